@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/keola-dunn/autolog/internal/calendar"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+	"github.com/keola-dunn/autolog/internal/service/signingkey"
+)
+
+// auth-keys manages the auth server's signing keyring. Intended to be run on a schedule to
+// rotate keys (ex. monthly cron), or by hand to replace a compromised key.
+//
+//	auth-keys list                          list keys and their status
+//	auth-keys rotate [-alg ES256] [-force]  activate the next key and create a new next key
+//	auth-keys next [-alg EdDSA]             replace the next key, ex. to switch algorithms
+//	auth-keys retire <kid>                  stop publishing a key now
+
+var environmentConfig struct {
+	DBUser     string `envconfig:"DB_USER"`
+	DBPassword string `envconfig:"DB_PASSWORD"`
+	DBHost     string `envconfig:"DB_HOST"`
+	DBPort     int64  `envconfig:"DB_PORT"`
+	DBSchema   string `envconfig:"DB_SCHEMA"`
+
+	// these must match the auth server's configs
+	SigningKeyEncryptionSecret string `envconfig:"SIGNING_KEY_ENCRYPTION_SECRET" required:"true"`
+	SigningKeyAlgorithm        string `envconfig:"SIGNING_KEY_ALGORITHM" default:"RS256"`
+	SigningKeyRetireAfterHours int64  `envconfig:"SIGNING_KEY_RETIRE_AFTER_HOURS" default:"24"`
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: auth-keys list | rotate [-alg alg] [-force] | next [-alg alg] | retire <kid>")
+	os.Exit(2)
+}
+
+func main() {
+	logger := logger.NewLogger()
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	// attempt to retrieve env vars from env file. This is for local dev only
+	if err := godotenv.Load(); err != nil {
+		logger.Error("failed to load .env file", err)
+	}
+
+	if err := envconfig.Process("", &environmentConfig); err != nil {
+		logger.Fatal("failed to process environment config", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	db, err := postgres.NewConnectionPool(ctx, postgres.ConnectionPoolConfig{
+		ConnectionConfig: postgres.ConnectionConfig{
+			User:     environmentConfig.DBUser,
+			Password: environmentConfig.DBPassword,
+			Host:     environmentConfig.DBHost,
+			Port:     environmentConfig.DBPort,
+			Schema:   environmentConfig.DBSchema,
+		},
+		MaxConnections:        1,
+		MinConnections:        1,
+		MaxConnectionIdleTime: time.Minute,
+	})
+	if err != nil {
+		logger.Fatal("failed to connect to the database", err)
+	}
+	defer db.Close()
+
+	signingKeySvc, err := signingkey.NewService(signingkey.ServiceConfig{
+		DB:               db,
+		CalendarService:  calendar.NewService(),
+		EncryptionSecret: []byte(environmentConfig.SigningKeyEncryptionSecret),
+		Algorithm:        signingkey.Algorithm(environmentConfig.SigningKeyAlgorithm),
+		RetireAfter:      time.Duration(environmentConfig.SigningKeyRetireAfterHours) * time.Hour,
+	})
+	if err != nil {
+		logger.Fatal("failed to create signing key service", err)
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	alg := flags.String("alg", "", "algorithm of the new next key, RS256, ES256 or EdDSA. Defaults to SIGNING_KEY_ALGORITHM")
+	force := flags.Bool("force", false, "activate the next key even if verifiers may not have fetched it yet")
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "list":
+		// listed below
+	case "rotate":
+		key, err := signingKeySvc.Rotate(ctx, signingkey.RotateInput{
+			Algorithm: signingkey.Algorithm(*alg),
+			Force:     *force,
+		})
+		if err != nil {
+			logger.Fatal("failed to rotate signing keys", err)
+		}
+		logger.Info("rotated signing keys", "kid", key.Id, "algorithm", string(key.Algorithm))
+	case "next":
+		key, err := signingKeySvc.CreateNextKey(ctx, signingkey.Algorithm(*alg))
+		if err != nil {
+			logger.Fatal("failed to create next signing key", err)
+		}
+		logger.Info("created next signing key", "kid", key.Id, "algorithm", string(key.Algorithm))
+	case "retire":
+		if flags.NArg() != 1 {
+			usage()
+		}
+		if err := signingKeySvc.RetireKey(ctx, flags.Arg(0)); err != nil {
+			logger.Fatal("failed to retire signing key", err)
+		}
+		logger.Info("retired signing key", "kid", flags.Arg(0))
+	default:
+		usage()
+	}
+
+	keys, err := signingKeySvc.ListKeys(ctx)
+	if err != nil {
+		logger.Fatal("failed to list signing keys", err)
+	}
+
+	keyring := signingkey.NewKeyring(keys, time.Now().UTC())
+	signingKey, _ := keyring.SigningKey()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALGORITHM\tSTATUS\tCREATED\tACTIVATED\tRETIRES")
+	for _, key := range keys {
+		status := string(key.Status(time.Now().UTC()))
+		if key.Id == signingKey.Id {
+			status += " (signing)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.Id, key.Algorithm, status,
+			formatTime(&key.CreatedAt), formatTime(key.ActivatedAt), formatTime(key.RetiredAt))
+	}
+	w.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+)
+
+// Login methods recorded as the detail of login events
+const (
+	loginMethodPassword = "password"
+	loginMethodMFA      = "mfa"
+	loginMethodPasskey  = "passkey"
+	loginMethodExternal = "external"
+)
+
+// recordAuthEvent adds the event to the audit trail with the request's IP address, user agent
+// and id. Failing to record it doesn't fail the request, it's only logged.
+func (h *AuthHandler) recordAuthEvent(r *http.Request, event audit.Event) {
+	event.IPAddress = clientIP(r)
+	event.UserAgent = r.UserAgent()
+	event.RequestId = logger.GetRequestId(r.Context())
+
+	if err := h.auditService.RecordEvent(r.Context(), event); err != nil {
+		logger.GetLogEntry(r).Error("failed to record "+string(event.Type)+" auth event", err)
+	}
+}
@@ -1,14 +1,24 @@
 package auth
 
 import (
-	"crypto/rsa"
+	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/keola-dunn/autolog/internal/calendar"
 	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
 	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/oidc"
 	"github.com/keola-dunn/autolog/internal/random"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/email"
+	"github.com/keola-dunn/autolog/internal/service/mfa"
+	"github.com/keola-dunn/autolog/internal/service/oauth"
+	"github.com/keola-dunn/autolog/internal/service/passkey"
+	"github.com/keola-dunn/autolog/internal/service/signingkey"
+	"github.com/keola-dunn/autolog/internal/service/token"
 	"github.com/keola-dunn/autolog/internal/service/user"
 )
 
@@ -19,60 +29,178 @@ type AuthHandler struct {
 	jwtIssuer              string
 	jwtExpiryLengthMinutes int64
 
+	// userTokenAudiences are the services user tokens may be used with
+	userTokenAudiences []string
+
+	// issuerUrl is the auth server's public url, the issuer of ID tokens
+	issuerUrl string
+
+	// appBaseUrl is where links in emails sent to users point
+	appBaseUrl       string
+	emailTokenSecret []byte
+
 	// foundationals/platform
 	calendarService calendar.ServiceIface
 	randomGenerator random.ServiceIface
 	logger          *logger.Logger
 
 	// services
-	userService user.ServiceIface
+	userService  user.ServiceIface
+	tokenService token.ServiceIface
+	emailService email.ServiceIface
+	mfaService   mfa.ServiceIface
+	auditService audit.ServiceIface
+
+	passkeyService passkey.ServiceIface
+	oauthService   oauth.ServiceIface
+
+	// oidcProviders are the external providers users can log in with, by name
+	oidcProviders map[string]*oidc.Provider
 
-	jwtPublicKeyData []byte
-	jwtPublicKey     *rsa.PublicKey
+	// signingKeyService holds the keyring tokens are signed and verified with
+	signingKeyService signingkey.ServiceIface
 
-	jwtPrivateKeyData []byte
-	jwtPrivateKey     *rsa.PrivateKey
+	jwtVerifier *autologjwt.TokenVerifier
 }
 
 type AuthHandlerConfig struct {
 	JWTIssuer              string
 	JWTExpiryLengthMinutes int64
 
+	// JWTAudience is the auth server's own audience. Its authenticated endpoints only accept
+	// tokens for it.
+	JWTAudience string
+
+	// UserTokenAudiences are the services tokens issued to users and OAuth clients may be used
+	// with. Must include JWTAudience.
+	UserTokenAudiences []string
+
+	// IssuerUrl is the auth server's public url as an OpenID provider, ex. https://auth.autolog.app
+	IssuerUrl string
+
+	// AppBaseUrl is the base url of the app links in emails point to, ex. https://autolog.app
+	AppBaseUrl string
+
+	// EmailTokenSecret signs the tokens emailed to users to verify their addresses
+	EmailTokenSecret []byte
+
 	// foundationals/platform
 	CalendarService calendar.ServiceIface
 	RandomGenerator random.ServiceIface
 	Logger          *logger.Logger
 
 	// services
-	UserService user.ServiceIface
+	UserService  user.ServiceIface
+	TokenService token.ServiceIface
+	EmailService email.ServiceIface
+	MFAService   mfa.ServiceIface
+	AuditService audit.ServiceIface
+
+	PasskeyService passkey.ServiceIface
+	OAuthService   oauth.ServiceIface
+
+	// OIDCProviders are the external providers users can log in with, optional
+	OIDCProviders []*oidc.Provider
 
-	JWTPublicKeyData  []byte
-	JWTPrivateKeyData []byte
+	SigningKeyService signingkey.ServiceIface
 }
 
 func NewAuthHandler(config AuthHandlerConfig) (*AuthHandler, error) {
-	pubKey, err := jwt.ParseRSAPublicKeyFromPEM(config.JWTPublicKeyData)
+	if len(config.EmailTokenSecret) < 32 {
+		return nil, fmt.Errorf("email token secret must be at least 32 bytes")
+	}
+
+	if config.SigningKeyService == nil {
+		return nil, fmt.Errorf("missing required signing key service")
+	}
+
+	if config.AuditService == nil {
+		return nil, fmt.Errorf("missing required audit service")
+	}
+
+	if config.JWTAudience != "" && !slices.Contains(config.UserTokenAudiences, config.JWTAudience) {
+		return nil, fmt.Errorf("user token audiences must include the jwt audience %q", config.JWTAudience)
+	}
+
+	// the auth server verifies its own tokens against its keyring, and checks revocations
+	// against its own database
+	keyFunc := func(token *jwt.Token) (any, error) {
+		keyring, err := config.SigningKeyService.GetKeyring(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get signing keyring: %w", err)
+		}
+		return keyring.Keyfunc(token)
+	}
+	revocationChecker := &tokenRevocationChecker{
+		tokenService: config.TokenService,
+	}
+
+	// revocation and introspection work on any token the auth server issued, whatever service
+	// it's for
+	jwtVerifier, err := autologjwt.NewLocalTokenVerifier(autologjwt.LocalTokenVerifierConfig{
+		KeyFunc:           keyFunc,
+		Issuer:            config.JWTIssuer,
+		RevocationChecker: revocationChecker,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %w", err)
+		return nil, fmt.Errorf("failed to create token verifier: %w", err)
 	}
-	privKey, err := jwt.ParseRSAPrivateKeyFromPEM(config.JWTPrivateKeyData)
+
+	audienceVerifier, err := autologjwt.NewLocalTokenVerifier(autologjwt.LocalTokenVerifierConfig{
+		KeyFunc:           keyFunc,
+		Issuer:            config.JWTIssuer,
+		Audience:          config.JWTAudience,
+		RevocationChecker: revocationChecker,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audience token verifier: %w", err)
+	}
+
+	authHandler, err := autologjwt.NewAuthHandler(autologjwt.AuthHandlerConfig{
+		TokenVerifier: audienceVerifier,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, fmt.Errorf("failed to create jwt auth handler: %w", err)
+	}
+
+	oidcProviders := make(map[string]*oidc.Provider, len(config.OIDCProviders))
+	for _, provider := range config.OIDCProviders {
+		if _, ok := oidcProviders[provider.Name()]; ok {
+			return nil, fmt.Errorf("duplicate oidc provider: %s", provider.Name())
+		}
+		oidcProviders[provider.Name()] = provider
 	}
 
 	return &AuthHandler{
+		AuthHandler: *authHandler,
+
 		jwtIssuer:              config.JWTIssuer,
 		jwtExpiryLengthMinutes: config.JWTExpiryLengthMinutes,
 
+		userTokenAudiences: config.UserTokenAudiences,
+
+		issuerUrl: strings.TrimSuffix(config.IssuerUrl, "/"),
+
+		appBaseUrl:       strings.TrimSuffix(config.AppBaseUrl, "/"),
+		emailTokenSecret: config.EmailTokenSecret,
+
 		calendarService: config.CalendarService,
 		randomGenerator: config.RandomGenerator,
 		logger:          config.Logger,
 
-		userService: config.UserService,
+		userService:  config.UserService,
+		tokenService: config.TokenService,
+		emailService: config.EmailService,
+		mfaService:   config.MFAService,
+		auditService: config.AuditService,
+
+		passkeyService: config.PasskeyService,
+		oauthService:   config.OAuthService,
+
+		oidcProviders: oidcProviders,
+
+		signingKeyService: config.SigningKeyService,
 
-		jwtPublicKeyData:  config.JWTPublicKeyData,
-		jwtPublicKey:      pubKey,
-		jwtPrivateKeyData: config.JWTPrivateKeyData,
-		jwtPrivateKey:     privKey,
+		jwtVerifier: jwtVerifier,
 	}, nil
 }
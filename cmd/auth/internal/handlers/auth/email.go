@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/email"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+// sendVerificationEmail emails the user a link to verify they own the address
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, userId, address string) error {
+	token, err := h.createEmailToken(userId, emailTokenClaims{
+		Purpose: emailTokenPurposeVerify,
+		Email:   address,
+	}, emailVerificationTokenExpiry)
+	if err != nil {
+		return fmt.Errorf("failed to create verification token: %w", err)
+	}
+
+	if err := h.emailService.Send(ctx, email.Message{
+		To:      address,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Verify your email address by following this link:\n\n%s\n\nThe link expires in %d hours.",
+			h.emailLink("/verify-email", token), int(emailVerificationTokenExpiry.Hours())),
+	}); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	return nil
+}
+
+// emailLink is a link to path in the app with the token as a query param
+func (h *AuthHandler) emailLink(path, token string) string {
+	return fmt.Sprintf("%s%s?token=%s", h.appBaseUrl, path, url.QueryEscape(token))
+}
+
+// ResendVerificationEmail sends a new verification email to the user's current address
+func (h *AuthHandler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	userEmail, err := h.userService.GetUserEmail(r.Context(), claims.GetUserId())
+	if err != nil {
+		logEntry.Error("failed to get user email", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if userEmail.Verified() {
+		httputil.RespondWithError(w, http.StatusConflict, "email address is already verified")
+		return
+	}
+
+	if err := h.sendVerificationEmail(r.Context(), claims.GetUserId(), userEmail.Email); err != nil {
+		logEntry.Error("failed to send verification email", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type emailTokenRequestBody struct {
+	Token string `json:"token"`
+}
+
+func readEmailTokenRequestBody(r *http.Request) (string, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	var reqBody emailTokenRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil || strings.TrimSpace(reqBody.Token) == "" {
+		return "", nil
+	}
+
+	return strings.TrimSpace(reqBody.Token), nil
+}
+
+// VerifyEmail verifies the user's email address with the token emailed to them. New tokens
+// issued to the user will have the email_verified claim.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	tokenString, err := readEmailTokenRequestBody(r)
+	if err != nil {
+		logEntry.Error("failed to read verify email request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if tokenString == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required token")
+		return
+	}
+
+	claims, err := h.parseEmailToken(tokenString, emailTokenPurposeVerify)
+	if err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid or expired token")
+		return
+	}
+
+	if err := h.userService.VerifyEmail(r.Context(), claims.Subject, claims.Email); err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			// the user's email has changed since the token was sent
+			httputil.RespondWithError(w, http.StatusBadRequest, "invalid or expired token")
+			return
+		}
+		logEntry.Error("failed to verify email", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type startEmailChangeRequestBody struct {
+	Email string `json:"email"`
+}
+
+type startEmailChangeResponse struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// StartEmailChange starts changing the user's email address. A confirmation link is sent to
+// both the current and new address, and the change is applied once both are followed.
+func (h *AuthHandler) StartEmailChange(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read email change request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody startEmailChangeRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if _, err := mail.ParseAddress(reqBody.Email); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "email address is invalid")
+		return
+	}
+
+	ctx := r.Context()
+
+	change, err := h.userService.StartEmailChange(ctx, claims.GetUserId(), reqBody.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrAlreadyExists):
+			httputil.RespondWithError(w, http.StatusConflict, "email already exists!")
+		case errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "email address is unchanged")
+		default:
+			logEntry.Error("failed to start email change", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	if err := h.sendEmailChangeConfirmations(ctx, change); err != nil {
+		logEntry.Error("failed to send email change confirmations", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusAccepted, startEmailChangeResponse{
+		ExpiresAt: change.ExpiresAt,
+	})
+}
+
+// sendEmailChangeConfirmations emails a confirmation link to both addresses of an email change
+func (h *AuthHandler) sendEmailChangeConfirmations(ctx context.Context, change user.EmailChange) error {
+	for _, recipient := range []struct {
+		address user.EmailChangeAddress
+		email   string
+		body    string
+	}{
+		{
+			address: user.EmailChangeAddressOld,
+			email:   change.OldEmail,
+			body:    fmt.Sprintf("A request was made to change your email address to %s. If this was you, confirm the change by following this link:", change.NewEmail),
+		},
+		{
+			address: user.EmailChangeAddressNew,
+			email:   change.NewEmail,
+			body:    "Confirm this is your new email address by following this link:",
+		},
+	} {
+		token, err := h.createEmailToken(change.UserId, emailTokenClaims{
+			Purpose:  emailTokenPurposeConfirmChange,
+			Email:    recipient.email,
+			ChangeId: change.Id,
+			Address:  string(recipient.address),
+		}, emailChangeTokenExpiry)
+		if err != nil {
+			return fmt.Errorf("failed to create email change token: %w", err)
+		}
+
+		if err := h.emailService.Send(ctx, email.Message{
+			To:      recipient.email,
+			Subject: "Confirm your email address change",
+			Body:    fmt.Sprintf("%s\n\n%s", recipient.body, h.emailLink("/confirm-email-change", token)),
+		}); err != nil {
+			return fmt.Errorf("failed to send email change confirmation: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type confirmEmailChangeResponse struct {
+	// Completed is true once both addresses have confirmed and the email has been changed
+	Completed bool `json:"completed"`
+}
+
+// ConfirmEmailChange confirms an email change for one of its addresses with the token emailed
+// to it
+func (h *AuthHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	tokenString, err := readEmailTokenRequestBody(r)
+	if err != nil {
+		logEntry.Error("failed to read confirm email change request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if tokenString == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required token")
+		return
+	}
+
+	claims, err := h.parseEmailToken(tokenString, emailTokenPurposeConfirmChange)
+	if err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid or expired token")
+		return
+	}
+
+	change, err := h.userService.ConfirmEmailChange(r.Context(), claims.ChangeId, user.EmailChangeAddress(claims.Address))
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrNotFound), errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "invalid or expired token")
+		case errors.Is(err, user.ErrAlreadyExists):
+			httputil.RespondWithError(w, http.StatusConflict, "email already exists!")
+		default:
+			logEntry.Error("failed to confirm email change", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, confirmEmailChangeResponse{
+		Completed: change.Completed(),
+	})
+}
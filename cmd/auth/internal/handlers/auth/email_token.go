@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var errInvalidEmailToken = errors.New("invalid email token")
+
+// emailTokenPurpose is what an email token can be used for, so a token sent for one flow
+// can't be used in another
+type emailTokenPurpose string
+
+const (
+	emailTokenPurposeVerify        = emailTokenPurpose("verify_email")
+	emailTokenPurposeConfirmChange = emailTokenPurpose("confirm_email_change")
+)
+
+const (
+	emailVerificationTokenExpiry = 72 * time.Hour
+	emailChangeTokenExpiry       = 24 * time.Hour
+)
+
+// emailTokenClaims are the claims of tokens emailed to users. They are signed with HMAC using
+// a separate secret, so they can never be mistaken for access tokens.
+type emailTokenClaims struct {
+	jwt.RegisteredClaims
+
+	Purpose emailTokenPurpose `json:"purpose"`
+	Email   string            `json:"email"`
+
+	// ChangeId and Address identify the email change and which of its addresses the token was
+	// sent to. Only set for change confirmations.
+	ChangeId string `json:"change_id,omitempty"`
+	Address  string `json:"address,omitempty"`
+}
+
+// createEmailToken signs a token for the user that expires after expiresIn
+func (h *AuthHandler) createEmailToken(userId string, claims emailTokenClaims, expiresIn time.Duration) (string, error) {
+	now := h.calendarService.NowUTC()
+
+	claims.Subject = userId
+	claims.Issuer = h.jwtIssuer
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(expiresIn))
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.emailTokenSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign email token: %w", err)
+	}
+
+	return token, nil
+}
+
+// parseEmailToken validates the token and that it was issued for purpose
+func (h *AuthHandler) parseEmailToken(tokenString string, purpose emailTokenPurpose) (emailTokenClaims, error) {
+	var claims emailTokenClaims
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		return h.emailTokenSecret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(h.jwtIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return emailTokenClaims{}, errInvalidEmailToken
+	}
+
+	if claims.Purpose != purpose || claims.Subject == "" || claims.Email == "" {
+		return emailTokenClaims{}, errInvalidEmailToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/oidc"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+type listExternalProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// ListExternalProviders lists the external providers users can log in with
+func (h *AuthHandler) ListExternalProviders(w http.ResponseWriter, r *http.Request) {
+	resp := listExternalProvidersResponse{
+		Providers: make([]string, 0, len(h.oidcProviders)),
+	}
+	for name := range h.oidcProviders {
+		resp.Providers = append(resp.Providers, name)
+	}
+	sort.Strings(resp.Providers)
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+type startExternalLoginResponse struct {
+	// AuthorizationUrl is where to send the user to log in with the provider
+	AuthorizationUrl string    `json:"authorizationUrl"`
+	State            string    `json:"state"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+}
+
+// StartExternalLogin starts a login with an external provider
+func (h *AuthHandler) StartExternalLogin(w http.ResponseWriter, r *http.Request) {
+	h.startExternalLogin(w, r, "")
+}
+
+// StartExternalLink starts linking an external provider to the logged in user's account
+func (h *AuthHandler) StartExternalLink(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	h.startExternalLogin(w, r, claims.GetUserId())
+}
+
+func (h *AuthHandler) startExternalLogin(w http.ResponseWriter, r *http.Request, linkUserId string) {
+	logEntry := logger.GetLogEntry(r)
+
+	provider, ok := h.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		httputil.RespondWithError(w, http.StatusNotFound, "unknown provider")
+		return
+	}
+
+	login, err := h.userService.StartExternalLogin(r.Context(), provider.Name(), linkUserId)
+	if err != nil {
+		logEntry.Error("failed to start external login", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, startExternalLoginResponse{
+		AuthorizationUrl: provider.AuthCodeURL(login.State, login.Nonce, login.CodeVerifier),
+		State:            login.State,
+		ExpiresAt:        login.ExpiresAt,
+	})
+}
+
+// externalCallbackRequestBody is what the provider redirected the user back to the app with
+type externalCallbackRequestBody struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// finishExternalLogin checks the state the provider sent the user back with, and exchanges the
+// code for the user's identity. Responds with an error and returns false if either is invalid.
+func (h *AuthHandler) finishExternalLogin(w http.ResponseWriter, r *http.Request) (user.ExternalLogin, user.ExternalIdentity, bool) {
+	logEntry := logger.GetLogEntry(r)
+
+	provider, ok := h.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		httputil.RespondWithError(w, http.StatusNotFound, "unknown provider")
+		return user.ExternalLogin{}, user.ExternalIdentity{}, false
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read external login request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return user.ExternalLogin{}, user.ExternalIdentity{}, false
+	}
+
+	var reqBody externalCallbackRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil ||
+		strings.TrimSpace(reqBody.Code) == "" ||
+		strings.TrimSpace(reqBody.State) == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required code or state")
+		return user.ExternalLogin{}, user.ExternalIdentity{}, false
+	}
+
+	ctx := r.Context()
+
+	login, err := h.userService.UseExternalLogin(ctx, provider.Name(), reqBody.State)
+	if err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "invalid or expired state, log in again")
+			return user.ExternalLogin{}, user.ExternalIdentity{}, false
+		}
+		logEntry.Error("failed to use external login", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return user.ExternalLogin{}, user.ExternalIdentity{}, false
+	}
+
+	claims, err := provider.Exchange(ctx, reqBody.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrExchangeFailed) || errors.Is(err, oidc.ErrInvalidIDToken) {
+			logEntry.Warn("external login failed verification", "provider", provider.Name(), "error", err)
+			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+			return user.ExternalLogin{}, user.ExternalIdentity{}, false
+		}
+		logEntry.Error("failed to exchange authorization code", err)
+		httputil.RespondWithError(w, http.StatusBadGateway, "")
+		return user.ExternalLogin{}, user.ExternalIdentity{}, false
+	}
+
+	return login, user.ExternalIdentity{
+		Provider:      provider.Name(),
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, true
+}
+
+// ExternalLoginCallback finishes a login with an external provider. Users that don't exist yet
+// are created. Users with 2FA enabled still need to complete it.
+func (h *AuthHandler) ExternalLoginCallback(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	login, identity, ok := h.finishExternalLogin(w, r)
+	if !ok {
+		return
+	}
+
+	// links are finished at the authenticated link callback, so they can't be used to log in
+	if login.LinkUserId != "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid or expired state, log in again")
+		return
+	}
+
+	userId, err := h.userService.LoginWithExternalIdentity(r.Context(), identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "the provider did not share an email address")
+		case errors.Is(err, user.ErrIdentityConflict):
+			httputil.RespondWithError(w, http.StatusConflict,
+				"an account with this email already exists, log in to it and link the provider instead")
+		default:
+			logEntry.Error("failed to log in with external identity", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	h.respondWithLogin(w, r, userId, loginMethodExternal+":"+identity.Provider)
+}
+
+type linkedIdentityResponse struct {
+	Id          string     `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func newLinkedIdentityResponse(i user.LinkedIdentity) linkedIdentityResponse {
+	return linkedIdentityResponse{
+		Id:          i.Id,
+		Provider:    i.Provider,
+		Email:       i.Email,
+		LastLoginAt: i.LastLoginAt,
+		CreatedAt:   i.CreatedAt,
+	}
+}
+
+// ExternalLinkCallback finishes linking an external provider to the logged in user's account
+func (h *AuthHandler) ExternalLinkCallback(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	login, identity, ok := h.finishExternalLogin(w, r)
+	if !ok {
+		return
+	}
+
+	// the link must be finished by the user who started it
+	if login.LinkUserId == "" || login.LinkUserId != claims.GetUserId() {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid or expired state, link again")
+		return
+	}
+
+	linked, err := h.userService.LinkExternalIdentity(r.Context(), claims.GetUserId(), identity)
+	if err != nil {
+		if errors.Is(err, user.ErrAlreadyExists) {
+			httputil.RespondWithError(w, http.StatusConflict, "the account is already linked to a user")
+			return
+		}
+		logEntry.Error("failed to link external identity", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusCreated, newLinkedIdentityResponse(linked))
+}
+
+type listLinkedIdentitiesResponse struct {
+	Identities []linkedIdentityResponse `json:"identities"`
+}
+
+// ListLinkedIdentities lists the external providers linked to the user's account
+func (h *AuthHandler) ListLinkedIdentities(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	identities, err := h.userService.ListExternalIdentities(r.Context(), claims.GetUserId())
+	if err != nil {
+		logEntry.Error("failed to list external identities", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := listLinkedIdentitiesResponse{
+		Identities: make([]linkedIdentityResponse, 0, len(identities)),
+	}
+	for _, i := range identities {
+		resp.Identities = append(resp.Identities, newLinkedIdentityResponse(i))
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// UnlinkIdentity removes an external provider from the user's account
+func (h *AuthHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	err := h.userService.UnlinkExternalIdentity(r.Context(), claims.GetUserId(), chi.URLParam(r, "identityId"))
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+		case errors.Is(err, user.ErrLastLoginMethod):
+			httputil.RespondWithError(w, http.StatusConflict,
+				"add a password or passkey before removing your only way to log in")
+		default:
+			logEntry.Error("failed to unlink external identity", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -8,19 +8,32 @@ import (
 	"github.com/keola-dunn/autolog/internal/logger"
 )
 
+// GetWellKnownJWKS publishes every key that isn't retired. Next keys are published before they
+// sign anything, so verifiers already have them when they're rotated in.
 func (a *AuthHandler) GetWellKnownJWKS(w http.ResponseWriter, r *http.Request) {
 	logEntry := logger.GetLogEntry(r)
 
-	jwk, err := jwt.ConvertPublicKeyPEMToJWK("autolog-public-key", a.jwtPublicKey)
+	keyring, err := a.signingKeyService.GetKeyring(r.Context())
 	if err != nil {
-		logEntry.Error("failed to convert public key pem to jwk", err)
+		logEntry.Error("failed to get signing keyring", err)
 		httputil.RespondWithError(w, http.StatusInternalServerError, "")
 		return
 	}
 
-	httputil.RespondWithJSON(w, http.StatusOK, jwt.JWKS{
-		Keys: []jwt.JWK{
-			jwk,
-		},
-	})
+	publishedKeys := keyring.PublishedKeys()
+
+	jwks := jwt.JWKS{
+		Keys: make([]jwt.JWK, 0, len(publishedKeys)),
+	}
+	for _, key := range publishedKeys {
+		jwk, err := jwt.ConvertPublicKeyToJWK(key.Id, string(key.Algorithm), key.PublicKey)
+		if err != nil {
+			logEntry.Error("failed to convert public key to jwk", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+			return
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, jwks)
 }
@@ -1,28 +1,121 @@
 package auth
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/service/signingkey"
+	"github.com/keola-dunn/autolog/internal/service/token"
+	"github.com/keola-dunn/autolog/internal/service/user"
 )
 
-func (h *AuthHandler) createJWT(userId string) (string, error) {
+// accessToken is an access JWT along with the claims needed to revoke it
+type accessToken struct {
+	jwt string
+
+	// id is the jti
+	id        string
+	expiresAt time.Time
+}
+
+func (h *AuthHandler) createJWT(ctx context.Context, userId string) (accessToken, error) {
+	return h.createAccessToken(ctx, userId, "", "")
+}
+
+// createClientJWT creates an access JWT for an OAuth client, limited to the granted scope
+func (h *AuthHandler) createClientJWT(ctx context.Context, userId, clientId, scope string) (string, error) {
+	jwtToken, err := h.createAccessToken(ctx, userId, clientId, scope)
+	if err != nil {
+		return "", err
+	}
+	return jwtToken.jwt, nil
+}
+
+func (h *AuthHandler) createAccessToken(ctx context.Context, userId, clientId, scope string) (accessToken, error) {
 	now := h.calendarService.NowUTC()
 
+	userEmail, err := h.userService.GetUserEmail(ctx, userId)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("failed to get user email: %w", err)
+	}
+
+	roles, err := h.userService.GetUserRoles(ctx, userId)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	signingKey, err := h.signingKey(ctx)
+	if err != nil {
+		return accessToken{}, err
+	}
+
+	tokenId, err := h.randomGenerator.RandomUUID()
+	if err != nil {
+		return accessToken{}, fmt.Errorf("failed to create random token id: %w", err)
+	}
+
+	expiresAt := now.Add(h.jwtExpiryLength())
+
+	jwtToken, err := autologjwt.CreateJWT(autologjwt.CreateJWTInput{
+		Issuer:        h.jwtIssuer,
+		UserId:        userId,
+		Audience:      h.userTokenAudiences,
+		IssuedAt:      now,
+		ExpiresAt:     expiresAt,
+		NotBefore:     now,
+		Id:            tokenId,
+		EmailVerified: userEmail.Verified(),
+		ClientId:      clientId,
+		Scope:         scope,
+		Roles:         roleClaims(roles),
+		Permissions:   permissionClaims(user.PermissionsForRoles(roles)),
+		KeyId:         signingKey.Id,
+		PrivateKey:    signingKey.PrivateKey,
+	})
+	if err != nil {
+		return accessToken{}, fmt.Errorf("failed to create jwt: %w", err)
+	}
+
+	return accessToken{
+		jwt:       jwtToken,
+		id:        tokenId,
+		expiresAt: expiresAt,
+	}, nil
+}
+
+// createServiceJWT creates an access JWT for a service client, for the audience it's calling and
+// limited to the granted permissions. The service is the token's subject.
+func (h *AuthHandler) createServiceJWT(ctx context.Context, clientId, audience string,
+	permissions []string) (string, error) {
+	now := h.calendarService.NowUTC()
+
+	signingKey, err := h.signingKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
 	tokenId, err := h.randomGenerator.RandomUUID()
 	if err != nil {
 		return "", fmt.Errorf("failed to create random token id: %w", err)
 	}
 
 	jwtToken, err := autologjwt.CreateJWT(autologjwt.CreateJWTInput{
-		Issuer:     h.jwtIssuer,
-		UserId:     userId,
-		IssuedAt:   now,
-		ExpiresAt:  now.Add(time.Duration(h.jwtExpiryLengthMinutes) * time.Minute),
-		NotBefore:  now,
-		Id:         tokenId,
-		PrivateKey: h.jwtPrivateKeyData,
+		Issuer:      h.jwtIssuer,
+		UserId:      clientId,
+		Audience:    []string{audience},
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(h.jwtExpiryLength()),
+		NotBefore:   now,
+		Id:          tokenId,
+		ClientId:    clientId,
+		Scope:       strings.Join(permissions, " "),
+		Permissions: permissions,
+		KeyId:       signingKey.Id,
+		PrivateKey:  signingKey.PrivateKey,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to create jwt: %w", err)
@@ -30,3 +123,90 @@ func (h *AuthHandler) createJWT(userId string) (string, error) {
 
 	return jwtToken, nil
 }
+
+func roleClaims(roles []user.Role) []string {
+	claims := make([]string, 0, len(roles))
+	for _, role := range roles {
+		claims = append(claims, string(role))
+	}
+	return claims
+}
+
+func permissionClaims(permissions []user.Permission) []string {
+	claims := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		claims = append(claims, string(permission))
+	}
+	return claims
+}
+
+// signingKey is the keyring's active key that tokens are signed with
+func (h *AuthHandler) signingKey(ctx context.Context) (signingkey.Key, error) {
+	keyring, err := h.signingKeyService.GetKeyring(ctx)
+	if err != nil {
+		return signingkey.Key{}, fmt.Errorf("failed to get signing keyring: %w", err)
+	}
+
+	key, err := keyring.SigningKey()
+	if err != nil {
+		return signingkey.Key{}, fmt.Errorf("failed to get signing key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (h *AuthHandler) jwtExpiryLength() time.Duration {
+	return time.Duration(h.jwtExpiryLengthMinutes) * time.Minute
+}
+
+// tokenResponse is returned whenever the auth server issues tokens to a user
+type tokenResponse struct {
+	JWT string `json:"jwt"`
+
+	// RefreshToken can be exchanged once for a new JWT and refresh token at /v1/auth/refresh
+	RefreshToken          string    `json:"refreshToken"`
+	RefreshTokenExpiresAt time.Time `json:"refreshTokenExpiresAt"`
+}
+
+// issueTokens creates an access JWT and a new refresh token family for the user, starting a
+// session for the device the request came from
+func (h *AuthHandler) issueTokens(r *http.Request, userId string) (tokenResponse, error) {
+	ctx := r.Context()
+
+	jwtToken, err := h.createJWT(ctx, userId)
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("failed to create jwt: %w", err)
+	}
+
+	refreshToken, err := h.tokenService.CreateRefreshToken(ctx, userId)
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	if err := h.recordSession(r, refreshToken, jwtToken); err != nil {
+		return tokenResponse{}, err
+	}
+
+	return tokenResponse{
+		JWT:                   jwtToken.jwt,
+		RefreshToken:          refreshToken.Token,
+		RefreshTokenExpiresAt: refreshToken.ExpiresAt,
+	}, nil
+}
+
+// recordSession starts or updates the session of the refresh token's family with the device
+// the request came from and the access token issued with it
+func (h *AuthHandler) recordSession(r *http.Request, refreshToken token.RefreshToken, jwtToken accessToken) error {
+	if err := h.tokenService.RecordSession(r.Context(), token.RecordSessionInput{
+		FamilyId:             refreshToken.FamilyId,
+		UserId:               refreshToken.UserId,
+		IPAddress:            clientIP(r),
+		UserAgent:            r.UserAgent(),
+		AccessTokenId:        jwtToken.id,
+		AccessTokenExpiresAt: jwtToken.expiresAt,
+	}); err != nil {
+		return fmt.Errorf("failed to record session: %w", err)
+	}
+
+	return nil
+}
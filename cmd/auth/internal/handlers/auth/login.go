@@ -1,45 +1,207 @@
 package auth
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/keola-dunn/autolog/internal/httputil"
 	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/email"
+	"github.com/keola-dunn/autolog/internal/service/mfa"
+	"github.com/keola-dunn/autolog/internal/service/user"
 )
 
 type LoginResponse struct {
-	JWT string `json:"jwt"`
+	tokenResponse
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
 	logEntry := logger.GetLogEntry(r)
-	user, pass, ok := r.BasicAuth()
+	login, pass, ok := r.BasicAuth()
 	if !ok {
 		httputil.RespondWithError(w, http.StatusUnauthorized, "missing required user/pass")
 		return
 	}
 
-	valid, userId, err := h.userService.ValidateCredentials(ctx, user, pass)
+	userId, err := h.checkPasswordLogin(r, login, pass)
 	if err != nil {
-		logEntry.Error("failed to validate credentials", err)
-		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		var throttled *user.LoginThrottledError
+		switch {
+		case errors.Is(err, errInvalidCredentials):
+			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		case errors.As(err, &throttled):
+			w.Header().Set("Retry-After", retryAfterSeconds(throttled.RetryAfter))
+			httputil.RespondWithError(w, http.StatusTooManyRequests, throttled.Error())
+		default:
+			logEntry.Error("failed to check password login", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
 		return
 	}
+
+	h.respondWithLogin(w, r, userId, loginMethodPassword)
+}
+
+// errInvalidCredentials is returned by checkPasswordLogin for a wrong login or password
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// checkPasswordLogin checks a password login, with brute force protection. Returns the user's
+// id, errInvalidCredentials if the login or password is wrong, or a *user.LoginThrottledError if
+// the account or client has failed too many logins recently.
+func (h *AuthHandler) checkPasswordLogin(r *http.Request, login, password string) (string, error) {
+	ctx := r.Context()
+
+	if strings.TrimSpace(login) == "" || strings.TrimSpace(password) == "" {
+		return "", errInvalidCredentials
+	}
+
+	attempt, err := h.userService.StartLoginAttempt(ctx, login, clientIP(r))
+	if err != nil {
+		var throttled *user.LoginThrottledError
+		if errors.As(err, &throttled) {
+			h.recordAuthEvent(r, audit.Event{
+				Type:   audit.EventLoginFailed,
+				UserId: attempt.UserId(),
+				Login:  login,
+				Detail: loginThrottledDetail(throttled),
+			})
+		}
+		return "", err
+	}
+
+	valid, userId, err := h.userService.ValidateCredentials(ctx, login, password)
+	if err != nil {
+		return "", fmt.Errorf("failed to validate credentials: %w", err)
+	}
+
 	if !valid {
-		httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		locked, err := h.userService.FailLoginAttempt(ctx, attempt)
+		if err != nil {
+			return "", fmt.Errorf("failed to record failed login: %w", err)
+		}
+
+		h.recordAuthEvent(r, audit.Event{
+			Type:   audit.EventLoginFailed,
+			UserId: attempt.UserId(),
+			Login:  login,
+			Detail: "invalid_credentials",
+		})
+
+		if locked {
+			// the login still fails if the user can't be told
+			if err := h.sendLockoutEmail(ctx, attempt.UserId()); err != nil {
+				logger.GetLogEntry(r).Error("failed to send lockout email", err)
+			}
+		}
+
+		return "", errInvalidCredentials
+	}
+
+	if err := h.userService.SucceedLoginAttempt(ctx, attempt); err != nil {
+		return "", fmt.Errorf("failed to record successful login: %w", err)
+	}
+
+	return userId, nil
+}
+
+// loginThrottledDetail is the audit event detail for a throttled login
+func loginThrottledDetail(throttled *user.LoginThrottledError) string {
+	if throttled.Locked {
+		return "locked_out"
+	}
+	return "rate_limited"
+}
+
+// sendLockoutEmail tells the user their account was locked after too many failed logins
+func (h *AuthHandler) sendLockoutEmail(ctx context.Context, userId string) error {
+	userEmail, err := h.userService.GetUserEmail(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("failed to get user email: %w", err)
+	}
+
+	if err := h.emailService.Send(ctx, email.Message{
+		To:      userEmail.Email,
+		Subject: "Your account has been temporarily locked",
+		Body: "There were too many failed attempts to log in to your account, so logging in has been " +
+			"locked for 15 minutes.\n\nIf this wasn't you, someone may be guessing your password. " +
+			"Consider resetting it, and turning on two-factor authentication.",
+	}); err != nil {
+		return fmt.Errorf("failed to send lockout email: %w", err)
+	}
+
+	return nil
+}
+
+// clientIP is the address the request came from. RemoteAddr is only the client's own address
+// when proxy headers are trusted, see TRUST_PROXY_HEADERS.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfterSeconds formats a Retry-After header, rounding up so clients don't retry early
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
+
+// respondWithLogin responds to a successful first factor with tokens, or with an MFA challenge
+// if the user has 2FA enabled. method is how the user logged in, for the audit trail.
+func (h *AuthHandler) respondWithLogin(w http.ResponseWriter, r *http.Request, userId, method string) {
+	ctx := r.Context()
+	logEntry := logger.GetLogEntry(r)
+
+	mfaEnabled, err := h.mfaService.IsTOTPEnabled(ctx, userId)
+	if err != nil {
+		logEntry.Error("failed to check if mfa is enabled", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
 		return
 	}
 
-	jwtToken, err := h.createJWT(userId)
+	if mfaEnabled {
+		// the password was right, but tokens aren't issued until the second factor is
+		challenge, err := h.mfaService.CreateChallenge(ctx, userId)
+		if err != nil {
+			if errors.Is(err, mfa.ErrLockedOut) {
+				httputil.RespondWithError(w, http.StatusTooManyRequests, "too many failed attempts, try again later")
+				return
+			}
+			logEntry.Error("failed to create mfa challenge", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+			return
+		}
+
+		httputil.RespondWithJSON(w, http.StatusOK, mfaChallengeResponse{
+			MFARequired:       true,
+			MFAToken:          challenge.Token,
+			MFATokenExpiresAt: challenge.ExpiresAt,
+		})
+		return
+	}
+
+	tokens, err := h.issueTokens(r, userId)
 	if err != nil {
-		logEntry.Error("failed to create jwt", err)
+		logEntry.Error("failed to issue tokens", err)
 		httputil.RespondWithError(w, http.StatusInternalServerError, "")
 		return
 	}
 
+	h.recordAuthEvent(r, audit.Event{
+		Type:   audit.EventLoginSucceeded,
+		UserId: userId,
+		Detail: method,
+	})
+
 	httputil.RespondWithJSON(w, http.StatusOK, LoginResponse{
-		JWT: jwtToken,
+		tokenResponse: tokens,
 	})
 }
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/mfa"
+)
+
+// mfaChallengeResponse is returned by Login instead of tokens when the user has 2FA enabled.
+// The MFA token is exchanged for tokens at /v1/auth/login/mfa along with a code.
+type mfaChallengeResponse struct {
+	MFARequired       bool      `json:"mfaRequired"`
+	MFAToken          string    `json:"mfaToken"`
+	MFATokenExpiresAt time.Time `json:"mfaTokenExpiresAt"`
+}
+
+type loginMFARequestBody struct {
+	MFAToken string `json:"mfaToken"`
+
+	// Code is a TOTP code from the user's authenticator, or one of their recovery codes
+	Code string `json:"code"`
+}
+
+// LoginMFA completes a login for a user with 2FA enabled, exchanging the MFA token from Login
+// and a valid code for tokens
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read mfa login request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody loginMFARequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil ||
+		strings.TrimSpace(reqBody.MFAToken) == "" ||
+		strings.TrimSpace(reqBody.Code) == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required mfa token or code")
+		return
+	}
+
+	ctx := r.Context()
+
+	userId, err := h.mfaService.VerifyChallenge(ctx, reqBody.MFAToken, reqBody.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, mfa.ErrInvalidCode):
+			h.recordAuthEvent(r, audit.Event{
+				Type:   audit.EventLoginFailed,
+				UserId: userId,
+				Detail: "invalid_mfa_code",
+			})
+			httputil.RespondWithError(w, http.StatusUnauthorized, "invalid code")
+		case errors.Is(err, mfa.ErrInvalidChallenge), errors.Is(err, mfa.ErrNotEnabled):
+			httputil.RespondWithError(w, http.StatusUnauthorized, "invalid or expired mfa token, log in again")
+		case errors.Is(err, mfa.ErrLockedOut):
+			httputil.RespondWithError(w, http.StatusTooManyRequests, "too many failed attempts, try again later")
+		default:
+			logEntry.Error("failed to verify mfa challenge", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	tokens, err := h.issueTokens(r, userId)
+	if err != nil {
+		logEntry.Error("failed to issue tokens", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	h.recordAuthEvent(r, audit.Event{
+		Type:   audit.EventLoginSucceeded,
+		UserId: userId,
+		Detail: loginMethodMFA,
+	})
+
+	httputil.RespondWithJSON(w, http.StatusOK, LoginResponse{
+		tokenResponse: tokens,
+	})
+}
+
+type startTOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+
+	// ProvisioningURI is the otpauth URI for the client to render as a QR code
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// StartTOTPEnrollment generates a TOTP secret for the user. 2FA is enabled once the user
+// confirms with a code from their authenticator.
+func (h *AuthHandler) StartTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	userEmail, err := h.userService.GetUserEmail(r.Context(), claims.GetUserId())
+	if err != nil {
+		logEntry.Error("failed to get user email", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	enrollment, err := h.mfaService.StartTOTPEnrollment(r.Context(), claims.GetUserId(), userEmail.Email)
+	if err != nil {
+		if errors.Is(err, mfa.ErrAlreadyEnabled) {
+			httputil.RespondWithError(w, http.StatusConflict, "two factor authentication is already enabled")
+			return
+		}
+		logEntry.Error("failed to start totp enrollment", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, startTOTPEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningURI: enrollment.ProvisioningURI,
+	})
+}
+
+type mfaCodeRequestBody struct {
+	Code string `json:"code"`
+}
+
+// readMFACode reads the code from the request body. Responds and returns false if it's missing.
+func readMFACode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.GetLogEntry(r).Error("failed to read mfa code request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return "", false
+	}
+
+	var reqBody mfaCodeRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil || strings.TrimSpace(reqBody.Code) == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required code")
+		return "", false
+	}
+
+	return reqBody.Code, true
+}
+
+type recoveryCodesResponse struct {
+	// RecoveryCodes can each be used once in place of a TOTP code. They can't be retrieved
+	// again.
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// ConfirmTOTPEnrollment enables 2FA with a code from the user's authenticator, and returns
+// their recovery codes
+func (h *AuthHandler) ConfirmTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	code, ok := readMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.mfaService.ConfirmTOTPEnrollment(r.Context(), claims.GetUserId(), code)
+	if err != nil {
+		switch {
+		case errors.Is(err, mfa.ErrInvalidCode):
+			httputil.RespondWithError(w, http.StatusBadRequest, "invalid code")
+		case errors.Is(err, mfa.ErrNotEnabled):
+			httputil.RespondWithError(w, http.StatusConflict, "two factor authentication enrollment has not been started")
+		case errors.Is(err, mfa.ErrAlreadyEnabled):
+			httputil.RespondWithError(w, http.StatusConflict, "two factor authentication is already enabled")
+		default:
+			logEntry.Error("failed to confirm totp enrollment", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, recoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// DisableTOTP turns off 2FA for the user with a valid TOTP or recovery code
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	code, ok := readMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.mfaService.DisableTOTP(r.Context(), claims.GetUserId(), code); err != nil {
+		respondWithMFACodeError(w, r, err, "failed to disable totp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with a valid TOTP or recovery code
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	code, ok := readMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.mfaService.RegenerateRecoveryCodes(r.Context(), claims.GetUserId(), code)
+	if err != nil {
+		respondWithMFACodeError(w, r, err, "failed to regenerate recovery codes")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, recoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func respondWithMFACodeError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, mfa.ErrInvalidCode):
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid code")
+	case errors.Is(err, mfa.ErrNotEnabled):
+		httputil.RespondWithError(w, http.StatusConflict, "two factor authentication is not enabled")
+	default:
+		logger.GetLogEntry(r).Error(message, err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/keola-dunn/autolog/internal/httputil"
+)
+
+// OAuth error codes, https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+const (
+	oauthErrorInvalidRequest       = "invalid_request"
+	oauthErrorUnsupportedTokenType = "unsupported_token_type"
+
+	oauthErrorInvalidClient           = "invalid_client"
+	oauthErrorInvalidGrant            = "invalid_grant"
+	oauthErrorInvalidScope            = "invalid_scope"
+	oauthErrorUnsupportedGrantType    = "unsupported_grant_type"
+	oauthErrorUnsupportedResponseType = "unsupported_response_type"
+	oauthErrorAccessDenied            = "access_denied"
+	oauthErrorLoginRequired           = "login_required"
+	oauthErrorServerError             = "server_error"
+
+	// oauthErrorUnauthorizedClient is for clients using a grant they aren't allowed
+	oauthErrorUnauthorizedClient = "unauthorized_client"
+
+	// oauthErrorInvalidTarget is for service tokens requested for an audience the client
+	// may not call, https://datatracker.ietf.org/doc/html/rfc8707#section-2
+	oauthErrorInvalidTarget = "invalid_target"
+)
+
+// Grant types, https://datatracker.ietf.org/doc/html/rfc6749#section-4
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypeClientCredentials = "client_credentials"
+)
+
+// Token type hints, https://datatracker.ietf.org/doc/html/rfc7009#section-2.1
+const (
+	tokenTypeHintAccessToken  = "access_token"
+	tokenTypeHintRefreshToken = "refresh_token"
+
+	// tokenTypeHintPersonalAccessToken isn't registered, it's for the auth server's own
+	// personal access tokens
+	tokenTypeHintPersonalAccessToken = "personal_access_token"
+)
+
+// oauthErrorResponse is the error format the OAuth specs require, which differs from
+// httputil.ErrorResponse
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func respondWithOAuthError(w http.ResponseWriter, statusCode int, oauthError, description string) {
+	httputil.RespondWithJSON(w, statusCode, oauthErrorResponse{
+		Error:            oauthError,
+		ErrorDescription: description,
+	})
+}
@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/random"
+	"github.com/keola-dunn/autolog/internal/service/mfa"
+	"github.com/keola-dunn/autolog/internal/service/oauth"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+//go:embed templates/authorize.html
+var templateFS embed.FS
+
+var authorizeTemplate = template.Must(template.ParseFS(templateFS, "templates/authorize.html"))
+
+const (
+	authorizeCSRFCookieName = "autolog_authorize_csrf"
+
+	codeChallengeMethodS256 = "S256"
+)
+
+// authorizeParams are the authorization request parameters carried through the hosted login
+// page's forms
+var authorizeParams = []string{
+	"client_id", "redirect_uri", "response_type", "scope", "state", "nonce",
+	"code_challenge", "code_challenge_method",
+}
+
+// authorizeRequest is an authorization request,
+// https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
+type authorizeRequest struct {
+	params url.Values
+
+	client oauth.Client
+
+	// scope is the scope granted to the client, set once the request is validated
+	scope string
+}
+
+// authorizeError is an error returned to the client at its redirect uri,
+// https://datatracker.ietf.org/doc/html/rfc6749#section-4.1.2.1
+type authorizeError struct {
+	code        string
+	description string
+}
+
+type authorizePage struct {
+	ClientName string
+	Params     map[string]string
+	CSRFToken  string
+
+	// MFAToken is set when the password was right and the user must enter their TOTP code
+	MFAToken string
+	Username string
+
+	Error string
+
+	// FatalError is shown instead of the form when the user can't be sent back to the client
+	FatalError string
+}
+
+// Authorize serves the hosted login page for the authorization code grant
+func (h *AuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	req, ok := h.loadAuthorizeRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	// there are no login sessions on the auth server, so users always have to log in
+	if r.URL.Query().Get("prompt") == "none" {
+		h.redirectWithAuthorizeError(w, r, req, authorizeError{code: oauthErrorLoginRequired})
+		return
+	}
+
+	csrfToken, err := h.setAuthorizeCSRFCookie(w)
+	if err != nil {
+		logEntry.Error("failed to set csrf cookie", err)
+		h.renderAuthorizePage(w, r, http.StatusInternalServerError, authorizePage{
+			FatalError: "Something went wrong, try again later.",
+		})
+		return
+	}
+
+	h.renderAuthorizePage(w, r, http.StatusOK, req.page(csrfToken))
+}
+
+// SubmitAuthorize handles the hosted login page's forms. Users log in with their password, then
+// their TOTP code if they have 2FA enabled, and are sent back to the client with a code.
+func (h *AuthHandler) SubmitAuthorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logEntry := logger.GetLogEntry(r)
+
+	if err := r.ParseForm(); err != nil {
+		h.renderAuthorizePage(w, r, http.StatusBadRequest, authorizePage{
+			FatalError: "The request is invalid.",
+		})
+		return
+	}
+
+	req, ok := h.loadAuthorizeRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	cookie, err := r.Cookie(authorizeCSRFCookieName)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostForm.Get("csrf_token"))) != 1 {
+		h.rerenderAuthorizePage(w, r, req, http.StatusForbidden, "Your session expired, try again.", "")
+		return
+	}
+
+	if r.PostForm.Get("action") == "cancel" {
+		h.redirectWithAuthorizeError(w, r, req, authorizeError{code: oauthErrorAccessDenied})
+		return
+	}
+
+	var userId string
+	if mfaToken := r.PostForm.Get("mfa_token"); mfaToken != "" {
+		userId, err = h.mfaService.VerifyChallenge(ctx, mfaToken, strings.TrimSpace(r.PostForm.Get("code")))
+		if err != nil {
+			switch {
+			case errors.Is(err, mfa.ErrInvalidCode), errors.Is(err, mfa.ErrInvalidArg):
+				h.rerenderAuthorizePage(w, r, req, http.StatusUnauthorized, "Incorrect code.", mfaToken)
+			case errors.Is(err, mfa.ErrInvalidChallenge), errors.Is(err, mfa.ErrNotEnabled):
+				h.rerenderAuthorizePage(w, r, req, http.StatusUnauthorized, "Your login expired, log in again.", "")
+			case errors.Is(err, mfa.ErrLockedOut):
+				h.rerenderAuthorizePage(w, r, req, http.StatusTooManyRequests,
+					"Too many failed attempts, wait a moment and try again.", "")
+			default:
+				logEntry.Error("failed to verify mfa challenge", err)
+				h.redirectWithAuthorizeError(w, r, req, authorizeError{code: oauthErrorServerError})
+			}
+			return
+		}
+	} else {
+		userId, err = h.checkPasswordLogin(r, r.PostForm.Get("username"), r.PostForm.Get("password"))
+		if err != nil {
+			var throttled *user.LoginThrottledError
+			switch {
+			case errors.Is(err, errInvalidCredentials):
+				h.rerenderAuthorizePage(w, r, req, http.StatusUnauthorized, "Incorrect username or password.", "")
+			case errors.As(err, &throttled):
+				w.Header().Set("Retry-After", retryAfterSeconds(throttled.RetryAfter))
+				h.rerenderAuthorizePage(w, r, req, http.StatusTooManyRequests,
+					"Too many failed attempts, wait a moment and try again.", "")
+			default:
+				logEntry.Error("failed to check password login", err)
+				h.redirectWithAuthorizeError(w, r, req, authorizeError{code: oauthErrorServerError})
+			}
+			return
+		}
+
+		mfaEnabled, err := h.mfaService.IsTOTPEnabled(ctx, userId)
+		if err != nil {
+			logEntry.Error("failed to check if mfa is enabled", err)
+			h.redirectWithAuthorizeError(w, r, req, authorizeError{code: oauthErrorServerError})
+			return
+		}
+
+		if mfaEnabled {
+			challenge, err := h.mfaService.CreateChallenge(ctx, userId)
+			if err != nil {
+				if errors.Is(err, mfa.ErrLockedOut) {
+					h.rerenderAuthorizePage(w, r, req, http.StatusTooManyRequests,
+						"Too many failed attempts, wait a moment and try again.", "")
+					return
+				}
+				logEntry.Error("failed to create mfa challenge", err)
+				h.redirectWithAuthorizeError(w, r, req, authorizeError{code: oauthErrorServerError})
+				return
+			}
+
+			h.rerenderAuthorizePage(w, r, req, http.StatusOK, "", challenge.Token)
+			return
+		}
+	}
+
+	code, err := h.oauthService.CreateAuthorizationCode(ctx, oauth.CreateAuthorizationCodeInput{
+		ClientId:      req.client.ClientId,
+		UserId:        userId,
+		RedirectURI:   req.params.Get("redirect_uri"),
+		Scope:         req.scope,
+		Nonce:         req.params.Get("nonce"),
+		CodeChallenge: req.params.Get("code_challenge"),
+	})
+	if err != nil {
+		logEntry.Error("failed to create authorization code", err)
+		h.redirectWithAuthorizeError(w, r, req, authorizeError{code: oauthErrorServerError})
+		return
+	}
+
+	h.redirectToClient(w, r, req, url.Values{"code": {code}})
+}
+
+// loadAuthorizeRequest validates the authorization request. Errors are shown to the user when
+// the client or redirect uri are invalid, since sending them there could be an open redirect,
+// and returned to the client otherwise.
+func (h *AuthHandler) loadAuthorizeRequest(w http.ResponseWriter, r *http.Request, values url.Values) (authorizeRequest, bool) {
+	logEntry := logger.GetLogEntry(r)
+
+	req := authorizeRequest{
+		params: url.Values{},
+	}
+	for _, param := range authorizeParams {
+		if value := values.Get(param); value != "" {
+			req.params.Set(param, value)
+		}
+	}
+
+	client, err := h.oauthService.GetClient(r.Context(), req.params.Get("client_id"))
+	if err != nil {
+		if errors.Is(err, oauth.ErrNotFound) || errors.Is(err, oauth.ErrInvalidArg) {
+			h.renderAuthorizePage(w, r, http.StatusBadRequest, authorizePage{
+				FatalError: "The app you came from isn't registered with Autolog.",
+			})
+			return authorizeRequest{}, false
+		}
+		logEntry.Error("failed to get oauth client", err)
+		h.renderAuthorizePage(w, r, http.StatusInternalServerError, authorizePage{
+			FatalError: "Something went wrong, try again later.",
+		})
+		return authorizeRequest{}, false
+	}
+	req.client = client
+
+	if !client.ValidRedirectURI(req.params.Get("redirect_uri")) {
+		h.renderAuthorizePage(w, r, http.StatusBadRequest, authorizePage{
+			FatalError: "The app you came from sent you to an address it hasn't registered.",
+		})
+		return authorizeRequest{}, false
+	}
+
+	if authErr, ok := req.validate(); !ok {
+		h.redirectWithAuthorizeError(w, r, req, authErr)
+		return authorizeRequest{}, false
+	}
+
+	return req, true
+}
+
+// validate checks the rest of the request once the client and redirect uri are known, and sets
+// the granted scope
+func (req *authorizeRequest) validate() (authorizeError, bool) {
+	if req.params.Get("response_type") != "code" {
+		return authorizeError{code: oauthErrorUnsupportedResponseType}, false
+	}
+
+	// every client uses PKCE, confidential or not,
+	// https://datatracker.ietf.org/doc/html/draft-ietf-oauth-security-topics#section-2.1.1
+	if req.params.Get("code_challenge") == "" || req.params.Get("code_challenge_method") != codeChallengeMethodS256 {
+		return authorizeError{
+			code:        oauthErrorInvalidRequest,
+			description: "code_challenge with code_challenge_method S256 is required",
+		}, false
+	}
+
+	scope, err := req.client.GrantScope(req.params.Get("scope"))
+	if err != nil {
+		return authorizeError{code: oauthErrorInvalidScope}, false
+	}
+	req.scope = scope
+
+	return authorizeError{}, true
+}
+
+func (req *authorizeRequest) page(csrfToken string) authorizePage {
+	params := make(map[string]string, len(req.params))
+	for name := range req.params {
+		params[name] = req.params.Get(name)
+	}
+
+	return authorizePage{
+		ClientName: req.client.Name,
+		Params:     params,
+		CSRFToken:  csrfToken,
+	}
+}
+
+// rerenderAuthorizePage shows the form again with an error, or the TOTP form if mfaToken is set
+func (h *AuthHandler) rerenderAuthorizePage(w http.ResponseWriter, r *http.Request, req authorizeRequest,
+	statusCode int, message, mfaToken string) {
+	csrfToken, err := h.setAuthorizeCSRFCookie(w)
+	if err != nil {
+		logger.GetLogEntry(r).Error("failed to set csrf cookie", err)
+		h.redirectWithAuthorizeError(w, r, req, authorizeError{code: oauthErrorServerError})
+		return
+	}
+
+	page := req.page(csrfToken)
+	page.Error = message
+	page.MFAToken = mfaToken
+	if mfaToken == "" {
+		page.Username = r.PostForm.Get("username")
+	}
+
+	h.renderAuthorizePage(w, r, statusCode, page)
+}
+
+func (h *AuthHandler) renderAuthorizePage(w http.ResponseWriter, r *http.Request, statusCode int, page authorizePage) {
+	// the login page must not be framed by other sites, or cached
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(statusCode)
+
+	if err := authorizeTemplate.ExecuteTemplate(w, "authorize", page); err != nil {
+		logger.GetLogEntry(r).Error("failed to render authorize page", err)
+	}
+}
+
+// setAuthorizeCSRFCookie sets a new double submit token for the login form
+func (h *AuthHandler) setAuthorizeCSRFCookie(w http.ResponseWriter) (string, error) {
+	csrfToken, err := random.SecureToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     authorizeCSRFCookieName,
+		Value:    csrfToken,
+		Path:     "/v1/oauth/authorize",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.issuerUrl, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return csrfToken, nil
+}
+
+func (h *AuthHandler) redirectWithAuthorizeError(w http.ResponseWriter, r *http.Request, req authorizeRequest, authErr authorizeError) {
+	values := url.Values{"error": {authErr.code}}
+	if authErr.description != "" {
+		values.Set("error_description", authErr.description)
+	}
+
+	h.redirectToClient(w, r, req, values)
+}
+
+// redirectToClient sends the user back to the client's redirect uri with the state, and the
+// issuer so clients can detect mix-up attacks, https://datatracker.ietf.org/doc/html/rfc9207
+func (h *AuthHandler) redirectToClient(w http.ResponseWriter, r *http.Request, req authorizeRequest, values url.Values) {
+	redirectURI, err := url.Parse(req.params.Get("redirect_uri"))
+	if err != nil {
+		// registered redirect uris are validated when clients are created
+		h.renderAuthorizePage(w, r, http.StatusInternalServerError, authorizePage{
+			FatalError: "Something went wrong, try again later.",
+		})
+		return
+	}
+
+	query := redirectURI.Query()
+	for name := range values {
+		query.Set(name, values.Get(name))
+	}
+	if state := req.params.Get("state"); state != "" {
+		query.Set("state", state)
+	}
+	query.Set("iss", h.issuerUrl)
+	redirectURI.RawQuery = query.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
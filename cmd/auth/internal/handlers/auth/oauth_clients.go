@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/oauth"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+type createOAuthClientRequestBody struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirectUris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+
+	// Audiences and Permissions register a service client, see oauth.CreateClientInput
+	Audiences   []string `json:"audiences"`
+	Permissions []string `json:"permissions"`
+}
+
+type oauthClientResponse struct {
+	ClientId     string    `json:"clientId"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirectUris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	Audiences    []string  `json:"audiences"`
+	Permissions  []string  `json:"permissions"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func newOAuthClientResponse(c oauth.Client) oauthClientResponse {
+	return oauthClientResponse{
+		ClientId:     c.ClientId,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectURIs,
+		Scopes:       c.Scopes,
+		Confidential: c.Confidential,
+		Audiences:    c.Audiences,
+		Permissions:  c.Permissions,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+type createOAuthClientResponse struct {
+	oauthClientResponse
+
+	// ClientSecret is only returned once, for confidential clients
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
+
+// CreateOAuthClient registers a client with the provider
+func (h *AuthHandler) CreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read create oauth client request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody createOAuthClientRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// service clients' tokens grant permissions from the permission matrix or the service
+	// permissions, nothing made up
+	for _, permission := range reqBody.Permissions {
+		if !user.ValidPermission(user.Permission(permission)) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "unknown permission: "+permission)
+			return
+		}
+	}
+
+	client, clientSecret, err := h.oauthService.CreateClient(r.Context(), oauth.CreateClientInput{
+		Name:         reqBody.Name,
+		RedirectURIs: reqBody.RedirectURIs,
+		Scopes:       reqBody.Scopes,
+		Confidential: reqBody.Confidential,
+		Audiences:    reqBody.Audiences,
+		Permissions:  reqBody.Permissions,
+	})
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest,
+				"a name, valid redirect uris and supported scopes are required, or for service "+
+					"clients a confidential client with audiences and permissions")
+			return
+		}
+		logEntry.Error("failed to create oauth client", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusCreated, createOAuthClientResponse{
+		oauthClientResponse: newOAuthClientResponse(client),
+		ClientSecret:        clientSecret,
+	})
+}
+
+type listOAuthClientsResponse struct {
+	Clients []oauthClientResponse `json:"clients"`
+}
+
+// ListOAuthClients lists the clients registered with the provider
+func (h *AuthHandler) ListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	clients, err := h.oauthService.ListClients(r.Context())
+	if err != nil {
+		logEntry.Error("failed to list oauth clients", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := listOAuthClientsResponse{
+		Clients: make([]oauthClientResponse, 0, len(clients)),
+	}
+	for _, c := range clients {
+		resp.Clients = append(resp.Clients, newOAuthClientResponse(c))
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// DeleteOAuthClient removes a client. Its unused authorization codes go with it, and refresh
+// tokens issued to it can no longer be used.
+func (h *AuthHandler) DeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	if err := h.oauthService.DeleteClient(r.Context(), chi.URLParam(r, "clientId")); err != nil {
+		if errors.Is(err, oauth.ErrNotFound) || errors.Is(err, oauth.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+			return
+		}
+		logEntry.Error("failed to delete oauth client", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
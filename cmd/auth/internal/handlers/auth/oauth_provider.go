@@ -0,0 +1,452 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/oauth"
+	"github.com/keola-dunn/autolog/internal/service/signingkey"
+	"github.com/keola-dunn/autolog/internal/service/token"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+// openIdConfiguration is the provider's discovery document,
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type openIdConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSUri                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+
+	AuthorizationResponseIssParameterSupported bool `json:"authorization_response_iss_parameter_supported"`
+}
+
+// idTokenSigningAlgs are every algorithm the keyring may sign with
+var idTokenSigningAlgs = func() []string {
+	algs := make([]string, 0, len(signingkey.SupportedAlgorithms))
+	for _, alg := range signingkey.SupportedAlgorithms {
+		algs = append(algs, string(alg))
+	}
+	return algs
+}()
+
+// GetOpenIdConfiguration serves the provider's discovery document
+func (h *AuthHandler) GetOpenIdConfiguration(w http.ResponseWriter, r *http.Request) {
+	httputil.RespondWithJSON(w, http.StatusOK, openIdConfiguration{
+		Issuer:                            h.issuerUrl,
+		AuthorizationEndpoint:             h.issuerUrl + "/v1/oauth/authorize",
+		TokenEndpoint:                     h.issuerUrl + "/v1/oauth/token",
+		UserinfoEndpoint:                  h.issuerUrl + "/v1/oauth/userinfo",
+		JWKSUri:                           h.issuerUrl + "/.well-known/jwks.json",
+		RevocationEndpoint:                h.issuerUrl + "/v1/oauth/revoke",
+		IntrospectionEndpoint:             h.issuerUrl + "/v1/oauth/introspect",
+		ScopesSupported:                   oauth.SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeRefreshToken, grantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  idTokenSigningAlgs,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash",
+			"email", "email_verified", "name", "preferred_username"},
+		AuthorizationResponseIssParameterSupported: true,
+	})
+}
+
+// oauthTokenResponse is the token endpoint's response,
+// https://datatracker.ietf.org/doc/html/rfc6749#section-5.1
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// Token is the OAuth token endpoint. Clients exchange authorization codes and refresh tokens
+// for access tokens here, and service clients get service tokens with their own credentials.
+func (h *AuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	// tokens must never be cached, https://datatracker.ietf.org/doc/html/rfc6749#section-5.1
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidRequest, "invalid form body")
+		return
+	}
+
+	client, err := h.authenticateOAuthClient(r)
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidClient) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="autolog"`)
+			respondWithOAuthError(w, http.StatusUnauthorized, oauthErrorInvalidClient, "")
+			return
+		}
+		logEntry.Error("failed to authenticate oauth client", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthErrorServerError, "")
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case grantTypeAuthorizationCode:
+		h.exchangeAuthorizationCode(w, r, client)
+	case grantTypeRefreshToken:
+		h.exchangeRefreshToken(w, r, client)
+	case grantTypeClientCredentials:
+		h.issueServiceToken(w, r, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorUnsupportedGrantType, "")
+	}
+}
+
+// authenticateOAuthClient authenticates the client with HTTP basic auth or the form body, or
+// just identifies it for public clients
+func (h *AuthHandler) authenticateOAuthClient(r *http.Request) (oauth.Client, error) {
+	clientId, clientSecret, ok := r.BasicAuth()
+	if ok {
+		// credentials are form encoded before basic auth encoding,
+		// https://datatracker.ietf.org/doc/html/rfc6749#section-2.3.1
+		var err error
+		if clientId, err = url.QueryUnescape(clientId); err != nil {
+			return oauth.Client{}, oauth.ErrInvalidClient
+		}
+		if clientSecret, err = url.QueryUnescape(clientSecret); err != nil {
+			return oauth.Client{}, oauth.ErrInvalidClient
+		}
+	} else {
+		clientId = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	return h.oauthService.AuthenticateClient(r.Context(), clientId, clientSecret)
+}
+
+func (h *AuthHandler) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client oauth.Client) {
+	logEntry := logger.GetLogEntry(r)
+	ctx := r.Context()
+
+	code, err := h.oauthService.ExchangeAuthorizationCode(ctx, oauth.ExchangeAuthorizationCodeInput{
+		Code:         r.PostForm.Get("code"),
+		ClientId:     client.ClientId,
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	})
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidGrant) {
+			respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidGrant, "")
+			return
+		}
+		logEntry.Error("failed to exchange authorization code", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthErrorServerError, "")
+		return
+	}
+
+	resp, err := h.createOAuthTokens(ctx, client, code.UserId, code.Scope, code.Nonce, code.AuthTime)
+	if err != nil {
+		logEntry.Error("failed to create oauth tokens", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthErrorServerError, "")
+		return
+	}
+
+	if oauth.HasScope(code.Scope, oauth.ScopeOfflineAccess) {
+		refreshToken, err := h.tokenService.CreateClientRefreshToken(ctx, code.UserId, client.ClientId, code.Scope)
+		if err != nil {
+			logEntry.Error("failed to create refresh token", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, oauthErrorServerError, "")
+			return
+		}
+		resp.RefreshToken = refreshToken.Token
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+func (h *AuthHandler) exchangeRefreshToken(w http.ResponseWriter, r *http.Request, client oauth.Client) {
+	logEntry := logger.GetLogEntry(r)
+	ctx := r.Context()
+
+	refreshToken, err := h.tokenService.RotateRefreshToken(ctx, r.PostForm.Get("refresh_token"), client.ClientId)
+	if err != nil {
+		switch {
+		case errors.Is(err, token.ErrTokenReused):
+			logEntry.Warn("refresh token reuse detected, token family revoked", "clientId", client.ClientId)
+			respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidGrant, "")
+		case errors.Is(err, token.ErrInvalidToken), errors.Is(err, token.ErrTokenExpired),
+			errors.Is(err, token.ErrInvalidArg):
+			respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidGrant, "")
+		default:
+			logEntry.Error("failed to rotate refresh token", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, oauthErrorServerError, "")
+		}
+		return
+	}
+
+	// no nonce or auth time, the user didn't log in again
+	resp, err := h.createOAuthTokens(ctx, client, refreshToken.UserId, refreshToken.Scope, "", time.Time{})
+	if err != nil {
+		logEntry.Error("failed to create oauth tokens", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthErrorServerError, "")
+		return
+	}
+	resp.RefreshToken = refreshToken.Token
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// issueServiceToken is the client credentials grant, for autolog services calling each other.
+// The token is for the audience param, which may be left out by clients with one audience, and
+// grants the permissions in the scope param, or every permission of the client without one. No
+// refresh token is issued, services request a new token when theirs expires.
+// https://datatracker.ietf.org/doc/html/rfc6749#section-4.4
+func (h *AuthHandler) issueServiceToken(w http.ResponseWriter, r *http.Request, client oauth.Client) {
+	logEntry := logger.GetLogEntry(r)
+
+	if !client.ServiceClient() {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorUnauthorizedClient, "")
+		return
+	}
+
+	audience := r.PostForm.Get("audience")
+	if audience == "" && len(client.Audiences) == 1 {
+		audience = client.Audiences[0]
+	}
+	if !client.ValidAudience(audience) {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidTarget, "")
+		return
+	}
+
+	permissions, err := client.GrantPermissions(r.PostForm.Get("scope"))
+	if err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidScope, "")
+		return
+	}
+
+	accessToken, err := h.createServiceJWT(r.Context(), client.ClientId, audience, permissions)
+	if err != nil {
+		logEntry.Error("failed to create service token", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, oauthErrorServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, oauthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(h.jwtExpiryLength().Seconds()),
+		Scope:       strings.Join(permissions, " "),
+	})
+}
+
+// createOAuthTokens creates the access token, and an ID token for OpenID Connect requests
+func (h *AuthHandler) createOAuthTokens(ctx context.Context, client oauth.Client, userId, scope,
+	nonce string, authTime time.Time) (oauthTokenResponse, error) {
+	accessToken, err := h.createClientJWT(ctx, userId, client.ClientId, scope)
+	if err != nil {
+		return oauthTokenResponse{}, fmt.Errorf("failed to create access token: %w", err)
+	}
+
+	resp := oauthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(h.jwtExpiryLength().Seconds()),
+		Scope:       scope,
+	}
+
+	if oauth.HasScope(scope, oauth.ScopeOpenId) {
+		resp.IdToken, err = h.createIdToken(ctx, idTokenInput{
+			UserId:      userId,
+			ClientId:    client.ClientId,
+			Scope:       scope,
+			Nonce:       nonce,
+			AuthTime:    authTime,
+			AccessToken: accessToken,
+		})
+		if err != nil {
+			return oauthTokenResponse{}, fmt.Errorf("failed to create id token: %w", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// idTokenClaims are the claims of the ID tokens the provider issues,
+// https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	Nonce    string           `json:"nonce,omitempty"`
+
+	// AccessTokenHash binds the ID token to the access token issued with it
+	AccessTokenHash string `json:"at_hash,omitempty"`
+
+	userInfoClaims
+}
+
+// userInfoClaims are the claims about the user, limited by the granted scope
+type userInfoClaims struct {
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+func newUserInfoClaims(profile user.Profile, scope string) userInfoClaims {
+	var claims userInfoClaims
+
+	if oauth.HasScope(scope, oauth.ScopeEmail) {
+		verified := profile.EmailVerifiedAt != nil
+		claims.Email = profile.Email
+		claims.EmailVerified = &verified
+	}
+
+	if oauth.HasScope(scope, oauth.ScopeProfile) {
+		claims.Name = profile.Name
+		claims.PreferredUsername = profile.Username
+	}
+
+	return claims
+}
+
+type idTokenInput struct {
+	UserId   string
+	ClientId string
+	Scope    string
+	Nonce    string
+
+	// AuthTime is when the user logged in, zero when refreshing
+	AuthTime time.Time
+
+	// AccessToken is the access token issued alongside the ID token
+	AccessToken string
+}
+
+// createIdToken creates an ID token for the client, signed with the same key as access tokens
+func (h *AuthHandler) createIdToken(ctx context.Context, input idTokenInput) (string, error) {
+	profile, err := h.userService.GetProfile(ctx, input.UserId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user profile: %w", err)
+	}
+
+	signingKey, err := h.signingKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	signingMethod, err := signingKey.Algorithm.SigningMethod()
+	if err != nil {
+		return "", fmt.Errorf("failed to get signing method: %w", err)
+	}
+
+	now := h.calendarService.NowUTC()
+
+	claims := idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    h.issuerUrl,
+			Subject:   input.UserId,
+			Audience:  jwt.ClaimStrings{input.ClientId},
+			ExpiresAt: jwt.NewNumericDate(now.Add(h.jwtExpiryLength())),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Nonce:           input.Nonce,
+		AccessTokenHash: accessTokenHash(signingKey.Algorithm, input.AccessToken),
+		userInfoClaims:  newUserInfoClaims(profile, input.Scope),
+	}
+	if !input.AuthTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(input.AuthTime)
+	}
+
+	idToken := jwt.NewWithClaims(signingMethod, claims)
+	idToken.Header["kid"] = signingKey.Id
+
+	signed, err := idToken.SignedString(signingKey.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign id token: %w", err)
+	}
+
+	return signed, nil
+}
+
+// accessTokenHash is the left half of the access token's hash, with the hash function of the ID
+// token's algorithm, https://openid.net/specs/openid-connect-core-1_0.html#CodeIDToken
+func accessTokenHash(alg signingkey.Algorithm, accessToken string) string {
+	var sum []byte
+	if alg == signingkey.AlgorithmEdDSA {
+		// Ed25519 uses SHA-512 internally, so its hashes do too
+		s := sha512.Sum512([]byte(accessToken))
+		sum = s[:]
+	} else {
+		s := sha256.Sum256([]byte(accessToken))
+		sum = s[:]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// userInfoResponse is the userinfo endpoint's response,
+// https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse
+type userInfoResponse struct {
+	Subject string `json:"sub"`
+	userInfoClaims
+}
+
+// UserInfo returns the claims about the user the access token's scope allows. Tokens from the
+// auth server's own logins aren't limited by scope.
+func (h *AuthHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := autologjwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	scope := claims.Scope
+	if claims.ClientId == "" {
+		scope = strings.Join(oauth.SupportedScopes, " ")
+	}
+
+	profile, err := h.userService.GetProfile(r.Context(), claims.GetUserId())
+	if err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+			return
+		}
+		logEntry.Error("failed to get user profile", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, userInfoResponse{
+		Subject:        profile.Id,
+		userInfoClaims: newUserInfoClaims(profile, scope),
+	})
+}
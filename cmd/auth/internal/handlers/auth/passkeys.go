@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/passkey"
+	"github.com/keola-dunn/autolog/internal/webauthn"
+)
+
+type beginPasskeyRegistrationResponse struct {
+	// PublicKey is passed to navigator.credentials.create()
+	PublicKey webauthn.CredentialCreationOptions `json:"publicKey"`
+}
+
+// BeginPasskeyRegistration starts registering a passkey for the user
+func (h *AuthHandler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	userEmail, err := h.userService.GetUserEmail(r.Context(), claims.GetUserId())
+	if err != nil {
+		logEntry.Error("failed to get user email", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	options, err := h.passkeyService.BeginRegistration(r.Context(), passkey.BeginRegistrationInput{
+		UserId: claims.GetUserId(),
+		Name:   userEmail.Email,
+	})
+	if err != nil {
+		logEntry.Error("failed to begin passkey registration", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, beginPasskeyRegistrationResponse{
+		PublicKey: options,
+	})
+}
+
+type finishPasskeyRegistrationRequestBody struct {
+	// Name helps the user tell their passkeys apart, ex. "Work laptop"
+	Name       string                        `json:"name"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+type passkeyResponse struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	BackedUp   bool       `json:"backedUp"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func newPasskeyResponse(p passkey.Passkey) passkeyResponse {
+	return passkeyResponse{
+		Id:         p.Id,
+		Name:       p.Name,
+		BackedUp:   p.BackedUp,
+		LastUsedAt: p.LastUsedAt,
+		CreatedAt:  p.CreatedAt,
+	}
+}
+
+// FinishPasskeyRegistration verifies the new credential and saves the passkey
+func (h *AuthHandler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read passkey registration request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody finishPasskeyRegistrationRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	p, err := h.passkeyService.FinishRegistration(r.Context(), passkey.FinishRegistrationInput{
+		UserId:   claims.GetUserId(),
+		Name:     reqBody.Name,
+		Response: reqBody.Credential,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, passkey.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "passkey name is too long")
+		case errors.Is(err, passkey.ErrInvalidChallenge), errors.Is(err, passkey.ErrInvalidCredential):
+			logEntry.Warn("passkey registration failed verification", "error", err)
+			httputil.RespondWithError(w, http.StatusBadRequest, "passkey registration failed")
+		case errors.Is(err, passkey.ErrAlreadyExists):
+			httputil.RespondWithError(w, http.StatusConflict, "passkey is already registered")
+		default:
+			logEntry.Error("failed to finish passkey registration", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusCreated, newPasskeyResponse(p))
+}
+
+type beginPasskeyLoginResponse struct {
+	// PublicKey is passed to navigator.credentials.get()
+	PublicKey webauthn.CredentialRequestOptions `json:"publicKey"`
+}
+
+// BeginPasskeyLogin starts a passwordless login
+func (h *AuthHandler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	options, err := h.passkeyService.BeginLogin(r.Context())
+	if err != nil {
+		logEntry.Error("failed to begin passkey login", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, beginPasskeyLoginResponse{
+		PublicKey: options,
+	})
+}
+
+type finishPasskeyLoginRequestBody struct {
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+// FinishPasskeyLogin verifies the passkey and issues tokens. Passkeys verify the user on the
+// device, so no second factor is asked for.
+func (h *AuthHandler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read passkey login request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody finishPasskeyLoginRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	ctx := r.Context()
+
+	userId, err := h.passkeyService.FinishLogin(ctx, reqBody.Credential)
+	if err != nil {
+		switch {
+		case errors.Is(err, passkey.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "missing required credential")
+		case errors.Is(err, passkey.ErrInvalidChallenge), errors.Is(err, passkey.ErrInvalidCredential):
+			logEntry.Warn("passkey login failed verification", "error", err)
+			h.recordAuthEvent(r, audit.Event{
+				Type:   audit.EventLoginFailed,
+				Detail: "invalid_passkey",
+			})
+			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		default:
+			logEntry.Error("failed to finish passkey login", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	tokens, err := h.issueTokens(r, userId)
+	if err != nil {
+		logEntry.Error("failed to issue tokens", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	h.recordAuthEvent(r, audit.Event{
+		Type:   audit.EventLoginSucceeded,
+		UserId: userId,
+		Detail: loginMethodPasskey,
+	})
+
+	httputil.RespondWithJSON(w, http.StatusOK, LoginResponse{
+		tokenResponse: tokens,
+	})
+}
+
+type listPasskeysResponse struct {
+	Passkeys []passkeyResponse `json:"passkeys"`
+}
+
+// ListPasskeys lists the user's passkeys
+func (h *AuthHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	passkeys, err := h.passkeyService.ListPasskeys(r.Context(), claims.GetUserId())
+	if err != nil {
+		logEntry.Error("failed to list passkeys", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := listPasskeysResponse{
+		Passkeys: make([]passkeyResponse, 0, len(passkeys)),
+	}
+	for _, p := range passkeys {
+		resp.Passkeys = append(resp.Passkeys, newPasskeyResponse(p))
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// DeletePasskey removes one of the user's passkeys
+func (h *AuthHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := h.passkeyService.DeletePasskey(r.Context(), claims.GetUserId(), chi.URLParam(r, "passkeyId")); err != nil {
+		if errors.Is(err, passkey.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+			return
+		}
+		logEntry.Error("failed to delete passkey", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+type startPasswordResetRequestBody struct {
+	// Login is the username or email of the account
+	Login string `json:"login"`
+}
+
+type startPasswordResetResponse struct {
+	ChallengeId string             `json:"challengeId"`
+	Questions   []SecurityQuestion `json:"questions"`
+	ExpiresAt   time.Time          `json:"expiresAt"`
+}
+
+// StartPasswordReset returns the security questions that must be answered to reset the
+// password. The response looks the same whether or not the account exists.
+func (a *AuthHandler) StartPasswordReset(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read password reset request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody startPasswordResetRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil || strings.TrimSpace(reqBody.Login) == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required username or email")
+		return
+	}
+
+	challenge, err := a.userService.StartPasswordReset(r.Context(), reqBody.Login)
+	if err != nil {
+		if respondWithPasswordResetLimitError(w, err) {
+			return
+		}
+		logEntry.Error("failed to start password reset", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := startPasswordResetResponse{
+		ChallengeId: challenge.Id,
+		Questions:   make([]SecurityQuestion, 0, len(challenge.Questions)),
+		ExpiresAt:   challenge.ExpiresAt,
+	}
+	for _, q := range challenge.Questions {
+		resp.Questions = append(resp.Questions, SecurityQuestion{
+			Question: q.Question,
+			Id:       q.Id,
+		})
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+type answerPasswordResetRequestBody struct {
+	Answers []signupQuestions `json:"answers"`
+}
+
+type answerPasswordResetResponse struct {
+	ResetToken string    `json:"resetToken"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// AnswerPasswordResetChallenge exchanges correct answers to the challenge for a short lived
+// reset token
+func (a *AuthHandler) AnswerPasswordResetChallenge(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read password reset answers request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody answerPasswordResetRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil || len(reqBody.Answers) == 0 {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required answers")
+		return
+	}
+
+	var answers = make([]user.UserSecurityQuestion, 0, len(reqBody.Answers))
+	for _, a := range reqBody.Answers {
+		answers = append(answers, user.UserSecurityQuestion{
+			QuestionId: a.QuestionId,
+			Answer:     a.Answer,
+		})
+	}
+
+	resetToken, err := a.userService.AnswerPasswordResetChallenge(r.Context(), chi.URLParam(r, "challengeId"), answers)
+	if err != nil {
+		switch {
+		case respondWithPasswordResetLimitError(w, err):
+		case errors.Is(err, user.ErrIncorrectAnswers):
+			httputil.RespondWithError(w, http.StatusUnauthorized, "incorrect answers")
+		case errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "missing required answers")
+		default:
+			logEntry.Error("failed to answer password reset challenge", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, answerPasswordResetResponse{
+		ResetToken: resetToken.Token,
+		ExpiresAt:  resetToken.ExpiresAt,
+	})
+}
+
+type completePasswordResetRequestBody struct {
+	ResetToken string `json:"resetToken"`
+	Password   string `json:"password"`
+}
+
+// CompletePasswordReset sets the new password. Every existing session for the user is revoked.
+func (a *AuthHandler) CompletePasswordReset(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read complete password reset request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody completePasswordResetRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil || strings.TrimSpace(reqBody.ResetToken) == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required reset token")
+		return
+	}
+
+	if err := user.CheckPasswordStrength(reqBody.Password); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+
+	userId, err := a.userService.GetPasswordResetUserId(ctx, reqBody.ResetToken)
+	if err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusUnauthorized, "invalid or expired reset token")
+			return
+		}
+		logEntry.Error("failed to get password reset user", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	// tokens are revoked before the password changes, the reset token is still usable if it
+	// fails so the client can retry
+	if err := a.tokenService.RevokeUserTokens(ctx, userId); err != nil {
+		logEntry.Error("failed to revoke user tokens for password reset", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	userId, err = a.userService.CompletePasswordReset(ctx, reqBody.ResetToken, reqBody.Password)
+	if err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusUnauthorized, "invalid or expired reset token")
+			return
+		}
+		if errors.Is(err, user.ErrWeakPassword) {
+			httputil.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logEntry.Error("failed to complete password reset", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	a.recordAuthEvent(r, audit.Event{
+		Type:   audit.EventPasswordChanged,
+		UserId: userId,
+		Detail: "reset",
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondWithPasswordResetLimitError responds and returns true if err is a rate limit or lockout
+func respondWithPasswordResetLimitError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, user.ErrRateLimited):
+		httputil.RespondWithError(w, http.StatusTooManyRequests, "too many password reset attempts, try again later")
+	case errors.Is(err, user.ErrLockedOut):
+		httputil.RespondWithError(w, http.StatusTooManyRequests, "too many failed attempts, try again later")
+	default:
+		return false
+	}
+	return true
+}
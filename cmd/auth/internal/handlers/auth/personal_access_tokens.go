@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/token"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+const (
+	defaultPersonalAccessTokenExpiryDays = 90
+	maxPersonalAccessTokenExpiryDays     = 365
+)
+
+// personalAccessTokenScopes are the permissions personal access tokens can be granted. Admin
+// permissions are left out, they're only for interactive logins.
+var personalAccessTokenScopes = []user.Permission{
+	user.PermissionCarsRead,
+	user.PermissionCarsWrite,
+	user.PermissionServiceLogsRead,
+	user.PermissionServiceLogsWrite,
+	user.PermissionServiceLogsCertify,
+	user.PermissionShopsRead,
+	user.PermissionShopsWrite,
+	user.PermissionImagesRead,
+	user.PermissionImagesWrite,
+}
+
+type createPersonalAccessTokenRequestBody struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+
+	// ExpiresInDays defaults to 90, and can be at most 365
+	ExpiresInDays int `json:"expiresInDays"`
+}
+
+type personalAccessTokenResponse struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func newPersonalAccessTokenResponse(pat token.PersonalAccessToken) personalAccessTokenResponse {
+	return personalAccessTokenResponse{
+		Id:         pat.Id,
+		Name:       pat.Name,
+		Scopes:     pat.Scopes,
+		ExpiresAt:  pat.ExpiresAt,
+		LastUsedAt: pat.LastUsedAt,
+		CreatedAt:  pat.CreatedAt,
+	}
+}
+
+type createPersonalAccessTokenResponse struct {
+	personalAccessTokenResponse
+
+	// Token is only returned once
+	Token string `json:"token"`
+}
+
+// CreatePersonalAccessToken issues the user a personal access token for scripts and
+// integrations. Tokens can only be granted permissions the user holds.
+func (h *AuthHandler) CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	// tokens issued to OAuth clients are limited to what the user let the client do
+	if claims.ClientId != "" {
+		httputil.RespondWithError(w, http.StatusForbidden, "")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read create personal access token request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody createPersonalAccessTokenRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if reqBody.ExpiresInDays == 0 {
+		reqBody.ExpiresInDays = defaultPersonalAccessTokenExpiryDays
+	}
+	if reqBody.ExpiresInDays < 0 || reqBody.ExpiresInDays > maxPersonalAccessTokenExpiryDays {
+		httputil.RespondWithError(w, http.StatusBadRequest, "expiresInDays must be between 1 and 365")
+		return
+	}
+
+	if len(reqBody.Scopes) == 0 {
+		httputil.RespondWithError(w, http.StatusBadRequest, "at least one scope is required")
+		return
+	}
+	for _, scope := range reqBody.Scopes {
+		if !slices.Contains(personalAccessTokenScopes, user.Permission(scope)) || !claims.HasPermission(scope) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "unsupported scope: "+scope)
+			return
+		}
+	}
+
+	pat, err := h.tokenService.CreatePersonalAccessToken(r.Context(), token.CreatePersonalAccessTokenInput{
+		UserId:    claims.GetUserId(),
+		Name:      reqBody.Name,
+		Scopes:    reqBody.Scopes,
+		ExpiresAt: h.calendarService.NowUTC().AddDate(0, 0, reqBody.ExpiresInDays),
+	})
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "a name of at most 128 characters is required")
+			return
+		}
+		logEntry.Error("failed to create personal access token", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusCreated, createPersonalAccessTokenResponse{
+		personalAccessTokenResponse: newPersonalAccessTokenResponse(pat),
+		Token:                       pat.Token,
+	})
+}
+
+type listPersonalAccessTokensResponse struct {
+	Tokens []personalAccessTokenResponse `json:"tokens"`
+}
+
+// ListPersonalAccessTokens lists the user's personal access tokens that haven't been revoked
+func (h *AuthHandler) ListPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	pats, err := h.tokenService.ListPersonalAccessTokens(r.Context(), claims.GetUserId())
+	if err != nil {
+		logEntry.Error("failed to list personal access tokens", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := listPersonalAccessTokensResponse{
+		Tokens: make([]personalAccessTokenResponse, 0, len(pats)),
+	}
+	for _, pat := range pats {
+		resp.Tokens = append(resp.Tokens, newPersonalAccessTokenResponse(pat))
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// RevokePersonalAccessToken revokes one of the user's personal access tokens. Services cache
+// introspections briefly, so it can keep working for up to 30 seconds.
+func (h *AuthHandler) RevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	err := h.tokenService.RevokePersonalAccessToken(r.Context(), claims.GetUserId(), chi.URLParam(r, "tokenId"))
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+			return
+		}
+		logEntry.Error("failed to revoke personal access token", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// personalAccessTokenIntrospection is what a personal access token grants right now
+type personalAccessTokenIntrospection struct {
+	pat token.PersonalAccessToken
+
+	// permissions are the token's scopes the user still holds. Removing a role from the user
+	// takes its permissions away from their tokens too.
+	permissions   []string
+	emailVerified bool
+}
+
+// introspectPersonalAccessToken looks up an active personal access token and what it grants.
+// Returns token.ErrInvalidToken or token.ErrTokenExpired for inactive tokens.
+func (h *AuthHandler) introspectPersonalAccessToken(ctx context.Context, tokenString string) (personalAccessTokenIntrospection, error) {
+	pat, err := h.tokenService.GetPersonalAccessToken(ctx, tokenString)
+	if err != nil {
+		return personalAccessTokenIntrospection{}, err
+	}
+
+	roles, err := h.userService.GetUserRoles(ctx, pat.UserId)
+	if err != nil {
+		return personalAccessTokenIntrospection{}, err
+	}
+
+	userEmail, err := h.userService.GetUserEmail(ctx, pat.UserId)
+	if err != nil {
+		return personalAccessTokenIntrospection{}, err
+	}
+
+	held := permissionClaims(user.PermissionsForRoles(roles))
+
+	permissions := make([]string, 0, len(pat.Scopes))
+	for _, scope := range pat.Scopes {
+		if slices.Contains(held, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	return personalAccessTokenIntrospection{
+		pat:           pat,
+		permissions:   permissions,
+		emailVerified: userEmail.Verified(),
+	}, nil
+}
+
+// isPersonalAccessTokenInactive checks if the error is just the token being inactive
+func isPersonalAccessTokenInactive(err error) bool {
+	return errors.Is(err, token.ErrInvalidToken) ||
+		errors.Is(err, token.ErrTokenExpired) ||
+		errors.Is(err, token.ErrInvalidArg)
+}
@@ -1,10 +1,18 @@
 package auth
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strings"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
 	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/user"
 )
 
 type getSecurityQuestionsResponse struct {
@@ -35,3 +43,221 @@ func (a *AuthHandler) GetSecurityQuestions(w http.ResponseWriter, r *http.Reques
 
 	httputil.RespondWithJSON(w, http.StatusOK, resp)
 }
+
+type addSecurityQuestionRequestBody struct {
+	Question string `json:"question"`
+}
+
+// AddSecurityQuestion adds a question for users to pick from
+func (a *AuthHandler) AddSecurityQuestion(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	var reqBody addSecurityQuestionRequestBody
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	question, err := a.userService.AddSecurityQuestion(r.Context(), reqBody.Question)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "question is missing or too long")
+		case errors.Is(err, user.ErrAlreadyExists):
+			httputil.RespondWithError(w, http.StatusConflict, "question is already offered")
+		default:
+			logEntry.Error("failed to add security question", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusCreated, SecurityQuestion{
+		Question: question.Question,
+		Id:       question.Id,
+	})
+}
+
+// RetireSecurityQuestion stops offering a question. Users who already answered it keep it until
+// they replace their questions.
+func (a *AuthHandler) RetireSecurityQuestion(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	if err := a.userService.RetireSecurityQuestion(r.Context(), chi.URLParam(r, "questionId")); err != nil {
+		switch {
+		case errors.Is(err, user.ErrInvalidArg), errors.Is(err, user.ErrNotFound):
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+		case errors.Is(err, user.ErrTooFewSecurityQuestions):
+			httputil.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			logEntry.Error("failed to retire security question", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type userSecurityQuestionsResponse struct {
+	Questions []userSecurityQuestion `json:"questions"`
+}
+
+// userSecurityQuestion is a question the user answered. Their answer is never returned.
+type userSecurityQuestion struct {
+	Id       string `json:"id"`
+	Question string `json:"question"`
+	Custom   bool   `json:"custom"`
+
+	// Retired questions are still asked, but should be replaced
+	Retired bool `json:"retired"`
+}
+
+// GetUserSecurityQuestions lists the questions the caller answered, without the answers
+func (a *AuthHandler) GetUserSecurityQuestions(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	questions, err := a.userService.GetUserSecurityQuestions(r.Context(), claims.GetUserId())
+	if err != nil {
+		logEntry.Error("failed to get user security questions", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := userSecurityQuestionsResponse{
+		Questions: make([]userSecurityQuestion, 0, len(questions)),
+	}
+	for _, q := range questions {
+		resp.Questions = append(resp.Questions, userSecurityQuestion{
+			Id:       q.Id,
+			Question: q.Question,
+			Custom:   q.Custom,
+			Retired:  q.RetiredAt != nil,
+		})
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+type replaceUserSecurityQuestionsRequestBody struct {
+	// Password re-authenticates the user, holding a token isn't enough to change how they reset
+	// their password
+	Password  string                       `json:"password"`
+	Questions []userSecurityQuestionAnswer `json:"securityQuestions"`
+}
+
+// userSecurityQuestionAnswer is either an offered question's id or a custom question, and the
+// answer to it
+type userSecurityQuestionAnswer struct {
+	QuestionId string `json:"questionId"`
+	Question   string `json:"question"`
+	Answer     string `json:"answer"`
+}
+
+// ReplaceUserSecurityQuestions replaces all of the caller's questions and answers, after they
+// re-authenticate with their password. Wrong passwords count towards the account's lockout,
+// like failed logins.
+func (a *AuthHandler) ReplaceUserSecurityQuestions(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read security questions request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody replaceUserSecurityQuestionsRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if strings.TrimSpace(reqBody.Password) == "" {
+		httputil.RespondWithError(w, http.StatusUnauthorized, "missing required password")
+		return
+	}
+
+	ctx := r.Context()
+	userId := claims.GetUserId()
+
+	profile, err := a.userService.GetProfile(ctx, userId)
+	if err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+			return
+		}
+		logEntry.Error("failed to get user profile", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	login := profile.Username
+	if login == "" {
+		login = profile.Email
+	}
+
+	passwordUserId, err := a.checkPasswordLogin(r, login, reqBody.Password)
+	if err != nil {
+		var throttled *user.LoginThrottledError
+		switch {
+		case errors.Is(err, errInvalidCredentials):
+			httputil.RespondWithError(w, http.StatusUnauthorized, "incorrect password")
+		case errors.As(err, &throttled):
+			w.Header().Set("Retry-After", retryAfterSeconds(throttled.RetryAfter))
+			httputil.RespondWithError(w, http.StatusTooManyRequests, throttled.Error())
+		default:
+			logEntry.Error("failed to check password", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	if passwordUserId != userId {
+		httputil.RespondWithError(w, http.StatusUnauthorized, "incorrect password")
+		return
+	}
+
+	var questions = make([]user.UserSecurityQuestion, 0, len(reqBody.Questions))
+	for _, q := range reqBody.Questions {
+		questions = append(questions, user.UserSecurityQuestion{
+			QuestionId: q.QuestionId,
+			Question:   q.Question,
+			Answer:     q.Answer,
+		})
+	}
+
+	if err := a.userService.ReplaceUserSecurityQuestions(ctx, userId, questions); err != nil {
+		switch {
+		case errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "security questions are missing, repeated or invalid")
+		case errors.Is(err, user.ErrInvalidSecurityQuestion):
+			httputil.RespondWithError(w, http.StatusBadRequest, err.Error())
+		default:
+			logEntry.Error("failed to replace user security questions", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	a.recordAuthEvent(r, audit.Event{
+		Type:   audit.EventSecurityQuestionsChanged,
+		UserId: userId,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
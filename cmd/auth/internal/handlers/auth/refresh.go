@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/token"
+)
+
+type refreshRequestBody struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type refreshResponse struct {
+	tokenResponse
+}
+
+// Refresh exchanges a refresh token for a new JWT and refresh token. The presented refresh
+// token can't be used again.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read refresh request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody refreshRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil || strings.TrimSpace(reqBody.RefreshToken) == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required refresh token")
+		return
+	}
+
+	refreshToken, err := h.tokenService.RotateRefreshToken(r.Context(), reqBody.RefreshToken, "")
+	if err != nil {
+		switch {
+		case errors.Is(err, token.ErrTokenReused):
+			// someone other than the client may hold the token family, everything issued
+			// from it has been revoked and the user must log in again
+			logEntry.Warn("refresh token reuse detected, token family revoked")
+			httputil.RespondWithError(w, http.StatusUnauthorized, "invalid refresh token")
+		case errors.Is(err, token.ErrInvalidToken), errors.Is(err, token.ErrTokenExpired):
+			httputil.RespondWithError(w, http.StatusUnauthorized, "invalid refresh token")
+		default:
+			logEntry.Error("failed to rotate refresh token", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	jwtToken, err := h.createJWT(r.Context(), refreshToken.UserId)
+	if err != nil {
+		logEntry.Error("failed to create jwt", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := h.recordSession(r, refreshToken, jwtToken); err != nil {
+		logEntry.Error("failed to record session", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	h.recordAuthEvent(r, audit.Event{
+		Type:   audit.EventTokenRefreshed,
+		UserId: refreshToken.UserId,
+	})
+
+	httputil.RespondWithJSON(w, http.StatusOK, refreshResponse{
+		tokenResponse: tokenResponse{
+			JWT:                   jwtToken.jwt,
+			RefreshToken:          refreshToken.Token,
+			RefreshTokenExpiresAt: refreshToken.ExpiresAt,
+		},
+	})
+}
@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/token"
+)
+
+// tokenRevocationChecker lets the auth server check its own denylist when verifying tokens
+type tokenRevocationChecker struct {
+	tokenService token.ServiceIface
+}
+
+func (t *tokenRevocationChecker) IsTokenRevoked(ctx context.Context, claims autologjwt.AutologAPIJWTClaims) (bool, error) {
+	if claims.ID == "" {
+		return false, nil
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	return t.tokenService.IsAccessTokenRevoked(ctx, claims.ID, claims.Subject, issuedAt)
+}
+
+// Revoke revokes an access or refresh token, per RFC 7009. Holding the token is enough to
+// revoke it. Unknown, invalid and expired tokens are treated as already revoked.
+// https://datatracker.ietf.org/doc/html/rfc7009
+func (h *AuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidRequest, "invalid form body")
+		return
+	}
+
+	tokenString := strings.TrimSpace(r.PostForm.Get("token"))
+	if tokenString == "" {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidRequest, "missing required token")
+		return
+	}
+
+	hint := r.PostForm.Get("token_type_hint")
+	switch hint {
+	case "", tokenTypeHintAccessToken, tokenTypeHintRefreshToken, tokenTypeHintPersonalAccessToken:
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorUnsupportedTokenType, "")
+		return
+	}
+
+	// the hint is only a hint, JWTs and personal access tokens are easy to tell apart from
+	// opaque refresh tokens
+	var userId, tokenType string
+	var err error
+	switch {
+	case isJWT(tokenString):
+		tokenType = tokenTypeHintAccessToken
+		if userId, err = h.revokeAccessToken(r.Context(), tokenString); err != nil {
+			logEntry.Error("failed to revoke access token", err)
+			httputil.RespondWithError(w, http.StatusServiceUnavailable, "")
+			return
+		}
+	case autologjwt.IsPersonalAccessToken(tokenString):
+		tokenType = tokenTypeHintPersonalAccessToken
+		if userId, err = h.revokePersonalAccessToken(r.Context(), tokenString); err != nil {
+			logEntry.Error("failed to revoke personal access token", err)
+			httputil.RespondWithError(w, http.StatusServiceUnavailable, "")
+			return
+		}
+	default:
+		tokenType = tokenTypeHintRefreshToken
+		if userId, err = h.revokeRefreshToken(r.Context(), tokenString); err != nil {
+			logEntry.Error("failed to revoke refresh token", err)
+			httputil.RespondWithError(w, http.StatusServiceUnavailable, "")
+			return
+		}
+	}
+
+	// tokens that were already inactive aren't worth an audit event
+	if userId != "" {
+		h.recordAuthEvent(r, audit.Event{
+			Type:   audit.EventTokenRevoked,
+			UserId: userId,
+			Detail: tokenType,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// revokeAccessToken revokes an access JWT. Returns the user the token was issued to, or an
+// empty string if it was already inactive.
+func (h *AuthHandler) revokeAccessToken(ctx context.Context, tokenString string) (string, error) {
+	valid, claims, err := h.jwtVerifier.VerifyToken(ctx, tokenString)
+	if err != nil || !valid {
+		// expired, already revoked or not one of ours, nothing to revoke
+		return "", nil
+	}
+
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return "", nil
+	}
+
+	// service tokens aren't a user's and can't be denylisted, they're short lived and deleting
+	// the service client stops new ones being issued
+	if claims.IsServiceToken() {
+		return "", nil
+	}
+
+	if err := h.tokenService.RevokeAccessToken(ctx, token.RevokeAccessTokenInput{
+		Id:        claims.ID,
+		UserId:    claims.Subject,
+		ExpiresAt: claims.ExpiresAt.Time,
+		Reason:    "revoked",
+	}); err != nil {
+		return "", err
+	}
+
+	return claims.Subject, nil
+}
+
+// revokePersonalAccessToken revokes a personal access token. Returns the user the token was
+// created by, or an empty string if it was already inactive.
+func (h *AuthHandler) revokePersonalAccessToken(ctx context.Context, tokenString string) (string, error) {
+	pat, err := h.tokenService.GetPersonalAccessToken(ctx, tokenString)
+	if err != nil {
+		if isPersonalAccessTokenInactive(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	if err := h.tokenService.RevokePersonalAccessToken(ctx, pat.UserId, pat.Id); err != nil {
+		if errors.Is(err, token.ErrInvalidToken) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return pat.UserId, nil
+}
+
+// revokeRefreshToken revokes a refresh token's family. Returns the user the token was issued
+// to, or an empty string if it was already inactive. Inactive tokens still revoke the rest of
+// their family.
+func (h *AuthHandler) revokeRefreshToken(ctx context.Context, tokenString string) (string, error) {
+	var userId string
+	refreshToken, err := h.tokenService.GetRefreshToken(ctx, tokenString)
+	switch {
+	case err == nil:
+		userId = refreshToken.UserId
+	case !errors.Is(err, token.ErrInvalidToken) && !errors.Is(err, token.ErrTokenExpired):
+		return "", err
+	}
+
+	if err := h.tokenService.RevokeRefreshToken(ctx, tokenString); err != nil {
+		return "", err
+	}
+
+	return userId, nil
+}
+
+// isJWT checks if the token looks like a JWT, three base64 segments separated by dots. Opaque
+// refresh tokens never contain a dot.
+func isJWT(tokenString string) bool {
+	return strings.Count(tokenString, ".") == 2
+}
+
+// introspectResponse is the RFC 7662 introspection response. Only Active is set for inactive
+// tokens.
+type introspectResponse struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	TokenId   string `json:"jti,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+
+	// EmailVerified isn't registered, services need it to treat personal access tokens like JWTs
+	EmailVerified bool `json:"email_verified,omitempty"`
+}
+
+// Introspect reports if a token is active and who it belongs to, per RFC 7662. Only service
+// clients with the tokens:introspect permission may call it, ex. services verifying personal
+// access tokens.
+// https://datatracker.ietf.org/doc/html/rfc7662
+func (h *AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidRequest, "invalid form body")
+		return
+	}
+
+	tokenString := strings.TrimSpace(r.PostForm.Get("token"))
+	if tokenString == "" {
+		respondWithOAuthError(w, http.StatusBadRequest, oauthErrorInvalidRequest, "missing required token")
+		return
+	}
+
+	if autologjwt.IsPersonalAccessToken(tokenString) {
+		introspection, err := h.introspectPersonalAccessToken(r.Context(), tokenString)
+		if err != nil {
+			if isPersonalAccessTokenInactive(err) {
+				httputil.RespondWithJSON(w, http.StatusOK, introspectResponse{Active: false})
+				return
+			}
+			logEntry.Error("failed to introspect personal access token", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+			return
+		}
+
+		httputil.RespondWithJSON(w, http.StatusOK, introspectResponse{
+			Active:        true,
+			TokenType:     tokenTypeHintPersonalAccessToken,
+			Subject:       introspection.pat.UserId,
+			Issuer:        h.jwtIssuer,
+			TokenId:       introspection.pat.Id,
+			ExpiresAt:     introspection.pat.ExpiresAt.Unix(),
+			IssuedAt:      introspection.pat.CreatedAt.Unix(),
+			Scope:         strings.Join(introspection.permissions, " "),
+			EmailVerified: introspection.emailVerified,
+		})
+		return
+	}
+
+	if !isJWT(tokenString) {
+		refreshToken, err := h.tokenService.GetRefreshToken(r.Context(), tokenString)
+		if err != nil {
+			if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenExpired) {
+				httputil.RespondWithJSON(w, http.StatusOK, introspectResponse{Active: false})
+				return
+			}
+			logEntry.Error("failed to get refresh token", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+			return
+		}
+
+		httputil.RespondWithJSON(w, http.StatusOK, introspectResponse{
+			Active:    true,
+			TokenType: tokenTypeHintRefreshToken,
+			Subject:   refreshToken.UserId,
+			Issuer:    h.jwtIssuer,
+			ExpiresAt: refreshToken.ExpiresAt.Unix(),
+			ClientId:  refreshToken.ClientId,
+			Scope:     refreshToken.Scope,
+		})
+		return
+	}
+
+	valid, claims, err := h.jwtVerifier.VerifyToken(r.Context(), tokenString)
+	if err != nil || !valid {
+		if err != nil && !errors.Is(err, jwt.ErrTokenExpired) && !errors.Is(err, autologjwt.ErrTokenRevoked) {
+			logEntry.Warn("introspected token failed verification", "error", err.Error())
+		}
+		httputil.RespondWithJSON(w, http.StatusOK, introspectResponse{Active: false})
+		return
+	}
+
+	resp := introspectResponse{
+		Active:    true,
+		TokenType: tokenTypeHintAccessToken,
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		TokenId:   claims.ID,
+		ClientId:  claims.ClientId,
+		Scope:     claims.Scope,
+
+		EmailVerified: claims.EmailVerified,
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		resp.NotBefore = claims.NotBefore.Unix()
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// GetRevocations is the revocation feed polled by jwt.TokenVerifier. Accepts an optional since
+// query param, RFC 3339, to only list newer revocations.
+func (h *AuthHandler) GetRevocations(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			httputil.RespondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	generatedAt := h.calendarService.NowUTC()
+
+	revocations, err := h.tokenService.ListRevocations(r.Context(), since,
+		time.Duration(h.jwtExpiryLengthMinutes)*time.Minute)
+	if err != nil {
+		logEntry.Error("failed to list revocations", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var feed = autologjwt.RevocationFeed{
+		GeneratedAt: generatedAt,
+		Tokens:      make([]autologjwt.RevokedToken, 0, len(revocations.Tokens)),
+		Users:       make([]autologjwt.RevokedUser, 0, len(revocations.Users)),
+	}
+	for _, t := range revocations.Tokens {
+		feed.Tokens = append(feed.Tokens, autologjwt.RevokedToken{
+			Id:        t.Id,
+			ExpiresAt: t.ExpiresAt,
+		})
+	}
+	for _, u := range revocations.Users {
+		feed.Users = append(feed.Users, autologjwt.RevokedUser{
+			UserId:       u.UserId,
+			IssuedBefore: u.IssuedBefore,
+		})
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, feed)
+}
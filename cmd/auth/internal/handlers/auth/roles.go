@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+type userRolesResponse struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// GetUserRoles lists the roles a user holds and the permissions they grant
+func (h *AuthHandler) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	roles, err := h.userService.GetUserRoles(r.Context(), chi.URLParam(r, "userId"))
+	if err != nil {
+		if errors.Is(err, user.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "")
+			return
+		}
+		logEntry.Error("failed to get user roles", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, userRolesResponse{
+		Roles:       roleClaims(roles),
+		Permissions: permissionClaims(user.PermissionsForRoles(roles)),
+	})
+}
+
+// AddUserRole grants a user a role. It's in their tokens from their next refresh.
+func (h *AuthHandler) AddUserRole(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	err := h.userService.AddUserRole(r.Context(), chi.URLParam(r, "userId"), user.Role(chi.URLParam(r, "role")))
+	if err != nil {
+		if errors.Is(err, user.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "unknown role")
+			return
+		}
+		logEntry.Error("failed to add user role", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequireServiceRolePermission is a middleware for the internal role routes. Services may only
+// manage the roles user.ServiceRolePermission allows, each with its own permission, so a service
+// granting mechanic can't grant admin.
+func (h *AuthHandler) RequireServiceRolePermission(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := autologjwt.GetClaimsFromContext(r.Context())
+		if !ok {
+			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+			return
+		}
+
+		permission, ok := user.ServiceRolePermission(user.Role(chi.URLParam(r, "role")))
+		if !ok {
+			httputil.RespondWithError(w, http.StatusForbidden, "the role can't be managed by services")
+			return
+		}
+
+		if !claims.HasPermission(string(permission)) {
+			httputil.RespondWithError(w, http.StatusForbidden, "")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RemoveUserRole revokes a role from a user. Their tokens are revoked too, so the role's
+// permissions stop working now instead of when the tokens expire.
+func (h *AuthHandler) RemoveUserRole(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	userId := chi.URLParam(r, "userId")
+
+	err := h.userService.RemoveUserRole(r.Context(), userId, user.Role(chi.URLParam(r, "role")))
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "unknown role")
+		case errors.Is(err, user.ErrNotFound):
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+		case errors.Is(err, user.ErrLastAdmin):
+			httputil.RespondWithError(w, http.StatusConflict, "grant another user admin before removing the last one")
+		default:
+			logEntry.Error("failed to remove user role", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	if err := h.tokenService.RevokeUserTokens(r.Context(), userId); err != nil {
+		logEntry.Error("failed to revoke user tokens after removing role", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddServiceUserRole grants a user a role for the calling service, which is recorded as the
+// grant's owner, so RemoveServiceUserRole can't revoke the role an admin granted.
+func (h *AuthHandler) AddServiceUserRole(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := autologjwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	err := h.userService.AddServiceUserRole(r.Context(), chi.URLParam(r, "userId"),
+		user.Role(chi.URLParam(r, "role")), claims.GetUserId())
+	if err != nil {
+		if errors.Is(err, user.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "unknown role")
+			return
+		}
+		logEntry.Error("failed to add user role", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveServiceUserRole revokes a role the calling service granted a user. Returns 404 if the
+// user doesn't hold the role from the service, ex. an admin granted it. Their tokens are revoked
+// too, same as RemoveUserRole.
+func (h *AuthHandler) RemoveServiceUserRole(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := autologjwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	userId := chi.URLParam(r, "userId")
+
+	err := h.userService.RemoveServiceUserRole(r.Context(), userId, user.Role(chi.URLParam(r, "role")), claims.GetUserId())
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "unknown role")
+		case errors.Is(err, user.ErrNotFound):
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+		default:
+			logEntry.Error("failed to remove user role", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	if err := h.tokenService.RevokeUserTokens(r.Context(), userId); err != nil {
+		logEntry.Error("failed to revoke user tokens after removing role", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
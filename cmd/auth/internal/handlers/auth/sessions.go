@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/token"
+)
+
+type sessionResponse struct {
+	Id         string    `json:"id"`
+	IPAddress  string    `json:"ipAddress"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+
+	// Current is true for the session the request was made from
+	Current bool `json:"current"`
+}
+
+type listSessionsResponse struct {
+	Sessions []sessionResponse `json:"sessions"`
+}
+
+// ListSessions lists the devices the user is logged in on
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	sessions, err := h.tokenService.ListSessions(r.Context(), claims.GetUserId())
+	if err != nil {
+		logEntry.Error("failed to list sessions", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := listSessionsResponse{
+		Sessions: make([]sessionResponse, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, sessionResponse{
+			Id:         session.Id,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			Current:    claims.ID != "" && claims.ID == session.AccessTokenId,
+		})
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// RevokeSession signs the user out of one of their devices. The device's refresh token and
+// latest access token stop working right away.
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	sessionId := chi.URLParam(r, "sessionId")
+
+	if err := h.tokenService.RevokeSession(r.Context(), claims.GetUserId(), sessionId); err != nil {
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+			return
+		}
+		logEntry.Error("failed to revoke session", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	h.recordAuthEvent(r, audit.Event{
+		Type:   audit.EventSessionRevoked,
+		UserId: claims.GetUserId(),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type authEventResponse struct {
+	Type      string    `json:"type"`
+	Detail    string    `json:"detail,omitempty"`
+	IPAddress string    `json:"ipAddress"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type listAuthEventsResponse struct {
+	Events []authEventResponse `json:"events"`
+}
+
+// ListAuthEvents lists the user's 100 most recent authentication events, like logins and
+// password changes, so they can spot activity that wasn't them
+func (h *AuthHandler) ListAuthEvents(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	events, err := h.auditService.ListUserEvents(r.Context(), claims.GetUserId(), 0)
+	if err != nil {
+		logEntry.Error("failed to list auth events", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := listAuthEventsResponse{
+		Events: make([]authEventResponse, 0, len(events)),
+	}
+	for _, event := range events {
+		resp.Events = append(resp.Events, authEventResponse{
+			Type:      string(event.Type),
+			Detail:    event.Detail,
+			IPAddress: event.IPAddress,
+			UserAgent: event.UserAgent,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
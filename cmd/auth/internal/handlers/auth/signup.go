@@ -2,6 +2,7 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/mail"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/keola-dunn/autolog/internal/httputil"
 	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/audit"
 	"github.com/keola-dunn/autolog/internal/service/user"
 )
 
@@ -20,8 +22,10 @@ type signUpRequestBody struct {
 	Questions []signupQuestions `json:"securityQuestions"`
 }
 
+// signupQuestions is either an offered question's id or a custom question, and the answer
 type signupQuestions struct {
 	QuestionId string `json:"questionId"`
+	Question   string `json:"question"`
 	Answer     string `json:"answer"`
 }
 
@@ -32,8 +36,8 @@ func (s *signUpRequestBody) valid() (bool, string) {
 	if strings.TrimSpace(s.Username) == "" || len(s.Username) > 64 {
 		return false, "username is missing or invalid"
 	}
-	if strings.TrimSpace(s.Password) == "" || len(s.Password) < 3 {
-		return false, "missing or too short password"
+	if err := user.CheckPasswordStrength(s.Password, s.Username, s.Email); err != nil {
+		return false, err.Error()
 	}
 	if len(s.Questions) < 3 {
 		return false, "missing security questions"
@@ -42,7 +46,7 @@ func (s *signUpRequestBody) valid() (bool, string) {
 }
 
 type signUpResponse struct {
-	JWT string `json:"jwt"`
+	tokenResponse
 }
 
 func (a *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
@@ -94,6 +98,7 @@ func (a *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 	for _, q := range reqBody.Questions {
 		secQuestions = append(secQuestions, user.UserSecurityQuestion{
 			QuestionId: q.QuestionId,
+			Question:   q.Question,
 			Answer:     q.Answer,
 		})
 	}
@@ -106,19 +111,37 @@ func (a *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 		Role:              user.RoleUser,
 	})
 	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrWeakPassword), errors.Is(err, user.ErrInvalidSecurityQuestion):
+			httputil.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "security questions are missing, repeated or invalid")
+			return
+		}
 		logEntry.Error("failed to create new user", err)
 		httputil.RespondWithError(w, http.StatusInternalServerError, "")
 		return
 	}
 
-	jwtToken, err := a.createJWT(userId)
+	if err := a.sendVerificationEmail(ctx, userId, reqBody.Email); err != nil {
+		// the user can ask for another verification email, don't fail the signup
+		logEntry.Error("failed to send verification email", err)
+	}
+
+	a.recordAuthEvent(r, audit.Event{
+		Type:   audit.EventSignup,
+		UserId: userId,
+	})
+
+	tokens, err := a.issueTokens(r, userId)
 	if err != nil {
-		logEntry.Error("failed to create new user jwt", err)
+		logEntry.Error("failed to issue new user tokens", err)
 		httputil.RespondWithError(w, http.StatusInternalServerError, "")
 		return
 	}
 
 	httputil.RespondWithJSON(w, http.StatusCreated, signUpResponse{
-		JWT: jwtToken,
+		tokenResponse: tokens,
 	})
 }
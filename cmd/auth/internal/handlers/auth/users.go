@@ -1,7 +1,346 @@
 package auth
 
-import "net/http"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/accountdeletion"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/email"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+type notificationPreferences struct {
+	ServiceReminders bool `json:"serviceReminders"`
+	ProductUpdates   bool `json:"productUpdates"`
+}
+
+type unitPreferences struct {
+	Distance string `json:"distance"`
+	Volume   string `json:"volume"`
+}
+
+type userResponse struct {
+	Id            string `json:"id"`
+	Username      string `json:"username"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+
+	NotificationPreferences notificationPreferences `json:"notificationPreferences"`
+	UnitPreferences         unitPreferences         `json:"unitPreferences"`
+
+	// DeletionScheduledAt is when the account will be deleted, if the user asked for it
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt,omitempty"`
+}
+
+func newUserResponse(p user.Profile) userResponse {
+	return userResponse{
+		Id:            p.Id,
+		Username:      p.Username,
+		Name:          p.Name,
+		Email:         p.Email,
+		EmailVerified: p.EmailVerifiedAt != nil,
+		NotificationPreferences: notificationPreferences{
+			ServiceReminders: p.NotificationPreferences.ServiceReminders,
+			ProductUpdates:   p.NotificationPreferences.ProductUpdates,
+		},
+		UnitPreferences: unitPreferences{
+			Distance: string(p.UnitPreferences.Distance),
+			Volume:   string(p.UnitPreferences.Volume),
+		},
+		DeletionScheduledAt: p.DeletionScheduledAt,
+	}
+}
+
+// GetUser gets the caller's profile
 func (a *AuthHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	profile, err := a.userService.GetProfile(r.Context(), claims.GetUserId())
+	if err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+			return
+		}
+		logEntry.Error("failed to get user profile", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, newUserResponse(profile))
+}
+
+// updateUserRequestBody is a partial profile, missing fields are left as they are
+type updateUserRequestBody struct {
+	Name     *string `json:"name"`
+	Username *string `json:"username"`
+
+	// Email starts an email change, it's applied once both addresses confirm it
+	Email *string `json:"email"`
+
+	NotificationPreferences *notificationPreferences `json:"notificationPreferences"`
+	UnitPreferences         *unitPreferences         `json:"unitPreferences"`
+}
+
+type updateUserResponse struct {
+	userResponse
+
+	// PendingEmail is the new email waiting for both addresses to confirm it
+	PendingEmail string `json:"pendingEmail,omitempty"`
+}
+
+// UpdateUser changes the caller's profile. A new email isn't applied right away, a
+// confirmation link is sent to both addresses like StartEmailChange.
+func (a *AuthHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read update user request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var reqBody updateUserRequestBody
+	if err := json.Unmarshal(data, &reqBody); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if reqBody.Email != nil {
+		if _, err := mail.ParseAddress(*reqBody.Email); err != nil {
+			httputil.RespondWithError(w, http.StatusBadRequest, "email address is invalid")
+			return
+		}
+	}
+
+	ctx := r.Context()
+	userId := claims.GetUserId()
+
+	input := user.UpdateProfileInput{
+		UserId:   userId,
+		Name:     reqBody.Name,
+		Username: reqBody.Username,
+	}
+	if reqBody.NotificationPreferences != nil {
+		input.NotificationPreferences = &user.NotificationPreferences{
+			ServiceReminders: reqBody.NotificationPreferences.ServiceReminders,
+			ProductUpdates:   reqBody.NotificationPreferences.ProductUpdates,
+		}
+	}
+	if reqBody.UnitPreferences != nil {
+		input.UnitPreferences = &user.UnitPreferences{
+			Distance: user.DistanceUnit(reqBody.UnitPreferences.Distance),
+			Volume:   user.VolumeUnit(reqBody.UnitPreferences.Volume),
+		}
+	}
+
+	profile, err := a.userService.UpdateProfile(ctx, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest,
+				"username must be 1 to 64 characters, name at most 256, and units one of mi, km, gal or l")
+		case errors.Is(err, user.ErrAlreadyExists):
+			httputil.RespondWithError(w, http.StatusConflict, "username already exists!")
+		case errors.Is(err, user.ErrNotFound):
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+		default:
+			logEntry.Error("failed to update user profile", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	resp := updateUserResponse{
+		userResponse: newUserResponse(profile),
+	}
+
+	if reqBody.Email != nil && !strings.EqualFold(strings.TrimSpace(*reqBody.Email), profile.Email) {
+		change, err := a.userService.StartEmailChange(ctx, userId, *reqBody.Email)
+		if err != nil {
+			if errors.Is(err, user.ErrAlreadyExists) {
+				httputil.RespondWithError(w, http.StatusConflict, "email already exists!")
+				return
+			}
+			logEntry.Error("failed to start email change", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+			return
+		}
+
+		if err := a.sendEmailChangeConfirmations(ctx, change); err != nil {
+			logEntry.Error("failed to send email change confirmations", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+			return
+		}
+		resp.PendingEmail = change.NewEmail
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+type deleteUserResponse struct {
+	DeletionScheduledAt time.Time `json:"deletionScheduledAt"`
+}
+
+// DeleteUser schedules the caller's account for deletion. Until the grace period is over the
+// user can still log in and cancel. Then their account is anonymized, and the other services
+// remove their cars, logs and images.
+func (a *AuthHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	ctx := r.Context()
+
+	scheduledAt, err := a.userService.ScheduleAccountDeletion(ctx, claims.GetUserId())
+	if err != nil {
+		if errors.Is(err, user.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+			return
+		}
+		logEntry.Error("failed to schedule account deletion", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := a.sendAccountDeletionEmail(ctx, claims.GetUserId(), scheduledAt); err != nil {
+		// the deletion is scheduled either way, the user can see it on their profile
+		logEntry.Error("failed to send account deletion email", err)
+	}
+
+	httputil.RespondWithJSON(w, http.StatusAccepted, deleteUserResponse{
+		DeletionScheduledAt: scheduledAt,
+	})
+}
+
+// sendAccountDeletionEmail tells the user when their account will be deleted, in case it wasn't
+// them who asked
+func (a *AuthHandler) sendAccountDeletionEmail(ctx context.Context, userId string, scheduledAt time.Time) error {
+	profile, err := a.userService.GetProfile(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("failed to get user profile: %w", err)
+	}
+
+	if profile.Email == "" {
+		return nil
+	}
+
+	return a.emailService.Send(ctx, email.Message{
+		To:      profile.Email,
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf("Your account, and your cars, service logs and images, will be deleted on %s. "+
+			"If you didn't ask for this, or changed your mind, log in and cancel the deletion before then.",
+			scheduledAt.Format("January 2, 2006")),
+	})
+}
+
+// CancelUserDeletion keeps the caller's account, if its deletion hasn't happened yet
+func (a *AuthHandler) CancelUserDeletion(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := a.userService.CancelAccountDeletion(r.Context(), claims.GetUserId()); err != nil {
+		if errors.Is(err, user.ErrDeletionNotScheduled) {
+			httputil.RespondWithError(w, http.StatusConflict, "account is not scheduled for deletion")
+			return
+		}
+		logEntry.Error("failed to cancel account deletion", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAccountDeletions is the account deletion feed polled by accountdeletion.Poller. Accepts an
+// optional since query param, RFC 3339, to only list newer deletions.
+func (a *AuthHandler) GetAccountDeletions(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			httputil.RespondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	generatedAt := a.calendarService.NowUTC()
+
+	accounts, err := a.userService.ListDeletedAccounts(r.Context(), since)
+	if err != nil {
+		logEntry.Error("failed to list deleted accounts", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var feed = accountdeletion.Feed{
+		GeneratedAt: generatedAt,
+		Users:       make([]accountdeletion.DeletedUser, 0, len(accounts)),
+	}
+	for _, account := range accounts {
+		feed.Users = append(feed.Users, accountdeletion.DeletedUser{
+			UserId:    account.UserId,
+			DeletedAt: account.DeletedAt,
+		})
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, feed)
+}
+
+// UnlockUser lifts a user's lockout after too many failed logins or wrong MFA codes, and clears
+// both. Logins from IP addresses that are locked out stay locked out.
+func (a *AuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	if err := a.userService.UnlockUser(r.Context(), chi.URLParam(r, "userId")); err != nil {
+		if errors.Is(err, user.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "")
+			return
+		}
+		logEntry.Error("failed to unlock user", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
 
+	w.WriteHeader(http.StatusNoContent)
 }
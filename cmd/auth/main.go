@@ -2,25 +2,37 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/keola-dunn/autolog/cmd/auth/internal/handlers/auth"
 	"github.com/keola-dunn/autolog/internal/calendar"
 	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/oidc"
 	"github.com/keola-dunn/autolog/internal/platform/postgres"
 	"github.com/keola-dunn/autolog/internal/random"
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/keola-dunn/autolog/internal/service/email"
+	"github.com/keola-dunn/autolog/internal/service/mfa"
+	"github.com/keola-dunn/autolog/internal/service/oauth"
+	"github.com/keola-dunn/autolog/internal/service/passkey"
+	"github.com/keola-dunn/autolog/internal/service/signingkey"
+	"github.com/keola-dunn/autolog/internal/service/token"
 	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/keola-dunn/autolog/internal/webauthn"
 )
 
 var environmentConfig struct {
@@ -33,8 +45,88 @@ var environmentConfig struct {
 	// JWTSecret              string `envconfig:"JWT_SECRET"`
 	JWTExpiryLengthMinutes int64 `envconfig:"JWT_EXPIRY_LENGTH_MINUTES" default:"30"`
 
-	JWTPublicKeyPath  string `envconfig:"JWT_PUBLIC_KEY_PATH" required:"true"`
-	JWTPrivateKeyPath string `envconfig:"JWT_PRIVATE_KEY_PATH" required:"true"`
+	// JWTAudience is the auth server's own audience, its authenticated endpoints only accept
+	// tokens for it
+	JWTAudience string `envconfig:"JWT_AUDIENCE" default:"auth-api"`
+
+	// UserTokenAudiences are the services tokens issued to users may be used with. Service
+	// tokens are only for the audience they're requested for.
+	UserTokenAudiences []string `envconfig:"USER_TOKEN_AUDIENCES" default:"auth-api,autolog-api,images"`
+
+	// RefreshTokenExpiryLengthHours is configured separately from the JWT, refresh tokens are
+	// expected to live much longer
+	RefreshTokenExpiryLengthHours int64 `envconfig:"REFRESH_TOKEN_EXPIRY_LENGTH_HOURS" default:"720"`
+
+	// JWTPrivateKeyPath is the RSA key the auth server signed with before the keyring. It is
+	// imported as the first active key when the keyring is empty, so tokens it signed keep
+	// verifying. Optional, a new key is generated without it.
+	JWTPrivateKeyPath string `envconfig:"JWT_PRIVATE_KEY_PATH"`
+
+	// SigningKeyEncryptionSecret encrypts the keyring's private keys at rest, at least 32 bytes
+	SigningKeyEncryptionSecret string `envconfig:"SIGNING_KEY_ENCRYPTION_SECRET" required:"true"`
+
+	// SigningKeyAlgorithm is the algorithm new signing keys are created with, RS256, ES256 or
+	// EdDSA. Switching takes effect at the rotation after next, once a key of the new
+	// algorithm has been published.
+	SigningKeyAlgorithm string `envconfig:"SIGNING_KEY_ALGORITHM" default:"RS256"`
+
+	// SigningKeyRetireAfterHours is how long keys stay published after they're rotated out.
+	// Must be longer than JWTs live.
+	SigningKeyRetireAfterHours int64 `envconfig:"SIGNING_KEY_RETIRE_AFTER_HOURS" default:"24"`
+
+	// EmailTokenSecret signs the verification links emailed to users, at least 32 bytes
+	EmailTokenSecret string `envconfig:"EMAIL_TOKEN_SECRET" required:"true"`
+
+	// PasswordResetDecoySecret picks the security questions shown when a password reset is
+	// started for an unknown login
+	PasswordResetDecoySecret string `envconfig:"PASSWORD_RESET_DECOY_SECRET" required:"true"`
+
+	// AppBaseUrl is where links in emails point
+	AppBaseUrl string `envconfig:"APP_BASE_URL" default:"http://localhost:3000"`
+
+	// SMTP configs, emails are logged when SMTPHost is empty. Local dev only.
+	SMTPHost     string `envconfig:"SMTP_HOST"`
+	SMTPPort     int64  `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername string `envconfig:"SMTP_USERNAME"`
+	SMTPPassword string `envconfig:"SMTP_PASSWORD"`
+	EmailFrom    string `envconfig:"EMAIL_FROM"`
+
+	// TOTPIssuer is the name authenticator apps show for the account
+	TOTPIssuer string `envconfig:"TOTP_ISSUER" default:"Autolog"`
+
+	// WebAuthn relying party configs. WebAuthnRPId is the domain passkeys are scoped to, and
+	// WebAuthnOrigins are the comma separated origins of the web and native apps.
+	WebAuthnRPId    string   `envconfig:"WEBAUTHN_RP_ID" default:"localhost"`
+	WebAuthnRPName  string   `envconfig:"WEBAUTHN_RP_NAME" default:"Autolog"`
+	WebAuthnOrigins []string `envconfig:"WEBAUTHN_ORIGINS" default:"http://localhost:3000"`
+
+	// OIDCProviders are the comma separated names of the external providers users can log in
+	// with, ex. "google". Each is configured with OIDC_<NAME>_* env vars, see oidcProviderConfig.
+	OIDCProviders []string `envconfig:"OIDC_PROVIDERS"`
+
+	// OAuthIssuerUrl is the auth server's public url as an OpenID provider. It is the issuer
+	// of ID tokens and the base of the endpoints in the discovery document.
+	OAuthIssuerUrl string `envconfig:"OAUTH_ISSUER_URL" default:"http://localhost:8080"`
+
+	// TrustProxyHeaders takes the client's IP address from X-Forwarded-For and X-Real-IP. Only
+	// set it behind a proxy that overwrites them, clients could dodge per-IP login limits otherwise.
+	TrustProxyHeaders bool `envconfig:"TRUST_PROXY_HEADERS" default:"false"`
+
+	// AccountDeletionGracePeriodDays is how long users can cancel deleting their account
+	AccountDeletionGracePeriodDays int64 `envconfig:"ACCOUNT_DELETION_GRACE_PERIOD_DAYS" default:"30"`
+}
+
+// legacyKeyId is the kid of the key the auth server signed with before the keyring
+const legacyKeyId = "autolog-public-key"
+
+// oidcProviderConfig configures an external provider, ex. OIDC_GOOGLE_ISSUER for google
+type oidcProviderConfig struct {
+	// Issuer is the provider's issuer identifier, ex. https://accounts.google.com
+	Issuer       string   `envconfig:"ISSUER" required:"true"`
+	ClientId     string   `envconfig:"CLIENT_ID" required:"true"`
+	ClientSecret string   `envconfig:"CLIENT_SECRET"`
+	RedirectUrl  string   `envconfig:"REDIRECT_URL" required:"true"`
+	Scopes       []string `envconfig:"SCOPES"`
 }
 
 func main() {
@@ -49,28 +141,29 @@ func main() {
 		logger.Fatal("failed to process environment config", err)
 	}
 
-	publicKeyFile, err := os.Open(environmentConfig.JWTPublicKeyPath)
-	if err != nil {
-		logger.Fatal(fmt.Sprintf("failed to open jwt public key: %s",
-			environmentConfig.JWTPublicKeyPath), err)
+	signingKeyRetireAfter := time.Duration(environmentConfig.SigningKeyRetireAfterHours) * time.Hour
+	if signingKeyRetireAfter <= time.Duration(environmentConfig.JWTExpiryLengthMinutes)*time.Minute {
+		logger.Fatal("signing keys must stay published longer than jwts live", nil)
 	}
-	defer publicKeyFile.Close()
 
-	jwtPublicKey, err := io.ReadAll(publicKeyFile)
-	if err != nil {
-		logger.Fatal("failed to read public key file", err)
-	}
+	var legacyPrivateKey *rsa.PrivateKey
+	if environmentConfig.JWTPrivateKeyPath != "" {
+		privateKeyFile, err := os.Open(environmentConfig.JWTPrivateKeyPath)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("failed to open jwt private key: %s",
+				environmentConfig.JWTPrivateKeyPath), err)
+		}
+		defer privateKeyFile.Close()
 
-	privateKeyFile, err := os.Open(environmentConfig.JWTPrivateKeyPath)
-	if err != nil {
-		logger.Fatal(fmt.Sprintf("failed to open jwt private key: %s",
-			environmentConfig.JWTPrivateKeyPath), err)
-	}
-	defer privateKeyFile.Close()
+		privateKeyData, err := io.ReadAll(privateKeyFile)
+		if err != nil {
+			logger.Fatal("failed to read private key file", err)
+		}
 
-	jwtPrivateKey, err := io.ReadAll(privateKeyFile)
-	if err != nil {
-		logger.Fatal("failed to read private key file", err)
+		legacyPrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(privateKeyData)
+		if err != nil {
+			logger.Fatal("failed to parse private key", err)
+		}
 	}
 
 	///////////////////////////////////////
@@ -99,27 +192,144 @@ func main() {
 
 	calendarSvc := calendar.NewService()
 
-	userSvc := user.NewService(user.ServiceConfig{
+	userSvc, err := user.NewService(user.ServiceConfig{
+		DB:                         db,
+		RandomGenerator:            randomSvc,
+		CalendarService:            calendarSvc,
+		AccountDeletionGracePeriod: time.Duration(environmentConfig.AccountDeletionGracePeriodDays) * 24 * time.Hour,
+		PasswordResetDecoySecret:   []byte(environmentConfig.PasswordResetDecoySecret),
+	})
+	if err != nil {
+		logger.Fatal("failed to create user service", err)
+	}
+
+	auditSvc := audit.NewService(audit.ServiceConfig{
+		DB: db,
+	})
+
+	tokenSvc := token.NewService(token.ServiceConfig{
+		DB:                       db,
+		CalendarService:          calendarSvc,
+		RefreshTokenExpiryLength: time.Duration(environmentConfig.RefreshTokenExpiryLengthHours) * time.Hour,
+	})
+
+	signingKeySvc, err := signingkey.NewService(signingkey.ServiceConfig{
+		DB:               db,
+		CalendarService:  calendarSvc,
+		EncryptionSecret: []byte(environmentConfig.SigningKeyEncryptionSecret),
+		Algorithm:        signingkey.Algorithm(environmentConfig.SigningKeyAlgorithm),
+		RetireAfter:      signingKeyRetireAfter,
+	})
+	if err != nil {
+		logger.Fatal("failed to create signing key service", err)
+	}
+
+	// the first start creates the keyring, later starts make sure there's a next key
+	ensureKeyringInput := signingkey.EnsureKeyringInput{}
+	if legacyPrivateKey != nil {
+		ensureKeyringInput.ImportKey = legacyPrivateKey
+		ensureKeyringInput.ImportKeyId = legacyKeyId
+	}
+	if err := signingKeySvc.EnsureKeyring(context.Background(), ensureKeyringInput); err != nil {
+		logger.Fatal("failed to set up signing keyring", err)
+	}
+
+	emailSvc := email.NewService(email.ServiceConfig{
+		SMTPHost:     environmentConfig.SMTPHost,
+		SMTPPort:     environmentConfig.SMTPPort,
+		SMTPUsername: environmentConfig.SMTPUsername,
+		SMTPPassword: environmentConfig.SMTPPassword,
+		From:         environmentConfig.EmailFrom,
+		Logger:       logger,
+	})
+
+	mfaSvc := mfa.NewService(mfa.ServiceConfig{
 		DB:              db,
-		RandomGenerator: randomSvc,
+		CalendarService: calendarSvc,
+		Issuer:          environmentConfig.TOTPIssuer,
 	})
 
+	relyingParty, err := webauthn.NewRelyingParty(webauthn.RelyingPartyConfig{
+		Id:      environmentConfig.WebAuthnRPId,
+		Name:    environmentConfig.WebAuthnRPName,
+		Origins: environmentConfig.WebAuthnOrigins,
+	})
+	if err != nil {
+		logger.Fatal("failed to create webauthn relying party", err)
+	}
+
+	passkeySvc := passkey.NewService(passkey.ServiceConfig{
+		DB:              db,
+		CalendarService: calendarSvc,
+		RelyingParty:    relyingParty,
+	})
+
+	oauthSvc := oauth.NewService(oauth.ServiceConfig{
+		DB:              db,
+		CalendarService: calendarSvc,
+	})
+
+	// external providers refresh their signing keys in the background until shutdown
+	oidcCtx, oidcCancel := context.WithCancel(context.Background())
+	defer oidcCancel()
+
+	var oidcProviders = make([]*oidc.Provider, 0, len(environmentConfig.OIDCProviders))
+	for _, name := range environmentConfig.OIDCProviders {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		var providerConfig oidcProviderConfig
+		if err := envconfig.Process("OIDC_"+strings.ToUpper(name), &providerConfig); err != nil {
+			logger.Fatal(fmt.Sprintf("failed to process oidc provider config: %s", name), err)
+		}
+
+		provider, err := oidc.NewProvider(oidcCtx, oidc.ProviderConfig{
+			Name:         name,
+			Issuer:       providerConfig.Issuer,
+			ClientId:     providerConfig.ClientId,
+			ClientSecret: providerConfig.ClientSecret,
+			RedirectUrl:  providerConfig.RedirectUrl,
+			Scopes:       providerConfig.Scopes,
+		})
+		if err != nil {
+			// the server still starts without the provider, so other logins keep working
+			logger.Error(fmt.Sprintf("failed to create oidc provider: %s", name), err)
+			continue
+		}
+		oidcProviders = append(oidcProviders, provider)
+	}
+
 	authHandler, err := auth.NewAuthHandler(auth.AuthHandlerConfig{
 		JWTIssuer:              "auth-api",
 		JWTExpiryLengthMinutes: environmentConfig.JWTExpiryLengthMinutes,
+		JWTAudience:            environmentConfig.JWTAudience,
+		UserTokenAudiences:     environmentConfig.UserTokenAudiences,
+		IssuerUrl:              environmentConfig.OAuthIssuerUrl,
+		AppBaseUrl:             environmentConfig.AppBaseUrl,
+		EmailTokenSecret:       []byte(environmentConfig.EmailTokenSecret),
 		CalendarService:        calendarSvc,
 		RandomGenerator:        randomSvc,
 		Logger:                 logger,
 		UserService:            userSvc,
-		JWTPublicKeyData:       jwtPublicKey,
-		JWTPrivateKeyData:      jwtPrivateKey,
+		TokenService:           tokenSvc,
+		EmailService:           emailSvc,
+		MFAService:             mfaSvc,
+		AuditService:           auditSvc,
+		PasskeyService:         passkeySvc,
+		OAuthService:           oauthSvc,
+		OIDCProviders:          oidcProviders,
+		SigningKeyService:      signingKeySvc,
 	})
 	if err != nil {
 		logger.Fatal("failed to create new auth handler", err)
 	}
 
+	// accounts are deleted in the background once their grace period is over
+	accountDeletionCtx, accountDeletionCancel := context.WithCancel(context.Background())
+	defer accountDeletionCancel()
+	go deleteDueAccounts(accountDeletionCtx, logger, userSvc, tokenSvc, time.Hour)
+
 	// create router using handlers
-	router := newRouter(logger, authHandler)
+	router := newRouter(logger, authHandler, environmentConfig.TrustProxyHeaders)
 
 	/////////////////////////////
 	// Server config and start //
@@ -152,9 +362,13 @@ func main() {
 
 }
 
-func newRouter(logger *logger.Logger, authHandler *auth.AuthHandler) *chi.Mux {
+func newRouter(logger *logger.Logger, authHandler *auth.AuthHandler, trustProxyHeaders bool) *chi.Mux {
 	router := chi.NewRouter()
 
+	if trustProxyHeaders {
+		router.Use(middleware.RealIP)
+	}
+
 	router.Use(logger.RequestLogger)
 
 	router.Get("/", home)
@@ -170,24 +384,280 @@ func newRouter(logger *logger.Logger, authHandler *auth.AuthHandler) *chi.Mux {
 	// TODO: build out to expose the public key for jwt encryption
 	router.Get("/.well-known/jwks.json", authHandler.GetWellKnownJWKS)
 
+	// OpenID provider discovery, https://openid.net/specs/openid-connect-discovery-1_0.html
+	router.Get("/.well-known/openid-configuration", authHandler.GetOpenIdConfiguration)
+
 	router.Route("/v1", func(router chi.Router) {
+		router.Route("/oauth", func(router chi.Router) {
+			// GET the hosted login page for the authorization code grant
+			// POST the login page's forms, redirects back to the client with a code
+			// public
+			router.Get("/authorize", authHandler.Authorize)
+			router.Post("/authorize", authHandler.SubmitAuthorize)
+
+			// POST exchange an authorization code or refresh token for tokens
+			// public, clients authenticate with their credentials
+			router.Post("/token", authHandler.Token)
+
+			// GET/POST the claims about the user the access token's scope allows
+			// authenticated only
+			router.With(authHandler.RequireTokenAuthentication).Get("/userinfo", authHandler.UserInfo)
+			router.With(authHandler.RequireTokenAuthentication).Post("/userinfo", authHandler.UserInfo)
+
+			// manage the clients registered with the provider
+			// admin only
+			router.Route("/clients", func(router chi.Router) {
+				router.Use(authHandler.RequireTokenAuthentication,
+					authHandler.RequirePermission(string(user.PermissionUsersAdmin)))
+
+				router.Post("/", authHandler.CreateOAuthClient)
+				router.Get("/", authHandler.ListOAuthClients)
+				router.Delete("/{clientId}", authHandler.DeleteOAuthClient)
+			})
+
+			// POST revoke an access or refresh token, RFC 7009
+			// public, holding the token is enough to revoke it
+			router.Post("/revoke", authHandler.Revoke)
+
+			// POST introspect a token, RFC 7662
+			// services with tokens:introspect only
+			router.With(authHandler.RequireServiceAuthentication,
+				authHandler.RequirePermission(string(user.PermissionTokensIntrospect))).Post("/introspect", authHandler.Introspect)
+
+			// GET revoked tokens that haven't expired, polled by token verifiers
+			// public
+			router.Get("/revocations", authHandler.GetRevocations)
+		})
+
 		router.Route("/auth", func(router chi.Router) {
 			router.Post("/login", authHandler.Login)
-			router.Post("/signup", authHandler.SignUp)
 
-			router.Get("/security-questions", authHandler.GetSecurityQuestions)
+			// POST complete a login with a TOTP or recovery code, when Login returns mfaRequired
+			// public, holding the mfa token is enough
+			router.Post("/login/mfa", authHandler.LoginMFA)
+			router.Post("/signup", authHandler.SignUp)
+			router.Post("/refresh", authHandler.Refresh)
+
+			router.Route("/password-reset", func(router chi.Router) {
+				router.Post("/", authHandler.StartPasswordReset)
+				router.Post("/complete", authHandler.CompletePasswordReset)
+				router.Post("/{challengeId}/answers", authHandler.AnswerPasswordResetChallenge)
+			})
+
+			router.Route("/security-questions", func(router chi.Router) {
+				// GET the questions users can pick from
+				// public
+				router.Get("/", authHandler.GetSecurityQuestions)
+
+				// POST add a question for users to pick from, DELETE stop offering one
+				// admin only
+				router.With(authHandler.RequireTokenAuthentication,
+					authHandler.RequirePermission(string(user.PermissionUsersAdmin))).Post("/", authHandler.AddSecurityQuestion)
+				router.With(authHandler.RequireTokenAuthentication,
+					authHandler.RequirePermission(string(user.PermissionUsersAdmin))).Delete("/{questionId}", authHandler.RetireSecurityQuestion)
+			})
+
+			router.Route("/mfa", func(router chi.Router) {
+				router.Use(authHandler.RequireTokenAuthentication)
+
+				// POST start TOTP enrollment, DELETE disable TOTP with a valid code
+				// authenticated only
+				router.Post("/totp", authHandler.StartTOTPEnrollment)
+				router.Delete("/totp", authHandler.DisableTOTP)
+
+				// POST enable TOTP with a code from the authenticator, returns recovery codes
+				// authenticated only
+				router.Post("/totp/confirm", authHandler.ConfirmTOTPEnrollment)
+
+				// POST replace recovery codes with a valid code
+				// authenticated only
+				router.Post("/recovery-codes", authHandler.RegenerateRecoveryCodes)
+			})
+
+			router.Route("/oidc", func(router chi.Router) {
+				// GET the external providers users can log in with
+				// public
+				router.Get("/providers", authHandler.ListExternalProviders)
+
+				// POST start a login with the provider, POST finish it with the code and state
+				// the provider redirected back with
+				// public
+				router.Post("/{provider}/authorize", authHandler.StartExternalLogin)
+				router.Post("/{provider}/callback", authHandler.ExternalLoginCallback)
+
+				// POST start and finish linking the provider to the user's account
+				// authenticated only
+				router.With(authHandler.RequireTokenAuthentication).Post("/{provider}/link", authHandler.StartExternalLink)
+				router.With(authHandler.RequireTokenAuthentication).Post("/{provider}/link/callback", authHandler.ExternalLinkCallback)
+			})
+
+			router.Route("/tokens", func(router chi.Router) {
+				router.Use(authHandler.RequireTokenAuthentication)
+
+				// POST create a personal access token, GET list the user's tokens
+				// authenticated only
+				router.Post("/", authHandler.CreatePersonalAccessToken)
+				router.Get("/", authHandler.ListPersonalAccessTokens)
+
+				// DELETE revoke a personal access token
+				// authenticated only
+				router.Delete("/{tokenId}", authHandler.RevokePersonalAccessToken)
+			})
+
+			router.Route("/sessions", func(router chi.Router) {
+				router.Use(authHandler.RequireTokenAuthentication)
+
+				// GET the devices the user is logged in on
+				// authenticated only
+				router.Get("/", authHandler.ListSessions)
+
+				// DELETE sign the user out of a device
+				// authenticated only
+				router.Delete("/{sessionId}", authHandler.RevokeSession)
+			})
+
+			// GET the user's recent logins, password changes and other auth events
+			// authenticated only
+			router.With(authHandler.RequireTokenAuthentication).Get("/events", authHandler.ListAuthEvents)
+
+			router.Route("/identities", func(router chi.Router) {
+				router.Use(authHandler.RequireTokenAuthentication)
+
+				// GET the external providers linked to the user's account, DELETE unlink one
+				// authenticated only
+				router.Get("/", authHandler.ListLinkedIdentities)
+				router.Delete("/{identityId}", authHandler.UnlinkIdentity)
+			})
+
+			router.Route("/passkeys", func(router chi.Router) {
+				// GET the user's passkeys
+				// authenticated only
+				router.With(authHandler.RequireTokenAuthentication).Get("/", authHandler.ListPasskeys)
+
+				// POST start and finish registering a passkey
+				// authenticated only
+				router.With(authHandler.RequireTokenAuthentication).Post("/registration", authHandler.BeginPasskeyRegistration)
+				router.With(authHandler.RequireTokenAuthentication).Post("/registration/finish", authHandler.FinishPasskeyRegistration)
+
+				// POST start and finish a passwordless login
+				// public
+				router.Post("/login", authHandler.BeginPasskeyLogin)
+				router.Post("/login/finish", authHandler.FinishPasskeyLogin)
+
+				// DELETE remove a passkey
+				// authenticated only
+				router.With(authHandler.RequireTokenAuthentication).Delete("/{passkeyId}", authHandler.DeletePasskey)
+			})
+
+			router.Route("/email", func(router chi.Router) {
+				// POST verify the user's email with the emailed token
+				// public, holding the token is enough
+				router.Post("/verify", authHandler.VerifyEmail)
+
+				// POST send another verification email
+				// authenticated only
+				router.With(authHandler.RequireTokenAuthentication).Post("/verification", authHandler.ResendVerificationEmail)
+
+				// POST start changing the user's email, both addresses must confirm
+				// authenticated only
+				router.With(authHandler.RequireTokenAuthentication).Post("/change", authHandler.StartEmailChange)
+
+				// POST confirm an email change with the token emailed to either address
+				// public, holding the token is enough
+				router.Post("/change/confirm", authHandler.ConfirmEmailChange)
+			})
 		})
 
 		router.Route("/users", func(router chi.Router) {
-			// GET user details
+			// GET the caller's profile, PATCH to change it
+			// DELETE schedule the caller's account for deletion
 			// authenticated only
 			router.With(authHandler.RequireTokenAuthentication).Get("/", authHandler.GetUser)
+			router.With(authHandler.RequireTokenAuthentication).Patch("/", authHandler.UpdateUser)
+			router.With(authHandler.RequireTokenAuthentication).Delete("/", authHandler.DeleteUser)
+
+			// GET the questions the caller answered, without the answers
+			// PUT replace the caller's questions and answers, with their password
+			// authenticated only
+			router.With(authHandler.RequireTokenAuthentication).Get("/security-questions", authHandler.GetUserSecurityQuestions)
+			router.With(authHandler.RequireTokenAuthentication).Put("/security-questions", authHandler.ReplaceUserSecurityQuestions)
+
+			// POST cancel the caller's account deletion during the grace period
+			// authenticated only
+			router.With(authHandler.RequireTokenAuthentication).Post("/deletion/cancel", authHandler.CancelUserDeletion)
+
+			// GET deleted accounts, polled by services to remove their data about them
+			// services only
+			router.With(authHandler.RequireServiceAuthentication).Get("/deletions", authHandler.GetAccountDeletions)
+
+			// DELETE unlock a user locked out after too many failed logins
+			// admin only
+			router.With(authHandler.RequireTokenAuthentication,
+				authHandler.RequirePermission(string(user.PermissionUsersAdmin))).Delete("/{userId}/lockout", authHandler.UnlockUser)
+
+			router.Route("/{userId}/roles", func(router chi.Router) {
+				router.Use(authHandler.RequireTokenAuthentication,
+					authHandler.RequirePermission(string(user.PermissionUsersAdmin)))
+
+				// GET the user's roles and permissions
+				// PUT grant a role, DELETE revoke one
+				// admin only
+				router.Get("/", authHandler.GetUserRoles)
+				router.Put("/{role}", authHandler.AddUserRole)
+				router.Delete("/{role}", authHandler.RemoveUserRole)
+			})
+		})
+
+		// service to service routes, for other autolog services calling with service tokens
+		router.Route("/internal", func(router chi.Router) {
+			router.Use(authHandler.RequireServiceAuthentication)
+
+			// PUT grant a user a role, DELETE revoke one. Only the roles services may manage, each
+			// with its own permission, ex. autolog-api granting mechanic to shop employees with
+			// roles:mechanic. A service can only revoke the roles it granted.
+			router.With(authHandler.RequireServiceRolePermission).
+				Put("/users/{userId}/roles/{role}", authHandler.AddServiceUserRole)
+			router.With(authHandler.RequireServiceRolePermission).
+				Delete("/users/{userId}/roles/{role}", authHandler.RemoveServiceUserRole)
 		})
 	})
 
 	return router
 }
 
+// deleteDueAccounts deletes the accounts whose grace period is over, every interval until the
+// context is done. Their tokens are revoked first, so a failed deletion is retried with the user
+// already logged out.
+func deleteDueAccounts(ctx context.Context, logger *logger.Logger, userSvc *user.Service, tokenSvc *token.Service,
+	interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		userIds, err := userSvc.DueAccountDeletions(ctx)
+		if err != nil {
+			logger.Error("failed to list due account deletions", err)
+		}
+
+		for _, userId := range userIds {
+			if err := tokenSvc.RevokeUserTokens(ctx, userId); err != nil {
+				logger.Error(fmt.Sprintf("failed to revoke tokens of deleted account: %s", userId), err)
+				continue
+			}
+
+			if err := userSvc.DeleteAccount(ctx, userId); err != nil && !errors.Is(err, user.ErrNotFound) {
+				logger.Error(fmt.Sprintf("failed to delete account: %s", userId), err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func home(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("KoalaGarage Auth Server!"))
 }
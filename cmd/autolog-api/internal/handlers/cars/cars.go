@@ -1,12 +1,17 @@
 package cars
 
 import (
+	"context"
+
+	"github.com/google/uuid"
 	"github.com/keola-dunn/autolog/internal/calendar"
+	"github.com/keola-dunn/autolog/internal/imagesclient"
 	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
 	"github.com/keola-dunn/autolog/internal/logger"
 	nhtsavpic "github.com/keola-dunn/autolog/internal/nhtsa"
 	"github.com/keola-dunn/autolog/internal/random"
 	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/keola-dunn/autolog/internal/service/catalog"
 	"github.com/keola-dunn/autolog/internal/service/user"
 )
 
@@ -17,11 +22,15 @@ type CarsHandler struct {
 	logger          *logger.Logger
 
 	// services
-	userService user.ServiceIface
-	carService  car.ServiceIface
+	userService    user.ServiceIface
+	carService     car.ServiceIface
+	catalogService catalog.ServiceIface
 
 	nhtsaClient nhtsavpic.ClientIface
 
+	// imagesClient checks claim evidence images. Without it, evidence can't include images.
+	imagesClient imagesclient.ClientIface
+
 	jwtVerifier *autologjwt.TokenVerifier
 }
 
@@ -32,11 +41,15 @@ type CarsHandlerConfig struct {
 	Logger          *logger.Logger
 
 	// services
-	UserService user.ServiceIface
-	CarService  car.ServiceIface
+	UserService    user.ServiceIface
+	CarService     car.ServiceIface
+	CatalogService catalog.ServiceIface
 
 	NHTSAClient nhtsavpic.ClientIface
 
+	// ImagesClient checks claim evidence images. Optional, evidence can't include images without it.
+	ImagesClient imagesclient.ClientIface
+
 	TokenVerifier *autologjwt.TokenVerifier
 }
 
@@ -46,11 +59,27 @@ func NewCarsHandler(config CarsHandlerConfig) (*CarsHandler, error) {
 		randomGenerator: config.RandomGenerator,
 		logger:          config.Logger,
 
-		userService: config.UserService,
-		carService:  config.CarService,
+		userService:    config.UserService,
+		carService:     config.CarService,
+		catalogService: config.CatalogService,
 
-		nhtsaClient: config.NHTSAClient,
+		nhtsaClient:  config.NHTSAClient,
+		imagesClient: config.ImagesClient,
 
 		jwtVerifier: config.TokenVerifier,
 	}, nil
 }
+
+// getCarByPathId retrieves a car by the {carId} path param, which may either be the car's
+// ID or it's public ID.
+func (h *CarsHandler) getCarByPathId(ctx context.Context, carId string) (car.GetCarOutput, error) {
+	if err := uuid.Validate(carId); err == nil {
+		return h.carService.GetCar(ctx, car.GetCarInput{
+			Id: carId,
+		})
+	}
+
+	return h.carService.GetCar(ctx, car.GetCarInput{
+		PublicId: carId,
+	})
+}
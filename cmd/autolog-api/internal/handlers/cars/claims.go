@@ -0,0 +1,374 @@
+package cars
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/imagesclient"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+type claimResponse struct {
+	Id               string     `json:"id"`
+	CarId            string     `json:"carId"`
+	ClaimantUserId   string     `json:"claimantUserId"`
+	Method           string     `json:"method"`
+	Status           string     `json:"status"`
+	EvidenceNotes    string     `json:"evidenceNotes"`
+	EvidenceImageIds []string   `json:"evidenceImageIds"`
+	ReviewedAt       *time.Time `json:"reviewedAt"`
+	ReviewNotes      string     `json:"reviewNotes"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+func newClaimResponse(c car.Claim) claimResponse {
+	return claimResponse{
+		Id:               c.Id(),
+		CarId:            c.CarId,
+		ClaimantUserId:   c.ClaimantUserId,
+		Method:           string(c.Method),
+		Status:           string(c.Status),
+		EvidenceNotes:    c.EvidenceNotes,
+		EvidenceImageIds: c.EvidenceImageIds,
+		ReviewedAt:       c.ReviewedAt,
+		ReviewNotes:      c.ReviewNotes,
+		CreatedAt:        c.CreatedAt(),
+	}
+}
+
+// claimExistingCar responds to a request to create a car that already exists by creating a
+// claim on the existing car for the user
+func (h *CarsHandler) claimExistingCar(w http.ResponseWriter, r *http.Request, carId, userId string) {
+	logEntry := logger.GetLogEntry(r)
+
+	// claims transfer cars, so only users with a verified email can make them
+	if claims, ok := jwt.GetClaimsFromContext(r.Context()); !ok || !claims.EmailVerified {
+		httputil.RespondWithError(w, http.StatusForbidden, "email address must be verified to claim an existing car")
+		return
+	}
+
+	claim, err := h.carService.CreateClaim(r.Context(), car.CreateClaimInput{
+		CarId:          carId,
+		ClaimantUserId: userId,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, car.ErrInvalidArg):
+			// the user already owns the car
+			httputil.RespondWithError(w, http.StatusConflict, "car already exists")
+		case errors.Is(err, car.ErrAlreadyExists):
+			httputil.RespondWithError(w, http.StatusConflict, "a claim on this car is already pending")
+		default:
+			logEntry.Error("failed to create claim", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusAccepted, newClaimResponse(claim))
+}
+
+type listClaimsResponse struct {
+	Claims []claimResponse `json:"claims"`
+}
+
+// ListClaims lists the claims made by the user, or with ?as=owner, the claims made on the
+// user's cars awaiting their review
+func (h *CarsHandler) ListClaims(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	input := car.ListClaimsInput{
+		UserId: claims.GetUserId(),
+		Status: car.ClaimStatus(r.URL.Query().Get("status")),
+	}
+
+	switch r.URL.Query().Get("as") {
+	case "", "claimant":
+	case "owner":
+		input.AsOwner = true
+	default:
+		httputil.RespondWithError(w, http.StatusBadRequest, "as must be one of claimant or owner")
+		return
+	}
+
+	switch input.Status {
+	case "", car.ClaimStatusPending, car.ClaimStatusApproved, car.ClaimStatusRejected, car.ClaimStatusCancelled:
+	default:
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+
+	carClaims, err := h.carService.ListClaims(r.Context(), input)
+	if err != nil {
+		logEntry.Error("failed to list claims", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var resp = listClaimsResponse{
+		Claims: make([]claimResponse, 0, len(carClaims)),
+	}
+	for _, c := range carClaims {
+		resp.Claims = append(resp.Claims, newClaimResponse(c))
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// GetClaim returns a claim. Only the claimant, the car's current owner, or an admin can view it.
+func (h *CarsHandler) GetClaim(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	claim, err := h.carService.GetClaim(r.Context(), chi.URLParam(r, "claimId"))
+	if err != nil {
+		if errors.Is(err, car.ErrNotFound) || errors.Is(err, car.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusNotFound, "claim not found")
+			return
+		}
+		logEntry.Error("failed to get claim", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if claim.ClaimantUserId != claims.GetUserId() {
+		canReview, err := h.canReviewClaim(r, claim, claims)
+		if err != nil {
+			logEntry.Error("failed to check claim access", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+			return
+		}
+		if !canReview {
+			httputil.RespondWithError(w, http.StatusNotFound, "claim not found")
+			return
+		}
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, newClaimResponse(claim))
+}
+
+type submitClaimEvidenceRequest struct {
+	Notes    string   `json:"notes"`
+	ImageIds []string `json:"imageIds"`
+}
+
+// SubmitClaimEvidence attaches evidence of ownership to the user's claim, ex. a photo of the
+// title, and sends it to evidence review
+func (h *CarsHandler) SubmitClaimEvidence(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	requestBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var req submitClaimEvidenceRequest
+	if err := json.Unmarshal(requestBody, &req); err != nil {
+		logEntry.Error("failed to unmarshal request body", err)
+		httputil.RespondWithError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	ok, err = h.ownsImages(r.Context(), claims.GetUserId(), req.ImageIds)
+	if err != nil {
+		logEntry.Error("failed to check claim evidence images", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if !ok {
+		httputil.RespondWithError(w, http.StatusBadRequest, "evidence images must be uploaded by the claimant")
+		return
+	}
+
+	if err := h.carService.SubmitClaimEvidence(r.Context(), car.SubmitClaimEvidenceInput{
+		ClaimId:  chi.URLParam(r, "claimId"),
+		UserId:   claims.GetUserId(),
+		Notes:    req.Notes,
+		ImageIds: req.ImageIds,
+	}); err != nil {
+		h.respondWithClaimError(w, r, "failed to submit claim evidence", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownsImages checks every image was uploaded by the user, so a claimant can't pass off someone
+// else's photo of a title as evidence. Images are rejected if they can't be checked.
+func (h *CarsHandler) ownsImages(ctx context.Context, userId string, imageIds []string) (bool, error) {
+	if h.imagesClient == nil {
+		return len(imageIds) == 0, nil
+	}
+
+	for _, imageId := range imageIds {
+		i, err := h.imagesClient.GetImage(ctx, imageId)
+		if err != nil {
+			if errors.Is(err, imagesclient.ErrNotFound) || errors.Is(err, imagesclient.ErrInvalidArg) {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to get image: %w", err)
+		}
+
+		if i.UserId != userId {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+type resolveClaimRequest struct {
+	Notes string `json:"notes"`
+}
+
+// ApproveClaim transfers the car to the claimant
+func (h *CarsHandler) ApproveClaim(w http.ResponseWriter, r *http.Request) {
+	h.resolveClaim(w, r, true)
+}
+
+func (h *CarsHandler) RejectClaim(w http.ResponseWriter, r *http.Request) {
+	h.resolveClaim(w, r, false)
+}
+
+func (h *CarsHandler) resolveClaim(w http.ResponseWriter, r *http.Request, approve bool) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var req resolveClaimRequest
+	if r.ContentLength != 0 {
+		requestBody, err := io.ReadAll(r.Body)
+		if err != nil {
+			logEntry.Error("failed to read request body", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+			return
+		}
+
+		if err := json.Unmarshal(requestBody, &req); err != nil {
+			logEntry.Error("failed to unmarshal request body", err)
+			httputil.RespondWithError(w, http.StatusBadRequest, "")
+			return
+		}
+	}
+
+	claim, err := h.carService.GetClaim(r.Context(), chi.URLParam(r, "claimId"))
+	if err != nil {
+		h.respondWithClaimError(w, r, "failed to get claim", err)
+		return
+	}
+
+	canReview, err := h.canReviewClaim(r, claim, claims)
+	if err != nil {
+		logEntry.Error("failed to check claim access", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if !canReview {
+		httputil.RespondWithError(w, http.StatusForbidden, "")
+		return
+	}
+
+	if err := h.carService.ResolveClaim(r.Context(), car.ResolveClaimInput{
+		ClaimId:        claim.Id(),
+		ReviewerUserId: claims.GetUserId(),
+		Method:         claim.Method,
+		Approve:        approve,
+		Notes:          req.Notes,
+	}); err != nil {
+		h.respondWithClaimError(w, r, "failed to resolve claim", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CancelClaim withdraws the user's pending claim
+func (h *CarsHandler) CancelClaim(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := h.carService.CancelClaim(r.Context(), chi.URLParam(r, "claimId"), claims.GetUserId()); err != nil {
+		h.respondWithClaimError(w, r, "failed to cancel claim", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// canReviewClaim checks if the user can approve or reject the claim. Owner claims are reviewed
+// by the car's current owner, and any claim by a user with the cars:admin permission.
+func (h *CarsHandler) canReviewClaim(r *http.Request, claim car.Claim, claims jwt.AutologAPIJWTClaims) (bool, error) {
+	if claim.Method == car.ClaimMethodOwner {
+		ownerId, err := h.carService.GetCarOwner(r.Context(), claim.CarId)
+		if err != nil && !errors.Is(err, car.ErrNotFound) {
+			return false, err
+		}
+		if ownerId == claims.GetUserId() {
+			return true, nil
+		}
+	}
+
+	return claims.HasPermission(string(user.PermissionCarsAdmin)), nil
+}
+
+func (h *CarsHandler) respondWithClaimError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch {
+	case errors.Is(err, car.ErrNotFound):
+		httputil.RespondWithError(w, http.StatusNotFound, "claim not found")
+	case errors.Is(err, car.ErrForbidden):
+		httputil.RespondWithError(w, http.StatusForbidden, "")
+	case errors.Is(err, car.ErrClaimUnderReview):
+		httputil.RespondWithError(w, http.StatusConflict,
+			"claim is under review, evidence can be sent once the owner has had a week to respond")
+	case errors.Is(err, car.ErrClaimMethodChanged):
+		httputil.RespondWithError(w, http.StatusConflict, "claim changed, check it again before resolving")
+	case errors.Is(err, car.ErrInvalidArg):
+		httputil.RespondWithError(w, http.StatusBadRequest, "claim is not pending or the request is invalid")
+	default:
+		logger.GetLogEntry(r).Error(msg, err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+	}
+}
@@ -2,6 +2,7 @@ package cars
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"slices"
@@ -12,18 +13,73 @@ import (
 	"github.com/keola-dunn/autolog/internal/logger"
 	nhtsavpic "github.com/keola-dunn/autolog/internal/nhtsa"
 	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/keola-dunn/autolog/internal/service/catalog"
+)
+
+// createCarMode controls what happens when the user entered car details don't match the
+// NHTSA decode of the VIN
+type createCarMode string
+
+const (
+	// createCarModeWarn creates the car with the user entered details, and returns the
+	// discrepancies. Any discrepancies are recorded as user overrides. This is the default.
+	createCarModeWarn = createCarMode("warn")
+
+	// createCarModeStrict rejects the request if there are any discrepancies
+	createCarModeStrict = createCarMode("strict")
+
+	// createCarModeAutoCorrect replaces the user entered details with NHTSA's
+	createCarModeAutoCorrect = createCarMode("autocorrect")
 )
 
 type createCarRequest struct {
-	VIN   string `json:"vin"`
+	VIN   string        `json:"vin"`
+	Make  string        `json:"make"`
+	Model string        `json:"model"`
+	Year  int64         `json:"year"`
+	Trim  string        `json:"trim"`
+	Color string        `json:"color"`
+	Mode  createCarMode `json:"mode"`
+
+	// IdentifierType and Identifier are used for cars without a 17 character VIN, ex. a
+	// chassis number. These cars are created unverified with the user supplied Specs.
+	IdentifierType car.IdentifierType `json:"identifierType"`
+	Identifier     string             `json:"identifier"`
+	Specs          *createCarSpecs    `json:"specs"`
+}
+
+type createCarResponse struct {
+	Id       string `json:"id"`
+	PublicId string `json:"publicId"`
+	VIN      string `json:"vin"`
+
+	IdentifierType car.IdentifierType `json:"identifierType"`
+	Identifier     string             `json:"identifier,omitempty"`
+	VINVerified    bool               `json:"vinVerified"`
+
 	Make  string `json:"make"`
 	Model string `json:"model"`
 	Year  int64  `json:"year"`
 	Trim  string `json:"trim"`
 	Color string `json:"color"`
+
+	Discrepancies []discrepancy `json:"discrepancies"`
+
+	// Overrides are the fields where the user entered details were kept over NHTSA's
+	Overrides []string `json:"overrides"`
 }
 
-//type createCarResponse struct {}
+type discrepancy struct {
+	Field     string `json:"field"`
+	Provided  string `json:"provided"`
+	Suggested string `json:"suggested"`
+	Reason    string `json:"reason"`
+}
+
+type createCarConflictResponse struct {
+	httputil.ErrorResponse
+	Discrepancies []discrepancy `json:"discrepancies"`
+}
 
 func (h *CarsHandler) CreateCar(w http.ResponseWriter, r *http.Request) {
 	logEntry := logger.GetLogEntry(r)
@@ -49,6 +105,44 @@ func (h *CarsHandler) CreateCar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch req.Mode {
+	case "":
+		req.Mode = createCarModeWarn
+	case createCarModeWarn, createCarModeStrict, createCarModeAutoCorrect:
+	default:
+		httputil.RespondWithError(w, http.StatusBadRequest, "mode must be one of warn, strict, or autocorrect")
+		return
+	}
+
+	if !req.IdentifierType.Valid() {
+		httputil.RespondWithError(w, http.StatusBadRequest, "identifierType must be one of vin, chassis, short_vin, or frame")
+		return
+	}
+
+	if !req.IdentifierType.Verified() {
+		h.createUnverifiedCar(w, r, claims.GetUserId(), req)
+		return
+	}
+
+	// a VIN can only belong to one car. Creating a car that is already known becomes a claim
+	// on the existing record, so its history is kept.
+	existingCar, err := h.carService.GetCar(r.Context(), car.GetCarInput{
+		VIN: req.VIN,
+	})
+	if err != nil && !errors.Is(err, car.ErrNotFound) {
+		if errors.Is(err, car.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "missing required vin")
+			return
+		}
+		logEntry.Error("failed to get car by vin", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if err == nil {
+		h.claimExistingCar(w, r, existingCar.Id, claims.GetUserId())
+		return
+	}
+
 	decodedVINData, err := h.nhtsaClient.DecodeVINFlat(r.Context(), nhtsavpic.DecodeVINFlatInput{
 		VIN:       req.VIN,
 		ModelYear: int(req.Year),
@@ -72,7 +166,10 @@ func (h *CarsHandler) CreateCar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !slices.Contains(errorCodes, nhtsavpic.ErrorCodeSuccess) {
+	// a model year warning means the provided year doesn't match the VIN, which is reported
+	// back as a discrepancy rather than failing the decode
+	if !slices.Contains(errorCodes, nhtsavpic.ErrorCodeSuccess) &&
+		!slices.Contains(errorCodes, nhtsavpic.ErrorCodeModelYearWarning) {
 		logEntry.Warn("nhtsavpic response doesn't indicate successful decode",
 			"vin", req.VIN, "modelYear", req.Year)
 		httputil.RespondWithError(w, http.StatusNotFound, "vin not found")
@@ -82,14 +179,25 @@ func (h *CarsHandler) CreateCar(w http.ResponseWriter, r *http.Request) {
 	modelYear, _ := strconv.Atoi(decodedVINData.Results[0].ModelYear)
 	payload, _ := json.Marshal(decodedVINData.Results[0])
 
-	if err := h.carService.CreateCar(r.Context(), claims.GetUserId(), car.Car{
+	// normalize free text make/model against the catalog, ex. "chevy" -> "CHEVROLET"
+	normalized, err := h.catalogService.NormalizeMakeModel(r.Context(), catalog.NormalizeMakeModelInput{
 		Make:  req.Make,
 		Model: req.Model,
 		Year:  req.Year,
-		Trim:  req.Trim,
-		VIN:   req.VIN,
-		Color: req.Color,
-	}, car.NHTSAVPICData{
+	})
+	if err != nil {
+		if errors.Is(err, catalog.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "missing required make or model")
+			return
+		}
+		logEntry.Error("failed to normalize make and model", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+	req.Make = normalized.Make
+	req.Model = normalized.Model
+
+	nhtsaData := car.NHTSAVPICData{
 		VIN:                     decodedVINData.Results[0].VIN,
 		Make:                    decodedVINData.Results[0].Make,
 		Model:                   decodedVINData.Results[0].Model,
@@ -127,11 +235,109 @@ func (h *CarsHandler) CreateCar(w http.ResponseWriter, r *http.Request) {
 		WheelbaseType:           decodedVINData.Results[0].WheelBaseType,
 		WheelSizeFront:          decodedVINData.Results[0].WheelSizeFront,
 		WheelSizeRear:           decodedVINData.Results[0].WheelSizeRear,
-		Payload:                 payload}); err != nil {
+		Payload:                 payload,
+	}
+
+	newCar := car.Car{
+		Make:  req.Make,
+		Model: req.Model,
+		Year:  req.Year,
+		Trim:  req.Trim,
+		VIN:   req.VIN,
+		Color: req.Color,
+	}
+
+	discrepancies := car.ReconcileWithNHTSA(newCar, nhtsaData)
+
+	var blocking []car.Discrepancy
+	for _, d := range discrepancies {
+		if d.Blocking() {
+			blocking = append(blocking, d)
+		}
+	}
+
+	var overrides []car.FieldOverride
+	switch req.Mode {
+	case createCarModeStrict:
+		if len(blocking) > 0 {
+			httputil.RespondWithJSON(w, http.StatusUnprocessableEntity, createCarConflictResponse{
+				ErrorResponse: httputil.ErrorResponse{
+					Status:       http.StatusText(http.StatusUnprocessableEntity),
+					StatusCode:   http.StatusUnprocessableEntity,
+					ErrorMessage: "car details do not match the vin",
+				},
+				Discrepancies: newDiscrepancies(blocking),
+			})
+			return
+		}
+	case createCarModeAutoCorrect:
+		car.ApplySuggestions(&newCar, discrepancies)
+	default:
+		for _, d := range blocking {
+			overrides = append(overrides, car.FieldOverride{
+				Field:         d.Field,
+				ProvidedValue: d.Provided,
+				NHTSAValue:    d.Suggested,
+				Reason:        d.Reason,
+			})
+		}
+	}
+
+	createdCar, err := h.carService.CreateCar(r.Context(), car.CreateCarInput{
+		UserId:    claims.GetUserId(),
+		Car:       newCar,
+		NHTSAData: nhtsaData,
+		Overrides: overrides,
+	})
+	if err != nil {
+		if errors.Is(err, car.ErrAlreadyExists) {
+			// the car was created by someone else since the check above
+			existingCar, err := h.carService.GetCar(r.Context(), car.GetCarInput{
+				VIN: newCar.VIN,
+			})
+			if err != nil {
+				logEntry.Error("failed to get existing car by vin", err)
+				httputil.RespondWithError(w, http.StatusInternalServerError, "")
+				return
+			}
+			h.claimExistingCar(w, r, existingCar.Id, claims.GetUserId())
+			return
+		}
 		logEntry.Error("failed to create car", err)
 		httputil.RespondWithError(w, http.StatusInternalServerError, "")
 		return
 	}
 
-	httputil.RespondWithJSON(w, http.StatusCreated, req)
+	var resp = createCarResponse{
+		Id:             createdCar.Id(),
+		PublicId:       createdCar.PublicId(),
+		VIN:            createdCar.VIN,
+		IdentifierType: createdCar.IdentifierType,
+		VINVerified:    true,
+		Make:           createdCar.Make,
+		Model:          createdCar.Model,
+		Year:           createdCar.Year,
+		Trim:           createdCar.Trim,
+		Color:          createdCar.Color,
+		Discrepancies:  newDiscrepancies(discrepancies),
+		Overrides:      []string{},
+	}
+	for _, o := range overrides {
+		resp.Overrides = append(resp.Overrides, string(o.Field))
+	}
+
+	httputil.RespondWithJSON(w, http.StatusCreated, resp)
+}
+
+func newDiscrepancies(discrepancies []car.Discrepancy) []discrepancy {
+	var resp = make([]discrepancy, 0, len(discrepancies))
+	for _, d := range discrepancies {
+		resp = append(resp, discrepancy{
+			Field:     string(d.Field),
+			Provided:  d.Provided,
+			Suggested: d.Suggested,
+			Reason:    string(d.Reason),
+		})
+	}
+	return resp
 }
@@ -0,0 +1,159 @@
+package cars
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/keola-dunn/autolog/internal/service/catalog"
+)
+
+// createCarSpecs are the user supplied specs for a car NHTSA can't decode. Units defaults to
+// metric. Imperial measurements are displacement in cubic inches, power in hp, wheelbase in
+// inches and curb weight in pounds.
+type createCarSpecs struct {
+	Units string `json:"units"`
+
+	Displacement    *float64 `json:"displacement"`
+	EngineCylinders *int64   `json:"engineCylinders"`
+	Power           *float64 `json:"power"`
+	Turbo           bool     `json:"turbo"`
+
+	DriveType          string `json:"driveType"`
+	FuelType           string `json:"fuelType"`
+	TransmissionType   string `json:"transmissionType"`
+	TransmissionSpeeds *int64 `json:"transmissionSpeeds"`
+
+	Wheelbase  *float64 `json:"wheelbase"`
+	CurbWeight *float64 `json:"curbWeight"`
+
+	Doors *int64 `json:"doors"`
+	Seats *int64 `json:"seats"`
+}
+
+func (c *createCarSpecs) toVehicleSpec() car.VehicleSpec {
+	input := car.UserVehicleSpecInput{
+		DisplacementLiters: c.Displacement,
+		EngineCylinders:    c.EngineCylinders,
+		PowerKW:            c.Power,
+		Turbo:              c.Turbo,
+		DriveType:          c.DriveType,
+		FuelType:           c.FuelType,
+		TransmissionType:   c.TransmissionType,
+		TransmissionSpeeds: c.TransmissionSpeeds,
+		WheelbaseMM:        c.Wheelbase,
+		CurbWeightKg:       c.CurbWeight,
+		Doors:              c.Doors,
+		Seats:              c.Seats,
+	}
+
+	if c.Units == unitsImperial {
+		input.DisplacementLiters = convert(c.Displacement, car.CubicInchesToLiters)
+		input.PowerKW = convert(c.Power, car.HorsepowerToKilowatts)
+		input.WheelbaseMM = convert(c.Wheelbase, car.InchesToMillimeters)
+		input.CurbWeightKg = convert(c.CurbWeight, car.PoundsToKilograms)
+	}
+
+	return car.NewUserVehicleSpec(input)
+}
+
+// createUnverifiedCar creates a car identified by a chassis number, short VIN or frame number
+// instead of a 17 character VIN. NHTSA can't decode these, so the user entered details and
+// specs are taken as is and the car is labeled as having an unverified VIN.
+func (h *CarsHandler) createUnverifiedCar(w http.ResponseWriter, r *http.Request, userId string, req createCarRequest) {
+	logEntry := logger.GetLogEntry(r)
+
+	if req.Specs != nil {
+		switch req.Specs.Units {
+		case "":
+			req.Specs.Units = unitsMetric
+		case unitsMetric, unitsImperial:
+		default:
+			httputil.RespondWithError(w, http.StatusBadRequest, "specs units must be metric or imperial")
+			return
+		}
+	}
+
+	normalized, err := h.catalogService.NormalizeMakeModel(r.Context(), catalog.NormalizeMakeModelInput{
+		Make:  req.Make,
+		Model: req.Model,
+		Year:  req.Year,
+	})
+	if err != nil {
+		if errors.Is(err, catalog.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "missing required make or model")
+			return
+		}
+		logEntry.Error("failed to normalize make and model", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	newCar := car.Car{
+		Make:           normalized.Make,
+		Model:          normalized.Model,
+		Year:           req.Year,
+		Trim:           req.Trim,
+		VIN:            req.VIN,
+		IdentifierType: req.IdentifierType,
+		Identifier:     req.Identifier,
+		Color:          req.Color,
+	}
+
+	var spec *car.VehicleSpec
+	if req.Specs != nil {
+		s := req.Specs.toVehicleSpec()
+		spec = &s
+	}
+
+	createdCar, err := h.carService.CreateCar(r.Context(), car.CreateCarInput{
+		UserId: userId,
+		Car:    newCar,
+		Spec:   spec,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, car.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest,
+				"missing required make, model, year, or a valid identifier")
+		case errors.Is(err, car.ErrAlreadyExists):
+			// same identifier for the same make is already known, claim it instead
+			existingCar, err := h.carService.GetCar(r.Context(), car.GetCarInput{
+				Identifier:     newCar.Identifier,
+				IdentifierType: newCar.IdentifierType,
+				IdentifierMake: newCar.Make,
+			})
+			if err != nil {
+				logEntry.Error("failed to get existing car by identifier", err)
+				httputil.RespondWithError(w, http.StatusInternalServerError, "")
+				return
+			}
+			h.claimExistingCar(w, r, existingCar.Id, userId)
+		default:
+			logEntry.Error("failed to create unverified car", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	logEntry.Info("created car with unverified vin", "carId", createdCar.Id(),
+		"publicId", createdCar.PublicId(), "identifierType", createdCar.IdentifierType)
+
+	httputil.RespondWithJSON(w, http.StatusCreated, createCarResponse{
+		Id:             createdCar.Id(),
+		PublicId:       createdCar.PublicId(),
+		VIN:            createdCar.VIN,
+		IdentifierType: createdCar.IdentifierType,
+		Identifier:     createdCar.Identifier,
+		VINVerified:    false,
+		Make:           createdCar.Make,
+		Model:          createdCar.Model,
+		Year:           createdCar.Year,
+		Trim:           createdCar.Trim,
+		Color:          createdCar.Color,
+		Discrepancies:  []discrepancy{},
+		Overrides:      []string{},
+	})
+}
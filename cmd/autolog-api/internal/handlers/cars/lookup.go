@@ -18,12 +18,17 @@ import (
 type lookupRequestParams struct {
 	VIN string
 
+	Identifier string
+
 	CarId string
 
 	// PlateNumber string
 	// State       string
 }
 
+// unverifiedVINLabel is shown for cars identified by something other than a 17 character VIN
+const unverifiedVINLabel = "unverified VIN"
+
 type lookupResponsePlate struct {
 	Number string `json:"number"`
 	State  string `json:"state"`
@@ -35,6 +40,13 @@ type lookupResponse struct {
 	///////////////
 	AutologVehicle bool `json:"autologVehicle"`
 
+	// VINVerified is false for cars identified by a chassis, short VIN or frame number, whose
+	// details are user entered rather than decoded by NHTSA
+	VINVerified       bool               `json:"vinVerified"`
+	VerificationLabel string             `json:"verificationLabel,omitempty"`
+	IdentifierType    car.IdentifierType `json:"identifierType"`
+	Identifier        string             `json:"identifier,omitempty"`
+
 	///////////////
 	// from cars db tables
 	///////////////
@@ -101,13 +113,21 @@ func (h *CarsHandler) Lookup(w http.ResponseWriter, r *http.Request) {
 	vin := strings.TrimSpace(queryParams.Get("vin"))
 	carId := strings.TrimSpace(queryParams.Get("carid"))
 	id := strings.TrimSpace(queryParams.Get("id"))
+	identifier := strings.TrimSpace(queryParams.Get("identifier"))
+	identifierType := car.IdentifierType(strings.TrimSpace(queryParams.Get("identifiertype")))
 	// plateNumber := strings.TrimSpace(queryParams.Get("platenumber"))
 	// state := strings.TrimSpace(queryParams.Get("state"))
 
 	if strings.TrimSpace(vin) == "" &&
 		strings.TrimSpace(carId) == "" &&
-		strings.TrimSpace(id) == "" {
-		httputil.RespondWithError(w, http.StatusBadRequest, "Invalid argument. Expected vin, carid, or id.")
+		strings.TrimSpace(id) == "" &&
+		strings.TrimSpace(identifier) == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "Invalid argument. Expected vin, carid, id, or identifier.")
+		return
+	}
+
+	if identifierType != "" && !identifierType.Valid() {
+		httputil.RespondWithError(w, http.StatusBadRequest, "Invalid argument. Unknown identifiertype.")
 		return
 	}
 
@@ -117,9 +137,11 @@ func (h *CarsHandler) Lookup(w http.ResponseWriter, r *http.Request) {
 
 	getCarStart := h.calendarService.NowUTC()
 	getCarOutput, err := h.carService.GetCar(r.Context(), car.GetCarInput{
-		VIN:      vin,
-		PublicId: carId,
-		Id:       id,
+		VIN:            vin,
+		Identifier:     identifier,
+		IdentifierType: identifierType,
+		PublicId:       carId,
+		Id:             id,
 	})
 	if err != nil {
 		if errors.Is(err, car.ErrNotFound) {
@@ -143,10 +165,26 @@ func (h *CarsHandler) Lookup(w http.ResponseWriter, r *http.Request) {
 			Make:           getCarOutput.Make,
 			Model:          getCarOutput.Model,
 			Color:          getCarOutput.Color,
+			Trim:           getCarOutput.Trim,
+			VINVerified:    getCarOutput.IdentifierType.Verified(),
+			IdentifierType: getCarOutput.IdentifierType,
+			Identifier:     getCarOutput.Identifier,
 		}
 		vin = getCarOutput.VIN
 	}
 
+	if isAutologVehicle && !response.VINVerified {
+		// NHTSA can't decode these, the user entered details are all there is
+		response.VerificationLabel = unverifiedVINLabel
+		h.respondWithLookup(w, r, userId, getCarOutput.Id, response)
+		return
+	}
+
+	if !isAutologVehicle && vin == "" {
+		httputil.RespondWithError(w, http.StatusNotFound, "car not found")
+		return
+	}
+
 	decodeVinStart := h.calendarService.NowUTC()
 	decodeVINOutput, err := h.nhtsaClient.DecodeVINFlat(r.Context(), nhtsavpic.DecodeVINFlatInput{
 		VIN: vin,
@@ -159,8 +197,11 @@ func (h *CarsHandler) Lookup(w http.ResponseWriter, r *http.Request) {
 	logEntry = logEntry.With("decodeVINDurationMs", time.Since(decodeVinStart).Milliseconds())
 	if decodeVINOutput.Count <= 0 {
 		logEntry.Error("vin not found in nhtsa", nil)
+	} else if !decodeVINOutput.Results[0].Decoded() {
+		logEntry.Warn("nhtsavpic response doesn't indicate successful decode", "vin", vin,
+			"errorCode", decodeVINOutput.Results[0].ErrorCode)
 	}
-	if decodeVINOutput.Count > 0 {
+	if decodeVINOutput.Count > 0 && decodeVINOutput.Results[0].Decoded() {
 		if !isAutologVehicle {
 			// not a autolog vehicle yet, use NHTSA data
 
@@ -172,6 +213,8 @@ func (h *CarsHandler) Lookup(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Data from NHTSA we need regardless
+		response.VINVerified = true
+		response.IdentifierType = car.IdentifierTypeVIN
 		response.VIN = decodeVINOutput.Results[0].VIN
 		response.Trim = decodeVINOutput.Results[0].Trim
 		response.ManufactureCity = decodeVINOutput.Results[0].PlantCity
@@ -179,18 +222,32 @@ func (h *CarsHandler) Lookup(w http.ResponseWriter, r *http.Request) {
 		response.ManufactureCountry = decodeVINOutput.Results[0].PlantCountry
 	}
 
+	var responseCarId string
+	if isAutologVehicle {
+		responseCarId = getCarOutput.Id
+	}
+	h.respondWithLookup(w, r, userId, responseCarId, response)
+}
+
+// respondWithLookup adds the service history of autolog vehicles to the lookup response.
+// carId is empty for cars that aren't in autolog.
+func (h *CarsHandler) respondWithLookup(w http.ResponseWriter, r *http.Request, userId, carId string,
+	response lookupResponse) {
+	logEntry := logger.GetLogEntry(r)
+
 	if strings.TrimSpace(userId) != "" {
 		// authed user
 
 	} else {
 		// public request
 
-		if isAutologVehicle {
+		if carId != "" {
 			serviceLogSummary, err := h.carService.GetServiceLogSummary(r.Context(), carId)
 			if err != nil {
 				if errors.Is(err, car.ErrNotFound) {
 					// no existing records found
 				}
+				logEntry.Error("failed to get service log summary", err)
 				httputil.RespondWithError(w, http.StatusInternalServerError, "")
 				return
 			}
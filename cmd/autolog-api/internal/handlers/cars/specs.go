@@ -0,0 +1,175 @@
+package cars
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/car"
+)
+
+const (
+	unitsMetric   = "metric"
+	unitsImperial = "imperial"
+)
+
+type specRange struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+type specValue struct {
+	Value *float64 `json:"value"`
+	Unit  string   `json:"unit"`
+}
+
+type specRangeValue struct {
+	specRange
+	Unit string `json:"unit"`
+}
+
+type getSpecsResponse struct {
+	Units string `json:"units"`
+
+	// Source is where the specs came from, either nhtsa or user entered
+	Source car.SpecSource `json:"source"`
+
+	Displacement    specValue      `json:"displacement"`
+	EngineCylinders *int64         `json:"engineCylinders"`
+	Power           specRangeValue `json:"power"`
+	Turbo           bool           `json:"turbo"`
+
+	DriveType          car.DriveType        `json:"driveType"`
+	FuelTypePrimary    car.FuelType         `json:"fuelTypePrimary"`
+	FuelTypeSecondary  car.FuelType         `json:"fuelTypeSecondary"`
+	TransmissionType   car.TransmissionType `json:"transmissionType"`
+	TransmissionSpeeds *int64               `json:"transmissionSpeeds"`
+
+	Wheelbase  specRangeValue `json:"wheelbase"`
+	TrackWidth specValue      `json:"trackWidth"`
+	CurbWeight specValue      `json:"curbWeight"`
+	GVWR       specRangeValue `json:"gvwr"`
+
+	WheelSizeFront specValue `json:"wheelSizeFront"`
+	WheelSizeRear  specValue `json:"wheelSizeRear"`
+
+	Doors    *int64 `json:"doors"`
+	Seats    *int64 `json:"seats"`
+	SeatRows *int64 `json:"seatRows"`
+
+	BatteryCapacity specRangeValue `json:"batteryCapacity"`
+}
+
+// GetSpecs returns the normalized specs for a car. Accepts a units query param of either
+// "metric" (default) or "imperial".
+func (h *CarsHandler) GetSpecs(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	carId := strings.TrimSpace(chi.URLParam(r, "carId"))
+	if carId == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required car id")
+		return
+	}
+
+	units := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("units")))
+	if units == "" {
+		units = unitsMetric
+	}
+	if units != unitsMetric && units != unitsImperial {
+		httputil.RespondWithError(w, http.StatusBadRequest, "units must be metric or imperial")
+		return
+	}
+
+	c, err := h.getCarByPathId(r.Context(), carId)
+	if err != nil {
+		if errors.Is(err, car.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "car not found")
+			return
+		}
+		logEntry.Error("failed to get car", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	spec, err := h.carService.GetVehicleSpec(r.Context(), c.Id)
+	if err != nil {
+		if errors.Is(err, car.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "specs not found")
+			return
+		}
+		logEntry.Error("failed to get vehicle spec", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, newGetSpecsResponse(spec, units))
+}
+
+func newGetSpecsResponse(spec car.VehicleSpec, units string) getSpecsResponse {
+	resp := getSpecsResponse{
+		Units:              units,
+		Source:             spec.Source,
+		EngineCylinders:    spec.EngineCylinders,
+		Turbo:              spec.Turbo,
+		DriveType:          spec.DriveType,
+		FuelTypePrimary:    spec.FuelTypePrimary,
+		FuelTypeSecondary:  spec.FuelTypeSecondary,
+		TransmissionType:   spec.TransmissionType,
+		TransmissionSpeeds: spec.TransmissionSpeeds,
+		WheelSizeFront:     specValue{Value: spec.WheelSizeFrontInches, Unit: "in"},
+		WheelSizeRear:      specValue{Value: spec.WheelSizeRearInches, Unit: "in"},
+		Doors:              spec.Doors,
+		Seats:              spec.Seats,
+		SeatRows:           spec.SeatRows,
+		BatteryCapacity: specRangeValue{
+			specRange: specRange{Min: spec.BatteryKWh.Min, Max: spec.BatteryKWh.Max},
+			Unit:      "kWh",
+		},
+	}
+
+	if units == unitsImperial {
+		resp.Displacement = specValue{Value: convert(spec.DisplacementLiters, car.LitersToCubicInches), Unit: "ci"}
+		resp.Power = newSpecRangeValue(spec.PowerKW, car.KilowattsToHorsepower, "hp")
+		resp.Wheelbase = newSpecRangeValue(spec.WheelbaseMM, car.MillimetersToInches, "in")
+		resp.TrackWidth = specValue{Value: convert(spec.TrackWidthMM, car.MillimetersToInches), Unit: "in"}
+		resp.CurbWeight = specValue{Value: convert(spec.CurbWeightKg, car.KilogramsToPounds), Unit: "lb"}
+		resp.GVWR = newSpecRangeValue(spec.GVWRKg, car.KilogramsToPounds, "lb")
+		return resp
+	}
+
+	resp.Displacement = specValue{Value: spec.DisplacementLiters, Unit: "L"}
+	resp.Power = newSpecRangeValue(spec.PowerKW, nil, "kW")
+	resp.Wheelbase = newSpecRangeValue(spec.WheelbaseMM, nil, "mm")
+	resp.TrackWidth = specValue{Value: spec.TrackWidthMM, Unit: "mm"}
+	resp.CurbWeight = specValue{Value: spec.CurbWeightKg, Unit: "kg"}
+	resp.GVWR = newSpecRangeValue(spec.GVWRKg, nil, "kg")
+	return resp
+}
+
+func newSpecRangeValue(r car.Range, conversion func(float64) float64, unit string) specRangeValue {
+	return specRangeValue{
+		specRange: specRange{
+			Min: convert(r.Min, conversion),
+			Max: convert(r.Max, conversion),
+		},
+		Unit: unit,
+	}
+}
+
+// convert applies the unit conversion to the value, rounded to 2 decimal places. nil values
+// and conversions are passed through.
+func convert(value *float64, conversion func(float64) float64) *float64 {
+	if value == nil {
+		return nil
+	}
+	v := *value
+	if conversion != nil {
+		v = conversion(v)
+	}
+	v = math.Round(v*100) / 100
+	return &v
+}
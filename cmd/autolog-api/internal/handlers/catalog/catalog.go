@@ -0,0 +1,29 @@
+package catalog
+
+import (
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/catalog"
+)
+
+type CatalogHandler struct {
+	// foundationals/platform
+	logger *logger.Logger
+
+	// services
+	catalogService catalog.ServiceIface
+}
+
+type CatalogHandlerConfig struct {
+	// foundationals/platform
+	Logger *logger.Logger
+
+	// services
+	CatalogService catalog.ServiceIface
+}
+
+func NewCatalogHandler(config CatalogHandlerConfig) (*CatalogHandler, error) {
+	return &CatalogHandler{
+		logger:         config.Logger,
+		catalogService: config.CatalogService,
+	}, nil
+}
@@ -0,0 +1,55 @@
+package catalog
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/catalog"
+)
+
+type searchMakesResponse struct {
+	Makes []catalogMake `json:"makes"`
+}
+
+type catalogMake struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// SearchMakes is the autocomplete endpoint for makes. Expects a q query param containing the
+// start of the make name, ex. "chev" or "chevy".
+func (h *CatalogHandler) SearchMakes(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	term := strings.TrimSpace(r.URL.Query().Get("q"))
+	if term == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required q param")
+		return
+	}
+
+	makes, err := h.catalogService.SearchMakes(r.Context(), term)
+	if err != nil {
+		if errors.Is(err, catalog.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "invalid q param")
+			return
+		}
+		logEntry.Error("failed to search makes", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var resp = searchMakesResponse{
+		Makes: make([]catalogMake, 0, len(makes)),
+	}
+	for _, m := range makes {
+		resp.Makes = append(resp.Makes, catalogMake{
+			Id:   m.Id(),
+			Name: m.Name,
+		})
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
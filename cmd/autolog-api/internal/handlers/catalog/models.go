@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/catalog"
+)
+
+type searchModelsResponse struct {
+	Models []catalogModel `json:"models"`
+}
+
+type catalogModel struct {
+	Id   string `json:"id"`
+	Make string `json:"make"`
+	Name string `json:"name"`
+}
+
+// SearchModels is the autocomplete endpoint for models. Expects a make query param, and
+// optionally a year and q (start of the model name) param.
+func (h *CatalogHandler) SearchModels(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	queryParams := r.URL.Query()
+
+	mk := strings.TrimSpace(queryParams.Get("make"))
+	if mk == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required make param")
+		return
+	}
+
+	var year int64
+	if yearParam := strings.TrimSpace(queryParams.Get("year")); yearParam != "" {
+		var err error
+		year, err = strconv.ParseInt(yearParam, 10, 64)
+		if err != nil {
+			httputil.RespondWithError(w, http.StatusBadRequest, "invalid year param")
+			return
+		}
+	}
+
+	models, err := h.catalogService.SearchModels(r.Context(), catalog.SearchModelsInput{
+		Make: mk,
+		Year: year,
+		Term: strings.TrimSpace(queryParams.Get("q")),
+	})
+	if err != nil {
+		if errors.Is(err, catalog.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "invalid make or year param")
+			return
+		}
+		logEntry.Error("failed to search models", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var resp = searchModelsResponse{
+		Models: make([]catalogModel, 0, len(models)),
+	}
+	for _, m := range models {
+		resp.Models = append(resp.Models, catalogModel{
+			Id:   m.Id(),
+			Make: m.Make,
+			Name: m.Name,
+		})
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,138 @@
+package shops
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/keola-dunn/autolog/internal/authclient"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/shop"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+type employeeResponse struct {
+	Id        string    `json:"id"`
+	ShopId    string    `json:"shopId"`
+	UserId    string    `json:"userId"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newEmployeeResponse(employee shop.Employee) employeeResponse {
+	return employeeResponse{
+		Id:        employee.Id,
+		ShopId:    employee.ShopId,
+		UserId:    employee.UserId,
+		Role:      string(employee.Role),
+		CreatedAt: employee.CreatedAt,
+	}
+}
+
+type listEmployeesResponse struct {
+	Employees []employeeResponse `json:"employees"`
+}
+
+// ListEmployees lists the shop's employees, owners first
+func (h *ShopsHandler) ListEmployees(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	shopId := chi.URLParam(r, "shopId")
+	if err := uuid.Validate(shopId); err != nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "shop not found")
+		return
+	}
+
+	// employees see who they work with, admins see every shop's employees
+	_, err := h.shopService.GetEmployee(r.Context(), shopId, claims.GetUserId())
+	if err != nil && !errors.Is(err, shop.ErrNotFound) {
+		logEntry.Error("failed to check shop access", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if err != nil && !claims.HasPermission(string(user.PermissionShopsAdmin)) {
+		httputil.RespondWithError(w, http.StatusForbidden, "")
+		return
+	}
+
+	employees, err := h.shopService.ListEmployees(r.Context(), shopId)
+	if err != nil {
+		logEntry.Error("failed to list shop employees", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := listEmployeesResponse{
+		Employees: make([]employeeResponse, 0, len(employees)),
+	}
+	for _, employee := range employees {
+		resp.Employees = append(resp.Employees, newEmployeeResponse(employee))
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// RemoveEmployee removes an employee from the shop. Once they don't work at any shop, the
+// mechanic role their job granted is revoked, which logs them out. One an admin granted is kept.
+// Removing an already removed employee retries the revoke, so a failed one can be retried.
+func (h *ShopsHandler) RemoveEmployee(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	shopId, ok := h.authorizeShopManagement(w, r, claims)
+	if !ok {
+		return
+	}
+
+	employeeId := chi.URLParam(r, "employeeId")
+	if err := uuid.Validate(employeeId); err != nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "employee not found")
+		return
+	}
+
+	removed, err := h.shopService.RemoveEmployee(r.Context(), shop.RemoveEmployeeInput{
+		ShopId:          shopId,
+		EmployeeId:      employeeId,
+		RemovedByUserId: claims.GetUserId(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, shop.ErrNotFound):
+			httputil.RespondWithError(w, http.StatusNotFound, "employee not found")
+		case errors.Is(err, shop.ErrLastOwner):
+			httputil.RespondWithError(w, http.StatusConflict, err.Error())
+		default:
+			logEntry.Error("failed to remove shop employee", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	if !removed.StillEmployed {
+		err := h.authClient.RemoveUserRole(r.Context(), removed.UserId, string(user.RoleMechanic))
+		if err != nil && !errors.Is(err, authclient.ErrNotFound) {
+			logEntry.Error("failed to revoke removed employee's mechanic role", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
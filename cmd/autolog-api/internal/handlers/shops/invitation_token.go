@@ -0,0 +1,68 @@
+package shops
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/keola-dunn/autolog/internal/service/shop"
+)
+
+var errInvalidInvitationToken = errors.New("invalid invitation token")
+
+// invitationTokenIssuer is the issuer of invitation tokens, only autolog-api accepts them
+const invitationTokenIssuer = "autolog-api"
+
+// invitationTokenClaims are the claims of the tokens emailed to invitees. The subject is the
+// invitation's id, and the token expires with the invitation. They're signed with HMAC using a
+// separate secret, so they can never be mistaken for access tokens.
+type invitationTokenClaims struct {
+	jwt.RegisteredClaims
+
+	ShopId string `json:"shop_id"`
+	Email  string `json:"email"`
+}
+
+// createInvitationToken signs a token for the invitation
+func (h *ShopsHandler) createInvitationToken(invitation shop.Invitation) (string, error) {
+	claims := invitationTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   invitation.Id,
+			Issuer:    invitationTokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(h.calendarService.NowUTC()),
+			ExpiresAt: jwt.NewNumericDate(invitation.ExpiresAt),
+		},
+		ShopId: invitation.ShopId,
+		Email:  invitation.Email,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.invitationSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign invitation token: %w", err)
+	}
+
+	return token, nil
+}
+
+// parseInvitationToken validates the token. Whether the invitation is still pending is up to
+// the shop service.
+func (h *ShopsHandler) parseInvitationToken(tokenString string) (invitationTokenClaims, error) {
+	var claims invitationTokenClaims
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		return h.invitationSecret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(invitationTokenIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return invitationTokenClaims{}, errInvalidInvitationToken
+	}
+
+	if claims.Subject == "" || claims.ShopId == "" {
+		return invitationTokenClaims{}, errInvalidInvitationToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,296 @@
+package shops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/email"
+	"github.com/keola-dunn/autolog/internal/service/shop"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+type invitationResponse struct {
+	Id        string    `json:"id"`
+	ShopId    string    `json:"shopId"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invitedBy"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newInvitationResponse(invitation shop.Invitation) invitationResponse {
+	return invitationResponse{
+		Id:        invitation.Id,
+		ShopId:    invitation.ShopId,
+		Email:     invitation.Email,
+		Role:      string(invitation.Role),
+		InvitedBy: invitation.InvitedBy,
+		ExpiresAt: invitation.ExpiresAt,
+		CreatedAt: invitation.CreatedAt,
+	}
+}
+
+type createInvitationRequestBody struct {
+	Email string `json:"email"`
+
+	// Role is employee or owner, defaults to employee
+	Role string `json:"role"`
+}
+
+// CreateInvitation invites an email address to work at the shop, and emails the invitee a link
+// to accept. The invitee doesn't need an account yet. Inviting an address again replaces its
+// pending invitation.
+func (h *ShopsHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	shopId, ok := h.authorizeShopManagement(w, r, claims)
+	if !ok {
+		return
+	}
+
+	requestBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var req createInvitationRequestBody
+	if err := json.Unmarshal(requestBody, &req); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	role := shop.Role(req.Role)
+	if role == "" {
+		role = shop.RoleEmployee
+	}
+
+	invitation, err := h.shopService.CreateInvitation(r.Context(), shop.CreateInvitationInput{
+		ShopId:          shopId,
+		Email:           req.Email,
+		Role:            role,
+		InvitedByUserId: claims.GetUserId(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, shop.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "email or role is invalid")
+		case errors.Is(err, shop.ErrNotFound):
+			httputil.RespondWithError(w, http.StatusNotFound, "shop not found")
+		default:
+			logEntry.Error("failed to create shop invitation", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	if err := h.sendInvitationEmail(r.Context(), invitation); err != nil {
+		// the invitation can be sent again by inviting the address again
+		logEntry.Error("failed to send shop invitation email", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusCreated, newInvitationResponse(invitation))
+}
+
+// sendInvitationEmail emails the invitee a link to accept the invitation
+func (h *ShopsHandler) sendInvitationEmail(ctx context.Context, invitation shop.Invitation) error {
+	token, err := h.createInvitationToken(invitation)
+	if err != nil {
+		return fmt.Errorf("failed to create invitation token: %w", err)
+	}
+
+	link := fmt.Sprintf("%s/shop-invitations/accept?token=%s", h.appBaseUrl, url.QueryEscape(token))
+
+	if err := h.emailService.Send(ctx, email.Message{
+		To:      invitation.Email,
+		Subject: "You've been invited to join a shop on Autolog",
+		Body: fmt.Sprintf("You've been invited to join %s on Autolog as %s. Sign up or log in, then accept the invitation by following this link:\n\n%s\n\nThe link expires in %d days.",
+			invitation.ShopName, invitation.Role, link, int(invitation.ExpiresAt.Sub(invitation.CreatedAt).Hours()/24)),
+	}); err != nil {
+		return fmt.Errorf("failed to send invitation email: %w", err)
+	}
+
+	return nil
+}
+
+type listInvitationsResponse struct {
+	Invitations []invitationResponse `json:"invitations"`
+}
+
+// ListInvitations lists the shop's pending invitations
+func (h *ShopsHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	shopId, ok := h.authorizeShopManagement(w, r, claims)
+	if !ok {
+		return
+	}
+
+	invitations, err := h.shopService.ListInvitations(r.Context(), shopId)
+	if err != nil {
+		logEntry.Error("failed to list shop invitations", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := listInvitationsResponse{
+		Invitations: make([]invitationResponse, 0, len(invitations)),
+	}
+	for _, invitation := range invitations {
+		resp.Invitations = append(resp.Invitations, newInvitationResponse(invitation))
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// RevokeInvitation revokes a pending invitation, the emailed link stops working
+func (h *ShopsHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	shopId, ok := h.authorizeShopManagement(w, r, claims)
+	if !ok {
+		return
+	}
+
+	invitationId := chi.URLParam(r, "invitationId")
+	if err := uuid.Validate(invitationId); err != nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "invitation not found")
+		return
+	}
+
+	if err := h.shopService.RevokeInvitation(r.Context(), shopId, invitationId); err != nil {
+		if errors.Is(err, shop.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "invitation not found")
+			return
+		}
+		logEntry.Error("failed to revoke shop invitation", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type acceptInvitationRequestBody struct {
+	Token string `json:"token"`
+}
+
+// AcceptInvitation makes the caller an employee of the shop they were invited to, with the
+// emailed token, and grants them the mechanic role. Holding the token is enough, the caller may
+// have signed up with a different address. The role is in their tokens from their next refresh.
+func (h *ShopsHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	requestBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var req acceptInvitationRequestBody
+	if err := json.Unmarshal(requestBody, &req); err != nil || strings.TrimSpace(req.Token) == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing invitation token")
+		return
+	}
+
+	tokenClaims, err := h.parseInvitationToken(req.Token)
+	if err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid or expired invitation token")
+		return
+	}
+
+	employee, err := h.shopService.AcceptInvitation(r.Context(), tokenClaims.Subject, claims.GetUserId())
+	if err != nil {
+		switch {
+		case errors.Is(err, shop.ErrNotFound):
+			httputil.RespondWithError(w, http.StatusNotFound, "invitation was revoked or already accepted")
+		case errors.Is(err, shop.ErrInvitationExpired):
+			httputil.RespondWithError(w, http.StatusGone, err.Error())
+		case errors.Is(err, shop.ErrAlreadyExists):
+			httputil.RespondWithError(w, http.StatusConflict, "already an employee of the shop")
+		default:
+			logEntry.Error("failed to accept shop invitation", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	// accepting again retries this, the invitation is already accepted by the caller
+	if err := h.authClient.AddUserRole(r.Context(), employee.UserId, string(user.RoleMechanic)); err != nil {
+		logEntry.Error("failed to grant shop employee the mechanic role", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, newEmployeeResponse(employee))
+}
+
+// authorizeShopManagement checks the {shopId} path param and that the caller can manage the shop,
+// responding with an error if not
+func (h *ShopsHandler) authorizeShopManagement(w http.ResponseWriter, r *http.Request, claims jwt.AutologAPIJWTClaims) (string, bool) {
+	logEntry := logger.GetLogEntry(r)
+
+	shopId := chi.URLParam(r, "shopId")
+	if err := uuid.Validate(shopId); err != nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "shop not found")
+		return "", false
+	}
+
+	canManage, err := h.canManageShop(r, shopId, claims)
+	if err != nil {
+		logEntry.Error("failed to check shop access", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return "", false
+	}
+	if !canManage {
+		httputil.RespondWithError(w, http.StatusForbidden, "")
+		return "", false
+	}
+
+	return shopId, true
+}
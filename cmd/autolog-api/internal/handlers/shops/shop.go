@@ -0,0 +1,258 @@
+package shops
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/shop"
+)
+
+type shopResponse struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Address1  string    `json:"address1"`
+	Address2  string    `json:"address2"`
+	City      string    `json:"city"`
+	State     string    `json:"state"`
+	Zip       string    `json:"zip"`
+	Phone     string    `json:"phone"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func newShopResponse(s shop.Shop) shopResponse {
+	return shopResponse{
+		Id:        s.Id(),
+		Name:      s.Name,
+		Address1:  s.Address1,
+		Address2:  s.Address2,
+		City:      s.City,
+		State:     s.State,
+		Zip:       s.Zip,
+		Phone:     s.Phone,
+		CreatedAt: s.CreatedAt(),
+		UpdatedAt: s.UpdatedAt(),
+	}
+}
+
+// shopRequestBody is the shop's details, when creating or updating it
+type shopRequestBody struct {
+	Name     string `json:"name"`
+	Address1 string `json:"address1"`
+	Address2 string `json:"address2"`
+	City     string `json:"city"`
+	State    string `json:"state"`
+	Zip      string `json:"zip"`
+	Phone    string `json:"phone"`
+}
+
+func (b shopRequestBody) shop() shop.Shop {
+	return shop.Shop{
+		Name:     strings.TrimSpace(b.Name),
+		Address1: strings.TrimSpace(b.Address1),
+		Address2: strings.TrimSpace(b.Address2),
+		City:     strings.TrimSpace(b.City),
+		State:    strings.TrimSpace(b.State),
+		Zip:      strings.TrimSpace(b.Zip),
+		Phone:    strings.TrimSpace(b.Phone),
+	}
+}
+
+// readShopRequestBody reads the shop's details, responding with an error if they're invalid
+func readShopRequestBody(w http.ResponseWriter, r *http.Request) (shop.Shop, bool) {
+	logEntry := logger.GetLogEntry(r)
+
+	requestBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		logEntry.Error("failed to read request body", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return shop.Shop{}, false
+	}
+
+	var req shopRequestBody
+	if err := json.Unmarshal(requestBody, &req); err != nil {
+		httputil.RespondWithError(w, http.StatusBadRequest, "invalid request body")
+		return shop.Shop{}, false
+	}
+
+	s := req.shop()
+	if !s.Valid() {
+		httputil.RespondWithError(w, http.StatusBadRequest, "shop name is missing, or a field is too long")
+		return shop.Shop{}, false
+	}
+
+	return s, true
+}
+
+// CreateShop creates a shop owned by the caller. It doesn't grant them the mechanic role, owners
+// get it from an admin, or by accepting an invitation to a shop.
+func (h *ShopsHandler) CreateShop(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	s, ok := readShopRequestBody(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := h.shopService.CreateShop(r.Context(), s, claims.GetUserId())
+	if err != nil {
+		if errors.Is(err, shop.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "shop name is missing, or a field is too long")
+			return
+		}
+		logEntry.Error("failed to create shop", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusCreated, newShopResponse(created))
+}
+
+// GetShop gets a shop's details
+func (h *ShopsHandler) GetShop(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	shopId := chi.URLParam(r, "shopId")
+	if err := uuid.Validate(shopId); err != nil {
+		httputil.RespondWithError(w, http.StatusNotFound, "shop not found")
+		return
+	}
+
+	s, err := h.shopService.GetShop(r.Context(), shopId)
+	if err != nil {
+		if errors.Is(err, shop.ErrNotFound) {
+			httputil.RespondWithError(w, http.StatusNotFound, "shop not found")
+			return
+		}
+		logEntry.Error("failed to get shop", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, newShopResponse(s))
+}
+
+// UpdateShop replaces a shop's details
+func (h *ShopsHandler) UpdateShop(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	claims, ok := jwt.GetClaimsFromContext(r.Context())
+	if !ok {
+		logEntry.Error("failed to get jwt claims from context", nil)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	shopId, ok := h.authorizeShopManagement(w, r, claims)
+	if !ok {
+		return
+	}
+
+	s, ok := readShopRequestBody(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := h.shopService.UpdateShop(r.Context(), shopId, s)
+	if err != nil {
+		switch {
+		case errors.Is(err, shop.ErrInvalidArg):
+			httputil.RespondWithError(w, http.StatusBadRequest, "shop name is missing, or a field is too long")
+		case errors.Is(err, shop.ErrNotFound):
+			httputil.RespondWithError(w, http.StatusNotFound, "shop not found")
+		default:
+			logEntry.Error("failed to update shop", err)
+			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, newShopResponse(updated))
+}
+
+type searchShopsResponse struct {
+	Shops []shopResponse `json:"shops"`
+
+	// Total is how many shops matched across every page
+	Total  int64 `json:"total"`
+	Limit  int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+// SearchShops searches for shops by name, city and zip code, best matches first. Expects a q
+// query param of at least 3 characters, ex. "kona auto" or "96740". Pages with the optional
+// limit, at most 50, and offset query params.
+func (h *ShopsHandler) SearchShops(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	query := r.URL.Query()
+
+	term := strings.TrimSpace(query.Get("q"))
+	if term == "" {
+		httputil.RespondWithError(w, http.StatusBadRequest, "missing required q param")
+		return
+	}
+
+	var input = shop.SearchForShopInput{
+		Term: term,
+	}
+
+	for _, param := range []struct {
+		name  string
+		value *int64
+	}{
+		{"limit", &input.Limit},
+		{"offset", &input.Offset},
+	} {
+		if query.Get(param.name) == "" {
+			continue
+		}
+
+		v, err := strconv.ParseInt(query.Get(param.name), 10, 64)
+		if err != nil || v < 0 {
+			httputil.RespondWithError(w, http.StatusBadRequest, "invalid "+param.name+" param")
+			return
+		}
+		*param.value = v
+	}
+
+	out, err := h.shopService.SearchForShop(r.Context(), input)
+	if err != nil {
+		if errors.Is(err, shop.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusBadRequest, "q param must be at least 3 characters")
+			return
+		}
+		logEntry.Error("failed to search for shops", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	resp := searchShopsResponse{
+		Shops:  make([]shopResponse, 0, len(out.Shops)),
+		Total:  out.Total,
+		Limit:  out.Limit,
+		Offset: input.Offset,
+	}
+	for _, s := range out.Shops {
+		resp.Shops = append(resp.Shops, newShopResponse(s))
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, resp)
+}
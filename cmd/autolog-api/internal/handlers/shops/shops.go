@@ -0,0 +1,93 @@
+package shops
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/keola-dunn/autolog/internal/authclient"
+	"github.com/keola-dunn/autolog/internal/calendar"
+	"github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/email"
+	"github.com/keola-dunn/autolog/internal/service/shop"
+	"github.com/keola-dunn/autolog/internal/service/user"
+)
+
+type ShopsHandler struct {
+	// foundationals/platform
+	calendarService calendar.ServiceIface
+	logger          *logger.Logger
+
+	// services
+	shopService  shop.ServiceIface
+	emailService email.ServiceIface
+
+	// authClient grants and revokes the mechanic role of shop employees
+	authClient authclient.ClientIface
+
+	// invitationSecret signs the invitation tokens emailed to invitees
+	invitationSecret []byte
+
+	// appBaseUrl is where links in emails sent to invitees point
+	appBaseUrl string
+}
+
+type ShopsHandlerConfig struct {
+	// foundationals/platform
+	CalendarService calendar.ServiceIface
+	Logger          *logger.Logger
+
+	// services
+	ShopService  shop.ServiceIface
+	EmailService email.ServiceIface
+
+	AuthClient authclient.ClientIface
+
+	// InvitationSecret signs invitation tokens, at least 32 bytes
+	InvitationSecret []byte
+
+	// AppBaseUrl is the base url of the app links in emails point to, ex. https://autolog.app
+	AppBaseUrl string
+}
+
+func NewShopsHandler(config ShopsHandlerConfig) (*ShopsHandler, error) {
+	if len(config.InvitationSecret) < 32 {
+		return nil, fmt.Errorf("invitation secret must be at least 32 bytes")
+	}
+
+	if config.AuthClient == nil {
+		return nil, fmt.Errorf("missing auth client")
+	}
+
+	if config.EmailService == nil {
+		return nil, fmt.Errorf("missing email service")
+	}
+
+	return &ShopsHandler{
+		calendarService: config.CalendarService,
+		logger:          config.Logger,
+
+		shopService:  config.ShopService,
+		emailService: config.EmailService,
+		authClient:   config.AuthClient,
+
+		invitationSecret: config.InvitationSecret,
+		appBaseUrl:       strings.TrimSuffix(config.AppBaseUrl, "/"),
+	}, nil
+}
+
+// canManageShop checks if the user can manage the shop's employees and invitations. Shops are
+// managed by their owners, and by users with the shops:admin permission.
+func (h *ShopsHandler) canManageShop(r *http.Request, shopId string, claims jwt.AutologAPIJWTClaims) (bool, error) {
+	employee, err := h.shopService.GetEmployee(r.Context(), shopId, claims.GetUserId())
+	if err != nil && !errors.Is(err, shop.ErrNotFound) {
+		return false, err
+	}
+	if err == nil && employee.Role == shop.RoleOwner {
+		return true, nil
+	}
+
+	return claims.HasPermission(string(user.PermissionShopsAdmin)), nil
+}
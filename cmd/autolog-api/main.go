@@ -14,14 +14,23 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/keola-dunn/autolog/cmd/autolog-api/internal/handlers/cars"
+	catalogHandlers "github.com/keola-dunn/autolog/cmd/autolog-api/internal/handlers/catalog"
+	"github.com/keola-dunn/autolog/cmd/autolog-api/internal/handlers/shops"
+	"github.com/keola-dunn/autolog/internal/accountdeletion"
+	"github.com/keola-dunn/autolog/internal/authclient"
 	"github.com/keola-dunn/autolog/internal/calendar"
+	"github.com/keola-dunn/autolog/internal/imagesclient"
 	"github.com/keola-dunn/autolog/internal/jwt"
 	"github.com/keola-dunn/autolog/internal/logger"
 	nhtsavpic "github.com/keola-dunn/autolog/internal/nhtsa"
 	"github.com/keola-dunn/autolog/internal/platform/postgres"
 	"github.com/keola-dunn/autolog/internal/random"
 	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/keola-dunn/autolog/internal/service/catalog"
+	"github.com/keola-dunn/autolog/internal/service/email"
+	"github.com/keola-dunn/autolog/internal/service/shop"
 	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/keola-dunn/autolog/internal/serviceauth"
 )
 
 var environmentConfig struct {
@@ -31,9 +40,64 @@ var environmentConfig struct {
 	DBPort     int64  `envconfig:"DB_PORT"`
 	DBSchema   string `envconfig:"DB_SCHEMA"`
 
-	//AuthAPIHost string `envconfig:"AUTH_API_HOST"`
+	// AuthUrl is the auth server, ex. http://auth. autolog-api calls it with its service client
+	// credentials to grant shop employees the mechanic role.
+	AuthUrl string `envconfig:"AUTH_URL" required:"true"`
 
 	JWKSUrl string `envconfig:"JWKS_URL"`
+
+	// JWKSCachePath is where the JWKS is cached, so the service can start while the auth server
+	// is down
+	JWKSCachePath string `envconfig:"JWKS_CACHE_PATH"`
+
+	// JWKSFile is a JWKS file to verify tokens with instead of JWKSUrl, for deployments that
+	// can't reach the auth server
+	JWKSFile string `envconfig:"JWKS_FILE"`
+
+	// JWTIssuer is the auth server's issuer, only tokens it issued are accepted
+	JWTIssuer string `envconfig:"JWT_ISSUER" default:"auth-api"`
+
+	// JWTLeewaySeconds is the clock skew allowed with the auth server when checking expiry
+	JWTLeewaySeconds int64 `envconfig:"JWT_LEEWAY_SECONDS" default:"30"`
+
+	// JWTAudience is autolog-api's audience, only tokens issued for it are accepted
+	JWTAudience string `envconfig:"JWT_AUDIENCE" default:"autolog-api"`
+
+	// RevocationFeedUrl is the auth server's revocation feed, ex. http://auth/v1/oauth/revocations
+	RevocationFeedUrl string `envconfig:"REVOCATION_FEED_URL"`
+
+	// IntrospectionUrl is the auth server's introspection endpoint, ex. http://auth/v1/oauth/introspect.
+	// Personal access tokens are only accepted when it's set.
+	IntrospectionUrl string `envconfig:"INTROSPECTION_URL"`
+
+	// AccountDeletionFeedUrl is the auth server's account deletion feed, ex.
+	// http://auth/v1/auth/users/deletions. Deleted users' cars are only removed when it's set.
+	AccountDeletionFeedUrl string `envconfig:"ACCOUNT_DELETION_FEED_URL"`
+
+	// ImagesUrl is the images service, ex. http://images. Images attached to claims are checked
+	// with the images service, using the service client credentials.
+	ImagesUrl string `envconfig:"IMAGES_URL" required:"true"`
+
+	// ServiceTokenUrl is the auth server's token endpoint, ex. http://auth/v1/oauth/token.
+	// ServiceClientId and ServiceClientSecret are autolog-api's service client credentials. The
+	// client needs the auth-api audience with roles:mechanic, to grant shop employees their role,
+	// and tokens:introspect, to verify personal access tokens.
+	ServiceTokenUrl     string `envconfig:"SERVICE_TOKEN_URL"`
+	ServiceClientId     string `envconfig:"SERVICE_CLIENT_ID"`
+	ServiceClientSecret string `envconfig:"SERVICE_CLIENT_SECRET"`
+
+	// ShopInvitationSecret signs the shop invitation links emailed to invitees, at least 32 bytes
+	ShopInvitationSecret string `envconfig:"SHOP_INVITATION_SECRET" required:"true"`
+
+	// AppBaseUrl is where links in emails point
+	AppBaseUrl string `envconfig:"APP_BASE_URL" default:"http://localhost:3000"`
+
+	// SMTP configs, emails are logged when SMTPHost is empty. Local dev only.
+	SMTPHost     string `envconfig:"SMTP_HOST"`
+	SMTPPort     int64  `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername string `envconfig:"SMTP_USERNAME"`
+	SMTPPassword string `envconfig:"SMTP_PASSWORD"`
+	EmailFrom    string `envconfig:"EMAIL_FROM"`
 }
 
 func main() {
@@ -75,32 +139,134 @@ func main() {
 	calendarSvc := calendar.NewService()
 
 	jwtVerifier, err := jwt.NewTokenVerifier(context.Background(), jwt.TokenVerifierConfig{
-		JWKSUrl: environmentConfig.JWKSUrl,
+		JWKSUrl:           environmentConfig.JWKSUrl,
+		JWKSCachePath:     environmentConfig.JWKSCachePath,
+		JWKSFile:          environmentConfig.JWKSFile,
+		Issuer:            environmentConfig.JWTIssuer,
+		Audience:          environmentConfig.JWTAudience,
+		Leeway:            time.Duration(environmentConfig.JWTLeewaySeconds) * time.Second,
+		RevocationFeedUrl: environmentConfig.RevocationFeedUrl,
 	})
 	if err != nil {
 		logger.Fatal("failed to create new jwt verifier", err)
 	}
 
+	imagesTokenSource, err := serviceauth.NewTokenSource(serviceauth.TokenSourceConfig{
+		TokenUrl:     environmentConfig.ServiceTokenUrl,
+		ClientId:     environmentConfig.ServiceClientId,
+		ClientSecret: environmentConfig.ServiceClientSecret,
+		Audience:     "images",
+	})
+	if err != nil {
+		logger.Fatal("failed to create service token source", err)
+	}
+
+	imagesClient, err := imagesclient.NewClient(imagesclient.ClientConfig{
+		BaseUrl:     environmentConfig.ImagesUrl,
+		TokenSource: imagesTokenSource,
+	})
+	if err != nil {
+		logger.Fatal("failed to create images client", err)
+	}
+
+	authTokenSource, err := serviceauth.NewTokenSource(serviceauth.TokenSourceConfig{
+		TokenUrl:     environmentConfig.ServiceTokenUrl,
+		ClientId:     environmentConfig.ServiceClientId,
+		ClientSecret: environmentConfig.ServiceClientSecret,
+		Audience:     "auth-api",
+	})
+	if err != nil {
+		logger.Fatal("failed to create auth service token source", err)
+	}
+
+	authClient, err := authclient.NewClient(authclient.ClientConfig{
+		BaseUrl:     environmentConfig.AuthUrl,
+		TokenSource: authTokenSource,
+	})
+	if err != nil {
+		logger.Fatal("failed to create auth client", err)
+	}
+
+	var patVerifier jwt.PersonalAccessTokenVerifier
+	if environmentConfig.IntrospectionUrl != "" {
+		patVerifier, err = jwt.NewIntrospectionVerifier(jwt.IntrospectionVerifierConfig{
+			IntrospectionUrl: environmentConfig.IntrospectionUrl,
+			TokenSource:      authTokenSource,
+		})
+		if err != nil {
+			logger.Fatal("failed to create personal access token verifier", err)
+		}
+	}
+
 	///////////////////////
 	// Service Creations //
 	///////////////////////
 
-	userSvc := user.NewService(user.ServiceConfig{
+	userSvc, err := user.NewService(user.ServiceConfig{
 		DB:              db,
 		RandomGenerator: randomSvc,
 	})
+	if err != nil {
+		logger.Fatal("failed to create user service", err)
+	}
 
 	carSvc := car.NewService(car.ServiceConfig{
 		DB:              db,
 		RandomGenerator: randomSvc,
 	})
 
+	shopSvc := shop.NewService(shop.ServiceConfig{
+		DB:              db,
+		RandomGenerator: randomSvc,
+	})
+
+	emailSvc := email.NewService(email.ServiceConfig{
+		SMTPHost:     environmentConfig.SMTPHost,
+		SMTPPort:     environmentConfig.SMTPPort,
+		SMTPUsername: environmentConfig.SMTPUsername,
+		SMTPPassword: environmentConfig.SMTPPassword,
+		From:         environmentConfig.EmailFrom,
+		Logger:       logger,
+	})
+
+	nhtsaClient := nhtsavpic.New()
+
+	catalogSvc := catalog.NewService(catalog.ServiceConfig{
+		DB:          db,
+		NHTSAClient: nhtsaClient,
+	})
+
+	// deleted users' data is removed in the background until shutdown
+	accountDeletionCtx, accountDeletionCancel := context.WithCancel(context.Background())
+	defer accountDeletionCancel()
+
+	if environmentConfig.AccountDeletionFeedUrl != "" {
+		accountDeletionPoller, err := accountdeletion.NewPoller(accountdeletion.PollerConfig{
+			FeedUrl:     environmentConfig.AccountDeletionFeedUrl,
+			TokenSource: authTokenSource,
+			Purge: func(ctx context.Context, userId string) error {
+				if err := carSvc.DeleteUserData(ctx, userId); err != nil {
+					return err
+				}
+				return shopSvc.DeleteUserData(ctx, userId)
+			},
+			OnError: func(err error) {
+				logger.Error("failed to remove deleted users' data", err)
+			},
+		})
+		if err != nil {
+			logger.Fatal("failed to create account deletion poller", err)
+		}
+		go accountDeletionPoller.Run(accountDeletionCtx)
+	}
+
 	///////////////////////////
 	// API Handler Creations //
 	///////////////////////////
 
 	authHandler, err := jwt.NewAuthHandler(jwt.AuthHandlerConfig{
-		TokenVerifier: jwtVerifier,
+		TokenVerifier:               jwtVerifier,
+		PersonalAccessTokenVerifier: patVerifier,
 	})
 	if err != nil {
 		logger.Fatal("failed to create auth handler", err)
@@ -111,18 +277,41 @@ func main() {
 		RandomGenerator: randomSvc,
 		Logger:          logger,
 
-		NHTSAClient: nhtsavpic.New(),
+		NHTSAClient:  nhtsaClient,
+		ImagesClient: imagesClient,
 
-		UserService:   userSvc,
-		CarService:    carSvc,
-		TokenVerifier: jwtVerifier,
+		UserService:    userSvc,
+		CarService:     carSvc,
+		CatalogService: catalogSvc,
+		TokenVerifier:  jwtVerifier,
 	})
 	if err != nil {
 		logger.Fatal("failed to create cars handler", err)
 	}
 
+	catalogHandler, err := catalogHandlers.NewCatalogHandler(catalogHandlers.CatalogHandlerConfig{
+		Logger:         logger,
+		CatalogService: catalogSvc,
+	})
+	if err != nil {
+		logger.Fatal("failed to create catalog handler", err)
+	}
+
+	shopsHandler, err := shops.NewShopsHandler(shops.ShopsHandlerConfig{
+		CalendarService:  calendarSvc,
+		Logger:           logger,
+		ShopService:      shopSvc,
+		EmailService:     emailSvc,
+		AuthClient:       authClient,
+		InvitationSecret: []byte(environmentConfig.ShopInvitationSecret),
+		AppBaseUrl:       environmentConfig.AppBaseUrl,
+	})
+	if err != nil {
+		logger.Fatal("failed to create shops handler", err)
+	}
+
 	// create router using handlers
-	router := newRouter(logger, authHandler, carsHandler)
+	router := newRouter(logger, jwtVerifier, authHandler, carsHandler, catalogHandler, shopsHandler)
 
 	/////////////////////////////
 	// Server config and start //
@@ -166,13 +355,15 @@ func robotsTxt(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("User-agent: *\nDisallow: /"))
 }
 
-func newRouter(logger *logger.Logger, authHandler *jwt.AuthHandler, carsHandler *cars.CarsHandler) *chi.Mux {
+func newRouter(logger *logger.Logger, jwtVerifier *jwt.TokenVerifier, authHandler *jwt.AuthHandler,
+	carsHandler *cars.CarsHandler, catalogHandler *catalogHandlers.CatalogHandler, shopsHandler *shops.ShopsHandler) *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Use(logger.RequestLogger)
 
 	router.Get("/", home)
 	router.Get("/health", healthCheck)
+	router.Get("/health/jwks", jwtVerifier.JWKSHealthHandler)
 
 	router.Get("/robots.txt", robotsTxt)
 
@@ -182,17 +373,84 @@ func newRouter(logger *logger.Logger, authHandler *jwt.AuthHandler, carsHandler
 	router.Mount("/debug", middleware.Profiler())
 
 	router.Route("/v1", func(router chi.Router) {
-		router.Route("/users", func(router chi.Router) {
-			// GET user details
-			// authenticated only
-			router.With(authHandler.RequireTokenAuthentication).Get("/", nil)
-		})
-
 		router.Route("/shops", func(router chi.Router) {
-			// GET search for shops
+			// POST create a shop owned by the caller
+			// authenticated only, with a verified email
+			router.With(authHandler.RequireTokenAuthentication, authHandler.RequireVerifiedEmail).
+				Post("/", shopsHandler.CreateShop)
+
+			// GET search for shops by name, city and zip, paged with limit and offset
 			// public
 			// ex. signing up for the right shop
-			router.Get("/search", nil)
+			router.Get("/search", shopsHandler.SearchShops)
+
+			// POST accept an invitation with the emailed token, grants the mechanic role
+			// authenticated only, holding the token is enough
+			router.With(authHandler.RequireTokenAuthentication).Post("/invitations/accept", shopsHandler.AcceptInvitation)
+
+			router.Route("/{shopId}", func(router chi.Router) {
+				// GET shop details
+				// public
+				router.Get("/", shopsHandler.GetShop)
+
+				// PUT replace the shop's details
+				// authenticated only, shop owner or admin
+				router.With(authHandler.RequireTokenAuthentication).Put("/", shopsHandler.UpdateShop)
+
+				// GET the shop's employees
+				// authenticated only, shop employee or admin
+				router.With(authHandler.RequireTokenAuthentication).Get("/employees", shopsHandler.ListEmployees)
+
+				// DELETE remove an employee, revokes their mechanic role once they don't work at
+				// any shop
+				// authenticated only, shop owner or admin
+				router.With(authHandler.RequireTokenAuthentication).Delete("/employees/{employeeId}", shopsHandler.RemoveEmployee)
+
+				// POST invite an email address to work at the shop, GET pending invitations
+				// DELETE revoke a pending invitation
+				// authenticated only, shop owner or admin
+				router.With(authHandler.RequireTokenAuthentication).Post("/invitations", shopsHandler.CreateInvitation)
+				router.With(authHandler.RequireTokenAuthentication).Get("/invitations", shopsHandler.ListInvitations)
+				router.With(authHandler.RequireTokenAuthentication).Delete("/invitations/{invitationId}", shopsHandler.RevokeInvitation)
+			})
+		})
+
+		router.Route("/catalog", func(router chi.Router) {
+			// GET autocomplete makes
+			// public
+			router.Get("/makes", catalogHandler.SearchMakes)
+
+			// GET autocomplete models for a make, optionally by year
+			// public
+			router.Get("/models", catalogHandler.SearchModels)
+		})
+
+		router.Route("/claims", func(router chi.Router) {
+			router.Use(authHandler.RequireTokenAuthentication)
+
+			// GET claims made by the user, or on the user's cars with ?as=owner
+			// authenticated only
+			router.Get("/", carsHandler.ListClaims)
+
+			router.Route("/{claimId}", func(router chi.Router) {
+				// GET claim details
+				// authenticated only, claimant, current owner, or admin
+				router.Get("/", carsHandler.GetClaim)
+
+				// POST evidence of ownership for review
+				// authenticated only, claimant
+				router.Post("/evidence", carsHandler.SubmitClaimEvidence)
+
+				// POST approve or reject the claim
+				// authenticated only, current owner or admin. Approving transfers the car, so
+				// it requires a verified email
+				router.With(authHandler.RequireVerifiedEmail).Post("/approve", carsHandler.ApproveClaim)
+				router.Post("/reject", carsHandler.RejectClaim)
+
+				// POST withdraw the claim
+				// authenticated only, claimant
+				router.Post("/cancel", carsHandler.CancelClaim)
+			})
 		})
 
 		router.Route("/cars", func(router chi.Router) {
@@ -206,8 +464,9 @@ func newRouter(logger *logger.Logger, authHandler *jwt.AuthHandler, carsHandler
 			router.With(authHandler.OptionalAuthentication).Get("/lookup", carsHandler.Lookup)
 
 			// PUT car if acquired
-			// authenticated only
-			router.With(authHandler.RequireTokenAuthentication).Put("/", carsHandler.CreateCar)
+			// authenticated only, becomes a claim if the VIN already exists
+			router.With(authHandler.RequireTokenAuthentication,
+				authHandler.RequirePermission(string(user.PermissionCarsWrite))).Put("/", carsHandler.CreateCar)
 
 			router.Route("/{carId}", func(router chi.Router) {
 
@@ -215,13 +474,19 @@ func newRouter(logger *logger.Logger, authHandler *jwt.AuthHandler, carsHandler
 				// public or authenticated
 				router.Get("/", nil)
 
+				// GET normalized car specs, metric or imperial
+				// public
+				router.Get("/specs", carsHandler.GetSpecs)
+
 				// POST car update (if sold, etc.)
 				// authenticated only
-				router.With(authHandler.RequireTokenAuthentication).Post("/", nil)
+				router.With(authHandler.RequireTokenAuthentication,
+					authHandler.RequirePermission(string(user.PermissionCarsWrite))).Post("/", nil)
 
 				// POST maintence log
 				// authenticated only
-				router.With(authHandler.RequireTokenAuthentication).Post("/maintenance-log", nil)
+				router.With(authHandler.RequireTokenAuthentication,
+					authHandler.RequirePermission(string(user.PermissionServiceLogsWrite))).Post("/maintenance-log", nil)
 			})
 
 		})
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/keola-dunn/autolog/internal/logger"
+	nhtsavpic "github.com/keola-dunn/autolog/internal/nhtsa"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+	"github.com/keola-dunn/autolog/internal/service/catalog"
+)
+
+// catalog-sync is a one shot job that pulls makes and models from NHTSA vPIC into the local
+// catalog tables. Intended to be run on a schedule (ex. nightly cron).
+
+var environmentConfig struct {
+	DBUser     string `envconfig:"DB_USER"`
+	DBPassword string `envconfig:"DB_PASSWORD"`
+	DBHost     string `envconfig:"DB_HOST"`
+	DBPort     int64  `envconfig:"DB_PORT"`
+	DBSchema   string `envconfig:"DB_SCHEMA"`
+
+	// SyncMakes limits the model sync to the provided makes. All makes are synced if empty.
+	SyncMakes []string `envconfig:"CATALOG_SYNC_MAKES"`
+
+	// SyncYearsBack is the number of model years prior to the current year to sync model years
+	// for. Set to a large value to backfill.
+	SyncYearsBack int64 `envconfig:"CATALOG_SYNC_YEARS_BACK" default:"1"`
+
+	// SyncYearsForward is the number of model years after the current year to sync model years
+	// for. Manufacturers release next year's models early.
+	SyncYearsForward int64 `envconfig:"CATALOG_SYNC_YEARS_FORWARD" default:"1"`
+
+	SyncTimeoutMinutes int64 `envconfig:"CATALOG_SYNC_TIMEOUT_MINUTES" default:"120"`
+}
+
+func main() {
+	logger := logger.NewLogger()
+
+	// attempt to retrieve env vars from env file. This is for local dev only
+	if err := godotenv.Load(); err != nil {
+		logger.Error("failed to load .env file", err)
+	}
+
+	if err := envconfig.Process("", &environmentConfig); err != nil {
+		logger.Fatal("failed to process environment config", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(environmentConfig.SyncTimeoutMinutes)*time.Minute)
+	defer cancel()
+
+	///////////////////////////////////////
+	// Platform and Foundational configs //
+	///////////////////////////////////////
+	logger.Info("connecting to the database...")
+	db, err := postgres.NewConnectionPool(ctx, postgres.ConnectionPoolConfig{
+		ConnectionConfig: postgres.ConnectionConfig{
+			User:     environmentConfig.DBUser,
+			Password: environmentConfig.DBPassword,
+			Host:     environmentConfig.DBHost,
+			Port:     environmentConfig.DBPort,
+			Schema:   environmentConfig.DBSchema,
+		},
+		MaxConnections:        2,
+		MinConnections:        1,
+		MaxConnectionIdleTime: time.Minute,
+	})
+	if err != nil {
+		logger.Fatal("failed to connect to the database", err)
+	}
+	defer db.Close()
+	logger.Info("successfully connected to the database!")
+
+	catalogSvc := catalog.NewService(catalog.ServiceConfig{
+		DB:          db,
+		NHTSAClient: nhtsavpic.New(),
+	})
+
+	start := time.Now()
+	logger.Info("syncing makes...")
+	makesSynced, err := catalogSvc.SyncMakes(ctx)
+	if err != nil {
+		logger.Fatal("failed to sync makes", err)
+	}
+	logger.Info("synced makes", "count", makesSynced, "durationMs", time.Since(start).Milliseconds())
+
+	currentYear := int64(time.Now().UTC().Year())
+
+	start = time.Now()
+	logger.Info("syncing models...")
+	modelsSynced, err := catalogSvc.SyncModels(ctx, catalog.SyncModelsInput{
+		Makes:     environmentConfig.SyncMakes,
+		StartYear: currentYear - environmentConfig.SyncYearsBack,
+		EndYear:   currentYear + environmentConfig.SyncYearsForward,
+	})
+	if err != nil {
+		logger.Fatal("failed to sync models", err)
+	}
+	logger.Info("synced models", "count", modelsSynced, "durationMs", time.Since(start).Milliseconds())
+}
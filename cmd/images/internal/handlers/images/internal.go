@@ -0,0 +1,68 @@
+package images
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/service/image"
+)
+
+type imageResponse struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"userId"`
+	Title     string    `json:"title"`
+	Width     int64     `json:"width"`
+	Height    int64     `json:"height"`
+	SizeKb    int64     `json:"sizeKb"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// GetInternalImage gets an image's metadata for another autolog service, ex. so autolog-api can
+// check who uploaded an image before attaching it to something
+func (h *ImagesHandler) GetInternalImage(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	i, err := h.imageSvc.GetImage(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, image.ErrNotFound) || errors.Is(err, image.ErrInvalidArg) {
+			httputil.RespondWithError(w, http.StatusNotFound, "")
+			return
+		}
+		logEntry.Error("failed to get image", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	httputil.RespondWithJSON(w, http.StatusOK, imageResponse{
+		Id:        i.Id(),
+		UserId:    i.UserId,
+		Title:     i.Title,
+		Width:     i.Width(),
+		Height:    i.Height(),
+		SizeKb:    i.SizeKb,
+		CreatedAt: i.CreatedAt(),
+	})
+}
+
+// DeleteUserImages removes every image a user uploaded, for another autolog service
+func (h *ImagesHandler) DeleteUserImages(w http.ResponseWriter, r *http.Request) {
+	logEntry := logger.GetLogEntry(r)
+
+	userId := chi.URLParam(r, "userId")
+	if userId == "" {
+		httputil.RespondWithError(w, http.StatusNotFound, "")
+		return
+	}
+
+	if err := h.imageSvc.DeleteUserImages(r.Context(), userId); err != nil {
+		logEntry.Error("failed to delete user images", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
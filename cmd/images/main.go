@@ -15,11 +15,14 @@ import (
 	"github.com/kelseyhightower/envconfig"
 
 	"github.com/keola-dunn/autolog/cmd/images/internal/handlers/images"
+	"github.com/keola-dunn/autolog/internal/accountdeletion"
 	"github.com/keola-dunn/autolog/internal/jwt"
 	"github.com/keola-dunn/autolog/internal/logger"
 	"github.com/keola-dunn/autolog/internal/platform/postgres"
 	"github.com/keola-dunn/autolog/internal/random"
 	"github.com/keola-dunn/autolog/internal/service/image"
+	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/keola-dunn/autolog/internal/serviceauth"
 )
 
 var environmentConfig struct {
@@ -32,6 +35,42 @@ var environmentConfig struct {
 	//AuthAPIHost string `envconfig:"AUTH_API_HOST"`
 
 	JWKSUrl string `envconfig:"JWKS_URL"`
+
+	// JWKSCachePath is where the JWKS is cached, so the service can start while the auth server
+	// is down
+	JWKSCachePath string `envconfig:"JWKS_CACHE_PATH"`
+
+	// JWKSFile is a JWKS file to verify tokens with instead of JWKSUrl, for deployments that
+	// can't reach the auth server
+	JWKSFile string `envconfig:"JWKS_FILE"`
+
+	// JWTIssuer is the auth server's issuer, only tokens it issued are accepted
+	JWTIssuer string `envconfig:"JWT_ISSUER" default:"auth-api"`
+
+	// JWTLeewaySeconds is the clock skew allowed with the auth server when checking expiry
+	JWTLeewaySeconds int64 `envconfig:"JWT_LEEWAY_SECONDS" default:"30"`
+
+	// JWTAudience is the images service's audience, only tokens issued for it are accepted
+	JWTAudience string `envconfig:"JWT_AUDIENCE" default:"images"`
+
+	// RevocationFeedUrl is the auth server's revocation feed, ex. http://auth/v1/oauth/revocations
+	RevocationFeedUrl string `envconfig:"REVOCATION_FEED_URL"`
+
+	// IntrospectionUrl is the auth server's introspection endpoint, ex. http://auth/v1/oauth/introspect.
+	// Personal access tokens are only accepted when it's set.
+	IntrospectionUrl string `envconfig:"INTROSPECTION_URL"`
+
+	// AccountDeletionFeedUrl is the auth server's account deletion feed, ex.
+	// http://auth/v1/auth/users/deletions. Deleted users' images are only removed when it's set.
+	AccountDeletionFeedUrl string `envconfig:"ACCOUNT_DELETION_FEED_URL"`
+
+	// ServiceTokenUrl is the auth server's token endpoint, ex. http://auth/v1/oauth/token.
+	// ServiceClientId and ServiceClientSecret are the images service's service client
+	// credentials, with the auth-api audience, to introspect personal access tokens and read the
+	// account deletion feed. Introspection needs the tokens:introspect permission.
+	ServiceTokenUrl     string `envconfig:"SERVICE_TOKEN_URL"`
+	ServiceClientId     string `envconfig:"SERVICE_CLIENT_ID"`
+	ServiceClientSecret string `envconfig:"SERVICE_CLIENT_SECRET"`
 }
 
 func main() {
@@ -73,12 +112,44 @@ func main() {
 	// calendarSvc := calendar.NewService()
 
 	jwtVerifier, err := jwt.NewTokenVerifier(context.Background(), jwt.TokenVerifierConfig{
-		JWKSUrl: environmentConfig.JWKSUrl,
+		JWKSUrl:           environmentConfig.JWKSUrl,
+		JWKSCachePath:     environmentConfig.JWKSCachePath,
+		JWKSFile:          environmentConfig.JWKSFile,
+		Issuer:            environmentConfig.JWTIssuer,
+		Audience:          environmentConfig.JWTAudience,
+		Leeway:            time.Duration(environmentConfig.JWTLeewaySeconds) * time.Second,
+		RevocationFeedUrl: environmentConfig.RevocationFeedUrl,
 	})
 	if err != nil {
 		logger.Fatal("failed to create new jwt verifier", err)
 	}
 
+	// the auth server is called as the images service, to introspect personal access tokens and
+	// read the account deletion feed
+	var authTokenSource *serviceauth.TokenSource
+	if environmentConfig.IntrospectionUrl != "" || environmentConfig.AccountDeletionFeedUrl != "" {
+		authTokenSource, err = serviceauth.NewTokenSource(serviceauth.TokenSourceConfig{
+			TokenUrl:     environmentConfig.ServiceTokenUrl,
+			ClientId:     environmentConfig.ServiceClientId,
+			ClientSecret: environmentConfig.ServiceClientSecret,
+			Audience:     "auth-api",
+		})
+		if err != nil {
+			logger.Fatal("failed to create auth service token source", err)
+		}
+	}
+
+	var patVerifier jwt.PersonalAccessTokenVerifier
+	if environmentConfig.IntrospectionUrl != "" {
+		patVerifier, err = jwt.NewIntrospectionVerifier(jwt.IntrospectionVerifierConfig{
+			IntrospectionUrl: environmentConfig.IntrospectionUrl,
+			TokenSource:      authTokenSource,
+		})
+		if err != nil {
+			logger.Fatal("failed to create personal access token verifier", err)
+		}
+	}
+
 	///////////////////////
 	// Service Creations //
 	///////////////////////
@@ -99,12 +170,32 @@ func main() {
 	// 	RandomGenerator: randomSvc,
 	// })
 
+	// deleted users' data is removed in the background until shutdown
+	accountDeletionCtx, accountDeletionCancel := context.WithCancel(context.Background())
+	defer accountDeletionCancel()
+
+	if environmentConfig.AccountDeletionFeedUrl != "" {
+		accountDeletionPoller, err := accountdeletion.NewPoller(accountdeletion.PollerConfig{
+			FeedUrl:     environmentConfig.AccountDeletionFeedUrl,
+			TokenSource: authTokenSource,
+			Purge:       imageSvc.DeleteUserImages,
+			OnError: func(err error) {
+				logger.Error("failed to remove deleted users' images", err)
+			},
+		})
+		if err != nil {
+			logger.Fatal("failed to create account deletion poller", err)
+		}
+		go accountDeletionPoller.Run(accountDeletionCtx)
+	}
+
 	///////////////////////////
 	// API Handler Creations //
 	///////////////////////////
 
 	authHandler, err := jwt.NewAuthHandler(jwt.AuthHandlerConfig{
-		TokenVerifier: jwtVerifier,
+		TokenVerifier:               jwtVerifier,
+		PersonalAccessTokenVerifier: patVerifier,
 	})
 	if err != nil {
 		logger.Fatal("failed to create auth handler", err)
@@ -118,7 +209,7 @@ func main() {
 	}
 
 	// create router using handlers
-	router := newRouter(logger, authHandler, imagesHandler)
+	router := newRouter(logger, jwtVerifier, authHandler, imagesHandler)
 
 	/////////////////////////////
 	// Server config and start //
@@ -162,13 +253,15 @@ func robotsTxt(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("User-agent: *\nDisallow: /"))
 }
 
-func newRouter(logger *logger.Logger, authHandler *jwt.AuthHandler, imageHandler *images.ImagesHandler) *chi.Mux {
+func newRouter(logger *logger.Logger, jwtVerifier *jwt.TokenVerifier, authHandler *jwt.AuthHandler,
+	imageHandler *images.ImagesHandler) *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Use(logger.RequestLogger)
 
 	router.Get("/", home)
 	router.Get("/health", healthCheck)
+	router.Get("/health/jwks", jwtVerifier.JWKSHealthHandler)
 
 	router.Get("/robots.txt", robotsTxt)
 
@@ -183,7 +276,21 @@ func newRouter(logger *logger.Logger, authHandler *jwt.AuthHandler, imageHandler
 			router.Get("/{id}", imageHandler.GetImage)
 
 			// POST image(s)
-			router.With(authHandler.RequireTokenAuthentication).Post("/", imageHandler.PostImage)
+			router.With(authHandler.RequireTokenAuthentication,
+				authHandler.RequirePermission(string(user.PermissionImagesWrite))).Post("/", imageHandler.PostImage)
+		})
+
+		// service to service routes, for other autolog services calling with service tokens
+		router.Route("/internal", func(router chi.Router) {
+			router.Use(authHandler.RequireServiceAuthentication)
+
+			// GET image metadata
+			router.With(authHandler.RequirePermission(string(user.PermissionImagesRead))).
+				Get("/images/{id}", imageHandler.GetInternalImage)
+
+			// DELETE a user's images
+			router.With(authHandler.RequirePermission(string(user.PermissionImagesAdmin))).
+				Delete("/users/{userId}/images", imageHandler.DeleteUserImages)
 		})
 	})
 
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/keola-dunn/autolog/internal/logger"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+	"github.com/keola-dunn/autolog/internal/service/car"
+)
+
+// spec-backfill is a one shot job that builds the vehicle spec for cars that have NHTSA vPIC
+// data but no spec, ex. cars created before specs were recorded. Safe to run again, cars that
+// have a spec are skipped.
+
+var environmentConfig struct {
+	DBUser     string `envconfig:"DB_USER"`
+	DBPassword string `envconfig:"DB_PASSWORD"`
+	DBHost     string `envconfig:"DB_HOST"`
+	DBPort     int64  `envconfig:"DB_PORT"`
+	DBSchema   string `envconfig:"DB_SCHEMA"`
+
+	BackfillTimeoutMinutes int64 `envconfig:"SPEC_BACKFILL_TIMEOUT_MINUTES" default:"30"`
+}
+
+func main() {
+	logger := logger.NewLogger()
+
+	// attempt to retrieve env vars from env file. This is for local dev only
+	if err := godotenv.Load(); err != nil {
+		logger.Error("failed to load .env file", err)
+	}
+
+	if err := envconfig.Process("", &environmentConfig); err != nil {
+		logger.Fatal("failed to process environment config", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(environmentConfig.BackfillTimeoutMinutes)*time.Minute)
+	defer cancel()
+
+	///////////////////////////////////////
+	// Platform and Foundational configs //
+	///////////////////////////////////////
+	logger.Info("connecting to the database...")
+	db, err := postgres.NewConnectionPool(ctx, postgres.ConnectionPoolConfig{
+		ConnectionConfig: postgres.ConnectionConfig{
+			User:     environmentConfig.DBUser,
+			Password: environmentConfig.DBPassword,
+			Host:     environmentConfig.DBHost,
+			Port:     environmentConfig.DBPort,
+			Schema:   environmentConfig.DBSchema,
+		},
+		MaxConnections:        2,
+		MinConnections:        1,
+		MaxConnectionIdleTime: time.Minute,
+	})
+	if err != nil {
+		logger.Fatal("failed to connect to the database", err)
+	}
+	defer db.Close()
+	logger.Info("successfully connected to the database!")
+
+	carSvc := car.NewService(car.ServiceConfig{
+		DB: db,
+	})
+
+	start := time.Now()
+	logger.Info("backfilling vehicle specs...")
+	created, err := carSvc.BackfillVehicleSpecs(ctx)
+	if err != nil {
+		logger.Fatal("failed to backfill vehicle specs", err)
+	}
+	logger.Info("backfilled vehicle specs", "count", created, "durationMs", time.Since(start).Milliseconds())
+}
@@ -0,0 +1,203 @@
+package accountdeletion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Feed lists the accounts deleted by the auth server. It is served by the auth server and
+// polled by Poller, so each service can remove its own data about deleted users.
+type Feed struct {
+	// GeneratedAt is passed back as the since query param to only get newer deletions
+	GeneratedAt time.Time `json:"generatedAt"`
+
+	Users []DeletedUser `json:"users"`
+}
+
+// DeletedUser is a single deleted account
+type DeletedUser struct {
+	UserId    string    `json:"sub"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// TokenSource provides the service tokens the feed is requested with, ex.
+// serviceauth.TokenSource
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// invalidator is implemented by token sources that cache tokens, so a rejected token isn't
+// reused
+type invalidator interface {
+	Invalidate()
+}
+
+// PurgeFunc removes a deleted user's data from a service. It is called again for a user if it
+// failed, or the service restarted, so it must be safe to repeat.
+type PurgeFunc func(ctx context.Context, userId string) error
+
+// Poller polls the auth server's account deletion feed and purges each deleted user
+type Poller struct {
+	feedUrl     string
+	tokenSource TokenSource
+	httpClient  *http.Client
+	interval    time.Duration
+
+	purge   PurgeFunc
+	onError func(error)
+
+	since time.Time
+}
+
+type PollerConfig struct {
+	// FeedUrl is the auth server's account deletion feed, ex. http://auth/v1/auth/users/deletions
+	FeedUrl string
+
+	// TokenSource provides the service's tokens for the auth server. The feed is only served to
+	// other autolog services.
+	TokenSource TokenSource
+
+	Purge PurgeFunc
+
+	// OnError is called with every failed poll or purge, ex. to log it. Optional.
+	OnError func(error)
+
+	// Interval defaults to 5 minutes
+	Interval time.Duration
+
+	// HTTPClient defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+func NewPoller(config PollerConfig) (*Poller, error) {
+	if _, err := url.ParseRequestURI(config.FeedUrl); err != nil {
+		return nil, fmt.Errorf("invalid account deletion feed url: %w", err)
+	}
+
+	if config.TokenSource == nil {
+		return nil, errors.New("missing token source")
+	}
+
+	if config.Purge == nil {
+		return nil, errors.New("missing purge func")
+	}
+
+	if config.OnError == nil {
+		config.OnError = func(error) {}
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	return &Poller{
+		feedUrl:     config.FeedUrl,
+		tokenSource: config.TokenSource,
+		httpClient:  config.HTTPClient,
+		interval:    config.Interval,
+		purge:       config.Purge,
+		onError:     config.OnError,
+	}, nil
+}
+
+// Run polls the feed until the context is done. The first poll gets every deletion the feed
+// still lists, so users deleted while the service was down are purged too.
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.poll(ctx); err != nil {
+			p.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll purges the users deleted since the last poll. The position in the feed only moves
+// forward once every user is purged, so failures are retried on the next poll.
+func (p *Poller) poll(ctx context.Context) error {
+	feed, err := p.getFeed(ctx)
+	if err != nil {
+		return err
+	}
+
+	var purgeErr error
+	for _, u := range feed.Users {
+		if err := p.purge(ctx, u.UserId); err != nil {
+			purgeErr = errors.Join(purgeErr, fmt.Errorf("failed to purge deleted user %s: %w", u.UserId, err))
+		}
+	}
+	if purgeErr != nil {
+		return purgeErr
+	}
+
+	p.since = feed.GeneratedAt
+
+	return nil
+}
+
+func (p *Poller) getFeed(ctx context.Context) (Feed, error) {
+	feedUrl, err := url.Parse(p.feedUrl)
+	if err != nil {
+		return Feed{}, fmt.Errorf("failed to parse account deletion feed url: %w", err)
+	}
+
+	if !p.since.IsZero() {
+		query := feedUrl.Query()
+		query.Set("since", p.since.Format(time.RFC3339Nano))
+		feedUrl.RawQuery = query.Encode()
+	}
+
+	token, err := p.tokenSource.Token(ctx)
+	if err != nil {
+		return Feed{}, fmt.Errorf("failed to get service token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedUrl.String(), nil)
+	if err != nil {
+		return Feed{}, fmt.Errorf("failed to create account deletion feed request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return Feed{}, fmt.Errorf("failed to get account deletion feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// a rejected token is dropped, so the next poll gets a new one in case it was revoked or its
+	// signing key retired
+	if resp.StatusCode == http.StatusUnauthorized {
+		if tokenSource, ok := p.tokenSource.(invalidator); ok {
+			tokenSource.Invalidate()
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Feed{}, fmt.Errorf("unexpected account deletion feed status code: %d", resp.StatusCode)
+	}
+
+	var feed Feed
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return Feed{}, fmt.Errorf("failed to decode account deletion feed: %w", err)
+	}
+
+	return feed, nil
+}
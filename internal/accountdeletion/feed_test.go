@@ -0,0 +1,201 @@
+package accountdeletion_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/accountdeletion"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "service-token"
+
+type fakeTokenSource struct {
+	mu          sync.Mutex
+	invalidated bool
+}
+
+func (f *fakeTokenSource) Token(_ context.Context) (string, error) {
+	return testToken, nil
+}
+
+func (f *fakeTokenSource) Invalidate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.invalidated = true
+}
+
+func TestPollerRun(t *testing.T) {
+	generatedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		purgeErrs map[string]error
+
+		expectedPurged []string
+		// expectedSince is the since param of the second poll
+		expectedSince string
+	}{
+		{
+			name:           "Purged",
+			expectedPurged: []string{"user-1", "user-2"},
+			expectedSince:  generatedAt.Format(time.RFC3339Nano),
+		},
+		{
+			name:           "PurgeFailed",
+			purgeErrs:      map[string]error{"user-2": errors.New("fake purge error")},
+			expectedPurged: []string{"user-1"},
+			expectedSince:  "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var mu sync.Mutex
+			sinces := make([]string, 0)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer "+testToken {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				mu.Lock()
+				sinces = append(sinces, r.URL.Query().Get("since"))
+				polls := len(sinces)
+				mu.Unlock()
+
+				if polls >= 2 {
+					cancel()
+				}
+
+				json.NewEncoder(w).Encode(accountdeletion.Feed{
+					GeneratedAt: generatedAt,
+					Users: []accountdeletion.DeletedUser{
+						{UserId: "user-1", DeletedAt: generatedAt.Add(-time.Hour)},
+						{UserId: "user-2", DeletedAt: generatedAt.Add(-time.Minute)},
+					},
+				})
+			}))
+			defer server.Close()
+
+			purged := make([]string, 0)
+			var errs []error
+			poller, err := accountdeletion.NewPoller(accountdeletion.PollerConfig{
+				FeedUrl:     server.URL,
+				TokenSource: &fakeTokenSource{},
+				Purge: func(ctx context.Context, userId string) error {
+					mu.Lock()
+					defer mu.Unlock()
+					if err := test.purgeErrs[userId]; err != nil {
+						return err
+					}
+					// only the first poll's purges are checked
+					if len(sinces) == 1 {
+						purged = append(purged, userId)
+					}
+					return nil
+				},
+				OnError: func(err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					errs = append(errs, err)
+				},
+				Interval: time.Millisecond,
+			})
+			require.NoError(t, err)
+
+			done := make(chan struct{})
+			go func() {
+				poller.Run(ctx)
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("poller did not stop")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.Equal(t, test.expectedPurged, purged)
+			require.GreaterOrEqual(t, len(sinces), 2)
+			require.Equal(t, "", sinces[0])
+			require.Equal(t, test.expectedSince, sinces[1])
+			if len(test.purgeErrs) > 0 {
+				require.NotEmpty(t, errs)
+			}
+		})
+	}
+}
+
+func TestPollerRejectedToken(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tokenSource := &fakeTokenSource{}
+	var errs []error
+	poller, err := accountdeletion.NewPoller(accountdeletion.PollerConfig{
+		FeedUrl:     server.URL,
+		TokenSource: tokenSource,
+		Purge: func(ctx context.Context, userId string) error {
+			t.Errorf("unexpected purge of %s", userId)
+			return nil
+		},
+		OnError: func(err error) {
+			errs = append(errs, err)
+			cancel()
+		},
+		Interval: time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	poller.Run(ctx)
+
+	require.NotEmpty(t, errs)
+	tokenSource.mu.Lock()
+	defer tokenSource.mu.Unlock()
+	require.True(t, tokenSource.invalidated)
+}
+
+func TestNewPoller(t *testing.T) {
+	purge := func(ctx context.Context, userId string) error { return nil }
+	tokenSource := &fakeTokenSource{}
+
+	_, err := accountdeletion.NewPoller(accountdeletion.PollerConfig{TokenSource: tokenSource, Purge: purge})
+	require.Error(t, err)
+
+	_, err = accountdeletion.NewPoller(accountdeletion.PollerConfig{
+		FeedUrl:     "http://auth/v1/auth/users/deletions",
+		TokenSource: tokenSource,
+	})
+	require.Error(t, err)
+
+	_, err = accountdeletion.NewPoller(accountdeletion.PollerConfig{
+		FeedUrl: "http://auth/v1/auth/users/deletions",
+		Purge:   purge,
+	})
+	require.Error(t, err)
+
+	_, err = accountdeletion.NewPoller(accountdeletion.PollerConfig{
+		FeedUrl:     "http://auth/v1/auth/users/deletions",
+		TokenSource: tokenSource,
+		Purge:       purge,
+	})
+	require.NoError(t, err)
+}
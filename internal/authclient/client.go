@@ -0,0 +1,160 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	ErrNotFound = errors.New("the requested resource was not found")
+
+	// ErrUnauthorized is returned when the auth server rejects the service token, ex. it lacks
+	// the permission for the call
+	ErrUnauthorized = errors.New("the auth server rejected the service token")
+)
+
+// TokenSource provides the service tokens the client authenticates with, ex.
+// serviceauth.TokenSource
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// invalidator is implemented by token sources that cache tokens, so a rejected token isn't
+// reused
+type invalidator interface {
+	Invalidate()
+}
+
+type ClientIface interface {
+	AddUserRole(ctx context.Context, userId, role string) error
+	RemoveUserRole(ctx context.Context, userId, role string) error
+}
+
+// Client calls the auth server's internal routes as the calling service
+type Client struct {
+	baseUrl     string
+	tokenSource TokenSource
+	httpClient  *http.Client
+}
+
+type ClientConfig struct {
+	// BaseUrl is the auth server's url, ex. http://auth
+	BaseUrl string
+
+	TokenSource TokenSource
+
+	// HTTPClient defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+func NewClient(config ClientConfig) (*Client, error) {
+	if _, err := url.ParseRequestURI(config.BaseUrl); err != nil {
+		return nil, fmt.Errorf("invalid auth server url: %w", err)
+	}
+
+	if config.TokenSource == nil {
+		return nil, errors.New("missing token source")
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	return &Client{
+		baseUrl:     strings.TrimSuffix(config.BaseUrl, "/"),
+		tokenSource: config.TokenSource,
+		httpClient:  config.HTTPClient,
+	}, nil
+}
+
+// AddUserRole grants the user a role as the calling service. Granting a role the user already
+// holds does nothing. Returns ErrInvalidArg if the auth server doesn't know the role.
+func (c *Client) AddUserRole(ctx context.Context, userId, role string) error {
+	return c.userRole(ctx, http.MethodPut, userId, role)
+}
+
+// RemoveUserRole revokes a role the calling service granted the user, which also revokes their
+// tokens. Returns ErrNotFound if the user doesn't hold the role from the service, ex. an admin
+// granted it.
+func (c *Client) RemoveUserRole(ctx context.Context, userId, role string) error {
+	return c.userRole(ctx, http.MethodDelete, userId, role)
+}
+
+func (c *Client) userRole(ctx context.Context, method, userId, role string) error {
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(role) == "" {
+		return ErrInvalidArg
+	}
+
+	resp, err := c.do(ctx, method, "/v1/internal/users/"+url.PathEscape(userId)+"/roles/"+url.PathEscape(role))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return statusError(resp.StatusCode)
+	}
+
+	return nil
+}
+
+// do sends a request with a service token. A rejected token is dropped and the request retried
+// once with a new one, in case it was revoked or its signing key retired.
+func (c *Client) do(ctx context.Context, method, path string) (*http.Response, error) {
+	resp, err := c.send(ctx, method, path)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource, ok := c.tokenSource.(invalidator)
+	if resp.StatusCode != http.StatusUnauthorized || !ok {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	tokenSource.Invalidate()
+
+	return c.send(ctx, method, path)
+}
+
+func (c *Client) send(ctx context.Context, method, path string) (*http.Response, error) {
+	token, err := c.tokenSource.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseUrl+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call auth server: %w", err)
+	}
+
+	return resp, nil
+}
+
+func statusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrInvalidArg
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	default:
+		return fmt.Errorf("unexpected auth server response status: %d", statusCode)
+	}
+}
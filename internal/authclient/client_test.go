@@ -0,0 +1,108 @@
+package authclient_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keola-dunn/autolog/internal/authclient"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTokenSource issues a new token after each invalidation
+type fakeTokenSource struct {
+	issued int
+}
+
+func (f *fakeTokenSource) Token(ctx context.Context) (string, error) {
+	if f.issued == 0 {
+		f.issued++
+	}
+	return fmt.Sprintf("token-%d", f.issued), nil
+}
+
+func (f *fakeTokenSource) Invalidate() {
+	f.issued++
+}
+
+func TestUserRoles(t *testing.T) {
+	roles := map[string]bool{}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer token-2":
+		case "Bearer token-1":
+			// the first token has been revoked
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if r.PathValue("role") != "mechanic" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		key := r.PathValue("userId") + "/" + r.PathValue("role")
+		if r.Method == http.MethodDelete {
+			if !roles[key] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(roles, key)
+		} else {
+			roles[key] = true
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /v1/internal/users/{userId}/roles/{role}", handler)
+	mux.HandleFunc("DELETE /v1/internal/users/{userId}/roles/{role}", handler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := authclient.NewClient(authclient.ClientConfig{
+		BaseUrl:     server.URL + "/",
+		TokenSource: &fakeTokenSource{},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	require.NoError(t, client.AddUserRole(ctx, "user-1", "mechanic"))
+	require.Equal(t, map[string]bool{"user-1/mechanic": true}, roles)
+
+	require.ErrorIs(t, client.AddUserRole(ctx, "user-1", "wizard"), authclient.ErrInvalidArg)
+	require.ErrorIs(t, client.AddUserRole(ctx, " ", "mechanic"), authclient.ErrInvalidArg)
+
+	require.NoError(t, client.RemoveUserRole(ctx, "user-1", "mechanic"))
+	require.Empty(t, roles)
+
+	require.ErrorIs(t, client.RemoveUserRole(ctx, "user-1", "mechanic"), authclient.ErrNotFound)
+
+	forbiddenClient, err := authclient.NewClient(authclient.ClientConfig{
+		BaseUrl:     server.URL,
+		TokenSource: &fakeTokenSource{issued: 5},
+	})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, forbiddenClient.AddUserRole(ctx, "user-1", "mechanic"), authclient.ErrUnauthorized)
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := authclient.NewClient(authclient.ClientConfig{
+		BaseUrl:     "not a url",
+		TokenSource: &fakeTokenSource{},
+	})
+	require.Error(t, err)
+
+	_, err = authclient.NewClient(authclient.ClientConfig{
+		BaseUrl: "http://auth",
+	})
+	require.Error(t, err)
+}
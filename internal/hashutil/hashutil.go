@@ -0,0 +1,14 @@
+package hashutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SHA256Hex hashes a secret for storage, ex. an opaque token. Only the hash is stored, so a
+// database leak doesn't leak usable secrets. The secret needs enough randomness that a fast hash
+// is fine, passwords don't.
+func SHA256Hex(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,13 @@
+package hashutil_test
+
+import (
+	"testing"
+
+	"github.com/keola-dunn/autolog/internal/hashutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSHA256Hex(t *testing.T) {
+	require.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", hashutil.SHA256Hex("hello"))
+	require.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", hashutil.SHA256Hex(""))
+}
@@ -0,0 +1,182 @@
+package imagesclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	ErrNotFound = errors.New("the requested resource was not found")
+
+	// ErrUnauthorized is returned when the images service rejects the service token, ex. it
+	// lacks the permission for the call
+	ErrUnauthorized = errors.New("the images service rejected the service token")
+)
+
+// TokenSource provides the service tokens the client authenticates with, ex.
+// serviceauth.TokenSource
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// invalidator is implemented by token sources that cache tokens, so a rejected token isn't
+// reused
+type invalidator interface {
+	Invalidate()
+}
+
+type ClientIface interface {
+	GetImage(ctx context.Context, imageId string) (Image, error)
+	DeleteUserImages(ctx context.Context, userId string) error
+}
+
+// Client calls the images service's internal routes as the calling service
+type Client struct {
+	baseUrl     string
+	tokenSource TokenSource
+	httpClient  *http.Client
+}
+
+type ClientConfig struct {
+	// BaseUrl is the images service's url, ex. http://images
+	BaseUrl string
+
+	TokenSource TokenSource
+
+	// HTTPClient defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+func NewClient(config ClientConfig) (*Client, error) {
+	if _, err := url.ParseRequestURI(config.BaseUrl); err != nil {
+		return nil, fmt.Errorf("invalid images service url: %w", err)
+	}
+
+	if config.TokenSource == nil {
+		return nil, errors.New("missing token source")
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	return &Client{
+		baseUrl:     strings.TrimSuffix(config.BaseUrl, "/"),
+		tokenSource: config.TokenSource,
+		httpClient:  config.HTTPClient,
+	}, nil
+}
+
+// Image is an image's metadata
+type Image struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"userId"`
+	Title     string    `json:"title"`
+	Width     int64     `json:"width"`
+	Height    int64     `json:"height"`
+	SizeKb    int64     `json:"sizeKb"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// GetImage gets an image's metadata. Returns ErrNotFound if it doesn't exist.
+func (c *Client) GetImage(ctx context.Context, imageId string) (Image, error) {
+	if strings.TrimSpace(imageId) == "" {
+		return Image{}, ErrInvalidArg
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/v1/internal/images/"+url.PathEscape(imageId))
+	if err != nil {
+		return Image{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Image{}, statusError(resp.StatusCode)
+	}
+
+	var i Image
+	if err := json.NewDecoder(resp.Body).Decode(&i); err != nil {
+		return Image{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	return i, nil
+}
+
+// DeleteUserImages removes every image the user uploaded
+func (c *Client) DeleteUserImages(ctx context.Context, userId string) error {
+	if strings.TrimSpace(userId) == "" {
+		return ErrInvalidArg
+	}
+
+	resp, err := c.do(ctx, http.MethodDelete, "/v1/internal/users/"+url.PathEscape(userId)+"/images")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return statusError(resp.StatusCode)
+	}
+
+	return nil
+}
+
+// do sends a request with a service token. A rejected token is dropped and the request retried
+// once with a new one, in case it was revoked or its signing key retired.
+func (c *Client) do(ctx context.Context, method, path string) (*http.Response, error) {
+	resp, err := c.send(ctx, method, path)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource, ok := c.tokenSource.(invalidator)
+	if resp.StatusCode != http.StatusUnauthorized || !ok {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	tokenSource.Invalidate()
+
+	return c.send(ctx, method, path)
+}
+
+func (c *Client) send(ctx context.Context, method, path string) (*http.Response, error) {
+	token, err := c.tokenSource.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseUrl+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call images service: %w", err)
+	}
+
+	return resp, nil
+}
+
+func statusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	default:
+		return fmt.Errorf("unexpected images service response status: %d", statusCode)
+	}
+}
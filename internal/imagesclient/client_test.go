@@ -0,0 +1,119 @@
+package imagesclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/imagesclient"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTokenSource issues a new token after each invalidation
+type fakeTokenSource struct {
+	issued int
+}
+
+func (f *fakeTokenSource) Token(ctx context.Context) (string, error) {
+	if f.issued == 0 {
+		f.issued++
+	}
+	return fmt.Sprintf("token-%d", f.issued), nil
+}
+
+func (f *fakeTokenSource) Invalidate() {
+	f.issued++
+}
+
+func TestGetImage(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/internal/images/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer token-2":
+		case "Bearer token-1":
+			// the first token has been revoked
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if r.PathValue("id") != "image-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(imagesclient.Image{
+			Id:        "image-1",
+			UserId:    "user-1",
+			Width:     640,
+			Height:    480,
+			CreatedAt: createdAt,
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := imagesclient.NewClient(imagesclient.ClientConfig{
+		BaseUrl:     server.URL,
+		TokenSource: &fakeTokenSource{},
+	})
+	require.NoError(t, err)
+
+	i, err := client.GetImage(context.Background(), "image-1")
+	require.NoError(t, err)
+	require.Equal(t, imagesclient.Image{
+		Id:        "image-1",
+		UserId:    "user-1",
+		Width:     640,
+		Height:    480,
+		CreatedAt: createdAt,
+	}, i)
+
+	_, err = client.GetImage(context.Background(), "image-2")
+	require.ErrorIs(t, err, imagesclient.ErrNotFound)
+
+	_, err = client.GetImage(context.Background(), " ")
+	require.ErrorIs(t, err, imagesclient.ErrInvalidArg)
+}
+
+func TestDeleteUserImages(t *testing.T) {
+	deleted := ""
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /v1/internal/users/{userId}/images", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		deleted = r.PathValue("userId")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := imagesclient.NewClient(imagesclient.ClientConfig{
+		BaseUrl:     server.URL + "/",
+		TokenSource: &fakeTokenSource{},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, client.DeleteUserImages(context.Background(), "user-1"))
+	require.Equal(t, "user-1", deleted)
+
+	forbiddenClient, err := imagesclient.NewClient(imagesclient.ClientConfig{
+		BaseUrl:     server.URL,
+		TokenSource: &fakeTokenSource{issued: 5},
+	})
+	require.NoError(t, err)
+
+	err = forbiddenClient.DeleteUserImages(context.Background(), "user-1")
+	require.ErrorIs(t, err, imagesclient.ErrUnauthorized)
+}
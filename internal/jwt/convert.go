@@ -2,6 +2,10 @@ package jwt
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"encoding/base64"
 	"fmt"
@@ -57,3 +61,46 @@ func ConvertJWKToPEM(ctx context.Context, j JWK) (*rsa.PublicKey, error) {
 
 	return nil, fmt.Errorf("unexpected error")
 }
+
+// ConvertPublicKeyToJWK converts an RSA, P-256 ECDSA or Ed25519 public key to a JWK for the
+// algorithm
+func ConvertPublicKeyToJWK(keyId, alg string, key crypto.PublicKey) (JWK, error) {
+	var j JWK
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		j, err = ConvertPublicKeyPEMToJWK(keyId, k)
+		if err != nil {
+			return JWK{}, err
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return JWK{}, fmt.Errorf("unsupported curve: %s", k.Curve.Params().Name)
+		}
+
+		// coordinates are padded to the curve size, https://datatracker.ietf.org/doc/html/rfc7518#section-6.2.1.2
+		j = JWK{
+			Kty: "EC",
+			KId: keyId,
+			Use: "sig",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, 32))),
+		}
+	case ed25519.PublicKey:
+		// https://datatracker.ietf.org/doc/html/rfc8037#section-2
+		j = JWK{
+			Kty: "OKP",
+			KId: keyId,
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}
+	default:
+		return JWK{}, fmt.Errorf("unsupported key type: %T", key)
+	}
+	j.Alg = alg
+
+	return j, nil
+}
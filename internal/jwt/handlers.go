@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strings"
@@ -11,68 +12,68 @@ import (
 )
 
 type AuthHandler struct {
-	jwtVerifier *TokenVerifier
+	jwtVerifier                 *TokenVerifier
+	personalAccessTokenVerifier PersonalAccessTokenVerifier
 }
 
 type AuthHandlerConfig struct {
 	// foundationals/platform
 	TokenVerifier *TokenVerifier
+
+	// PersonalAccessTokenVerifier is optional. Personal access tokens are rejected without it.
+	PersonalAccessTokenVerifier PersonalAccessTokenVerifier
 }
 
 func NewAuthHandler(config AuthHandlerConfig) (*AuthHandler, error) {
 	return &AuthHandler{
-		jwtVerifier: config.TokenVerifier,
+		jwtVerifier:                 config.TokenVerifier,
+		personalAccessTokenVerifier: config.PersonalAccessTokenVerifier,
 	}, nil
 }
 
-// RequireAuthentication is a middleware that requires the request to be authenticated
+// verifyToken verifies a bearer token, either a JWT or a personal access token
+func (a *AuthHandler) verifyToken(ctx context.Context, token string) (bool, AutologAPIJWTClaims, error) {
+	if IsPersonalAccessToken(token) {
+		if a.personalAccessTokenVerifier == nil {
+			return false, AutologAPIJWTClaims{}, nil
+		}
+		return a.personalAccessTokenVerifier.VerifyPersonalAccessToken(ctx, token)
+	}
+
+	return a.jwtVerifier.VerifyToken(ctx, token)
+}
+
+// RequireAuthentication is a middleware that requires the request to be authenticated by a user.
+// Service tokens are rejected, use RequireServiceAuthentication for service to service routes.
 func (a *AuthHandler) RequireTokenAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logEntry := logger.GetLogEntry(r)
-
-		authHeader := r.Header.Get("Authorization")
-		if strings.TrimSpace(authHeader) == "" {
-			logEntry.Warn("missing authentication header",
-				"referer", r.Header.Get("referer"),
-				"user-agent", r.Header.Get("user-agent"),
-				"x-forwarded-for", r.Header.Get("X-Forwarded-For"))
-			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		claims, ok := a.authenticate(w, r)
+		if !ok {
 			return
 		}
 
-		splitToken := strings.Split(authHeader, "Bearer ")
-		if len(splitToken) != 2 || !strings.Contains(authHeader, "Bearer") {
-			logEntry.Warn("invalid authentication header",
-				"header", authHeader,
-				"referer", r.Header.Get("referer"),
-				"user-agent", r.Header.Get("user-agent"),
-				"x-forwarded-for", r.Header.Get("X-Forwarded-For"))
-			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		if claims.IsServiceToken() {
+			httputil.RespondWithError(w, http.StatusForbidden, "")
 			return
 		}
 
-		token := splitToken[1]
+		r = r.WithContext(SetClaimsInContext(r.Context(), claims))
 
-		valid, claims, err := a.jwtVerifier.VerifyToken(token)
-		if err != nil {
-			if errors.Is(err, jwt.ErrTokenExpired) {
-				httputil.RespondWithError(w, http.StatusUnauthorized, "token expired")
-				return
-			}
+		next.ServeHTTP(w, r)
+	})
+}
 
-			logEntry.Error("failed to verify token", err)
-			httputil.RespondWithError(w, http.StatusInternalServerError, "")
+// RequireServiceAuthentication is a middleware that requires the request to be authenticated by
+// another autolog service, with a token from the client credentials grant
+func (a *AuthHandler) RequireServiceAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := a.authenticate(w, r)
+		if !ok {
 			return
 		}
-		if !valid {
-			// log failed auth attempts
-			logEntry.Warn("invalid token provided",
-				"token", token,
-				"referer", r.Header.Get("referer"),
-				"user-agent", r.Header.Get("user-agent"),
-				"x-forwarded-for", r.Header.Get("X-Forwarded-For"))
 
-			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		if !claims.IsServiceToken() {
+			httputil.RespondWithError(w, http.StatusForbidden, "")
 			return
 		}
 
@@ -82,6 +83,80 @@ func (a *AuthHandler) RequireTokenAuthentication(next http.Handler) http.Handler
 	})
 }
 
+// authenticate verifies the request's bearer token, responding with an error if it's missing or
+// invalid
+func (a *AuthHandler) authenticate(w http.ResponseWriter, r *http.Request) (AutologAPIJWTClaims, bool) {
+	logEntry := logger.GetLogEntry(r)
+
+	authHeader := r.Header.Get("Authorization")
+	if strings.TrimSpace(authHeader) == "" {
+		logEntry.Warn("missing authentication header",
+			"referer", r.Header.Get("referer"),
+			"user-agent", r.Header.Get("user-agent"),
+			"x-forwarded-for", r.Header.Get("X-Forwarded-For"))
+		httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		return AutologAPIJWTClaims{}, false
+	}
+
+	splitToken := strings.Split(authHeader, "Bearer ")
+	if len(splitToken) != 2 || !strings.Contains(authHeader, "Bearer") {
+		logEntry.Warn("invalid authentication header",
+			"header", authHeader,
+			"referer", r.Header.Get("referer"),
+			"user-agent", r.Header.Get("user-agent"),
+			"x-forwarded-for", r.Header.Get("X-Forwarded-For"))
+		httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		return AutologAPIJWTClaims{}, false
+	}
+
+	token := splitToken[1]
+
+	valid, claims, err := a.verifyToken(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			httputil.RespondWithError(w, http.StatusUnauthorized, "token expired")
+			return AutologAPIJWTClaims{}, false
+		}
+
+		if errors.Is(err, ErrTokenRevoked) {
+			httputil.RespondWithError(w, http.StatusUnauthorized, "token revoked")
+			return AutologAPIJWTClaims{}, false
+		}
+
+		if errors.Is(err, ErrNoVerificationKeys) {
+			logEntry.Error("no keys to verify token with", err)
+			httputil.RespondWithError(w, http.StatusServiceUnavailable, "")
+			return AutologAPIJWTClaims{}, false
+		}
+
+		if errors.Is(err, ErrInvalidIssuer) || errors.Is(err, ErrInvalidAudience) {
+			logEntry.Warn("token from another issuer or for another audience provided",
+				"referer", r.Header.Get("referer"),
+				"user-agent", r.Header.Get("user-agent"),
+				"x-forwarded-for", r.Header.Get("X-Forwarded-For"))
+			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+			return AutologAPIJWTClaims{}, false
+		}
+
+		logEntry.Error("failed to verify token", err)
+		httputil.RespondWithError(w, http.StatusInternalServerError, "")
+		return AutologAPIJWTClaims{}, false
+	}
+	if !valid {
+		// log failed auth attempts
+		logEntry.Warn("invalid token provided",
+			"token", token,
+			"referer", r.Header.Get("referer"),
+			"user-agent", r.Header.Get("user-agent"),
+			"x-forwarded-for", r.Header.Get("X-Forwarded-For"))
+
+		httputil.RespondWithError(w, http.StatusUnauthorized, "")
+		return AutologAPIJWTClaims{}, false
+	}
+
+	return claims, true
+}
+
 // OptionalAuthentication is a middleware that checks if a token is provided, and attaches it's claims
 // to the context if so
 func (a *AuthHandler) OptionalAuthentication(next http.Handler) http.Handler {
@@ -95,13 +170,29 @@ func (a *AuthHandler) OptionalAuthentication(next http.Handler) http.Handler {
 			if len(splitToken) == 2 && strings.Contains(authHeader, "Bearer") {
 				token := splitToken[1]
 
-				valid, claims, err := a.jwtVerifier.VerifyToken(token)
+				valid, claims, err := a.verifyToken(r.Context(), token)
 				if err != nil {
 					if errors.Is(err, jwt.ErrTokenExpired) {
 						httputil.RespondWithError(w, http.StatusUnauthorized, "token expired")
 						return
 					}
 
+					if errors.Is(err, ErrTokenRevoked) {
+						httputil.RespondWithError(w, http.StatusUnauthorized, "token revoked")
+						return
+					}
+
+					if errors.Is(err, ErrNoVerificationKeys) {
+						logEntry.Error("no keys to verify token with", err)
+						httputil.RespondWithError(w, http.StatusServiceUnavailable, "")
+						return
+					}
+
+					if errors.Is(err, ErrInvalidIssuer) || errors.Is(err, ErrInvalidAudience) {
+						httputil.RespondWithError(w, http.StatusUnauthorized, "")
+						return
+					}
+
 					logEntry.Error("failed to verify token", err)
 					httputil.RespondWithError(w, http.StatusInternalServerError, "")
 					return
@@ -119,6 +210,11 @@ func (a *AuthHandler) OptionalAuthentication(next http.Handler) http.Handler {
 					return
 				}
 
+				if claims.IsServiceToken() {
+					httputil.RespondWithError(w, http.StatusForbidden, "")
+					return
+				}
+
 				r = r.WithContext(SetClaimsInContext(r.Context(), claims))
 			}
 		}
@@ -126,3 +222,68 @@ func (a *AuthHandler) OptionalAuthentication(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireVerifiedEmail is a middleware that requires the authenticated user to have verified
+// their email address. It must be used after RequireTokenAuthentication.
+func (a *AuthHandler) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := GetClaimsFromContext(r.Context())
+		if !ok {
+			httputil.RespondWithError(w, http.StatusUnauthorized, "")
+			return
+		}
+
+		if !claims.EmailVerified {
+			httputil.RespondWithError(w, http.StatusForbidden, "email address must be verified")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole is a middleware that requires the authenticated user to hold one of the roles. It
+// must be used after RequireTokenAuthentication.
+func (a *AuthHandler) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaimsFromContext(r.Context())
+			if !ok {
+				httputil.RespondWithError(w, http.StatusUnauthorized, "")
+				return
+			}
+
+			for _, role := range roles {
+				if claims.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			httputil.RespondWithError(w, http.StatusForbidden, "")
+		})
+	}
+}
+
+// RequirePermission is a middleware that requires the token to grant every one of the
+// permissions. It must be used after RequireTokenAuthentication.
+func (a *AuthHandler) RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaimsFromContext(r.Context())
+			if !ok {
+				httputil.RespondWithError(w, http.StatusUnauthorized, "")
+				return
+			}
+
+			for _, permission := range permissions {
+				if !claims.HasPermission(permission) {
+					httputil.RespondWithError(w, http.StatusForbidden, "")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package jwt_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	verifier, err := autologjwt.NewStaticTokenVerifier(autologjwt.StaticTokenVerifierConfig{
+		PublicKey: &privateKey.PublicKey,
+	})
+	require.NoError(t, err)
+
+	authHandler, err := autologjwt.NewAuthHandler(autologjwt.AuthHandlerConfig{
+		TokenVerifier: verifier,
+	})
+	require.NoError(t, err)
+
+	handler := authHandler.RequireTokenAuthentication(authHandler.RequireVerifiedEmail(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
+
+	now := time.Now()
+	createToken := func(emailVerified bool) string {
+		token, err := autologjwt.CreateJWT(autologjwt.CreateJWTInput{
+			Issuer:        "auth-api",
+			UserId:        "user-1",
+			IssuedAt:      now,
+			ExpiresAt:     now.Add(time.Hour),
+			NotBefore:     now,
+			Id:            "token-id",
+			EmailVerified: emailVerified,
+			PrivateKey:    privateKey,
+		})
+		require.NoError(t, err)
+		return token
+	}
+
+	tests := []struct {
+		name           string
+		emailVerified  bool
+		expectedStatus int
+	}{
+		{
+			name:           "Unverified",
+			emailVerified:  false,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Verified",
+			emailVerified:  true,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+createToken(test.emailVerified))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestRequireRoleAndPermission(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	verifier, err := autologjwt.NewStaticTokenVerifier(autologjwt.StaticTokenVerifierConfig{
+		PublicKey: &privateKey.PublicKey,
+	})
+	require.NoError(t, err)
+
+	authHandler, err := autologjwt.NewAuthHandler(autologjwt.AuthHandlerConfig{
+		TokenVerifier: verifier,
+	})
+	require.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	now := time.Now()
+	createToken := func(roles, permissions []string) string {
+		token, err := autologjwt.CreateJWT(autologjwt.CreateJWTInput{
+			Issuer:      "auth-api",
+			UserId:      "user-1",
+			IssuedAt:    now,
+			ExpiresAt:   now.Add(time.Hour),
+			NotBefore:   now,
+			Id:          "token-id",
+			Roles:       roles,
+			Permissions: permissions,
+			PrivateKey:  privateKey,
+		})
+		require.NoError(t, err)
+		return token
+	}
+
+	tests := []struct {
+		name           string
+		middleware     func(http.Handler) http.Handler
+		roles          []string
+		permissions    []string
+		expectedStatus int
+	}{
+		{
+			name:           "RoleHeld",
+			middleware:     authHandler.RequireRole("admin", "mechanic"),
+			roles:          []string{"user", "mechanic"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "RoleMissing",
+			middleware:     authHandler.RequireRole("admin"),
+			roles:          []string{"user"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "NoRoles",
+			middleware:     authHandler.RequireRole("admin"),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "AllPermissionsGranted",
+			middleware:     authHandler.RequirePermission("cars:read", "cars:write"),
+			permissions:    []string{"cars:read", "cars:write", "images:write"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OnePermissionMissing",
+			middleware:     authHandler.RequirePermission("cars:read", "cars:admin"),
+			permissions:    []string{"cars:read", "cars:write"},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := authHandler.RequireTokenAuthentication(test.middleware(ok))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+createToken(test.roles, test.permissions))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestRequireServiceAuthentication(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	verifier, err := autologjwt.NewStaticTokenVerifier(autologjwt.StaticTokenVerifierConfig{
+		PublicKey: &privateKey.PublicKey,
+		Audience:  "images",
+	})
+	require.NoError(t, err)
+
+	authHandler, err := autologjwt.NewAuthHandler(autologjwt.AuthHandlerConfig{
+		TokenVerifier: verifier,
+	})
+	require.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	now := time.Now()
+	createToken := func(subject, clientId string, audience []string) string {
+		token, err := autologjwt.CreateJWT(autologjwt.CreateJWTInput{
+			Issuer:     "auth-api",
+			UserId:     subject,
+			Audience:   audience,
+			IssuedAt:   now,
+			ExpiresAt:  now.Add(time.Hour),
+			NotBefore:  now,
+			Id:         "token-id",
+			ClientId:   clientId,
+			PrivateKey: privateKey,
+		})
+		require.NoError(t, err)
+		return token
+	}
+
+	serviceToken := createToken("autolog-api-client", "autolog-api-client", []string{"images"})
+	userToken := createToken("user-1", "", []string{"autolog-api", "images"})
+
+	tests := []struct {
+		name           string
+		middleware     func(http.Handler) http.Handler
+		token          string
+		expectedStatus int
+	}{
+		{
+			name:           "ServiceToken",
+			middleware:     authHandler.RequireServiceAuthentication,
+			token:          serviceToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "UserTokenOnServiceRoute",
+			middleware:     authHandler.RequireServiceAuthentication,
+			token:          userToken,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "ServiceTokenOnUserRoute",
+			middleware:     authHandler.RequireTokenAuthentication,
+			token:          serviceToken,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "UserToken",
+			middleware:     authHandler.RequireTokenAuthentication,
+			token:          userToken,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OtherAudience",
+			middleware:     authHandler.RequireServiceAuthentication,
+			token:          createToken("autolog-api-client", "autolog-api-client", []string{"autolog-api"}),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "NoAudience",
+			middleware:     authHandler.RequireTokenAuthentication,
+			token:          createToken("user-1", "", nil),
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+
+			rec := httptest.NewRecorder()
+			test.middleware(ok).ServeHTTP(rec, req)
+
+			require.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+}
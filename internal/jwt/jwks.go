@@ -50,10 +50,19 @@ type JWK struct {
 	X5c []string `json:"x5c"`
 
 	// The modulus for the RSA public key.
-	N string `json:"n"`
+	N string `json:"n,omitempty"`
 
 	// The exponent for the RSA public key.
-	E string `json:"e"`
+	E string `json:"e,omitempty"`
+
+	// The curve of EC and OKP public keys. Ex. "P-256" or "Ed25519"
+	Crv string `json:"crv,omitempty"`
+
+	// The x coordinate of EC public keys, or the OKP public key.
+	X string `json:"x,omitempty"`
+
+	// The y coordinate of EC public keys.
+	Y string `json:"y,omitempty"`
 
 	// The unique identifier for the key.
 	KId string `json:"kid"`
@@ -0,0 +1,324 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrNoVerificationKeys is returned when the verifier has no keys yet, ex. the auth server
+	// has been unreachable since startup and there's no cached JWKS
+	ErrNoVerificationKeys = errors.New("no token verification keys are available")
+)
+
+// Where a verifier's keys come from
+const (
+	// JWKSSourceRemote keys are fetched from the auth server's JWKS url
+	JWKSSourceRemote = "remote"
+
+	// JWKSSourceFile keys are read once from a JWKS file, for deployments that can't reach the
+	// auth server
+	JWKSSourceFile = "file"
+)
+
+// JWKSHealth is how fresh a verifier's keys are
+type JWKSHealth struct {
+	Source   string `json:"source"`
+	KeyCount int    `json:"keyCount"`
+
+	// FetchedAt is when the keys were fetched from the auth server, or written to the disk cache
+	// or file they were read from
+	FetchedAt *time.Time `json:"fetchedAt"`
+
+	// LastRefreshAt and LastRefreshError are from the latest attempt to fetch the keys
+	LastRefreshAt    *time.Time `json:"lastRefreshAt,omitempty"`
+	LastRefreshError string     `json:"lastRefreshError,omitempty"`
+
+	// Stale is true once remote keys haven't been fetched for longer than the verifier's stale
+	// after. Tokens are still verified with them, but keys rotated in since will be missing.
+	Stale bool `json:"stale"`
+}
+
+// jwksCache holds the keys tokens are verified with. Remote keys are refreshed in the background
+// and when a token is signed by an unknown key. The last known keys are kept while the auth
+// server can't be reached, and written to disk so restarts don't depend on it either.
+type jwksCache struct {
+	source     string
+	url        string
+	cachePath  string
+	httpClient *http.Client
+
+	// unknownKeyRefreshInterval limits refreshes for unknown keys, so tokens with made up key
+	// ids can't flood the auth server
+	unknownKeyRefreshInterval time.Duration
+	staleAfter                time.Duration
+
+	now func() time.Time
+
+	// refreshMu serializes fetches
+	refreshMu sync.Mutex
+
+	mu               sync.RWMutex
+	keyfunc          keyfunc.Keyfunc
+	keyIds           []string
+	fetchedAt        time.Time
+	lastRefreshAt    time.Time
+	lastRefreshError error
+
+	unknownKeyRefreshAt time.Time
+}
+
+type remoteJWKSCacheConfig struct {
+	url        string
+	cachePath  string
+	httpClient *http.Client
+
+	refreshInterval time.Duration
+	staleAfter      time.Duration
+}
+
+// newRemoteJWKSCache loads the disk cache, if there is one, and fetches the keys. Startup
+// doesn't fail if the auth server is down, the cached keys are used until it's back.
+func newRemoteJWKSCache(ctx context.Context, config remoteJWKSCacheConfig) *jwksCache {
+	c := &jwksCache{
+		source:                    JWKSSourceRemote,
+		url:                       config.url,
+		cachePath:                 config.cachePath,
+		httpClient:                config.httpClient,
+		staleAfter:                config.staleAfter,
+		unknownKeyRefreshInterval: 30 * time.Second,
+		now:                       time.Now,
+	}
+
+	if c.cachePath != "" {
+		// a missing or corrupt cache only means waiting on the auth server
+		_ = c.loadFile(c.cachePath)
+	}
+
+	_ = c.refresh(ctx)
+
+	go c.poll(ctx, config.refreshInterval)
+
+	return c
+}
+
+// newFileJWKSCache reads the keys from a JWKS file. They are never refreshed.
+func newFileJWKSCache(path string) (*jwksCache, error) {
+	c := &jwksCache{
+		source: JWKSSourceFile,
+		now:    time.Now,
+	}
+
+	if err := c.loadFile(path); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *jwksCache) poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = c.refresh(ctx)
+		}
+	}
+}
+
+// Keyfunc finds the key a token was signed with. Tokens signed by a key the cache doesn't know
+// trigger a refresh, the auth server may have rotated keys since the last one.
+func (c *jwksCache) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	c.mu.Lock()
+	kf, known := c.keyfunc, slices.Contains(c.keyIds, kid)
+	refresh := !known && c.source == JWKSSourceRemote &&
+		c.now().Sub(c.unknownKeyRefreshAt) >= c.unknownKeyRefreshInterval
+	if refresh {
+		c.unknownKeyRefreshAt = c.now()
+	}
+	c.mu.Unlock()
+
+	if refresh {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := c.refresh(ctx); err == nil {
+			c.mu.RLock()
+			kf = c.keyfunc
+			c.mu.RUnlock()
+		}
+	}
+
+	if kf == nil {
+		return nil, ErrNoVerificationKeys
+	}
+
+	return kf.Keyfunc(token)
+}
+
+// refresh fetches the keys from the auth server. The current keys are kept if it fails.
+func (c *jwksCache) refresh(ctx context.Context) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	raw, err := c.fetch(ctx)
+	if err == nil {
+		err = c.setKeys(raw, c.now())
+	}
+
+	// the fetched keys are in use even if caching them fails, the error is still reported
+	if err == nil && c.cachePath != "" {
+		err = writeFileAtomic(c.cachePath, raw)
+	}
+
+	c.mu.Lock()
+	c.lastRefreshAt = c.now()
+	c.lastRefreshError = err
+	c.mu.Unlock()
+
+	return err
+}
+
+func (c *jwksCache) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jwks request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected jwks response status: %d", resp.StatusCode)
+	}
+
+	// a JWKS is a handful of keys, anything near this is not one
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks: %w", err)
+	}
+
+	return raw, nil
+}
+
+// loadFile reads keys from a JWKS file, a disk cache or a static file. They're as fresh as the
+// file.
+func (c *jwksCache) loadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks file: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat jwks file: %w", err)
+	}
+
+	return c.setKeys(raw, info.ModTime())
+}
+
+// setKeys replaces the keys with the JWKS. A JWKS without keys, or that can't be parsed, is
+// rejected so a bad response can't wipe out the last known keys.
+func (c *jwksCache) setKeys(raw []byte, fetchedAt time.Time) error {
+	var jwks JWKS
+	if err := json.Unmarshal(raw, &jwks); err != nil {
+		return fmt.Errorf("failed to unmarshal jwks: %w", err)
+	}
+
+	if len(jwks.Keys) == 0 {
+		return errors.New("jwks has no keys")
+	}
+
+	kf, err := keyfunc.NewJWKSetJSON(raw)
+	if err != nil {
+		return fmt.Errorf("failed to parse jwks: %w", err)
+	}
+
+	keyIds := make([]string, 0, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		keyIds = append(keyIds, key.KId)
+	}
+
+	c.mu.Lock()
+	c.keyfunc = kf
+	c.keyIds = keyIds
+	c.fetchedAt = fetchedAt
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *jwksCache) health() JWKSHealth {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	health := JWKSHealth{
+		Source:   c.source,
+		KeyCount: len(c.keyIds),
+	}
+
+	if !c.fetchedAt.IsZero() {
+		fetchedAt := c.fetchedAt
+		health.FetchedAt = &fetchedAt
+	}
+
+	if !c.lastRefreshAt.IsZero() {
+		lastRefreshAt := c.lastRefreshAt
+		health.LastRefreshAt = &lastRefreshAt
+	}
+
+	if c.lastRefreshError != nil {
+		health.LastRefreshError = c.lastRefreshError.Error()
+	}
+
+	if c.source == JWKSSourceRemote {
+		health.Stale = c.fetchedAt.IsZero() || c.now().Sub(c.fetchedAt) > c.staleAfter
+	}
+
+	return health
+}
+
+// writeFileAtomic writes the file through a temp file, so a crash can't leave a partial cache
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create jwks cache temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write jwks cache: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close jwks cache temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace jwks cache: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,379 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+type jwksServer struct {
+	*httptest.Server
+	jwks autologjwt.JWKS
+	down atomic.Bool
+}
+
+func newJWKSServer(t *testing.T, jwks autologjwt.JWKS) *jwksServer {
+	s := &jwksServer{jwks: jwks}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(s.jwks)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestKey(t *testing.T, kid string) (*rsa.PrivateKey, autologjwt.JWKS) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwk, err := autologjwt.ConvertPublicKeyPEMToJWK(kid, &privateKey.PublicKey)
+	require.NoError(t, err)
+
+	return privateKey, autologjwt.JWKS{Keys: []autologjwt.JWK{jwk}}
+}
+
+func createTestToken(t *testing.T, privateKey *rsa.PrivateKey, kid string) string {
+	now := time.Now()
+	token, err := autologjwt.CreateJWT(autologjwt.CreateJWTInput{
+		Issuer:     "auth-api",
+		UserId:     "user-1",
+		Audience:   []string{"autolog-api"},
+		IssuedAt:   now,
+		ExpiresAt:  now.Add(time.Hour),
+		NotBefore:  now,
+		Id:         "token-id",
+		KeyId:      kid,
+		PrivateKey: privateKey,
+	})
+	require.NoError(t, err)
+	return token
+}
+
+func TestNewTokenVerifier(t *testing.T) {
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+
+	tests := []struct {
+		name   string
+		config autologjwt.TokenVerifierConfig
+	}{
+		{
+			name: "missing issuer",
+			config: autologjwt.TokenVerifierConfig{
+				JWKSUrl:  "http://auth/.well-known/jwks.json",
+				Audience: "autolog-api",
+			},
+		},
+		{
+			name: "missing audience",
+			config: autologjwt.TokenVerifierConfig{
+				JWKSUrl: "http://auth/.well-known/jwks.json",
+				Issuer:  "auth-api",
+			},
+		},
+		{
+			name: "missing jwks",
+			config: autologjwt.TokenVerifierConfig{
+				Issuer:   "auth-api",
+				Audience: "autolog-api",
+			},
+		},
+		{
+			name: "jwks url and file",
+			config: autologjwt.TokenVerifierConfig{
+				JWKSUrl:  "http://auth/.well-known/jwks.json",
+				JWKSFile: jwksFile,
+				Issuer:   "auth-api",
+				Audience: "autolog-api",
+			},
+		},
+		{
+			name: "missing jwks file",
+			config: autologjwt.TokenVerifierConfig{
+				JWKSFile: jwksFile,
+				Issuer:   "auth-api",
+				Audience: "autolog-api",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := autologjwt.NewTokenVerifier(context.Background(), test.config)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestTokenVerifierClaims(t *testing.T) {
+	privateKey, jwks := newTestKey(t, "test-key")
+	server := newJWKSServer(t, jwks)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := autologjwt.NewTokenVerifier(ctx, autologjwt.TokenVerifierConfig{
+		JWKSUrl:  server.URL,
+		Issuer:   "auth-api",
+		Audience: "autolog-api",
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	tests := []struct {
+		name          string
+		claims        jwt.RegisteredClaims
+		expectedError error
+	}{
+		{
+			name: "valid",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "auth-api",
+				Audience:  jwt.ClaimStrings{"autolog-api"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		},
+		{
+			name: "one of several audiences",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "auth-api",
+				Audience:  jwt.ClaimStrings{"images", "autolog-api"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		},
+		{
+			name: "expired within leeway",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "auth-api",
+				Audience:  jwt.ClaimStrings{"autolog-api"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(-10 * time.Second)),
+			},
+		},
+		{
+			name: "not before within leeway",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "auth-api",
+				Audience:  jwt.ClaimStrings{"autolog-api"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				NotBefore: jwt.NewNumericDate(now.Add(10 * time.Second)),
+			},
+		},
+		{
+			name: "expired",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "auth-api",
+				Audience:  jwt.ClaimStrings{"autolog-api"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(-time.Minute)),
+			},
+			expectedError: jwt.ErrTokenExpired,
+		},
+		{
+			name: "wrong issuer",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "someone-else",
+				Audience:  jwt.ClaimStrings{"autolog-api"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			expectedError: autologjwt.ErrInvalidIssuer,
+		},
+		{
+			name: "missing issuer",
+			claims: jwt.RegisteredClaims{
+				Audience:  jwt.ClaimStrings{"autolog-api"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			expectedError: autologjwt.ErrInvalidIssuer,
+		},
+		{
+			name: "wrong audience",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "auth-api",
+				Audience:  jwt.ClaimStrings{"images"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			expectedError: autologjwt.ErrInvalidAudience,
+		},
+		{
+			name: "missing audience",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "auth-api",
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			expectedError: autologjwt.ErrInvalidAudience,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, test.claims)
+			token.Header["kid"] = "test-key"
+			tokenString, err := token.SignedString(privateKey)
+			require.NoError(t, err)
+
+			valid, _, err := verifier.VerifyToken(ctx, tokenString)
+			if test.expectedError != nil {
+				require.ErrorIs(t, err, test.expectedError)
+				require.False(t, valid)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, valid)
+		})
+	}
+
+	t.Run("missing expiry", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{
+			Issuer:   "auth-api",
+			Audience: jwt.ClaimStrings{"autolog-api"},
+		})
+		token.Header["kid"] = "test-key"
+		tokenString, err := token.SignedString(privateKey)
+		require.NoError(t, err)
+
+		valid, _, err := verifier.VerifyToken(ctx, tokenString)
+		require.Error(t, err)
+		require.False(t, valid)
+	})
+}
+
+func TestTokenVerifierLastKnownKeys(t *testing.T) {
+	privateKey, jwks := newTestKey(t, "test-key")
+	server := newJWKSServer(t, jwks)
+	cachePath := filepath.Join(t.TempDir(), "jwks.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := autologjwt.TokenVerifierConfig{
+		JWKSUrl:       server.URL,
+		JWKSCachePath: cachePath,
+		Issuer:        "auth-api",
+		Audience:      "autolog-api",
+	}
+
+	verifier, err := autologjwt.NewTokenVerifier(ctx, config)
+	require.NoError(t, err)
+
+	token := createTestToken(t, privateKey, "test-key")
+
+	valid, _, err := verifier.VerifyToken(ctx, token)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	server.down.Store(true)
+
+	// an unknown key makes the verifier refresh, which fails, the known keys are kept
+	otherKey, _ := newTestKey(t, "other-key")
+	_, _, err = verifier.VerifyToken(ctx, createTestToken(t, otherKey, "other-key"))
+	require.Error(t, err)
+
+	valid, _, err = verifier.VerifyToken(ctx, token)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	health, ok := verifier.JWKSHealth()
+	require.True(t, ok)
+	require.Equal(t, 1, health.KeyCount)
+	require.NotEmpty(t, health.LastRefreshError)
+	require.False(t, health.Stale)
+
+	// a restart while the auth server is down uses the disk cache
+	restarted, err := autologjwt.NewTokenVerifier(ctx, config)
+	require.NoError(t, err)
+
+	valid, _, err = restarted.VerifyToken(ctx, token)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	health, ok = restarted.JWKSHealth()
+	require.True(t, ok)
+	require.Equal(t, autologjwt.JWKSSourceRemote, health.Source)
+	require.Equal(t, 1, health.KeyCount)
+	require.NotNil(t, health.FetchedAt)
+	require.NotEmpty(t, health.LastRefreshError)
+}
+
+func TestTokenVerifierNoKeys(t *testing.T) {
+	privateKey, jwks := newTestKey(t, "test-key")
+	server := newJWKSServer(t, jwks)
+	server.down.Store(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := autologjwt.NewTokenVerifier(ctx, autologjwt.TokenVerifierConfig{
+		JWKSUrl:             server.URL,
+		JWKSRefreshInterval: 10 * time.Millisecond,
+		Issuer:              "auth-api",
+		Audience:            "autolog-api",
+	})
+	require.NoError(t, err)
+
+	token := createTestToken(t, privateKey, "test-key")
+
+	_, _, err = verifier.VerifyToken(ctx, token)
+	require.ErrorIs(t, err, autologjwt.ErrNoVerificationKeys)
+
+	w := httptest.NewRecorder()
+	verifier.JWKSHealthHandler(w, httptest.NewRequest(http.MethodGet, "/health/jwks", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var health autologjwt.JWKSHealth
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&health))
+	require.Equal(t, 0, health.KeyCount)
+	require.True(t, health.Stale)
+	require.Nil(t, health.FetchedAt)
+
+	server.down.Store(false)
+
+	require.Eventually(t, func() bool {
+		valid, _, err := verifier.VerifyToken(ctx, token)
+		return err == nil && valid
+	}, time.Second, 10*time.Millisecond)
+
+	w = httptest.NewRecorder()
+	verifier.JWKSHealthHandler(w, httptest.NewRequest(http.MethodGet, "/health/jwks", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTokenVerifierJWKSFile(t *testing.T) {
+	privateKey, jwks := newTestKey(t, "test-key")
+
+	raw, err := json.Marshal(jwks)
+	require.NoError(t, err)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, raw, 0o600))
+
+	verifier, err := autologjwt.NewTokenVerifier(context.Background(), autologjwt.TokenVerifierConfig{
+		JWKSFile: jwksFile,
+		Issuer:   "auth-api",
+		Audience: "autolog-api",
+	})
+	require.NoError(t, err)
+
+	valid, claims, err := verifier.VerifyToken(context.Background(), createTestToken(t, privateKey, "test-key"))
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.Equal(t, "user-1", claims.GetUserId())
+
+	health, ok := verifier.JWKSHealth()
+	require.True(t, ok)
+	require.Equal(t, autologjwt.JWKSSourceFile, health.Source)
+	require.Equal(t, 1, health.KeyCount)
+	require.False(t, health.Stale)
+}
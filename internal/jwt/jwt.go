@@ -1,15 +1,26 @@
 package jwt
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+func init() {
+	// user revocations cut off at the millisecond the user's tokens were revoked, issued at
+	// needs the same precision so a token issued right after a revocation isn't revoked with it
+	jwt.TimePrecision = time.Millisecond
+}
+
 func GetTokenFromAuthHeader(authHeader string) string {
 	if strings.TrimSpace(authHeader) == "" {
 		return ""
@@ -25,12 +36,41 @@ func GetTokenFromAuthHeader(authHeader string) string {
 
 type AutologAPIJWTClaims struct {
 	jwt.RegisteredClaims
+
+	// EmailVerified is true once the user has proven they own their email address
+	EmailVerified bool `json:"email_verified,omitempty"`
+
+	// ClientId and Scope are set for tokens issued to OAuth clients, RFC 9068. Tokens from the
+	// auth server's own logins have neither and aren't limited by scope.
+	ClientId string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+
+	// Roles and Permissions are what the user held when the token was issued. Permissions are
+	// derived from the roles by the auth server's permission matrix.
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
 }
 
 func (a *AutologAPIJWTClaims) GetUserId() string {
 	return a.Subject
 }
 
+// IsServiceToken checks if the token was issued to a service with the client credentials grant.
+// Service tokens act for the service itself, their subject is the client id rather than a user.
+func (a *AutologAPIJWTClaims) IsServiceToken() bool {
+	return a.ClientId != "" && a.Subject == a.ClientId
+}
+
+// HasRole checks if the token's user holds the role
+func (a *AutologAPIJWTClaims) HasRole(role string) bool {
+	return slices.Contains(a.Roles, role)
+}
+
+// HasPermission checks if the token grants the permission
+func (a *AutologAPIJWTClaims) HasPermission(permission string) bool {
+	return slices.Contains(a.Permissions, permission)
+}
+
 type VerifyTokenInput struct {
 	TokenString string
 
@@ -66,9 +106,13 @@ type CreateJWTInput struct {
 	// Issuer is the service that created and issued the token
 	Issuer string
 
-	// UserId is the ID of the user whose token this is. This will be the token subject.
+	// UserId is the ID of the user whose token this is. This will be the token subject. Service
+	// tokens use their client id.
 	UserId string
 
+	// Audience are the services the token may be used with
+	Audience []string
+
 	// IssuedAt is when the token was created
 	IssuedAt time.Time
 
@@ -81,15 +125,31 @@ type CreateJWTInput struct {
 	// Id is the ID of the token
 	Id string
 
-	// TokenSecret is the private key used to sign the token. This is not a public value.
-	PrivateKey []byte
+	// EmailVerified is whether the user has verified their email address
+	EmailVerified bool
+
+	// ClientId and Scope are the OAuth client the token is issued to and the space separated
+	// scopes it was granted. Empty for the auth server's own logins.
+	ClientId string
+	Scope    string
+
+	// Roles and Permissions are the user's roles and the permissions they grant
+	Roles       []string
+	Permissions []string
+
+	// KeyId identifies the signing key in the JWKS, so verifiers can find it
+	KeyId string
+
+	// PrivateKey signs the token with RS256, ES256 or EdDSA depending on its type. This is not
+	// a public value.
+	PrivateKey crypto.Signer
 }
 
 func CreateJWT(input CreateJWTInput) (string, error) {
 	claims := jwt.RegisteredClaims{
 		Issuer:    input.Issuer,
 		Subject:   input.UserId,
-		Audience:  jwt.ClaimStrings{}, // app specific keys indicating what the JWT is intended to be used by
+		Audience:  jwt.ClaimStrings(input.Audience),
 		ExpiresAt: jwt.NewNumericDate(input.ExpiresAt),
 		NotBefore: jwt.NewNumericDate(input.NotBefore),
 		IssuedAt:  jwt.NewNumericDate(input.IssuedAt),
@@ -98,18 +158,43 @@ func CreateJWT(input CreateJWTInput) (string, error) {
 
 	myClaims := AutologAPIJWTClaims{
 		RegisteredClaims: claims,
+		EmailVerified:    input.EmailVerified,
+		ClientId:         input.ClientId,
+		Scope:            input.Scope,
+		Roles:            input.Roles,
+		Permissions:      input.Permissions,
 	}
 
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(input.PrivateKey)
+	signingMethod, err := SigningMethodForKey(input.PrivateKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse private key: %w", err)
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, myClaims)
+	token := jwt.NewWithClaims(signingMethod, myClaims)
+	if input.KeyId != "" {
+		token.Header["kid"] = input.KeyId
+	}
 
-	jwtToken, err := token.SignedString(privateKey)
+	jwtToken, err := token.SignedString(input.PrivateKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign jwt: %w", err)
 	}
 	return jwtToken, nil
 }
+
+// SigningMethodForKey is the signing method for an RSA, P-256 ECDSA or Ed25519 private key
+func SigningMethodForKey(privateKey crypto.Signer) (jwt.SigningMethod, error) {
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported curve: %s", k.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type: %T", privateKey)
+	}
+}
@@ -0,0 +1,242 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, so they can be told apart from
+// JWTs without a lookup
+const PersonalAccessTokenPrefix = "alpat_"
+
+// IsPersonalAccessToken checks if the bearer token is a personal access token
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// PersonalAccessTokenVerifier verifies personal access tokens. The claims are the token's user,
+// with the permissions the token's scopes grant.
+type PersonalAccessTokenVerifier interface {
+	VerifyPersonalAccessToken(ctx context.Context, token string) (bool, AutologAPIJWTClaims, error)
+}
+
+// introspectionResponse is the subset of the auth server's RFC 7662 response the verifier uses
+type introspectionResponse struct {
+	Active        bool   `json:"active"`
+	Subject       string `json:"sub"`
+	Issuer        string `json:"iss"`
+	TokenId       string `json:"jti"`
+	ExpiresAt     int64  `json:"exp"`
+	IssuedAt      int64  `json:"iat"`
+	Scope         string `json:"scope"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// introspectionResult is a cached introspection of a token
+type introspectionResult struct {
+	active bool
+	claims AutologAPIJWTClaims
+
+	cachedUntil time.Time
+}
+
+// TokenSource provides the service tokens introspection requests authenticate with, ex.
+// serviceauth.TokenSource. The service client needs the tokens:introspect permission.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// invalidator is implemented by token sources that cache tokens, so a rejected token isn't
+// reused
+type invalidator interface {
+	Invalidate()
+}
+
+// IntrospectionVerifier verifies personal access tokens with the auth server's introspection
+// endpoint, authenticating as the calling service.
+type IntrospectionVerifier struct {
+	introspectionUrl string
+	tokenSource      TokenSource
+	httpClient       *http.Client
+	cacheLength      time.Duration
+
+	mu    sync.Mutex
+	cache map[string]introspectionResult
+}
+
+type IntrospectionVerifierConfig struct {
+	// IntrospectionUrl is the auth server's introspection endpoint, ex. http://auth/v1/oauth/introspect
+	IntrospectionUrl string
+
+	TokenSource TokenSource
+
+	// CacheLength is how long an introspection is reused for, defaults to 30 seconds. A revoked
+	// token can keep working for this long.
+	CacheLength time.Duration
+
+	// HTTPClient defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+func NewIntrospectionVerifier(config IntrospectionVerifierConfig) (*IntrospectionVerifier, error) {
+	if _, err := url.ParseRequestURI(config.IntrospectionUrl); err != nil {
+		return nil, fmt.Errorf("invalid introspection url: %w", err)
+	}
+
+	if config.TokenSource == nil {
+		return nil, errors.New("missing token source")
+	}
+
+	if config.CacheLength <= 0 {
+		config.CacheLength = 30 * time.Second
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	return &IntrospectionVerifier{
+		introspectionUrl: config.IntrospectionUrl,
+		tokenSource:      config.TokenSource,
+		httpClient:       config.HTTPClient,
+		cacheLength:      config.CacheLength,
+		cache:            make(map[string]introspectionResult),
+	}, nil
+}
+
+// VerifyPersonalAccessToken introspects the token, or reuses a recent introspection. Inactive
+// tokens, including expired and revoked ones, aren't valid.
+func (v *IntrospectionVerifier) VerifyPersonalAccessToken(ctx context.Context, token string) (bool, AutologAPIJWTClaims, error) {
+	// the cache is keyed by a hash so usable tokens aren't kept in memory
+	key := hashutil.SHA256Hex(token)
+
+	now := time.Now()
+
+	v.mu.Lock()
+	result, ok := v.cache[key]
+	v.mu.Unlock()
+
+	if !ok || !now.Before(result.cachedUntil) {
+		var err error
+		result, err = v.introspect(ctx, token)
+		if err != nil {
+			return false, AutologAPIJWTClaims{}, err
+		}
+		result.cachedUntil = now.Add(v.cacheLength)
+
+		v.mu.Lock()
+		for k, r := range v.cache {
+			if !now.Before(r.cachedUntil) {
+				delete(v.cache, k)
+			}
+		}
+		v.cache[key] = result
+		v.mu.Unlock()
+	}
+
+	if !result.active {
+		return false, AutologAPIJWTClaims{}, nil
+	}
+
+	if result.claims.ExpiresAt != nil && !now.Before(result.claims.ExpiresAt.Time) {
+		return false, result.claims, jwt.ErrTokenExpired
+	}
+
+	return true, result.claims, nil
+}
+
+func (v *IntrospectionVerifier) introspect(ctx context.Context, token string) (introspectionResult, error) {
+	resp, err := v.send(ctx, token)
+	if err != nil {
+		return introspectionResult{}, err
+	}
+
+	// a rejected service token is dropped and the request retried once with a new one, in case
+	// it was revoked or its signing key retired
+	if tokenSource, ok := v.tokenSource.(invalidator); ok && resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		tokenSource.Invalidate()
+
+		resp, err = v.send(ctx, token)
+		if err != nil {
+			return introspectionResult{}, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return introspectionResult{}, fmt.Errorf("unexpected introspection status code: %d", resp.StatusCode)
+	}
+
+	var introspection introspectionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&introspection); err != nil {
+		return introspectionResult{}, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+
+	if !introspection.Active {
+		return introspectionResult{}, nil
+	}
+
+	if introspection.Subject == "" {
+		return introspectionResult{}, errors.New("active introspection response is missing sub")
+	}
+
+	claims := AutologAPIJWTClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: introspection.Subject,
+			Issuer:  introspection.Issuer,
+			ID:      introspection.TokenId,
+		},
+		EmailVerified: introspection.EmailVerified,
+		Scope:         introspection.Scope,
+		Permissions:   strings.Fields(introspection.Scope),
+	}
+	if introspection.ExpiresAt != 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Unix(introspection.ExpiresAt, 0))
+	}
+	if introspection.IssuedAt != 0 {
+		claims.IssuedAt = jwt.NewNumericDate(time.Unix(introspection.IssuedAt, 0))
+	}
+
+	return introspectionResult{
+		active: true,
+		claims: claims,
+	}, nil
+}
+
+func (v *IntrospectionVerifier) send(ctx context.Context, token string) (*http.Response, error) {
+	serviceToken, err := v.tokenSource.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service token: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("token", token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.introspectionUrl,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+serviceToken)
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect token: %w", err)
+	}
+
+	return resp, nil
+}
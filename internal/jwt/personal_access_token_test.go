@@ -0,0 +1,186 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+const testServiceToken = "service-token"
+
+type fakeTokenSource struct {
+	invalidations atomic.Int32
+}
+
+func (f *fakeTokenSource) Token(_ context.Context) (string, error) {
+	return testServiceToken, nil
+}
+
+func (f *fakeTokenSource) Invalidate() {
+	f.invalidations.Add(1)
+}
+
+func TestPersonalAccessTokenAuthentication(t *testing.T) {
+	const activeToken = "alpat_active"
+	const revokedToken = "alpat_revoked"
+
+	var introspections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		introspections.Add(1)
+
+		require.NoError(t, r.ParseForm())
+		token := r.PostForm.Get("token")
+		// introspection is authenticated as the service, never with the token itself
+		require.Equal(t, "Bearer "+testServiceToken, r.Header.Get("Authorization"))
+
+		if token != activeToken {
+			json.NewEncoder(w).Encode(map[string]any{"active": false})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"active":     true,
+			"token_type": "personal_access_token",
+			"sub":        "user-1",
+			"jti":        "token-1",
+			"exp":        time.Now().Add(time.Hour).Unix(),
+			"scope":      "cars:read service_logs:write",
+		})
+	}))
+	defer server.Close()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwtVerifier, err := autologjwt.NewStaticTokenVerifier(autologjwt.StaticTokenVerifierConfig{
+		PublicKey: &privateKey.PublicKey,
+	})
+	require.NoError(t, err)
+
+	patVerifier, err := autologjwt.NewIntrospectionVerifier(autologjwt.IntrospectionVerifierConfig{
+		IntrospectionUrl: server.URL,
+		TokenSource:      &fakeTokenSource{},
+		CacheLength:      time.Minute,
+	})
+	require.NoError(t, err)
+
+	authHandler, err := autologjwt.NewAuthHandler(autologjwt.AuthHandlerConfig{
+		TokenVerifier:               jwtVerifier,
+		PersonalAccessTokenVerifier: patVerifier,
+	})
+	require.NoError(t, err)
+
+	handler := func(permission string) http.Handler {
+		return authHandler.RequireTokenAuthentication(authHandler.RequirePermission(permission)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, ok := autologjwt.GetClaimsFromContext(r.Context())
+				require.True(t, ok)
+				require.Equal(t, "user-1", claims.GetUserId())
+				w.WriteHeader(http.StatusOK)
+			})))
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		permission     string
+		expectedStatus int
+	}{
+		{
+			name:           "InScope",
+			token:          activeToken,
+			permission:     "service_logs:write",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OutOfScope",
+			token:          activeToken,
+			permission:     "cars:write",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Inactive",
+			token:          revokedToken,
+			permission:     "cars:read",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+
+			rec := httptest.NewRecorder()
+			handler(test.permission).ServeHTTP(rec, req)
+
+			require.Equal(t, test.expectedStatus, rec.Code)
+		})
+	}
+
+	// introspections are cached, the active token was only introspected once
+	require.Equal(t, int32(2), introspections.Load())
+}
+
+func TestPersonalAccessTokenWithoutVerifier(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwtVerifier, err := autologjwt.NewStaticTokenVerifier(autologjwt.StaticTokenVerifierConfig{
+		PublicKey: &privateKey.PublicKey,
+	})
+	require.NoError(t, err)
+
+	authHandler, err := autologjwt.NewAuthHandler(autologjwt.AuthHandlerConfig{
+		TokenVerifier: jwtVerifier,
+	})
+	require.NoError(t, err)
+
+	handler := authHandler.RequireTokenAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer alpat_active")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestIntrospectionVerifierRejectedServiceToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tokenSource := &fakeTokenSource{}
+	patVerifier, err := autologjwt.NewIntrospectionVerifier(autologjwt.IntrospectionVerifierConfig{
+		IntrospectionUrl: server.URL,
+		TokenSource:      tokenSource,
+	})
+	require.NoError(t, err)
+
+	// a rejected service token is an error, not an inactive personal access token
+	valid, _, err := patVerifier.VerifyPersonalAccessToken(context.Background(), "alpat_active")
+	require.Error(t, err)
+	require.False(t, valid)
+	require.Equal(t, int32(1), tokenSource.invalidations.Load())
+}
+
+func TestIntrospectionVerifierMissingTokenSource(t *testing.T) {
+	_, err := autologjwt.NewIntrospectionVerifier(autologjwt.IntrospectionVerifierConfig{
+		IntrospectionUrl: "http://auth/v1/oauth/introspect",
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RevocationFeed lists the tokens revoked by the auth server that haven't expired yet. It is
+// served by the auth server and polled by TokenVerifier.
+type RevocationFeed struct {
+	// GeneratedAt is passed back as the since query param to only get newer revocations
+	GeneratedAt time.Time `json:"generatedAt"`
+
+	Tokens []RevokedToken `json:"tokens"`
+	Users  []RevokedUser  `json:"users"`
+}
+
+// RevokedToken is a single revoked token
+type RevokedToken struct {
+	Id        string    `json:"jti"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// RevokedUser revokes every token issued to the user at or before IssuedBefore
+type RevokedUser struct {
+	UserId       string    `json:"sub"`
+	IssuedBefore time.Time `json:"issuedBefore"`
+}
+
+// revocationList is the in memory copy of the revocation feed
+type revocationList struct {
+	feedUrl    string
+	httpClient *http.Client
+
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[string]time.Time
+	since  time.Time
+}
+
+func newRevocationList(feedUrl string, httpClient *http.Client) *revocationList {
+	return &revocationList{
+		feedUrl:    feedUrl,
+		httpClient: httpClient,
+		tokens:     make(map[string]time.Time),
+		users:      make(map[string]time.Time),
+	}
+}
+
+func (r *revocationList) isRevoked(claims AutologAPIJWTClaims) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.tokens[claims.ID]; ok {
+		return true
+	}
+
+	if issuedBefore, ok := r.users[claims.Subject]; ok {
+		if claims.IssuedAt == nil || !claims.IssuedAt.After(issuedBefore) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// poll refreshes the revocation list until the context is done. Failed polls are retried on
+// the next interval, the last known revocations are kept in the meantime.
+func (r *revocationList) poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// errors are dropped, the verifier has no logger and the next poll retries
+		_ = r.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *revocationList) refresh(ctx context.Context) error {
+	r.mu.RLock()
+	since := r.since
+	r.mu.RUnlock()
+
+	feedUrl, err := url.Parse(r.feedUrl)
+	if err != nil {
+		return fmt.Errorf("failed to parse revocation feed url: %w", err)
+	}
+
+	if !since.IsZero() {
+		query := feedUrl.Query()
+		query.Set("since", since.Format(time.RFC3339Nano))
+		feedUrl.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedUrl.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create revocation feed request: %w", err)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get revocation feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected revocation feed status code: %d", resp.StatusCode)
+	}
+
+	var feed RevocationFeed
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return fmt.Errorf("failed to decode revocation feed: %w", err)
+	}
+
+	r.apply(feed, time.Now())
+
+	return nil
+}
+
+// apply merges the feed into the list and drops revocations that no longer matter
+func (r *revocationList) apply(feed RevocationFeed, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range feed.Tokens {
+		r.tokens[t.Id] = t.ExpiresAt
+	}
+
+	for _, u := range feed.Users {
+		if existing, ok := r.users[u.UserId]; !ok || u.IssuedBefore.After(existing) {
+			r.users[u.UserId] = u.IssuedBefore
+		}
+	}
+
+	for id, expiresAt := range r.tokens {
+		if now.After(expiresAt) {
+			delete(r.tokens, id)
+		}
+	}
+
+	// user revocations are kept, there's one per user at most
+
+	if !feed.GeneratedAt.IsZero() {
+		// overlap the next poll slightly so revocations committed during this one aren't missed
+		r.since = feed.GeneratedAt.Add(-5 * time.Second)
+	}
+}
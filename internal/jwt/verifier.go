@@ -2,45 +2,266 @@ package jwt
 
 import (
 	"context"
+	"crypto/rsa"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"time"
 
-	"github.com/MicahParks/keyfunc/v3"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/keola-dunn/autolog/internal/httputil"
 )
 
+var (
+	// ErrTokenRevoked is returned when a token is valid, but has been revoked before expiring
+	ErrTokenRevoked = errors.New("the token has been revoked")
+
+	// ErrInvalidAudience is returned when a token wasn't issued for the verifier's audience
+	ErrInvalidAudience = errors.New("the token is not for this audience")
+
+	// ErrInvalidIssuer is returned when a token wasn't issued by the verifier's issuer
+	ErrInvalidIssuer = errors.New("the token is not from this issuer")
+)
+
+// defaultLeeway is the clock skew allowed between the auth server and verifiers when checking
+// a token's expiry and not before
+const defaultLeeway = 30 * time.Second
+
+// RevocationChecker checks if a token has been revoked. The auth server checks its database
+// directly, rather than polling its own revocation feed.
+type RevocationChecker interface {
+	IsTokenRevoked(ctx context.Context, claims AutologAPIJWTClaims) (bool, error)
+}
+
 type TokenVerifier struct {
-	keyFunc keyfunc.Keyfunc
+	keyFunc jwt.Keyfunc
+
+	// jwks is the verifier's key cache, nil for verifiers that are given their keys
+	jwks *jwksCache
+
+	// issuer and audience, when set, must match the token's
+	issuer   string
+	audience string
+	leeway   time.Duration
+
+	revocations       *revocationList
+	revocationChecker RevocationChecker
 }
 
 type TokenVerifierConfig struct {
+	// JWKSUrl is the auth server's JWKS, ex. http://auth/.well-known/jwks.json
 	JWKSUrl string
+
+	// JWKSCachePath is optional. Fetched keys are written to it, and read from it on startup, so
+	// the service can start while the auth server is down.
+	JWKSCachePath string
+
+	// JWKSFile is a JWKS file to read the keys from instead of JWKSUrl, for deployments that
+	// can't reach the auth server. The keys are never refreshed.
+	JWKSFile string
+
+	// JWKSRefreshInterval defaults to 5 minutes. Keys are also refreshed when a token is signed
+	// by an unknown key.
+	JWKSRefreshInterval time.Duration
+
+	// JWKSStaleAfter is how long keys can go without being fetched before they're reported
+	// stale. Defaults to 1 hour.
+	JWKSStaleAfter time.Duration
+
+	// Issuer is the auth server's issuer, ex. auth-api. Required.
+	Issuer string
+
+	// Audience is the service verifying the tokens, ex. images. Required, so a token meant for
+	// one service can't be used with another.
+	Audience string
+
+	// Leeway is the clock skew allowed when checking expiry. Defaults to 30 seconds.
+	Leeway time.Duration
+
+	// RevocationFeedUrl is the auth server's revocation feed. When set, the feed is polled
+	// every RevocationPollInterval and revoked tokens are rejected before they expire.
+	RevocationFeedUrl string
+
+	// RevocationPollInterval defaults to 30 seconds
+	RevocationPollInterval time.Duration
+
+	// HTTPClient is used to fetch the JWKS and poll the revocation feed. Defaults to a client
+	// with a 10 second timeout.
+	HTTPClient *http.Client
 }
 
+// NewTokenVerifier creates a verifier for the auth server's tokens. It doesn't wait on the auth
+// server, if the JWKS can't be fetched the cached keys are used, and tokens are rejected with
+// ErrNoVerificationKeys until there are some.
 func NewTokenVerifier(ctx context.Context, config TokenVerifierConfig) (*TokenVerifier, error) {
-	jwksFunc, err := keyfunc.NewDefaultCtx(ctx, []string{
-		config.JWKSUrl,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create jwksFunc: %w", err)
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("missing required issuer or audience")
+	}
+
+	if (config.JWKSUrl == "") == (config.JWKSFile == "") {
+		return nil, errors.New("exactly one of a jwks url or jwks file is required")
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	var jwks *jwksCache
+	if config.JWKSFile != "" {
+		var err error
+		jwks, err = newFileJWKSCache(config.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load jwks file: %w", err)
+		}
+	} else {
+		if _, err := url.ParseRequestURI(config.JWKSUrl); err != nil {
+			return nil, fmt.Errorf("invalid jwks url: %w", err)
+		}
+
+		if config.JWKSRefreshInterval <= 0 {
+			config.JWKSRefreshInterval = 5 * time.Minute
+		}
+
+		if config.JWKSStaleAfter <= 0 {
+			config.JWKSStaleAfter = time.Hour
+		}
+
+		jwks = newRemoteJWKSCache(ctx, remoteJWKSCacheConfig{
+			url:             config.JWKSUrl,
+			cachePath:       config.JWKSCachePath,
+			httpClient:      config.HTTPClient,
+			refreshInterval: config.JWKSRefreshInterval,
+			staleAfter:      config.JWKSStaleAfter,
+		})
+	}
+
+	if config.Leeway <= 0 {
+		config.Leeway = defaultLeeway
 	}
 
 	verifier := TokenVerifier{
-		keyFunc: jwksFunc,
+		keyFunc:  jwks.Keyfunc,
+		jwks:     jwks,
+		issuer:   config.Issuer,
+		audience: config.Audience,
+		leeway:   config.Leeway,
+	}
+
+	if config.RevocationFeedUrl != "" {
+		if config.RevocationPollInterval <= 0 {
+			config.RevocationPollInterval = 30 * time.Second
+		}
+
+		verifier.revocations = newRevocationList(config.RevocationFeedUrl, config.HTTPClient)
+		go verifier.revocations.poll(ctx, config.RevocationPollInterval)
 	}
 
 	return &verifier, nil
 }
 
-func (v *TokenVerifier) VerifyToken(tokenString string) (bool, AutologAPIJWTClaims, error) {
+type StaticTokenVerifierConfig struct {
+	// PublicKey verifies the token signatures
+	PublicKey *rsa.PublicKey
+
+	// Issuer and Audience are optional, see TokenVerifierConfig
+	Issuer   string
+	Audience string
+
+	// RevocationChecker is optional
+	RevocationChecker RevocationChecker
+}
+
+// NewStaticTokenVerifier creates a verifier that checks tokens against a known public key
+// instead of a JWKS url. Used by the auth server to verify the tokens it issues.
+func NewStaticTokenVerifier(config StaticTokenVerifierConfig) (*TokenVerifier, error) {
+	if config.PublicKey == nil {
+		return nil, errors.New("missing required public key")
+	}
+
+	return &TokenVerifier{
+		keyFunc: func(token *jwt.Token) (any, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+			}
+			return config.PublicKey, nil
+		},
+		issuer:            config.Issuer,
+		audience:          config.Audience,
+		leeway:            defaultLeeway,
+		revocationChecker: config.RevocationChecker,
+	}, nil
+}
+
+type LocalTokenVerifierConfig struct {
+	// KeyFunc finds the key to verify a token's signature with
+	KeyFunc jwt.Keyfunc
+
+	// Issuer and Audience are optional, see TokenVerifierConfig
+	Issuer   string
+	Audience string
+
+	// RevocationChecker is optional
+	RevocationChecker RevocationChecker
+}
+
+// NewLocalTokenVerifier creates a verifier that finds keys with a key func instead of fetching
+// a JWKS url. Used by the auth server to verify tokens against its own keyring.
+func NewLocalTokenVerifier(config LocalTokenVerifierConfig) (*TokenVerifier, error) {
+	if config.KeyFunc == nil {
+		return nil, errors.New("missing required key func")
+	}
+
+	return &TokenVerifier{
+		keyFunc:           config.KeyFunc,
+		issuer:            config.Issuer,
+		audience:          config.Audience,
+		leeway:            defaultLeeway,
+		revocationChecker: config.RevocationChecker,
+	}, nil
+}
+
+// VerifyToken makes sure the token is valid, from the verifier's issuer, for its audience and not
+// revoked. Returns jwt.ErrTokenExpired for expired tokens, ErrInvalidIssuer and
+// ErrInvalidAudience for tokens from or for someone else, and ErrTokenRevoked for revoked tokens.
+func (v *TokenVerifier) VerifyToken(ctx context.Context, tokenString string) (bool, AutologAPIJWTClaims, error) {
 	var claims AutologAPIJWTClaims
 
-	token, err := jwt.ParseWithClaims(tokenString, &claims, v.keyFunc.Keyfunc)
+	opts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.leeway),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, v.keyFunc, opts...)
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
 			return false, claims, jwt.ErrTokenExpired
 		}
 
+		if errors.Is(err, ErrNoVerificationKeys) {
+			return false, claims, ErrNoVerificationKeys
+		}
+
+		// missing claims are checked too, tokens from before issuers and audiences were checked
+		// may have neither
+		if errors.Is(err, jwt.ErrTokenInvalidIssuer) ||
+			(errors.Is(err, jwt.ErrTokenRequiredClaimMissing) && v.issuer != "" && claims.Issuer == "") {
+			return false, claims, ErrInvalidIssuer
+		}
+
+		if errors.Is(err, jwt.ErrTokenInvalidAudience) ||
+			(errors.Is(err, jwt.ErrTokenRequiredClaimMissing) && v.audience != "" && len(claims.Audience) == 0) {
+			return false, claims, ErrInvalidAudience
+		}
+
 		return false, claims, fmt.Errorf("failed to parse jwt: %w", err)
 	}
 
@@ -48,5 +269,45 @@ func (v *TokenVerifier) VerifyToken(tokenString string) (bool, AutologAPIJWTClai
 		return false, claims, nil
 	}
 
+	if v.revocations != nil && v.revocations.isRevoked(claims) {
+		return false, claims, ErrTokenRevoked
+	}
+
+	if v.revocationChecker != nil {
+		revoked, err := v.revocationChecker.IsTokenRevoked(ctx, claims)
+		if err != nil {
+			return false, claims, fmt.Errorf("failed to check if token is revoked: %w", err)
+		}
+		if revoked {
+			return false, claims, ErrTokenRevoked
+		}
+	}
+
 	return true, claims, nil
 }
+
+// JWKSHealth reports how fresh the verifier's keys are. Returns false for verifiers that are
+// given their keys rather than fetching them.
+func (v *TokenVerifier) JWKSHealth() (JWKSHealth, bool) {
+	if v.jwks == nil {
+		return JWKSHealth{}, false
+	}
+	return v.jwks.health(), true
+}
+
+// JWKSHealthHandler serves the verifier's JWKSHealth. It responds 503 while there are no keys to
+// verify tokens with, stale keys are still reported healthy since tokens can be verified.
+func (v *TokenVerifier) JWKSHealthHandler(w http.ResponseWriter, r *http.Request) {
+	health, ok := v.JWKSHealth()
+	if !ok {
+		httputil.RespondWithError(w, http.StatusNotFound, "")
+		return
+	}
+
+	status := http.StatusOK
+	if health.KeyCount == 0 {
+		status = http.StatusServiceUnavailable
+	}
+
+	httputil.RespondWithJSON(w, status, health)
+}
@@ -0,0 +1,183 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenVerifierRevocationFeed(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwk, err := autologjwt.ConvertPublicKeyPEMToJWK("test-key", &privateKey.PublicKey)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var feed = autologjwt.RevocationFeed{
+		Tokens: []autologjwt.RevokedToken{},
+		Users:  []autologjwt.RevokedUser{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(autologjwt.JWKS{Keys: []autologjwt.JWK{jwk}})
+	})
+	mux.HandleFunc("/v1/oauth/revocations", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		feed.GeneratedAt = time.Now()
+		json.NewEncoder(w).Encode(feed)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := autologjwt.NewTokenVerifier(ctx, autologjwt.TokenVerifierConfig{
+		JWKSUrl:                server.URL + "/.well-known/jwks.json",
+		Issuer:                 "auth-api",
+		Audience:               "autolog-api",
+		RevocationFeedUrl:      server.URL + "/v1/oauth/revocations",
+		RevocationPollInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	createToken := func(id, userId string) string {
+		token, err := autologjwt.CreateJWT(autologjwt.CreateJWTInput{
+			Issuer:     "auth-api",
+			UserId:     userId,
+			Audience:   []string{"autolog-api"},
+			IssuedAt:   now,
+			ExpiresAt:  now.Add(time.Hour),
+			NotBefore:  now,
+			Id:         id,
+			PrivateKey: privateKey,
+		})
+		require.NoError(t, err)
+		return token
+	}
+
+	revokedToken := createToken("revoked-token", "user-1")
+	revokedUserToken := createToken("other-token", "user-2")
+	validToken := createToken("valid-token", "user-3")
+
+	for _, token := range []string{revokedToken, revokedUserToken, validToken} {
+		valid, _, err := verifier.VerifyToken(ctx, token)
+		require.NoError(t, err)
+		require.True(t, valid)
+	}
+
+	mu.Lock()
+	feed.Tokens = append(feed.Tokens, autologjwt.RevokedToken{
+		Id:        "revoked-token",
+		ExpiresAt: now.Add(time.Hour),
+	})
+	feed.Users = append(feed.Users, autologjwt.RevokedUser{
+		UserId:       "user-2",
+		IssuedBefore: now,
+	})
+	mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		_, _, err := verifier.VerifyToken(ctx, revokedToken)
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	_, _, err = verifier.VerifyToken(ctx, revokedToken)
+	require.ErrorIs(t, err, autologjwt.ErrTokenRevoked)
+
+	_, _, err = verifier.VerifyToken(ctx, revokedUserToken)
+	require.ErrorIs(t, err, autologjwt.ErrTokenRevoked)
+
+	valid, claims, err := verifier.VerifyToken(ctx, validToken)
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.Equal(t, "user-3", claims.GetUserId())
+
+	// a token issued a millisecond after the user's tokens were revoked is valid
+	now = now.Add(time.Millisecond)
+	valid, claims, err = verifier.VerifyToken(ctx, createToken("new-token", "user-2"))
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.Equal(t, "user-2", claims.GetUserId())
+}
+
+func TestTokenVerifierKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keys := []struct {
+		kid        string
+		alg        string
+		privateKey crypto.Signer
+	}{
+		{kid: "rsa-key", alg: "RS256", privateKey: rsaKey},
+		{kid: "ec-key", alg: "ES256", privateKey: ecKey},
+		{kid: "ed-key", alg: "EdDSA", privateKey: edKey},
+	}
+
+	var jwks autologjwt.JWKS
+	for _, key := range keys {
+		jwk, err := autologjwt.ConvertPublicKeyToJWK(key.kid, key.alg, key.privateKey.Public())
+		require.NoError(t, err)
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier, err := autologjwt.NewTokenVerifier(ctx, autologjwt.TokenVerifierConfig{
+		JWKSUrl:  server.URL,
+		Issuer:   "auth-api",
+		Audience: "autolog-api",
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, key := range keys {
+		t.Run(key.alg, func(t *testing.T) {
+			token, err := autologjwt.CreateJWT(autologjwt.CreateJWTInput{
+				Issuer:     "auth-api",
+				UserId:     "user-1",
+				Audience:   []string{"autolog-api"},
+				IssuedAt:   now,
+				ExpiresAt:  now.Add(time.Hour),
+				NotBefore:  now,
+				Id:         "token-id",
+				KeyId:      key.kid,
+				PrivateKey: key.privateKey,
+			})
+			require.NoError(t, err)
+
+			valid, claims, err := verifier.VerifyToken(ctx, token)
+			require.NoError(t, err)
+			require.True(t, valid)
+			require.Equal(t, "user-1", claims.GetUserId())
+		})
+	}
+}
@@ -88,8 +88,11 @@ func (l *Logger) RequestLogger(next http.Handler) http.Handler {
 	})
 }
 
+// GetRequestId returns the request's id, or an empty string outside of a request handled by the
+// logging middleware
 func GetRequestId(ctx context.Context) string {
-	return ctx.Value(contextKeyRequestId).(string)
+	requestId, _ := ctx.Value(contextKeyRequestId).(string)
+	return requestId
 }
 
 func GetLogEntry(r *http.Request) *Logger {
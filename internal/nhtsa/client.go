@@ -8,6 +8,9 @@ import (
 
 const (
 	baseURL = "vpic.nhtsa.dot.gov"
+
+	// MinModelYear is the earliest model year looked up, the first car was built in 1885
+	MinModelYear = 1885
 )
 
 var (
@@ -19,6 +22,10 @@ type ClientIface interface {
 	DecodeVINFlat(context.Context, DecodeVINFlatInput) (DecodeVINFlatOutput, error)
 	DecodeVINExtended(context.Context, DecodeVINExtendedInput) (DecodeVINExtendedOutput, error)
 	DecodeVINExtendedFlat(context.Context, DecodeVINExtendedFlatInput) (DecodeVINExtendedFlatOutput, error)
+
+	GetAllMakes(context.Context) (GetAllMakesOutput, error)
+	GetModelsForMakeID(context.Context, GetModelsForMakeIDInput) (GetModelsForMakeIDOutput, error)
+	GetModelsForMakeIDYear(context.Context, GetModelsForMakeIDYearInput) (GetModelsForMakeIDYearOutput, error)
 }
 
 type Client struct {
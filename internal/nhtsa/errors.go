@@ -2,6 +2,7 @@ package nhtsavpic
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -38,3 +39,13 @@ func (d *DecodeVINFlatResult) ErrorCodes() ([]ErrorCode, error) {
 
 	return resp, nil
 }
+
+// Decoded reports whether NHTSA decoded the VIN without any errors. NHTSA returns a result even
+// for invalid VINs, with the issues in the error codes.
+func (d *DecodeVINFlatResult) Decoded() bool {
+	errorCodes, err := d.ErrorCodes()
+	if err != nil {
+		return false
+	}
+	return slices.Equal(errorCodes, []ErrorCode{ErrorCodeSuccess})
+}
@@ -108,3 +108,53 @@ func (c *Client) GetModelsForMakeID(ctx context.Context, in GetModelsForMakeIDIn
 
 	return out, nil
 }
+
+type GetModelsForMakeIDYearInput struct {
+	MakeID    int `json:"Make_ID"`
+	ModelYear int `json:"ModelYear"`
+}
+
+type GetModelsForMakeIDYearOutput struct {
+	Count          int                      `json:"Count"`
+	Message        string                   `json:"Message"`
+	SearchCriteria string                   `json:"SearchCriteria"`
+	Results        []GetModelsForMakeResult `json:"Results"`
+}
+
+// GetModelsForMakeIDYear returns the models NHTSA has on record for a make in the provided
+// model year.
+func (c *Client) GetModelsForMakeIDYear(ctx context.Context, in GetModelsForMakeIDYearInput) (GetModelsForMakeIDYearOutput, error) {
+	if in.MakeID < 0 || in.ModelYear < MinModelYear {
+		return GetModelsForMakeIDYearOutput{}, ErrInvalidArgument
+	}
+
+	url := url.URL{
+		Scheme:   "https",
+		Host:     baseURL,
+		Path:     fmt.Sprintf("api/vehicles/GetModelsForMakeIdYear/makeId/%d/modelyear/%d", in.MakeID, in.ModelYear),
+		RawQuery: "format=json",
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return GetModelsForMakeIDYearOutput{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return GetModelsForMakeIDYearOutput{}, fmt.Errorf("failed to get models for make id year: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return GetModelsForMakeIDYearOutput{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var out GetModelsForMakeIDYearOutput
+	if err := json.Unmarshal(respData, &out); err != nil {
+		return GetModelsForMakeIDYearOutput{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,89 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// idTokenLeeway allows for clock drift between the auth server and providers
+const idTokenLeeway = time.Minute
+
+// IDTokenClaims are the claims of an ID token the relying party uses,
+// https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+
+	Nonce string `json:"nonce"`
+
+	// AuthorizedParty is the client the token was issued to, when there are multiple audiences
+	AuthorizedParty string `json:"azp,omitempty"`
+
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// flexBool is a bool some providers send as a string, ex. "true"
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		*b = flexBool(strings.EqualFold(v, "true"))
+	case nil:
+		*b = false
+	default:
+		return fmt.Errorf("unexpected boolean value: %s", data)
+	}
+
+	return nil
+}
+
+// VerifyIDToken checks the ID token's signature against the provider's JWKS, and that it was
+// issued by the provider, for this client, for the login with the nonce
+func (p *Provider) VerifyIDToken(rawIdToken, nonce string) (IDTokenClaims, error) {
+	var claims IDTokenClaims
+
+	token, err := jwt.ParseWithClaims(rawIdToken, &claims, p.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(p.clientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(idTokenLeeway),
+	)
+	if err != nil {
+		return IDTokenClaims{}, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	if !token.Valid {
+		return IDTokenClaims{}, ErrInvalidIDToken
+	}
+
+	if claims.Subject == "" {
+		return IDTokenClaims{}, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return IDTokenClaims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	// https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientId {
+		return IDTokenClaims{}, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
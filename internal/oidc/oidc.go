@@ -0,0 +1,249 @@
+// Package oidc is an OpenID Connect relying party, for logging users in with external providers
+// such as Google. It implements the authorization code flow with PKCE, and validates ID tokens
+// against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/keola-dunn/autolog/internal/random"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("oidc provider is missing required configurations")
+
+	// ErrInvalidIDToken is returned when an ID token fails validation
+	ErrInvalidIDToken = errors.New("the id token is invalid")
+
+	// ErrExchangeFailed is returned when the provider rejects an authorization code
+	ErrExchangeFailed = errors.New("the provider rejected the authorization code")
+)
+
+// discoveryPath is appended to the issuer to find the provider's configuration,
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig
+const discoveryPath = "/.well-known/openid-configuration"
+
+// defaultScopes are requested when a provider has no scopes configured
+var defaultScopes = []string{"openid", "email", "profile"}
+
+type ProviderConfig struct {
+	// Name identifies the provider in urls and linked identities, ex. "google"
+	Name string
+
+	// Issuer is the provider's issuer identifier, ex. https://accounts.google.com
+	Issuer string
+
+	ClientId     string
+	ClientSecret string
+
+	// RedirectUrl is where the provider sends the user back to with the authorization code
+	RedirectUrl string
+
+	// Scopes defaults to openid, email and profile
+	Scopes []string
+
+	// HTTPClient defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// providerMetadata is the subset of the discovery document the relying party uses
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSUri               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider users can log in with
+type Provider struct {
+	name         string
+	clientId     string
+	clientSecret string
+	redirectUrl  string
+	scopes       []string
+
+	metadata   providerMetadata
+	keyFunc    jwt.Keyfunc
+	httpClient *http.Client
+}
+
+// NewProvider discovers the provider's endpoints from its issuer. The provider's signing keys
+// are refreshed in the background until ctx is cancelled.
+func NewProvider(ctx context.Context, config ProviderConfig) (*Provider, error) {
+	if strings.TrimSpace(config.Name) == "" ||
+		strings.TrimSpace(config.Issuer) == "" ||
+		strings.TrimSpace(config.ClientId) == "" ||
+		strings.TrimSpace(config.RedirectUrl) == "" {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = defaultScopes
+	}
+
+	metadata, err := discover(ctx, config.HTTPClient, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover provider: %w", err)
+	}
+
+	jwksFunc, err := keyfunc.NewDefaultCtx(ctx, []string{metadata.JWKSUri})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jwksFunc: %w", err)
+	}
+
+	return &Provider{
+		name:         config.Name,
+		clientId:     config.ClientId,
+		clientSecret: config.ClientSecret,
+		redirectUrl:  config.RedirectUrl,
+		scopes:       config.Scopes,
+		metadata:     metadata,
+		keyFunc:      jwksFunc.Keyfunc,
+		httpClient:   config.HTTPClient,
+	}, nil
+}
+
+func discover(ctx context.Context, client *http.Client, issuer string) (providerMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(issuer, "/")+discoveryPath, nil)
+	if err != nil {
+		return providerMetadata{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return providerMetadata{}, fmt.Errorf("failed to get discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return providerMetadata{}, fmt.Errorf("unexpected discovery document status: %d", resp.StatusCode)
+	}
+
+	var metadata providerMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return providerMetadata{}, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+
+	// the issuer must match exactly, or tokens from another issuer could be accepted
+	if metadata.Issuer != issuer {
+		return providerMetadata{}, fmt.Errorf("discovery document issuer %q does not match %q", metadata.Issuer, issuer)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSUri == "" {
+		return providerMetadata{}, errors.New("discovery document is missing required endpoints")
+	}
+
+	return metadata, nil
+}
+
+// Name is the provider's configured name
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// NewCodeVerifier returns a PKCE code verifier, https://datatracker.ietf.org/doc/html/rfc7636#section-4.1
+func NewCodeVerifier() (string, error) {
+	return random.SecureToken(32)
+}
+
+// CodeChallenge is the S256 code challenge for the verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is where the user is sent to log in with the provider. state and nonce must be
+// unguessable and checked when the user comes back.
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.clientId)
+	params.Set("redirect_uri", p.redirectUrl)
+	params.Set("scope", strings.Join(p.scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.metadata.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// tokenResponse is the provider's response to a code exchange
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IdToken     string `json:"id_token"`
+}
+
+// Exchange trades the authorization code for the user's ID token, verifies it and returns its
+// claims. nonce and codeVerifier are the values the login was started with.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (IDTokenClaims, error) {
+	if strings.TrimSpace(code) == "" || strings.TrimSpace(codeVerifier) == "" {
+		return IDTokenClaims{}, ErrExchangeFailed
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectUrl)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDTokenClaims{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.clientId), url.QueryEscape(p.clientSecret))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return IDTokenClaims{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return IDTokenClaims{}, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return IDTokenClaims{}, fmt.Errorf("%w: status %d: %s", ErrExchangeFailed, resp.StatusCode, data)
+	}
+
+	var tokens tokenResponse
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return IDTokenClaims{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if tokens.IdToken == "" {
+		return IDTokenClaims{}, fmt.Errorf("%w: missing id token", ErrInvalidIDToken)
+	}
+
+	return p.VerifyIDToken(tokens.IdToken, nonce)
+}
@@ -0,0 +1,186 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/keola-dunn/autolog/internal/oidc"
+	"github.com/keola-dunn/autolog/internal/oidc/oidctest"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testClientId     = "autolog"
+	testClientSecret = "test-client-secret"
+	testRedirectUrl  = "http://localhost:3000/login/callback"
+)
+
+func TestNewProvider(t *testing.T) {
+	stub, err := oidctest.NewProvider(testClientId, testClientSecret)
+	require.NoError(t, err)
+	defer stub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = oidc.NewProvider(ctx, oidc.ProviderConfig{
+		Name:        "test",
+		Issuer:      stub.Issuer,
+		ClientId:    testClientId,
+		RedirectUrl: testRedirectUrl,
+	})
+	require.NoError(t, err)
+
+	// the discovery document's issuer must match exactly
+	_, err = oidc.NewProvider(ctx, oidc.ProviderConfig{
+		Name:        "test",
+		Issuer:      stub.Issuer + "/",
+		ClientId:    testClientId,
+		RedirectUrl: testRedirectUrl,
+	})
+	require.Error(t, err)
+
+	_, err = oidc.NewProvider(ctx, oidc.ProviderConfig{
+		Issuer:      stub.Issuer,
+		ClientId:    testClientId,
+		RedirectUrl: testRedirectUrl,
+	})
+	require.ErrorIs(t, err, oidc.ErrMissingRequiredConfiguration)
+}
+
+func TestExchange(t *testing.T) {
+	testUser := oidctest.User{
+		Subject:       "110169484474386276334",
+		Email:         "driver@example.com",
+		EmailVerified: true,
+		Name:          "Test Driver",
+	}
+
+	tests := []struct {
+		name string
+
+		clientSecret string
+		modifyClaims func(claims jwt.MapClaims)
+		// wrongVerifier and wrongNonce exchange with values other than the login started with
+		wrongVerifier bool
+		wrongNonce    bool
+
+		expectedErr error
+	}{
+		{
+			name:         "success",
+			clientSecret: testClientSecret,
+		},
+		{
+			name:         "email verified as a string",
+			clientSecret: testClientSecret,
+			modifyClaims: func(claims jwt.MapClaims) {
+				claims["email_verified"] = "true"
+			},
+		},
+		{
+			name:         "wrong client secret",
+			clientSecret: "wrong",
+			expectedErr:  oidc.ErrExchangeFailed,
+		},
+		{
+			name:          "wrong code verifier",
+			clientSecret:  testClientSecret,
+			wrongVerifier: true,
+			expectedErr:   oidc.ErrExchangeFailed,
+		},
+		{
+			name:         "wrong nonce",
+			clientSecret: testClientSecret,
+			wrongNonce:   true,
+			expectedErr:  oidc.ErrInvalidIDToken,
+		},
+		{
+			name:         "wrong audience",
+			clientSecret: testClientSecret,
+			modifyClaims: func(claims jwt.MapClaims) {
+				claims["aud"] = "another-client"
+			},
+			expectedErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:         "wrong issuer",
+			clientSecret: testClientSecret,
+			modifyClaims: func(claims jwt.MapClaims) {
+				claims["iss"] = "https://accounts.example.com"
+			},
+			expectedErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:         "expired",
+			clientSecret: testClientSecret,
+			modifyClaims: func(claims jwt.MapClaims) {
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			},
+			expectedErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:         "multiple audiences without authorized party",
+			clientSecret: testClientSecret,
+			modifyClaims: func(claims jwt.MapClaims) {
+				claims["aud"] = []string{testClientId, "another-client"}
+			},
+			expectedErr: oidc.ErrInvalidIDToken,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub, err := oidctest.NewProvider(testClientId, testClientSecret)
+			require.NoError(t, err)
+			defer stub.Close()
+			stub.ModifyClaims = test.modifyClaims
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			provider, err := oidc.NewProvider(ctx, oidc.ProviderConfig{
+				Name:         "test",
+				Issuer:       stub.Issuer,
+				ClientId:     testClientId,
+				ClientSecret: test.clientSecret,
+				RedirectUrl:  testRedirectUrl,
+			})
+			require.NoError(t, err)
+
+			verifier, err := oidc.NewCodeVerifier()
+			require.NoError(t, err)
+
+			code, state, err := stub.Authorize(provider.AuthCodeURL("test-state", "test-nonce", verifier), testUser)
+			require.NoError(t, err)
+			require.Equal(t, "test-state", state)
+
+			nonce := "test-nonce"
+			if test.wrongNonce {
+				nonce = "another-nonce"
+			}
+			if test.wrongVerifier {
+				verifier, err = oidc.NewCodeVerifier()
+				require.NoError(t, err)
+			}
+
+			claims, err := provider.Exchange(ctx, code, verifier, nonce)
+			if test.expectedErr != nil {
+				require.True(t, errors.Is(err, test.expectedErr), "expected %v, got %v", test.expectedErr, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testUser.Subject, claims.Subject)
+			require.Equal(t, testUser.Email, claims.Email)
+			require.True(t, bool(claims.EmailVerified))
+			require.Equal(t, testUser.Name, claims.Name)
+
+			// codes can only be exchanged once
+			_, err = provider.Exchange(ctx, code, verifier, nonce)
+			require.ErrorIs(t, err, oidc.ErrExchangeFailed)
+		})
+	}
+}
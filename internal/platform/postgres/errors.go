@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// ErrCodeUniqueViolation is the postgres error code returned when a unique constraint is violated
+	// https://www.postgresql.org/docs/current/errcodes-appendix.html
+	ErrCodeUniqueViolation = "23505"
+)
+
+// IsUniqueViolation checks if the error is a postgres unique constraint violation
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == ErrCodeUniqueViolation
+}
+
+// IsUniqueViolationOf checks if the error is a postgres unique constraint violation of one of the
+// named constraints or unique indexes
+func IsUniqueViolationOf(err error, constraints ...string) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != ErrCodeUniqueViolation {
+		return false
+	}
+	return slices.Contains(constraints, pgErr.ConstraintName)
+}
@@ -0,0 +1,17 @@
+package random
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// SecureToken returns a URL safe token made from numBytes of cryptographically secure
+// randomness. Use this, not the ServiceIface methods, for anything that grants access.
+func SecureToken(numBytes int) (string, error) {
+	b := make([]byte, numBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventType is what happened in an authentication event
+type EventType string
+
+const (
+	EventLoginSucceeded  EventType = "login_succeeded"
+	EventLoginFailed     EventType = "login_failed"
+	EventSignup          EventType = "signup"
+	EventPasswordChanged EventType = "password_changed"
+	EventTokenRefreshed  EventType = "token_refreshed"
+	EventTokenRevoked    EventType = "token_revoked"
+	EventSessionRevoked  EventType = "session_revoked"
+
+	EventSecurityQuestionsChanged EventType = "security_questions_changed"
+)
+
+const (
+	maxLoginLength     = 320
+	maxDetailLength    = 64
+	maxIPAddressLength = 64
+	maxUserAgentLength = 512
+	maxRequestIdLength = 64
+
+	// maxListedEvents caps how many events ListUserEvents returns
+	maxListedEvents = 100
+)
+
+// Event is a single entry in the audit trail
+type Event struct {
+	Id   string
+	Type EventType
+
+	// UserId is empty for failed logins that don't match a user
+	UserId string
+
+	// Login is the username or email given for a failed login, since it may not match a user
+	Login string
+
+	// Detail is more about the event, ex. the login method or why a login failed
+	Detail string
+
+	IPAddress string
+	UserAgent string
+	RequestId string
+
+	CreatedAt time.Time
+}
+
+// RecordEvent adds the event to the audit trail. Values too long for their columns, like long
+// user agents, are cut short.
+func (s *Service) RecordEvent(ctx context.Context, event Event) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(string(event.Type)) == "" {
+		return ErrInvalidArg
+	}
+
+	var userId *string
+	if strings.TrimSpace(event.UserId) != "" {
+		u := strings.TrimSpace(event.UserId)
+		userId = &u
+	}
+
+	query := `
+	INSERT INTO auth_events (event_type, user_id, login, detail, ip_address, user_agent, request_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	if _, err := s.db.Exec(ctx, query, string(event.Type), userId,
+		nullableString(event.Login, maxLoginLength),
+		nullableString(event.Detail, maxDetailLength),
+		nullableString(event.IPAddress, maxIPAddressLength),
+		nullableString(event.UserAgent, maxUserAgentLength),
+		nullableString(event.RequestId, maxRequestIdLength)); err != nil {
+		return fmt.Errorf("failed to insert auth event: %w", err)
+	}
+
+	return nil
+}
+
+// ListUserEvents lists the user's most recent events, newest first. At most 100 are returned.
+func (s *Service) ListUserEvents(ctx context.Context, userId string, limit int) ([]Event, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	if limit <= 0 || limit > maxListedEvents {
+		limit = maxListedEvents
+	}
+
+	query := `
+	SELECT
+		ae.id,
+		ae.event_type,
+		COALESCE(ae.detail, ''),
+		COALESCE(ae.ip_address, ''),
+		COALESCE(ae.user_agent, ''),
+		COALESCE(ae.request_id, ''),
+		ae.created_at
+	FROM auth_events ae
+	WHERE ae.user_id = $1
+	ORDER BY ae.created_at DESC
+	LIMIT $2`
+
+	rows, err := s.db.Query(ctx, query, strings.TrimSpace(userId), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for auth events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]Event, 0)
+	for rows.Next() {
+		var eventType string
+		event := Event{
+			UserId: strings.TrimSpace(userId),
+		}
+		if err := rows.Scan(&event.Id, &eventType, &event.Detail, &event.IPAddress, &event.UserAgent,
+			&event.RequestId, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan auth event: %w", err)
+		}
+		event.Type = EventType(eventType)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read auth events: %w", err)
+	}
+
+	return events, nil
+}
+
+// nullableString cuts the value to at most maxLength bytes of valid UTF-8, postgres rejects
+// anything else, and returns nil for empty values
+func nullableString(value string, maxLength int) *string {
+	value = strings.ToValidUTF8(strings.TrimSpace(value), "")
+	if len(value) > maxLength {
+		// dropping invalid UTF-8 again drops a character cut in half
+		value = strings.ToValidUTF8(value[:maxLength], "")
+	}
+
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
@@ -0,0 +1,216 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/service/audit"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordEvent(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	query := "INSERT INTO auth_events (event_type, user_id, login, detail, ip_address, user_agent, request_id) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7)"
+
+	strPtr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name   string
+		event  audit.Event
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			event:       audit.Event{UserId: testUserId},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: audit.ErrInvalidArg,
+		},
+		{
+			name: "LoginSucceeded",
+			event: audit.Event{
+				Type:      audit.EventLoginSucceeded,
+				UserId:    testUserId,
+				Detail:    "password",
+				IPAddress: "203.0.113.7",
+				UserAgent: "Mozilla/5.0",
+				RequestId: "request-1",
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs("login_succeeded", strPtr(testUserId), (*string)(nil),
+					strPtr("password"), strPtr("203.0.113.7"), strPtr("Mozilla/5.0"), strPtr("request-1")).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			},
+		},
+		{
+			name: "UnknownUser",
+			event: audit.Event{
+				Type:      audit.EventLoginFailed,
+				Login:     "nobody",
+				Detail:    "invalid_credentials",
+				IPAddress: "203.0.113.7",
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs("login_failed", (*string)(nil), strPtr("nobody"),
+					strPtr("invalid_credentials"), strPtr("203.0.113.7"), (*string)(nil), (*string)(nil)).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			},
+		},
+		{
+			name: "LongUserAgent",
+			event: audit.Event{
+				Type:      audit.EventTokenRefreshed,
+				UserId:    testUserId,
+				UserAgent: strings.Repeat("a", 511) + "é",
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs("token_refreshed", strPtr(testUserId), (*string)(nil),
+					(*string)(nil), (*string)(nil), strPtr(strings.Repeat("a", 511)), (*string)(nil)).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			},
+		},
+		{
+			name:  "DbError",
+			event: audit.Event{Type: audit.EventSignup, UserId: testUserId},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs("signup", strPtr(testUserId), (*string)(nil),
+					(*string)(nil), (*string)(nil), (*string)(nil), (*string)(nil)).
+					WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to insert auth event: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := audit.NewService(audit.ServiceConfig{
+				DB: db,
+			})
+
+			err = service.RecordEvent(context.TODO(), test.event)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				if !errors.Is(err, test.expectedErr) {
+					require.Equal(t, test.expectedErr.Error(), err.Error())
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListUserEvents(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	query := "SELECT ae.id, ae.event_type, COALESCE(ae.detail, ''), COALESCE(ae.ip_address, ''), " +
+		"COALESCE(ae.user_agent, ''), COALESCE(ae.request_id, ''), ae.created_at FROM auth_events ae " +
+		"WHERE ae.user_id = $1 ORDER BY ae.created_at DESC LIMIT $2"
+	columns := []string{"id", "event_type", "detail", "ip_address", "user_agent", "request_id", "created_at"}
+
+	tests := []struct {
+		name   string
+		userId string
+		limit  int
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr    error
+		expectedEvents []audit.Event
+	}{
+		{
+			name:        "InvalidArg",
+			userId:      " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: audit.ErrInvalidArg,
+		},
+		{
+			name:   "DefaultLimit",
+			userId: testUserId,
+			limit:  0,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs(testUserId, 100).
+					WillReturnRows(pgxmock.NewRows(columns).
+						AddRow("event-1", "login_succeeded", "passkey", "203.0.113.7", "Mozilla/5.0", "request-1", createdAt))
+			},
+			expectedEvents: []audit.Event{
+				{
+					Id:        "event-1",
+					Type:      audit.EventLoginSucceeded,
+					UserId:    testUserId,
+					Detail:    "passkey",
+					IPAddress: "203.0.113.7",
+					UserAgent: "Mozilla/5.0",
+					RequestId: "request-1",
+					CreatedAt: createdAt,
+				},
+			},
+		},
+		{
+			name:   "NoEvents",
+			userId: testUserId,
+			limit:  10,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs(testUserId, 10).
+					WillReturnRows(pgxmock.NewRows(columns))
+			},
+			expectedEvents: []audit.Event{},
+		},
+		{
+			name:   "DbError",
+			userId: testUserId,
+			limit:  10,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs(testUserId, 10).
+					WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to query for auth events: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := audit.NewService(audit.ServiceConfig{
+				DB: db,
+			})
+
+			events, err := service.ListUserEvents(context.TODO(), test.userId, test.limit)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				if !errors.Is(err, test.expectedErr) {
+					require.Equal(t, test.expectedErr.Error(), err.Error())
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expectedEvents, events)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package audit
+
+import (
+	"context"
+	"errors"
+
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("audit service is missing required configurations to perform this operation")
+
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+)
+
+type ServiceConfig struct {
+	// DB is the Database used for the audit service
+	DB postgres.ConnectionPool
+}
+
+type ServiceIface interface {
+	RecordEvent(ctx context.Context, event Event) error
+	ListUserEvents(ctx context.Context, userId string, limit int) ([]Event, error)
+}
+
+// Service keeps the audit trail of authentication events
+type Service struct {
+	db postgres.ConnectionPool
+}
+
+func NewService(cfg ServiceConfig) *Service {
+	return &Service{
+		db: cfg.DB,
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
 )
 
 var (
@@ -22,6 +23,11 @@ type Car struct {
 	Year  int64
 	VIN   string
 
+	// IdentifierType is how the car is identified. Defaults to a VIN. Cars identified any other
+	// way store the number in Identifier, can't be decoded by NHTSA and are unverified.
+	IdentifierType IdentifierType
+	Identifier     string
+
 	Color string
 
 	// PublicId is the short 6 character ID assigned to each car for
@@ -41,73 +47,178 @@ func (c *Car) PublicId() string {
 	return c.publicId
 }
 
-func (s *Service) CreateCar(ctx context.Context, userId string, car Car, nhtsaData NHTSAVPICData) error {
+type CreateCarInput struct {
+	// UserId is the ID of the user creating, and owning, the car
+	UserId string
+
+	Car Car
+
+	// NHTSAData is the decode of the car's VIN. Required for VIN identified cars.
+	NHTSAData NHTSAVPICData
+
+	// Spec is the user supplied spec for cars that NHTSA can't decode. Ignored for VIN
+	// identified cars, which have their spec built from the NHTSA data.
+	Spec *VehicleSpec
+
+	// Overrides are the car details where the user kept their value over NHTSA's
+	Overrides []FieldOverride
+}
+
+// CreateCar creates the car, assigns it to the user and stores the NHTSA data for it. Cars
+// identified by something other than a VIN store the user supplied spec instead. Returns
+// the created car.
+func (s *Service) CreateCar(ctx context.Context, input CreateCarInput) (Car, error) {
 	if s.db == nil {
-		return ErrMissingRequiredConfiguration
+		return Car{}, ErrMissingRequiredConfiguration
+	}
+
+	car := input.Car
+	nhtsaData := input.NHTSAData
+
+	if strings.TrimSpace(input.UserId) == "" || !car.valid() {
+		return Car{}, ErrInvalidArg
 	}
 
-	if strings.TrimSpace(userId) == "" || !car.valid() {
-		return ErrInvalidArg
+	car.VIN = normalizeVIN(car.VIN)
+	if car.IdentifierType.Verified() {
+		car.IdentifierType = IdentifierTypeVIN
+	} else {
+		car.Identifier = normalizeIdentifier(car.Identifier)
 	}
 
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return Car{}, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
 	publicId, _, err := s.generatePublicId(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to generate public id: %w", err)
+		return Car{}, fmt.Errorf("failed to generate public id: %w", err)
 	}
 
 	car.publicId = publicId
 
 	carId, err := createCarRecord(ctx, tx, car)
 	if err != nil {
-		return fmt.Errorf("failed to create car record: %w", err)
+		if errors.Is(err, ErrAlreadyExists) {
+			return Car{}, ErrAlreadyExists
+		}
+		return Car{}, fmt.Errorf("failed to create car record: %w", err)
+	}
+	car.id = carId
+
+	if _, err := createUserCarRecord(ctx, tx, input.UserId, carId); err != nil {
+		return Car{}, fmt.Errorf("failed to create user car record: %w", err)
 	}
 
-	if _, err := createUserCarRecord(ctx, tx, userId, carId); err != nil {
-		return fmt.Errorf("failed to create user car record: %w", err)
+	if !car.IdentifierType.Verified() {
+		if input.Spec != nil {
+			spec := *input.Spec
+			spec.carId = carId
+			spec.Source = SpecSourceUser
+
+			if err := createVehicleSpecRecord(ctx, tx, spec); err != nil {
+				return Car{}, fmt.Errorf("failed to create vehicle spec record: %w", err)
+			}
+		}
+	} else {
+		nhtsaData.carId = carId
+		if err := createNHTSAVPICDataRecord(ctx, tx, nhtsaData); err != nil {
+			return Car{}, fmt.Errorf("failed to create nhtsa vpic data record: %w", err)
+		}
+	}
+
+	if car.IdentifierType.Verified() && len(nhtsaData.Payload) > 0 {
+		spec, err := newVehicleSpecFromPayload(nhtsaData.Payload)
+		if err != nil {
+			return Car{}, fmt.Errorf("failed to build vehicle spec: %w", err)
+		}
+		spec.carId = carId
+
+		if err := createVehicleSpecRecord(ctx, tx, spec); err != nil {
+			return Car{}, fmt.Errorf("failed to create vehicle spec record: %w", err)
+		}
 	}
 
-	nhtsaData.carId = carId
-	if err := createNHTSAVPICDataRecord(ctx, tx, nhtsaData); err != nil {
-		return fmt.Errorf("failed to create nhtsa vpic data record: %w", err)
+	if err := createFieldOverrideRecords(ctx, tx, carId, input.UserId, input.Overrides); err != nil {
+		return Car{}, fmt.Errorf("failed to create field override records: %w", err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return Car{}, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return nil
+	return car, nil
 }
 
 func (c *Car) valid() bool {
 	// first car created was in 1885
-	return !(strings.TrimSpace(c.Make) == "" ||
+	if strings.TrimSpace(c.Make) == "" ||
 		strings.TrimSpace(c.Model) == "" ||
-		c.Year < 1885 ||
-		strings.TrimSpace(c.VIN) == "")
+		c.Year < 1885 {
+		return false
+	}
+
+	if !c.IdentifierType.Valid() {
+		return false
+	}
 
+	if c.IdentifierType.Verified() {
+		return strings.TrimSpace(c.VIN) != ""
+	}
+
+	return validAlternateIdentifier(c.Identifier)
 }
 
+const (
+	// carVINUniqueIndex and carIdentifierUniqueIndex enforce a car is only created once
+	carVINUniqueIndex        = "idx_cars_vin_unique"
+	carIdentifierUniqueIndex = "idx_cars_identifier_unique"
+)
+
 func createCarRecord(ctx context.Context, tx pgx.Tx, car Car) (string, error) {
 	query := `
-	INSERT INTO cars (make, model, trim, year, vin, color)
+	INSERT INTO cars (public_id, make, model, trim, year, vin, identifier_type, identifier, color)
 	VALUES 
-	($1, $2, $3, $4, $5, $6) RETURNING id`
+	($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+
+	// cars identified by a VIN don't have an alternate identifier, and vice versa
+	var vin, identifier *string
+	identifierType := car.IdentifierType
+	if identifierType.Verified() {
+		identifierType = IdentifierTypeVIN
+		v := normalizeVIN(car.VIN)
+		vin = &v
+	} else {
+		i := normalizeIdentifier(car.Identifier)
+		identifier = &i
+		if strings.TrimSpace(car.VIN) != "" {
+			v := normalizeVIN(car.VIN)
+			vin = &v
+		}
+	}
 
-	row := tx.QueryRow(ctx, query, car.Make, car.Model, car.Trim, car.Year, car.VIN, car.Color)
+	row := tx.QueryRow(ctx, query, car.publicId, car.Make, car.Model, car.Trim, car.Year,
+		vin, identifierType, identifier, car.Color)
 	var carId string
 	if err := row.Scan(&carId); err != nil {
+		// a public id collision isn't the car already existing
+		if postgres.IsUniqueViolationOf(err, carVINUniqueIndex, carIdentifierUniqueIndex) {
+			return "", ErrAlreadyExists
+		}
 		return "", fmt.Errorf("failed to insert car: %w", err)
 	}
 
 	return carId, nil
 }
 
+// normalizeVIN upper cases and trims the VIN. VINs are stored normalized so they can be
+// enforced unique.
+func normalizeVIN(vin string) string {
+	return strings.ToUpper(strings.TrimSpace(vin))
+}
+
 func createUserCarRecord(ctx context.Context, tx pgx.Tx, userId, carId string) (string, error) {
 	query := `
 	INSERT INTO users_cars (user_id, car_id)
@@ -140,13 +251,17 @@ func (s *Service) GetUsersCars(ctx context.Context, userId string) ([]Car, error
     	c.model,
     	c.trim,
     	c.year,
-    	c.vin,
+    	COALESCE(c.vin, ''),
+		c.identifier_type,
+		COALESCE(c.identifier, ''),
 		c.color,
     	c.created_at,
     	c.updated_at
 	FROM cars c
 	JOIN users_cars uc ON uc.car_id = c.id
-	WHERE uc.user_id = $1`
+	WHERE 
+		uc.user_id = $1 AND
+		uc.ended_at IS NULL`
 
 	rows, err := s.db.Query(ctx, query, userId)
 	if err != nil {
@@ -159,7 +274,8 @@ func (s *Service) GetUsersCars(ctx context.Context, userId string) ([]Car, error
 	for rows.Next() {
 		var c Car
 		if err := rows.Scan(&c.id, &c.publicId, &c.Make, &c.Model, &c.Trim,
-			&c.Year, &c.VIN, &c.Color, &c.createdAt, &c.updatedAt); err != nil {
+			&c.Year, &c.VIN, &c.IdentifierType, &c.Identifier, &c.Color,
+			&c.createdAt, &c.updatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
@@ -172,6 +288,13 @@ func (s *Service) GetUsersCars(ctx context.Context, userId string) ([]Car, error
 type GetCarInput struct {
 	VIN string
 
+	// Identifier is the chassis, short VIN or frame number of a car without a 17 character VIN.
+	// Identifiers are only unique per type and make, so IdentifierType and IdentifierMake
+	// optionally narrow the lookup, ex. a chassis number can have the same text as a frame number.
+	Identifier     string
+	IdentifierType IdentifierType
+	IdentifierMake string
+
 	PublicId string
 
 	Id string
@@ -184,7 +307,9 @@ type GetCarInput struct {
 
 func (g *GetCarInput) valid() bool {
 	return strings.TrimSpace(g.VIN) != "" ||
+		strings.TrimSpace(g.Identifier) != "" ||
 		strings.TrimSpace(g.PublicId) != "" ||
+		strings.TrimSpace(g.Id) != "" ||
 		(strings.TrimSpace(g.PlateNumber) != "" && strings.TrimSpace(g.PlateState) != "")
 }
 
@@ -245,17 +370,35 @@ func (s *Service) GetCar(ctx context.Context, input GetCarInput) (GetCarOutput,
 		c.model,
 		c.trim,
 		c.year,
-		c.vin,
+		COALESCE(c.vin, ''),
+		c.identifier_type,
+		COALESCE(c.identifier, ''),
+		COALESCE(c.color, ''),
 		c.created_at,
 		c.updated_at
 	FROM cars c
 	WHERE `)
 
 	if strings.TrimSpace(input.VIN) != "" {
-		queryArgs = append(queryArgs, strings.TrimSpace(input.VIN))
+		queryArgs = append(queryArgs, normalizeVIN(input.VIN))
 		conditionalQueryArgs = append(conditionalQueryArgs, fmt.Sprintf("c.vin = $%d", len(queryArgs)))
 	}
 
+	if strings.TrimSpace(input.Identifier) != "" {
+		queryArgs = append(queryArgs, normalizeIdentifier(input.Identifier))
+		identifierConditions := []string{fmt.Sprintf("c.identifier = $%d", len(queryArgs))}
+		if strings.TrimSpace(string(input.IdentifierType)) != "" {
+			queryArgs = append(queryArgs, input.IdentifierType)
+			identifierConditions = append(identifierConditions, fmt.Sprintf("c.identifier_type = $%d", len(queryArgs)))
+		}
+		if strings.TrimSpace(input.IdentifierMake) != "" {
+			queryArgs = append(queryArgs, strings.TrimSpace(input.IdentifierMake))
+			identifierConditions = append(identifierConditions, fmt.Sprintf("UPPER(c.make) = UPPER($%d)", len(queryArgs)))
+		}
+		conditionalQueryArgs = append(conditionalQueryArgs,
+			fmt.Sprintf("(%s)", strings.Join(identifierConditions, " AND ")))
+	}
+
 	if strings.TrimSpace(input.PublicId) != "" {
 		queryArgs = append(queryArgs, strings.TrimSpace(input.PublicId))
 		conditionalQueryArgs = append(conditionalQueryArgs, fmt.Sprintf("c.public_id = $%d", len(queryArgs)))
@@ -277,7 +420,8 @@ func (s *Service) GetCar(ctx context.Context, input GetCarInput) (GetCarOutput,
 	var c Car
 	row := s.db.QueryRow(ctx, queryBuilder.String(), queryArgs...)
 	if err := row.Scan(&c.id, &c.publicId, &c.Make, &c.Model, &c.Trim,
-		&c.Year, &c.VIN, &c.createdAt, &c.updatedAt); err != nil {
+		&c.Year, &c.VIN, &c.IdentifierType, &c.Identifier, &c.Color,
+		&c.createdAt, &c.updatedAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return GetCarOutput{}, ErrNotFound
 		}
@@ -0,0 +1,169 @@
+package car_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/keola-dunn/autolog/internal/random"
+	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUserId     = "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testOwnerId    = "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e"
+	testCarId      = "5a6b7c8d-9e0f-4a1b-8c2d-3e4f5a6b7c8d"
+	testClaimId    = "9f8e7d6c-5b4a-4c3d-8e2f-1a0b9c8d7e6f"
+	testPublicId   = "ABC123"
+	testVIN        = "JTDBAMDE1NW000001"
+	testUserCarId  = "1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d"
+	testReviewNote = "looks good"
+)
+
+type fakeRandomService struct {
+	random.ServiceIface
+}
+
+func (f *fakeRandomService) RandomUpperAlphanumericString(_ int64) string {
+	return testPublicId
+}
+
+func newTestService(t *testing.T) (*car.Service, pgxmock.PgxConnIface) {
+	db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("failed to create new test postgres db: %v", err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	return car.NewService(car.ServiceConfig{
+		DB:              db,
+		RandomGenerator: &fakeRandomService{},
+	}), db
+}
+
+func requireErr(t *testing.T, expectedErr, err error) {
+	t.Helper()
+
+	require.Error(t, err)
+	if !errors.Is(err, expectedErr) {
+		require.Equal(t, expectedErr.Error(), err.Error())
+	}
+}
+
+func TestCreateCarUniqueViolation(t *testing.T) {
+	publicIdQuery := "SELECT 1 FROM cars c WHERE c.public_id = $1"
+	insertQuery := "INSERT INTO cars (public_id, make, model, trim, year, vin, identifier_type, identifier, color) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id"
+
+	input := car.CreateCarInput{
+		UserId: testUserId,
+		Car: car.Car{
+			Make:  "TOYOTA",
+			Model: "GR Supra",
+			Year:  2022,
+			VIN:   testVIN,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		constraint string
+
+		expectedErr error
+	}{
+		{
+			name:        "VIN",
+			constraint:  "idx_cars_vin_unique",
+			expectedErr: car.ErrAlreadyExists,
+		},
+		{
+			name:        "Identifier",
+			constraint:  "idx_cars_identifier_unique",
+			expectedErr: car.ErrAlreadyExists,
+		},
+		{
+			// the car doesn't exist, another car took the public id first
+			name:       "PublicId",
+			constraint: "cars_public_id_key",
+			expectedErr: errors.New("failed to create car record: failed to insert car: " +
+				"ERROR: duplicate key value violates unique constraint (SQLSTATE 23505)"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+
+			db.ExpectBegin()
+			db.ExpectQuery(publicIdQuery).WithArgs(testPublicId).WillReturnError(pgx.ErrNoRows)
+			db.ExpectQuery(insertQuery).
+				WithArgs(testPublicId, "TOYOTA", "GR Supra", "", int64(2022), pgxmock.AnyArg(),
+					car.IdentifierTypeVIN, pgxmock.AnyArg(), "").
+				WillReturnError(&pgconn.PgError{
+					Severity:       "ERROR",
+					Code:           "23505",
+					Message:        "duplicate key value violates unique constraint",
+					ConstraintName: test.constraint,
+				})
+			db.ExpectRollback()
+
+			_, err := service.CreateCar(context.TODO(), input)
+			requireErr(t, test.expectedErr, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetCarByIdentifier(t *testing.T) {
+	selectQuery := "SELECT c.id, c.public_id, c.make, c.model, c.trim, c.year, COALESCE(c.vin, ''), " +
+		"c.identifier_type, COALESCE(c.identifier, ''), COALESCE(c.color, ''), c.created_at, c.updated_at " +
+		"FROM cars c WHERE "
+	columns := []string{"id", "public_id", "make", "model", "trim", "year", "vin", "identifier_type",
+		"identifier", "color", "created_at", "updated_at"}
+
+	tests := []struct {
+		name  string
+		input car.GetCarInput
+
+		expectedQuery string
+		expectedArgs  []any
+	}{
+		{
+			name:          "Identifier",
+			input:         car.GetCarInput{Identifier: "10001"},
+			expectedQuery: selectQuery + "(c.identifier = $1)",
+			expectedArgs:  []any{"10001"},
+		},
+		{
+			// a chassis number shouldn't match a frame number with the same text
+			name: "IdentifierTypeAndMake",
+			input: car.GetCarInput{
+				Identifier:     "10001",
+				IdentifierType: car.IdentifierTypeChassis,
+				IdentifierMake: "Porsche",
+			},
+			expectedQuery: selectQuery + "(c.identifier = $1 AND c.identifier_type = $2 AND UPPER(c.make) = UPPER($3))",
+			expectedArgs:  []any{"10001", car.IdentifierTypeChassis, "Porsche"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+
+			db.ExpectQuery(test.expectedQuery).WithArgs(test.expectedArgs...).
+				WillReturnRows(pgxmock.NewRows(columns).AddRow(testCarId, testPublicId, "PORSCHE", "911", "",
+					int64(1965), "", car.IdentifierTypeChassis, "10001", "", time.Time{}, time.Time{}))
+
+			output, err := service.GetCar(context.TODO(), test.input)
+			require.NoError(t, err)
+			require.Equal(t, testCarId, output.Id)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,544 @@
+package car
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+// ClaimMethod is how a claim on an existing car gets resolved
+type ClaimMethod string
+
+const (
+	// ClaimMethodOwner claims are approved or rejected by the car's current owner
+	ClaimMethodOwner = ClaimMethod("owner")
+
+	// ClaimMethodEvidence claims are reviewed by an admin using the evidence the claimant
+	// submitted, ex. a photo of the title or registration. Used when the car has no current
+	// owner, or the current owner is unresponsive.
+	ClaimMethodEvidence = ClaimMethod("evidence")
+)
+
+// ownerClaimResponseWindow is how long the current owner has to respond to a claim before the
+// claimant can send it to evidence review instead
+const ownerClaimResponseWindow = 7 * 24 * time.Hour
+
+var (
+	// ErrClaimUnderReview is returned when the claim's method or evidence can't be changed because
+	// it's being reviewed, ex. the owner's response window hasn't passed, or evidence was already
+	// submitted
+	ErrClaimUnderReview = errors.New("the claim is under review")
+
+	// ErrClaimMethodChanged is returned when the claim's method changed after the reviewer was
+	// authorized for it
+	ErrClaimMethodChanged = errors.New("the claim's method changed")
+)
+
+type ClaimStatus string
+
+const (
+	ClaimStatusPending   = ClaimStatus("pending")
+	ClaimStatusApproved  = ClaimStatus("approved")
+	ClaimStatusRejected  = ClaimStatus("rejected")
+	ClaimStatusCancelled = ClaimStatus("cancelled")
+)
+
+// Claim is a request from a user to take ownership of a car that already exists in autolog.
+// An approved claim transfers the car, along with its full service history, to the claimant.
+type Claim struct {
+	id               string
+	CarId            string
+	ClaimantUserId   string
+	Method           ClaimMethod
+	Status           ClaimStatus
+	EvidenceNotes    string
+	EvidenceImageIds []string
+	ReviewedBy       string
+	ReviewedAt       *time.Time
+	ReviewNotes      string
+
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+func (c *Claim) Id() string {
+	return c.id
+}
+
+func (c *Claim) CreatedAt() time.Time {
+	return c.createdAt
+}
+
+func (c *Claim) UpdatedAt() time.Time {
+	return c.updatedAt
+}
+
+// GetCarOwner returns the user id of the current owner of the car. Returns ErrNotFound if the
+// car has no current owner.
+func (s *Service) GetCarOwner(ctx context.Context, carId string) (string, error) {
+	if s.db == nil {
+		return "", ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(carId) == "" {
+		return "", ErrInvalidArg
+	}
+
+	query := `
+	SELECT 
+		uc.user_id
+	FROM users_cars uc
+	WHERE 
+		uc.car_id = $1 AND 
+		uc.ended_at IS NULL`
+
+	var userId string
+	row := s.db.QueryRow(ctx, query, strings.TrimSpace(carId))
+	if err := row.Scan(&userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to query for car owner: %w", err)
+	}
+
+	return userId, nil
+}
+
+type CreateClaimInput struct {
+	CarId          string
+	ClaimantUserId string
+
+	// EvidenceNotes and EvidenceImageIds are optional at creation. Providing evidence up front
+	// is required when the car has no current owner to approve the claim.
+	EvidenceNotes    string
+	EvidenceImageIds []string
+}
+
+func (c *CreateClaimInput) valid() bool {
+	return strings.TrimSpace(c.CarId) != "" &&
+		strings.TrimSpace(c.ClaimantUserId) != ""
+}
+
+// CreateClaim creates a pending claim on an existing car. The claim is resolved by the current
+// owner if there is one, otherwise by evidence review. Returns ErrAlreadyExists if the user
+// already has a pending claim on the car, and ErrInvalidArg if the user already owns the car.
+func (s *Service) CreateClaim(ctx context.Context, input CreateClaimInput) (Claim, error) {
+	if s.db == nil {
+		return Claim{}, ErrMissingRequiredConfiguration
+	}
+
+	if !input.valid() {
+		return Claim{}, ErrInvalidArg
+	}
+
+	method := ClaimMethodOwner
+	ownerId, err := s.GetCarOwner(ctx, input.CarId)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return Claim{}, fmt.Errorf("failed to get car owner: %w", err)
+		}
+		method = ClaimMethodEvidence
+	}
+
+	if ownerId == strings.TrimSpace(input.ClaimantUserId) {
+		return Claim{}, ErrInvalidArg
+	}
+
+	if input.EvidenceImageIds == nil {
+		input.EvidenceImageIds = []string{}
+	}
+
+	query := `
+	INSERT INTO car_claims (car_id, claimant_user_id, method, status, evidence_notes, evidence_image_ids)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, updated_at`
+
+	claim := Claim{
+		CarId:            strings.TrimSpace(input.CarId),
+		ClaimantUserId:   strings.TrimSpace(input.ClaimantUserId),
+		Method:           method,
+		Status:           ClaimStatusPending,
+		EvidenceNotes:    input.EvidenceNotes,
+		EvidenceImageIds: input.EvidenceImageIds,
+	}
+
+	row := s.db.QueryRow(ctx, query, claim.CarId, claim.ClaimantUserId, claim.Method,
+		claim.Status, claim.EvidenceNotes, claim.EvidenceImageIds)
+	if err := row.Scan(&claim.id, &claim.createdAt, &claim.updatedAt); err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return Claim{}, ErrAlreadyExists
+		}
+		return Claim{}, fmt.Errorf("failed to insert claim: %w", err)
+	}
+
+	return claim, nil
+}
+
+const claimColumns = `
+		cc.id,
+		cc.car_id,
+		cc.claimant_user_id,
+		cc.method,
+		cc.status,
+		COALESCE(cc.evidence_notes, ''),
+		cc.evidence_image_ids,
+		COALESCE(cc.reviewed_by::text, ''),
+		cc.reviewed_at,
+		COALESCE(cc.review_notes, ''),
+		cc.created_at,
+		cc.updated_at`
+
+func scanClaim(row pgx.Row) (Claim, error) {
+	var c Claim
+	err := row.Scan(&c.id, &c.CarId, &c.ClaimantUserId, &c.Method, &c.Status,
+		&c.EvidenceNotes, &c.EvidenceImageIds, &c.ReviewedBy, &c.ReviewedAt, &c.ReviewNotes,
+		&c.createdAt, &c.updatedAt)
+	return c, err
+}
+
+func (s *Service) GetClaim(ctx context.Context, claimId string) (Claim, error) {
+	if s.db == nil {
+		return Claim{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(claimId) == "" {
+		return Claim{}, ErrInvalidArg
+	}
+
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM car_claims cc
+	WHERE cc.id = $1`, claimColumns)
+
+	claim, err := scanClaim(s.db.QueryRow(ctx, query, strings.TrimSpace(claimId)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Claim{}, ErrNotFound
+		}
+		return Claim{}, fmt.Errorf("failed to query for claim: %w", err)
+	}
+
+	return claim, nil
+}
+
+type ListClaimsInput struct {
+	// UserId is the user to list claims for
+	UserId string
+
+	// AsOwner lists the claims made on the user's cars. Otherwise, the claims the user has made
+	// are listed.
+	AsOwner bool
+
+	// Status optionally filters the claims by status
+	Status ClaimStatus
+}
+
+func (s *Service) ListClaims(ctx context.Context, input ListClaimsInput) ([]Claim, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.UserId) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(fmt.Sprintf(`
+	SELECT %s
+	FROM car_claims cc`, claimColumns))
+
+	if input.AsOwner {
+		queryBuilder.WriteString(`
+	JOIN users_cars uc ON uc.car_id = cc.car_id AND uc.ended_at IS NULL
+	WHERE 
+		uc.user_id = $1 AND 
+		cc.method = 'owner'`)
+	} else {
+		queryBuilder.WriteString(`
+	WHERE cc.claimant_user_id = $1`)
+	}
+
+	var queryArgs = []any{strings.TrimSpace(input.UserId)}
+	if input.Status != "" {
+		queryArgs = append(queryArgs, input.Status)
+		queryBuilder.WriteString(fmt.Sprintf(" AND cc.status = $%d", len(queryArgs)))
+	}
+
+	queryBuilder.WriteString(`
+	ORDER BY cc.created_at DESC`)
+
+	rows, err := s.db.Query(ctx, queryBuilder.String(), queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for claims: %w", err)
+	}
+	defer rows.Close()
+
+	var claims = []Claim{}
+	for rows.Next() {
+		claim, err := scanClaim(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan claim row: %w", err)
+		}
+		claims = append(claims, claim)
+	}
+
+	return claims, nil
+}
+
+type SubmitClaimEvidenceInput struct {
+	ClaimId string
+	UserId  string
+
+	Notes    string
+	ImageIds []string
+}
+
+// SubmitClaimEvidence attaches evidence to a pending claim, and moves it to evidence review.
+// Only the claimant can submit evidence. Owner claims only move to evidence review once the
+// owner has had ownerClaimResponseWindow to respond, and evidence can only be submitted once.
+// Returns ErrClaimUnderReview otherwise. The evidence images are expected to already be checked.
+func (s *Service) SubmitClaimEvidence(ctx context.Context, input SubmitClaimEvidenceInput) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.ClaimId) == "" ||
+		strings.TrimSpace(input.UserId) == "" ||
+		(strings.TrimSpace(input.Notes) == "" && len(input.ImageIds) == 0) {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the claim so it can't change while it's being resolved
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM car_claims cc
+	WHERE cc.id = $1
+	FOR UPDATE`, claimColumns)
+
+	claim, err := scanClaim(tx.QueryRow(ctx, query, strings.TrimSpace(input.ClaimId)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to query for claim: %w", err)
+	}
+
+	if claim.ClaimantUserId != strings.TrimSpace(input.UserId) {
+		return ErrForbidden
+	}
+
+	if claim.Status != ClaimStatusPending {
+		return ErrInvalidArg
+	}
+
+	switch claim.Method {
+	case ClaimMethodOwner:
+		if time.Since(claim.createdAt) < ownerClaimResponseWindow {
+			return ErrClaimUnderReview
+		}
+	case ClaimMethodEvidence:
+		if claim.EvidenceNotes != "" || len(claim.EvidenceImageIds) > 0 {
+			return ErrClaimUnderReview
+		}
+	}
+
+	if input.ImageIds == nil {
+		input.ImageIds = []string{}
+	}
+
+	updateQuery := `
+	UPDATE car_claims SET
+		method = $2,
+		evidence_notes = $3,
+		evidence_image_ids = $4,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, updateQuery, claim.id, ClaimMethodEvidence,
+		strings.TrimSpace(input.Notes), input.ImageIds); err != nil {
+		return fmt.Errorf("failed to update claim evidence: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+type ResolveClaimInput struct {
+	ClaimId string
+
+	// ReviewerUserId is the user approving or rejecting the claim. This is expected to already
+	// be authorized for the claim's method.
+	ReviewerUserId string
+
+	// Method is the claim's method the reviewer was authorized for. The claim isn't resolved if
+	// it has changed since.
+	Method ClaimMethod
+
+	Approve bool
+
+	Notes string
+}
+
+// ResolveClaim approves or rejects a pending claim. Approving a claim ends the current
+// owner's ownership of the car and makes the claimant the owner. The car's history is kept.
+// Returns ErrClaimMethodChanged if the claim's method isn't the one the reviewer was authorized
+// for.
+func (s *Service) ResolveClaim(ctx context.Context, input ResolveClaimInput) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.ClaimId) == "" ||
+		strings.TrimSpace(input.ReviewerUserId) == "" ||
+		input.Method == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the claim so it can't be resolved twice
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM car_claims cc
+	WHERE cc.id = $1
+	FOR UPDATE`, claimColumns)
+
+	claim, err := scanClaim(tx.QueryRow(ctx, query, strings.TrimSpace(input.ClaimId)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to query for claim: %w", err)
+	}
+
+	if claim.Status != ClaimStatusPending {
+		return ErrInvalidArg
+	}
+
+	if claim.Method != input.Method {
+		return ErrClaimMethodChanged
+	}
+
+	status := ClaimStatusRejected
+	if input.Approve {
+		status = ClaimStatusApproved
+
+		if err := transferCar(ctx, tx, claim.CarId, claim.ClaimantUserId); err != nil {
+			return fmt.Errorf("failed to transfer car: %w", err)
+		}
+	}
+
+	updateQuery := `
+	UPDATE car_claims SET
+		status = $2,
+		reviewed_by = $3,
+		reviewed_at = NOW(),
+		review_notes = $4,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, updateQuery, claim.id, status,
+		strings.TrimSpace(input.ReviewerUserId), strings.TrimSpace(input.Notes)); err != nil {
+		return fmt.Errorf("failed to update claim: %w", err)
+	}
+
+	if input.Approve {
+		// any other pending claims are moot once the car changes hands
+		rejectQuery := `
+		UPDATE car_claims SET
+			status = $2,
+			reviewed_by = $3,
+			reviewed_at = NOW(),
+			review_notes = 'car was claimed by another user',
+			updated_at = NOW()
+		WHERE 
+			car_id = $1 AND 
+			status = 'pending'`
+
+		if _, err := tx.Exec(ctx, rejectQuery, claim.CarId, ClaimStatusRejected,
+			strings.TrimSpace(input.ReviewerUserId)); err != nil {
+			return fmt.Errorf("failed to reject other pending claims: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// CancelClaim cancels a pending claim. Only the claimant can cancel their claim.
+func (s *Service) CancelClaim(ctx context.Context, claimId, userId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(claimId) == "" || strings.TrimSpace(userId) == "" {
+		return ErrInvalidArg
+	}
+
+	claim, err := s.GetClaim(ctx, claimId)
+	if err != nil {
+		return fmt.Errorf("failed to get claim: %w", err)
+	}
+
+	if claim.ClaimantUserId != strings.TrimSpace(userId) {
+		return ErrForbidden
+	}
+
+	if claim.Status != ClaimStatusPending {
+		return ErrInvalidArg
+	}
+
+	query := `
+	UPDATE car_claims SET
+		status = $2,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := s.db.Exec(ctx, query, claim.id, ClaimStatusCancelled); err != nil {
+		return fmt.Errorf("failed to cancel claim: %w", err)
+	}
+
+	return nil
+}
+
+// transferCar ends the current ownership of the car, if any, and assigns it to the user
+func transferCar(ctx context.Context, tx pgx.Tx, carId, userId string) error {
+	endQuery := `
+	UPDATE users_cars SET
+		ended_at = NOW(),
+		updated_at = NOW()
+	WHERE 
+		car_id = $1 AND 
+		ended_at IS NULL`
+
+	if _, err := tx.Exec(ctx, endQuery, carId); err != nil {
+		return fmt.Errorf("failed to end current ownership: %w", err)
+	}
+
+	if _, err := createUserCarRecord(ctx, tx, userId, carId); err != nil {
+		return fmt.Errorf("failed to create user car record: %w", err)
+	}
+
+	return nil
+}
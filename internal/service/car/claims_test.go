@@ -0,0 +1,419 @@
+package car_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const claimColumns = "cc.id, cc.car_id, cc.claimant_user_id, cc.method, cc.status, COALESCE(cc.evidence_notes, ''), " +
+	"cc.evidence_image_ids, COALESCE(cc.reviewed_by::text, ''), cc.reviewed_at, COALESCE(cc.review_notes, ''), " +
+	"cc.created_at, cc.updated_at"
+
+var claimColumnNames = []string{"id", "car_id", "claimant_user_id", "method", "status", "evidence_notes",
+	"evidence_image_ids", "reviewed_by", "reviewed_at", "review_notes", "created_at", "updated_at"}
+
+func claimRows(status car.ClaimStatus) *pgxmock.Rows {
+	return methodClaimRows(car.ClaimMethodOwner, status, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), "")
+}
+
+func methodClaimRows(method car.ClaimMethod, status car.ClaimStatus, createdAt time.Time, evidenceNotes string) *pgxmock.Rows {
+	return pgxmock.NewRows(claimColumnNames).AddRow(testClaimId, testCarId, testUserId, method,
+		status, evidenceNotes, []string{}, "", (*time.Time)(nil), "", createdAt, createdAt)
+}
+
+func TestCreateClaim(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	ownerQuery := "SELECT uc.user_id FROM users_cars uc WHERE uc.car_id = $1 AND uc.ended_at IS NULL"
+	insertQuery := "INSERT INTO car_claims (car_id, claimant_user_id, method, status, evidence_notes, evidence_image_ids) " +
+		"VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at"
+
+	input := car.CreateClaimInput{
+		CarId:          testCarId,
+		ClaimantUserId: testUserId,
+	}
+
+	tests := []struct {
+		name   string
+		input  car.CreateClaimInput
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr    error
+		expectedMethod car.ClaimMethod
+	}{
+		{
+			name:        "InvalidArg",
+			input:       car.CreateClaimInput{CarId: testCarId},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: car.ErrInvalidArg,
+		},
+		{
+			name:  "ByOwner",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(ownerQuery).WithArgs(testCarId).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(testOwnerId))
+				db.ExpectQuery(insertQuery).
+					WithArgs(testCarId, testUserId, car.ClaimMethodOwner, car.ClaimStatusPending, "", []string{}).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at", "updated_at"}).
+						AddRow(testClaimId, createdAt, createdAt))
+			},
+			expectedMethod: car.ClaimMethodOwner,
+		},
+		{
+			name:  "ByEvidence",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(ownerQuery).WithArgs(testCarId).WillReturnError(pgx.ErrNoRows)
+				db.ExpectQuery(insertQuery).
+					WithArgs(testCarId, testUserId, car.ClaimMethodEvidence, car.ClaimStatusPending, "", []string{}).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at", "updated_at"}).
+						AddRow(testClaimId, createdAt, createdAt))
+			},
+			expectedMethod: car.ClaimMethodEvidence,
+		},
+		{
+			name:  "AlreadyOwner",
+			input: car.CreateClaimInput{CarId: testCarId, ClaimantUserId: testOwnerId},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(ownerQuery).WithArgs(testCarId).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(testOwnerId))
+			},
+			expectedErr: car.ErrInvalidArg,
+		},
+		{
+			name:  "DuplicatePending",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(ownerQuery).WithArgs(testCarId).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(testOwnerId))
+				db.ExpectQuery(insertQuery).
+					WithArgs(testCarId, testUserId, car.ClaimMethodOwner, car.ClaimStatusPending, "", []string{}).
+					WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "idx_car_claims_pending"})
+			},
+			expectedErr: car.ErrAlreadyExists,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			claim, err := service.CreateClaim(context.TODO(), test.input)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testClaimId, claim.Id())
+			require.Equal(t, test.expectedMethod, claim.Method)
+			require.Equal(t, car.ClaimStatusPending, claim.Status)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestResolveClaim(t *testing.T) {
+	lockQuery := "SELECT " + claimColumns + " FROM car_claims cc WHERE cc.id = $1 FOR UPDATE"
+	endOwnershipQuery := "UPDATE users_cars SET ended_at = NOW(), updated_at = NOW() " +
+		"WHERE car_id = $1 AND ended_at IS NULL"
+	userCarQuery := "INSERT INTO users_cars (user_id, car_id) VALUES ($1, $2) RETURNING id"
+	updateQuery := "UPDATE car_claims SET status = $2, reviewed_by = $3, reviewed_at = NOW(), review_notes = $4, " +
+		"updated_at = NOW() WHERE id = $1"
+	rejectOthersQuery := "UPDATE car_claims SET status = $2, reviewed_by = $3, reviewed_at = NOW(), " +
+		"review_notes = 'car was claimed by another user', updated_at = NOW() WHERE car_id = $1 AND status = 'pending'"
+
+	input := car.ResolveClaimInput{
+		ClaimId:        testClaimId,
+		ReviewerUserId: testOwnerId,
+		Method:         car.ClaimMethodOwner,
+		Approve:        true,
+		Notes:          testReviewNote,
+	}
+
+	tests := []struct {
+		name   string
+		input  car.ResolveClaimInput
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			input:       car.ResolveClaimInput{ClaimId: testClaimId},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: car.ErrInvalidArg,
+		},
+		{
+			// the old owner's ownership is ended before the claimant becomes the owner
+			name:  "OwnerApproves",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).WillReturnRows(claimRows(car.ClaimStatusPending))
+				db.ExpectExec(endOwnershipQuery).WithArgs(testCarId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectQuery(userCarQuery).WithArgs(testUserId, testCarId).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserCarId))
+				db.ExpectExec(updateQuery).WithArgs(testClaimId, car.ClaimStatusApproved, testOwnerId, testReviewNote).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectExec(rejectOthersQuery).WithArgs(testCarId, car.ClaimStatusRejected, testOwnerId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+		{
+			name: "OwnerRejects",
+			input: car.ResolveClaimInput{
+				ClaimId:        testClaimId,
+				ReviewerUserId: testOwnerId,
+				Method:         car.ClaimMethodOwner,
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).WillReturnRows(claimRows(car.ClaimStatusPending))
+				db.ExpectExec(updateQuery).WithArgs(testClaimId, car.ClaimStatusRejected, testOwnerId, "").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+		{
+			name:  "AlreadyResolved",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).WillReturnRows(claimRows(car.ClaimStatusApproved))
+				db.ExpectRollback()
+			},
+			expectedErr: car.ErrInvalidArg,
+		},
+		{
+			name:  "NotFound",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: car.ErrNotFound,
+		},
+		{
+			// the claimant sent the claim to evidence review after the owner was authorized for it
+			name:  "MethodChanged",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).
+					WillReturnRows(methodClaimRows(car.ClaimMethodEvidence, car.ClaimStatusPending, time.Now(), "title photo"))
+				db.ExpectRollback()
+			},
+			expectedErr: car.ErrClaimMethodChanged,
+		},
+		{
+			// the claimant doesn't become the owner if the old ownership can't be ended
+			name:  "TransferError",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).WillReturnRows(claimRows(car.ClaimStatusPending))
+				db.ExpectExec(endOwnershipQuery).WithArgs(testCarId).WillReturnError(errors.New("fake db error"))
+				db.ExpectRollback()
+			},
+			expectedErr: errors.New("failed to transfer car: failed to end current ownership: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			err := service.ResolveClaim(context.TODO(), test.input)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSubmitClaimEvidence(t *testing.T) {
+	lockQuery := "SELECT " + claimColumns + " FROM car_claims cc WHERE cc.id = $1 FOR UPDATE"
+	updateQuery := "UPDATE car_claims SET method = $2, evidence_notes = $3, evidence_image_ids = $4, " +
+		"updated_at = NOW() WHERE id = $1"
+
+	input := car.SubmitClaimEvidenceInput{
+		ClaimId:  testClaimId,
+		UserId:   testUserId,
+		Notes:    "title photo",
+		ImageIds: []string{testCarId},
+	}
+
+	// the owner's response window has passed
+	longAgo := time.Now().Add(-8 * 24 * time.Hour)
+
+	tests := []struct {
+		name   string
+		input  car.SubmitClaimEvidenceInput
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			input:       car.SubmitClaimEvidenceInput{ClaimId: testClaimId, UserId: testUserId},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: car.ErrInvalidArg,
+		},
+		{
+			name:  "OwnerUnresponsive",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).
+					WillReturnRows(methodClaimRows(car.ClaimMethodOwner, car.ClaimStatusPending, longAgo, ""))
+				db.ExpectExec(updateQuery).WithArgs(testClaimId, car.ClaimMethodEvidence, "title photo", []string{testCarId}).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+		{
+			// the claim has no owner to review it, so the first evidence is welcome right away
+			name:  "FirstEvidence",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).
+					WillReturnRows(methodClaimRows(car.ClaimMethodEvidence, car.ClaimStatusPending, time.Now(), ""))
+				db.ExpectExec(updateQuery).WithArgs(testClaimId, car.ClaimMethodEvidence, "title photo", []string{testCarId}).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+		{
+			name:  "OwnerStillReviewing",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).
+					WillReturnRows(methodClaimRows(car.ClaimMethodOwner, car.ClaimStatusPending, time.Now(), ""))
+				db.ExpectRollback()
+			},
+			expectedErr: car.ErrClaimUnderReview,
+		},
+		{
+			name:  "EvidenceAlreadySubmitted",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).
+					WillReturnRows(methodClaimRows(car.ClaimMethodEvidence, car.ClaimStatusPending, longAgo, "registration"))
+				db.ExpectRollback()
+			},
+			expectedErr: car.ErrClaimUnderReview,
+		},
+		{
+			name: "NotClaimant",
+			input: car.SubmitClaimEvidenceInput{
+				ClaimId: testClaimId,
+				UserId:  testOwnerId,
+				Notes:   "title photo",
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(lockQuery).WithArgs(testClaimId).
+					WillReturnRows(methodClaimRows(car.ClaimMethodOwner, car.ClaimStatusPending, longAgo, ""))
+				db.ExpectRollback()
+			},
+			expectedErr: car.ErrForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			err := service.SubmitClaimEvidence(context.TODO(), test.input)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCancelClaim(t *testing.T) {
+	getQuery := "SELECT " + claimColumns + " FROM car_claims cc WHERE cc.id = $1"
+	cancelQuery := "UPDATE car_claims SET status = $2, updated_at = NOW() WHERE id = $1"
+
+	tests := []struct {
+		name   string
+		userId string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:   "Cancelled",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(getQuery).WithArgs(testClaimId).WillReturnRows(claimRows(car.ClaimStatusPending))
+				db.ExpectExec(cancelQuery).WithArgs(testClaimId, car.ClaimStatusCancelled).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+		},
+		{
+			name:   "NotClaimant",
+			userId: testOwnerId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(getQuery).WithArgs(testClaimId).WillReturnRows(claimRows(car.ClaimStatusPending))
+			},
+			expectedErr: car.ErrForbidden,
+		},
+		{
+			name:   "NotPending",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(getQuery).WithArgs(testClaimId).WillReturnRows(claimRows(car.ClaimStatusRejected))
+			},
+			expectedErr: car.ErrInvalidArg,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			err := service.CancelClaim(context.TODO(), testClaimId, test.userId)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+				require.NoError(t, db.ExpectationsWereMet())
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package car
+
+import (
+	"strings"
+	"unicode"
+)
+
+// IdentifierType is how a car is identified. Cars built for the US market since 1981 have a
+// 17 character VIN that NHTSA can decode. Older cars, and cars imported from other markets,
+// are identified by whatever number the manufacturer stamped on them.
+type IdentifierType string
+
+const (
+	// IdentifierTypeVIN is a 17 character VIN, verified by a NHTSA decode
+	IdentifierTypeVIN = IdentifierType("vin")
+
+	// IdentifierTypeChassis is a manufacturer chassis number, ex. a pre-1981 Porsche
+	IdentifierTypeChassis = IdentifierType("chassis")
+
+	// IdentifierTypeShortVIN is a pre-1981 VIN, typically 11 to 13 characters
+	IdentifierTypeShortVIN = IdentifierType("short_vin")
+
+	// IdentifierTypeFrame is a frame number, ex. a Japanese domestic market import
+	IdentifierTypeFrame = IdentifierType("frame")
+)
+
+const (
+	vinLength = 17
+
+	// alternate identifiers vary by manufacturer and era. These bounds reject obvious junk
+	// while allowing the short numbers used on early cars.
+	minAlternateIdentifierLength = 4
+	maxAlternateIdentifierLength = 30
+)
+
+// Valid checks if the identifier type is known. An empty type is treated as a VIN.
+func (i IdentifierType) Valid() bool {
+	switch i {
+	case "", IdentifierTypeVIN, IdentifierTypeChassis, IdentifierTypeShortVIN, IdentifierTypeFrame:
+		return true
+	}
+	return false
+}
+
+// Verified is true when the identifier is a VIN that was decoded by NHTSA. Cars with any other
+// identifier are shown as having an unverified VIN.
+func (i IdentifierType) Verified() bool {
+	return i == "" || i == IdentifierTypeVIN
+}
+
+// normalizeIdentifier upper cases the identifier and strips the spaces and dashes commonly
+// used when writing out chassis and frame numbers, ex. "KGC10 - 123456" -> "KGC10123456"
+func normalizeIdentifier(identifier string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, identifier)
+}
+
+// validAlternateIdentifier checks an identifier that isn't a 17 character VIN. Identifiers
+// must be letters and digits only once normalized.
+func validAlternateIdentifier(identifier string) bool {
+	identifier = normalizeIdentifier(identifier)
+	if len(identifier) < minAlternateIdentifierLength || len(identifier) > maxAlternateIdentifierLength {
+		return false
+	}
+
+	for _, r := range identifier {
+		if !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
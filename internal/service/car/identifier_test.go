@@ -0,0 +1,86 @@
+package car
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifierType(t *testing.T) {
+	tests := []struct {
+		identifierType IdentifierType
+		valid          bool
+		verified       bool
+	}{
+		{identifierType: "", valid: true, verified: true},
+		{identifierType: IdentifierTypeVIN, valid: true, verified: true},
+		{identifierType: IdentifierTypeChassis, valid: true, verified: false},
+		{identifierType: IdentifierTypeShortVIN, valid: true, verified: false},
+		{identifierType: IdentifierTypeFrame, valid: true, verified: false},
+		{identifierType: "plate", valid: false, verified: false},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.identifierType), func(t *testing.T) {
+			require.Equal(t, test.valid, test.identifierType.Valid())
+			require.Equal(t, test.verified, test.identifierType.Verified())
+		})
+	}
+}
+
+func TestNormalizeIdentifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Chassis", input: "911 0 123 456", expected: "9110123456"},
+		{name: "ShortVIN", input: "ab123c456789", expected: "AB123C456789"},
+		{name: "Frame", input: "KGC10 - 123456", expected: "KGC10123456"},
+		{name: "Whitespace", input: " \tbnr32-300001\n", expected: "BNR32300001"},
+		{name: "Empty", input: "", expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, normalizeIdentifier(test.input))
+		})
+	}
+}
+
+func TestValidAlternateIdentifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		identifier string
+		valid      bool
+	}{
+		// chassis numbers
+		{name: "Chassis", identifier: "9110123456", valid: true},
+		{name: "ChassisSpaced", identifier: "911 0 123 456", valid: true},
+		{name: "ChassisShortest", identifier: "1234", valid: true},
+		{name: "ChassisTooShort", identifier: "123", valid: false},
+		{name: "ChassisTooShortOnceNormalized", identifier: "1-2 3", valid: false},
+
+		// pre-1981 short VINs
+		{name: "ShortVIN", identifier: "5R08C100001", valid: true},
+		{name: "ShortVINLowerCase", identifier: "124379n600001", valid: true},
+		{name: "ShortVINPunctuation", identifier: "124379N6.0001", valid: false},
+
+		// frame numbers
+		{name: "Frame", identifier: "KGC10-123456", valid: true},
+		{name: "FrameSpaced", identifier: "BNR32 - 300001", valid: true},
+		{name: "FrameLongest", identifier: "ABCDEFGHIJ0123456789ABCDEFGHIJ", valid: true},
+		{name: "FrameTooLong", identifier: "ABCDEFGHIJ0123456789ABCDEFGHIJK", valid: false},
+		{name: "FrameSlash", identifier: "KGC10/123456", valid: false},
+		{name: "FrameNonASCII", identifier: "KGC10ÄÖ1234", valid: false},
+
+		{name: "Empty", identifier: "", valid: false},
+		{name: "Whitespace", identifier: "   ", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.valid, validAlternateIdentifier(test.identifier))
+		})
+	}
+}
@@ -153,7 +153,7 @@ func createNHTSAVPICDataRecord(ctx context.Context, tx pgx.Tx, input NHTSAVPICDa
 		$39)`
 
 	if _, err := tx.Exec(ctx, query,
-		input.CarId,
+		input.carId,
 		input.VIN,
 		input.Make,
 		input.Model,
@@ -0,0 +1,263 @@
+package car
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DiscrepancyField is a user entered car detail that can be compared to the NHTSA decode
+type DiscrepancyField string
+
+const (
+	DiscrepancyFieldYear  = DiscrepancyField("year")
+	DiscrepancyFieldMake  = DiscrepancyField("make")
+	DiscrepancyFieldModel = DiscrepancyField("model")
+	DiscrepancyFieldTrim  = DiscrepancyField("trim")
+)
+
+// DiscrepancyReason describes why a user entered value was flagged
+type DiscrepancyReason string
+
+const (
+	// DiscrepancyReasonMismatch is when the user entered value is different from NHTSA's
+	DiscrepancyReasonMismatch = DiscrepancyReason("mismatch")
+
+	// DiscrepancyReasonTypo is when the user entered value is close to, but not the same as
+	// NHTSA's. Ex. "Toyta" vs "TOYOTA"
+	DiscrepancyReasonTypo = DiscrepancyReason("typo")
+
+	// DiscrepancyReasonUnknownTrim is when the user entered a trim NHTSA doesn't have on record
+	// for the VIN
+	DiscrepancyReasonUnknownTrim = DiscrepancyReason("unknown-trim")
+
+	// DiscrepancyReasonMissing is when the user left a value empty that NHTSA knows. This is
+	// informational only.
+	DiscrepancyReasonMissing = DiscrepancyReason("missing")
+)
+
+// Discrepancy is a difference between a user entered car detail and the NHTSA decode of the VIN
+type Discrepancy struct {
+	Field     DiscrepancyField
+	Provided  string
+	Suggested string
+	Reason    DiscrepancyReason
+}
+
+// Blocking indicates the discrepancy is an actual conflict with the NHTSA data, rather than
+// missing info.
+func (d *Discrepancy) Blocking() bool {
+	return d.Reason != DiscrepancyReasonMissing
+}
+
+// maxTypoDistance is the max edit distance between two values for them to be considered a typo
+// rather than a mismatch
+const maxTypoDistance = 2
+
+// minContainedDetailLength is the min length of a value for it to match a longer value containing
+// it, otherwise a single letter like "S" would match most models
+const minContainedDetailLength = 3
+
+// ReconcileWithNHTSA compares the user entered details of a car with the NHTSA decode of it's VIN.
+// Returns any discrepancies found, with NHTSA's values as the suggested values.
+func ReconcileWithNHTSA(c Car, nhtsaData NHTSAVPICData) []Discrepancy {
+	var discrepancies []Discrepancy
+
+	if nhtsaData.Year > 0 && c.Year != nhtsaData.Year {
+		discrepancies = append(discrepancies, Discrepancy{
+			Field:     DiscrepancyFieldYear,
+			Provided:  strconv.FormatInt(c.Year, 10),
+			Suggested: strconv.FormatInt(nhtsaData.Year, 10),
+			Reason:    DiscrepancyReasonMismatch,
+		})
+	}
+
+	if d, ok := compareDetail(DiscrepancyFieldMake, c.Make, nhtsaData.Make); ok {
+		discrepancies = append(discrepancies, d)
+	}
+
+	if d, ok := compareDetail(DiscrepancyFieldModel, c.Model, nhtsaData.Model); ok {
+		discrepancies = append(discrepancies, d)
+	}
+
+	if d, ok := compareTrim(c.Trim, nhtsaData.Trim, nhtsaData.Trim2); ok {
+		discrepancies = append(discrepancies, d)
+	}
+
+	return discrepancies
+}
+
+// ApplySuggestions sets the NHTSA suggested values of the discrepancies on the car
+func ApplySuggestions(c *Car, discrepancies []Discrepancy) {
+	for _, d := range discrepancies {
+		switch d.Field {
+		case DiscrepancyFieldYear:
+			if year, err := strconv.ParseInt(d.Suggested, 10, 64); err == nil {
+				c.Year = year
+			}
+		case DiscrepancyFieldMake:
+			c.Make = d.Suggested
+		case DiscrepancyFieldModel:
+			c.Model = d.Suggested
+		case DiscrepancyFieldTrim:
+			c.Trim = d.Suggested
+		}
+	}
+}
+
+func compareDetail(field DiscrepancyField, provided, decoded string) (Discrepancy, bool) {
+	normalizedProvided := normalizeDetail(provided)
+	normalizedDecoded := normalizeDetail(decoded)
+
+	if normalizedDecoded == "" {
+		// nothing to compare against
+		return Discrepancy{}, false
+	}
+
+	d := Discrepancy{
+		Field:     field,
+		Provided:  strings.TrimSpace(provided),
+		Suggested: strings.TrimSpace(decoded),
+	}
+
+	switch {
+	case normalizedProvided == "":
+		d.Reason = DiscrepancyReasonMissing
+	case normalizedProvided == normalizedDecoded,
+		// ex. "Supra" vs "GR Supra"
+		containsDetail(normalizedDecoded, normalizedProvided),
+		containsDetail(normalizedProvided, normalizedDecoded):
+		return Discrepancy{}, false
+	case levenshtein(normalizedProvided, normalizedDecoded) <= maxTypoDistance:
+		d.Reason = DiscrepancyReasonTypo
+	default:
+		d.Reason = DiscrepancyReasonMismatch
+	}
+
+	return d, true
+}
+
+func compareTrim(provided string, decodedTrims ...string) (Discrepancy, bool) {
+	normalizedProvided := normalizeDetail(provided)
+
+	var known []string
+	for _, trim := range decodedTrims {
+		if normalizeDetail(trim) != "" {
+			known = append(known, strings.TrimSpace(trim))
+		}
+	}
+
+	if len(known) == 0 {
+		// NHTSA doesn't have trims for every vehicle, nothing to compare against
+		return Discrepancy{}, false
+	}
+
+	d := Discrepancy{
+		Field:     DiscrepancyFieldTrim,
+		Provided:  strings.TrimSpace(provided),
+		Suggested: known[0],
+	}
+
+	if normalizedProvided == "" {
+		d.Reason = DiscrepancyReasonMissing
+		return d, true
+	}
+
+	for _, trim := range known {
+		normalizedTrim := normalizeDetail(trim)
+		if normalizedProvided == normalizedTrim {
+			return Discrepancy{}, false
+		}
+		if levenshtein(normalizedProvided, normalizedTrim) <= maxTypoDistance {
+			d.Suggested = trim
+			d.Reason = DiscrepancyReasonTypo
+			return d, true
+		}
+	}
+
+	d.Reason = DiscrepancyReasonUnknownTrim
+	return d, true
+}
+
+// containsDetail reports whether the normalized value contains the normalized substr, which has
+// to be long enough to not match by chance
+func containsDetail(value, substr string) bool {
+	return len([]rune(substr)) >= minContainedDetailLength && strings.Contains(value, substr)
+}
+
+// normalizeDetail lower cases the value and strips everything but letters and digits
+func normalizeDetail(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(value)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// FieldOverride records a car detail where the user kept their own value over NHTSA's
+type FieldOverride struct {
+	Field         DiscrepancyField
+	ProvidedValue string
+	NHTSAValue    string
+	Reason        DiscrepancyReason
+}
+
+func createFieldOverrideRecords(ctx context.Context, tx pgx.Tx, carId, userId string, overrides []FieldOverride) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	var query strings.Builder
+	query.WriteString(`
+	INSERT INTO car_field_overrides (car_id, field, provided_value, nhtsa_value, reason, created_by)
+	VALUES `)
+
+	var args = []any{}
+	for i, o := range overrides {
+		args = append(args, carId, o.Field, o.ProvidedValue, o.NHTSAValue, o.Reason, userId)
+
+		query.WriteString(fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)",
+			len(args)-5, len(args)-4, len(args)-3, len(args)-2, len(args)-1, len(args)))
+
+		if i != len(overrides)-1 {
+			query.WriteString(",\n")
+		}
+	}
+
+	if _, err := tx.Exec(ctx, query.String(), args...); err != nil {
+		return fmt.Errorf("failed to insert field overrides: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package car_test
+
+import (
+	"testing"
+
+	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileWithNHTSA(t *testing.T) {
+	nhtsaData := car.NHTSAVPICData{
+		Make:  "TOYOTA",
+		Model: "GR Supra",
+		Year:  2022,
+		Trim:  "3.0",
+	}
+
+	tests := []struct {
+		name     string
+		input    car.Car
+		nhtsa    car.NHTSAVPICData
+		expected []car.Discrepancy
+	}{
+		{
+			name:     "Match",
+			input:    car.Car{Make: "Toyota", Model: "Supra", Year: 2022, Trim: "3.0"},
+			nhtsa:    nhtsaData,
+			expected: nil,
+		},
+		{
+			name:  "WrongYear",
+			input: car.Car{Make: "Toyota", Model: "Supra", Year: 2021, Trim: "3.0"},
+			nhtsa: nhtsaData,
+			expected: []car.Discrepancy{
+				{Field: car.DiscrepancyFieldYear, Provided: "2021", Suggested: "2022", Reason: car.DiscrepancyReasonMismatch},
+			},
+		},
+		{
+			name:  "MakeTypo",
+			input: car.Car{Make: "Toyta", Model: "Supra", Year: 2022, Trim: "3.0"},
+			nhtsa: nhtsaData,
+			expected: []car.Discrepancy{
+				{Field: car.DiscrepancyFieldMake, Provided: "Toyta", Suggested: "TOYOTA", Reason: car.DiscrepancyReasonTypo},
+			},
+		},
+		{
+			name:  "ModelMismatch",
+			input: car.Car{Make: "Toyota", Model: "Celica", Year: 2022, Trim: "3.0"},
+			nhtsa: nhtsaData,
+			expected: []car.Discrepancy{
+				{Field: car.DiscrepancyFieldModel, Provided: "Celica", Suggested: "GR Supra", Reason: car.DiscrepancyReasonMismatch},
+			},
+		},
+		{
+			name:  "ShortModel",
+			input: car.Car{Make: "Toyota", Model: "S", Year: 2022, Trim: "3.0"},
+			nhtsa: nhtsaData,
+			expected: []car.Discrepancy{
+				{Field: car.DiscrepancyFieldModel, Provided: "S", Suggested: "GR Supra", Reason: car.DiscrepancyReasonMismatch},
+			},
+		},
+		{
+			name:  "UnknownTrim",
+			input: car.Car{Make: "Toyota", Model: "Supra", Year: 2022, Trim: "A91 Edition"},
+			nhtsa: nhtsaData,
+			expected: []car.Discrepancy{
+				{Field: car.DiscrepancyFieldTrim, Provided: "A91 Edition", Suggested: "3.0", Reason: car.DiscrepancyReasonUnknownTrim},
+			},
+		},
+		{
+			name:  "MissingTrim",
+			input: car.Car{Make: "Toyota", Model: "Supra", Year: 2022},
+			nhtsa: nhtsaData,
+			expected: []car.Discrepancy{
+				{Field: car.DiscrepancyFieldTrim, Provided: "", Suggested: "3.0", Reason: car.DiscrepancyReasonMissing},
+			},
+		},
+		{
+			name:     "NoNHTSAData",
+			input:    car.Car{Make: "Toyota", Model: "Supra", Year: 2022, Trim: "3.0"},
+			nhtsa:    car.NHTSAVPICData{},
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, car.ReconcileWithNHTSA(test.input, test.nhtsa))
+		})
+	}
+}
+
+func TestApplySuggestions(t *testing.T) {
+	c := car.Car{Make: "Toyta", Model: "Supra", Year: 2021}
+
+	car.ApplySuggestions(&c, []car.Discrepancy{
+		{Field: car.DiscrepancyFieldYear, Suggested: "2022"},
+		{Field: car.DiscrepancyFieldMake, Suggested: "TOYOTA"},
+		{Field: car.DiscrepancyFieldTrim, Suggested: "3.0"},
+	})
+
+	require.Equal(t, car.Car{Make: "TOYOTA", Model: "Supra", Year: 2022, Trim: "3.0"}, c)
+}
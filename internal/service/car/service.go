@@ -12,6 +12,10 @@ var (
 	ErrMissingRequiredConfiguration = errors.New("auth service is missing required configurations to perform this operation")
 
 	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	ErrAlreadyExists = errors.New("the resource already exists")
+
+	ErrForbidden = errors.New("the user is not allowed to perform this operation")
 )
 
 type ServiceConfig struct {
@@ -27,10 +31,24 @@ type ServiceConfig struct {
 
 type ServiceIface interface {
 	CreateServiceLog(ctx context.Context, serviceLog ServiceLog, userId, carId string) (string, error)
-	CreateCar(ctx context.Context, userId string, car Car, nhtsaData NHTSAVPICData) error
+	CreateCar(ctx context.Context, input CreateCarInput) (Car, error)
 	GetCar(ctx context.Context, input GetCarInput) (GetCarOutput, error)
 
 	GetServiceLogSummary(ctx context.Context, carId string) (ServiceLogSummary, error)
+
+	GetVehicleSpec(ctx context.Context, carId string) (VehicleSpec, error)
+	BackfillVehicleSpecs(ctx context.Context) (int64, error)
+
+	GetCarOwner(ctx context.Context, carId string) (string, error)
+
+	CreateClaim(ctx context.Context, input CreateClaimInput) (Claim, error)
+	GetClaim(ctx context.Context, claimId string) (Claim, error)
+	ListClaims(ctx context.Context, input ListClaimsInput) ([]Claim, error)
+	SubmitClaimEvidence(ctx context.Context, input SubmitClaimEvidenceInput) error
+	ResolveClaim(ctx context.Context, input ResolveClaimInput) error
+	CancelClaim(ctx context.Context, claimId, userId string) error
+
+	DeleteUserData(ctx context.Context, userId string) error
 }
 
 type Service struct {
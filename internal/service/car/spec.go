@@ -0,0 +1,672 @@
+package car
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	nhtsavpic "github.com/keola-dunn/autolog/internal/nhtsa"
+)
+
+// DriveType is the normalized drive type of a vehicle
+type DriveType string
+
+const (
+	DriveTypeFWD     = DriveType("fwd")
+	DriveTypeRWD     = DriveType("rwd")
+	DriveTypeAWD     = DriveType("awd")
+	DriveType4WD     = DriveType("4wd")
+	DriveType2WD     = DriveType("2wd")
+	DriveTypeUnknown = DriveType("unknown")
+)
+
+// FuelType is the normalized fuel type of a vehicle
+type FuelType string
+
+const (
+	FuelTypeGasoline = FuelType("gasoline")
+	FuelTypeDiesel   = FuelType("diesel")
+	FuelTypeElectric = FuelType("electric")
+	FuelTypeFlexFuel = FuelType("flex-fuel")
+	FuelTypeEthanol  = FuelType("ethanol")
+	FuelTypeCNG      = FuelType("cng")
+	FuelTypeLPG      = FuelType("lpg")
+	FuelTypeHydrogen = FuelType("hydrogen")
+	FuelTypeUnknown  = FuelType("unknown")
+)
+
+// TransmissionType is the normalized transmission style of a vehicle
+type TransmissionType string
+
+const (
+	TransmissionTypeAutomatic       = TransmissionType("automatic")
+	TransmissionTypeManual          = TransmissionType("manual")
+	TransmissionTypeCVT             = TransmissionType("cvt")
+	TransmissionTypeDCT             = TransmissionType("dct")
+	TransmissionTypeAutomatedManual = TransmissionType("automated-manual")
+	TransmissionTypeUnknown         = TransmissionType("unknown")
+)
+
+// Range is a numeric spec that NHTSA may report as a single value or as a range, ex. horsepower
+// "255" to "300" or a GVWR class. Either end may be nil if unknown. A single value is
+// reported as Min == Max.
+type Range struct {
+	Min *float64
+	Max *float64
+}
+
+func (r Range) IsZero() bool {
+	return r.Min == nil && r.Max == nil
+}
+
+// SpecSource is where a vehicle spec came from
+type SpecSource string
+
+const (
+	// SpecSourceNHTSA specs are decoded from the VIN by NHTSA vPIC
+	SpecSourceNHTSA = SpecSource("nhtsa")
+
+	// SpecSourceUser specs are entered by the user, for cars NHTSA can't decode
+	SpecSourceUser = SpecSource("user")
+)
+
+// VehicleSpec is the typed, unit-normalized version of the specs NHTSA reports for a vehicle.
+// All measurements are stored in metric units.
+type VehicleSpec struct {
+	carId string
+
+	Source SpecSource
+
+	DisplacementLiters *float64
+	EngineCylinders    *int64
+	PowerKW            Range
+	Turbo              bool
+
+	DriveType          DriveType
+	FuelTypePrimary    FuelType
+	FuelTypeSecondary  FuelType
+	TransmissionType   TransmissionType
+	TransmissionSpeeds *int64
+
+	WheelbaseMM  Range
+	TrackWidthMM *float64
+	CurbWeightKg *float64
+	GVWRKg       Range
+
+	// WheelSizeFrontInches and WheelSizeRearInches are the wheel diameters. Wheels are sized
+	// in inches regardless of unit system.
+	WheelSizeFrontInches *float64
+	WheelSizeRearInches  *float64
+
+	Doors    *int64
+	Seats    *int64
+	SeatRows *int64
+
+	BatteryKWh Range
+
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+func (v *VehicleSpec) CarId() string {
+	return v.carId
+}
+
+const (
+	litersToCubicInches = 61.0237
+	kilowattsToHP       = 1.34102
+	millimetersPerInch  = 25.4
+	kilogramsPerPound   = 0.45359237
+)
+
+func LitersToCubicInches(liters float64) float64 {
+	return liters * litersToCubicInches
+}
+
+func CubicInchesToLiters(cubicInches float64) float64 {
+	return cubicInches / litersToCubicInches
+}
+
+func KilowattsToHorsepower(kw float64) float64 {
+	return kw * kilowattsToHP
+}
+
+func HorsepowerToKilowatts(hp float64) float64 {
+	return hp / kilowattsToHP
+}
+
+func MillimetersToInches(mm float64) float64 {
+	return mm / millimetersPerInch
+}
+
+func InchesToMillimeters(inches float64) float64 {
+	return inches * millimetersPerInch
+}
+
+func KilogramsToPounds(kg float64) float64 {
+	return kg / kilogramsPerPound
+}
+
+func PoundsToKilograms(lb float64) float64 {
+	return lb * kilogramsPerPound
+}
+
+// NewVehicleSpec builds a VehicleSpec from a NHTSA vPIC flat decode result. Values NHTSA
+// doesn't know, or reports as "Not Applicable", are left nil/unknown.
+func NewVehicleSpec(result nhtsavpic.DecodeVINFlatResult) VehicleSpec {
+	spec := VehicleSpec{
+		Source: SpecSourceNHTSA,
+
+		DisplacementLiters: parseSpecFloat(result.DisplacementL),
+		EngineCylinders:    parseSpecInt(result.EngineCylinders),
+		Turbo:              strings.EqualFold(strings.TrimSpace(result.Turbo), "yes"),
+
+		DriveType:          parseDriveType(result.DriveType),
+		FuelTypePrimary:    parseFuelType(result.FuelTypePrimary),
+		FuelTypeSecondary:  parseFuelType(result.FuelTypeSecondary),
+		TransmissionType:   parseTransmissionType(result.TransmissionStyle),
+		TransmissionSpeeds: parseSpecInt(result.TransmissionSpeeds),
+
+		WheelSizeFrontInches: parseSpecFloat(result.WheelSizeFront),
+		WheelSizeRearInches:  parseSpecFloat(result.WheelSizeRear),
+
+		Doors:    parseSpecInt(result.Doors),
+		Seats:    parseSpecInt(result.Seats),
+		SeatRows: parseSpecInt(result.SeatRows),
+
+		BatteryKWh: parseSpecRange(result.BatteryKWh, result.BatteryKWh_to),
+	}
+
+	if spec.DisplacementLiters == nil {
+		// fall back to cc when liters aren't reported
+		if cc := parseSpecFloat(result.DisplacementCC); cc != nil {
+			liters := *cc / 1000
+			spec.DisplacementLiters = &liters
+		}
+	}
+
+	// horsepower is reported more often than kW, prefer it when available
+	if hp := parseSpecRange(result.EngineHP, result.EngineHP_to); !hp.IsZero() {
+		spec.PowerKW = convertRange(hp, HorsepowerToKilowatts)
+	} else {
+		spec.PowerKW = parseSpecRange(result.EngineKW, "")
+	}
+
+	// NHTSA reports wheelbase in inches, as a short and long value for vehicles offered in
+	// multiple wheelbases
+	spec.WheelbaseMM = convertRange(parseSpecRange(result.WheelBaseShort, result.WheelBaseLong), InchesToMillimeters)
+
+	if trackWidth := parseSpecFloat(result.TrackWidth); trackWidth != nil {
+		mm := InchesToMillimeters(*trackWidth)
+		spec.TrackWidthMM = &mm
+	}
+
+	if curbWeight := parseSpecFloat(result.CurbWeightLB); curbWeight != nil {
+		kg := PoundsToKilograms(*curbWeight)
+		spec.CurbWeightKg = &kg
+	}
+
+	spec.GVWRKg = convertRange(parseGVWRClass(result.GVWR, result.GVWR_to), PoundsToKilograms)
+
+	return spec
+}
+
+// UserVehicleSpecInput is a spec entered by a user for a car NHTSA can't decode. Measurements
+// are metric. Drive, fuel and transmission types are free text, ex. "rear wheel drive".
+type UserVehicleSpecInput struct {
+	DisplacementLiters *float64
+	EngineCylinders    *int64
+	PowerKW            *float64
+	Turbo              bool
+
+	DriveType          string
+	FuelType           string
+	TransmissionType   string
+	TransmissionSpeeds *int64
+
+	WheelbaseMM  *float64
+	CurbWeightKg *float64
+
+	Doors *int64
+	Seats *int64
+}
+
+// NewUserVehicleSpec builds a VehicleSpec from user supplied values
+func NewUserVehicleSpec(input UserVehicleSpecInput) VehicleSpec {
+	return VehicleSpec{
+		Source: SpecSourceUser,
+
+		DisplacementLiters: input.DisplacementLiters,
+		EngineCylinders:    input.EngineCylinders,
+		PowerKW:            Range{Min: input.PowerKW, Max: input.PowerKW},
+		Turbo:              input.Turbo,
+
+		DriveType:          parseDriveType(input.DriveType),
+		FuelTypePrimary:    parseFuelType(input.FuelType),
+		FuelTypeSecondary:  FuelTypeUnknown,
+		TransmissionType:   parseTransmissionType(input.TransmissionType),
+		TransmissionSpeeds: input.TransmissionSpeeds,
+
+		WheelbaseMM:  Range{Min: input.WheelbaseMM, Max: input.WheelbaseMM},
+		CurbWeightKg: input.CurbWeightKg,
+
+		Doors: input.Doors,
+		Seats: input.Seats,
+	}
+}
+
+// notApplicableValues are the values NHTSA uses to indicate a spec is unknown
+var notApplicableValues = []string{"", "not applicable", "n/a", "na", "unknown", "null"}
+
+func isNotApplicable(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, na := range notApplicableValues {
+		if value == na {
+			return true
+		}
+	}
+	return false
+}
+
+var specNumberRegex = regexp.MustCompile(`-?\d[\d,]*(\.\d+)?`)
+
+// parseSpecFloat parses the first number in a NHTSA value, ex. "2.0", "1,500" or "255 HP".
+// Returns nil if the value is empty, not applicable, or doesn't contain a number.
+func parseSpecFloat(value string) *float64 {
+	if isNotApplicable(value) {
+		return nil
+	}
+
+	match := specNumberRegex.FindString(value)
+	if match == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(strings.ReplaceAll(match, ",", ""), 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+func parseSpecInt(value string) *int64 {
+	f := parseSpecFloat(value)
+	if f == nil {
+		return nil
+	}
+	i := int64(*f)
+	return &i
+}
+
+// parseSpecRange parses a NHTSA from/to value pair. The from value itself may be a range,
+// ex. "108.0 - 112.0". A single value results in a Range where Min == Max.
+func parseSpecRange(from, to string) Range {
+	var r Range
+
+	if !isNotApplicable(from) {
+		numbers := specNumberRegex.FindAllString(from, -1)
+		if len(numbers) >= 2 && strings.Contains(from, " - ") {
+			r.Min = parseSpecFloat(numbers[0])
+			r.Max = parseSpecFloat(numbers[1])
+		} else {
+			r.Min = parseSpecFloat(from)
+		}
+	}
+
+	if r.Max == nil {
+		r.Max = parseSpecFloat(to)
+	}
+
+	if r.Max == nil {
+		r.Max = r.Min
+	}
+	if r.Min == nil {
+		r.Min = r.Max
+	}
+
+	return r
+}
+
+// parseGVWRClass parses the pounds range out of a NHTSA GVWR class, ex.
+// "Class 2E: 6,001 - 7,000 lb (2,722 - 3,175 kg)" or "Class 1: 6,000 lb or less (2,722 kg or less)".
+// The to value is used as the upper bound if provided.
+func parseGVWRClass(class, to string) Range {
+	var r Range
+	if isNotApplicable(class) {
+		return r
+	}
+
+	// ignore the metric values in parentheses and the class number
+	value := class
+	if i := strings.Index(value, "("); i >= 0 {
+		value = value[:i]
+	}
+	if i := strings.Index(value, ":"); i >= 0 {
+		value = value[i+1:]
+	}
+
+	numbers := specNumberRegex.FindAllString(value, -1)
+	lower := strings.ToLower(value)
+	switch {
+	case len(numbers) >= 2:
+		r.Min = parseSpecFloat(numbers[0])
+		r.Max = parseSpecFloat(numbers[1])
+	case len(numbers) == 1 && strings.Contains(lower, "or less"):
+		r.Max = parseSpecFloat(numbers[0])
+	case len(numbers) == 1 && (strings.Contains(lower, "and above") || strings.Contains(lower, "or more")):
+		r.Min = parseSpecFloat(numbers[0])
+	case len(numbers) == 1:
+		r.Min = parseSpecFloat(numbers[0])
+		r.Max = r.Min
+	}
+
+	if toRange := parseGVWRClass(to, ""); toRange.Max != nil {
+		r.Max = toRange.Max
+	}
+
+	return r
+}
+
+func convertRange(r Range, convert func(float64) float64) Range {
+	var out Range
+	if r.Min != nil {
+		min := convert(*r.Min)
+		out.Min = &min
+	}
+	if r.Max != nil {
+		max := convert(*r.Max)
+		out.Max = &max
+	}
+	return out
+}
+
+func parseDriveType(value string) DriveType {
+	value = strings.ToLower(value)
+	switch {
+	case isNotApplicable(value):
+		return DriveTypeUnknown
+	case strings.Contains(value, "fwd") || strings.Contains(value, "front-wheel") || strings.Contains(value, "front wheel"):
+		return DriveTypeFWD
+	case strings.Contains(value, "rwd") || strings.Contains(value, "rear-wheel") || strings.Contains(value, "rear wheel"):
+		return DriveTypeRWD
+	case strings.Contains(value, "awd") || strings.Contains(value, "all-wheel") || strings.Contains(value, "all wheel"):
+		return DriveTypeAWD
+	case strings.Contains(value, "4wd") || strings.Contains(value, "4x4") || strings.Contains(value, "4-wheel"):
+		return DriveType4WD
+	case strings.Contains(value, "4x2") || strings.Contains(value, "2wd"):
+		return DriveType2WD
+	}
+	return DriveTypeUnknown
+}
+
+func parseFuelType(value string) FuelType {
+	value = strings.ToLower(value)
+	switch {
+	case isNotApplicable(value):
+		return FuelTypeUnknown
+	case strings.Contains(value, "flexible") || strings.Contains(value, "ffv"):
+		return FuelTypeFlexFuel
+	case strings.Contains(value, "gasoline"):
+		return FuelTypeGasoline
+	case strings.Contains(value, "diesel"):
+		return FuelTypeDiesel
+	case strings.Contains(value, "electric"):
+		return FuelTypeElectric
+	case strings.Contains(value, "ethanol") || strings.Contains(value, "e85"):
+		return FuelTypeEthanol
+	case strings.Contains(value, "cng") || strings.Contains(value, "compressed natural gas"):
+		return FuelTypeCNG
+	case strings.Contains(value, "lpg") || strings.Contains(value, "propane"):
+		return FuelTypeLPG
+	case strings.Contains(value, "hydrogen") || strings.Contains(value, "fuel cell"):
+		return FuelTypeHydrogen
+	}
+	return FuelTypeUnknown
+}
+
+func parseTransmissionType(value string) TransmissionType {
+	value = strings.ToLower(value)
+	switch {
+	case isNotApplicable(value):
+		return TransmissionTypeUnknown
+	case strings.Contains(value, "cvt") || strings.Contains(value, "continuously variable"):
+		return TransmissionTypeCVT
+	case strings.Contains(value, "dct") || strings.Contains(value, "dual-clutch") || strings.Contains(value, "dual clutch"):
+		return TransmissionTypeDCT
+	case strings.Contains(value, "amt") || strings.Contains(value, "automated manual"):
+		return TransmissionTypeAutomatedManual
+	case strings.Contains(value, "manual") || strings.Contains(value, "standard"):
+		return TransmissionTypeManual
+	case strings.Contains(value, "automatic"):
+		return TransmissionTypeAutomatic
+	}
+	return TransmissionTypeUnknown
+}
+
+// GetVehicleSpec retrieves the spec for a car. Returns ErrNotFound if the car has no spec, ex.
+// it was identified without a VIN and the user didn't supply one.
+func (s *Service) GetVehicleSpec(ctx context.Context, carId string) (VehicleSpec, error) {
+	if s.db == nil {
+		return VehicleSpec{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(carId) == "" {
+		return VehicleSpec{}, ErrInvalidArg
+	}
+
+	query := `
+	SELECT
+		vs.car_id,
+		vs.source,
+		vs.displacement_l,
+		vs.engine_cylinders,
+		vs.power_kw_min,
+		vs.power_kw_max,
+		vs.turbo,
+		vs.drive_type,
+		vs.fuel_type_primary,
+		vs.fuel_type_secondary,
+		vs.transmission_type,
+		vs.transmission_speeds,
+		vs.wheelbase_mm_min,
+		vs.wheelbase_mm_max,
+		vs.track_width_mm,
+		vs.curb_weight_kg,
+		vs.gvwr_kg_min,
+		vs.gvwr_kg_max,
+		vs.wheel_size_front_in,
+		vs.wheel_size_rear_in,
+		vs.doors,
+		vs.seats,
+		vs.seat_rows,
+		vs.battery_kwh_min,
+		vs.battery_kwh_max,
+		vs.created_at,
+		vs.updated_at
+	FROM vehicle_specs vs
+	WHERE vs.car_id = $1`
+
+	var spec VehicleSpec
+	row := s.db.QueryRow(ctx, query, strings.TrimSpace(carId))
+	err := row.Scan(
+		&spec.carId,
+		&spec.Source,
+		&spec.DisplacementLiters,
+		&spec.EngineCylinders,
+		&spec.PowerKW.Min,
+		&spec.PowerKW.Max,
+		&spec.Turbo,
+		&spec.DriveType,
+		&spec.FuelTypePrimary,
+		&spec.FuelTypeSecondary,
+		&spec.TransmissionType,
+		&spec.TransmissionSpeeds,
+		&spec.WheelbaseMM.Min,
+		&spec.WheelbaseMM.Max,
+		&spec.TrackWidthMM,
+		&spec.CurbWeightKg,
+		&spec.GVWRKg.Min,
+		&spec.GVWRKg.Max,
+		&spec.WheelSizeFrontInches,
+		&spec.WheelSizeRearInches,
+		&spec.Doors,
+		&spec.Seats,
+		&spec.SeatRows,
+		&spec.BatteryKWh.Min,
+		&spec.BatteryKWh.Max,
+		&spec.createdAt,
+		&spec.updatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return VehicleSpec{}, ErrNotFound
+		}
+		return VehicleSpec{}, fmt.Errorf("failed to query for vehicle spec: %w", err)
+	}
+
+	return spec, nil
+}
+
+// BackfillVehicleSpecs builds the spec for each car that has NHTSA vPIC data but no spec, ex.
+// cars created before specs were recorded. Returns the number of specs created. It can be
+// repeated safely, cars that have a spec are skipped.
+func (s *Service) BackfillVehicleSpecs(ctx context.Context) (int64, error) {
+	if s.db == nil {
+		return 0, ErrMissingRequiredConfiguration
+	}
+
+	query := `
+	SELECT DISTINCT ON (n.car_id)
+		n.car_id,
+		n.payload
+	FROM nhtsa_vpic_data n
+	WHERE NOT EXISTS (
+		SELECT 1
+		FROM vehicle_specs vs
+		WHERE vs.car_id = n.car_id
+	)
+	ORDER BY n.car_id, n.created_at DESC`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query for cars without specs: %w", err)
+	}
+
+	type carPayload struct {
+		carId   string
+		payload []byte
+	}
+	var payloads []carPayload
+	for rows.Next() {
+		var p carPayload
+		if err := rows.Scan(&p.carId, &p.payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan car payload: %w", err)
+		}
+		payloads = append(payloads, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read car payloads: %w", err)
+	}
+
+	var created int64
+	for _, p := range payloads {
+		spec, err := newVehicleSpecFromPayload(p.payload)
+		if err != nil {
+			return created, fmt.Errorf("failed to build vehicle spec for car %s: %w", p.carId, err)
+		}
+		spec.carId = p.carId
+
+		if err := createVehicleSpecRecord(ctx, s.db, spec); err != nil {
+			return created, fmt.Errorf("failed to create vehicle spec record for car %s: %w", p.carId, err)
+		}
+		created++
+	}
+
+	return created, nil
+}
+
+func newVehicleSpecFromPayload(payload []byte) (VehicleSpec, error) {
+	var result nhtsavpic.DecodeVINFlatResult
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return VehicleSpec{}, fmt.Errorf("failed to unmarshal nhtsa payload: %w", err)
+	}
+	return NewVehicleSpec(result), nil
+}
+
+// execer is satisfied by both pgx.Tx and postgres.ConnectionPool
+type execer interface {
+	Exec(context.Context, string, ...any) (pgconn.CommandTag, error)
+}
+
+func createVehicleSpecRecord(ctx context.Context, db execer, spec VehicleSpec) error {
+	query := `
+	INSERT INTO vehicle_specs (
+		car_id,
+		source,
+		displacement_l,
+		engine_cylinders,
+		power_kw_min,
+		power_kw_max,
+		turbo,
+		drive_type,
+		fuel_type_primary,
+		fuel_type_secondary,
+		transmission_type,
+		transmission_speeds,
+		wheelbase_mm_min,
+		wheelbase_mm_max,
+		track_width_mm,
+		curb_weight_kg,
+		gvwr_kg_min,
+		gvwr_kg_max,
+		wheel_size_front_in,
+		wheel_size_rear_in,
+		doors,
+		seats,
+		seat_rows,
+		battery_kwh_min,
+		battery_kwh_max
+	) VALUES (
+		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
+		$14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25
+	) ON CONFLICT (car_id) DO NOTHING`
+
+	if _, err := db.Exec(ctx, query,
+		spec.carId,
+		spec.Source,
+		spec.DisplacementLiters,
+		spec.EngineCylinders,
+		spec.PowerKW.Min,
+		spec.PowerKW.Max,
+		spec.Turbo,
+		spec.DriveType,
+		spec.FuelTypePrimary,
+		spec.FuelTypeSecondary,
+		spec.TransmissionType,
+		spec.TransmissionSpeeds,
+		spec.WheelbaseMM.Min,
+		spec.WheelbaseMM.Max,
+		spec.TrackWidthMM,
+		spec.CurbWeightKg,
+		spec.GVWRKg.Min,
+		spec.GVWRKg.Max,
+		spec.WheelSizeFrontInches,
+		spec.WheelSizeRearInches,
+		spec.Doors,
+		spec.Seats,
+		spec.SeatRows,
+		spec.BatteryKWh.Min,
+		spec.BatteryKWh.Max); err != nil {
+		return fmt.Errorf("failed to exec insert query: %w", err)
+	}
+
+	return nil
+}
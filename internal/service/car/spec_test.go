@@ -0,0 +1,254 @@
+package car_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	nhtsavpic "github.com/keola-dunn/autolog/internal/nhtsa"
+	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func integer(i int64) *int64 {
+	return &i
+}
+
+func TestNewVehicleSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    nhtsavpic.DecodeVINFlatResult
+		expected car.VehicleSpec
+	}{
+		{
+			name:  "Empty",
+			input: nhtsavpic.DecodeVINFlatResult{},
+			expected: car.VehicleSpec{
+				Source:            car.SpecSourceNHTSA,
+				DriveType:         car.DriveTypeUnknown,
+				FuelTypePrimary:   car.FuelTypeUnknown,
+				FuelTypeSecondary: car.FuelTypeUnknown,
+				TransmissionType:  car.TransmissionTypeUnknown,
+			},
+		},
+		{
+			name: "NotApplicable",
+			input: nhtsavpic.DecodeVINFlatResult{
+				DisplacementL:     "Not Applicable",
+				EngineHP:          "Not Applicable",
+				DriveType:         "Not Applicable",
+				FuelTypeSecondary: "Not Applicable",
+				TransmissionStyle: "Not Applicable",
+			},
+			expected: car.VehicleSpec{
+				Source:            car.SpecSourceNHTSA,
+				DriveType:         car.DriveTypeUnknown,
+				FuelTypePrimary:   car.FuelTypeUnknown,
+				FuelTypeSecondary: car.FuelTypeUnknown,
+				TransmissionType:  car.TransmissionTypeUnknown,
+			},
+		},
+		{
+			name: "Supra",
+			input: nhtsavpic.DecodeVINFlatResult{
+				DisplacementL:      "2.997972",
+				EngineCylinders:    "6",
+				EngineHP:           "382",
+				Turbo:              "Yes",
+				DriveType:          "RWD/Rear-Wheel Drive",
+				FuelTypePrimary:    "Gasoline",
+				TransmissionStyle:  "Manual/Standard",
+				TransmissionSpeeds: "6",
+				WheelBaseShort:     "97.2",
+				GVWR:               "Class 1C: 4,001 - 5,000 lb (1,814 - 2,268 kg)",
+				Doors:              "2",
+				Seats:              "2",
+			},
+			expected: car.VehicleSpec{
+				Source:             car.SpecSourceNHTSA,
+				DisplacementLiters: float(2.997972),
+				EngineCylinders:    integer(6),
+				PowerKW: car.Range{
+					Min: float(car.HorsepowerToKilowatts(382)),
+					Max: float(car.HorsepowerToKilowatts(382)),
+				},
+				Turbo:              true,
+				DriveType:          car.DriveTypeRWD,
+				FuelTypePrimary:    car.FuelTypeGasoline,
+				FuelTypeSecondary:  car.FuelTypeUnknown,
+				TransmissionType:   car.TransmissionTypeManual,
+				TransmissionSpeeds: integer(6),
+				WheelbaseMM: car.Range{
+					Min: float(car.InchesToMillimeters(97.2)),
+					Max: float(car.InchesToMillimeters(97.2)),
+				},
+				GVWRKg: car.Range{
+					Min: float(car.PoundsToKilograms(4001)),
+					Max: float(car.PoundsToKilograms(5000)),
+				},
+				Doors: integer(2),
+				Seats: integer(2),
+			},
+		},
+		{
+			name: "Ranges",
+			input: nhtsavpic.DecodeVINFlatResult{
+				DisplacementCC:    "5,000",
+				EngineHP:          "255",
+				EngineHP_to:       "300",
+				DriveType:         "4WD/4-Wheel Drive/4x4",
+				FuelTypePrimary:   "Flexible Fuel Vehicle (FFV)",
+				TransmissionStyle: "Continuously Variable Transmission (CVT)",
+				WheelBaseShort:    "120.0 - 145.0",
+				GVWR:              "Class 1: 6,000 lb or less (2,722 kg or less)",
+			},
+			expected: car.VehicleSpec{
+				Source:             car.SpecSourceNHTSA,
+				DisplacementLiters: float(5),
+				PowerKW: car.Range{
+					Min: float(car.HorsepowerToKilowatts(255)),
+					Max: float(car.HorsepowerToKilowatts(300)),
+				},
+				DriveType:         car.DriveType4WD,
+				FuelTypePrimary:   car.FuelTypeFlexFuel,
+				FuelTypeSecondary: car.FuelTypeUnknown,
+				TransmissionType:  car.TransmissionTypeCVT,
+				WheelbaseMM: car.Range{
+					Min: float(car.InchesToMillimeters(120)),
+					Max: float(car.InchesToMillimeters(145)),
+				},
+				GVWRKg: car.Range{
+					Max: float(car.PoundsToKilograms(6000)),
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, car.NewVehicleSpec(test.input))
+		})
+	}
+}
+
+func TestNewUserVehicleSpec(t *testing.T) {
+	spec := car.NewUserVehicleSpec(car.UserVehicleSpecInput{
+		DisplacementLiters: float(2.0),
+		EngineCylinders:    integer(4),
+		PowerKW:            float(75),
+		DriveType:          "rear wheel drive",
+		FuelType:           "Gasoline",
+		TransmissionType:   "4 speed manual",
+		TransmissionSpeeds: integer(4),
+		WheelbaseMM:        float(2400),
+	})
+
+	require.Equal(t, car.VehicleSpec{
+		Source:             car.SpecSourceUser,
+		DisplacementLiters: float(2.0),
+		EngineCylinders:    integer(4),
+		PowerKW:            car.Range{Min: float(75), Max: float(75)},
+		DriveType:          car.DriveTypeRWD,
+		FuelTypePrimary:    car.FuelTypeGasoline,
+		FuelTypeSecondary:  car.FuelTypeUnknown,
+		TransmissionType:   car.TransmissionTypeManual,
+		TransmissionSpeeds: integer(4),
+		WheelbaseMM:        car.Range{Min: float(2400), Max: float(2400)},
+	}, spec)
+}
+
+const vehicleSpecColumns = "vs.car_id, vs.source, vs.displacement_l, vs.engine_cylinders, vs.power_kw_min, vs.power_kw_max, " +
+	"vs.turbo, vs.drive_type, vs.fuel_type_primary, vs.fuel_type_secondary, vs.transmission_type, " +
+	"vs.transmission_speeds, vs.wheelbase_mm_min, vs.wheelbase_mm_max, vs.track_width_mm, vs.curb_weight_kg, " +
+	"vs.gvwr_kg_min, vs.gvwr_kg_max, vs.wheel_size_front_in, vs.wheel_size_rear_in, vs.doors, vs.seats, " +
+	"vs.seat_rows, vs.battery_kwh_min, vs.battery_kwh_max, vs.created_at, vs.updated_at"
+
+func TestGetVehicleSpecNotFound(t *testing.T) {
+	service, db := newTestService(t)
+
+	// a car without a spec isn't given one on read, it's left for the backfill
+	db.ExpectQuery("SELECT " + vehicleSpecColumns + " FROM vehicle_specs vs WHERE vs.car_id = $1").
+		WithArgs(testCarId).WillReturnError(pgx.ErrNoRows)
+
+	_, err := service.GetVehicleSpec(context.TODO(), testCarId)
+	require.ErrorIs(t, err, car.ErrNotFound)
+	require.NoError(t, db.ExpectationsWereMet())
+}
+
+func TestBackfillVehicleSpecs(t *testing.T) {
+	query := "SELECT DISTINCT ON (n.car_id) n.car_id, n.payload FROM nhtsa_vpic_data n WHERE NOT EXISTS " +
+		"( SELECT 1 FROM vehicle_specs vs WHERE vs.car_id = n.car_id ) ORDER BY n.car_id, n.created_at DESC"
+	insertQuery := "INSERT INTO vehicle_specs ( car_id, source, displacement_l, engine_cylinders, power_kw_min, " +
+		"power_kw_max, turbo, drive_type, fuel_type_primary, fuel_type_secondary, transmission_type, " +
+		"transmission_speeds, wheelbase_mm_min, wheelbase_mm_max, track_width_mm, curb_weight_kg, gvwr_kg_min, " +
+		"gvwr_kg_max, wheel_size_front_in, wheel_size_rear_in, doors, seats, seat_rows, battery_kwh_min, " +
+		"battery_kwh_max ) VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, " +
+		"$18, $19, $20, $21, $22, $23, $24, $25 ) ON CONFLICT (car_id) DO NOTHING"
+
+	insertArgs := func(carId string) []any {
+		args := []any{carId}
+		for range 24 {
+			args = append(args, pgxmock.AnyArg())
+		}
+		return args
+	}
+
+	tests := []struct {
+		name   string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedCreated int64
+		expectedErr     error
+	}{
+		{
+			name: "Backfilled",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WillReturnRows(pgxmock.NewRows([]string{"car_id", "payload"}).
+					AddRow(testCarId, []byte(`{"DisplacementL":"2.0","DriveType":"RWD/Rear-Wheel Drive"}`)).
+					AddRow(testUserCarId, []byte(`{"FuelTypePrimary":"Gasoline"}`)))
+				db.ExpectExec(insertQuery).WithArgs(insertArgs(testCarId)...).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				db.ExpectExec(insertQuery).WithArgs(insertArgs(testUserCarId)...).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			},
+			expectedCreated: 2,
+		},
+		{
+			name: "NothingToBackfill",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WillReturnRows(pgxmock.NewRows([]string{"car_id", "payload"}))
+			},
+		},
+		{
+			name: "InvalidPayload",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WillReturnRows(pgxmock.NewRows([]string{"car_id", "payload"}).
+					AddRow(testCarId, []byte(`{`)))
+			},
+			expectedErr: errors.New("failed to build vehicle spec for car " + testCarId +
+				": failed to unmarshal nhtsa payload: unexpected end of JSON input"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			created, err := service.BackfillVehicleSpecs(context.TODO())
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, test.expectedCreated, created)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package car
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// soleCarDataQueries remove cars only the deleted user has ever owned, with everything about
+// them. $1 is the car ids.
+var soleCarDataQueries = []string{
+	`DELETE FROM service_logs WHERE car_id::text = ANY($1)`,
+	`DELETE FROM license_plates WHERE car_id::text = ANY($1)`,
+	`DELETE FROM nhtsa_vpic_data WHERE car_id::text = ANY($1)`,
+	`DELETE FROM car_field_overrides WHERE car_id::text = ANY($1)`,
+	`DELETE FROM vehicle_specs WHERE car_id::text = ANY($1)`,
+	`DELETE FROM car_claims WHERE car_id::text = ANY($1)`,
+	`DELETE FROM users_cars WHERE car_id::text = ANY($1)`,
+	`DELETE FROM cars WHERE id::text = ANY($1)`,
+}
+
+// userDataQueries remove what the deleted user added to cars other users have owned too. The
+// cars, and their other owners' logs, are kept. $1 is the user id.
+var userDataQueries = []string{
+	`DELETE FROM car_claims WHERE claimant_user_id = $1`,
+	`DELETE FROM service_logs WHERE user_id = $1`,
+	`DELETE FROM license_plates WHERE user_id = $1`,
+	`DELETE FROM users_cars WHERE user_id = $1`,
+}
+
+// DeleteUserData removes a deleted user's cars, service logs, license plates and claims. Cars
+// other users have owned are kept without the user's history. It can be repeated safely.
+func (s *Service) DeleteUserData(ctx context.Context, userId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	soleCarsQuery := `
+	SELECT
+		uc.car_id
+	FROM users_cars uc
+	WHERE
+		uc.user_id = $1 AND
+		NOT EXISTS (
+			SELECT 1
+			FROM users_cars other
+			WHERE
+				other.car_id = uc.car_id AND
+				other.user_id <> $1
+		)`
+
+	rows, err := tx.Query(ctx, soleCarsQuery, strings.TrimSpace(userId))
+	if err != nil {
+		return fmt.Errorf("failed to query for user's cars: %w", err)
+	}
+
+	carIds := make([]string, 0)
+	for rows.Next() {
+		var carId string
+		if err := rows.Scan(&carId); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan user's car: %w", err)
+		}
+		carIds = append(carIds, carId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read user's cars: %w", err)
+	}
+
+	if len(carIds) > 0 {
+		for _, q := range soleCarDataQueries {
+			if _, err := tx.Exec(ctx, q, carIds); err != nil {
+				return fmt.Errorf("failed to delete user's cars: %w", err)
+			}
+		}
+	}
+
+	for _, q := range userDataQueries {
+		if _, err := tx.Exec(ctx, q, strings.TrimSpace(userId)); err != nil {
+			return fmt.Errorf("failed to delete user's car data: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package car_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/car"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteUserData(t *testing.T) {
+	soleCarsQuery := "SELECT uc.car_id FROM users_cars uc WHERE uc.user_id = $1 AND NOT EXISTS " +
+		"( SELECT 1 FROM users_cars other WHERE other.car_id = uc.car_id AND other.user_id <> $1 )"
+	soleCarDataQueries := []string{
+		"DELETE FROM service_logs WHERE car_id::text = ANY($1)",
+		"DELETE FROM license_plates WHERE car_id::text = ANY($1)",
+		"DELETE FROM nhtsa_vpic_data WHERE car_id::text = ANY($1)",
+		"DELETE FROM car_field_overrides WHERE car_id::text = ANY($1)",
+		"DELETE FROM vehicle_specs WHERE car_id::text = ANY($1)",
+		"DELETE FROM car_claims WHERE car_id::text = ANY($1)",
+		"DELETE FROM users_cars WHERE car_id::text = ANY($1)",
+		"DELETE FROM cars WHERE id::text = ANY($1)",
+	}
+	userDataQueries := []string{
+		"DELETE FROM car_claims WHERE claimant_user_id = $1",
+		"DELETE FROM service_logs WHERE user_id = $1",
+		"DELETE FROM license_plates WHERE user_id = $1",
+		"DELETE FROM users_cars WHERE user_id = $1",
+	}
+
+	expectUserData := func(db pgxmock.PgxConnIface) {
+		for _, q := range userDataQueries {
+			db.ExpectExec(q).WithArgs(testUserId).
+				WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		}
+	}
+
+	tests := []struct {
+		name   string
+		userId string
+
+		dbFunc      func(db pgxmock.PgxConnIface)
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			userId:      " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: car.ErrInvalidArg,
+		},
+		{
+			// the car only the user has owned is removed with everything about it
+			name:   "SoleOwner",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(soleCarsQuery).WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"car_id"}).AddRow(testCarId))
+				for _, q := range soleCarDataQueries {
+					db.ExpectExec(q).WithArgs([]string{testCarId}).
+						WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				}
+				expectUserData(db)
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+		{
+			// a car another user has owned too is kept, only the user's own data is removed
+			name:   "SharedCar",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(soleCarsQuery).WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"car_id"}))
+				expectUserData(db)
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+		{
+			name:   "DbError",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(soleCarsQuery).WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"car_id"}).AddRow(testCarId))
+				db.ExpectExec(soleCarDataQueries[0]).WithArgs([]string{testCarId}).
+					WillReturnError(errors.New("fake db error"))
+				db.ExpectRollback()
+			},
+			expectedErr: errors.New("failed to delete user's cars: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			err := service.DeleteUserData(context.TODO(), test.userId)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Make struct {
+	id          string
+	NHTSAMakeId int64
+	Name        string
+
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+func (m *Make) Id() string {
+	return m.id
+}
+
+func (m *Make) CreatedAt() time.Time {
+	return m.createdAt
+}
+
+func (m *Make) UpdatedAt() time.Time {
+	return m.updatedAt
+}
+
+// SearchMakes returns the makes in the catalog whose name, or a known alias, starts with the
+// provided term. Exact matches are returned first.
+func (s *Service) SearchMakes(ctx context.Context, term string) ([]Make, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	normalizedTerm := normalizeName(term)
+	if normalizedTerm == "" {
+		return nil, ErrInvalidArg
+	}
+
+	query := `
+	SELECT
+		m.id,
+		m.nhtsa_make_id,
+		m.name,
+		m.created_at,
+		m.updated_at
+	FROM catalog_makes m
+	WHERE 
+		m.normalized_name LIKE $1 || '%' OR 
+		m.normalized_name IN (
+			SELECT 
+				a.make_normalized_name 
+			FROM catalog_make_aliases a 
+			WHERE a.alias LIKE $1 || '%'
+		)
+	ORDER BY 
+		(m.normalized_name = $1 OR m.normalized_name IN (
+			SELECT 
+				a.make_normalized_name 
+			FROM catalog_make_aliases a 
+			WHERE a.alias = $1
+		)) DESC,
+		m.name
+	LIMIT $2`
+
+	rows, err := s.db.Query(ctx, query, normalizedTerm, s.searchLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for makes: %w", err)
+	}
+	defer rows.Close()
+
+	var makes = []Make{}
+	for rows.Next() {
+		var m Make
+		if err := rows.Scan(&m.id, &m.NHTSAMakeId, &m.Name, &m.createdAt, &m.updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan make row: %w", err)
+		}
+		makes = append(makes, m)
+	}
+
+	return makes, nil
+}
+
+// getMake retrieves a single make by its name or alias. Returns ErrNotFound if the make
+// isn't in the catalog.
+func (s *Service) getMake(ctx context.Context, name string) (Make, error) {
+	query := `
+	SELECT
+		m.id,
+		m.nhtsa_make_id,
+		m.name,
+		m.created_at,
+		m.updated_at
+	FROM catalog_makes m
+	WHERE m.normalized_name = $1 OR m.normalized_name = (
+		SELECT 
+			a.make_normalized_name 
+		FROM catalog_make_aliases a 
+		WHERE a.alias = $1
+	)
+	ORDER BY (m.normalized_name = $1) DESC
+	LIMIT 1`
+
+	var m Make
+	row := s.db.QueryRow(ctx, query, normalizeName(name))
+	if err := row.Scan(&m.id, &m.NHTSAMakeId, &m.Name, &m.createdAt, &m.updatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Make{}, ErrNotFound
+		}
+		return Make{}, fmt.Errorf("failed to query for make: %w", err)
+	}
+
+	return m, nil
+}
+
+func (s *Service) upsertMake(ctx context.Context, nhtsaMakeId int64, name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", ErrInvalidArg
+	}
+
+	query := `
+	INSERT INTO catalog_makes (nhtsa_make_id, name, normalized_name)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (nhtsa_make_id) DO UPDATE SET
+		name = EXCLUDED.name,
+		normalized_name = EXCLUDED.normalized_name,
+		updated_at = NOW()
+	RETURNING id`
+
+	row := s.db.QueryRow(ctx, query, nhtsaMakeId, strings.TrimSpace(name), normalizeName(name))
+
+	var makeId string
+	if err := row.Scan(&makeId); err != nil {
+		return "", fmt.Errorf("failed to upsert make: %w", err)
+	}
+
+	return makeId, nil
+}
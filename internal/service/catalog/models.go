@@ -0,0 +1,244 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	nhtsavpic "github.com/keola-dunn/autolog/internal/nhtsa"
+)
+
+type Model struct {
+	id           string
+	makeId       string
+	NHTSAModelId int64
+	Make         string
+	Name         string
+
+	createdAt time.Time
+	updatedAt time.Time
+}
+
+func (m *Model) Id() string {
+	return m.id
+}
+
+func (m *Model) MakeId() string {
+	return m.makeId
+}
+
+func (m *Model) CreatedAt() time.Time {
+	return m.createdAt
+}
+
+func (m *Model) UpdatedAt() time.Time {
+	return m.updatedAt
+}
+
+type SearchModelsInput struct {
+	// Make is the name or alias of the make to search models for. Required.
+	Make string
+
+	// Year limits the models returned to those NHTSA has on record for the model year.
+	// Optional.
+	Year int64
+
+	// Term is the prefix of the model name to search for. Optional, all models for the
+	// make are returned if empty.
+	Term string
+}
+
+func (s *SearchModelsInput) valid() bool {
+	return strings.TrimSpace(s.Make) != "" &&
+		(s.Year == 0 || s.Year >= nhtsavpic.MinModelYear)
+}
+
+// SearchModels returns the models in the catalog for a make, optionally limited to a model year
+// and a name prefix.
+func (s *Service) SearchModels(ctx context.Context, input SearchModelsInput) ([]Model, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if !input.valid() {
+		return nil, ErrInvalidArg
+	}
+
+	mk, err := s.getMake(ctx, input.Make)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return []Model{}, nil
+		}
+		return nil, fmt.Errorf("failed to get make: %w", err)
+	}
+
+	var queryBuilder strings.Builder
+	var queryArgs = []any{mk.id}
+
+	queryBuilder.WriteString(`
+	SELECT
+		cm.id,
+		cm.make_id,
+		cm.nhtsa_model_id,
+		cm.name,
+		cm.created_at,
+		cm.updated_at
+	FROM catalog_models cm
+	WHERE cm.make_id = $1`)
+
+	if term := normalizeName(input.Term); term != "" {
+		queryArgs = append(queryArgs, term)
+		queryBuilder.WriteString(fmt.Sprintf(" AND cm.normalized_name LIKE $%d || '%%'", len(queryArgs)))
+	}
+
+	if input.Year != 0 {
+		queryArgs = append(queryArgs, input.Year)
+		queryBuilder.WriteString(fmt.Sprintf(` AND EXISTS (
+		SELECT 1 
+		FROM catalog_model_years cmy 
+		WHERE cmy.model_id = cm.id AND cmy.year = $%d
+	)`, len(queryArgs)))
+	}
+
+	queryArgs = append(queryArgs, s.searchLimit)
+	queryBuilder.WriteString(fmt.Sprintf(`
+	ORDER BY cm.name
+	LIMIT $%d`, len(queryArgs)))
+
+	rows, err := s.db.Query(ctx, queryBuilder.String(), queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for models: %w", err)
+	}
+	defer rows.Close()
+
+	var models = []Model{}
+	for rows.Next() {
+		var m = Model{Make: mk.Name}
+		if err := rows.Scan(&m.id, &m.makeId, &m.NHTSAModelId, &m.Name,
+			&m.createdAt, &m.updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan model row: %w", err)
+		}
+		models = append(models, m)
+	}
+
+	return models, nil
+}
+
+type NormalizeMakeModelInput struct {
+	Make  string
+	Model string
+	Year  int64
+}
+
+type NormalizeMakeModelOutput struct {
+	// Make is the catalog name of the make. Falls back to the provided make if the make
+	// isn't found in the catalog.
+	Make string
+
+	// Model is the catalog name of the model. Falls back to the provided model if the model
+	// isn't found in the catalog for the make.
+	Model string
+
+	// MakeFound indicates the make was matched against the catalog
+	MakeFound bool
+
+	// ModelFound indicates the model was matched against the catalog
+	ModelFound bool
+}
+
+// NormalizeMakeModel resolves free text make and model values, ex. "chevy" "corvette", into the
+// names stored in the catalog, ex. "CHEVROLET" "Corvette". Values that can't be matched are
+// returned trimmed but otherwise untouched.
+func (s *Service) NormalizeMakeModel(ctx context.Context, input NormalizeMakeModelInput) (NormalizeMakeModelOutput, error) {
+	if s.db == nil {
+		return NormalizeMakeModelOutput{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.Make) == "" || strings.TrimSpace(input.Model) == "" {
+		return NormalizeMakeModelOutput{}, ErrInvalidArg
+	}
+
+	var output = NormalizeMakeModelOutput{
+		Make:  strings.TrimSpace(input.Make),
+		Model: strings.TrimSpace(input.Model),
+	}
+
+	mk, err := s.getMake(ctx, input.Make)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return output, nil
+		}
+		return NormalizeMakeModelOutput{}, fmt.Errorf("failed to get make: %w", err)
+	}
+	output.Make = mk.Name
+	output.MakeFound = true
+
+	// prefer a model on record for the given year, but fall back to any model with a
+	// matching name since the year sync may not cover every year
+	query := `
+	SELECT
+		cm.name
+	FROM catalog_models cm
+	WHERE 
+		cm.make_id = $1 AND 
+		cm.normalized_name = $2
+	ORDER BY EXISTS (
+		SELECT 1 
+		FROM catalog_model_years cmy 
+		WHERE cmy.model_id = cm.id AND cmy.year = $3
+	) DESC
+	LIMIT 1`
+
+	row := s.db.QueryRow(ctx, query, mk.id, normalizeName(input.Model), input.Year)
+	var modelName string
+	if err := row.Scan(&modelName); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return output, nil
+		}
+		return NormalizeMakeModelOutput{}, fmt.Errorf("failed to query for model: %w", err)
+	}
+	output.Model = modelName
+	output.ModelFound = true
+
+	return output, nil
+}
+
+func (s *Service) upsertModel(ctx context.Context, makeId string, nhtsaModelId int64, name string) (string, error) {
+	if strings.TrimSpace(makeId) == "" || strings.TrimSpace(name) == "" {
+		return "", ErrInvalidArg
+	}
+
+	query := `
+	INSERT INTO catalog_models (make_id, nhtsa_model_id, name, normalized_name)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (make_id, nhtsa_model_id) DO UPDATE SET
+		name = EXCLUDED.name,
+		normalized_name = EXCLUDED.normalized_name,
+		updated_at = NOW()
+	RETURNING id`
+
+	row := s.db.QueryRow(ctx, query, makeId, nhtsaModelId, strings.TrimSpace(name), normalizeName(name))
+
+	var modelId string
+	if err := row.Scan(&modelId); err != nil {
+		return "", fmt.Errorf("failed to upsert model: %w", err)
+	}
+
+	return modelId, nil
+}
+
+func (s *Service) createModelYear(ctx context.Context, modelId string, year int64) error {
+	query := `
+	INSERT INTO catalog_model_years (model_id, year)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`
+
+	if _, err := s.db.Exec(ctx, query, modelId, year); err != nil {
+		return fmt.Errorf("failed to insert model year: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package catalog
+
+import (
+	"strings"
+	"unicode"
+)
+
+// normalizeName reduces a make or model name down to lower case letters and digits so that
+// "Mercedes Benz", "mercedes-benz" and "MERCEDES-BENZ" all compare as equal.
+func normalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,28 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Empty", input: "", expected: ""},
+		{name: "Whitespace", input: "   ", expected: ""},
+		{name: "UpperCase", input: "CHEVROLET", expected: "chevrolet"},
+		{name: "Hyphenated", input: "Mercedes-Benz", expected: "mercedesbenz"},
+		{name: "Spaced", input: " Mercedes Benz ", expected: "mercedesbenz"},
+		{name: "Digits", input: "F-150", expected: "f150"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, normalizeName(test.input))
+		})
+	}
+}
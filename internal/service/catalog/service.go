@@ -0,0 +1,57 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+
+	nhtsavpic "github.com/keola-dunn/autolog/internal/nhtsa"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("catalog service is missing required configurations to perform this operation")
+
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	ErrNotFound = errors.New("the requested resource was not found")
+)
+
+type ServiceConfig struct {
+	// DB is the Database used for the catalog service
+	DB postgres.ConnectionPool
+
+	// NHTSAClient is used to pull makes and models when syncing the catalog
+	NHTSAClient nhtsavpic.ClientIface
+
+	// SearchLimit is the max number of results returned from a search. Defaults to 25.
+	SearchLimit int64
+}
+
+type ServiceIface interface {
+	SearchMakes(ctx context.Context, term string) ([]Make, error)
+	SearchModels(ctx context.Context, input SearchModelsInput) ([]Model, error)
+
+	NormalizeMakeModel(ctx context.Context, input NormalizeMakeModelInput) (NormalizeMakeModelOutput, error)
+
+	SyncMakes(ctx context.Context) (int64, error)
+	SyncModels(ctx context.Context, input SyncModelsInput) (int64, error)
+}
+
+type Service struct {
+	db          postgres.ConnectionPool
+	nhtsaClient nhtsavpic.ClientIface
+
+	searchLimit int64
+}
+
+func NewService(cfg ServiceConfig) *Service {
+	if cfg.SearchLimit <= 0 {
+		cfg.SearchLimit = 25
+	}
+
+	return &Service{
+		db:          cfg.DB,
+		nhtsaClient: cfg.NHTSAClient,
+		searchLimit: cfg.SearchLimit,
+	}
+}
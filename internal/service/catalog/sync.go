@@ -0,0 +1,158 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	nhtsavpic "github.com/keola-dunn/autolog/internal/nhtsa"
+)
+
+// SyncMakes pulls every make from NHTSA vPIC into the catalog. Returns the number of makes
+// synced.
+func (s *Service) SyncMakes(ctx context.Context) (int64, error) {
+	if s.db == nil || s.nhtsaClient == nil {
+		return 0, ErrMissingRequiredConfiguration
+	}
+
+	allMakes, err := s.nhtsaClient.GetAllMakes(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get all makes: %w", err)
+	}
+
+	var synced int64
+	for _, mk := range allMakes.Results {
+		if strings.TrimSpace(mk.MakeName) == "" {
+			continue
+		}
+
+		if _, err := s.upsertMake(ctx, int64(mk.MakeID), mk.MakeName); err != nil {
+			return synced, fmt.Errorf("failed to upsert make %d: %w", mk.MakeID, err)
+		}
+		synced++
+	}
+
+	return synced, nil
+}
+
+type SyncModelsInput struct {
+	// Makes limits the sync to the provided make names. All makes in the catalog are synced
+	// if empty.
+	Makes []string
+
+	// StartYear and EndYear are the inclusive range of model years to record for each model.
+	// Model years are not synced if either is 0.
+	StartYear int64
+	EndYear   int64
+}
+
+func (s *SyncModelsInput) valid() bool {
+	if s.StartYear == 0 || s.EndYear == 0 {
+		return true
+	}
+	return s.StartYear >= nhtsavpic.MinModelYear && s.EndYear >= s.StartYear
+}
+
+// SyncModels pulls the models for each make in the catalog from NHTSA vPIC, along with the
+// model years each model was available in. Returns the number of models synced.
+func (s *Service) SyncModels(ctx context.Context, input SyncModelsInput) (int64, error) {
+	if s.db == nil || s.nhtsaClient == nil {
+		return 0, ErrMissingRequiredConfiguration
+	}
+
+	if !input.valid() {
+		return 0, ErrInvalidArg
+	}
+
+	makes, err := s.listMakes(ctx, input.Makes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list makes: %w", err)
+	}
+
+	var synced int64
+	for _, mk := range makes {
+		models, err := s.nhtsaClient.GetModelsForMakeID(ctx, nhtsavpic.GetModelsForMakeIDInput{
+			MakeID: int(mk.NHTSAMakeId),
+		})
+		if err != nil {
+			return synced, fmt.Errorf("failed to get models for make %d: %w", mk.NHTSAMakeId, err)
+		}
+
+		for _, model := range models.Results {
+			if strings.TrimSpace(model.ModelName) == "" {
+				continue
+			}
+			if _, err := s.upsertModel(ctx, mk.id, int64(model.ModelID), model.ModelName); err != nil {
+				return synced, fmt.Errorf("failed to upsert model %d: %w", model.ModelID, err)
+			}
+			synced++
+		}
+
+		if input.StartYear == 0 || input.EndYear == 0 {
+			continue
+		}
+
+		for year := input.StartYear; year <= input.EndYear; year++ {
+			yearModels, err := s.nhtsaClient.GetModelsForMakeIDYear(ctx, nhtsavpic.GetModelsForMakeIDYearInput{
+				MakeID:    int(mk.NHTSAMakeId),
+				ModelYear: int(year),
+			})
+			if err != nil {
+				return synced, fmt.Errorf("failed to get models for make %d year %d: %w", mk.NHTSAMakeId, year, err)
+			}
+
+			for _, model := range yearModels.Results {
+				if strings.TrimSpace(model.ModelName) == "" {
+					continue
+				}
+				modelId, err := s.upsertModel(ctx, mk.id, int64(model.ModelID), model.ModelName)
+				if err != nil {
+					return synced, fmt.Errorf("failed to upsert model %d: %w", model.ModelID, err)
+				}
+
+				if err := s.createModelYear(ctx, modelId, year); err != nil {
+					return synced, fmt.Errorf("failed to create model year: %w", err)
+				}
+			}
+		}
+	}
+
+	return synced, nil
+}
+
+func (s *Service) listMakes(ctx context.Context, names []string) ([]Make, error) {
+	query := `
+	SELECT
+		m.id,
+		m.nhtsa_make_id,
+		m.name,
+		m.created_at,
+		m.updated_at
+	FROM catalog_makes m
+	WHERE cardinality($1::text[]) = 0 OR m.normalized_name = ANY($1)
+	ORDER BY m.name`
+
+	var normalizedNames = make([]string, 0, len(names))
+	for _, name := range names {
+		if n := normalizeName(name); n != "" {
+			normalizedNames = append(normalizedNames, n)
+		}
+	}
+
+	rows, err := s.db.Query(ctx, query, normalizedNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for makes: %w", err)
+	}
+	defer rows.Close()
+
+	var makes []Make
+	for rows.Next() {
+		var m Make
+		if err := rows.Scan(&m.id, &m.NHTSAMakeId, &m.Name, &m.createdAt, &m.updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan make row: %w", err)
+		}
+		makes = append(makes, m)
+	}
+
+	return makes, nil
+}
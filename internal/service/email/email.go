@@ -0,0 +1,115 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/keola-dunn/autolog/internal/logger"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("email service is missing required configurations to perform this operation")
+
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+)
+
+type ServiceConfig struct {
+	// SMTPHost is the mail server emails are sent through. When empty, emails are logged
+	// instead of sent, which is intended for local dev only.
+	SMTPHost string
+	SMTPPort int64
+
+	SMTPUsername string
+	SMTPPassword string
+
+	// From is the address emails are sent from
+	From string
+
+	Logger *logger.Logger
+}
+
+type ServiceIface interface {
+	Send(context.Context, Message) error
+}
+
+type Service struct {
+	smtpAddr string
+	smtpAuth smtp.Auth
+	from     string
+
+	logger *logger.Logger
+}
+
+func NewService(cfg ServiceConfig) *Service {
+	if cfg.SMTPPort <= 0 {
+		cfg.SMTPPort = 587
+	}
+
+	var auth smtp.Auth
+	if strings.TrimSpace(cfg.SMTPUsername) != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	var addr string
+	if strings.TrimSpace(cfg.SMTPHost) != "" {
+		addr = net.JoinHostPort(cfg.SMTPHost, strconv.FormatInt(cfg.SMTPPort, 10))
+	}
+
+	return &Service{
+		smtpAddr: addr,
+		smtpAuth: auth,
+		from:     cfg.From,
+		logger:   cfg.Logger,
+	}
+}
+
+type Message struct {
+	To      string
+	Subject string
+
+	// Body is the plain text body of the email
+	Body string
+}
+
+func (m *Message) valid() bool {
+	if strings.TrimSpace(m.To) == "" ||
+		strings.TrimSpace(m.Subject) == "" ||
+		strings.ContainsAny(m.To, "\r\n") ||
+		strings.ContainsAny(m.Subject, "\r\n") {
+		return false
+	}
+	return true
+}
+
+// Send sends the message. If no mail server is configured the message is logged.
+func (s *Service) Send(ctx context.Context, msg Message) error {
+	if !msg.valid() {
+		return ErrInvalidArg
+	}
+
+	if s.smtpAddr == "" {
+		if s.logger == nil {
+			return ErrMissingRequiredConfiguration
+		}
+		s.logger.Info("no smtp server configured, logging email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+		return nil
+	}
+
+	if strings.TrimSpace(s.from) == "" {
+		return ErrMissingRequiredConfiguration
+	}
+
+	data := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=\"utf-8\"\r\n\r\n%s\r\n",
+		s.from, msg.To, msg.Subject, msg.Body)
+
+	if err := smtp.SendMail(s.smtpAddr, s.smtpAuth, s.from, []string{msg.To}, []byte(data)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
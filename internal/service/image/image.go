@@ -9,6 +9,7 @@ import (
 	"image/jpeg"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -113,6 +114,40 @@ func (s *Service) SaveImage(ctx context.Context, i Image) (*Image, error) {
 	return &i, nil
 }
 
+// GetImage gets an image's record, without loading the image itself. Returns ErrNotFound if it
+// doesn't exist.
+func (s *Service) GetImage(ctx context.Context, id string) (*Image, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	query := `
+	SELECT
+		i.id,
+		i.user_id,
+		COALESCE(i.title, ''),
+		i.path,
+		COALESCE(i.width, 0),
+		COALESCE(i.height, 0),
+		COALESCE(i.imageSizeKb, 0),
+		i.created_at,
+		i.updated_at
+	FROM images i
+	WHERE i.id::text = $1`
+
+	var i Image
+	row := s.db.QueryRow(ctx, query, strings.TrimSpace(id))
+	if err := row.Scan(&i.id, &i.UserId, &i.Title, &i.Path, &i.width, &i.height, &i.SizeKb,
+		&i.createdAt, &i.updatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to query for image: %w", err)
+	}
+
+	return &i, nil
+}
+
 func (s *Service) doesImageIdExist(ctx context.Context, id string) (bool, error) {
 	query := `SELECT 1 FROM images WHERE id = $1`
 
@@ -128,3 +163,53 @@ func (s *Service) doesImageIdExist(ctx context.Context, id string) (bool, error)
 	}
 	return true, nil
 }
+
+// DeleteUserImages removes every image the user uploaded, files and records. It can be repeated
+// safely, files that are already gone are skipped.
+func (s *Service) DeleteUserImages(ctx context.Context, userId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return ErrInvalidArg
+	}
+
+	query := `SELECT id, path FROM images WHERE user_id = $1`
+
+	rows, err := s.db.Query(ctx, query, userId)
+	if err != nil {
+		return fmt.Errorf("failed to query for user images: %w", err)
+	}
+
+	type userImage struct {
+		id   string
+		path string
+	}
+	var images []userImage
+	for rows.Next() {
+		var i userImage
+		if err := rows.Scan(&i.id, &i.path); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan user image: %w", err)
+		}
+		images = append(images, i)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read user images: %w", err)
+	}
+
+	for _, i := range images {
+		if err := os.Remove(i.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove image file: %w", err)
+		}
+
+		// each record goes with its file, so a failure part way only leaves images to retry
+		if _, err := s.db.Exec(ctx, `DELETE FROM images WHERE id = $1`, i.id); err != nil {
+			return fmt.Errorf("failed to delete image: %w", err)
+		}
+	}
+
+	return nil
+}
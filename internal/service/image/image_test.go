@@ -0,0 +1,99 @@
+package image_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/image"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetImage(t *testing.T) {
+	testImageId := "0c8f5b3e-2a4b-4d6e-9f1a-7b3c5d7e9f11"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	query := "SELECT i.id, i.user_id, COALESCE(i.title, ''), i.path, COALESCE(i.width, 0), " +
+		"COALESCE(i.height, 0), COALESCE(i.imageSizeKb, 0), i.created_at, i.updated_at FROM images i " +
+		"WHERE i.id::text = $1"
+	columns := []string{"id", "user_id", "title", "path", "width", "height", "imagesizekb", "created_at", "updated_at"}
+
+	tests := []struct {
+		name    string
+		imageId string
+		dbFunc  func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			imageId:     " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: image.ErrInvalidArg,
+		},
+		{
+			name:    "Found",
+			imageId: testImageId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs(testImageId).
+					WillReturnRows(pgxmock.NewRows(columns).AddRow(testImageId, testUserId, "Title",
+						"images/"+testImageId+".jpg", int64(640), int64(480), int64(52), createdAt, createdAt))
+			},
+		},
+		{
+			name:    "NotFound",
+			imageId: testImageId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs(testImageId).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			expectedErr: image.ErrNotFound,
+		},
+		{
+			name:    "DbError",
+			imageId: testImageId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs(testImageId).
+					WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to query for image: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := image.NewService(image.ServiceConfig{
+				DB: db,
+			})
+
+			i, err := service.GetImage(context.TODO(), test.imageId)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				if !errors.Is(err, test.expectedErr) {
+					require.Equal(t, test.expectedErr.Error(), err.Error())
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testImageId, i.Id())
+			require.Equal(t, testUserId, i.UserId)
+			require.Equal(t, int64(640), i.Width())
+			require.Equal(t, int64(52), i.SizeKb)
+			require.Equal(t, createdAt, i.CreatedAt())
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
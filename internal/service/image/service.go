@@ -2,13 +2,24 @@ package image
 
 import (
 	"context"
+	"errors"
 
 	"github.com/keola-dunn/autolog/internal/platform/postgres"
 	"github.com/keola-dunn/autolog/internal/random"
 )
 
+var (
+	ErrMissingRequiredConfiguration = errors.New("image service is missing required configurations to perform this operation")
+
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	ErrNotFound = errors.New("the requested resource was not found")
+)
+
 type ServiceIface interface {
 	SaveImage(context.Context, Image) (*Image, error)
+	GetImage(ctx context.Context, id string) (*Image, error)
+	DeleteUserImages(ctx context.Context, userId string) error
 }
 
 type Service struct {
@@ -0,0 +1,162 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+	"github.com/keola-dunn/autolog/internal/random"
+)
+
+const (
+	// challengeMaxFailures is how many wrong codes a challenge allows before the user has to
+	// log in with their password again
+	challengeMaxFailures = 5
+
+	challengeTokenBytes = 32
+)
+
+// Challenge is issued after the user logs in with their password, and is exchanged for tokens
+// along with a valid code
+type Challenge struct {
+	// Token is the plain text token. It is only available when the challenge is created.
+	Token     string
+	ExpiresAt time.Time
+}
+
+// CreateChallenge creates a login challenge for the user. Returns ErrLockedOut if the user
+// entered too many wrong codes recently.
+func (s *Service) CreateChallenge(ctx context.Context, userId string) (Challenge, error) {
+	if s.db == nil {
+		return Challenge{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return Challenge{}, ErrInvalidArg
+	}
+
+	if err := s.checkLockout(ctx, s.db, userId); err != nil {
+		return Challenge{}, err
+	}
+
+	token, err := random.SecureToken(challengeTokenBytes)
+	if err != nil {
+		return Challenge{}, fmt.Errorf("failed to generate challenge token: %w", err)
+	}
+
+	challenge := Challenge{
+		Token:     token,
+		ExpiresAt: s.calendarService.NowUTC().Add(s.challengeExpiryLength),
+	}
+
+	query := `
+	INSERT INTO mfa_challenges (user_id, token_hash, expires_at)
+	VALUES ($1, $2, $3)`
+
+	if _, err := s.db.Exec(ctx, query, userId, hashutil.SHA256Hex(token), challenge.ExpiresAt); err != nil {
+		return Challenge{}, fmt.Errorf("failed to insert mfa challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// VerifyChallenge completes the challenge with a TOTP or recovery code. Returns the user id
+// the challenge was issued to. Returns ErrInvalidChallenge if the challenge can't be used,
+// ErrLockedOut if the user entered too many wrong codes across their challenges recently, and
+// ErrInvalidCode if the code is wrong, along with the user id so the failure can be audited.
+func (s *Service) VerifyChallenge(ctx context.Context, token, code string) (string, error) {
+	if s.db == nil {
+		return "", ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(token) == "" || strings.TrimSpace(code) == "" {
+		return "", ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT 
+		mc.id,
+		mc.user_id,
+		mc.failed_attempts,
+		mc.expires_at,
+		mc.completed_at
+	FROM mfa_challenges mc
+	WHERE mc.token_hash = $1
+	FOR UPDATE`
+
+	var id, userId string
+	var failedAttempts int64
+	var expiresAt time.Time
+	var completedAt *time.Time
+	row := tx.QueryRow(ctx, query, hashutil.SHA256Hex(strings.TrimSpace(token)))
+	if err := row.Scan(&id, &userId, &failedAttempts, &expiresAt, &completedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidChallenge
+		}
+		return "", fmt.Errorf("failed to query for mfa challenge: %w", err)
+	}
+
+	if completedAt != nil ||
+		failedAttempts >= challengeMaxFailures ||
+		s.calendarService.NowUTC().After(expiresAt) {
+		return "", ErrInvalidChallenge
+	}
+
+	if err := s.checkLockout(ctx, tx, userId); err != nil {
+		return "", err
+	}
+
+	if err := s.verifyCode(ctx, tx, userId, code); err != nil {
+		if !errors.Is(err, ErrInvalidCode) {
+			return "", err
+		}
+
+		failQuery := `
+		UPDATE mfa_challenges SET
+			failed_attempts = failed_attempts + 1
+		WHERE id = $1`
+
+		if _, err := tx.Exec(ctx, failQuery, id); err != nil {
+			return "", fmt.Errorf("failed to record failed attempt: %w", err)
+		}
+
+		if err := s.recordFailure(ctx, tx, userId); err != nil {
+			return "", err
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return "", fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		return userId, ErrInvalidCode
+	}
+
+	completeQuery := `
+	UPDATE mfa_challenges SET
+		completed_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, completeQuery, id); err != nil {
+		return "", fmt.Errorf("failed to complete mfa challenge: %w", err)
+	}
+
+	if err := s.clearFailures(ctx, tx, userId); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userId, nil
+}
@@ -0,0 +1,364 @@
+package mfa_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/mfa"
+	"github.com/keola-dunn/autolog/internal/totp"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCalendarService struct {
+	now time.Time
+}
+
+func (f *fakeCalendarService) NowUTC() time.Time {
+	return f.now
+}
+
+func (f *fakeCalendarService) Now() time.Time {
+	return f.now
+}
+
+func hash(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyChallenge(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testChallengeId := "0d0c1bd4-8f63-4a6b-b0a4-53f6f0a3e1c2"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testSecret := "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+	currentCode, err := totp.Code(testSecret, totp.Step(now))
+	require.NoError(t, err)
+
+	challengeQuery := "SELECT mc.id, mc.user_id, mc.failed_attempts, mc.expires_at, mc.completed_at FROM mfa_challenges mc WHERE mc.token_hash = $1 FOR UPDATE"
+	secretQuery := "SELECT ut.secret, ut.last_used_step FROM user_totp ut WHERE ut.user_id = $1 AND ut.enabled_at IS NOT NULL FOR UPDATE"
+	recoveryQuery := "UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+	failQuery := "UPDATE mfa_challenges SET failed_attempts = failed_attempts + 1 WHERE id = $1"
+	completeQuery := "UPDATE mfa_challenges SET completed_at = NOW() WHERE id = $1"
+	lockoutQuery := "SELECT lt.locked_until FROM login_throttles lt WHERE lt.kind = $1 AND lt.key = $2"
+	recordFailureQuery := "INSERT INTO login_throttles (kind, key, failed_attempts, last_failed_at) VALUES ($1, $2, 1, $3) " +
+		"ON CONFLICT (kind, key) DO UPDATE SET failed_attempts = CASE WHEN login_throttles.last_failed_at <= $4 THEN 1 " +
+		"ELSE login_throttles.failed_attempts + 1 END, last_failed_at = $3, updated_at = NOW() RETURNING failed_attempts"
+	lockQuery := "UPDATE login_throttles SET locked_until = $3, updated_at = NOW() WHERE kind = $1 AND key = $2"
+	clearFailuresQuery := "DELETE FROM login_throttles WHERE kind = $1 AND key = $2"
+
+	expectNotLocked := func(db pgxmock.PgxConnIface) {
+		db.ExpectQuery(lockoutQuery).
+			WithArgs("mfa", testUserId).
+			WillReturnError(pgx.ErrNoRows)
+	}
+
+	expectFailure := func(db pgxmock.PgxConnIface, failedAttempts int) {
+		db.ExpectExec(failQuery).
+			WithArgs(testChallengeId).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		db.ExpectQuery(recordFailureQuery).
+			WithArgs("mfa", testUserId, now, now.Add(-15*time.Minute)).
+			WillReturnRows(pgxmock.NewRows([]string{"failed_attempts"}).AddRow(failedAttempts))
+	}
+
+	expectCompleted := func(db pgxmock.PgxConnIface) {
+		db.ExpectExec(completeQuery).
+			WithArgs(testChallengeId).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		db.ExpectExec(clearFailuresQuery).
+			WithArgs("mfa", testUserId).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		db.ExpectCommit()
+		db.ExpectRollback()
+	}
+
+	challengeRows := func(failedAttempts int64, expiresAt time.Time, completedAt *time.Time) *pgxmock.Rows {
+		return pgxmock.NewRows([]string{"id", "user_id", "failed_attempts", "expires_at", "completed_at"}).
+			AddRow(testChallengeId, testUserId, failedAttempts, expiresAt, completedAt)
+	}
+
+	tests := []struct {
+		name string
+		code string
+
+		dbFunc         func(db pgxmock.PgxConnIface)
+		expectedUserId string
+		expectedErr    error
+	}{
+		{
+			name:        "InvalidArg",
+			code:        "",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: mfa.ErrInvalidArg,
+		},
+		{
+			name: "UnknownChallenge",
+			code: currentCode,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(hash("mfatoken")).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: mfa.ErrInvalidChallenge,
+		},
+		{
+			name: "ExpiredChallenge",
+			code: currentCode,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(hash("mfatoken")).
+					WillReturnRows(challengeRows(0, now.Add(-time.Second), nil))
+				db.ExpectRollback()
+			},
+			expectedErr: mfa.ErrInvalidChallenge,
+		},
+		{
+			name: "TooManyFailures",
+			code: currentCode,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(hash("mfatoken")).
+					WillReturnRows(challengeRows(5, now.Add(time.Minute), nil))
+				db.ExpectRollback()
+			},
+			expectedErr: mfa.ErrInvalidChallenge,
+		},
+		{
+			name: "ValidTOTPCode",
+			code: currentCode,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(hash("mfatoken")).
+					WillReturnRows(challengeRows(0, now.Add(time.Minute), nil))
+				expectNotLocked(db)
+				db.ExpectQuery(secretQuery).
+					WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"secret", "last_used_step"}).AddRow(testSecret, int64(0)))
+				db.ExpectExec("UPDATE user_totp SET last_used_step = $2, updated_at = NOW() WHERE user_id = $1").
+					WithArgs(testUserId, totp.Step(now)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectCompleted(db)
+			},
+			expectedUserId: testUserId,
+		},
+		{
+			name: "ReplayedTOTPCode",
+			code: currentCode,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(hash("mfatoken")).
+					WillReturnRows(challengeRows(0, now.Add(time.Minute), nil))
+				expectNotLocked(db)
+				db.ExpectQuery(secretQuery).
+					WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"secret", "last_used_step"}).AddRow(testSecret, totp.Step(now)))
+				expectFailure(db, 1)
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedErr:    mfa.ErrInvalidCode,
+			expectedUserId: testUserId,
+		},
+		{
+			name: "RecoveryCode",
+			code: "ABCD-efgh-ijkl-mnop",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(hash("mfatoken")).
+					WillReturnRows(challengeRows(0, now.Add(time.Minute), nil))
+				expectNotLocked(db)
+				db.ExpectQuery(secretQuery).
+					WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"secret", "last_used_step"}).AddRow(testSecret, int64(0)))
+				db.ExpectExec(recoveryQuery).
+					WithArgs(testUserId, hash("abcdefghijklmnop")).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				expectCompleted(db)
+			},
+			expectedUserId: testUserId,
+		},
+		{
+			name: "WrongCode",
+			code: "not-a-code",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(hash("mfatoken")).
+					WillReturnRows(challengeRows(2, now.Add(time.Minute), nil))
+				expectNotLocked(db)
+				db.ExpectQuery(secretQuery).
+					WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"secret", "last_used_step"}).AddRow(testSecret, int64(0)))
+				db.ExpectExec(recoveryQuery).
+					WithArgs(testUserId, hash("notacode")).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				expectFailure(db, 3)
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedErr:    mfa.ErrInvalidCode,
+			expectedUserId: testUserId,
+		},
+		{
+			// wrong codes are counted across the user's challenges, a new challenge doesn't
+			// start the count over
+			name: "WrongCodeLocksUser",
+			code: "not-a-code",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(hash("mfatoken")).
+					WillReturnRows(challengeRows(0, now.Add(time.Minute), nil))
+				expectNotLocked(db)
+				db.ExpectQuery(secretQuery).
+					WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"secret", "last_used_step"}).AddRow(testSecret, int64(0)))
+				db.ExpectExec(recoveryQuery).
+					WithArgs(testUserId, hash("notacode")).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				expectFailure(db, 10)
+				db.ExpectExec(lockQuery).
+					WithArgs("mfa", testUserId, now.Add(15*time.Minute)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedErr:    mfa.ErrInvalidCode,
+			expectedUserId: testUserId,
+		},
+		{
+			// a fresh challenge with the right code is still refused while the user is locked
+			name: "LockedOut",
+			code: currentCode,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(hash("mfatoken")).
+					WillReturnRows(challengeRows(0, now.Add(time.Minute), nil))
+				lockedUntil := now.Add(time.Minute)
+				db.ExpectQuery(lockoutQuery).
+					WithArgs("mfa", testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"locked_until"}).AddRow(&lockedUntil))
+				db.ExpectRollback()
+			},
+			expectedErr: mfa.ErrLockedOut,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := mfa.NewService(mfa.ServiceConfig{
+				DB:              db,
+				CalendarService: &fakeCalendarService{now: now},
+			})
+
+			userId, err := service.VerifyChallenge(context.TODO(), "mfatoken", test.code)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.Equal(t, test.expectedUserId, userId, "userIdComparison")
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreateChallenge(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	lockoutQuery := "SELECT lt.locked_until FROM login_throttles lt WHERE lt.kind = $1 AND lt.key = $2"
+	insertQuery := "INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)"
+
+	tests := []struct {
+		name string
+
+		dbFunc      func(db pgxmock.PgxConnIface)
+		expectedErr error
+	}{
+		{
+			name: "Created",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(lockoutQuery).
+					WithArgs("mfa", testUserId).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectExec(insertQuery).
+					WithArgs(testUserId, pgxmock.AnyArg(), now.Add(5*time.Minute)).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			},
+		},
+		{
+			name: "LockExpired",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				lockedUntil := now.Add(-time.Second)
+				db.ExpectQuery(lockoutQuery).
+					WithArgs("mfa", testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"locked_until"}).AddRow(&lockedUntil))
+				db.ExpectExec(insertQuery).
+					WithArgs(testUserId, pgxmock.AnyArg(), now.Add(5*time.Minute)).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			},
+		},
+		{
+			// logging in with the password again doesn't get a locked user more guesses
+			name: "LockedOut",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				lockedUntil := now.Add(10 * time.Minute)
+				db.ExpectQuery(lockoutQuery).
+					WithArgs("mfa", testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"locked_until"}).AddRow(&lockedUntil))
+			},
+			expectedErr: mfa.ErrLockedOut,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := mfa.NewService(mfa.ServiceConfig{
+				DB:              db,
+				CalendarService: &fakeCalendarService{now: now},
+			})
+
+			challenge, err := service.CreateChallenge(context.TODO(), testUserId)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				require.NoError(t, db.ExpectationsWereMet())
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotEmpty(t, challenge.Token)
+			require.Equal(t, now.Add(5*time.Minute), challenge.ExpiresAt)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+)
+
+const (
+	// recoveryCodeCount is how many recovery codes the user is given at a time
+	recoveryCodeCount = 10
+
+	// recoveryCodeBytes is the randomness in each code, encoded as 16 base32 characters
+	recoveryCodeBytes = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, invalidating the old ones. A valid
+// TOTP or recovery code is required.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userId, code string) ([]string, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(code) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.verifyCode(ctx, tx, userId, code); err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := replaceRecoveryCodes(ctx, tx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return recoveryCodes, nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and creates new ones
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userId string) ([]string, error) {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	var codes = make([]string, 0, recoveryCodeCount)
+	var hashes = make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	query := `
+	INSERT INTO mfa_recovery_codes (user_id, code_hash)
+	SELECT $1, UNNEST($2::text[])`
+
+	if _, err := tx.Exec(ctx, query, userId, hashes); err != nil {
+		return nil, fmt.Errorf("failed to insert recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// useRecoveryCode marks the code as used. Returns false if it isn't one of the user's unused
+// codes.
+func useRecoveryCode(ctx context.Context, tx pgx.Tx, userId, code string) (bool, error) {
+	query := `
+	UPDATE mfa_recovery_codes SET
+		used_at = NOW()
+	WHERE 
+		user_id = $1 AND 
+		code_hash = $2 AND 
+		used_at IS NULL`
+
+	tag, err := tx.Exec(ctx, query, userId, hashRecoveryCode(code))
+	if err != nil {
+		return false, fmt.Errorf("failed to update recovery code: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// newRecoveryCode generates a code formatted for reading, ex. abcd-efgh-ijkl-mnop
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+
+	var groups []string
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:min(i+4, len(encoded))])
+	}
+
+	return strings.Join(groups, "-"), nil
+}
+
+// hashRecoveryCode hashes the code for storage, ignoring case, spaces and dashes so the user
+// can type it however they like. Codes have enough randomness that a fast hash is fine.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	return hashutil.SHA256Hex(normalized)
+}
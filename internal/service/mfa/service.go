@@ -0,0 +1,90 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/calendar"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("mfa service is missing required configurations to perform this operation")
+
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	// ErrInvalidCode is returned when a TOTP or recovery code is wrong or was already used
+	ErrInvalidCode = errors.New("the code is invalid")
+
+	// ErrAlreadyEnabled is returned when enrolling a user that already has 2FA enabled
+	ErrAlreadyEnabled = errors.New("two factor authentication is already enabled")
+
+	// ErrNotEnabled is returned when the user doesn't have 2FA enabled, or hasn't started
+	// enrolling when confirming
+	ErrNotEnabled = errors.New("two factor authentication is not enabled")
+
+	// ErrInvalidChallenge is returned when a login challenge is unknown, expired, already
+	// completed or has had too many wrong codes
+	ErrInvalidChallenge = errors.New("the challenge is invalid")
+
+	// ErrLockedOut is returned when the user entered too many wrong codes recently, across all
+	// of their challenges
+	ErrLockedOut = errors.New("too many failed attempts, two factor authentication is temporarily locked")
+)
+
+type ServiceConfig struct {
+	// DB is the Database used for the mfa service
+	DB postgres.ConnectionPool
+
+	CalendarService calendar.ServiceIface
+
+	// Issuer is shown in authenticator apps next to the account. Defaults to Autolog.
+	Issuer string
+
+	// ChallengeExpiryLength is how long the user has to enter a code after logging in with
+	// their password. Defaults to 5 minutes.
+	ChallengeExpiryLength time.Duration
+}
+
+type ServiceIface interface {
+	StartTOTPEnrollment(ctx context.Context, userId, accountName string) (TOTPEnrollment, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userId, code string) ([]string, error)
+	IsTOTPEnabled(ctx context.Context, userId string) (bool, error)
+	DisableTOTP(ctx context.Context, userId, code string) error
+
+	RegenerateRecoveryCodes(ctx context.Context, userId, code string) ([]string, error)
+
+	CreateChallenge(ctx context.Context, userId string) (Challenge, error)
+	VerifyChallenge(ctx context.Context, token, code string) (string, error)
+}
+
+// Service manages the second factors users log in with
+type Service struct {
+	db              postgres.ConnectionPool
+	calendarService calendar.ServiceIface
+
+	issuer                string
+	challengeExpiryLength time.Duration
+}
+
+func NewService(cfg ServiceConfig) *Service {
+	if cfg.CalendarService == nil {
+		cfg.CalendarService = calendar.NewService()
+	}
+
+	if cfg.Issuer == "" {
+		cfg.Issuer = "Autolog"
+	}
+
+	if cfg.ChallengeExpiryLength <= 0 {
+		cfg.ChallengeExpiryLength = 5 * time.Minute
+	}
+
+	return &Service{
+		db:                    cfg.DB,
+		calendarService:       cfg.CalendarService,
+		issuer:                cfg.Issuer,
+		challengeExpiryLength: cfg.ChallengeExpiryLength,
+	}
+}
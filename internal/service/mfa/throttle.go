@@ -0,0 +1,113 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// mfaThrottleKind is the login_throttles kind wrong codes are counted under, keyed by user.
+	// Every password login creates a new challenge, so the per challenge limit alone doesn't stop
+	// someone with the password from guessing codes.
+	mfaThrottleKind = "mfa"
+
+	// mfaThrottleWindow is how long wrong codes are remembered. A wrong code after a quiet window
+	// starts the count over.
+	mfaThrottleWindow = 15 * time.Minute
+
+	// mfaLockoutFailures is how many wrong codes across the user's challenges lock them out
+	mfaLockoutFailures = 10
+
+	mfaLockoutLength = 15 * time.Minute
+)
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// checkLockout returns ErrLockedOut if the user entered too many wrong codes recently
+func (s *Service) checkLockout(ctx context.Context, db queryRower, userId string) error {
+	query := `
+	SELECT
+		lt.locked_until
+	FROM login_throttles lt
+	WHERE
+		lt.kind = $1 AND
+		lt.key = $2`
+
+	var lockedUntil *time.Time
+	row := db.QueryRow(ctx, query, mfaThrottleKind, userId)
+	if err := row.Scan(&lockedUntil); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to query for mfa throttle: %w", err)
+	}
+
+	if lockedUntil != nil && s.calendarService.NowUTC().Before(*lockedUntil) {
+		return ErrLockedOut
+	}
+
+	return nil
+}
+
+// recordFailure counts a wrong code for the user, and locks them out once there are
+// mfaLockoutFailures in the window
+func (s *Service) recordFailure(ctx context.Context, tx pgx.Tx, userId string) error {
+	now := s.calendarService.NowUTC()
+
+	query := `
+	INSERT INTO login_throttles (kind, key, failed_attempts, last_failed_at)
+	VALUES ($1, $2, 1, $3)
+	ON CONFLICT (kind, key) DO UPDATE SET
+		failed_attempts = CASE
+			WHEN login_throttles.last_failed_at <= $4 THEN 1
+			ELSE login_throttles.failed_attempts + 1
+		END,
+		last_failed_at = $3,
+		updated_at = NOW()
+	RETURNING failed_attempts`
+
+	var failedAttempts int
+	row := tx.QueryRow(ctx, query, mfaThrottleKind, userId, now, now.Add(-mfaThrottleWindow))
+	if err := row.Scan(&failedAttempts); err != nil {
+		return fmt.Errorf("failed to record failed mfa code: %w", err)
+	}
+
+	if failedAttempts < mfaLockoutFailures {
+		return nil
+	}
+
+	lockQuery := `
+	UPDATE login_throttles SET
+		locked_until = $3,
+		updated_at = NOW()
+	WHERE
+		kind = $1 AND
+		key = $2`
+
+	if _, err := tx.Exec(ctx, lockQuery, mfaThrottleKind, userId, now.Add(mfaLockoutLength)); err != nil {
+		return fmt.Errorf("failed to lock mfa: %w", err)
+	}
+
+	return nil
+}
+
+// clearFailures forgets the user's wrong codes once they enter a right one
+func (s *Service) clearFailures(ctx context.Context, tx pgx.Tx, userId string) error {
+	query := `
+	DELETE FROM login_throttles
+	WHERE
+		kind = $1 AND
+		key = $2`
+
+	if _, err := tx.Exec(ctx, query, mfaThrottleKind, userId); err != nil {
+		return fmt.Errorf("failed to delete mfa throttle: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,251 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/totp"
+)
+
+type TOTPEnrollment struct {
+	// Secret is the base32 secret, for users entering it into their authenticator by hand
+	Secret string
+
+	// ProvisioningURI is the otpauth URI to show as a QR code
+	ProvisioningURI string
+}
+
+// StartTOTPEnrollment generates a new TOTP secret for the user. 2FA isn't enabled until the
+// user confirms they've set up their authenticator with ConfirmTOTPEnrollment. Starting again
+// before confirming replaces the secret. accountName is shown in the authenticator app,
+// usually the user's email.
+func (s *Service) StartTOTPEnrollment(ctx context.Context, userId, accountName string) (TOTPEnrollment, error) {
+	if s.db == nil {
+		return TOTPEnrollment{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(accountName) == "" {
+		return TOTPEnrollment{}, ErrInvalidArg
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TOTPEnrollment{}, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	// the update is skipped for enabled secrets, so nothing is returned
+	query := `
+	INSERT INTO user_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET
+		secret = EXCLUDED.secret,
+		last_used_step = 0,
+		updated_at = NOW()
+	WHERE user_totp.enabled_at IS NULL
+	RETURNING user_id`
+
+	var id string
+	row := s.db.QueryRow(ctx, query, userId, secret)
+	if err := row.Scan(&id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return TOTPEnrollment{}, ErrAlreadyEnabled
+		}
+		return TOTPEnrollment{}, fmt.Errorf("failed to upsert totp secret: %w", err)
+	}
+
+	return TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.issuer, accountName, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables 2FA for the user once they've entered a valid code from their
+// authenticator. Returns the user's recovery codes, which are only available now.
+func (s *Service) ConfirmTOTPEnrollment(ctx context.Context, userId, code string) ([]string, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(code) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT 
+		ut.secret,
+		ut.enabled_at
+	FROM user_totp ut
+	WHERE ut.user_id = $1
+	FOR UPDATE`
+
+	var secret string
+	var enabledAt *time.Time
+	row := tx.QueryRow(ctx, query, userId)
+	if err := row.Scan(&secret, &enabledAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotEnabled
+		}
+		return nil, fmt.Errorf("failed to query for totp secret: %w", err)
+	}
+
+	if enabledAt != nil {
+		return nil, ErrAlreadyEnabled
+	}
+
+	step, ok, err := totp.Validate(secret, code, s.calendarService.NowUTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate totp code: %w", err)
+	}
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	enableQuery := `
+	UPDATE user_totp SET
+		enabled_at = NOW(),
+		last_used_step = $2,
+		updated_at = NOW()
+	WHERE user_id = $1`
+
+	if _, err := tx.Exec(ctx, enableQuery, userId, step); err != nil {
+		return nil, fmt.Errorf("failed to enable totp: %w", err)
+	}
+
+	recoveryCodes, err := replaceRecoveryCodes(ctx, tx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return recoveryCodes, nil
+}
+
+// IsTOTPEnabled checks if the user has confirmed TOTP enrollment
+func (s *Service) IsTOTPEnabled(ctx context.Context, userId string) (bool, error) {
+	if s.db == nil {
+		return false, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return false, ErrInvalidArg
+	}
+
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM user_totp ut WHERE ut.user_id = $1 AND ut.enabled_at IS NOT NULL
+	)`
+
+	var enabled bool
+	if err := s.db.QueryRow(ctx, query, userId).Scan(&enabled); err != nil {
+		return false, fmt.Errorf("failed to query if totp is enabled: %w", err)
+	}
+
+	return enabled, nil
+}
+
+// DisableTOTP turns off 2FA for the user. A valid TOTP or recovery code is required, so a
+// stolen session alone can't remove the second factor.
+func (s *Service) DisableTOTP(ctx context.Context, userId, code string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(code) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.verifyCode(ctx, tx, userId, code); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userId); err != nil {
+		return fmt.Errorf("failed to delete totp secret: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// verifyCode checks the code is the user's current TOTP code or one of their unused recovery
+// codes, and uses it up. Returns ErrNotEnabled if the user doesn't have 2FA enabled and
+// ErrInvalidCode if the code is wrong.
+func (s *Service) verifyCode(ctx context.Context, tx pgx.Tx, userId, code string) error {
+	query := `
+	SELECT 
+		ut.secret,
+		ut.last_used_step
+	FROM user_totp ut
+	WHERE 
+		ut.user_id = $1 AND 
+		ut.enabled_at IS NOT NULL
+	FOR UPDATE`
+
+	var secret string
+	var lastUsedStep int64
+	row := tx.QueryRow(ctx, query, userId)
+	if err := row.Scan(&secret, &lastUsedStep); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotEnabled
+		}
+		return fmt.Errorf("failed to query for totp secret: %w", err)
+	}
+
+	step, ok, err := totp.Validate(secret, code, s.calendarService.NowUTC())
+	if err != nil {
+		return fmt.Errorf("failed to validate totp code: %w", err)
+	}
+
+	if ok {
+		if step <= lastUsedStep {
+			// the code was already used, it may have been observed
+			return ErrInvalidCode
+		}
+
+		updateQuery := `
+		UPDATE user_totp SET
+			last_used_step = $2,
+			updated_at = NOW()
+		WHERE user_id = $1`
+
+		if _, err := tx.Exec(ctx, updateQuery, userId, step); err != nil {
+			return fmt.Errorf("failed to update totp last used step: %w", err)
+		}
+		return nil
+	}
+
+	used, err := useRecoveryCode(ctx, tx, userId, code)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+
+	return nil
+}
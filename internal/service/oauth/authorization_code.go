@@ -0,0 +1,158 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+	"github.com/keola-dunn/autolog/internal/random"
+)
+
+type CreateAuthorizationCodeInput struct {
+	ClientId    string
+	UserId      string
+	RedirectURI string
+
+	// Scope is the space separated scopes granted to the client
+	Scope string
+
+	// Nonce is the client's nonce, returned in the ID token
+	Nonce string
+
+	// CodeChallenge is the client's S256 PKCE code challenge
+	CodeChallenge string
+}
+
+// CreateAuthorizationCode issues a code for the user who logged in, for the client to exchange
+// for tokens
+func (s *Service) CreateAuthorizationCode(ctx context.Context, input CreateAuthorizationCodeInput) (string, error) {
+	if s.db == nil {
+		return "", ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.ClientId) == "" ||
+		strings.TrimSpace(input.UserId) == "" ||
+		strings.TrimSpace(input.RedirectURI) == "" ||
+		strings.TrimSpace(input.CodeChallenge) == "" {
+		return "", ErrInvalidArg
+	}
+
+	code, err := random.SecureToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+
+	query := `
+	INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce, 
+		code_challenge, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	if _, err := s.db.Exec(ctx, query, hashutil.SHA256Hex(code), input.ClientId, input.UserId, input.RedirectURI,
+		input.Scope, input.Nonce, input.CodeChallenge,
+		s.calendarService.NowUTC().Add(s.authorizationCodeExpiryLength)); err != nil {
+		return "", fmt.Errorf("failed to insert authorization code: %w", err)
+	}
+
+	return code, nil
+}
+
+type ExchangeAuthorizationCodeInput struct {
+	Code string
+
+	// ClientId is the authenticated client presenting the code
+	ClientId    string
+	RedirectURI string
+
+	// CodeVerifier is the PKCE code verifier the challenge was made from
+	CodeVerifier string
+}
+
+// AuthorizationCode is what the user authorized the client to do
+type AuthorizationCode struct {
+	UserId string
+	Scope  string
+	Nonce  string
+
+	// AuthTime is when the user logged in
+	AuthTime time.Time
+}
+
+// ExchangeAuthorizationCode checks the code was issued to the client for the redirect uri and
+// code verifier, and marks it used. Returns ErrInvalidGrant otherwise.
+func (s *Service) ExchangeAuthorizationCode(ctx context.Context, input ExchangeAuthorizationCodeInput) (AuthorizationCode, error) {
+	if s.db == nil {
+		return AuthorizationCode{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.Code) == "" || strings.TrimSpace(input.CodeVerifier) == "" {
+		return AuthorizationCode{}, ErrInvalidGrant
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return AuthorizationCode{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT 
+		oac.id,
+		oac.client_id,
+		oac.user_id,
+		oac.redirect_uri,
+		oac.scope,
+		oac.nonce,
+		oac.code_challenge,
+		oac.expires_at,
+		oac.used_at,
+		oac.created_at
+	FROM oauth_authorization_codes oac
+	WHERE oac.code_hash = $1
+	FOR UPDATE`
+
+	var id, clientId, redirectURI, codeChallenge string
+	var expiresAt time.Time
+	var usedAt *time.Time
+	var code AuthorizationCode
+	row := tx.QueryRow(ctx, query, hashutil.SHA256Hex(input.Code))
+	if err := row.Scan(&id, &clientId, &code.UserId, &redirectURI, &code.Scope, &code.Nonce,
+		&codeChallenge, &expiresAt, &usedAt, &code.AuthTime); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return AuthorizationCode{}, ErrInvalidGrant
+		}
+		return AuthorizationCode{}, fmt.Errorf("failed to query for authorization code: %w", err)
+	}
+
+	if usedAt != nil ||
+		clientId != input.ClientId ||
+		redirectURI != input.RedirectURI ||
+		!s.calendarService.NowUTC().Before(expiresAt) ||
+		!verifyCodeChallenge(codeChallenge, input.CodeVerifier) {
+		return AuthorizationCode{}, ErrInvalidGrant
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE oauth_authorization_codes SET used_at = NOW() WHERE id = $1`, id); err != nil {
+		return AuthorizationCode{}, fmt.Errorf("failed to mark authorization code used: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return AuthorizationCode{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return code, nil
+}
+
+// verifyCodeChallenge checks the S256 challenge was made from the verifier,
+// https://datatracker.ietf.org/doc/html/rfc7636#section-4.6
+func verifyCodeChallenge(challenge, verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
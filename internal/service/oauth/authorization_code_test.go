@@ -0,0 +1,187 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/oauth"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCalendarService struct {
+	now time.Time
+}
+
+func (f *fakeCalendarService) NowUTC() time.Time {
+	return f.now
+}
+
+func (f *fakeCalendarService) Now() time.Time {
+	return f.now
+}
+
+func hash(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExchangeAuthorizationCode(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCodeId := "0d0c1bd4-8f63-4a6b-b0a4-53f6f0a3e1c2"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testClientId := "web"
+	testRedirectURI := "https://autolog.app/callback"
+	testVerifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	// https://datatracker.ietf.org/doc/html/rfc7636#appendix-B
+	sum := sha256.Sum256([]byte(testVerifier))
+	testChallenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	require.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", testChallenge)
+
+	selectQuery := "SELECT oac.id, oac.client_id, oac.user_id, oac.redirect_uri, oac.scope, oac.nonce, oac.code_challenge, oac.expires_at, oac.used_at, oac.created_at FROM oauth_authorization_codes oac WHERE oac.code_hash = $1 FOR UPDATE"
+	usedQuery := "UPDATE oauth_authorization_codes SET used_at = NOW() WHERE id = $1"
+
+	codeRows := func(clientId, redirectURI string, expiresAt time.Time, usedAt *time.Time) *pgxmock.Rows {
+		return pgxmock.NewRows([]string{"id", "client_id", "user_id", "redirect_uri", "scope", "nonce",
+			"code_challenge", "expires_at", "used_at", "created_at"}).
+			AddRow(testCodeId, clientId, testUserId, redirectURI, "openid email", "test-nonce",
+				testChallenge, expiresAt, usedAt, now.Add(-time.Second))
+	}
+
+	defaultInput := oauth.ExchangeAuthorizationCodeInput{
+		Code:         "test-code",
+		ClientId:     testClientId,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testVerifier,
+	}
+
+	tests := []struct {
+		name  string
+		input oauth.ExchangeAuthorizationCodeInput
+
+		dbFunc       func(db pgxmock.PgxConnIface)
+		expectedCode oauth.AuthorizationCode
+		expectedErr  error
+	}{
+		{
+			name:  "Success",
+			input: defaultInput,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(selectQuery).WithArgs(hash("test-code")).
+					WillReturnRows(codeRows(testClientId, testRedirectURI, now.Add(time.Minute), nil))
+				db.ExpectExec(usedQuery).WithArgs(testCodeId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedCode: oauth.AuthorizationCode{
+				UserId:   testUserId,
+				Scope:    "openid email",
+				Nonce:    "test-nonce",
+				AuthTime: now.Add(-time.Second),
+			},
+		},
+		{
+			name:  "UnknownCode",
+			input: defaultInput,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(selectQuery).WithArgs(hash("test-code")).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: oauth.ErrInvalidGrant,
+		},
+		{
+			name:  "AlreadyUsed",
+			input: defaultInput,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				usedAt := now.Add(-time.Second)
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(selectQuery).WithArgs(hash("test-code")).
+					WillReturnRows(codeRows(testClientId, testRedirectURI, now.Add(time.Minute), &usedAt))
+				db.ExpectRollback()
+			},
+			expectedErr: oauth.ErrInvalidGrant,
+		},
+		{
+			name:  "Expired",
+			input: defaultInput,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(selectQuery).WithArgs(hash("test-code")).
+					WillReturnRows(codeRows(testClientId, testRedirectURI, now, nil))
+				db.ExpectRollback()
+			},
+			expectedErr: oauth.ErrInvalidGrant,
+		},
+		{
+			name:  "OtherClient",
+			input: defaultInput,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(selectQuery).WithArgs(hash("test-code")).
+					WillReturnRows(codeRows("mobile", testRedirectURI, now.Add(time.Minute), nil))
+				db.ExpectRollback()
+			},
+			expectedErr: oauth.ErrInvalidGrant,
+		},
+		{
+			name:  "OtherRedirectURI",
+			input: defaultInput,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(selectQuery).WithArgs(hash("test-code")).
+					WillReturnRows(codeRows(testClientId, "https://autolog.app/other", now.Add(time.Minute), nil))
+				db.ExpectRollback()
+			},
+			expectedErr: oauth.ErrInvalidGrant,
+		},
+		{
+			name: "WrongVerifier",
+			input: oauth.ExchangeAuthorizationCodeInput{
+				Code:         "test-code",
+				ClientId:     testClientId,
+				RedirectURI:  testRedirectURI,
+				CodeVerifier: "another-verifier",
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(selectQuery).WithArgs(hash("test-code")).
+					WillReturnRows(codeRows(testClientId, testRedirectURI, now.Add(time.Minute), nil))
+				db.ExpectRollback()
+			},
+			expectedErr: oauth.ErrInvalidGrant,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := oauth.NewService(oauth.ServiceConfig{
+				DB:              db,
+				CalendarService: &fakeCalendarService{now: now},
+			})
+
+			code, err := service.ExchangeAuthorizationCode(context.Background(), test.input)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.Equal(t, test.expectedCode, code)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
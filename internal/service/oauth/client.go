@@ -0,0 +1,385 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+	"github.com/keola-dunn/autolog/internal/random"
+)
+
+// Client is an app registered to log users in through the provider
+type Client struct {
+	ClientId string
+	Name     string
+
+	// RedirectURIs are the only places users are sent back to with authorization codes
+	RedirectURIs []string
+
+	// Scopes are the scopes the client may request
+	Scopes []string
+
+	// Confidential clients authenticate with a secret. Public clients, like the web and
+	// mobile apps, can't keep one and rely on PKCE alone.
+	Confidential bool
+
+	// Audiences and Permissions are set for service clients, the autolog services that call each
+	// other with the client credentials grant. Their tokens are restricted to one of the
+	// audiences and grant at most the permissions.
+	Audiences   []string
+	Permissions []string
+
+	CreatedAt time.Time
+
+	secretHash string
+}
+
+// ValidRedirectURI checks the redirect uri is registered for the client. URIs must match exactly,
+// except the port of loopback URIs, which native apps pick when they start,
+// https://datatracker.ietf.org/doc/html/rfc8252#section-7.3
+func (c *Client) ValidRedirectURI(redirectURI string) bool {
+	if slices.Contains(c.RedirectURIs, redirectURI) {
+		return true
+	}
+
+	requested, err := url.Parse(redirectURI)
+	if err != nil || requested.Scheme != "http" || !isLoopback(requested.Hostname()) {
+		return false
+	}
+
+	for _, registeredURI := range c.RedirectURIs {
+		registered, err := url.Parse(registeredURI)
+		if err != nil || registered.Scheme != "http" || !isLoopback(registered.Hostname()) {
+			continue
+		}
+
+		if registered.Hostname() == requested.Hostname() &&
+			registered.Path == requested.Path &&
+			registered.RawQuery == requested.RawQuery {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// GrantScope checks the client may request the space separated scope, returning it normalized.
+// Returns ErrInvalidScope otherwise.
+func (c *Client) GrantScope(scope string) (string, error) {
+	requested := ParseScope(scope)
+	if len(requested) == 0 {
+		return "", ErrInvalidScope
+	}
+
+	for _, s := range requested {
+		if !slices.Contains(c.Scopes, s) {
+			return "", ErrInvalidScope
+		}
+	}
+
+	return strings.Join(requested, " "), nil
+}
+
+// ServiceClient checks if the client is a service, which may use the client credentials grant
+func (c *Client) ServiceClient() bool {
+	return c.Confidential && len(c.Audiences) > 0
+}
+
+// ValidAudience checks the service client may request tokens for the audience
+func (c *Client) ValidAudience(audience string) bool {
+	return audience != "" && slices.Contains(c.Audiences, audience)
+}
+
+// GrantPermissions checks the service client may request the space separated permissions,
+// returning them. An empty scope requests every permission of the client. Returns
+// ErrInvalidScope otherwise.
+func (c *Client) GrantPermissions(scope string) ([]string, error) {
+	requested := ParseScope(scope)
+	if len(requested) == 0 {
+		return slices.Clone(c.Permissions), nil
+	}
+
+	for _, permission := range requested {
+		if !slices.Contains(c.Permissions, permission) {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	return requested, nil
+}
+
+// validRegisteredRedirectURI checks a redirect uri can be registered. It must be absolute and
+// without a fragment, and only loopback addresses may use plain http. Custom schemes are allowed
+// for mobile apps.
+func validRegisteredRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Scheme == "" || u.Fragment != "" || u.Opaque != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		return isLoopback(u.Hostname()) || u.Hostname() == "localhost"
+	default:
+		return true
+	}
+}
+
+type CreateClientInput struct {
+	Name         string
+	RedirectURIs []string
+
+	// Scopes default to openid, profile and email
+	Scopes []string
+
+	// Confidential clients are issued a secret
+	Confidential bool
+
+	// Audiences make the client a service client, which must be confidential and has no redirect
+	// uris or scopes. Permissions are what its tokens may grant, and are required for service
+	// clients.
+	Audiences   []string
+	Permissions []string
+}
+
+func (c *CreateClientInput) Valid() bool {
+	if strings.TrimSpace(c.Name) == "" || len(c.Name) > 128 {
+		return false
+	}
+
+	if len(c.Audiences) > 0 {
+		return c.validServiceClient()
+	}
+
+	if len(c.RedirectURIs) == 0 || len(c.Permissions) > 0 {
+		return false
+	}
+
+	for _, redirectURI := range c.RedirectURIs {
+		if !validRegisteredRedirectURI(redirectURI) {
+			return false
+		}
+	}
+
+	for _, scope := range c.Scopes {
+		if !slices.Contains(SupportedScopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *CreateClientInput) validServiceClient() bool {
+	if !c.Confidential || len(c.RedirectURIs) > 0 || len(c.Scopes) > 0 || len(c.Permissions) == 0 {
+		return false
+	}
+
+	for _, audience := range c.Audiences {
+		if strings.TrimSpace(audience) != audience || audience == "" || strings.ContainsAny(audience, " ,") {
+			return false
+		}
+	}
+
+	for _, permission := range c.Permissions {
+		if strings.TrimSpace(permission) != permission || permission == "" || strings.Contains(permission, " ") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CreateClient registers a client. Confidential clients' secrets are returned, they are only
+// available now.
+func (s *Service) CreateClient(ctx context.Context, input CreateClientInput) (Client, string, error) {
+	if s.db == nil {
+		return Client{}, "", ErrMissingRequiredConfiguration
+	}
+
+	if !input.Valid() {
+		return Client{}, "", ErrInvalidArg
+	}
+
+	clientId, err := random.SecureToken(16)
+	if err != nil {
+		return Client{}, "", fmt.Errorf("failed to generate client id: %w", err)
+	}
+
+	client := Client{
+		ClientId:     clientId,
+		Name:         strings.TrimSpace(input.Name),
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       input.Scopes,
+		Confidential: input.Confidential,
+		Audiences:    input.Audiences,
+		Permissions:  input.Permissions,
+	}
+	if len(client.Scopes) == 0 && !client.ServiceClient() {
+		client.Scopes = []string{ScopeOpenId, ScopeProfile, ScopeEmail}
+	}
+
+	// the columns aren't nullable, and pgx sends nil slices as NULL
+	for _, values := range []*[]string{&client.RedirectURIs, &client.Scopes, &client.Audiences, &client.Permissions} {
+		if *values == nil {
+			*values = []string{}
+		}
+	}
+
+	var clientSecret string
+	var secretHash *string
+	if input.Confidential {
+		clientSecret, err = random.SecureToken(32)
+		if err != nil {
+			return Client{}, "", fmt.Errorf("failed to generate client secret: %w", err)
+		}
+		hash := hashutil.SHA256Hex(clientSecret)
+		secretHash = &hash
+	}
+
+	query := `
+	INSERT INTO oauth_clients (client_id, client_secret_hash, name, redirect_uris, scopes, audiences, permissions)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING created_at`
+
+	row := s.db.QueryRow(ctx, query, client.ClientId, secretHash, client.Name, client.RedirectURIs, client.Scopes,
+		client.Audiences, client.Permissions)
+	if err := row.Scan(&client.CreatedAt); err != nil {
+		return Client{}, "", fmt.Errorf("failed to insert client: %w", err)
+	}
+
+	return client, clientSecret, nil
+}
+
+const selectClientQuery = `
+	SELECT 
+		oc.client_id,
+		oc.name,
+		oc.redirect_uris,
+		oc.scopes,
+		oc.audiences,
+		oc.permissions,
+		COALESCE(oc.client_secret_hash, ''),
+		oc.created_at
+	FROM oauth_clients oc`
+
+func scanClient(row pgx.Row) (Client, error) {
+	var client Client
+	if err := row.Scan(&client.ClientId, &client.Name, &client.RedirectURIs, &client.Scopes,
+		&client.Audiences, &client.Permissions, &client.secretHash, &client.CreatedAt); err != nil {
+		return Client{}, err
+	}
+	client.Confidential = client.secretHash != ""
+	return client, nil
+}
+
+// GetClient gets a registered client. Returns ErrNotFound if it doesn't exist.
+func (s *Service) GetClient(ctx context.Context, clientId string) (Client, error) {
+	if s.db == nil {
+		return Client{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(clientId) == "" {
+		return Client{}, ErrInvalidArg
+	}
+
+	client, err := scanClient(s.db.QueryRow(ctx, selectClientQuery+`
+	WHERE oc.client_id = $1`, clientId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Client{}, ErrNotFound
+		}
+		return Client{}, fmt.Errorf("failed to query for client: %w", err)
+	}
+
+	return client, nil
+}
+
+// ListClients lists every registered client
+func (s *Service) ListClients(ctx context.Context) ([]Client, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	rows, err := s.db.Query(ctx, selectClientQuery+`
+	ORDER BY oc.created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for clients: %w", err)
+	}
+	defer rows.Close()
+
+	var clients = []Client{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan client row: %w", err)
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+// DeleteClient removes a registered client, along with its outstanding authorization codes.
+// Returns ErrNotFound if it doesn't exist.
+func (s *Service) DeleteClient(ctx context.Context, clientId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(clientId) == "" {
+		return ErrInvalidArg
+	}
+
+	tag, err := s.db.Exec(ctx, `DELETE FROM oauth_clients WHERE client_id = $1`, clientId)
+	if err != nil {
+		return fmt.Errorf("failed to delete client: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// AuthenticateClient gets the client presenting the credentials. Confidential clients must
+// present their secret, and public clients must not present one. Returns ErrInvalidClient
+// otherwise.
+func (s *Service) AuthenticateClient(ctx context.Context, clientId, clientSecret string) (Client, error) {
+	client, err := s.GetClient(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidArg) {
+			return Client{}, ErrInvalidClient
+		}
+		return Client{}, err
+	}
+
+	if !client.Confidential {
+		if clientSecret != "" {
+			return Client{}, ErrInvalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashutil.SHA256Hex(clientSecret)), []byte(client.secretHash)) != 1 {
+		return Client{}, ErrInvalidClient
+	}
+
+	return client, nil
+}
@@ -0,0 +1,169 @@
+package oauth_test
+
+import (
+	"testing"
+
+	"github.com/keola-dunn/autolog/internal/service/oauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidRedirectURI(t *testing.T) {
+	client := oauth.Client{
+		RedirectURIs: []string{
+			"https://autolog.app/callback",
+			"com.autolog.app:/oauth/callback",
+			"http://127.0.0.1/callback",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		redirectURI string
+		expected    bool
+	}{
+		{name: "Exact", redirectURI: "https://autolog.app/callback", expected: true},
+		{name: "CustomScheme", redirectURI: "com.autolog.app:/oauth/callback", expected: true},
+		{name: "LoopbackAnyPort", redirectURI: "http://127.0.0.1:51004/callback", expected: true},
+		{name: "LoopbackOtherPath", redirectURI: "http://127.0.0.1:51004/other", expected: false},
+		{name: "OtherPath", redirectURI: "https://autolog.app/callback/other", expected: false},
+		{name: "ExtraQuery", redirectURI: "https://autolog.app/callback?next=/", expected: false},
+		{name: "OtherHost", redirectURI: "https://autolog.app.example.com/callback", expected: false},
+		{name: "NotHttps", redirectURI: "http://autolog.app/callback", expected: false},
+		{name: "Empty", redirectURI: "", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, client.ValidRedirectURI(test.redirectURI))
+		})
+	}
+}
+
+func TestGrantScope(t *testing.T) {
+	client := oauth.Client{
+		Scopes: []string{oauth.ScopeOpenId, oauth.ScopeEmail},
+	}
+
+	scope, err := client.GrantScope("openid  email openid")
+	require.NoError(t, err)
+	require.Equal(t, "openid email", scope)
+
+	_, err = client.GrantScope("openid offline_access")
+	require.ErrorIs(t, err, oauth.ErrInvalidScope)
+
+	_, err = client.GrantScope(" ")
+	require.ErrorIs(t, err, oauth.ErrInvalidScope)
+}
+
+func TestGrantPermissions(t *testing.T) {
+	client := oauth.Client{
+		Confidential: true,
+		Audiences:    []string{"images"},
+		Permissions:  []string{"images:read", "images:admin"},
+	}
+
+	require.True(t, client.ServiceClient())
+	require.True(t, client.ValidAudience("images"))
+	require.False(t, client.ValidAudience("autolog-api"))
+	require.False(t, client.ValidAudience(""))
+
+	permissions, err := client.GrantPermissions("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"images:read", "images:admin"}, permissions)
+
+	permissions, err = client.GrantPermissions("images:admin images:admin")
+	require.NoError(t, err)
+	require.Equal(t, []string{"images:admin"}, permissions)
+
+	_, err = client.GrantPermissions("images:read users:admin")
+	require.ErrorIs(t, err, oauth.ErrInvalidScope)
+
+	require.False(t, (&oauth.Client{Audiences: []string{"images"}}).ServiceClient())
+}
+
+func TestCreateClientInputValid(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    oauth.CreateClientInput
+		expected bool
+	}{
+		{
+			name:     "Valid",
+			input:    oauth.CreateClientInput{Name: "Web", RedirectURIs: []string{"https://autolog.app/callback"}},
+			expected: true,
+		},
+		{
+			name:     "Localhost",
+			input:    oauth.CreateClientInput{Name: "Dev", RedirectURIs: []string{"http://localhost:3000/callback"}},
+			expected: true,
+		},
+		{
+			name:     "PlainHttp",
+			input:    oauth.CreateClientInput{Name: "Web", RedirectURIs: []string{"http://autolog.app/callback"}},
+			expected: false,
+		},
+		{
+			name:     "Fragment",
+			input:    oauth.CreateClientInput{Name: "Web", RedirectURIs: []string{"https://autolog.app/callback#x"}},
+			expected: false,
+		},
+		{
+			name:     "Relative",
+			input:    oauth.CreateClientInput{Name: "Web", RedirectURIs: []string{"/callback"}},
+			expected: false,
+		},
+		{
+			name: "UnsupportedScope",
+			input: oauth.CreateClientInput{Name: "Web", RedirectURIs: []string{"https://autolog.app/callback"},
+				Scopes: []string{"admin"}},
+			expected: false,
+		},
+		{
+			name:     "NoRedirectURIs",
+			input:    oauth.CreateClientInput{Name: "Web"},
+			expected: false,
+		},
+		{
+			name: "PermissionsWithoutAudiences",
+			input: oauth.CreateClientInput{Name: "Web", RedirectURIs: []string{"https://autolog.app/callback"},
+				Permissions: []string{"images:read"}},
+			expected: false,
+		},
+		{
+			name: "ServiceClient",
+			input: oauth.CreateClientInput{Name: "autolog-api", Confidential: true, Audiences: []string{"images"},
+				Permissions: []string{"images:read", "images:admin"}},
+			expected: true,
+		},
+		{
+			name: "PublicServiceClient",
+			input: oauth.CreateClientInput{Name: "autolog-api", Audiences: []string{"images"},
+				Permissions: []string{"images:read"}},
+			expected: false,
+		},
+		{
+			name: "ServiceClientWithoutPermissions",
+			input: oauth.CreateClientInput{Name: "autolog-api", Confidential: true,
+				Audiences: []string{"images"}},
+			expected: false,
+		},
+		{
+			name: "ServiceClientWithRedirectURIs",
+			input: oauth.CreateClientInput{Name: "autolog-api", Confidential: true, Audiences: []string{"images"},
+				Permissions: []string{"images:read"}, RedirectURIs: []string{"https://autolog.app/callback"}},
+			expected: false,
+		},
+		{
+			name: "InvalidAudience",
+			input: oauth.CreateClientInput{Name: "autolog-api", Confidential: true, Audiences: []string{"images api"},
+				Permissions: []string{"images:read"}},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, test.input.Valid())
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package oauth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Scopes clients can be allowed to request
+const (
+	// ScopeOpenId makes the request an OpenID Connect request, an ID token is issued
+	ScopeOpenId = "openid"
+
+	// ScopeProfile grants the user's name and username
+	ScopeProfile = "profile"
+
+	// ScopeEmail grants the user's email address and whether it's verified
+	ScopeEmail = "email"
+
+	// ScopeOfflineAccess grants a refresh token
+	ScopeOfflineAccess = "offline_access"
+)
+
+// SupportedScopes are every scope the provider understands
+var SupportedScopes = []string{ScopeOpenId, ScopeProfile, ScopeEmail, ScopeOfflineAccess}
+
+// ParseScope splits a space separated scope into its unique scopes, in order
+func ParseScope(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// HasScope checks if the space separated scope includes s
+func HasScope(scope, s string) bool {
+	return slices.Contains(strings.Fields(scope), s)
+}
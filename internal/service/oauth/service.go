@@ -0,0 +1,75 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/calendar"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("oauth service is missing required configurations to perform this operation")
+
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	ErrNotFound = errors.New("the requested resource was not found")
+
+	// ErrInvalidClient is returned when a client is unknown or fails to authenticate
+	ErrInvalidClient = errors.New("the client is invalid")
+
+	// ErrInvalidScope is returned when a client requests scopes it isn't allowed
+	ErrInvalidScope = errors.New("the requested scope is invalid")
+
+	// ErrInvalidGrant is returned when an authorization code is unknown, expired, already used,
+	// or presented by another client, redirect uri or code verifier than it was issued for
+	ErrInvalidGrant = errors.New("the authorization code is invalid")
+)
+
+type ServiceConfig struct {
+	// DB is the Database used for the oauth service
+	DB postgres.ConnectionPool
+
+	CalendarService calendar.ServiceIface
+
+	// AuthorizationCodeExpiryLength is how long clients have to exchange an authorization code.
+	// Defaults to 1 minute.
+	AuthorizationCodeExpiryLength time.Duration
+}
+
+type ServiceIface interface {
+	CreateClient(ctx context.Context, input CreateClientInput) (Client, string, error)
+	GetClient(ctx context.Context, clientId string) (Client, error)
+	ListClients(ctx context.Context) ([]Client, error)
+	DeleteClient(ctx context.Context, clientId string) error
+	AuthenticateClient(ctx context.Context, clientId, clientSecret string) (Client, error)
+
+	CreateAuthorizationCode(ctx context.Context, input CreateAuthorizationCodeInput) (string, error)
+	ExchangeAuthorizationCode(ctx context.Context, input ExchangeAuthorizationCodeInput) (AuthorizationCode, error)
+}
+
+// Service manages the clients registered with the auth server's OAuth2/OIDC provider, and the
+// authorization codes issued to them
+type Service struct {
+	db              postgres.ConnectionPool
+	calendarService calendar.ServiceIface
+
+	authorizationCodeExpiryLength time.Duration
+}
+
+func NewService(cfg ServiceConfig) *Service {
+	if cfg.CalendarService == nil {
+		cfg.CalendarService = calendar.NewService()
+	}
+
+	if cfg.AuthorizationCodeExpiryLength <= 0 {
+		cfg.AuthorizationCodeExpiryLength = time.Minute
+	}
+
+	return &Service{
+		db:                            cfg.DB,
+		calendarService:               cfg.CalendarService,
+		authorizationCodeExpiryLength: cfg.AuthorizationCodeExpiryLength,
+	}
+}
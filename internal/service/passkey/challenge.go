@@ -0,0 +1,75 @@
+package passkey
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/keola-dunn/autolog/internal/webauthn"
+)
+
+type ceremony string
+
+const (
+	ceremonyRegistration = ceremony("registration")
+	ceremonyLogin        = ceremony("login")
+)
+
+const challengeBytes = 32
+
+// createChallenge stores a new challenge for the ceremony. userId is empty for logins.
+func (s *Service) createChallenge(ctx context.Context, c ceremony, userId string) ([]byte, error) {
+	challenge := make([]byte, challengeBytes)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	var user *string
+	if userId != "" {
+		user = &userId
+	}
+
+	query := `
+	INSERT INTO webauthn_challenges (user_id, ceremony, challenge, expires_at)
+	VALUES ($1, $2, $3, $4)`
+
+	if _, err := s.db.Exec(ctx, query, user, string(c), challenge,
+		s.calendarService.NowUTC().Add(webauthn.CeremonyTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to insert challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// useChallenge finds the challenge in the client data and marks it used, so it can't be
+// replayed. userId must match the challenge's user for registrations.
+//
+// The challenge is used in its own statement, before the response is verified, so a response
+// that fails verification still uses it up.
+func (s *Service) useChallenge(ctx context.Context, clientDataJSON []byte, c ceremony, userId string) ([]byte, error) {
+	challenge, err := webauthn.ClientDataChallenge(clientDataJSON)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	query := `
+	UPDATE webauthn_challenges SET
+		used_at = NOW()
+	WHERE 
+		challenge = $1 AND 
+		ceremony = $2 AND 
+		COALESCE(user_id::text, '') = $3 AND 
+		expires_at >= $4 AND 
+		used_at IS NULL`
+
+	tag, err := s.db.Exec(ctx, query, challenge, string(c), userId, s.calendarService.NowUTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to use challenge: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return nil, ErrInvalidChallenge
+	}
+
+	return challenge, nil
+}
@@ -0,0 +1,329 @@
+package passkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+	"github.com/keola-dunn/autolog/internal/webauthn"
+)
+
+// maxPasskeyNameLength matches the name column
+const maxPasskeyNameLength = 64
+
+// Passkey is a registered WebAuthn credential
+type Passkey struct {
+	Id           string
+	Name         string
+	CredentialId []byte
+	Transports   []string
+
+	// BackedUp is true for passkeys synced between the user's devices
+	BackedUp bool
+
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// userHandle is the WebAuthn user handle for the user, the raw bytes of their id
+func userHandle(userId string) ([]byte, error) {
+	id, err := uuid.Parse(userId)
+	if err != nil {
+		return nil, ErrInvalidArg
+	}
+	return id[:], nil
+}
+
+type BeginRegistrationInput struct {
+	UserId string
+
+	// Name identifies the account in the authenticator, usually the username or email
+	Name        string
+	DisplayName string
+}
+
+// BeginRegistration starts registering a passkey for the user, returning the options to pass to
+// the client
+func (s *Service) BeginRegistration(ctx context.Context, input BeginRegistrationInput) (webauthn.CredentialCreationOptions, error) {
+	if s.db == nil || s.relyingParty == nil {
+		return webauthn.CredentialCreationOptions{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.Name) == "" {
+		return webauthn.CredentialCreationOptions{}, ErrInvalidArg
+	}
+
+	handle, err := userHandle(input.UserId)
+	if err != nil {
+		return webauthn.CredentialCreationOptions{}, err
+	}
+
+	existing, err := s.ListPasskeys(ctx, input.UserId)
+	if err != nil {
+		return webauthn.CredentialCreationOptions{}, fmt.Errorf("failed to list existing passkeys: %w", err)
+	}
+
+	var exclude = make([]webauthn.CredentialDescriptor, 0, len(existing))
+	for _, p := range existing {
+		exclude = append(exclude, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			Id:         p.CredentialId,
+			Transports: p.Transports,
+		})
+	}
+
+	challenge, err := s.createChallenge(ctx, ceremonyRegistration, input.UserId)
+	if err != nil {
+		return webauthn.CredentialCreationOptions{}, fmt.Errorf("failed to create challenge: %w", err)
+	}
+
+	displayName := input.DisplayName
+	if strings.TrimSpace(displayName) == "" {
+		displayName = input.Name
+	}
+
+	return s.relyingParty.NewCreationOptions(challenge, webauthn.UserEntity{
+		Id:          handle,
+		Name:        input.Name,
+		DisplayName: displayName,
+	}, exclude), nil
+}
+
+type FinishRegistrationInput struct {
+	UserId string
+
+	// Name helps the user tell their passkeys apart, ex. "Work laptop"
+	Name string
+
+	Response webauthn.RegistrationResponse
+}
+
+// FinishRegistration verifies the client's response to BeginRegistration and stores the new
+// passkey
+func (s *Service) FinishRegistration(ctx context.Context, input FinishRegistrationInput) (Passkey, error) {
+	if s.db == nil || s.relyingParty == nil {
+		return Passkey{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.UserId) == "" || len(input.Name) > maxPasskeyNameLength {
+		return Passkey{}, ErrInvalidArg
+	}
+
+	challenge, err := s.useChallenge(ctx, input.Response.Response.ClientDataJSON, ceremonyRegistration, input.UserId)
+	if err != nil {
+		return Passkey{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Passkey{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	credential, err := s.relyingParty.VerifyRegistration(input.Response, challenge)
+	if err != nil {
+		return Passkey{}, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+
+	transports := credential.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
+	passkey := Passkey{
+		Name:         strings.TrimSpace(input.Name),
+		CredentialId: credential.Id,
+		Transports:   transports,
+		BackedUp:     credential.BackedUp,
+	}
+
+	query := `
+	INSERT INTO webauthn_credentials (user_id, credential_id, public_key, algorithm, sign_count, 
+		aaguid, transports, backup_eligible, backed_up, name)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	RETURNING id, created_at`
+
+	row := tx.QueryRow(ctx, query, input.UserId, credential.Id, credential.PublicKey, credential.Algorithm,
+		int64(credential.SignCount), credential.AAGUID, transports, credential.BackupEligible,
+		credential.BackedUp, passkey.Name)
+	if err := row.Scan(&passkey.Id, &passkey.CreatedAt); err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return Passkey{}, ErrAlreadyExists
+		}
+		return Passkey{}, fmt.Errorf("failed to insert credential: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Passkey{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return passkey, nil
+}
+
+// BeginLogin starts a passkey login, returning the options to pass to the client. The user
+// picks which of their passkeys to use, so no username is needed.
+func (s *Service) BeginLogin(ctx context.Context) (webauthn.CredentialRequestOptions, error) {
+	if s.db == nil || s.relyingParty == nil {
+		return webauthn.CredentialRequestOptions{}, ErrMissingRequiredConfiguration
+	}
+
+	challenge, err := s.createChallenge(ctx, ceremonyLogin, "")
+	if err != nil {
+		return webauthn.CredentialRequestOptions{}, fmt.Errorf("failed to create challenge: %w", err)
+	}
+
+	return s.relyingParty.NewRequestOptions(challenge, nil), nil
+}
+
+// FinishLogin verifies the client's response to BeginLogin. Returns the id of the user the
+// passkey belongs to.
+func (s *Service) FinishLogin(ctx context.Context, resp webauthn.AssertionResponse) (string, error) {
+	if s.db == nil || s.relyingParty == nil {
+		return "", ErrMissingRequiredConfiguration
+	}
+
+	if len(resp.RawId) == 0 {
+		return "", ErrInvalidArg
+	}
+
+	challenge, err := s.useChallenge(ctx, resp.Response.ClientDataJSON, ceremonyLogin, "")
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT 
+		wc.id,
+		wc.user_id,
+		wc.public_key,
+		wc.algorithm,
+		wc.sign_count
+	FROM webauthn_credentials wc
+	WHERE wc.credential_id = $1
+	FOR UPDATE`
+
+	var id, userId string
+	var signCount int64
+	credential := webauthn.Credential{Id: resp.RawId}
+	row := tx.QueryRow(ctx, query, []byte(resp.RawId))
+	if err := row.Scan(&id, &userId, &credential.PublicKey, &credential.Algorithm, &signCount); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidCredential
+		}
+		return "", fmt.Errorf("failed to query for credential: %w", err)
+	}
+	credential.SignCount = uint32(signCount)
+
+	// the user handle is optional, but must be the owner's if it's sent
+	if len(resp.Response.UserHandle) > 0 {
+		handle, err := userHandle(userId)
+		if err != nil || !bytes.Equal(handle, resp.Response.UserHandle) {
+			return "", ErrInvalidCredential
+		}
+	}
+
+	newSignCount, err := s.relyingParty.VerifyAssertion(resp, challenge, credential)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+
+	updateQuery := `
+	UPDATE webauthn_credentials SET
+		sign_count = $2,
+		last_used_at = NOW(),
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, updateQuery, id, int64(newSignCount)); err != nil {
+		return "", fmt.Errorf("failed to update credential: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userId, nil
+}
+
+// ListPasskeys lists the user's passkeys, newest first
+func (s *Service) ListPasskeys(ctx context.Context, userId string) ([]Passkey, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	query := `
+	SELECT 
+		wc.id,
+		wc.name,
+		wc.credential_id,
+		wc.transports,
+		wc.backed_up,
+		wc.last_used_at,
+		wc.created_at
+	FROM webauthn_credentials wc
+	WHERE wc.user_id = $1
+	ORDER BY wc.created_at DESC`
+
+	rows, err := s.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	var passkeys = []Passkey{}
+	for rows.Next() {
+		var p Passkey
+		if err := rows.Scan(&p.Id, &p.Name, &p.CredentialId, &p.Transports, &p.BackedUp,
+			&p.LastUsedAt, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan passkey row: %w", err)
+		}
+		passkeys = append(passkeys, p)
+	}
+
+	return passkeys, nil
+}
+
+// DeletePasskey removes one of the user's passkeys. Returns ErrNotFound if the user doesn't
+// have the passkey.
+func (s *Service) DeletePasskey(ctx context.Context, userId, passkeyId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(passkeyId) == "" {
+		return ErrInvalidArg
+	}
+
+	query := `
+	DELETE FROM webauthn_credentials
+	WHERE 
+		id::text = $1 AND 
+		user_id = $2`
+
+	tag, err := s.db.Exec(ctx, query, passkeyId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package passkey_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/passkey"
+	"github.com/keola-dunn/autolog/internal/webauthn"
+	"github.com/keola-dunn/autolog/internal/webauthn/webauthntest"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCalendarService struct {
+	now time.Time
+}
+
+func (f *fakeCalendarService) NowUTC() time.Time {
+	return f.now
+}
+
+func (f *fakeCalendarService) Now() time.Time {
+	return f.now
+}
+
+const (
+	testRPId   = "autolog.test"
+	testOrigin = "https://autolog.test"
+)
+
+func TestFinishLogin(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testCredentialRowId := "6b7b3a6e-4c1f-4d0e-9d4a-2f4f5a8f2c11"
+	testChallenge := []byte("01234567890123456789012345678901")
+	testUserHandle := uuid.MustParse(testUserId)
+
+	relyingParty, err := webauthn.NewRelyingParty(webauthn.RelyingPartyConfig{
+		Id:      testRPId,
+		Name:    "Autolog",
+		Origins: []string{testOrigin},
+	})
+	require.NoError(t, err)
+
+	useChallengeQuery := "UPDATE webauthn_challenges SET used_at = NOW() WHERE challenge = $1 AND ceremony = $2 AND " +
+		"COALESCE(user_id::text, '') = $3 AND expires_at >= $4 AND used_at IS NULL"
+	credentialQuery := "SELECT wc.id, wc.user_id, wc.public_key, wc.algorithm, wc.sign_count FROM webauthn_credentials wc WHERE wc.credential_id = $1 FOR UPDATE"
+	updateCredentialQuery := "UPDATE webauthn_credentials SET sign_count = $2, last_used_at = NOW(), updated_at = NOW() WHERE id = $1"
+
+	expectUseChallenge := func(db pgxmock.PgxConnIface, rowsAffected int64) {
+		db.ExpectExec(useChallengeQuery).WithArgs(testChallenge, "login", "", now).
+			WillReturnResult(pgxmock.NewResult("UPDATE", rowsAffected))
+	}
+
+	tests := []struct {
+		name string
+
+		// userHandle is what the authenticator sends back, the owner's by default
+		userHandle []byte
+		// storedSignCount is the sign count saved from the last login
+		storedSignCount int64
+
+		dbFunc         func(db pgxmock.PgxConnIface, a *webauthntest.Authenticator)
+		expectedUserId string
+		expectedErr    error
+	}{
+		{
+			name:       "success",
+			userHandle: testUserHandle[:],
+			dbFunc: func(db pgxmock.PgxConnIface, a *webauthntest.Authenticator) {
+				expectUseChallenge(db, 1)
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(credentialQuery).WithArgs(a.CredentialId).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "public_key", "algorithm", "sign_count"}).
+						AddRow(testCredentialRowId, testUserId, a.PublicKeyCOSE(), webauthn.AlgES256, int64(0)))
+				db.ExpectExec(updateCredentialQuery).WithArgs(testCredentialRowId, int64(1)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedUserId: testUserId,
+		},
+		{
+			name:       "challenge already used",
+			userHandle: testUserHandle[:],
+			dbFunc: func(db pgxmock.PgxConnIface, a *webauthntest.Authenticator) {
+				expectUseChallenge(db, 0)
+			},
+			expectedErr: passkey.ErrInvalidChallenge,
+		},
+		{
+			name:       "challenge expired",
+			userHandle: testUserHandle[:],
+			dbFunc: func(db pgxmock.PgxConnIface, a *webauthntest.Authenticator) {
+				expectUseChallenge(db, 0)
+			},
+			expectedErr: passkey.ErrInvalidChallenge,
+		},
+		{
+			name:       "unknown credential",
+			userHandle: testUserHandle[:],
+			dbFunc: func(db pgxmock.PgxConnIface, a *webauthntest.Authenticator) {
+				expectUseChallenge(db, 1)
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(credentialQuery).WithArgs(a.CredentialId).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: passkey.ErrInvalidCredential,
+		},
+		{
+			name:       "user handle belongs to another user",
+			userHandle: make([]byte, 16),
+			dbFunc: func(db pgxmock.PgxConnIface, a *webauthntest.Authenticator) {
+				expectUseChallenge(db, 1)
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(credentialQuery).WithArgs(a.CredentialId).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "public_key", "algorithm", "sign_count"}).
+						AddRow(testCredentialRowId, testUserId, a.PublicKeyCOSE(), webauthn.AlgES256, int64(0)))
+				db.ExpectRollback()
+			},
+			expectedErr: passkey.ErrInvalidCredential,
+		},
+		{
+			// the challenge is used up before verifying, so a failed assertion can't retry it
+			name:            "sign count regressed",
+			userHandle:      testUserHandle[:],
+			storedSignCount: 5,
+			dbFunc: func(db pgxmock.PgxConnIface, a *webauthntest.Authenticator) {
+				expectUseChallenge(db, 1)
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(credentialQuery).WithArgs(a.CredentialId).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "public_key", "algorithm", "sign_count"}).
+						AddRow(testCredentialRowId, testUserId, a.PublicKeyCOSE(), webauthn.AlgES256, int64(5)))
+				db.ExpectRollback()
+			},
+			expectedErr: passkey.ErrInvalidCredential,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator, err := webauthntest.NewAuthenticator(testRPId, testOrigin)
+			require.NoError(t, err)
+			authenticator.UserHandle = test.userHandle
+
+			resp, err := authenticator.Get(relyingParty.NewRequestOptions(testChallenge, nil))
+			require.NoError(t, err)
+
+			mockDB, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			defer mockDB.Close(context.Background())
+
+			test.dbFunc(mockDB, authenticator)
+
+			svc := passkey.NewService(passkey.ServiceConfig{
+				DB:              mockDB,
+				CalendarService: &fakeCalendarService{now: now},
+				RelyingParty:    relyingParty,
+			})
+
+			userId, err := svc.FinishLogin(context.Background(), resp)
+			if test.expectedErr != nil {
+				require.True(t, errors.Is(err, test.expectedErr), "expected %v, got %v", test.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, test.expectedUserId, userId)
+			require.NoError(t, mockDB.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package passkey
+
+import (
+	"context"
+	"errors"
+
+	"github.com/keola-dunn/autolog/internal/calendar"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+	"github.com/keola-dunn/autolog/internal/webauthn"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("passkey service is missing required configurations to perform this operation")
+
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	ErrNotFound = errors.New("the requested resource was not found")
+
+	// ErrAlreadyExists is returned when registering a credential that is already registered
+	ErrAlreadyExists = errors.New("the passkey is already registered")
+
+	// ErrInvalidChallenge is returned when a ceremony's challenge is unknown, expired, already
+	// used or belongs to another user
+	ErrInvalidChallenge = errors.New("the challenge is invalid")
+
+	// ErrInvalidCredential is returned when a ceremony response fails verification
+	ErrInvalidCredential = errors.New("the passkey response is invalid")
+)
+
+type ServiceConfig struct {
+	// DB is the Database used for the passkey service
+	DB postgres.ConnectionPool
+
+	CalendarService calendar.ServiceIface
+
+	// RelyingParty verifies ceremonies
+	RelyingParty *webauthn.RelyingParty
+}
+
+type ServiceIface interface {
+	BeginRegistration(ctx context.Context, input BeginRegistrationInput) (webauthn.CredentialCreationOptions, error)
+	FinishRegistration(ctx context.Context, input FinishRegistrationInput) (Passkey, error)
+
+	BeginLogin(ctx context.Context) (webauthn.CredentialRequestOptions, error)
+	FinishLogin(ctx context.Context, resp webauthn.AssertionResponse) (string, error)
+
+	ListPasskeys(ctx context.Context, userId string) ([]Passkey, error)
+	DeletePasskey(ctx context.Context, userId, passkeyId string) error
+}
+
+// Service manages users' passkeys and the WebAuthn ceremonies to register and log in with them
+type Service struct {
+	db              postgres.ConnectionPool
+	calendarService calendar.ServiceIface
+	relyingParty    *webauthn.RelyingParty
+}
+
+func NewService(cfg ServiceConfig) *Service {
+	if cfg.CalendarService == nil {
+		cfg.CalendarService = calendar.NewService()
+	}
+
+	return &Service{
+		db:              cfg.DB,
+		calendarService: cfg.CalendarService,
+		relyingParty:    cfg.RelyingParty,
+	}
+}
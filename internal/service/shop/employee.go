@@ -2,10 +2,18 @@ package shop
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
+// ErrLastOwner is returned when removing a shop's only owner, which would leave nobody to manage
+// it
+var ErrLastOwner = errors.New("the shop's only owner can't be removed")
+
 type Role string
 
 const (
@@ -14,6 +22,26 @@ const (
 	RoleOwner = Role("owner")
 )
 
+// ValidRole checks the role is one a shop employee can have
+func ValidRole(role Role) bool {
+	switch role {
+	case RoleEmployee, RoleOwner:
+		return true
+	default:
+		return false
+	}
+}
+
+type Employee struct {
+	Id     string
+	ShopId string
+	UserId string
+	Role   Role
+
+	CreatedBy string
+	CreatedAt time.Time
+}
+
 type CreateEmployeeInput struct {
 	ShopId          string
 	UserId          string
@@ -47,3 +75,217 @@ func (s *Service) CreateEmployee(ctx context.Context, input CreateEmployeeInput)
 
 	return employeeId, nil
 }
+
+// GetEmployee gets the user's employment at the shop. Returns ErrNotFound if they don't work
+// there.
+func (s *Service) GetEmployee(ctx context.Context, shopId, userId string) (Employee, error) {
+	if s.db == nil {
+		return Employee{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(shopId) == "" || strings.TrimSpace(userId) == "" {
+		return Employee{}, ErrInvalidArg
+	}
+
+	return getEmployee(ctx, s.db, shopId, userId)
+}
+
+// queryRower is satisfied by both pgx.Tx and postgres.ConnectionPool
+type queryRower interface {
+	QueryRow(context.Context, string, ...any) pgx.Row
+}
+
+func getEmployee(ctx context.Context, db queryRower, shopId, userId string) (Employee, error) {
+	query := `
+	SELECT
+		e.id,
+		e.shop_id,
+		e.user_id,
+		e."role",
+		e.created_by,
+		e.created_at
+	FROM employees e
+	WHERE
+		e.shop_id = $1 AND
+		e.user_id = $2 AND
+		e.removed_at IS NULL`
+
+	var e Employee
+	row := db.QueryRow(ctx, query, shopId, userId)
+	if err := row.Scan(&e.Id, &e.ShopId, &e.UserId, &e.Role, &e.CreatedBy, &e.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Employee{}, ErrNotFound
+		}
+		return Employee{}, fmt.Errorf("failed to query for employee: %w", err)
+	}
+
+	return e, nil
+}
+
+// ListEmployees lists the shop's employees, owners first then by when they joined
+func (s *Service) ListEmployees(ctx context.Context, shopId string) ([]Employee, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(shopId) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	query := `
+	SELECT
+		e.id,
+		e.shop_id,
+		e.user_id,
+		e."role",
+		e.created_by,
+		e.created_at
+	FROM employees e
+	WHERE
+		e.shop_id = $1 AND
+		e.removed_at IS NULL
+	ORDER BY
+		e."role" = $2 DESC,
+		e.created_at`
+
+	rows, err := s.db.Query(ctx, query, shopId, RoleOwner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for employees: %w", err)
+	}
+	defer rows.Close()
+
+	var employees = []Employee{}
+	for rows.Next() {
+		var e Employee
+		if err := rows.Scan(&e.Id, &e.ShopId, &e.UserId, &e.Role, &e.CreatedBy, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan employee row: %w", err)
+		}
+		employees = append(employees, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read employees: %w", err)
+	}
+
+	return employees, nil
+}
+
+type RemoveEmployeeInput struct {
+	ShopId          string
+	EmployeeId      string
+	RemovedByUserId string
+}
+
+type RemoveEmployeeOutput struct {
+	UserId string
+	Role   Role
+
+	// StillEmployed is true if the user still works at another shop
+	StillEmployed bool
+}
+
+// RemoveEmployee removes the employee from the shop. The row is kept so the work they logged
+// still points at them. Removing an employee that's already removed does nothing and returns
+// the same output, so a caller that failed to revoke their roles can retry. Returns ErrNotFound if
+// they never worked at the shop, and ErrLastOwner if they're its only owner.
+func (s *Service) RemoveEmployee(ctx context.Context, input RemoveEmployeeInput) (RemoveEmployeeOutput, error) {
+	if s.db == nil {
+		return RemoveEmployeeOutput{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.ShopId) == "" ||
+		strings.TrimSpace(input.EmployeeId) == "" ||
+		strings.TrimSpace(input.RemovedByUserId) == "" {
+		return RemoveEmployeeOutput{}, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return RemoveEmployeeOutput{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT
+		e.user_id,
+		e."role",
+		e.removed_at IS NOT NULL
+	FROM employees e
+	WHERE
+		e.id = $1 AND
+		e.shop_id = $2
+	FOR UPDATE`
+
+	var out RemoveEmployeeOutput
+	var removed bool
+	row := tx.QueryRow(ctx, query, input.EmployeeId, input.ShopId)
+	if err := row.Scan(&out.UserId, &out.Role, &removed); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return RemoveEmployeeOutput{}, ErrNotFound
+		}
+		return RemoveEmployeeOutput{}, fmt.Errorf("failed to query for employee: %w", err)
+	}
+
+	if !removed && out.Role == RoleOwner {
+		// the owners are locked so two owners can't remove each other at once
+		ownersQuery := `
+		SELECT
+			e.id
+		FROM employees e
+		WHERE
+			e.shop_id = $1 AND
+			e."role" = $2 AND
+			e.removed_at IS NULL
+		FOR UPDATE`
+
+		rows, err := tx.Query(ctx, ownersQuery, input.ShopId, RoleOwner)
+		if err != nil {
+			return RemoveEmployeeOutput{}, fmt.Errorf("failed to query for shop owners: %w", err)
+		}
+
+		var owners int
+		for rows.Next() {
+			owners++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return RemoveEmployeeOutput{}, fmt.Errorf("failed to read shop owners: %w", err)
+		}
+
+		if owners <= 1 {
+			return RemoveEmployeeOutput{}, ErrLastOwner
+		}
+	}
+
+	updateQuery := `
+	UPDATE employees SET
+		removed_at = NOW(),
+		removed_by = $2,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if !removed {
+		if _, err := tx.Exec(ctx, updateQuery, input.EmployeeId, input.RemovedByUserId); err != nil {
+			return RemoveEmployeeOutput{}, fmt.Errorf("failed to remove employee: %w", err)
+		}
+	}
+
+	employedQuery := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM employees e
+		WHERE
+			e.user_id = $1 AND
+			e.removed_at IS NULL
+	)`
+
+	row = tx.QueryRow(ctx, employedQuery, out.UserId)
+	if err := row.Scan(&out.StillEmployed); err != nil {
+		return RemoveEmployeeOutput{}, fmt.Errorf("failed to query for employments: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return RemoveEmployeeOutput{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return out, nil
+}
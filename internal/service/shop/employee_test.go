@@ -0,0 +1,182 @@
+package shop_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/shop"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveEmployee(t *testing.T) {
+	selectQuery := `SELECT e.user_id, e."role", e.removed_at IS NOT NULL FROM employees e ` +
+		"WHERE e.id = $1 AND e.shop_id = $2 FOR UPDATE"
+	ownersQuery := `SELECT e.id FROM employees e WHERE e.shop_id = $1 AND e."role" = $2 AND e.removed_at IS NULL FOR UPDATE`
+	updateQuery := "UPDATE employees SET removed_at = NOW(), removed_by = $2, updated_at = NOW() WHERE id = $1"
+	employedQuery := "SELECT EXISTS ( SELECT 1 FROM employees e WHERE e.user_id = $1 AND e.removed_at IS NULL )"
+
+	input := shop.RemoveEmployeeInput{
+		ShopId:          testShopId,
+		EmployeeId:      testEmployeeId,
+		RemovedByUserId: testOwnerId,
+	}
+
+	tests := []struct {
+		name   string
+		input  shop.RemoveEmployeeInput
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr    error
+		expectedOutput shop.RemoveEmployeeOutput
+	}{
+		{
+			name: "InvalidArg",
+			input: shop.RemoveEmployeeInput{
+				ShopId:     testShopId,
+				EmployeeId: testEmployeeId,
+			},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: shop.ErrInvalidArg,
+		},
+		{
+			name:  "Removed",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testEmployeeId, testShopId).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "role", "removed"}).AddRow(testUserId, shop.RoleEmployee, false))
+				db.ExpectExec(updateQuery).WithArgs(testEmployeeId, testOwnerId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectQuery(employedQuery).WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedOutput: shop.RemoveEmployeeOutput{
+				UserId: testUserId,
+				Role:   shop.RoleEmployee,
+			},
+		},
+		{
+			name:  "OwnerWithOtherOwners",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testEmployeeId, testShopId).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "role", "removed"}).AddRow(testUserId, shop.RoleOwner, false))
+				db.ExpectQuery(ownersQuery).WithArgs(testShopId, shop.RoleOwner).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testEmployeeId).AddRow("other-owner"))
+				db.ExpectExec(updateQuery).WithArgs(testEmployeeId, testOwnerId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectQuery(employedQuery).WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedOutput: shop.RemoveEmployeeOutput{
+				UserId:        testUserId,
+				Role:          shop.RoleOwner,
+				StillEmployed: true,
+			},
+		},
+		{
+			// a retry after the role revoke failed, the last owner check doesn't apply to them
+			// anymore and nothing is updated
+			name:  "AlreadyRemoved",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testEmployeeId, testShopId).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "role", "removed"}).AddRow(testUserId, shop.RoleOwner, true))
+				db.ExpectQuery(employedQuery).WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedOutput: shop.RemoveEmployeeOutput{
+				UserId: testUserId,
+				Role:   shop.RoleOwner,
+			},
+		},
+		{
+			name:  "LastOwner",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testEmployeeId, testShopId).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "role", "removed"}).AddRow(testUserId, shop.RoleOwner, false))
+				db.ExpectQuery(ownersQuery).WithArgs(testShopId, shop.RoleOwner).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testEmployeeId))
+				db.ExpectRollback()
+			},
+			expectedErr: shop.ErrLastOwner,
+		},
+		{
+			name:  "NotFound",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testEmployeeId, testShopId).WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: shop.ErrNotFound,
+		},
+		{
+			name:  "DbError",
+			input: input,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testEmployeeId, testShopId).
+					WillReturnError(errors.New("fake db error"))
+				db.ExpectRollback()
+			},
+			expectedErr: errors.New("failed to query for employee: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			out, err := service.RemoveEmployee(context.TODO(), test.input)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expectedOutput, out)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListEmployees(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	query := `SELECT e.id, e.shop_id, e.user_id, e."role", e.created_by, e.created_at FROM employees e ` +
+		`WHERE e.shop_id = $1 AND e.removed_at IS NULL ORDER BY e."role" = $2 DESC, e.created_at`
+
+	service, db := newTestService(t)
+
+	db.ExpectQuery(query).WithArgs(testShopId, shop.RoleOwner).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "shop_id", "user_id", "role", "created_by", "created_at"}).
+			AddRow("owner-employee", testShopId, testOwnerId, shop.RoleOwner, testOwnerId, createdAt).
+			AddRow(testEmployeeId, testShopId, testUserId, shop.RoleEmployee, testOwnerId, createdAt))
+
+	employees, err := service.ListEmployees(context.TODO(), testShopId)
+	require.NoError(t, err)
+	require.Equal(t, []shop.Employee{
+		{Id: "owner-employee", ShopId: testShopId, UserId: testOwnerId, Role: shop.RoleOwner, CreatedBy: testOwnerId, CreatedAt: createdAt},
+		{Id: testEmployeeId, ShopId: testShopId, UserId: testUserId, Role: shop.RoleEmployee, CreatedBy: testOwnerId, CreatedAt: createdAt},
+	}, employees)
+	require.NoError(t, db.ExpectationsWereMet())
+
+	_, err = service.ListEmployees(context.TODO(), " ")
+	require.ErrorIs(t, err, shop.ErrInvalidArg)
+}
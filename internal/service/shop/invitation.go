@@ -0,0 +1,285 @@
+package shop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+// ErrInvitationExpired is returned when accepting an invitation after it expired
+var ErrInvitationExpired = errors.New("the invitation has expired")
+
+// maxInvitationEmailLength matches shop_invitations.email
+const maxInvitationEmailLength = 256
+
+// Invitation invites an email address to work at a shop. Invitations expire after a week.
+type Invitation struct {
+	Id       string
+	ShopId   string
+	ShopName string
+	Email    string
+	Role     Role
+
+	InvitedBy string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type CreateInvitationInput struct {
+	ShopId          string
+	Email           string
+	Role            Role
+	InvitedByUserId string
+}
+
+// CreateInvitation invites the email address to work at the shop. Inviting an address again
+// replaces its pending invitation. Returns ErrNotFound if the shop doesn't exist.
+func (s *Service) CreateInvitation(ctx context.Context, input CreateInvitationInput) (Invitation, error) {
+	if s.db == nil {
+		return Invitation{}, ErrMissingRequiredConfiguration
+	}
+
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email ||
+		len(email) > maxInvitationEmailLength {
+		return Invitation{}, ErrInvalidArg
+	}
+
+	if strings.TrimSpace(input.ShopId) == "" ||
+		strings.TrimSpace(input.InvitedByUserId) == "" ||
+		!ValidRole(input.Role) {
+		return Invitation{}, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Invitation{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var invitation = Invitation{
+		ShopId:    input.ShopId,
+		Email:     email,
+		Role:      input.Role,
+		InvitedBy: input.InvitedByUserId,
+	}
+
+	row := tx.QueryRow(ctx, `SELECT name FROM shops WHERE id = $1`, input.ShopId)
+	if err := row.Scan(&invitation.ShopName); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Invitation{}, ErrNotFound
+		}
+		return Invitation{}, fmt.Errorf("failed to query for shop: %w", err)
+	}
+
+	revokeQuery := `
+	UPDATE shop_invitations SET
+		revoked_at = NOW(),
+		updated_at = NOW()
+	WHERE
+		shop_id = $1 AND
+		email = $2 AND
+		accepted_at IS NULL AND
+		revoked_at IS NULL`
+
+	if _, err := tx.Exec(ctx, revokeQuery, input.ShopId, email); err != nil {
+		return Invitation{}, fmt.Errorf("failed to revoke pending invitations: %w", err)
+	}
+
+	query := `
+	INSERT INTO shop_invitations (shop_id, email, "role", invited_by, expires_at)
+	VALUES ($1, $2, $3, $4, NOW() + INTERVAL '7 days')
+	RETURNING id, expires_at, created_at`
+
+	row = tx.QueryRow(ctx, query, input.ShopId, email, input.Role, input.InvitedByUserId)
+	if err := row.Scan(&invitation.Id, &invitation.ExpiresAt, &invitation.CreatedAt); err != nil {
+		return Invitation{}, fmt.Errorf("failed to insert invitation: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Invitation{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// ListInvitations lists the shop's pending invitations, newest first. Accepted, revoked and
+// expired invitations aren't included.
+func (s *Service) ListInvitations(ctx context.Context, shopId string) ([]Invitation, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(shopId) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	query := `
+	SELECT
+		si.id,
+		si.shop_id,
+		s.name,
+		si.email,
+		si."role",
+		si.invited_by,
+		si.expires_at,
+		si.created_at
+	FROM shop_invitations si
+	JOIN shops s ON s.id = si.shop_id
+	WHERE
+		si.shop_id = $1 AND
+		si.accepted_at IS NULL AND
+		si.revoked_at IS NULL AND
+		si.expires_at > NOW()
+	ORDER BY si.created_at DESC`
+
+	rows, err := s.db.Query(ctx, query, shopId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations = []Invitation{}
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.Id, &i.ShopId, &i.ShopName, &i.Email, &i.Role,
+			&i.InvitedBy, &i.ExpiresAt, &i.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan invitation row: %w", err)
+		}
+		invitations = append(invitations, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// RevokeInvitation revokes the shop's pending invitation, its token stops working. Returns
+// ErrNotFound if there's no pending invitation.
+func (s *Service) RevokeInvitation(ctx context.Context, shopId, invitationId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(shopId) == "" || strings.TrimSpace(invitationId) == "" {
+		return ErrInvalidArg
+	}
+
+	query := `
+	UPDATE shop_invitations SET
+		revoked_at = NOW(),
+		updated_at = NOW()
+	WHERE
+		id = $1 AND
+		shop_id = $2 AND
+		accepted_at IS NULL AND
+		revoked_at IS NULL`
+
+	tag, err := s.db.Exec(ctx, query, invitationId, shopId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation makes the user an employee of the invitation's shop, with the invited role.
+// Accepting an invitation the user already accepted returns their employment again, so whatever
+// follows acceptance can be retried. Returns ErrNotFound if the invitation was revoked or
+// accepted by someone else, ErrInvitationExpired once it's expired, and ErrAlreadyExists if the
+// user already works at the shop.
+func (s *Service) AcceptInvitation(ctx context.Context, invitationId, userId string) (Employee, error) {
+	if s.db == nil {
+		return Employee{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(invitationId) == "" || strings.TrimSpace(userId) == "" {
+		return Employee{}, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Employee{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT
+		si.shop_id,
+		si."role",
+		si.invited_by,
+		si.accepted_by,
+		si.revoked_at IS NOT NULL,
+		si.expires_at <= NOW()
+	FROM shop_invitations si
+	WHERE si.id = $1
+	FOR UPDATE`
+
+	var (
+		employee         = Employee{UserId: userId}
+		acceptedBy       *string
+		revoked, expired bool
+	)
+
+	row := tx.QueryRow(ctx, query, invitationId)
+	if err := row.Scan(&employee.ShopId, &employee.Role, &employee.CreatedBy, &acceptedBy,
+		&revoked, &expired); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Employee{}, ErrNotFound
+		}
+		return Employee{}, fmt.Errorf("failed to query for invitation: %w", err)
+	}
+
+	switch {
+	case revoked:
+		return Employee{}, ErrNotFound
+	case acceptedBy != nil:
+		if *acceptedBy != userId {
+			return Employee{}, ErrNotFound
+		}
+		return getEmployee(ctx, tx, employee.ShopId, userId)
+	case expired:
+		return Employee{}, ErrInvitationExpired
+	}
+
+	insertQuery := `
+	INSERT INTO employees (user_id, shop_id, "role", created_by)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`
+
+	row = tx.QueryRow(ctx, insertQuery, userId, employee.ShopId, employee.Role, employee.CreatedBy)
+	if err := row.Scan(&employee.Id, &employee.CreatedAt); err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return Employee{}, ErrAlreadyExists
+		}
+		return Employee{}, fmt.Errorf("failed to insert employee: %w", err)
+	}
+
+	updateQuery := `
+	UPDATE shop_invitations SET
+		accepted_by = $2,
+		accepted_at = NOW(),
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, updateQuery, invitationId, userId); err != nil {
+		return Employee{}, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Employee{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return employee, nil
+}
@@ -0,0 +1,337 @@
+package shop_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/keola-dunn/autolog/internal/service/shop"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testShopId       = "0b8d3a3e-4f5c-4c39-9b0a-5d7c4f2e7a11"
+	testOwnerId      = "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testUserId       = "6f1c2b4d-8e3a-4a57-b1c9-2d4e6f8a0b1c"
+	testInvitationId = "9a7b5c3d-1e2f-4a6b-8c0d-e1f2a3b4c5d6"
+	testEmployeeId   = "3c5e7a9b-0d2f-4e6a-8b1c-3d5f7a9b1c2e"
+)
+
+func newTestService(t *testing.T) (*shop.Service, pgxmock.PgxConnIface) {
+	db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("failed to create new test postgres db: %v", err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	return shop.NewService(shop.ServiceConfig{
+		DB: db,
+	}), db
+}
+
+func requireErr(t *testing.T, expectedErr, err error) {
+	t.Helper()
+
+	require.Error(t, err)
+	if !errors.Is(err, expectedErr) {
+		require.Equal(t, expectedErr.Error(), err.Error())
+	}
+}
+
+func TestCreateInvitation(t *testing.T) {
+	expiresAt := time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC)
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	shopQuery := "SELECT name FROM shops WHERE id = $1"
+	revokeQuery := "UPDATE shop_invitations SET revoked_at = NOW(), updated_at = NOW() " +
+		"WHERE shop_id = $1 AND email = $2 AND accepted_at IS NULL AND revoked_at IS NULL"
+	insertQuery := `INSERT INTO shop_invitations (shop_id, email, "role", invited_by, expires_at) ` +
+		"VALUES ($1, $2, $3, $4, NOW() + INTERVAL '7 days') RETURNING id, expires_at, created_at"
+
+	validInput := shop.CreateInvitationInput{
+		ShopId:          testShopId,
+		Email:           " Mechanic@Example.com ",
+		Role:            shop.RoleEmployee,
+		InvitedByUserId: testOwnerId,
+	}
+
+	tests := []struct {
+		name   string
+		input  shop.CreateInvitationInput
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr        error
+		expectedInvitation shop.Invitation
+	}{
+		{
+			name: "InvalidEmail",
+			input: shop.CreateInvitationInput{
+				ShopId:          testShopId,
+				Email:           "Mechanic <mechanic@example.com>",
+				Role:            shop.RoleEmployee,
+				InvitedByUserId: testOwnerId,
+			},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: shop.ErrInvalidArg,
+		},
+		{
+			name: "InvalidRole",
+			input: shop.CreateInvitationInput{
+				ShopId:          testShopId,
+				Email:           "mechanic@example.com",
+				Role:            shop.Role("manager"),
+				InvitedByUserId: testOwnerId,
+			},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: shop.ErrInvalidArg,
+		},
+		{
+			name:  "ShopNotFound",
+			input: validInput,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(shopQuery).WithArgs(testShopId).WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: shop.ErrNotFound,
+		},
+		{
+			name:  "Created",
+			input: validInput,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(shopQuery).WithArgs(testShopId).
+					WillReturnRows(pgxmock.NewRows([]string{"name"}).AddRow("Kona Auto"))
+				db.ExpectExec(revokeQuery).WithArgs(testShopId, "mechanic@example.com").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectQuery(insertQuery).WithArgs(testShopId, "mechanic@example.com", shop.RoleEmployee, testOwnerId).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "expires_at", "created_at"}).
+						AddRow(testInvitationId, expiresAt, createdAt))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedInvitation: shop.Invitation{
+				Id:        testInvitationId,
+				ShopId:    testShopId,
+				ShopName:  "Kona Auto",
+				Email:     "mechanic@example.com",
+				Role:      shop.RoleEmployee,
+				InvitedBy: testOwnerId,
+				ExpiresAt: expiresAt,
+				CreatedAt: createdAt,
+			},
+		},
+		{
+			name:  "DbError",
+			input: validInput,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(shopQuery).WithArgs(testShopId).
+					WillReturnRows(pgxmock.NewRows([]string{"name"}).AddRow("Kona Auto"))
+				db.ExpectExec(revokeQuery).WithArgs(testShopId, "mechanic@example.com").
+					WillReturnError(errors.New("fake db error"))
+				db.ExpectRollback()
+			},
+			expectedErr: errors.New("failed to revoke pending invitations: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			invitation, err := service.CreateInvitation(context.TODO(), test.input)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expectedInvitation, invitation)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRevokeInvitation(t *testing.T) {
+	query := "UPDATE shop_invitations SET revoked_at = NOW(), updated_at = NOW() " +
+		"WHERE id = $1 AND shop_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL"
+
+	tests := []struct {
+		name   string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name: "Revoked",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs(testInvitationId, testShopId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+		},
+		{
+			name: "NotPending",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs(testInvitationId, testShopId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			expectedErr: shop.ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			err := service.RevokeInvitation(context.TODO(), testShopId, testInvitationId)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	createdAt := time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)
+	otherUserId := "0f9e8d7c-6b5a-4c3d-2e1f-0a9b8c7d6e5f"
+
+	selectQuery := `SELECT si.shop_id, si."role", si.invited_by, si.accepted_by, si.revoked_at IS NOT NULL, ` +
+		"si.expires_at <= NOW() FROM shop_invitations si WHERE si.id = $1 FOR UPDATE"
+	insertQuery := `INSERT INTO employees (user_id, shop_id, "role", created_by) VALUES ($1, $2, $3, $4) ` +
+		"RETURNING id, created_at"
+	updateQuery := "UPDATE shop_invitations SET accepted_by = $2, accepted_at = NOW(), updated_at = NOW() WHERE id = $1"
+	employeeQuery := `SELECT e.id, e.shop_id, e.user_id, e."role", e.created_by, e.created_at FROM employees e ` +
+		"WHERE e.shop_id = $1 AND e.user_id = $2 AND e.removed_at IS NULL"
+
+	invitationRows := func(acceptedBy *string, revoked, expired bool) *pgxmock.Rows {
+		return pgxmock.NewRows([]string{"shop_id", "role", "invited_by", "accepted_by", "revoked", "expired"}).
+			AddRow(testShopId, shop.RoleEmployee, testOwnerId, acceptedBy, revoked, expired)
+	}
+
+	expectedEmployee := shop.Employee{
+		Id:        testEmployeeId,
+		ShopId:    testShopId,
+		UserId:    testUserId,
+		Role:      shop.RoleEmployee,
+		CreatedBy: testOwnerId,
+		CreatedAt: createdAt,
+	}
+
+	tests := []struct {
+		name   string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr      error
+		expectedEmployee shop.Employee
+	}{
+		{
+			name: "Accepted",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testInvitationId).
+					WillReturnRows(invitationRows(nil, false, false))
+				db.ExpectQuery(insertQuery).WithArgs(testUserId, testShopId, shop.RoleEmployee, testOwnerId).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(testEmployeeId, createdAt))
+				db.ExpectExec(updateQuery).WithArgs(testInvitationId, testUserId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedEmployee: expectedEmployee,
+		},
+		{
+			name: "AlreadyAcceptedByUser",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				acceptedBy := testUserId
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testInvitationId).
+					WillReturnRows(invitationRows(&acceptedBy, false, true))
+				db.ExpectQuery(employeeQuery).WithArgs(testShopId, testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "shop_id", "user_id", "role", "created_by", "created_at"}).
+						AddRow(testEmployeeId, testShopId, testUserId, shop.RoleEmployee, testOwnerId, createdAt))
+				db.ExpectRollback()
+			},
+			expectedEmployee: expectedEmployee,
+		},
+		{
+			name: "AcceptedBySomeoneElse",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				acceptedBy := otherUserId
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testInvitationId).
+					WillReturnRows(invitationRows(&acceptedBy, false, false))
+				db.ExpectRollback()
+			},
+			expectedErr: shop.ErrNotFound,
+		},
+		{
+			name: "Revoked",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testInvitationId).
+					WillReturnRows(invitationRows(nil, true, false))
+				db.ExpectRollback()
+			},
+			expectedErr: shop.ErrNotFound,
+		},
+		{
+			name: "Expired",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testInvitationId).
+					WillReturnRows(invitationRows(nil, false, true))
+				db.ExpectRollback()
+			},
+			expectedErr: shop.ErrInvitationExpired,
+		},
+		{
+			name: "NotFound",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testInvitationId).WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: shop.ErrNotFound,
+		},
+		{
+			name: "AlreadyEmployee",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testInvitationId).
+					WillReturnRows(invitationRows(nil, false, false))
+				db.ExpectQuery(insertQuery).WithArgs(testUserId, testShopId, shop.RoleEmployee, testOwnerId).
+					WillReturnError(&pgconn.PgError{Code: "23505"})
+				db.ExpectRollback()
+			},
+			expectedErr: shop.ErrAlreadyExists,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			employee, err := service.AcceptInvitation(context.TODO(), testInvitationId, testUserId)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expectedEmployee, employee)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/keola-dunn/autolog/internal/platform/postgres"
 	"github.com/keola-dunn/autolog/internal/random"
 )
@@ -15,6 +16,10 @@ var (
 	ErrMissingRequiredConfiguration = errors.New("auth service is missing required configurations to perform this operation")
 
 	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	ErrNotFound = errors.New("the requested resource was not found")
+
+	ErrAlreadyExists = errors.New("the resource already exists")
 )
 
 type ServiceConfig struct {
@@ -26,8 +31,21 @@ type ServiceConfig struct {
 }
 
 type ServiceIface interface {
-	CreateShop(ctx context.Context, shop Shop, creatorUserId string) (string, error)
-	SearchForShop(ctx context.Context, term string, limit int64) ([]Shop, error)
+	CreateShop(ctx context.Context, shop Shop, creatorUserId string) (Shop, error)
+	GetShop(ctx context.Context, shopId string) (Shop, error)
+	UpdateShop(ctx context.Context, shopId string, shop Shop) (Shop, error)
+	SearchForShop(ctx context.Context, input SearchForShopInput) (SearchForShopOutput, error)
+
+	GetEmployee(ctx context.Context, shopId, userId string) (Employee, error)
+	ListEmployees(ctx context.Context, shopId string) ([]Employee, error)
+	RemoveEmployee(ctx context.Context, input RemoveEmployeeInput) (RemoveEmployeeOutput, error)
+
+	CreateInvitation(ctx context.Context, input CreateInvitationInput) (Invitation, error)
+	ListInvitations(ctx context.Context, shopId string) ([]Invitation, error)
+	RevokeInvitation(ctx context.Context, shopId, invitationId string) error
+	AcceptInvitation(ctx context.Context, invitationId, userId string) (Employee, error)
+
+	DeleteUserData(ctx context.Context, userId string) error
 }
 
 type Service struct {
@@ -61,9 +79,30 @@ type Shop struct {
 	updatedAt time.Time
 }
 
-func (s *Shop) valid() bool {
-	// TODO: build into this at a later date
-	return strings.TrimSpace(s.Name) != ""
+// Valid checks the shop has a name, and that its fields fit the shops table
+func (s *Shop) Valid() bool {
+	if strings.TrimSpace(s.Name) == "" {
+		return false
+	}
+
+	for _, field := range []struct {
+		value     string
+		maxLength int
+	}{
+		{s.Name, 256},
+		{s.Address1, 256},
+		{s.Address2, 256},
+		{s.City, 128},
+		{s.State, 4},
+		{s.Zip, 12},
+		{s.Phone, 20},
+	} {
+		if len(field.value) > field.maxLength {
+			return false
+		}
+	}
+
+	return true
 }
 
 func (s *Shop) Id() string {
@@ -82,15 +121,22 @@ func (s *Shop) UpdatedAt() time.Time {
 	return s.updatedAt
 }
 
-func (s *Service) CreateShop(ctx context.Context, shop Shop, creatorUserId string) (string, error) {
+// CreateShop creates the shop, and makes its creator the shop's owner
+func (s *Service) CreateShop(ctx context.Context, shop Shop, creatorUserId string) (Shop, error) {
 	if s.db == nil {
-		return "", ErrMissingRequiredConfiguration
+		return Shop{}, ErrMissingRequiredConfiguration
 	}
 
-	if !shop.valid() {
-		return "", ErrInvalidArg
+	if !shop.Valid() || strings.TrimSpace(creatorUserId) == "" {
+		return Shop{}, ErrInvalidArg
 	}
 
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Shop{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
 	INSERT INTO shops (
     	name,
@@ -103,65 +149,213 @@ func (s *Service) CreateShop(ctx context.Context, shop Shop, creatorUserId strin
     	created_by
 	) VALUES 
 	 ($1, $2, $3, $4, $5, $6, $7, $8)
-	 RETURNING id`
+	 RETURNING id, created_at, updated_at`
 
-	row := s.db.QueryRow(ctx, query, shop.Name, shop.Address1,
+	row := tx.QueryRow(ctx, query, shop.Name, shop.Address1,
 		shop.Address2, shop.City, shop.State, shop.Zip,
 		shop.Phone, creatorUserId)
 
-	var shopId string
-	if err := row.Scan(&shopId); err != nil {
-		return "", fmt.Errorf("failed to insert shop: %w", err)
+	if err := row.Scan(&shop.id, &shop.createdAt, &shop.updatedAt); err != nil {
+		return Shop{}, fmt.Errorf("failed to insert shop: %w", err)
+	}
+	shop.createdBy = creatorUserId
+
+	ownerQuery := `
+	INSERT INTO employees (user_id, shop_id, "role", created_by) 
+	VALUES ($1, $2, $3, $1)`
+
+	if _, err := tx.Exec(ctx, ownerQuery, creatorUserId, shop.id, RoleOwner); err != nil {
+		return Shop{}, fmt.Errorf("failed to insert shop owner: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Shop{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return shop, nil
+}
+
+// shopColumns are the columns scanned by scanShop
+const shopColumns = `
+	s.id,
+	s.name,
+	s.address1,
+	s.address2,
+	s.city,
+	s.state,
+	s.zip,
+	s.phone,
+	s.created_by,
+	s.created_at,
+	s.updated_at`
+
+func scanShop(row pgx.Row, extra ...any) (Shop, error) {
+	var shop Shop
+	dest := append([]any{&shop.id, &shop.Name, &shop.Address1, &shop.Address2, &shop.City,
+		&shop.State, &shop.Zip, &shop.Phone, &shop.createdBy, &shop.createdAt, &shop.updatedAt}, extra...)
+
+	if err := row.Scan(dest...); err != nil {
+		return Shop{}, err
+	}
+
+	return shop, nil
+}
+
+// GetShop gets the shop. Returns ErrNotFound if it doesn't exist.
+func (s *Service) GetShop(ctx context.Context, shopId string) (Shop, error) {
+	if s.db == nil {
+		return Shop{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(shopId) == "" {
+		return Shop{}, ErrInvalidArg
+	}
+
+	query := `
+	SELECT` + shopColumns + `
+	FROM shops s
+	WHERE s.id = $1`
+
+	shop, err := scanShop(s.db.QueryRow(ctx, query, shopId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Shop{}, ErrNotFound
+		}
+		return Shop{}, fmt.Errorf("failed to query for shop: %w", err)
 	}
 
-	return shopId, nil
+	return shop, nil
 }
 
-func (s *Service) SearchForShop(ctx context.Context, term string, limit int64) ([]Shop, error) {
+// UpdateShop replaces the shop's details. Returns ErrNotFound if it doesn't exist.
+func (s *Service) UpdateShop(ctx context.Context, shopId string, shop Shop) (Shop, error) {
 	if s.db == nil {
-		return nil, ErrMissingRequiredConfiguration
+		return Shop{}, ErrMissingRequiredConfiguration
 	}
 
-	if strings.TrimSpace(term) == "" || len(term) <= 3 {
-		return nil, ErrInvalidArg
+	if strings.TrimSpace(shopId) == "" || !shop.Valid() {
+		return Shop{}, ErrInvalidArg
 	}
 
 	query := `
-	SELECT 
-		s.id,
-    	s.name,
-    	s.address1,
-    	s.address2,
-    	s.city,
-    	s.state,
-    	s.zip,
-    	s.phone,
-    	s.created_by,
-    	s.created_at,
-    	s.updated_at
+	UPDATE shops s SET
+		name = $2,
+		address1 = $3,
+		address2 = $4,
+		city = $5,
+		state = $6,
+		zip = $7,
+		phone = $8,
+		updated_at = NOW()
+	WHERE s.id = $1
+	RETURNING` + shopColumns
+
+	updated, err := scanShop(s.db.QueryRow(ctx, query, shopId, shop.Name, shop.Address1,
+		shop.Address2, shop.City, shop.State, shop.Zip, shop.Phone))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Shop{}, ErrNotFound
+		}
+		return Shop{}, fmt.Errorf("failed to update shop: %w", err)
+	}
+
+	return updated, nil
+}
+
+const (
+	// minSearchTermLength is the shortest term searched for, shorter terms have too few trigrams
+	// to match on
+	minSearchTermLength = 3
+
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+type SearchForShopInput struct {
+	// Term is matched against the shops' names, cities and zip codes, ex. "kona auto" or "96740"
+	Term string
+
+	// Limit defaults to 20, and is at most 50
+	Limit  int64
+	Offset int64
+}
+
+type SearchForShopOutput struct {
+	Shops []Shop
+
+	// Total is how many shops matched across every page, including for pages past the last match
+	Total int64
+
+	// Limit is the page size used, after defaulting and capping the input's
+	Limit int64
+}
+
+// SearchForShop searches for shops by name, city and zip code. Shops are ranked by how closely
+// a word in them matches the term, so misspellings and partial names still match, then by how
+// closely their name matches.
+func (s *Service) SearchForShop(ctx context.Context, input SearchForShopInput) (SearchForShopOutput, error) {
+	if s.db == nil {
+		return SearchForShopOutput{}, ErrMissingRequiredConfiguration
+	}
+
+	term := strings.ToLower(strings.Join(strings.Fields(input.Term), " "))
+	if len(term) < minSearchTermLength || input.Limit < 0 || input.Offset < 0 {
+		return SearchForShopOutput{}, ErrInvalidArg
+	}
+
+	limit := input.Limit
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	query := `
+	SELECT` + shopColumns + `,
+		COUNT(*) OVER ()
 	FROM shops s
-	WHERE 
-		LOWER(CONCAT(s.name, ' - ', s.city)) LIKE LOWER(%1) OR 
-		LOWER(CONCAT(s.name, ' - ', s.address1, ' ', s.address2, ', ', s.city, ', ', s.state, ' ', s.zip)) LIKE LOWER(%1)
-	ORDER BY CONCAT(s.name, ' - ', s.city)
-	LIMIT $2`
+	WHERE $1 <% s.search_text
+	ORDER BY
+		word_similarity($1, s.search_text) DESC,
+		similarity($1, LOWER(s.name)) DESC,
+		s.name,
+		s.id
+	LIMIT $2
+	OFFSET $3`
 
-	rows, err := s.db.Query(ctx, query, strings.TrimSpace(strings.ToLower(fmt.Sprintf("%%%s%%", term))), limit)
+	rows, err := s.db.Query(ctx, query, term, limit, input.Offset)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query for shops: %w", err)
+		return SearchForShopOutput{}, fmt.Errorf("failed to query for shops: %w", err)
 	}
 	defer rows.Close()
 
-	var shops = make([]Shop, 0, limit)
+	var out = SearchForShopOutput{
+		Shops: make([]Shop, 0, limit),
+		Limit: limit,
+	}
 	for rows.Next() {
-		var shop Shop
-
-		if err := rows.Scan(&shop); err != nil {
-			return nil, fmt.Errorf("failed to scan shop: %w", err)
+		shop, err := scanShop(rows, &out.Total)
+		if err != nil {
+			return SearchForShopOutput{}, fmt.Errorf("failed to scan shop: %w", err)
 		}
 
-		shops = append(shops, shop)
+		out.Shops = append(out.Shops, shop)
+	}
+	if err := rows.Err(); err != nil {
+		return SearchForShopOutput{}, fmt.Errorf("failed to read shops: %w", err)
+	}
+
+	// the count comes with the page's rows, so a page past the last match has to count on its own
+	if len(out.Shops) == 0 && input.Offset > 0 {
+		countQuery := `
+		SELECT 
+			COUNT(*)
+		FROM shops s
+		WHERE $1 <% s.search_text`
+
+		if err := s.db.QueryRow(ctx, countQuery, term).Scan(&out.Total); err != nil {
+			return SearchForShopOutput{}, fmt.Errorf("failed to count shops: %w", err)
+		}
 	}
 
-	return shops, nil
+	return out, nil
 }
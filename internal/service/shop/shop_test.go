@@ -0,0 +1,294 @@
+package shop_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/shop"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const shopColumns = "s.id, s.name, s.address1, s.address2, s.city, s.state, s.zip, s.phone, s.created_by, s.created_at, s.updated_at"
+
+var shopColumnNames = []string{"id", "name", "address1", "address2", "city", "state", "zip", "phone",
+	"created_by", "created_at", "updated_at"}
+
+func testShop() shop.Shop {
+	return shop.Shop{
+		Name:     "Kona Auto Repair",
+		Address1: "75-5660 Kopiko St",
+		City:     "Kailua-Kona",
+		State:    "HI",
+		Zip:      "96740",
+		Phone:    "808-555-0100",
+	}
+}
+
+func TestCreateShop(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	insertQuery := "INSERT INTO shops ( name, address1, address2, city, state, zip, phone, created_by ) VALUES " +
+		"($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at, updated_at"
+	ownerQuery := `INSERT INTO employees (user_id, shop_id, "role", created_by) VALUES ($1, $2, $3, $1)`
+
+	s := testShop()
+
+	tests := []struct {
+		name   string
+		shop   shop.Shop
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "MissingName",
+			shop:        shop.Shop{City: "Hilo"},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: shop.ErrInvalidArg,
+		},
+		{
+			name:        "StateTooLong",
+			shop:        shop.Shop{Name: "Hilo Auto", State: "Hawaii"},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: shop.ErrInvalidArg,
+		},
+		{
+			name: "Created",
+			shop: s,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(insertQuery).WithArgs(s.Name, s.Address1, s.Address2, s.City, s.State, s.Zip, s.Phone, testOwnerId).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(testShopId, createdAt, createdAt))
+				db.ExpectExec(ownerQuery).WithArgs(testOwnerId, testShopId, shop.RoleOwner).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+		{
+			name: "DbError",
+			shop: s,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(insertQuery).WithArgs(s.Name, s.Address1, s.Address2, s.City, s.State, s.Zip, s.Phone, testOwnerId).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(testShopId, createdAt, createdAt))
+				db.ExpectExec(ownerQuery).WithArgs(testOwnerId, testShopId, shop.RoleOwner).
+					WillReturnError(errors.New("fake db error"))
+				db.ExpectRollback()
+			},
+			expectedErr: errors.New("failed to insert shop owner: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			created, err := service.CreateShop(context.TODO(), test.shop, testOwnerId)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testShopId, created.Id())
+			require.Equal(t, testOwnerId, created.CreatedBy())
+			require.Equal(t, createdAt, created.CreatedAt())
+			require.Equal(t, test.shop.Name, created.Name)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetShop(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	query := "SELECT " + shopColumns + " FROM shops s WHERE s.id = $1"
+
+	t.Run("Found", func(t *testing.T) {
+		service, db := newTestService(t)
+
+		s := testShop()
+		db.ExpectQuery(query).WithArgs(testShopId).
+			WillReturnRows(pgxmock.NewRows(shopColumnNames).AddRow(testShopId, s.Name, s.Address1, s.Address2,
+				s.City, s.State, s.Zip, s.Phone, testOwnerId, createdAt, createdAt))
+
+		found, err := service.GetShop(context.TODO(), testShopId)
+		require.NoError(t, err)
+		require.Equal(t, testShopId, found.Id())
+		require.Equal(t, s.Name, found.Name)
+		require.Equal(t, s.Zip, found.Zip)
+		require.NoError(t, db.ExpectationsWereMet())
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		service, db := newTestService(t)
+
+		db.ExpectQuery(query).WithArgs(testShopId).WillReturnError(pgx.ErrNoRows)
+
+		_, err := service.GetShop(context.TODO(), testShopId)
+		require.ErrorIs(t, err, shop.ErrNotFound)
+	})
+}
+
+func TestUpdateShop(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	updatedAt := time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	query := "UPDATE shops s SET name = $2, address1 = $3, address2 = $4, city = $5, state = $6, zip = $7, " +
+		"phone = $8, updated_at = NOW() WHERE s.id = $1 RETURNING " + shopColumns
+
+	s := testShop()
+	s.Phone = "808-555-0199"
+
+	t.Run("Updated", func(t *testing.T) {
+		service, db := newTestService(t)
+
+		db.ExpectQuery(query).WithArgs(testShopId, s.Name, s.Address1, s.Address2, s.City, s.State, s.Zip, s.Phone).
+			WillReturnRows(pgxmock.NewRows(shopColumnNames).AddRow(testShopId, s.Name, s.Address1, s.Address2,
+				s.City, s.State, s.Zip, s.Phone, testOwnerId, createdAt, updatedAt))
+
+		updated, err := service.UpdateShop(context.TODO(), testShopId, s)
+		require.NoError(t, err)
+		require.Equal(t, "808-555-0199", updated.Phone)
+		require.Equal(t, updatedAt, updated.UpdatedAt())
+		require.NoError(t, db.ExpectationsWereMet())
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		service, db := newTestService(t)
+
+		db.ExpectQuery(query).WithArgs(testShopId, s.Name, s.Address1, s.Address2, s.City, s.State, s.Zip, s.Phone).
+			WillReturnError(pgx.ErrNoRows)
+
+		_, err := service.UpdateShop(context.TODO(), testShopId, s)
+		require.ErrorIs(t, err, shop.ErrNotFound)
+	})
+
+	t.Run("InvalidArg", func(t *testing.T) {
+		service, _ := newTestService(t)
+
+		_, err := service.UpdateShop(context.TODO(), testShopId, shop.Shop{Name: strings.Repeat("a", 257)})
+		require.ErrorIs(t, err, shop.ErrInvalidArg)
+	})
+}
+
+func TestSearchForShop(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	query := "SELECT " + shopColumns + ", COUNT(*) OVER () FROM shops s WHERE $1 <% s.search_text " +
+		"ORDER BY word_similarity($1, s.search_text) DESC, similarity($1, LOWER(s.name)) DESC, s.name, s.id " +
+		"LIMIT $2 OFFSET $3"
+	countQuery := "SELECT COUNT(*) FROM shops s WHERE $1 <% s.search_text"
+
+	rows := func() *pgxmock.Rows {
+		return pgxmock.NewRows(append(shopColumnNames, "count")).
+			AddRow(testShopId, "Kona Auto Repair", "", "", "Kailua-Kona", "HI", "96740", "", testOwnerId, createdAt, createdAt, int64(2)).
+			AddRow("1d2c3b4a-5e6f-4a7b-8c9d-0e1f2a3b4c5d", "Kona Tire", "", "", "Kailua-Kona", "HI", "96740", "", testOwnerId, createdAt, createdAt, int64(2))
+	}
+
+	tests := []struct {
+		name   string
+		input  shop.SearchForShopInput
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr   error
+		expectedNames []string
+		expectedTotal int64
+		expectedLimit int64
+	}{
+		{
+			name:        "TermTooShort",
+			input:       shop.SearchForShopInput{Term: " ko "},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: shop.ErrInvalidArg,
+		},
+		{
+			name:        "NegativeOffset",
+			input:       shop.SearchForShopInput{Term: "kona", Offset: -1},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: shop.ErrInvalidArg,
+		},
+		{
+			name:  "DefaultLimit",
+			input: shop.SearchForShopInput{Term: "  Kona   AUTO "},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs("kona auto", int64(20), int64(0)).WillReturnRows(rows())
+			},
+			expectedNames: []string{"Kona Auto Repair", "Kona Tire"},
+			expectedTotal: 2,
+			expectedLimit: 20,
+		},
+		{
+			name:  "LimitCapped",
+			input: shop.SearchForShopInput{Term: "96740", Limit: 500, Offset: 50},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs("96740", int64(50), int64(50)).
+					WillReturnRows(pgxmock.NewRows(append(shopColumnNames, "count")))
+				db.ExpectQuery(countQuery).WithArgs("96740").
+					WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(2)))
+			},
+			expectedNames: []string{},
+			expectedTotal: 2,
+			expectedLimit: 50,
+		},
+		{
+			// nothing matched, so there's nothing to count
+			name:  "NoMatches",
+			input: shop.SearchForShopInput{Term: "hilo"},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs("hilo", int64(20), int64(0)).
+					WillReturnRows(pgxmock.NewRows(append(shopColumnNames, "count")))
+			},
+			expectedNames: []string{},
+			expectedLimit: 20,
+		},
+		{
+			name:  "CountError",
+			input: shop.SearchForShopInput{Term: "kona", Offset: 40},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs("kona", int64(20), int64(40)).
+					WillReturnRows(pgxmock.NewRows(append(shopColumnNames, "count")))
+				db.ExpectQuery(countQuery).WithArgs("kona").WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to count shops: fake db error"),
+		},
+		{
+			name:  "DbError",
+			input: shop.SearchForShopInput{Term: "kona"},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs("kona", int64(20), int64(0)).WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to query for shops: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			out, err := service.SearchForShop(context.TODO(), test.input)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			var names = []string{}
+			for _, s := range out.Shops {
+				names = append(names, s.Name)
+			}
+			require.Equal(t, test.expectedNames, names)
+			require.Equal(t, test.expectedTotal, out.Total)
+			require.Equal(t, test.expectedLimit, out.Limit)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package shop
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// userDataQueries remove the deleted user's jobs and the invitations they sent or accepted,
+// with the invitee emails on them, and unlink them from the employees they removed. $1 is the
+// user id.
+var userDataQueries = []string{
+	`DELETE FROM shop_invitations WHERE invited_by = $1 OR accepted_by = $1`,
+	`UPDATE employees SET removed_by = NULL, updated_at = NOW() WHERE removed_by = $1`,
+	`DELETE FROM employees WHERE user_id = $1`,
+}
+
+// DeleteUserData removes a deleted user's jobs at shops and the invitations they sent or
+// accepted. Shops they're the only owner of are handed to their longest serving employee, since
+// refusing would hold up every later deletion. A shop without employees left is kept ownerless.
+// It can be repeated safely.
+func (s *Service) DeleteUserData(ctx context.Context, userId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	transferQuery := `
+	UPDATE employees SET
+		"role" = $2,
+		updated_at = NOW()
+	WHERE id IN (
+		SELECT DISTINCT ON (e.shop_id)
+			e.id
+		FROM employees owner
+		JOIN employees e ON e.shop_id = owner.shop_id
+		WHERE
+			owner.user_id = $1 AND
+			owner."role" = $2 AND
+			owner.removed_at IS NULL AND
+			e.user_id <> $1 AND
+			e.removed_at IS NULL AND
+			NOT EXISTS (
+				SELECT 1
+				FROM employees other
+				WHERE
+					other.shop_id = owner.shop_id AND
+					other."role" = $2 AND
+					other.removed_at IS NULL AND
+					other.user_id <> $1
+			)
+		ORDER BY e.shop_id, e.created_at
+	)`
+
+	if _, err := tx.Exec(ctx, transferQuery, userId, RoleOwner); err != nil {
+		return fmt.Errorf("failed to transfer user's shops: %w", err)
+	}
+
+	for _, query := range userDataQueries {
+		if _, err := tx.Exec(ctx, query, userId); err != nil {
+			return fmt.Errorf("failed to delete user's shop data: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
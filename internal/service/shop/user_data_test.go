@@ -0,0 +1,84 @@
+package shop_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/keola-dunn/autolog/internal/service/shop"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteUserData(t *testing.T) {
+	transferQuery := `UPDATE employees SET "role" = $2, updated_at = NOW() WHERE id IN ( ` +
+		`SELECT DISTINCT ON (e.shop_id) e.id FROM employees owner JOIN employees e ON e.shop_id = owner.shop_id ` +
+		`WHERE owner.user_id = $1 AND owner."role" = $2 AND owner.removed_at IS NULL AND e.user_id <> $1 AND e.removed_at IS NULL AND ` +
+		`NOT EXISTS ( SELECT 1 FROM employees other WHERE other.shop_id = owner.shop_id AND other."role" = $2 AND ` +
+		`other.removed_at IS NULL AND other.user_id <> $1 ) ORDER BY e.shop_id, e.created_at )`
+	userDataQueries := []string{
+		"DELETE FROM shop_invitations WHERE invited_by = $1 OR accepted_by = $1",
+		"UPDATE employees SET removed_by = NULL, updated_at = NOW() WHERE removed_by = $1",
+		"DELETE FROM employees WHERE user_id = $1",
+	}
+
+	tests := []struct {
+		name   string
+		userId string
+
+		dbFunc      func(db pgxmock.PgxConnIface)
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			userId:      " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: shop.ErrInvalidArg,
+		},
+		{
+			// the user was a shop's only owner, an employee is promoted before the user's jobs
+			// are removed
+			name:   "LastOwner",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectExec(transferQuery).WithArgs(testUserId, shop.RoleOwner).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				for _, q := range userDataQueries {
+					db.ExpectExec(q).WithArgs(testUserId).
+						WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				}
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+		{
+			name:   "DbError",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectExec(transferQuery).WithArgs(testUserId, shop.RoleOwner).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				db.ExpectExec(userDataQueries[0]).WithArgs(testUserId).
+					WillReturnError(errors.New("fake db error"))
+				db.ExpectRollback()
+			},
+			expectedErr: errors.New("failed to delete user's shop data: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, db := newTestService(t)
+			test.dbFunc(db)
+
+			err := service.DeleteUserData(context.TODO(), test.userId)
+			if test.expectedErr != nil {
+				requireErr(t, test.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package signingkey
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+)
+
+// Algorithm is the JWS algorithm a key signs with
+type Algorithm string
+
+const (
+	AlgorithmRS256 = Algorithm("RS256")
+	AlgorithmES256 = Algorithm("ES256")
+	AlgorithmEdDSA = Algorithm("EdDSA")
+)
+
+// SupportedAlgorithms are the algorithms keys can be created with
+var SupportedAlgorithms = []Algorithm{AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA}
+
+// SigningMethod is the jwt signing method for the algorithm
+func (a Algorithm) SigningMethod() (jwt.SigningMethod, error) {
+	switch a {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmES256:
+		return jwt.SigningMethodES256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// KeyStatus is where a key is in its lifecycle
+type KeyStatus string
+
+const (
+	// KeyStatusNext keys are published but don't sign anything until they're activated
+	KeyStatusNext = KeyStatus("next")
+
+	// KeyStatusActive keys are published. The newest one signs tokens.
+	KeyStatusActive = KeyStatus("active")
+
+	// KeyStatusRetired keys are no longer published, tokens they signed no longer verify
+	KeyStatusRetired = KeyStatus("retired")
+)
+
+// Key is a signing key in the keyring
+type Key struct {
+	// Id is the key's kid
+	Id        string
+	Algorithm Algorithm
+
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+
+	CreatedAt   time.Time
+	ActivatedAt *time.Time
+	RetiredAt   *time.Time
+}
+
+// Status is the key's status at the given time
+func (k *Key) Status(now time.Time) KeyStatus {
+	switch {
+	case k.RetiredAt != nil && !k.RetiredAt.After(now):
+		return KeyStatusRetired
+	case k.ActivatedAt != nil && !k.ActivatedAt.After(now):
+		return KeyStatusActive
+	default:
+		return KeyStatusNext
+	}
+}
+
+// generateKey creates a new private key for the algorithm
+func generateKey(alg Algorithm) (crypto.Signer, error) {
+	switch alg {
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case AlgorithmES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// algorithmForKey is the algorithm a private key signs with
+func algorithmForKey(privateKey crypto.Signer) (Algorithm, error) {
+	signingMethod, err := autologjwt.SigningMethodForKey(privateKey)
+	if err != nil {
+		return "", ErrUnsupportedAlgorithm
+	}
+
+	return Algorithm(signingMethod.Alg()), nil
+}
+
+// parsePrivateKey parses a PKCS #8 private key
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key can't sign")
+	}
+
+	return signer, nil
+}
+
+// keyEncrypter encrypts private keys at rest with AES-256-GCM
+type keyEncrypter struct {
+	aead cipher.AEAD
+}
+
+func newKeyEncrypter(secret []byte) (*keyEncrypter, error) {
+	// the secret is configured as a string, so it's hashed into a key of the right length
+	key := sha256.Sum256(secret)
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+
+	return &keyEncrypter{
+		aead: aead,
+	}, nil
+}
+
+// encrypt returns the nonce followed by the ciphertext. The kid is authenticated with it, so
+// encrypted keys can't be swapped between rows.
+func (e *keyEncrypter) encrypt(kid string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	return e.aead.Seal(nonce, nonce, plaintext, []byte(kid)), nil
+}
+
+func (e *keyEncrypter) decrypt(kid string, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < e.aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	nonce, ciphertext := ciphertext[:e.aead.NonceSize()], ciphertext[e.aead.NonceSize():]
+
+	plaintext, err := e.aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,88 @@
+package signingkey
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Keyring is a snapshot of the signing keys at a point in time
+type Keyring struct {
+	// keys are ordered newest first
+	keys []Key
+	now  time.Time
+}
+
+// NewKeyring creates a keyring of the keys as they are at now
+func NewKeyring(keys []Key, now time.Time) *Keyring {
+	return &Keyring{
+		keys: keys,
+		now:  now,
+	}
+}
+
+// SigningKey is the newest active key. Returns ErrNoActiveKey if no key is active.
+func (k *Keyring) SigningKey() (Key, error) {
+	var signingKey *Key
+	for i := range k.keys {
+		if k.keys[i].Status(k.now) != KeyStatusActive {
+			continue
+		}
+		if signingKey == nil || k.keys[i].ActivatedAt.After(*signingKey.ActivatedAt) {
+			signingKey = &k.keys[i]
+		}
+	}
+
+	if signingKey == nil {
+		return Key{}, ErrNoActiveKey
+	}
+
+	return *signingKey, nil
+}
+
+// PublishedKeys are the keys verifiers should trust, every key that isn't retired
+func (k *Keyring) PublishedKeys() []Key {
+	keys := make([]Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		if key.Status(k.now) != KeyStatusRetired {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Keyfunc finds the published key a token was signed with by its kid, for jwt.Parse. Tokens
+// must be signed with the key's algorithm.
+func (k *Keyring) Keyfunc(token *jwt.Token) (any, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, fmt.Errorf("missing kid")
+	}
+
+	for _, key := range k.PublishedKeys() {
+		if key.Id != kid {
+			continue
+		}
+
+		if token.Method.Alg() != string(key.Algorithm) {
+			return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+		}
+
+		return key.PublicKey, nil
+	}
+
+	return nil, fmt.Errorf("unknown kid: %s", kid)
+}
+
+// nextKey is the newest next key, which the next rotation activates
+func (k *Keyring) nextKey() (Key, bool) {
+	for _, key := range k.keys {
+		if key.Status(k.now) == KeyStatusNext {
+			return key, true
+		}
+	}
+
+	return Key{}, false
+}
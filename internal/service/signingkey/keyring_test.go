@@ -0,0 +1,147 @@
+package signingkey_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/keola-dunn/autolog/internal/service/signingkey"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(t *testing.T, id string, alg signingkey.Algorithm, activatedAt, retiredAt *time.Time) signingkey.Key {
+	var privateKey crypto.Signer
+	var err error
+	switch alg {
+	case signingkey.AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case signingkey.AlgorithmES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case signingkey.AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	}
+	require.NoError(t, err)
+
+	return signingkey.Key{
+		Id:          id,
+		Algorithm:   alg,
+		PrivateKey:  privateKey,
+		PublicKey:   privateKey.Public(),
+		ActivatedAt: activatedAt,
+		RetiredAt:   retiredAt,
+	}
+}
+
+func sign(t *testing.T, key signingkey.Key, kid string) string {
+	signingMethod, err := key.Algorithm.SigningMethod()
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(signingMethod, jwt.RegisteredClaims{Subject: "user-1"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key.PrivateKey)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func TestKeyring(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	next := newKey(t, "next", signingkey.AlgorithmEdDSA, nil, nil)
+	active := newKey(t, "active", signingkey.AlgorithmES256, at(-time.Hour), nil)
+	superseded := newKey(t, "superseded", signingkey.AlgorithmRS256, at(-48*time.Hour), at(time.Hour))
+	retired := newKey(t, "retired", signingkey.AlgorithmRS256, at(-96*time.Hour), at(-time.Hour))
+
+	keyring := signingkey.NewKeyring([]signingkey.Key{next, active, superseded, retired}, now)
+
+	require.Equal(t, signingkey.KeyStatusNext, next.Status(now))
+	require.Equal(t, signingkey.KeyStatusActive, active.Status(now))
+	require.Equal(t, signingkey.KeyStatusActive, superseded.Status(now))
+	require.Equal(t, signingkey.KeyStatusRetired, retired.Status(now))
+
+	signingKey, err := keyring.SigningKey()
+	require.NoError(t, err)
+	require.Equal(t, "active", signingKey.Id)
+
+	var published []string
+	for _, key := range keyring.PublishedKeys() {
+		published = append(published, key.Id)
+	}
+	require.Equal(t, []string{"next", "active", "superseded"}, published)
+
+	tests := []struct {
+		name        string
+		token       string
+		expectedErr bool
+	}{
+		{
+			name:  "Active",
+			token: sign(t, active, "active"),
+		},
+		{
+			name:  "Superseded",
+			token: sign(t, superseded, "superseded"),
+		},
+		{
+			name:  "Next",
+			token: sign(t, next, "next"),
+		},
+		{
+			name:        "Retired",
+			token:       sign(t, retired, "retired"),
+			expectedErr: true,
+		},
+		{
+			name:        "UnknownKid",
+			token:       sign(t, active, "unknown"),
+			expectedErr: true,
+		},
+		{
+			name:        "MissingKid",
+			token:       sign(t, active, ""),
+			expectedErr: true,
+		},
+		{
+			name:        "WrongKey",
+			token:       sign(t, superseded, "active"),
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var claims jwt.RegisteredClaims
+			_, err := jwt.ParseWithClaims(test.token, &claims, keyring.Keyfunc)
+			if test.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "user-1", claims.Subject)
+		})
+	}
+}
+
+func TestKeyringNoActiveKey(t *testing.T) {
+	now := time.Now().UTC()
+
+	keyring := signingkey.NewKeyring([]signingkey.Key{
+		newKey(t, "next", signingkey.AlgorithmRS256, nil, nil),
+	}, now)
+
+	_, err := keyring.SigningKey()
+	require.ErrorIs(t, err, signingkey.ErrNoActiveKey)
+}
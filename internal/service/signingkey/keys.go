@@ -0,0 +1,393 @@
+package signingkey
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/random"
+)
+
+// queryer is a pgx.Tx or the connection pool
+type queryer interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// GetKeyring returns the keyring, reloading it from the database every refresh interval
+func (s *Service) GetKeyring(ctx context.Context) (*Keyring, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.calendarService.NowUTC()
+	if s.keys == nil || now.Sub(s.fetchedAt) >= s.refreshInterval {
+		keys, err := s.listKeys(ctx, s.db)
+		if err != nil {
+			return nil, err
+		}
+		s.keys = keys
+		s.fetchedAt = now
+	}
+
+	return NewKeyring(s.keys, now), nil
+}
+
+// ListKeys lists every key in the keyring, newest first
+func (s *Service) ListKeys(ctx context.Context) ([]Key, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	return s.listKeys(ctx, s.db)
+}
+
+func (s *Service) listKeys(ctx context.Context, q queryer) ([]Key, error) {
+	query := `
+	SELECT
+		sk.kid,
+		sk.algorithm,
+		sk.private_key,
+		sk.activated_at,
+		sk.retired_at,
+		sk.created_at
+	FROM signing_keys sk
+	ORDER BY sk.created_at DESC`
+
+	rows, err := q.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]Key, 0)
+	for rows.Next() {
+		var key Key
+		var algorithm string
+		var encryptedPrivateKey []byte
+		if err := rows.Scan(&key.Id, &algorithm, &encryptedPrivateKey, &key.ActivatedAt,
+			&key.RetiredAt, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan signing key: %w", err)
+		}
+		key.Algorithm = Algorithm(algorithm)
+
+		der, err := s.encrypter.decrypt(key.Id, encryptedPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt signing key %s: %w", key.Id, err)
+		}
+
+		key.PrivateKey, err = parsePrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key %s: %w", key.Id, err)
+		}
+		key.PublicKey = key.PrivateKey.Public()
+
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read signing keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// insertKey encrypts and stores the private key
+func (s *Service) insertKey(ctx context.Context, tx pgx.Tx, kid string, privateKey crypto.Signer,
+	activatedAt *time.Time) (Key, error) {
+	alg, err := algorithmForKey(privateKey)
+	if err != nil {
+		return Key{}, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	encryptedPrivateKey, err := s.encrypter.encrypt(kid, privateDER)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+
+	key := Key{
+		Id:          kid,
+		Algorithm:   alg,
+		PrivateKey:  privateKey,
+		PublicKey:   privateKey.Public(),
+		ActivatedAt: activatedAt,
+	}
+
+	query := `
+	INSERT INTO signing_keys (kid, algorithm, private_key, public_key, activated_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING created_at`
+
+	row := tx.QueryRow(ctx, query, kid, string(alg), encryptedPrivateKey, publicDER, activatedAt)
+	if err := row.Scan(&key.CreatedAt); err != nil {
+		return Key{}, fmt.Errorf("failed to insert signing key: %w", err)
+	}
+
+	return key, nil
+}
+
+// createKey generates and stores a key for the algorithm
+func (s *Service) createKey(ctx context.Context, tx pgx.Tx, alg Algorithm, activatedAt *time.Time) (Key, error) {
+	privateKey, err := generateKey(alg)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	kid, err := random.SecureToken(12)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to generate kid: %w", err)
+	}
+
+	return s.insertKey(ctx, tx, kid, privateKey, activatedAt)
+}
+
+// beginKeyringTx starts a transaction that has the keyring to itself, so concurrent rotations
+// and servers starting at once can't both activate keys
+func (s *Service) beginKeyringTx(ctx context.Context) (pgx.Tx, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `LOCK TABLE signing_keys IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf("failed to lock signing keys: %w", err)
+	}
+
+	return tx, nil
+}
+
+// commitKeyringTx commits and drops the cached keyring, so this process sees the change now
+func (s *Service) commitKeyringTx(ctx context.Context, tx pgx.Tx) error {
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.mu.Lock()
+	s.keys = nil
+	s.mu.Unlock()
+
+	return nil
+}
+
+type EnsureKeyringInput struct {
+	// ImportKey is activated instead of a new key when the keyring is empty, so tokens signed
+	// with the key the server used before the keyring keep verifying. Optional.
+	ImportKey   crypto.Signer
+	ImportKeyId string
+}
+
+// EnsureKeyring makes sure there is an active key to sign with and a next key to rotate to.
+// The first active key is activated right away, there are no tokens for verifiers to check yet.
+func (s *Service) EnsureKeyring(ctx context.Context, input EnsureKeyringInput) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if input.ImportKey != nil && strings.TrimSpace(input.ImportKeyId) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.beginKeyringTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	keys, err := s.listKeys(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	now := s.calendarService.NowUTC()
+	keyring := NewKeyring(keys, now)
+
+	if _, err := keyring.SigningKey(); errors.Is(err, ErrNoActiveKey) {
+		if len(keys) == 0 && input.ImportKey != nil {
+			if _, err := s.insertKey(ctx, tx, input.ImportKeyId, input.ImportKey, &now); err != nil {
+				return fmt.Errorf("failed to import key: %w", err)
+			}
+		} else {
+			if _, err := s.createKey(ctx, tx, s.algorithm, &now); err != nil {
+				return fmt.Errorf("failed to create active key: %w", err)
+			}
+		}
+	}
+
+	if _, ok := keyring.nextKey(); !ok {
+		if _, err := s.createKey(ctx, tx, s.algorithm, nil); err != nil {
+			return fmt.Errorf("failed to create next key: %w", err)
+		}
+	}
+
+	return s.commitKeyringTx(ctx, tx)
+}
+
+// CreateNextKey adds a next key for the algorithm, which the next rotation activates. Other next
+// keys are retired. Defaults to the configured algorithm.
+func (s *Service) CreateNextKey(ctx context.Context, alg Algorithm) (Key, error) {
+	if s.db == nil {
+		return Key{}, ErrMissingRequiredConfiguration
+	}
+
+	if alg == "" {
+		alg = s.algorithm
+	}
+	if _, err := alg.SigningMethod(); err != nil {
+		return Key{}, err
+	}
+
+	tx, err := s.beginKeyringTx(ctx)
+	if err != nil {
+		return Key{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	now := s.calendarService.NowUTC()
+
+	query := `
+	UPDATE signing_keys
+	SET retired_at = $1
+	WHERE activated_at IS NULL
+		AND retired_at IS NULL`
+
+	if _, err := tx.Exec(ctx, query, now); err != nil {
+		return Key{}, fmt.Errorf("failed to retire next keys: %w", err)
+	}
+
+	key, err := s.createKey(ctx, tx, alg, nil)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to create next key: %w", err)
+	}
+
+	if err := s.commitKeyringTx(ctx, tx); err != nil {
+		return Key{}, err
+	}
+
+	return key, nil
+}
+
+type RotateInput struct {
+	// Algorithm is the algorithm of the new next key. Defaults to the configured algorithm.
+	Algorithm Algorithm
+
+	// Force activates the next key even if verifiers may not have fetched it yet. Tokens it
+	// signs may fail to verify until they do. Only for replacing a compromised key.
+	Force bool
+}
+
+// Rotate activates the next key, and creates a new next key. The previous active keys are
+// retired once the tokens they signed have expired. Returns the newly active key.
+func (s *Service) Rotate(ctx context.Context, input RotateInput) (Key, error) {
+	if s.db == nil {
+		return Key{}, ErrMissingRequiredConfiguration
+	}
+
+	if input.Algorithm == "" {
+		input.Algorithm = s.algorithm
+	}
+	if _, err := input.Algorithm.SigningMethod(); err != nil {
+		return Key{}, err
+	}
+
+	tx, err := s.beginKeyringTx(ctx)
+	if err != nil {
+		return Key{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	keys, err := s.listKeys(ctx, tx)
+	if err != nil {
+		return Key{}, err
+	}
+
+	now := s.calendarService.NowUTC()
+
+	nextKey, ok := NewKeyring(keys, now).nextKey()
+	if !ok {
+		return Key{}, ErrNoNextKey
+	}
+	if !input.Force && now.Sub(nextKey.CreatedAt) < s.publishLength {
+		return Key{}, ErrNextKeyNotPublished
+	}
+
+	retireQuery := `
+	UPDATE signing_keys
+	SET retired_at = $1
+	WHERE activated_at IS NOT NULL
+		AND retired_at IS NULL`
+
+	if _, err := tx.Exec(ctx, retireQuery, now.Add(s.retireAfter)); err != nil {
+		return Key{}, fmt.Errorf("failed to retire active keys: %w", err)
+	}
+
+	activateQuery := `
+	UPDATE signing_keys
+	SET activated_at = $1
+	WHERE kid = $2`
+
+	if _, err := tx.Exec(ctx, activateQuery, now, nextKey.Id); err != nil {
+		return Key{}, fmt.Errorf("failed to activate next key: %w", err)
+	}
+	nextKey.ActivatedAt = &now
+
+	if _, err := s.createKey(ctx, tx, input.Algorithm, nil); err != nil {
+		return Key{}, fmt.Errorf("failed to create next key: %w", err)
+	}
+
+	if err := s.commitKeyringTx(ctx, tx); err != nil {
+		return Key{}, err
+	}
+
+	return nextKey, nil
+}
+
+// RetireKey retires a key now. Tokens it signed stop verifying once verifiers refresh their
+// keys. Meant for compromised keys, rotate first so there's another key to sign with.
+func (s *Service) RetireKey(ctx context.Context, kid string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(kid) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.beginKeyringTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	UPDATE signing_keys
+	SET retired_at = $1
+	WHERE kid = $2
+		AND (retired_at IS NULL OR retired_at > $1)`
+
+	tag, err := tx.Exec(ctx, query, s.calendarService.NowUTC(), kid)
+	if err != nil {
+		return fmt.Errorf("failed to retire signing key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return s.commitKeyringTx(ctx, tx)
+}
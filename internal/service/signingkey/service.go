@@ -0,0 +1,128 @@
+package signingkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/calendar"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("signing key service is missing required configurations to perform this operation")
+
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	ErrNotFound = errors.New("the requested resource was not found")
+
+	// ErrUnsupportedAlgorithm is returned for algorithms other than RS256, ES256 and EdDSA
+	ErrUnsupportedAlgorithm = errors.New("the signing algorithm is not supported")
+
+	// ErrNoActiveKey is returned when the keyring has no key to sign with
+	ErrNoActiveKey = errors.New("there is no active signing key")
+
+	// ErrNoNextKey is returned when rotating without a next key to activate
+	ErrNoNextKey = errors.New("there is no next signing key to activate")
+
+	// ErrNextKeyNotPublished is returned when rotating to a next key that hasn't been published
+	// long enough for verifiers to have fetched it
+	ErrNextKeyNotPublished = errors.New("the next signing key hasn't been published long enough")
+)
+
+type ServiceConfig struct {
+	// DB is the Database used for the signing key service
+	DB postgres.ConnectionPool
+
+	CalendarService calendar.ServiceIface
+
+	// EncryptionSecret encrypts private keys at rest. Must be at least 32 bytes.
+	EncryptionSecret []byte
+
+	// Algorithm is the algorithm new keys are created with. Defaults to RS256.
+	Algorithm Algorithm
+
+	// RetireAfter is how long keys stay published after they're superseded. Must be longer
+	// than tokens live. Defaults to 24 hours.
+	RetireAfter time.Duration
+
+	// PublishLength is how long next keys must be published before they're activated, so
+	// verifiers have fetched them. Defaults to 1 hour, how often keyfunc refreshes a JWKS.
+	PublishLength time.Duration
+
+	// RefreshInterval is how often the keyring is reloaded, so rotations by other processes
+	// are picked up. Defaults to 1 minute.
+	RefreshInterval time.Duration
+}
+
+type ServiceIface interface {
+	GetKeyring(ctx context.Context) (*Keyring, error)
+	ListKeys(ctx context.Context) ([]Key, error)
+
+	EnsureKeyring(ctx context.Context, input EnsureKeyringInput) error
+	CreateNextKey(ctx context.Context, alg Algorithm) (Key, error)
+	Rotate(ctx context.Context, input RotateInput) (Key, error)
+	RetireKey(ctx context.Context, kid string) error
+}
+
+// Service manages the keyring the auth server signs tokens with
+type Service struct {
+	db              postgres.ConnectionPool
+	calendarService calendar.ServiceIface
+	encrypter       *keyEncrypter
+
+	algorithm       Algorithm
+	retireAfter     time.Duration
+	publishLength   time.Duration
+	refreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      []Key
+	fetchedAt time.Time
+}
+
+func NewService(cfg ServiceConfig) (*Service, error) {
+	if len(cfg.EncryptionSecret) < 32 {
+		return nil, fmt.Errorf("encryption secret must be at least 32 bytes")
+	}
+
+	if cfg.CalendarService == nil {
+		cfg.CalendarService = calendar.NewService()
+	}
+
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = AlgorithmRS256
+	}
+	if _, err := cfg.Algorithm.SigningMethod(); err != nil {
+		return nil, err
+	}
+
+	if cfg.RetireAfter <= 0 {
+		cfg.RetireAfter = 24 * time.Hour
+	}
+
+	if cfg.PublishLength <= 0 {
+		cfg.PublishLength = time.Hour
+	}
+
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Minute
+	}
+
+	encrypter, err := newKeyEncrypter(cfg.EncryptionSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key encrypter: %w", err)
+	}
+
+	return &Service{
+		db:              cfg.DB,
+		calendarService: cfg.CalendarService,
+		encrypter:       encrypter,
+		algorithm:       cfg.Algorithm,
+		retireAfter:     cfg.RetireAfter,
+		publishLength:   cfg.PublishLength,
+		refreshInterval: cfg.RefreshInterval,
+	}, nil
+}
@@ -0,0 +1,14 @@
+package token
+
+import (
+	"github.com/keola-dunn/autolog/internal/random"
+)
+
+// opaqueTokenBytes is the amount of randomness in an opaque token. 32 bytes is too large to
+// guess, so tokens can be stored with a fast hash rather than a password hash.
+const opaqueTokenBytes = 32
+
+// newOpaqueToken generates a random, URL safe token
+func newOpaqueToken() (string, error) {
+	return random.SecureToken(opaqueTokenBytes)
+}
@@ -0,0 +1,237 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+	autologjwt "github.com/keola-dunn/autolog/internal/jwt"
+)
+
+// lastUsedResolution is how often a personal access token's last use is recorded. Scripts can
+// use a token many times a minute, there's no need to write each use.
+const lastUsedResolution = time.Minute
+
+// PersonalAccessToken is a long lived, opaque token a user creates for scripts and
+// integrations. It is limited to its scopes.
+type PersonalAccessToken struct {
+	Id string
+
+	// Token is the plain text token. It is only available when the token is created.
+	Token string
+
+	UserId string
+	Name   string
+	Scopes []string
+
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+type CreatePersonalAccessTokenInput struct {
+	UserId string
+	Name   string
+
+	// Scopes are the permissions the token grants. The caller checks the user holds them.
+	Scopes []string
+
+	ExpiresAt time.Time
+}
+
+// CreatePersonalAccessToken issues a personal access token for the user
+func (s *Service) CreatePersonalAccessToken(ctx context.Context, input CreatePersonalAccessTokenInput) (PersonalAccessToken, error) {
+	if s.db == nil {
+		return PersonalAccessToken{}, ErrMissingRequiredConfiguration
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if strings.TrimSpace(input.UserId) == "" || name == "" || len(name) > 128 ||
+		!input.ExpiresAt.After(s.calendarService.NowUTC()) {
+		return PersonalAccessToken{}, ErrInvalidArg
+	}
+
+	var scopes []string
+	for _, scope := range input.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\n") {
+			return PersonalAccessToken{}, ErrInvalidArg
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return PersonalAccessToken{}, ErrInvalidArg
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return PersonalAccessToken{}, fmt.Errorf("failed to generate personal access token: %w", err)
+	}
+
+	pat := PersonalAccessToken{
+		// the prefix lets verifiers, and secret scanners, tell the token apart from JWTs
+		Token:     autologjwt.PersonalAccessTokenPrefix + token,
+		UserId:    strings.TrimSpace(input.UserId),
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresAt: input.ExpiresAt,
+	}
+
+	query := `
+	INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	row := s.db.QueryRow(ctx, query, pat.UserId, pat.Name, hashutil.SHA256Hex(pat.Token), pat.Scopes, pat.ExpiresAt)
+	if err := row.Scan(&pat.Id, &pat.CreatedAt); err != nil {
+		return PersonalAccessToken{}, fmt.Errorf("failed to insert personal access token: %w", err)
+	}
+
+	return pat, nil
+}
+
+// GetPersonalAccessToken looks up an active personal access token and records that it was used.
+// Returns ErrInvalidToken if the token is unknown or revoked, and ErrTokenExpired if it has
+// expired. The plain text token is not returned.
+func (s *Service) GetPersonalAccessToken(ctx context.Context, token string) (PersonalAccessToken, error) {
+	if s.db == nil {
+		return PersonalAccessToken{}, ErrMissingRequiredConfiguration
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(token), autologjwt.PersonalAccessTokenPrefix) {
+		return PersonalAccessToken{}, ErrInvalidArg
+	}
+
+	query := `
+	SELECT
+		pat.id,
+		pat.user_id,
+		pat.name,
+		pat.scopes,
+		pat.expires_at,
+		pat.last_used_at,
+		pat.created_at,
+		pat.revoked_at
+	FROM personal_access_tokens pat
+	WHERE pat.token_hash = $1`
+
+	var pat PersonalAccessToken
+	var revokedAt *time.Time
+	row := s.db.QueryRow(ctx, query, hashutil.SHA256Hex(strings.TrimSpace(token)))
+	if err := row.Scan(&pat.Id, &pat.UserId, &pat.Name, &pat.Scopes, &pat.ExpiresAt, &pat.LastUsedAt,
+		&pat.CreatedAt, &revokedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PersonalAccessToken{}, ErrInvalidToken
+		}
+		return PersonalAccessToken{}, fmt.Errorf("failed to query for personal access token: %w", err)
+	}
+
+	if revokedAt != nil {
+		return PersonalAccessToken{}, ErrInvalidToken
+	}
+
+	now := s.calendarService.NowUTC()
+	if !now.Before(pat.ExpiresAt) {
+		return PersonalAccessToken{}, ErrTokenExpired
+	}
+
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) >= lastUsedResolution {
+		usedQuery := `
+		UPDATE personal_access_tokens SET
+			last_used_at = $2,
+			updated_at = NOW()
+		WHERE id = $1`
+
+		if _, err := s.db.Exec(ctx, usedQuery, pat.Id, now); err != nil {
+			return PersonalAccessToken{}, fmt.Errorf("failed to record personal access token use: %w", err)
+		}
+		pat.LastUsedAt = &now
+	}
+
+	return pat, nil
+}
+
+// ListPersonalAccessTokens lists the user's personal access tokens that haven't been revoked,
+// newest first. Expired tokens are included so users can see what stopped working.
+func (s *Service) ListPersonalAccessTokens(ctx context.Context, userId string) ([]PersonalAccessToken, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	query := `
+	SELECT
+		pat.id,
+		pat.user_id,
+		pat.name,
+		pat.scopes,
+		pat.expires_at,
+		pat.last_used_at,
+		pat.created_at
+	FROM personal_access_tokens pat
+	WHERE
+		pat.user_id = $1 AND
+		pat.revoked_at IS NULL
+	ORDER BY pat.created_at DESC`
+
+	rows, err := s.db.Query(ctx, query, strings.TrimSpace(userId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for personal access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	pats := make([]PersonalAccessToken, 0)
+	for rows.Next() {
+		var pat PersonalAccessToken
+		if err := rows.Scan(&pat.Id, &pat.UserId, &pat.Name, &pat.Scopes, &pat.ExpiresAt,
+			&pat.LastUsedAt, &pat.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan personal access token: %w", err)
+		}
+		pats = append(pats, pat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read personal access tokens: %w", err)
+	}
+
+	return pats, nil
+}
+
+// RevokePersonalAccessToken revokes one of the user's personal access tokens. Returns
+// ErrInvalidToken if the user has no such token, or it's already revoked.
+func (s *Service) RevokePersonalAccessToken(ctx context.Context, userId, id string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(id) == "" {
+		return ErrInvalidArg
+	}
+
+	query := `
+	UPDATE personal_access_tokens SET
+		revoked_at = NOW(),
+		updated_at = NOW()
+	WHERE
+		id::text = $1 AND
+		user_id = $2 AND
+		revoked_at IS NULL`
+
+	tag, err := s.db.Exec(ctx, query, strings.TrimSpace(id), strings.TrimSpace(userId))
+	if err != nil {
+		return fmt.Errorf("failed to revoke personal access token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package token_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/service/token"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPersonalAccessToken(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testTokenId := "3c8c5a8e-2b1f-4f0e-9f0a-6a1b2c3d4e5f"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	selectQuery := `
+	SELECT
+		pat.id,
+		pat.user_id,
+		pat.name,
+		pat.scopes,
+		pat.expires_at,
+		pat.last_used_at,
+		pat.created_at,
+		pat.revoked_at
+	FROM personal_access_tokens pat
+	WHERE pat.token_hash = $1`
+
+	usedQuery := `
+		UPDATE personal_access_tokens SET
+			last_used_at = $2,
+			updated_at = NOW()
+		WHERE id = $1`
+
+	selectColumns := []string{"id", "user_id", "name", "scopes", "expires_at", "last_used_at", "created_at", "revoked_at"}
+	scopes := []string{"cars:read", "service_logs:write"}
+
+	tests := []struct {
+		name   string
+		token  string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "NotPersonalAccessToken",
+			token:       "refresh-token",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: token.ErrInvalidArg,
+		},
+		{
+			name:  "NotFound",
+			token: "alpat_unknown",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(selectQuery).WithArgs(hash("alpat_unknown")).
+					WillReturnRows(pgxmock.NewRows(selectColumns))
+			},
+			expectedErr: token.ErrInvalidToken,
+		},
+		{
+			name:  "Revoked",
+			token: "alpat_revoked",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				revokedAt := now.Add(-time.Hour)
+				db.ExpectQuery(selectQuery).WithArgs(hash("alpat_revoked")).
+					WillReturnRows(pgxmock.NewRows(selectColumns).
+						AddRow(testTokenId, testUserId, "obd logger", scopes, now.Add(time.Hour), nil, now.Add(-48*time.Hour), &revokedAt))
+			},
+			expectedErr: token.ErrInvalidToken,
+		},
+		{
+			name:  "Expired",
+			token: "alpat_expired",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(selectQuery).WithArgs(hash("alpat_expired")).
+					WillReturnRows(pgxmock.NewRows(selectColumns).
+						AddRow(testTokenId, testUserId, "obd logger", scopes, now, nil, now.Add(-48*time.Hour), nil))
+			},
+			expectedErr: token.ErrTokenExpired,
+		},
+		{
+			name:  "RecentlyUsed",
+			token: "alpat_valid",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				lastUsedAt := now.Add(-10 * time.Second)
+				db.ExpectQuery(selectQuery).WithArgs(hash("alpat_valid")).
+					WillReturnRows(pgxmock.NewRows(selectColumns).
+						AddRow(testTokenId, testUserId, "obd logger", scopes, now.Add(time.Hour), &lastUsedAt, now.Add(-48*time.Hour), nil))
+			},
+			expectedErr: nil,
+		},
+		{
+			name:  "Success",
+			token: "alpat_valid",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(selectQuery).WithArgs(hash("alpat_valid")).
+					WillReturnRows(pgxmock.NewRows(selectColumns).
+						AddRow(testTokenId, testUserId, "obd logger", scopes, now.Add(time.Hour), nil, now.Add(-48*time.Hour), nil))
+				db.ExpectExec(usedQuery).WithArgs(testTokenId, now).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+			expectedErr: nil,
+		},
+		{
+			name:  "DbError",
+			token: "alpat_valid",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(selectQuery).WithArgs(hash("alpat_valid")).
+					WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to query for personal access token: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := token.NewService(token.ServiceConfig{
+				DB:              db,
+				CalendarService: &fakeCalendarService{now: now},
+			})
+
+			pat, err := service.GetPersonalAccessToken(context.Background(), test.token)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				require.Equal(t, test.expectedErr.Error(), err.Error())
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testUserId, pat.UserId)
+			require.Equal(t, scopes, pat.Scopes)
+			require.NotNil(t, pat.LastUsedAt)
+			require.Empty(t, pat.Token)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
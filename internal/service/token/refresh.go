@@ -0,0 +1,297 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+)
+
+// RefreshToken is an opaque, long lived token that can be exchanged for a new access JWT.
+// Refresh tokens are single use: each refresh returns a new token in the same family, and
+// presenting a used token again revokes the whole family.
+type RefreshToken struct {
+	id string
+
+	// Token is the plain text token. It is only available when the token is issued.
+	Token string
+
+	UserId string
+
+	// FamilyId groups every token rotated from the same login
+	FamilyId string
+
+	// ClientId is the OAuth client the token was issued to, empty for the auth server's own
+	// logins. Only that client can rotate the token.
+	ClientId string
+
+	// Scope is the space separated scopes the client was granted
+	Scope string
+
+	ExpiresAt time.Time
+}
+
+func (r *RefreshToken) Id() string {
+	return r.id
+}
+
+// CreateRefreshToken issues a refresh token for the user, starting a new token family
+func (s *Service) CreateRefreshToken(ctx context.Context, userId string) (RefreshToken, error) {
+	if s.db == nil {
+		return RefreshToken{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return RefreshToken{}, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	refreshToken, err := s.createRefreshTokenRecord(ctx, tx, RefreshToken{
+		UserId: strings.TrimSpace(userId),
+	})
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to create refresh token record: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+// CreateClientRefreshToken issues a refresh token to an OAuth client for the user, starting a
+// new token family. The token keeps the scopes the client was granted through rotations.
+func (s *Service) CreateClientRefreshToken(ctx context.Context, userId, clientId, scope string) (RefreshToken, error) {
+	if s.db == nil {
+		return RefreshToken{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(clientId) == "" {
+		return RefreshToken{}, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	refreshToken, err := s.createRefreshTokenRecord(ctx, tx, RefreshToken{
+		UserId:   strings.TrimSpace(userId),
+		ClientId: clientId,
+		Scope:    scope,
+	})
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to create refresh token record: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same family. Returns
+// ErrInvalidToken if the token is unknown or revoked, ErrTokenExpired if it has expired and
+// ErrTokenReused if it was already rotated, in which case the family is revoked. clientId is the
+// OAuth client presenting the token, empty for the auth server's own logins, and must be the
+// client the token was issued to.
+func (s *Service) RotateRefreshToken(ctx context.Context, token, clientId string) (RefreshToken, error) {
+	if s.db == nil {
+		return RefreshToken{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(token) == "" {
+		return RefreshToken{}, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the token so concurrent refreshes can't both rotate it
+	query := `
+	SELECT 
+		rt.id,
+		rt.family_id,
+		rt.user_id,
+		COALESCE(rt.client_id, ''),
+		COALESCE(rt.scope, ''),
+		rt.expires_at,
+		rt.used_at,
+		rt.revoked_at
+	FROM refresh_tokens rt
+	WHERE rt.token_hash = $1
+	FOR UPDATE`
+
+	var current RefreshToken
+	var usedAt, revokedAt *time.Time
+	row := tx.QueryRow(ctx, query, hashutil.SHA256Hex(strings.TrimSpace(token)))
+	if err := row.Scan(&current.id, &current.FamilyId, &current.UserId, &current.ClientId,
+		&current.Scope, &current.ExpiresAt, &usedAt, &revokedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return RefreshToken{}, ErrInvalidToken
+		}
+		return RefreshToken{}, fmt.Errorf("failed to query for refresh token: %w", err)
+	}
+
+	// another client presenting the token isn't its holder rotating it, so it's just invalid
+	if revokedAt != nil || current.ClientId != clientId {
+		return RefreshToken{}, ErrInvalidToken
+	}
+
+	if usedAt != nil {
+		if err := revokeRefreshTokenFamily(ctx, tx, current.FamilyId); err != nil {
+			return RefreshToken{}, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return RefreshToken{}, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		return RefreshToken{}, ErrTokenReused
+	}
+
+	if !s.calendarService.NowUTC().Before(current.ExpiresAt) {
+		return RefreshToken{}, ErrTokenExpired
+	}
+
+	usedQuery := `
+	UPDATE refresh_tokens SET
+		used_at = NOW(),
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, usedQuery, current.id); err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+
+	refreshToken, err := s.createRefreshTokenRecord(ctx, tx, current)
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to create refresh token record: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+// createRefreshTokenRecord generates and stores a new refresh token rotated from the parent, for
+// the same user, client and scope. A parent that isn't stored yet starts a new family.
+func (s *Service) createRefreshTokenRecord(ctx context.Context, tx pgx.Tx, parent RefreshToken) (RefreshToken, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	refreshToken := RefreshToken{
+		Token:     token,
+		UserId:    parent.UserId,
+		ClientId:  parent.ClientId,
+		Scope:     parent.Scope,
+		ExpiresAt: s.calendarService.NowUTC().Add(s.refreshTokenExpiryLength),
+	}
+
+	var familyIdArg, parentIdArg, clientIdArg, scopeArg *string
+	if parent.FamilyId != "" {
+		familyIdArg = &parent.FamilyId
+	}
+	if parent.id != "" {
+		parentIdArg = &parent.id
+	}
+	if parent.ClientId != "" {
+		clientIdArg = &parent.ClientId
+		scopeArg = &parent.Scope
+	}
+
+	query := `
+	INSERT INTO refresh_tokens (family_id, parent_id, user_id, client_id, scope, token_hash, expires_at)
+	VALUES (COALESCE($1, gen_random_uuid()), $2, $3, $4, $5, $6, $7)
+	RETURNING id, family_id`
+
+	row := tx.QueryRow(ctx, query, familyIdArg, parentIdArg, parent.UserId, clientIdArg, scopeArg,
+		hashutil.SHA256Hex(token), refreshToken.ExpiresAt)
+	if err := row.Scan(&refreshToken.id, &refreshToken.FamilyId); err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+func revokeRefreshTokenFamily(ctx context.Context, tx pgx.Tx, familyId string) error {
+	query := `
+	UPDATE refresh_tokens SET
+		revoked_at = NOW(),
+		updated_at = NOW()
+	WHERE 
+		family_id = $1 AND 
+		revoked_at IS NULL`
+
+	if _, err := tx.Exec(ctx, query, familyId); err != nil {
+		return fmt.Errorf("failed to update refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// GetRefreshToken looks up an active refresh token. Returns ErrInvalidToken if the token is
+// unknown, used or revoked, and ErrTokenExpired if it has expired. The plain text token is not
+// returned.
+func (s *Service) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	if s.db == nil {
+		return RefreshToken{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(token) == "" {
+		return RefreshToken{}, ErrInvalidArg
+	}
+
+	query := `
+	SELECT 
+		rt.id,
+		rt.family_id,
+		rt.user_id,
+		COALESCE(rt.client_id, ''),
+		COALESCE(rt.scope, ''),
+		rt.expires_at,
+		rt.used_at,
+		rt.revoked_at
+	FROM refresh_tokens rt
+	WHERE rt.token_hash = $1`
+
+	var refreshToken RefreshToken
+	var usedAt, revokedAt *time.Time
+	row := s.db.QueryRow(ctx, query, hashutil.SHA256Hex(strings.TrimSpace(token)))
+	if err := row.Scan(&refreshToken.id, &refreshToken.FamilyId, &refreshToken.UserId,
+		&refreshToken.ClientId, &refreshToken.Scope, &refreshToken.ExpiresAt, &usedAt, &revokedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return RefreshToken{}, ErrInvalidToken
+		}
+		return RefreshToken{}, fmt.Errorf("failed to query for refresh token: %w", err)
+	}
+
+	if usedAt != nil || revokedAt != nil {
+		return RefreshToken{}, ErrInvalidToken
+	}
+
+	if !s.calendarService.NowUTC().Before(refreshToken.ExpiresAt) {
+		return RefreshToken{}, ErrTokenExpired
+	}
+
+	return refreshToken, nil
+}
@@ -0,0 +1,206 @@
+package token_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/service/token"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCalendarService struct {
+	now time.Time
+}
+
+func (f *fakeCalendarService) NowUTC() time.Time {
+	return f.now
+}
+
+func (f *fakeCalendarService) Now() time.Time {
+	return f.now
+}
+
+func hash(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testTokenId := "7f1d4b1e-6a8b-4f54-9a51-53f1d6c52f4e"
+	testFamilyId := "5b0b7c1a-8a4e-4f0d-8c55-0b5f3c2f3c11"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	selectQuery := `
+	SELECT 
+		rt.id,
+		rt.family_id,
+		rt.user_id,
+		COALESCE(rt.client_id, ''),
+		COALESCE(rt.scope, ''),
+		rt.expires_at,
+		rt.used_at,
+		rt.revoked_at
+	FROM refresh_tokens rt
+	WHERE rt.token_hash = $1
+	FOR UPDATE`
+
+	selectColumns := []string{"id", "family_id", "user_id", "client_id", "scope", "expires_at", "used_at", "revoked_at"}
+
+	tests := []struct {
+		name   string
+		token  string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			token:       " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: token.ErrInvalidArg,
+		},
+		{
+			name:  "NotFound",
+			token: "unknown",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(hash("unknown")).
+					WillReturnRows(pgxmock.NewRows(selectColumns))
+				db.ExpectRollback()
+			},
+			expectedErr: token.ErrInvalidToken,
+		},
+		{
+			name:  "Revoked",
+			token: "revoked",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				revokedAt := now.Add(-time.Hour)
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(hash("revoked")).
+					WillReturnRows(pgxmock.NewRows(selectColumns).
+						AddRow(testTokenId, testFamilyId, testUserId, "", "", now.Add(time.Hour), nil, &revokedAt))
+				db.ExpectRollback()
+			},
+			expectedErr: token.ErrInvalidToken,
+		},
+		{
+			name:  "IssuedToClient",
+			token: "client",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(hash("client")).
+					WillReturnRows(pgxmock.NewRows(selectColumns).
+						AddRow(testTokenId, testFamilyId, testUserId, "third-party", "openid", now.Add(time.Hour), nil, nil))
+				db.ExpectRollback()
+			},
+			expectedErr: token.ErrInvalidToken,
+		},
+		{
+			name:  "Expired",
+			token: "expired",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(hash("expired")).
+					WillReturnRows(pgxmock.NewRows(selectColumns).
+						AddRow(testTokenId, testFamilyId, testUserId, "", "", now.Add(-time.Second), nil, nil))
+				db.ExpectRollback()
+			},
+			expectedErr: token.ErrTokenExpired,
+		},
+		{
+			name:  "Reused",
+			token: "reused",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				usedAt := now.Add(-time.Minute)
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(hash("reused")).
+					WillReturnRows(pgxmock.NewRows(selectColumns).
+						AddRow(testTokenId, testFamilyId, testUserId, "", "", now.Add(time.Hour), &usedAt, nil))
+				db.ExpectExec(`
+				UPDATE refresh_tokens SET
+					revoked_at = NOW(),
+					updated_at = NOW()
+				WHERE 
+					family_id = $1 AND 
+					revoked_at IS NULL`).WithArgs(testFamilyId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 3))
+				db.ExpectCommit()
+			},
+			expectedErr: token.ErrTokenReused,
+		},
+		{
+			name:  "Success",
+			token: "valid",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(hash("valid")).
+					WillReturnRows(pgxmock.NewRows(selectColumns).
+						AddRow(testTokenId, testFamilyId, testUserId, "", "", now.Add(time.Hour), nil, nil))
+				db.ExpectExec(`
+				UPDATE refresh_tokens SET
+					used_at = NOW(),
+					updated_at = NOW()
+				WHERE id = $1`).WithArgs(testTokenId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectQuery(`
+				INSERT INTO refresh_tokens (family_id, parent_id, user_id, client_id, scope, token_hash, expires_at)
+				VALUES (COALESCE($1, gen_random_uuid()), $2, $3, $4, $5, $6, $7)
+				RETURNING id, family_id`).
+					WithArgs(&testFamilyId, &testTokenId, testUserId, (*string)(nil), (*string)(nil), pgxmock.AnyArg(), now.Add(time.Hour)).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "family_id"}).
+						AddRow("0d4f6f0b-7a57-4d0e-bb3c-4f2f8f2b7d4a", testFamilyId))
+				db.ExpectCommit()
+			},
+			expectedErr: nil,
+		},
+		{
+			name:  "DbError",
+			token: "valid",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(hash("valid")).
+					WillReturnError(errors.New("fake db error"))
+				db.ExpectRollback()
+			},
+			expectedErr: errors.New("failed to query for refresh token: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := token.NewService(token.ServiceConfig{
+				DB:                       db,
+				CalendarService:          &fakeCalendarService{now: now},
+				RefreshTokenExpiryLength: time.Hour,
+			})
+
+			refreshToken, err := service.RotateRefreshToken(context.Background(), test.token, "")
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				require.Equal(t, test.expectedErr.Error(), err.Error())
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotEmpty(t, refreshToken.Token)
+			require.NotEqual(t, test.token, refreshToken.Token)
+			require.Equal(t, testFamilyId, refreshToken.FamilyId)
+			require.Equal(t, testUserId, refreshToken.UserId)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
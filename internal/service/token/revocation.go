@@ -0,0 +1,262 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+)
+
+type RevokeAccessTokenInput struct {
+	// Id is the jti of the access JWT
+	Id string
+
+	UserId string
+
+	// ExpiresAt is when the token expires. The token only needs to be denied until then.
+	ExpiresAt time.Time
+
+	Reason string
+}
+
+// RevokeAccessToken adds the access token's jti to the denylist. Revoking a token that is
+// already revoked is not an error.
+func (s *Service) RevokeAccessToken(ctx context.Context, input RevokeAccessTokenInput) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.Id) == "" || input.ExpiresAt.IsZero() {
+		return ErrInvalidArg
+	}
+
+	var userId *string
+	if strings.TrimSpace(input.UserId) != "" {
+		u := strings.TrimSpace(input.UserId)
+		userId = &u
+	}
+
+	query := `
+	INSERT INTO revoked_tokens (jti, user_id, expires_at, reason)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (jti) DO NOTHING`
+
+	if _, err := s.db.Exec(ctx, query, strings.TrimSpace(input.Id), userId, input.ExpiresAt,
+		strings.TrimSpace(input.Reason)); err != nil {
+		return fmt.Errorf("failed to insert revoked token: %w", err)
+	}
+
+	return nil
+}
+
+// IsAccessTokenRevoked checks if the access token has been revoked, either directly by its jti
+// or by a revocation of the user's tokens made at or after issuedAt.
+func (s *Service) IsAccessTokenRevoked(ctx context.Context, id, userId string, issuedAt time.Time) (bool, error) {
+	if s.db == nil {
+		return false, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(id) == "" {
+		return false, ErrInvalidArg
+	}
+
+	query := `
+	SELECT 
+		EXISTS (SELECT 1 FROM revoked_tokens rt WHERE rt.jti = $1) OR
+		EXISTS (
+			SELECT 1 
+			FROM user_token_revocations utr 
+			WHERE 
+				utr.user_id::text = $2 AND 
+				utr.issued_before >= $3
+		)`
+
+	var revoked bool
+	row := s.db.QueryRow(ctx, query, strings.TrimSpace(id), strings.TrimSpace(userId), issuedAt)
+	if err := row.Scan(&revoked); err != nil {
+		return false, fmt.Errorf("failed to query for revoked token: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// RevokeRefreshToken revokes the refresh token along with the rest of its family. Unknown
+// tokens are ignored.
+func (s *Service) RevokeRefreshToken(ctx context.Context, token string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(token) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT 
+		rt.family_id
+	FROM refresh_tokens rt
+	WHERE rt.token_hash = $1`
+
+	var familyId string
+	row := tx.QueryRow(ctx, query, hashutil.SHA256Hex(strings.TrimSpace(token)))
+	if err := row.Scan(&familyId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to query for refresh token: %w", err)
+	}
+
+	if err := revokeRefreshTokenFamily(ctx, tx, familyId); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens revokes every access and refresh token issued to the user so far, ex. on a
+// password change. Tokens issued afterwards, even within the same second, are unaffected.
+func (s *Service) RevokeUserTokens(ctx context.Context, userId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the cut off is the instant of the revocation, at the millisecond precision of jwt
+	// timestamps. Tokens issued at or before it are revoked.
+	issuedBefore := s.calendarService.NowUTC().Truncate(time.Millisecond)
+
+	userQuery := `
+	INSERT INTO user_token_revocations (user_id, issued_before)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET
+		issued_before = EXCLUDED.issued_before,
+		updated_at = NOW()`
+
+	if _, err := tx.Exec(ctx, userQuery, strings.TrimSpace(userId), issuedBefore); err != nil {
+		return fmt.Errorf("failed to upsert user token revocation: %w", err)
+	}
+
+	refreshQuery := `
+	UPDATE refresh_tokens SET
+		revoked_at = NOW(),
+		updated_at = NOW()
+	WHERE 
+		user_id = $1 AND 
+		revoked_at IS NULL`
+
+	if _, err := tx.Exec(ctx, refreshQuery, strings.TrimSpace(userId)); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// RevokedToken is an access token on the denylist
+type RevokedToken struct {
+	Id        string
+	ExpiresAt time.Time
+}
+
+// RevokedUser is a user whose tokens issued at or before IssuedBefore are revoked
+type RevokedUser struct {
+	UserId       string
+	IssuedBefore time.Time
+}
+
+type Revocations struct {
+	Tokens []RevokedToken
+	Users  []RevokedUser
+}
+
+// ListRevocations lists the revocations made after since that still matter. Tokens are listed
+// until they expire, and user revocations until maxTokenAge has passed, after which every
+// token they cover has expired.
+func (s *Service) ListRevocations(ctx context.Context, since time.Time, maxTokenAge time.Duration) (Revocations, error) {
+	if s.db == nil {
+		return Revocations{}, ErrMissingRequiredConfiguration
+	}
+
+	now := s.calendarService.NowUTC()
+
+	tokensQuery := `
+	SELECT 
+		rt.jti,
+		rt.expires_at
+	FROM revoked_tokens rt
+	WHERE 
+		rt.created_at >= $1 AND 
+		rt.expires_at > $2
+	ORDER BY rt.created_at`
+
+	rows, err := s.db.Query(ctx, tokensQuery, since, now)
+	if err != nil {
+		return Revocations{}, fmt.Errorf("failed to query for revoked tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var revocations = Revocations{
+		Tokens: []RevokedToken{},
+		Users:  []RevokedUser{},
+	}
+	for rows.Next() {
+		var t RevokedToken
+		if err := rows.Scan(&t.Id, &t.ExpiresAt); err != nil {
+			return Revocations{}, fmt.Errorf("failed to scan revoked token row: %w", err)
+		}
+		revocations.Tokens = append(revocations.Tokens, t)
+	}
+	rows.Close()
+
+	usersQuery := `
+	SELECT 
+		utr.user_id,
+		utr.issued_before
+	FROM user_token_revocations utr
+	WHERE 
+		utr.updated_at >= $1 AND 
+		utr.issued_before > $2
+	ORDER BY utr.updated_at`
+
+	rows, err = s.db.Query(ctx, usersQuery, since, now.Add(-maxTokenAge))
+	if err != nil {
+		return Revocations{}, fmt.Errorf("failed to query for user token revocations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u RevokedUser
+		if err := rows.Scan(&u.UserId, &u.IssuedBefore); err != nil {
+			return Revocations{}, fmt.Errorf("failed to scan user token revocation row: %w", err)
+		}
+		revocations.Users = append(revocations.Users, u)
+	}
+
+	return revocations, nil
+}
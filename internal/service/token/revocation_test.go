@@ -0,0 +1,93 @@
+package token_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/token"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokeUserTokens(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 250*int(time.Millisecond)+999, time.UTC)
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	userQuery := "INSERT INTO user_token_revocations (user_id, issued_before) VALUES ($1, $2) " +
+		"ON CONFLICT (user_id) DO UPDATE SET issued_before = EXCLUDED.issued_before, updated_at = NOW()"
+	refreshQuery := "UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() " +
+		"WHERE user_id = $1 AND revoked_at IS NULL"
+
+	tests := []struct {
+		name   string
+		userId string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			userId:      " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: token.ErrInvalidArg,
+		},
+		{
+			// the cut off is the instant of the revocation, not the end of the current second
+			name:   "Revoked",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectExec(userQuery).WithArgs(testUserId, now.Truncate(time.Millisecond)).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				db.ExpectExec(refreshQuery).WithArgs(testUserId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+		{
+			name:   "DbError",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectExec(userQuery).WithArgs(testUserId, now.Truncate(time.Millisecond)).
+					WillReturnError(errors.New("fake db error"))
+				db.ExpectRollback()
+			},
+			expectedErr: errors.New("failed to upsert user token revocation: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := token.NewService(token.ServiceConfig{
+				DB:              db,
+				CalendarService: &fakeCalendarService{now: now},
+			})
+
+			err = service.RevokeUserTokens(context.TODO(), test.userId)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				if !errors.Is(err, test.expectedErr) {
+					require.Equal(t, test.expectedErr.Error(), err.Error())
+				}
+				require.NoError(t, db.ExpectationsWereMet())
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/calendar"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("token service is missing required configurations to perform this operation")
+
+	ErrInvalidArg = errors.New("one or more of the provided arguments are invalid")
+
+	// ErrInvalidToken is returned when a token doesn't exist or has been revoked
+	ErrInvalidToken = errors.New("the token is invalid")
+
+	ErrTokenExpired = errors.New("the token has expired")
+
+	// ErrTokenReused is returned when a refresh token that was already rotated is presented
+	// again. This indicates the token was stolen, so the whole token family is revoked.
+	ErrTokenReused = errors.New("the token has already been used")
+)
+
+type ServiceConfig struct {
+	// DB is the Database used for the token service
+	DB postgres.ConnectionPool
+
+	CalendarService calendar.ServiceIface
+
+	// RefreshTokenExpiryLength is how long a refresh token is valid for. Each rotation issues
+	// a new token valid for the full length. Defaults to 30 days.
+	RefreshTokenExpiryLength time.Duration
+}
+
+type ServiceIface interface {
+	CreateRefreshToken(ctx context.Context, userId string) (RefreshToken, error)
+	CreateClientRefreshToken(ctx context.Context, userId, clientId, scope string) (RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, token, clientId string) (RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+
+	RevokeAccessToken(ctx context.Context, input RevokeAccessTokenInput) error
+	IsAccessTokenRevoked(ctx context.Context, id, userId string, issuedAt time.Time) (bool, error)
+	RevokeUserTokens(ctx context.Context, userId string) error
+	ListRevocations(ctx context.Context, since time.Time, maxTokenAge time.Duration) (Revocations, error)
+
+	CreatePersonalAccessToken(ctx context.Context, input CreatePersonalAccessTokenInput) (PersonalAccessToken, error)
+	GetPersonalAccessToken(ctx context.Context, token string) (PersonalAccessToken, error)
+	ListPersonalAccessTokens(ctx context.Context, userId string) ([]PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, userId, id string) error
+
+	RecordSession(ctx context.Context, input RecordSessionInput) error
+	ListSessions(ctx context.Context, userId string) ([]Session, error)
+	RevokeSession(ctx context.Context, userId, sessionId string) error
+}
+
+// Service manages the opaque tokens issued by the auth server
+type Service struct {
+	db              postgres.ConnectionPool
+	calendarService calendar.ServiceIface
+
+	refreshTokenExpiryLength time.Duration
+}
+
+func NewService(cfg ServiceConfig) *Service {
+	if cfg.CalendarService == nil {
+		cfg.CalendarService = calendar.NewService()
+	}
+
+	if cfg.RefreshTokenExpiryLength <= 0 {
+		cfg.RefreshTokenExpiryLength = 30 * 24 * time.Hour
+	}
+
+	return &Service{
+		db:                       cfg.DB,
+		calendarService:          cfg.CalendarService,
+		refreshTokenExpiryLength: cfg.RefreshTokenExpiryLength,
+	}
+}
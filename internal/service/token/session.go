@@ -0,0 +1,202 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Session is a device the user is logged in on. Each login starts a refresh token family, and
+// the session lasts as long as the family has an active refresh token.
+type Session struct {
+	// Id is the refresh token family's id
+	Id     string
+	UserId string
+
+	// IPAddress and UserAgent are from the session's latest login or refresh
+	IPAddress string
+	UserAgent string
+
+	// AccessTokenId is the jti of the latest access JWT issued to the session
+	AccessTokenId string
+
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+type RecordSessionInput struct {
+	// FamilyId is the refresh token family the session is for
+	FamilyId string
+	UserId   string
+
+	IPAddress string
+	UserAgent string
+
+	// AccessTokenId and AccessTokenExpiresAt are for the access JWT issued along with the
+	// refresh token, so it's revoked if the session is
+	AccessTokenId        string
+	AccessTokenExpiresAt time.Time
+}
+
+// RecordSession starts a session for a new refresh token family, or updates the session when
+// the family's refresh token is rotated
+func (s *Service) RecordSession(ctx context.Context, input RecordSessionInput) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(input.FamilyId) == "" || strings.TrimSpace(input.UserId) == "" {
+		return ErrInvalidArg
+	}
+
+	var accessTokenId *string
+	var accessTokenExpiresAt *time.Time
+	if strings.TrimSpace(input.AccessTokenId) != "" && !input.AccessTokenExpiresAt.IsZero() {
+		id := strings.TrimSpace(input.AccessTokenId)
+		accessTokenId = &id
+		accessTokenExpiresAt = &input.AccessTokenExpiresAt
+	}
+
+	// a family only ever belongs to one user, the user id check keeps a mixed up family id from
+	// moving another user's session
+	query := `
+	INSERT INTO sessions (id, user_id, ip_address, user_agent, access_token_id, access_token_expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (id) DO UPDATE SET
+		ip_address = EXCLUDED.ip_address,
+		user_agent = EXCLUDED.user_agent,
+		access_token_id = EXCLUDED.access_token_id,
+		access_token_expires_at = EXCLUDED.access_token_expires_at,
+		last_used_at = NOW(),
+		updated_at = NOW()
+	WHERE sessions.user_id = EXCLUDED.user_id`
+
+	if _, err := s.db.Exec(ctx, query, strings.TrimSpace(input.FamilyId), strings.TrimSpace(input.UserId),
+		input.IPAddress, input.UserAgent, accessTokenId, accessTokenExpiresAt); err != nil {
+		return fmt.Errorf("failed to upsert session: %w", err)
+	}
+
+	return nil
+}
+
+// ListSessions lists the user's active sessions, most recently used first
+func (s *Service) ListSessions(ctx context.Context, userId string) ([]Session, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	query := `
+	SELECT
+		s.id,
+		s.user_id,
+		COALESCE(s.ip_address, ''),
+		COALESCE(s.user_agent, ''),
+		COALESCE(s.access_token_id, ''),
+		s.created_at,
+		s.last_used_at
+	FROM sessions s
+	WHERE
+		s.user_id = $1 AND
+		EXISTS (
+			SELECT 1
+			FROM refresh_tokens rt
+			WHERE
+				rt.family_id = s.id AND
+				rt.used_at IS NULL AND
+				rt.revoked_at IS NULL AND
+				rt.expires_at > $2
+		)
+	ORDER BY s.last_used_at DESC`
+
+	rows, err := s.db.Query(ctx, query, strings.TrimSpace(userId), s.calendarService.NowUTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.Id, &session.UserId, &session.IPAddress, &session.UserAgent,
+			&session.AccessTokenId, &session.CreatedAt, &session.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession signs the user out of one of their sessions. Its refresh tokens are revoked
+// along with the latest access token issued to it. Returns ErrInvalidToken if the user has no
+// such session.
+func (s *Service) RevokeSession(ctx context.Context, userId, sessionId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(sessionId) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT
+		s.id,
+		COALESCE(s.access_token_id, ''),
+		s.access_token_expires_at
+	FROM sessions s
+	WHERE
+		s.id::text = $1 AND
+		s.user_id = $2
+	FOR UPDATE`
+
+	var familyId, accessTokenId string
+	var accessTokenExpiresAt *time.Time
+	row := tx.QueryRow(ctx, query, strings.TrimSpace(sessionId), strings.TrimSpace(userId))
+	if err := row.Scan(&familyId, &accessTokenId, &accessTokenExpiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidToken
+		}
+		return fmt.Errorf("failed to query for session: %w", err)
+	}
+
+	if err := revokeRefreshTokenFamily(ctx, tx, familyId); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	if accessTokenId != "" && accessTokenExpiresAt != nil &&
+		s.calendarService.NowUTC().Before(*accessTokenExpiresAt) {
+		revokeQuery := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at, reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING`
+
+		if _, err := tx.Exec(ctx, revokeQuery, accessTokenId, strings.TrimSpace(userId), *accessTokenExpiresAt,
+			"session revoked"); err != nil {
+			return fmt.Errorf("failed to insert revoked token: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
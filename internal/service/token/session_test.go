@@ -0,0 +1,194 @@
+package token_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/token"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordSession(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testFamilyId := "5b0b7c1a-8a4e-4f0d-8c55-0b5f3c2f3c11"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	query := "INSERT INTO sessions (id, user_id, ip_address, user_agent, access_token_id, access_token_expires_at) " +
+		"VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (id) DO UPDATE SET ip_address = EXCLUDED.ip_address, " +
+		"user_agent = EXCLUDED.user_agent, access_token_id = EXCLUDED.access_token_id, " +
+		"access_token_expires_at = EXCLUDED.access_token_expires_at, last_used_at = NOW(), updated_at = NOW() " +
+		"WHERE sessions.user_id = EXCLUDED.user_id"
+
+	accessTokenId := "access-token-id"
+	accessTokenExpiresAt := now.Add(15 * time.Minute)
+
+	tests := []struct {
+		name   string
+		input  token.RecordSessionInput
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			input:       token.RecordSessionInput{UserId: testUserId},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: token.ErrInvalidArg,
+		},
+		{
+			name: "Recorded",
+			input: token.RecordSessionInput{
+				FamilyId:             testFamilyId,
+				UserId:               testUserId,
+				IPAddress:            "203.0.113.7",
+				UserAgent:            "Mozilla/5.0",
+				AccessTokenId:        accessTokenId,
+				AccessTokenExpiresAt: accessTokenExpiresAt,
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs(testFamilyId, testUserId, "203.0.113.7", "Mozilla/5.0",
+					&accessTokenId, &accessTokenExpiresAt).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			},
+		},
+		{
+			name: "DbError",
+			input: token.RecordSessionInput{
+				FamilyId: testFamilyId,
+				UserId:   testUserId,
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs(testFamilyId, testUserId, "", "", (*string)(nil), (*time.Time)(nil)).
+					WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to upsert session: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := token.NewService(token.ServiceConfig{
+				DB:              db,
+				CalendarService: &fakeCalendarService{now: now},
+			})
+
+			err = service.RecordSession(context.TODO(), test.input)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				if !errors.Is(err, test.expectedErr) {
+					require.Equal(t, test.expectedErr.Error(), err.Error())
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testFamilyId := "5b0b7c1a-8a4e-4f0d-8c55-0b5f3c2f3c11"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	selectQuery := "SELECT s.id, COALESCE(s.access_token_id, ''), s.access_token_expires_at FROM sessions s " +
+		"WHERE s.id::text = $1 AND s.user_id = $2 FOR UPDATE"
+	selectColumns := []string{"id", "access_token_id", "access_token_expires_at"}
+	familyQuery := "UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL"
+	revokeQuery := "INSERT INTO revoked_tokens (jti, user_id, expires_at, reason) VALUES ($1, $2, $3, $4) " +
+		"ON CONFLICT (jti) DO NOTHING"
+
+	tests := []struct {
+		name      string
+		sessionId string
+		dbFunc    func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			sessionId:   " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: token.ErrInvalidArg,
+		},
+		{
+			name:      "Revoked",
+			sessionId: testFamilyId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				expiresAt := now.Add(10 * time.Minute)
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testFamilyId, testUserId).
+					WillReturnRows(pgxmock.NewRows(selectColumns).AddRow(testFamilyId, "access-token-id", &expiresAt))
+				db.ExpectExec(familyQuery).WithArgs(testFamilyId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectExec(revokeQuery).WithArgs("access-token-id", testUserId, expiresAt, "session revoked").
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				db.ExpectCommit()
+			},
+		},
+		{
+			name:      "AccessTokenExpired",
+			sessionId: testFamilyId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				expiresAt := now.Add(-10 * time.Minute)
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testFamilyId, testUserId).
+					WillReturnRows(pgxmock.NewRows(selectColumns).AddRow(testFamilyId, "access-token-id", &expiresAt))
+				db.ExpectExec(familyQuery).WithArgs(testFamilyId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+			},
+		},
+		{
+			name:      "NotFound",
+			sessionId: testFamilyId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).WithArgs(testFamilyId, testUserId).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: token.ErrInvalidToken,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service := token.NewService(token.ServiceConfig{
+				DB:              db,
+				CalendarService: &fakeCalendarService{now: now},
+			})
+
+			err = service.RevokeSession(context.TODO(), testUserId, test.sessionId)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				require.NoError(t, db.ExpectationsWereMet())
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
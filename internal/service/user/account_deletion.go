@@ -0,0 +1,265 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// defaultAccountDeletionGracePeriod is how long a user has to change their mind about
+	// deleting their account
+	defaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+	// deletedAccountRetention is how long deleted accounts stay in ListDeletedAccounts, so
+	// services that were down can still remove the user's data
+	deletedAccountRetention = 30 * 24 * time.Hour
+
+	// dueAccountDeletionsLimit is how many accounts DueAccountDeletions returns at once
+	dueAccountDeletionsLimit = 100
+)
+
+// ErrDeletionNotScheduled is returned when cancelling the deletion of an account that isn't
+// scheduled for deletion
+var ErrDeletionNotScheduled = errors.New("the account is not scheduled for deletion")
+
+// ScheduleAccountDeletion schedules the user's account to be deleted once the grace period is
+// over. Scheduling it again keeps the original date. Returns when the account will be deleted.
+func (s *Service) ScheduleAccountDeletion(ctx context.Context, userId string) (time.Time, error) {
+	if s.db == nil {
+		return time.Time{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return time.Time{}, ErrInvalidArg
+	}
+
+	query := `
+	UPDATE users SET
+		deletion_scheduled_at = COALESCE(deletion_scheduled_at, $2),
+		updated_at = NOW()
+	WHERE
+		id = $1 AND
+		deleted_at IS NULL
+	RETURNING deletion_scheduled_at`
+
+	var scheduledAt time.Time
+	row := s.db.QueryRow(ctx, query, strings.TrimSpace(userId), time.Now().UTC().Add(s.accountDeletionGracePeriod))
+	if err := row.Scan(&scheduledAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, ErrNotFound
+		}
+		return time.Time{}, fmt.Errorf("failed to schedule account deletion: %w", err)
+	}
+
+	return scheduledAt, nil
+}
+
+// CancelAccountDeletion keeps the user's account. Returns ErrDeletionNotScheduled if it isn't
+// scheduled for deletion, including once it has been deleted.
+func (s *Service) CancelAccountDeletion(ctx context.Context, userId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return ErrInvalidArg
+	}
+
+	query := `
+	UPDATE users SET
+		deletion_scheduled_at = NULL,
+		updated_at = NOW()
+	WHERE
+		id = $1 AND
+		deletion_scheduled_at IS NOT NULL AND
+		deleted_at IS NULL`
+
+	tag, err := s.db.Exec(ctx, query, strings.TrimSpace(userId))
+	if err != nil {
+		return fmt.Errorf("failed to cancel account deletion: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeletionNotScheduled
+	}
+
+	return nil
+}
+
+// DueAccountDeletions lists users whose grace period is over, oldest first. Up to 100 are
+// returned, call it again after deleting them for more.
+func (s *Service) DueAccountDeletions(ctx context.Context) ([]string, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	query := `
+	SELECT
+		u.id
+	FROM users u
+	WHERE
+		u.deletion_scheduled_at <= $1 AND
+		u.deleted_at IS NULL
+	ORDER BY u.deletion_scheduled_at
+	LIMIT $2`
+
+	rows, err := s.db.Query(ctx, query, time.Now().UTC(), dueAccountDeletionsLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for due account deletions: %w", err)
+	}
+	defer rows.Close()
+
+	userIds := make([]string, 0)
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			return nil, fmt.Errorf("failed to scan due account deletion: %w", err)
+		}
+		userIds = append(userIds, userId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read due account deletions: %w", err)
+	}
+
+	return userIds, nil
+}
+
+// anonymizeAccountQueries remove everything the auth server knows about a deleted user. The
+// users row is kept, anonymized, since other services' rows reference it.
+var anonymizeAccountQueries = []string{
+	`DELETE FROM users_security_questions WHERE user_id = $1`,
+	`DELETE FROM security_questions WHERE user_id = $1`,
+	`UPDATE users_roles SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+	`DELETE FROM external_identities WHERE user_id = $1`,
+	`DELETE FROM external_logins WHERE link_user_id = $1`,
+	`DELETE FROM webauthn_credentials WHERE user_id = $1`,
+	`DELETE FROM webauthn_challenges WHERE user_id = $1`,
+	`DELETE FROM user_totp WHERE user_id = $1`,
+	`DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+	`DELETE FROM mfa_challenges WHERE user_id = $1`,
+	`DELETE FROM email_changes WHERE user_id = $1`,
+	`DELETE FROM password_resets WHERE user_id = $1`,
+	`DELETE FROM oauth_authorization_codes WHERE user_id = $1`,
+	`UPDATE personal_access_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+	`DELETE FROM login_throttles WHERE kind IN ('account', 'mfa') AND key = $1::text`,
+	`DELETE FROM sessions WHERE user_id = $1`,
+	`UPDATE auth_events SET login = NULL, ip_address = NULL, user_agent = NULL WHERE user_id = $1`,
+}
+
+// DeleteAccount deletes a user whose grace period is over. Their details are anonymized and
+// their login methods removed. Returns ErrNotFound if the user isn't due for deletion. The
+// caller revokes the user's tokens.
+func (s *Service) DeleteAccount(ctx context.Context, userId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the user may have cancelled since the deletion was found to be due
+	query := `
+	UPDATE users SET
+		username = NULL,
+		email = NULL,
+		name = '',
+		salt = '',
+		password_hash = '',
+		email_verified_at = NULL,
+		active = false,
+		updated_at = NOW()
+	WHERE
+		id = $1 AND
+		deletion_scheduled_at <= $2 AND
+		deleted_at IS NULL`
+
+	tag, err := tx.Exec(ctx, query, strings.TrimSpace(userId), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to anonymize user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	for _, q := range anonymizeAccountQueries {
+		if _, err := tx.Exec(ctx, q, strings.TrimSpace(userId)); err != nil {
+			return fmt.Errorf("failed to remove user data: %w", err)
+		}
+	}
+
+	// NOW() is when the transaction started, and the deletion feed moves pollers past any
+	// deleted_at before it was generated. The deletion is stamped as close to the commit as it
+	// can be, so it isn't hidden behind a feed generated while this transaction ran.
+	deletedQuery := `
+	UPDATE users SET
+		deleted_at = clock_timestamp()
+	WHERE
+		id = $1`
+
+	if _, err := tx.Exec(ctx, deletedQuery, strings.TrimSpace(userId)); err != nil {
+		return fmt.Errorf("failed to mark user deleted: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeletedAccount is a deleted user, for the services that keep their own data about users
+type DeletedAccount struct {
+	UserId    string
+	DeletedAt time.Time
+}
+
+// ListDeletedAccounts lists the users deleted after since, oldest first. Only accounts deleted
+// in the last 30 days are listed.
+func (s *Service) ListDeletedAccounts(ctx context.Context, since time.Time) ([]DeletedAccount, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if retentionStart := time.Now().UTC().Add(-deletedAccountRetention); since.Before(retentionStart) {
+		since = retentionStart
+	}
+
+	query := `
+	SELECT
+		u.id,
+		u.deleted_at
+	FROM users u
+	WHERE u.deleted_at > $1
+	ORDER BY u.deleted_at`
+
+	rows, err := s.db.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for deleted accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make([]DeletedAccount, 0)
+	for rows.Next() {
+		var a DeletedAccount
+		if err := rows.Scan(&a.UserId, &a.DeletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deleted account: %w", err)
+		}
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read deleted accounts: %w", err)
+	}
+
+	return accounts, nil
+}
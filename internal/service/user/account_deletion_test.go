@@ -0,0 +1,275 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleAccountDeletion(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	scheduledAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	query := "UPDATE users SET deletion_scheduled_at = COALESCE(deletion_scheduled_at, $2), updated_at = NOW() " +
+		"WHERE id = $1 AND deleted_at IS NULL RETURNING deletion_scheduled_at"
+
+	tests := []struct {
+		name   string
+		userId string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr         error
+		expectedScheduledAt time.Time
+	}{
+		{
+			name:        "InvalidArg",
+			userId:      " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:   "Scheduled",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs(testUserId, pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"deletion_scheduled_at"}).AddRow(scheduledAt))
+			},
+			expectedScheduledAt: scheduledAt,
+		},
+		{
+			name:   "NotFound",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs(testUserId, pgxmock.AnyArg()).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name:   "DbError",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).WithArgs(testUserId, pgxmock.AnyArg()).
+					WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to schedule account deletion: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			scheduledAt, err := service.ScheduleAccountDeletion(context.TODO(), test.userId)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				if !errors.Is(err, test.expectedErr) {
+					require.Equal(t, test.expectedErr.Error(), err.Error())
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expectedScheduledAt, scheduledAt)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCancelAccountDeletion(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	query := "UPDATE users SET deletion_scheduled_at = NULL, updated_at = NOW() " +
+		"WHERE id = $1 AND deletion_scheduled_at IS NOT NULL AND deleted_at IS NULL"
+
+	tests := []struct {
+		name   string
+		userId string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			userId:      "",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:   "Cancelled",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs(testUserId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+		},
+		{
+			name:   "NotScheduled",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs(testUserId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			expectedErr: user.ErrDeletionNotScheduled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			err = service.CancelAccountDeletion(context.TODO(), test.userId)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	anonymizeQuery := "UPDATE users SET username = NULL, email = NULL, name = '', salt = '', password_hash = '', " +
+		"email_verified_at = NULL, active = false, updated_at = NOW() " +
+		"WHERE id = $1 AND deletion_scheduled_at <= $2 AND deleted_at IS NULL"
+	userDataQueries := []string{
+		"DELETE FROM users_security_questions WHERE user_id = $1",
+		"DELETE FROM security_questions WHERE user_id = $1",
+		"UPDATE users_roles SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL",
+		"DELETE FROM external_identities WHERE user_id = $1",
+		"DELETE FROM external_logins WHERE link_user_id = $1",
+		"DELETE FROM webauthn_credentials WHERE user_id = $1",
+		"DELETE FROM webauthn_challenges WHERE user_id = $1",
+		"DELETE FROM user_totp WHERE user_id = $1",
+		"DELETE FROM mfa_recovery_codes WHERE user_id = $1",
+		"DELETE FROM mfa_challenges WHERE user_id = $1",
+		"DELETE FROM email_changes WHERE user_id = $1",
+		"DELETE FROM password_resets WHERE user_id = $1",
+		"DELETE FROM oauth_authorization_codes WHERE user_id = $1",
+		"UPDATE personal_access_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL",
+		"DELETE FROM login_throttles WHERE kind IN ('account', 'mfa') AND key = $1::text",
+		"DELETE FROM sessions WHERE user_id = $1",
+		"UPDATE auth_events SET login = NULL, ip_address = NULL, user_agent = NULL WHERE user_id = $1",
+	}
+	deletedQuery := "UPDATE users SET deleted_at = clock_timestamp() WHERE id = $1"
+
+	tests := []struct {
+		name   string
+		userId string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			userId:      " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:   "Deleted",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectExec(anonymizeQuery).WithArgs(testUserId, pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				for _, q := range userDataQueries {
+					db.ExpectExec(q).WithArgs(testUserId).
+						WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				}
+				db.ExpectExec(deletedQuery).WithArgs(testUserId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+			},
+		},
+		{
+			name:   "NotDue",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectExec(anonymizeQuery).WithArgs(testUserId, pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name:   "DbError",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectExec(anonymizeQuery).WithArgs(testUserId, pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectExec("DELETE FROM users_security_questions WHERE user_id = $1").WithArgs(testUserId).
+					WillReturnError(errors.New("fake db error"))
+				db.ExpectRollback()
+			},
+			expectedErr: errors.New("failed to remove user data: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			err = service.DeleteAccount(context.TODO(), test.userId)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				if !errors.Is(err, test.expectedErr) {
+					require.Equal(t, test.expectedErr.Error(), err.Error())
+				}
+				require.NoError(t, db.ExpectationsWereMet())
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+// ErrAlreadyExists is returned when a unique value, like an email address, is already in use
+var ErrAlreadyExists = errors.New("the resource already exists")
+
+// emailChangeExpiry is how long both addresses have to confirm an email change
+const emailChangeExpiry = 24 * time.Hour
+
+type UserEmail struct {
+	Email string
+
+	// VerifiedAt is when the user proved they own the address, nil if they haven't yet
+	VerifiedAt *time.Time
+}
+
+func (u *UserEmail) Verified() bool {
+	return u.VerifiedAt != nil
+}
+
+// GetUserEmail gets the user's email address and whether it has been verified
+func (s *Service) GetUserEmail(ctx context.Context, userId string) (UserEmail, error) {
+	if s.db == nil {
+		return UserEmail{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return UserEmail{}, ErrInvalidArg
+	}
+
+	query := `
+	SELECT 
+		COALESCE(u.email, ''),
+		u.email_verified_at
+	FROM users u
+	WHERE u.id = $1`
+
+	var output UserEmail
+	row := s.db.QueryRow(ctx, query, userId)
+	if err := row.Scan(&output.Email, &output.VerifiedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return UserEmail{}, ErrNotFound
+		}
+		return UserEmail{}, fmt.Errorf("failed to query for user email: %w", err)
+	}
+
+	return output, nil
+}
+
+// VerifyEmail marks the user's email address as verified. The address must still be the user's
+// current address, otherwise ErrNotFound is returned.
+func (s *Service) VerifyEmail(ctx context.Context, userId, email string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(email) == "" {
+		return ErrInvalidArg
+	}
+
+	query := `
+	UPDATE users SET
+		email_verified_at = COALESCE(email_verified_at, NOW()),
+		updated_at = NOW()
+	WHERE 
+		id = $1 AND 
+		email = $2`
+
+	tag, err := s.db.Exec(ctx, query, userId, email)
+	if err != nil {
+		return fmt.Errorf("failed to verify user email: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// EmailChangeAddress identifies which of the two addresses in an email change is confirming
+type EmailChangeAddress string
+
+const (
+	EmailChangeAddressOld = EmailChangeAddress("old")
+	EmailChangeAddressNew = EmailChangeAddress("new")
+)
+
+func (e EmailChangeAddress) Valid() bool {
+	return e == EmailChangeAddressOld || e == EmailChangeAddressNew
+}
+
+type EmailChange struct {
+	Id       string
+	UserId   string
+	OldEmail string
+	NewEmail string
+
+	OldConfirmedAt *time.Time
+	NewConfirmedAt *time.Time
+
+	// CompletedAt is when the user's email was changed, once both addresses have confirmed
+	CompletedAt *time.Time
+	ExpiresAt   time.Time
+}
+
+func (e *EmailChange) Completed() bool {
+	return e.CompletedAt != nil
+}
+
+// StartEmailChange starts changing the user's email address to newEmail. Both the current and
+// new address must confirm the change before it is applied. Any other change the user has in
+// progress is replaced. Returns ErrAlreadyExists if newEmail is already in use.
+func (s *Service) StartEmailChange(ctx context.Context, userId, newEmail string) (EmailChange, error) {
+	if s.db == nil {
+		return EmailChange{}, ErrMissingRequiredConfiguration
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if strings.TrimSpace(userId) == "" || newEmail == "" {
+		return EmailChange{}, ErrInvalidArg
+	}
+
+	currentEmail, err := s.GetUserEmail(ctx, userId)
+	if err != nil {
+		return EmailChange{}, fmt.Errorf("failed to get user email: %w", err)
+	}
+
+	if strings.EqualFold(currentEmail.Email, newEmail) {
+		return EmailChange{}, ErrInvalidArg
+	}
+
+	existsQuery := `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`
+
+	var emailExists bool
+	if err := s.db.QueryRow(ctx, existsQuery, newEmail).Scan(&emailExists); err != nil {
+		return EmailChange{}, fmt.Errorf("failed to check if email exists: %w", err)
+	}
+	if emailExists {
+		return EmailChange{}, ErrAlreadyExists
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return EmailChange{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// only the latest change can be confirmed
+	expireQuery := `
+	UPDATE email_changes SET
+		expires_at = NOW(),
+		updated_at = NOW()
+	WHERE 
+		user_id = $1 AND 
+		completed_at IS NULL AND 
+		expires_at > NOW()`
+
+	if _, err := tx.Exec(ctx, expireQuery, userId); err != nil {
+		return EmailChange{}, fmt.Errorf("failed to expire existing email changes: %w", err)
+	}
+
+	change := EmailChange{
+		UserId:    userId,
+		OldEmail:  currentEmail.Email,
+		NewEmail:  newEmail,
+		ExpiresAt: time.Now().UTC().Add(emailChangeExpiry),
+	}
+
+	insertQuery := `
+	INSERT INTO email_changes (user_id, old_email, new_email, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id`
+
+	row := tx.QueryRow(ctx, insertQuery, change.UserId, change.OldEmail, change.NewEmail, change.ExpiresAt)
+	if err := row.Scan(&change.Id); err != nil {
+		return EmailChange{}, fmt.Errorf("failed to insert email change: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return EmailChange{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return change, nil
+}
+
+// ConfirmEmailChange records that one of the addresses confirmed the change. Once both have, the
+// user's email is changed to the new address, which is then verified. Returns ErrNotFound if
+// the change doesn't exist, is expired or was already completed.
+func (s *Service) ConfirmEmailChange(ctx context.Context, changeId string, address EmailChangeAddress) (EmailChange, error) {
+	if s.db == nil {
+		return EmailChange{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(changeId) == "" || !address.Valid() {
+		return EmailChange{}, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return EmailChange{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT 
+		ec.id,
+		ec.user_id,
+		ec.old_email,
+		ec.new_email,
+		ec.old_confirmed_at,
+		ec.new_confirmed_at,
+		ec.completed_at,
+		ec.expires_at
+	FROM email_changes ec
+	WHERE ec.id::text = $1
+	FOR UPDATE`
+
+	var change EmailChange
+	row := tx.QueryRow(ctx, query, changeId)
+	if err := row.Scan(&change.Id, &change.UserId, &change.OldEmail, &change.NewEmail,
+		&change.OldConfirmedAt, &change.NewConfirmedAt, &change.CompletedAt, &change.ExpiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return EmailChange{}, ErrNotFound
+		}
+		return EmailChange{}, fmt.Errorf("failed to query for email change: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if change.Completed() || now.After(change.ExpiresAt) {
+		return EmailChange{}, ErrNotFound
+	}
+
+	switch address {
+	case EmailChangeAddressOld:
+		if change.OldConfirmedAt == nil {
+			change.OldConfirmedAt = &now
+		}
+	case EmailChangeAddressNew:
+		if change.NewConfirmedAt == nil {
+			change.NewConfirmedAt = &now
+		}
+	}
+
+	if change.OldConfirmedAt != nil && change.NewConfirmedAt != nil {
+		userQuery := `
+		UPDATE users SET
+			email = $3,
+			email_verified_at = NOW(),
+			updated_at = NOW()
+		WHERE 
+			id = $1 AND 
+			email = $2`
+
+		tag, err := tx.Exec(ctx, userQuery, change.UserId, change.OldEmail, change.NewEmail)
+		if err != nil {
+			if postgres.IsUniqueViolation(err) {
+				return EmailChange{}, ErrAlreadyExists
+			}
+			return EmailChange{}, fmt.Errorf("failed to update user email: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			// the user's email changed some other way since this change started
+			return EmailChange{}, ErrNotFound
+		}
+
+		change.CompletedAt = &now
+	}
+
+	updateQuery := `
+	UPDATE email_changes SET
+		old_confirmed_at = $2,
+		new_confirmed_at = $3,
+		completed_at = $4,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, updateQuery, change.Id, change.OldConfirmedAt, change.NewConfirmedAt, change.CompletedAt); err != nil {
+		return EmailChange{}, fmt.Errorf("failed to update email change: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return EmailChange{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return change, nil
+}
@@ -0,0 +1,207 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	query := "UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW() WHERE id = $1 AND email = $2"
+
+	tests := []struct {
+		name  string
+		email string
+
+		dbFunc      func(db pgxmock.PgxConnIface)
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			email:       "",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:  "EmailChanged",
+			email: "old@example.com",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).
+					WithArgs(testUserId, "old@example.com").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name:  "Verified",
+			email: "test@example.com",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).
+					WithArgs(testUserId, "test@example.com").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			err = service.VerifyEmail(context.TODO(), testUserId, test.email)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	testChangeId := "0d0c1bd4-8f63-4a6b-b0a4-53f6f0a3e1c2"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	selectQuery := "SELECT ec.id, ec.user_id, ec.old_email, ec.new_email, ec.old_confirmed_at, ec.new_confirmed_at, ec.completed_at, ec.expires_at FROM email_changes ec WHERE ec.id::text = $1 FOR UPDATE"
+	updateUserQuery := "UPDATE users SET email = $3, email_verified_at = NOW(), updated_at = NOW() WHERE id = $1 AND email = $2"
+	updateChangeQuery := "UPDATE email_changes SET old_confirmed_at = $2, new_confirmed_at = $3, completed_at = $4, updated_at = NOW() WHERE id = $1"
+
+	confirmedAt := time.Now().Add(-time.Hour)
+
+	changeRows := func(oldConfirmedAt, newConfirmedAt, completedAt *time.Time, expiresAt time.Time) *pgxmock.Rows {
+		return pgxmock.NewRows([]string{"id", "user_id", "old_email", "new_email", "old_confirmed_at", "new_confirmed_at", "completed_at", "expires_at"}).
+			AddRow(testChangeId, testUserId, "old@example.com", "new@example.com", oldConfirmedAt, newConfirmedAt, completedAt, expiresAt)
+	}
+
+	tests := []struct {
+		name    string
+		address user.EmailChangeAddress
+
+		dbFunc            func(db pgxmock.PgxConnIface)
+		expectedCompleted bool
+		expectedErr       error
+	}{
+		{
+			name:        "InvalidAddress",
+			address:     user.EmailChangeAddress("other"),
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:    "NotFound",
+			address: user.EmailChangeAddressOld,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).
+					WithArgs(testChangeId).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name:    "Expired",
+			address: user.EmailChangeAddressOld,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).
+					WithArgs(testChangeId).
+					WillReturnRows(changeRows(nil, nil, nil, time.Now().Add(-time.Minute)))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name:    "FirstConfirmation",
+			address: user.EmailChangeAddressOld,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).
+					WithArgs(testChangeId).
+					WillReturnRows(changeRows(nil, nil, nil, time.Now().Add(time.Hour)))
+				db.ExpectExec(updateChangeQuery).
+					WithArgs(testChangeId, pgxmock.AnyArg(), (*time.Time)(nil), (*time.Time)(nil)).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedCompleted: false,
+		},
+		{
+			name:    "BothConfirmed",
+			address: user.EmailChangeAddressNew,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).
+					WithArgs(testChangeId).
+					WillReturnRows(changeRows(&confirmedAt, nil, nil, time.Now().Add(time.Hour)))
+				db.ExpectExec(updateUserQuery).
+					WithArgs(testUserId, "old@example.com", "new@example.com").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectExec(updateChangeQuery).
+					WithArgs(testChangeId, pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedCompleted: true,
+		},
+		{
+			name:    "UserEmailChangedSinceStart",
+			address: user.EmailChangeAddressNew,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(selectQuery).
+					WithArgs(testChangeId).
+					WillReturnRows(changeRows(&confirmedAt, nil, nil, time.Now().Add(time.Hour)))
+				db.ExpectExec(updateUserQuery).
+					WithArgs(testUserId, "old@example.com", "new@example.com").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			change, err := service.ConfirmEmailChange(context.TODO(), testChangeId, test.address)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.Equal(t, test.expectedCompleted, change.Completed(), "completedComparison")
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+	"github.com/keola-dunn/autolog/internal/random"
+)
+
+var (
+	// ErrIdentityConflict is returned when an external identity's email belongs to an account
+	// it can't be linked to automatically. The user must log in and link the provider instead.
+	ErrIdentityConflict = errors.New("the email address belongs to another account")
+
+	// ErrLastLoginMethod is returned when removing the only way a user can log in
+	ErrLastLoginMethod = errors.New("the user has no other way to log in")
+)
+
+// externalLoginExpiry is how long the user has to log in with the provider and come back
+const externalLoginExpiry = 10 * time.Minute
+
+// ExternalLogin is a login with an external provider in progress
+type ExternalLogin struct {
+	// State is sent to the provider and must come back with the authorization code. It is only
+	// known when the login is started, it is stored hashed.
+	State string
+
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+
+	// LinkUserId is set when a logged in user is linking the provider to their account
+	LinkUserId string
+
+	ExpiresAt time.Time
+}
+
+// StartExternalLogin starts a login with the provider. linkUserId is the logged in user when
+// linking the provider to an existing account, empty otherwise.
+func (s *Service) StartExternalLogin(ctx context.Context, provider, linkUserId string) (ExternalLogin, error) {
+	if s.db == nil {
+		return ExternalLogin{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(provider) == "" {
+		return ExternalLogin{}, ErrInvalidArg
+	}
+
+	state, err := random.SecureToken(32)
+	if err != nil {
+		return ExternalLogin{}, fmt.Errorf("failed to generate state: %w", err)
+	}
+
+	nonce, err := random.SecureToken(32)
+	if err != nil {
+		return ExternalLogin{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	// https://datatracker.ietf.org/doc/html/rfc7636#section-4.1
+	codeVerifier, err := random.SecureToken(32)
+	if err != nil {
+		return ExternalLogin{}, fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+
+	login := ExternalLogin{
+		State:        state,
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserId:   linkUserId,
+		ExpiresAt:    time.Now().UTC().Add(externalLoginExpiry),
+	}
+
+	var linkUser *string
+	if linkUserId != "" {
+		linkUser = &linkUserId
+	}
+
+	query := `
+	INSERT INTO external_logins (state_hash, provider, nonce, code_verifier, link_user_id, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+
+	if _, err := s.db.Exec(ctx, query, hashutil.SHA256Hex(state), provider, nonce, codeVerifier,
+		linkUser, login.ExpiresAt); err != nil {
+		return ExternalLogin{}, fmt.Errorf("failed to insert external login: %w", err)
+	}
+
+	return login, nil
+}
+
+// UseExternalLogin finds the login with the provider by its state, and marks it used so it can't
+// be replayed. Returns ErrNotFound if it doesn't exist, is expired or was already used.
+func (s *Service) UseExternalLogin(ctx context.Context, provider, state string) (ExternalLogin, error) {
+	if s.db == nil {
+		return ExternalLogin{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(provider) == "" || strings.TrimSpace(state) == "" {
+		return ExternalLogin{}, ErrInvalidArg
+	}
+
+	query := `
+	UPDATE external_logins SET
+		used_at = NOW()
+	WHERE 
+		state_hash = $1 AND 
+		provider = $2 AND 
+		used_at IS NULL AND 
+		expires_at > NOW()
+	RETURNING nonce, code_verifier, COALESCE(link_user_id::text, ''), expires_at`
+
+	login := ExternalLogin{
+		Provider: provider,
+	}
+	row := s.db.QueryRow(ctx, query, hashutil.SHA256Hex(state), provider)
+	if err := row.Scan(&login.Nonce, &login.CodeVerifier, &login.LinkUserId, &login.ExpiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ExternalLogin{}, ErrNotFound
+		}
+		return ExternalLogin{}, fmt.Errorf("failed to use external login: %w", err)
+	}
+
+	return login, nil
+}
+
+// ExternalIdentity is who the user is at an external provider, from its ID token
+type ExternalIdentity struct {
+	Provider string
+
+	// Subject is the provider's stable id for the user
+	Subject string
+
+	Email string
+
+	// EmailVerified is true when the provider vouches the user owns the email address
+	EmailVerified bool
+
+	Name string
+}
+
+// LinkedIdentity is an external identity linked to a user
+type LinkedIdentity struct {
+	Id          string
+	Provider    string
+	Email       string
+	LastLoginAt *time.Time
+	CreatedAt   time.Time
+}
+
+// LoginWithExternalIdentity finds the user for the external identity, returning their id.
+//
+// Identities that aren't linked yet are linked to the user with the same email address, as long
+// as both the provider and the user have verified it. Otherwise a user that doesn't exist is
+// created. Returns ErrIdentityConflict if the email belongs to a user it can't be linked to.
+func (s *Service) LoginWithExternalIdentity(ctx context.Context, identity ExternalIdentity) (string, error) {
+	if s.db == nil {
+		return "", ErrMissingRequiredConfiguration
+	}
+
+	identity.Email = strings.TrimSpace(identity.Email)
+	if strings.TrimSpace(identity.Provider) == "" || strings.TrimSpace(identity.Subject) == "" {
+		return "", ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	loginQuery := `
+	UPDATE external_identities SET
+		email = $3,
+		last_login_at = NOW(),
+		updated_at = NOW()
+	WHERE 
+		provider = $1 AND 
+		subject = $2
+	RETURNING user_id`
+
+	var userId string
+	row := tx.QueryRow(ctx, loginQuery, identity.Provider, identity.Subject, identity.Email)
+	err = row.Scan(&userId)
+	switch {
+	case err == nil:
+		if err := tx.Commit(ctx); err != nil {
+			return "", fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return userId, nil
+	case !errors.Is(err, pgx.ErrNoRows):
+		return "", fmt.Errorf("failed to update external identity: %w", err)
+	}
+
+	// the email is how the identity is matched to, or becomes, a user
+	if identity.Email == "" {
+		return "", ErrInvalidArg
+	}
+
+	userQuery := `
+	SELECT 
+		u.id,
+		u.email_verified_at
+	FROM users u
+	WHERE u.email = $1`
+
+	var emailVerifiedAt *time.Time
+	row = tx.QueryRow(ctx, userQuery, identity.Email)
+	err = row.Scan(&userId, &emailVerifiedAt)
+	switch {
+	case err == nil:
+		// either side not verifying the address could let someone take over the account
+		if !identity.EmailVerified || emailVerifiedAt == nil {
+			return "", ErrIdentityConflict
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		userId, err = createExternalUserRecord(ctx, tx, identity)
+		if err != nil {
+			if postgres.IsUniqueViolation(err) {
+				return "", ErrIdentityConflict
+			}
+			return "", fmt.Errorf("failed to create user: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("failed to query for user: %w", err)
+	}
+
+	if _, err := insertExternalIdentity(ctx, tx, userId, identity); err != nil {
+		return "", fmt.Errorf("failed to insert external identity: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userId, nil
+}
+
+// createExternalUserRecord creates a user for an external identity. They have no username or
+// password until they set one.
+func createExternalUserRecord(ctx context.Context, tx pgx.Tx, identity ExternalIdentity) (string, error) {
+	var emailVerifiedAt *time.Time
+	if identity.EmailVerified {
+		now := time.Now().UTC()
+		emailVerifiedAt = &now
+	}
+
+	query := `
+	INSERT INTO users (salt, password_hash, email, name, email_verified_at)
+	VALUES ('', '', $1, $2, $3)
+	RETURNING id`
+
+	var userId string
+	row := tx.QueryRow(ctx, query, identity.Email, identity.Name, emailVerifiedAt)
+	if err := row.Scan(&userId); err != nil {
+		return "", fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	if err := createUserRoleRecord(ctx, tx, userId, RoleUser); err != nil {
+		return "", fmt.Errorf("failed to create user role record: %w", err)
+	}
+
+	return userId, nil
+}
+
+func insertExternalIdentity(ctx context.Context, tx pgx.Tx, userId string, identity ExternalIdentity) (LinkedIdentity, error) {
+	query := `
+	INSERT INTO external_identities (user_id, provider, subject, email, last_login_at)
+	VALUES ($1, $2, $3, $4, NOW())
+	RETURNING id, last_login_at, created_at`
+
+	linked := LinkedIdentity{
+		Provider: identity.Provider,
+		Email:    identity.Email,
+	}
+	row := tx.QueryRow(ctx, query, userId, identity.Provider, identity.Subject, identity.Email)
+	if err := row.Scan(&linked.Id, &linked.LastLoginAt, &linked.CreatedAt); err != nil {
+		return LinkedIdentity{}, err
+	}
+
+	return linked, nil
+}
+
+// LinkExternalIdentity links the external identity to the user, so they can log in with the
+// provider. Returns ErrAlreadyExists if the identity is linked to a user already.
+func (s *Service) LinkExternalIdentity(ctx context.Context, userId string, identity ExternalIdentity) (LinkedIdentity, error) {
+	if s.db == nil {
+		return LinkedIdentity{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" ||
+		strings.TrimSpace(identity.Provider) == "" ||
+		strings.TrimSpace(identity.Subject) == "" {
+		return LinkedIdentity{}, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return LinkedIdentity{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	linked, err := insertExternalIdentity(ctx, tx, userId, identity)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return LinkedIdentity{}, ErrAlreadyExists
+		}
+		return LinkedIdentity{}, fmt.Errorf("failed to insert external identity: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return LinkedIdentity{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return linked, nil
+}
+
+// ListExternalIdentities lists the external identities linked to the user
+func (s *Service) ListExternalIdentities(ctx context.Context, userId string) ([]LinkedIdentity, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	query := `
+	SELECT 
+		ei.id,
+		ei.provider,
+		ei.email,
+		ei.last_login_at,
+		ei.created_at
+	FROM external_identities ei
+	WHERE ei.user_id = $1
+	ORDER BY ei.created_at`
+
+	rows, err := s.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for external identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities = []LinkedIdentity{}
+	for rows.Next() {
+		var i LinkedIdentity
+		if err := rows.Scan(&i.Id, &i.Provider, &i.Email, &i.LastLoginAt, &i.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan external identity row: %w", err)
+		}
+		identities = append(identities, i)
+	}
+
+	return identities, nil
+}
+
+// UnlinkExternalIdentity removes the external identity from the user. Returns ErrNotFound if the
+// user doesn't have it, and ErrLastLoginMethod if the user would be left unable to log in.
+func (s *Service) UnlinkExternalIdentity(ctx context.Context, userId, identityId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || strings.TrimSpace(identityId) == "" {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	deleteQuery := `
+	DELETE FROM external_identities
+	WHERE 
+		id::text = $1 AND 
+		user_id = $2`
+
+	tag, err := tx.Exec(ctx, deleteQuery, identityId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete external identity: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	loginMethodsQuery := `
+	SELECT 
+		COALESCE(u.password_hash, '') <> '' OR 
+		EXISTS (SELECT 1 FROM external_identities ei WHERE ei.user_id = u.id) OR 
+		EXISTS (SELECT 1 FROM webauthn_credentials wc WHERE wc.user_id = u.id)
+	FROM users u
+	WHERE u.id = $1`
+
+	var canLogin bool
+	if err := tx.QueryRow(ctx, loginMethodsQuery, userId).Scan(&canLogin); err != nil {
+		return fmt.Errorf("failed to query for remaining login methods: %w", err)
+	}
+	if !canLogin {
+		return ErrLastLoginMethod
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginWithExternalIdentity(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testIdentityId := "0d0c1bd4-8f63-4a6b-b0a4-53f6f0a3e1c2"
+	verifiedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	loginQuery := "UPDATE external_identities SET email = $3, last_login_at = NOW(), updated_at = NOW() WHERE provider = $1 AND subject = $2 RETURNING user_id"
+	userQuery := "SELECT u.id, u.email_verified_at FROM users u WHERE u.email = $1"
+	createUserQuery := "INSERT INTO users (salt, password_hash, email, name, email_verified_at) VALUES ('', '', $1, $2, $3) RETURNING id"
+	roleQuery := "WITH role AS ( SELECT id FROM roles r WHERE r.role = $1 LIMIT 1 ) INSERT INTO users_roles (user_id, role_id) VALUES ($2, (SELECT id FROM role))"
+	linkQuery := "INSERT INTO external_identities (user_id, provider, subject, email, last_login_at) VALUES ($1, $2, $3, $4, NOW()) RETURNING id, last_login_at, created_at"
+
+	testIdentity := user.ExternalIdentity{
+		Provider:      "google",
+		Subject:       "110169484474386276334",
+		Email:         "test@example.com",
+		EmailVerified: true,
+		Name:          "Test User",
+	}
+
+	linkRows := func() *pgxmock.Rows {
+		return pgxmock.NewRows([]string{"id", "last_login_at", "created_at"}).
+			AddRow(testIdentityId, &verifiedAt, verifiedAt)
+	}
+
+	tests := []struct {
+		name     string
+		identity user.ExternalIdentity
+
+		dbFunc         func(db pgxmock.PgxConnIface)
+		expectedUserId string
+		expectedErr    error
+	}{
+		{
+			name:        "InvalidArg",
+			identity:    user.ExternalIdentity{Provider: "google"},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:     "AlreadyLinked",
+			identity: testIdentity,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(loginQuery).
+					WithArgs("google", testIdentity.Subject, testIdentity.Email).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(testUserId))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedUserId: testUserId,
+		},
+		{
+			name:     "LinkedByVerifiedEmail",
+			identity: testIdentity,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(loginQuery).
+					WithArgs("google", testIdentity.Subject, testIdentity.Email).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectQuery(userQuery).
+					WithArgs(testIdentity.Email).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "email_verified_at"}).AddRow(testUserId, &verifiedAt))
+				db.ExpectQuery(linkQuery).
+					WithArgs(testUserId, "google", testIdentity.Subject, testIdentity.Email).
+					WillReturnRows(linkRows())
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedUserId: testUserId,
+		},
+		{
+			name:     "UserEmailNotVerified",
+			identity: testIdentity,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(loginQuery).
+					WithArgs("google", testIdentity.Subject, testIdentity.Email).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectQuery(userQuery).
+					WithArgs(testIdentity.Email).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "email_verified_at"}).AddRow(testUserId, (*time.Time)(nil)))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrIdentityConflict,
+		},
+		{
+			name: "ProviderEmailNotVerified",
+			identity: user.ExternalIdentity{
+				Provider: "google",
+				Subject:  testIdentity.Subject,
+				Email:    testIdentity.Email,
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(loginQuery).
+					WithArgs("google", testIdentity.Subject, testIdentity.Email).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectQuery(userQuery).
+					WithArgs(testIdentity.Email).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "email_verified_at"}).AddRow(testUserId, &verifiedAt))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrIdentityConflict,
+		},
+		{
+			name:     "NewUser",
+			identity: testIdentity,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(loginQuery).
+					WithArgs("google", testIdentity.Subject, testIdentity.Email).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectQuery(userQuery).
+					WithArgs(testIdentity.Email).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectQuery(createUserQuery).
+					WithArgs(testIdentity.Email, testIdentity.Name, pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
+				db.ExpectExec(roleQuery).
+					WithArgs("user", testUserId).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				db.ExpectQuery(linkQuery).
+					WithArgs(testUserId, "google", testIdentity.Subject, testIdentity.Email).
+					WillReturnRows(linkRows())
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedUserId: testUserId,
+		},
+		{
+			name: "NewUserWithoutEmail",
+			identity: user.ExternalIdentity{
+				Provider: "google",
+				Subject:  testIdentity.Subject,
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(loginQuery).
+					WithArgs("google", testIdentity.Subject, "").
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrInvalidArg,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			userId, err := service.LoginWithExternalIdentity(context.TODO(), test.identity)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.Equal(t, test.expectedUserId, userId)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
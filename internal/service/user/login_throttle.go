@@ -0,0 +1,343 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// loginThrottleWindow is how long failed logins are remembered. A failure after a quiet
+	// window starts the count over.
+	loginThrottleWindow = 15 * time.Minute
+
+	// loginFreeAttempts is how many failed logins are allowed before delays start. Each failure
+	// after that doubles the delay, up to loginMaxDelay.
+	loginFreeAttempts = 3
+	loginMaxDelay     = 30 * time.Second
+
+	// loginAccountLockoutFailures is how many failed logins lock an account
+	loginAccountLockoutFailures = 10
+
+	// loginIPLockoutFailures is how many failed logins lock an IP address out of every account.
+	// It's higher than the account limit since many users can share an address.
+	loginIPLockoutFailures = 50
+
+	loginLockoutLength = 15 * time.Minute
+)
+
+type loginThrottleKind string
+
+const (
+	loginThrottleKindAccount = loginThrottleKind("account")
+	loginThrottleKindIP      = loginThrottleKind("ip")
+
+	// loginThrottleKindMFA is counted by the mfa service, keyed by user, for wrong codes
+	loginThrottleKindMFA = loginThrottleKind("mfa")
+)
+
+// LoginThrottledError is returned when a login is attempted too soon after failed attempts.
+// It matches ErrRateLimited while logins are delayed, and ErrLockedOut once there were too many
+// failures.
+type LoginThrottledError struct {
+	// RetryAfter is how long until another attempt is allowed
+	RetryAfter time.Duration
+
+	Locked bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return ErrLockedOut.Error()
+	}
+	return ErrRateLimited.Error()
+}
+
+func (e *LoginThrottledError) Is(target error) bool {
+	if e.Locked {
+		return target == ErrLockedOut
+	}
+	return target == ErrRateLimited
+}
+
+// LoginAttempt is a password login being throttled, from StartLoginAttempt
+type LoginAttempt struct {
+	// userId is empty when the login doesn't match a user
+	userId string
+
+	accountKey string
+	ip         string
+}
+
+// UserId is the user the login matches, empty if it doesn't match one
+func (l *LoginAttempt) UserId() string {
+	return l.userId
+}
+
+// loginThrottle is the failed login count for an account or IP address
+type loginThrottle struct {
+	failedAttempts int
+	lastFailedAt   time.Time
+	lockedUntil    *time.Time
+}
+
+// retryAfter is how long until another attempt is allowed, zero if one is allowed now
+func (t *loginThrottle) retryAfter(now time.Time) (time.Duration, bool) {
+	if t.lockedUntil != nil && now.Before(*t.lockedUntil) {
+		return t.lockedUntil.Sub(now), true
+	}
+
+	if now.Sub(t.lastFailedAt) >= loginThrottleWindow || t.failedAttempts < loginFreeAttempts {
+		return 0, false
+	}
+
+	delay := loginMaxDelay
+	if shift := t.failedAttempts - loginFreeAttempts; shift < 8 {
+		delay = min(time.Second<<shift, loginMaxDelay)
+	}
+
+	if nextAttempt := t.lastFailedAt.Add(delay); now.Before(nextAttempt) {
+		return nextAttempt.Sub(now), false
+	}
+
+	return 0, false
+}
+
+// StartLoginAttempt checks a password login from the IP address isn't throttled before the
+// password is checked. Returns a *LoginThrottledError if the account or the IP address has
+// failed too many logins recently. The IP address is optional.
+//
+// Logins that don't match a user are throttled the same as ones that do.
+func (s *Service) StartLoginAttempt(ctx context.Context, login, ip string) (LoginAttempt, error) {
+	if s.db == nil {
+		return LoginAttempt{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(login) == "" {
+		return LoginAttempt{}, ErrInvalidArg
+	}
+
+	attempt := LoginAttempt{
+		ip: strings.TrimSpace(ip),
+	}
+
+	userQuery := `
+	SELECT
+		u.id
+	FROM users u
+	WHERE u.username = $1 OR u.email = $1`
+
+	row := s.db.QueryRow(ctx, userQuery, login)
+	if err := row.Scan(&attempt.userId); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return LoginAttempt{}, fmt.Errorf("failed to query for user: %w", err)
+		}
+	}
+
+	// throttle by user so a username and email can't be alternated to get twice the attempts
+	attempt.accountKey = attempt.userId
+	if attempt.accountKey == "" {
+		attempt.accountKey = strings.ToLower(strings.TrimSpace(login))
+	}
+
+	now := time.Now().UTC()
+
+	var throttled *LoginThrottledError
+	for _, k := range attempt.throttleKeys() {
+		throttle, err := s.getLoginThrottle(ctx, k.kind, k.key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return LoginAttempt{}, err
+		}
+
+		retryAfter, locked := throttle.retryAfter(now)
+		if retryAfter <= 0 {
+			continue
+		}
+
+		if throttled == nil || (locked && !throttled.Locked) ||
+			(locked == throttled.Locked && retryAfter > throttled.RetryAfter) {
+			throttled = &LoginThrottledError{
+				RetryAfter: retryAfter,
+				Locked:     locked,
+			}
+		}
+	}
+
+	if throttled != nil {
+		return LoginAttempt{}, throttled
+	}
+
+	return attempt, nil
+}
+
+type loginThrottleKey struct {
+	kind loginThrottleKind
+	key  string
+}
+
+// throttleKeys are what the attempt is throttled by, its account and IP address
+func (l *LoginAttempt) throttleKeys() []loginThrottleKey {
+	keys := []loginThrottleKey{
+		{kind: loginThrottleKindAccount, key: l.accountKey},
+	}
+	if l.ip != "" {
+		keys = append(keys, loginThrottleKey{kind: loginThrottleKindIP, key: l.ip})
+	}
+	return keys
+}
+
+func (s *Service) getLoginThrottle(ctx context.Context, kind loginThrottleKind, key string) (loginThrottle, error) {
+	query := `
+	SELECT
+		lt.failed_attempts,
+		lt.last_failed_at,
+		lt.locked_until
+	FROM login_throttles lt
+	WHERE
+		lt.kind = $1 AND
+		lt.key = $2`
+
+	var throttle loginThrottle
+	row := s.db.QueryRow(ctx, query, string(kind), key)
+	if err := row.Scan(&throttle.failedAttempts, &throttle.lastFailedAt, &throttle.lockedUntil); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return loginThrottle{}, ErrNotFound
+		}
+		return loginThrottle{}, fmt.Errorf("failed to query for login throttle: %w", err)
+	}
+
+	return throttle, nil
+}
+
+// FailLoginAttempt records that the attempt's password was wrong. Returns true if this failure
+// locked the attempt's user out, so they can be told.
+func (s *Service) FailLoginAttempt(ctx context.Context, attempt LoginAttempt) (bool, error) {
+	if s.db == nil {
+		return false, ErrMissingRequiredConfiguration
+	}
+
+	if attempt.accountKey == "" {
+		return false, ErrInvalidArg
+	}
+
+	now := time.Now().UTC()
+
+	var accountLocked bool
+	for _, k := range attempt.throttleKeys() {
+		lockoutFailures := loginAccountLockoutFailures
+		if k.kind == loginThrottleKindIP {
+			lockoutFailures = loginIPLockoutFailures
+		}
+
+		locked, err := s.recordLoginFailure(ctx, k.kind, k.key, lockoutFailures, now)
+		if err != nil {
+			return false, err
+		}
+
+		if k.kind == loginThrottleKindAccount {
+			accountLocked = locked
+		}
+	}
+
+	return accountLocked && attempt.userId != "", nil
+}
+
+// recordLoginFailure counts a failure and locks the account or IP address once there are
+// lockoutFailures in the window. Returns true if this failure locked it.
+func (s *Service) recordLoginFailure(ctx context.Context, kind loginThrottleKind, key string, lockoutFailures int,
+	now time.Time) (bool, error) {
+	query := `
+	INSERT INTO login_throttles (kind, key, failed_attempts, last_failed_at)
+	VALUES ($1, $2, 1, $3)
+	ON CONFLICT (kind, key) DO UPDATE SET
+		failed_attempts = CASE
+			WHEN login_throttles.last_failed_at <= $4 THEN 1
+			ELSE login_throttles.failed_attempts + 1
+		END,
+		last_failed_at = $3,
+		updated_at = NOW()
+	RETURNING failed_attempts`
+
+	var failedAttempts int
+	row := s.db.QueryRow(ctx, query, string(kind), key, now, now.Add(-loginThrottleWindow))
+	if err := row.Scan(&failedAttempts); err != nil {
+		return false, fmt.Errorf("failed to record failed login: %w", err)
+	}
+
+	if failedAttempts < lockoutFailures {
+		return false, nil
+	}
+
+	// only the failure that takes the lock reports it, concurrent failures find it locked
+	lockQuery := `
+	UPDATE login_throttles SET
+		locked_until = $3,
+		updated_at = NOW()
+	WHERE
+		kind = $1 AND
+		key = $2 AND
+		(locked_until IS NULL OR locked_until <= $4)`
+
+	tag, err := s.db.Exec(ctx, lockQuery, string(kind), key, now.Add(loginLockoutLength), now)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// SucceedLoginAttempt clears the failed logins of the attempt's user. Failures from the IP
+// address are kept, so one valid account can't be used to reset them, and so are wrong MFA
+// codes, so the password can't be used to reset those.
+func (s *Service) SucceedLoginAttempt(ctx context.Context, attempt LoginAttempt) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if attempt.userId == "" {
+		return ErrInvalidArg
+	}
+
+	return s.deleteLoginThrottles(ctx, attempt.userId, loginThrottleKindAccount)
+}
+
+// UnlockUser clears the user's failed logins and wrong MFA codes, lifting any lockout. Unlocking
+// a user that isn't locked is not an error.
+func (s *Service) UnlockUser(ctx context.Context, userId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return ErrInvalidArg
+	}
+
+	return s.deleteLoginThrottles(ctx, strings.TrimSpace(userId), loginThrottleKindAccount, loginThrottleKindMFA)
+}
+
+// deleteLoginThrottles deletes the user's throttles of the kinds
+func (s *Service) deleteLoginThrottles(ctx context.Context, userId string, kinds ...loginThrottleKind) error {
+	var kindArgs = make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		kindArgs = append(kindArgs, string(kind))
+	}
+
+	query := `
+	DELETE FROM login_throttles
+	WHERE
+		kind = ANY($1) AND
+		key = $2`
+
+	if _, err := s.db.Exec(ctx, query, kindArgs, userId); err != nil {
+		return fmt.Errorf("failed to delete login throttle: %w", err)
+	}
+
+	return nil
+}
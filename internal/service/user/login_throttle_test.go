@@ -0,0 +1,342 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	loginUserQuery     = "SELECT u.id FROM users u WHERE u.username = $1 OR u.email = $1"
+	loginThrottleQuery = "SELECT lt.failed_attempts, lt.last_failed_at, lt.locked_until FROM login_throttles lt WHERE lt.kind = $1 AND lt.key = $2"
+)
+
+var loginThrottleColumns = []string{"failed_attempts", "last_failed_at", "locked_until"}
+
+func TestStartLoginAttempt(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testIP := "203.0.113.7"
+
+	tests := []struct {
+		name   string
+		login  string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr    error
+		expectedLocked bool
+		expectedUserId string
+	}{
+		{
+			name:        "InvalidArg",
+			login:       " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:  "NoFailures",
+			login: "Username",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(loginUserQuery).WithArgs("Username").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
+				db.ExpectQuery(loginThrottleQuery).WithArgs("account", testUserId).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectQuery(loginThrottleQuery).WithArgs("ip", testIP).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			expectedUserId: testUserId,
+		},
+		{
+			name:  "Delayed",
+			login: "Username",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(loginUserQuery).WithArgs("Username").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
+				db.ExpectQuery(loginThrottleQuery).WithArgs("account", testUserId).
+					WillReturnRows(pgxmock.NewRows(loginThrottleColumns).
+						AddRow(5, time.Now().UTC(), nil))
+				db.ExpectQuery(loginThrottleQuery).WithArgs("ip", testIP).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			expectedErr: user.ErrRateLimited,
+		},
+		{
+			name:  "DelayOver",
+			login: "Username",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(loginUserQuery).WithArgs("Username").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
+				db.ExpectQuery(loginThrottleQuery).WithArgs("account", testUserId).
+					WillReturnRows(pgxmock.NewRows(loginThrottleColumns).
+						AddRow(5, time.Now().UTC().Add(-time.Minute), nil))
+				db.ExpectQuery(loginThrottleQuery).WithArgs("ip", testIP).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			expectedUserId: testUserId,
+		},
+		{
+			name:  "UnknownUserLocked",
+			login: "Nobody",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				lockedUntil := time.Now().UTC().Add(10 * time.Minute)
+				db.ExpectQuery(loginUserQuery).WithArgs("Nobody").
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectQuery(loginThrottleQuery).WithArgs("account", "nobody").
+					WillReturnRows(pgxmock.NewRows(loginThrottleColumns).
+						AddRow(10, time.Now().UTC(), &lockedUntil))
+				db.ExpectQuery(loginThrottleQuery).WithArgs("ip", testIP).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			expectedErr:    user.ErrLockedOut,
+			expectedLocked: true,
+		},
+		{
+			name:  "IPLocked",
+			login: "Username",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				lockedUntil := time.Now().UTC().Add(10 * time.Minute)
+				db.ExpectQuery(loginUserQuery).WithArgs("Username").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
+				db.ExpectQuery(loginThrottleQuery).WithArgs("account", testUserId).
+					WillReturnRows(pgxmock.NewRows(loginThrottleColumns).
+						AddRow(4, time.Now().UTC(), nil))
+				db.ExpectQuery(loginThrottleQuery).WithArgs("ip", testIP).
+					WillReturnRows(pgxmock.NewRows(loginThrottleColumns).
+						AddRow(50, time.Now().UTC(), &lockedUntil))
+			},
+			expectedErr:    user.ErrLockedOut,
+			expectedLocked: true,
+		},
+		{
+			name:  "DbError",
+			login: "Username",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(loginUserQuery).WithArgs("Username").
+					WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to query for user: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			attempt, err := service.StartLoginAttempt(context.TODO(), test.login, testIP)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				if errors.Is(test.expectedErr, user.ErrRateLimited) || errors.Is(test.expectedErr, user.ErrLockedOut) {
+					var throttled *user.LoginThrottledError
+					require.ErrorAs(t, err, &throttled)
+					require.ErrorIs(t, err, test.expectedErr)
+					require.Equal(t, test.expectedLocked, throttled.Locked)
+					require.Positive(t, throttled.RetryAfter)
+				} else if !errors.Is(err, test.expectedErr) {
+					require.Equal(t, test.expectedErr.Error(), err.Error())
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expectedUserId, attempt.UserId())
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestFailLoginAttempt(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	failureQuery := "INSERT INTO login_throttles (kind, key, failed_attempts, last_failed_at) VALUES ($1, $2, 1, $3) " +
+		"ON CONFLICT (kind, key) DO UPDATE SET failed_attempts = CASE WHEN login_throttles.last_failed_at <= $4 THEN 1 " +
+		"ELSE login_throttles.failed_attempts + 1 END, last_failed_at = $3, updated_at = NOW() RETURNING failed_attempts"
+	lockQuery := "UPDATE login_throttles SET locked_until = $3, updated_at = NOW() WHERE kind = $1 AND key = $2 AND " +
+		"(locked_until IS NULL OR locked_until <= $4)"
+
+	tests := []struct {
+		name   string
+		login  string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedLocked bool
+	}{
+		{
+			name:  "BelowLockout",
+			login: "Username",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(failureQuery).WithArgs("account", testUserId, pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"failed_attempts"}).AddRow(9))
+			},
+			expectedLocked: false,
+		},
+		{
+			name:  "Locks",
+			login: "Username",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(failureQuery).WithArgs("account", testUserId, pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"failed_attempts"}).AddRow(10))
+				db.ExpectExec(lockQuery).WithArgs("account", testUserId, pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+			expectedLocked: true,
+		},
+		{
+			name:  "AlreadyLocked",
+			login: "Username",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(failureQuery).WithArgs("account", testUserId, pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"failed_attempts"}).AddRow(11))
+				db.ExpectExec(lockQuery).WithArgs("account", testUserId, pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			expectedLocked: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			// the attempt comes from StartLoginAttempt, without an IP address
+			db.ExpectQuery(loginUserQuery).WithArgs(test.login).
+				WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
+			db.ExpectQuery(loginThrottleQuery).WithArgs("account", testUserId).
+				WillReturnError(pgx.ErrNoRows)
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			attempt, err := service.StartLoginAttempt(context.TODO(), test.login, "")
+			require.NoError(t, err)
+
+			locked, err := service.FailLoginAttempt(context.TODO(), attempt)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedLocked, locked)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	query := "DELETE FROM login_throttles WHERE kind = ANY($1) AND key = $2"
+
+	tests := []struct {
+		name   string
+		userId string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			userId:      " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			// wrong MFA codes are cleared along with failed logins
+			name:   "Unlocked",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs([]string{"account", "mfa"}, testUserId).
+					WillReturnResult(pgxmock.NewResult("DELETE", 2))
+			},
+		},
+		{
+			name:   "DbError",
+			userId: testUserId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).WithArgs([]string{"account", "mfa"}, testUserId).
+					WillReturnError(errors.New("fake db error"))
+			},
+			expectedErr: errors.New("failed to delete login throttle: fake db error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			err = service.UnlockUser(context.TODO(), test.userId)
+			if test.expectedErr != nil {
+				require.Error(t, err)
+				if !errors.Is(err, test.expectedErr) {
+					require.Equal(t, test.expectedErr.Error(), err.Error())
+				}
+			} else {
+				require.NoError(t, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSucceedLoginAttempt(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("failed to create new test postgres db: %v", err)
+	}
+	defer db.Close(context.Background())
+
+	db.ExpectQuery(loginUserQuery).WithArgs("Username").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
+	db.ExpectQuery(loginThrottleQuery).WithArgs("account", testUserId).
+		WillReturnError(pgx.ErrNoRows)
+	// wrong MFA codes are kept, the password alone can't reset them
+	db.ExpectExec("DELETE FROM login_throttles WHERE kind = ANY($1) AND key = $2").
+		WithArgs([]string{"account"}, testUserId).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	service, err := user.NewService(user.ServiceConfig{
+		DB:              db,
+		RandomGenerator: &fakeRandomService{},
+	})
+	require.NoError(t, err)
+
+	attempt, err := service.StartLoginAttempt(context.TODO(), "Username", "")
+	require.NoError(t, err)
+
+	require.NoError(t, service.SucceedLoginAttempt(context.TODO(), attempt))
+	require.NoError(t, db.ExpectationsWereMet())
+}
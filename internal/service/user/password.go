@@ -0,0 +1,166 @@
+package user
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2Params are the cost parameters of an argon2 hash. They're stored with every hash, so
+// they can be raised without breaking existing passwords.
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	keyLength   uint32
+}
+
+// currentPasswordParams are used for every new hash. Hashes made with anything else are
+// upgraded the next time the user logs in.
+var currentPasswordParams = argon2Params{
+	memory:      64 * 1024,
+	iterations:  3,
+	parallelism: 4,
+	keyLength:   32,
+}
+
+// legacyPasswordParams are the parameters of hashes from before hashes were stored in PHC
+// format. Those are argon2i hashes, base64 encoded without the parameters, with the salt in its
+// own column.
+var legacyPasswordParams = argon2Params{
+	memory:      64 * 1024,
+	iterations:  1,
+	parallelism: 4,
+	keyLength:   32,
+}
+
+const (
+	phcArgon2id = "argon2id"
+	phcArgon2i  = "argon2i"
+)
+
+var errInvalidPasswordHash = errors.New("invalid password hash")
+
+// hashPassword hashes the password with the current parameters and a new random salt. The
+// result is a PHC string, ex. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func (s *Service) hashPassword(password string) (string, error) {
+	salt := make([]byte, s.saltLength)
+	if _, err := io.ReadFull(s.saltReader, salt); err != nil {
+		return "", fmt.Errorf("failed to read salt: %w", err)
+	}
+
+	return encodePasswordHash(password, salt, currentPasswordParams), nil
+}
+
+func encodePasswordHash(password string, salt []byte, p argon2Params) string {
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, p.keyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", phcArgon2id, argon2.Version, p.memory, p.iterations,
+		p.parallelism, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// legacyPasswordHash is how passwords were hashed before PHC strings. It's only used to check
+// hashes that haven't been upgraded yet.
+func legacyPasswordHash(password, salt string) string {
+	p := legacyPasswordParams
+	key := argon2.Key([]byte(password), []byte(salt), p.iterations, p.memory, p.parallelism, p.keyLength)
+	return base64.RawStdEncoding.EncodeToString(key)
+}
+
+// verifyPassword checks the password against a stored hash, either a PHC string or a legacy
+// hash with its salt. Returns true if the password matches, and true if the hash should be
+// replaced because it doesn't use the current parameters.
+func verifyPassword(password, storedHash, legacySalt string) (bool, bool, error) {
+	if !strings.HasPrefix(storedHash, "$") {
+		providedHash := legacyPasswordHash(password, legacySalt)
+		return subtle.ConstantTimeCompare([]byte(providedHash), []byte(storedHash)) == 1, true, nil
+	}
+
+	algorithm, params, salt, key, err := decodePasswordHash(storedHash)
+	if err != nil {
+		return false, false, err
+	}
+
+	var providedKey []byte
+	switch algorithm {
+	case phcArgon2id:
+		providedKey = argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism,
+			params.keyLength)
+	case phcArgon2i:
+		providedKey = argon2.Key([]byte(password), salt, params.iterations, params.memory, params.parallelism,
+			params.keyLength)
+	}
+
+	if subtle.ConstantTimeCompare(providedKey, key) != 1 {
+		return false, false, nil
+	}
+
+	return true, algorithm != phcArgon2id || params != currentPasswordParams, nil
+}
+
+// decodePasswordHash parses an argon2 PHC string
+func decodePasswordHash(hash string) (string, argon2Params, []byte, []byte, error) {
+	// "", algorithm, version, parameters, salt, hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return "", argon2Params{}, nil, nil, errInvalidPasswordHash
+	}
+
+	algorithm := parts[1]
+	if algorithm != phcArgon2id && algorithm != phcArgon2i {
+		return "", argon2Params{}, nil, nil, fmt.Errorf("%w: unsupported algorithm %q", errInvalidPasswordHash, algorithm)
+	}
+
+	if parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return "", argon2Params{}, nil, nil, fmt.Errorf("%w: unsupported version %q", errInvalidPasswordHash, parts[2])
+	}
+
+	var params argon2Params
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return "", argon2Params{}, nil, nil, errInvalidPasswordHash
+		}
+
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return "", argon2Params{}, nil, nil, errInvalidPasswordHash
+		}
+
+		switch name {
+		case "m":
+			params.memory = uint32(n)
+		case "t":
+			params.iterations = uint32(n)
+		case "p":
+			if n > 255 {
+				return "", argon2Params{}, nil, nil, errInvalidPasswordHash
+			}
+			params.parallelism = uint8(n)
+		default:
+			return "", argon2Params{}, nil, nil, errInvalidPasswordHash
+		}
+	}
+	if params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return "", argon2Params{}, nil, nil, errInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return "", argon2Params{}, nil, nil, errInvalidPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return "", argon2Params{}, nil, nil, errInvalidPasswordHash
+	}
+	params.keyLength = uint32(len(key))
+
+	return algorithm, params, salt, key, nil
+}
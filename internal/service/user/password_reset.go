@@ -0,0 +1,612 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/hashutil"
+	"github.com/keola-dunn/autolog/internal/random"
+)
+
+var (
+	ErrNotFound = errors.New("the requested resource was not found")
+
+	// ErrIncorrectAnswers is returned when one or more security question answers are wrong
+	ErrIncorrectAnswers = errors.New("one or more answers are incorrect")
+
+	// ErrRateLimited is returned when too many password resets were started recently
+	ErrRateLimited = errors.New("too many attempts, try again later")
+
+	// ErrLockedOut is returned when there were too many wrong answers recently
+	ErrLockedOut = errors.New("too many failed attempts, the account is temporarily locked")
+)
+
+const (
+	// passwordResetQuestionCount is how many of the user's security questions must be answered
+	passwordResetQuestionCount = 2
+
+	// passwordResetChallengeExpiry is how long the user has to answer the questions
+	passwordResetChallengeExpiry = 10 * time.Minute
+
+	// passwordResetTokenExpiry is how long the user has to set a new password once verified
+	passwordResetTokenExpiry = 15 * time.Minute
+
+	// passwordResetWindow is the window the start and failure limits are counted over
+	passwordResetWindow = time.Hour
+
+	// passwordResetMaxStarts is how many resets can be started per login per window
+	passwordResetMaxStarts = 5
+
+	// passwordResetMaxFailures is how many wrong answers lock the login out of resets for the
+	// rest of the window
+	passwordResetMaxFailures = 5
+
+	// maxPasswordResetLoginLength matches password_resets.login
+	maxPasswordResetLoginLength = 256
+
+	passwordResetTokenBytes = 32
+)
+
+type passwordResetStatus string
+
+const (
+	passwordResetStatusPending   = passwordResetStatus("pending")
+	passwordResetStatusVerified  = passwordResetStatus("verified")
+	passwordResetStatusCompleted = passwordResetStatus("completed")
+	passwordResetStatusFailed    = passwordResetStatus("failed")
+)
+
+// PasswordResetChallenge is the set of security questions the user must answer to reset their
+// password
+type PasswordResetChallenge struct {
+	Id        string
+	Questions []SecurityQuestion
+	ExpiresAt time.Time
+}
+
+// StartPasswordReset starts a password reset for the user with the username or email. A random
+// subset of the user's security questions are returned to be answered.
+//
+// Resets are limited by the login before it's looked up, and an unknown login gets a challenge
+// that can never be passed, so neither the response nor the limits reveal which accounts exist.
+func (s *Service) StartPasswordReset(ctx context.Context, login string) (PasswordResetChallenge, error) {
+	if s.db == nil {
+		return PasswordResetChallenge{}, ErrMissingRequiredConfiguration
+	}
+
+	normalizedLogin := normalizePasswordResetLogin(login)
+	if normalizedLogin == "" || len(normalizedLogin) > maxPasswordResetLoginLength {
+		return PasswordResetChallenge{}, ErrInvalidArg
+	}
+
+	if err := s.checkPasswordResetLimits(ctx, normalizedLogin, true); err != nil {
+		return PasswordResetChallenge{}, err
+	}
+
+	userQuery := `
+	SELECT 
+		u.id
+	FROM users u
+	WHERE u.username = $1 OR u.email = $1`
+
+	var userId string
+	row := s.db.QueryRow(ctx, userQuery, strings.TrimSpace(login))
+	if err := row.Scan(&userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.decoyPasswordResetChallenge(ctx, normalizedLogin)
+		}
+		return PasswordResetChallenge{}, fmt.Errorf("failed to query for user: %w", err)
+	}
+
+	questionsQuery := `
+	SELECT 
+		sq.id,
+		sq.question,
+		sq.created_at
+	FROM users_security_questions usq
+	JOIN security_questions sq ON sq.id = usq.question_id
+	WHERE usq.user_id = $1`
+
+	questions, err := s.querySecurityQuestions(ctx, questionsQuery, userId)
+	if err != nil {
+		return PasswordResetChallenge{}, fmt.Errorf("failed to query for user security questions: %w", err)
+	}
+
+	if len(questions) == 0 {
+		// nothing to verify the user with
+		return s.decoyPasswordResetChallenge(ctx, normalizedLogin)
+	}
+
+	return s.createPasswordReset(ctx, &userId, normalizedLogin, questions)
+}
+
+// decoyPasswordResetChallenge is returned for unknown logins. It's stored without a user, so
+// answering it always fails but counts towards the login's limits like any other reset. Its
+// questions are picked from the login, so every reset for the login shows the same ones.
+func (s *Service) decoyPasswordResetChallenge(ctx context.Context, login string) (PasswordResetChallenge, error) {
+	questions, err := s.GetSecurityQuestions(ctx)
+	if err != nil {
+		return PasswordResetChallenge{}, fmt.Errorf("failed to get security questions: %w", err)
+	}
+
+	return s.createPasswordReset(ctx, nil, login, decoyQuestions(questions, login, s.passwordResetDecoySecret))
+}
+
+// createPasswordReset stores a reset challenge for a random subset of the questions. userId is
+// nil for a decoy.
+func (s *Service) createPasswordReset(ctx context.Context, userId *string, login string,
+	questions []SecurityQuestion) (PasswordResetChallenge, error) {
+	questions = randomQuestions(questions, passwordResetQuestionCount)
+
+	var questionIds = make([]string, 0, len(questions))
+	for _, q := range questions {
+		questionIds = append(questionIds, q.Id)
+	}
+
+	challenge := PasswordResetChallenge{
+		Questions: questions,
+		ExpiresAt: s.calendarService.NowUTC().Add(passwordResetChallengeExpiry),
+	}
+
+	insertQuery := `
+	INSERT INTO password_resets (user_id, login, question_ids, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id`
+
+	row := s.db.QueryRow(ctx, insertQuery, userId, login, questionIds, challenge.ExpiresAt)
+	if err := row.Scan(&challenge.Id); err != nil {
+		return PasswordResetChallenge{}, fmt.Errorf("failed to insert password reset: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// decoyQuestions picks as many questions as a user has, ordered by an HMAC of the login and
+// each question, so the same login always gets the same questions
+func decoyQuestions(questions []SecurityQuestion, login string, secret []byte) []SecurityQuestion {
+	type rankedQuestion struct {
+		question SecurityQuestion
+		rank     []byte
+	}
+
+	ranked := make([]rankedQuestion, 0, len(questions))
+	for _, q := range questions {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(login))
+		mac.Write([]byte{0})
+		mac.Write([]byte(q.Id))
+		ranked = append(ranked, rankedQuestion{question: q, rank: mac.Sum(nil)})
+	}
+
+	slices.SortFunc(ranked, func(a, b rankedQuestion) int {
+		return bytes.Compare(a.rank, b.rank)
+	})
+
+	if len(ranked) > minSecurityQuestions {
+		ranked = ranked[:minSecurityQuestions]
+	}
+
+	var picked = make([]SecurityQuestion, 0, len(ranked))
+	for _, r := range ranked {
+		picked = append(picked, r.question)
+	}
+	return picked
+}
+
+// normalizePasswordResetLogin is the login resets are limited by. Usernames and emails are
+// limited separately, so a user's resets are limited by twice the limits at most.
+func normalizePasswordResetLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
+
+// randomQuestions returns count questions picked at random
+func randomQuestions(questions []SecurityQuestion, count int) []SecurityQuestion {
+	shuffled := make([]SecurityQuestion, len(questions))
+	copy(shuffled, questions)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	if len(shuffled) > count {
+		shuffled = shuffled[:count]
+	}
+	return shuffled
+}
+
+func (s *Service) querySecurityQuestions(ctx context.Context, query string, args ...any) ([]SecurityQuestion, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for questions: %w", err)
+	}
+	defer rows.Close()
+
+	var questions = []SecurityQuestion{}
+	for rows.Next() {
+		var q SecurityQuestion
+		if err := rows.Scan(&q.Id, &q.Question, &q.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan question row as expected: %w", err)
+		}
+		questions = append(questions, q)
+	}
+
+	return questions, nil
+}
+
+// checkPasswordResetLimits returns ErrLockedOut if the login has too many wrong answers in the
+// current window, and ErrRateLimited if starting is true and too many resets were started.
+func (s *Service) checkPasswordResetLimits(ctx context.Context, login string, starting bool) error {
+	query := `
+	SELECT 
+		COUNT(*),
+		COALESCE(SUM(pr.failed_attempts), 0)
+	FROM password_resets pr
+	WHERE 
+		pr.login = $1 AND 
+		pr.created_at > $2`
+
+	var starts, failures int64
+	row := s.db.QueryRow(ctx, query, login, s.calendarService.NowUTC().Add(-passwordResetWindow))
+	if err := row.Scan(&starts, &failures); err != nil {
+		return fmt.Errorf("failed to query for recent password resets: %w", err)
+	}
+
+	if failures >= passwordResetMaxFailures {
+		return ErrLockedOut
+	}
+
+	if starting && starts >= passwordResetMaxStarts {
+		return ErrRateLimited
+	}
+
+	return nil
+}
+
+type PasswordResetToken struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// AnswerPasswordResetChallenge checks the answers to the challenge's questions. Every question
+// must be answered correctly to get a reset token. Returns ErrIncorrectAnswers for wrong
+// answers, or an unknown or expired challenge, and ErrLockedOut once there have been too many
+// wrong answers.
+func (s *Service) AnswerPasswordResetChallenge(ctx context.Context, challengeId string, answers []UserSecurityQuestion) (PasswordResetToken, error) {
+	if s.db == nil {
+		return PasswordResetToken{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(challengeId) == "" || len(answers) == 0 {
+		return PasswordResetToken{}, ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return PasswordResetToken{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT 
+		COALESCE(pr.user_id::text, ''),
+		COALESCE(pr.login, ''),
+		pr.question_ids::text[],
+		pr.status,
+		pr.expires_at
+	FROM password_resets pr
+	WHERE pr.id::text = $1
+	FOR UPDATE`
+
+	var userId, login string
+	var questionIds []string
+	var status string
+	var expiresAt time.Time
+	row := tx.QueryRow(ctx, query, strings.TrimSpace(challengeId))
+	if err := row.Scan(&userId, &login, &questionIds, &status, &expiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PasswordResetToken{}, ErrIncorrectAnswers
+		}
+		return PasswordResetToken{}, fmt.Errorf("failed to query for password reset: %w", err)
+	}
+
+	if passwordResetStatus(status) != passwordResetStatusPending || s.calendarService.NowUTC().After(expiresAt) {
+		return PasswordResetToken{}, ErrIncorrectAnswers
+	}
+
+	if err := s.checkPasswordResetLimits(ctx, login, false); err != nil {
+		return PasswordResetToken{}, err
+	}
+
+	// decoys don't have a user, their answers are always wrong
+	var correct bool
+	if userId != "" {
+		correct, err = s.checkSecurityQuestionAnswers(ctx, tx, userId, questionIds, answers)
+		if err != nil {
+			return PasswordResetToken{}, fmt.Errorf("failed to check answers: %w", err)
+		}
+	}
+
+	if !correct {
+		failQuery := `
+		UPDATE password_resets SET
+			failed_attempts = failed_attempts + 1,
+			status = CASE WHEN failed_attempts + 1 >= $2 THEN 'failed' ELSE status END,
+			updated_at = NOW()
+		WHERE id = $1`
+
+		if _, err := tx.Exec(ctx, failQuery, strings.TrimSpace(challengeId), passwordResetMaxFailures); err != nil {
+			return PasswordResetToken{}, fmt.Errorf("failed to record failed attempt: %w", err)
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return PasswordResetToken{}, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		return PasswordResetToken{}, ErrIncorrectAnswers
+	}
+
+	token, err := random.SecureToken(passwordResetTokenBytes)
+	if err != nil {
+		return PasswordResetToken{}, fmt.Errorf("failed to generate reset token: %w", err)
+	}
+
+	resetToken := PasswordResetToken{
+		Token:     token,
+		ExpiresAt: s.calendarService.NowUTC().Add(passwordResetTokenExpiry),
+	}
+
+	verifiedQuery := `
+	UPDATE password_resets SET
+		status = $2,
+		reset_token_hash = $3,
+		reset_token_expires_at = $4,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, verifiedQuery, strings.TrimSpace(challengeId), passwordResetStatusVerified,
+		hashutil.SHA256Hex(token), resetToken.ExpiresAt); err != nil {
+		return PasswordResetToken{}, fmt.Errorf("failed to update password reset: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return PasswordResetToken{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return resetToken, nil
+}
+
+// checkSecurityQuestionAnswers checks that every question is answered correctly. Each stored
+// answer is compared in constant time, and every answer is hashed even once one is wrong.
+// Answers hashed as they were typed, or with older parameters, are rehashed normalized once
+// they're all correct.
+func (s *Service) checkSecurityQuestionAnswers(ctx context.Context, tx pgx.Tx, userId string,
+	questionIds []string, answers []UserSecurityQuestion) (bool, error) {
+	query := `
+	SELECT 
+		usq.question_id,
+		usq.answer_hash,
+		usq.salt,
+		usq.answer_normalized
+	FROM users_security_questions usq
+	WHERE 
+		usq.user_id = $1 AND 
+		usq.question_id::text = ANY($2)`
+
+	rows, err := tx.Query(ctx, query, userId, questionIds)
+	if err != nil {
+		return false, fmt.Errorf("failed to query for user security questions: %w", err)
+	}
+	defer rows.Close()
+
+	type storedAnswer struct {
+		hash       string
+		salt       string
+		normalized bool
+	}
+	var stored = make(map[string]storedAnswer, len(questionIds))
+	for rows.Next() {
+		var questionId string
+		var a storedAnswer
+		if err := rows.Scan(&questionId, &a.hash, &a.salt, &a.normalized); err != nil {
+			return false, fmt.Errorf("failed to scan user security question row: %w", err)
+		}
+		stored[questionId] = a
+	}
+	rows.Close()
+
+	var provided = make(map[string]string, len(answers))
+	for _, a := range answers {
+		provided[a.QuestionId] = a.Answer
+	}
+
+	correct := len(stored) == len(questionIds)
+	var upgrades []UserSecurityQuestion
+	for _, questionId := range questionIds {
+		answer, ok := provided[questionId]
+		a := stored[questionId]
+
+		if a.normalized {
+			answer = normalizeSecurityAnswer(answer)
+		}
+
+		match, needsUpgrade, err := verifyPassword(answer, a.hash, a.salt)
+		if err != nil {
+			return false, fmt.Errorf("failed to verify security question answer: %w", err)
+		}
+		if !ok || !match {
+			correct = false
+			continue
+		}
+
+		if needsUpgrade || !a.normalized {
+			upgrades = append(upgrades, UserSecurityQuestion{QuestionId: questionId, Answer: answer})
+		}
+	}
+
+	if !correct {
+		return false, nil
+	}
+
+	for _, upgrade := range upgrades {
+		if err := s.upgradeSecurityQuestionAnswer(ctx, tx, userId, upgrade.QuestionId, upgrade.Answer); err != nil {
+			return false, fmt.Errorf("failed to upgrade security question answer: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// upgradeSecurityQuestionAnswer rehashes a correct answer normalized, with the current parameters
+func (s *Service) upgradeSecurityQuestionAnswer(ctx context.Context, tx pgx.Tx, userId, questionId, answer string) error {
+	answerHash, err := s.hashPassword(normalizeSecurityAnswer(answer))
+	if err != nil {
+		return fmt.Errorf("failed to hash security question answer: %w", err)
+	}
+
+	query := `
+	UPDATE users_security_questions SET
+		answer_hash = $3,
+		salt = '',
+		answer_normalized = true
+	WHERE 
+		user_id = $1 AND 
+		question_id::text = $2`
+
+	if _, err := tx.Exec(ctx, query, userId, questionId, answerHash); err != nil {
+		return fmt.Errorf("failed to update user security question answer: %w", err)
+	}
+
+	return nil
+}
+
+// CompletePasswordReset sets a new password using a reset token. The token can only be used
+// once. Returns the user id, so their existing sessions can be revoked, and an error wrapping
+// ErrWeakPassword if the new password isn't strong enough.
+// GetPasswordResetUserId returns the user of a verified, unexpired reset token without using the
+// token, so the user's tokens can be revoked before their password changes. Returns ErrNotFound
+// for unknown and expired reset tokens.
+func (s *Service) GetPasswordResetUserId(ctx context.Context, resetToken string) (string, error) {
+	if s.db == nil {
+		return "", ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(resetToken) == "" {
+		return "", ErrInvalidArg
+	}
+
+	query := `
+	SELECT 
+		pr.user_id
+	FROM password_resets pr
+	WHERE 
+		pr.reset_token_hash = $1 AND 
+		pr.status = $2 AND 
+		pr.reset_token_expires_at > $3`
+
+	var userId string
+	row := s.db.QueryRow(ctx, query, hashutil.SHA256Hex(strings.TrimSpace(resetToken)), passwordResetStatusVerified,
+		s.calendarService.NowUTC())
+	if err := row.Scan(&userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to query for password reset: %w", err)
+	}
+
+	return userId, nil
+}
+
+func (s *Service) CompletePasswordReset(ctx context.Context, resetToken, newPassword string) (string, error) {
+	if s.db == nil {
+		return "", ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(resetToken) == "" || strings.TrimSpace(newPassword) == "" {
+		return "", ErrInvalidArg
+	}
+
+	if err := CheckPasswordStrength(newPassword); err != nil {
+		return "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	SELECT 
+		pr.id,
+		pr.user_id,
+		pr.reset_token_expires_at
+	FROM password_resets pr
+	WHERE 
+		pr.reset_token_hash = $1 AND 
+		pr.status = $2
+	FOR UPDATE`
+
+	var resetId, userId string
+	var expiresAt time.Time
+	row := tx.QueryRow(ctx, query, hashutil.SHA256Hex(strings.TrimSpace(resetToken)), passwordResetStatusVerified)
+	if err := row.Scan(&resetId, &userId, &expiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to query for password reset: %w", err)
+	}
+
+	if s.calendarService.NowUTC().After(expiresAt) {
+		return "", ErrNotFound
+	}
+
+	if err := s.setPassword(ctx, tx, userId, newPassword); err != nil {
+		return "", fmt.Errorf("failed to set password: %w", err)
+	}
+
+	completeQuery := `
+	UPDATE password_resets SET
+		status = $2,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, completeQuery, resetId, passwordResetStatusCompleted); err != nil {
+		return "", fmt.Errorf("failed to complete password reset: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userId, nil
+}
+
+// setPassword hashes the password with a new salt and stores it for the user
+func (s *Service) setPassword(ctx context.Context, tx pgx.Tx, userId, password string) error {
+	passwordHash, err := s.hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// the salt is part of the hash, the salt column is only used by legacy hashes
+	query := `
+	UPDATE users SET
+		salt = $2,
+		password_hash = $3,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, query, userId, "", passwordHash); err != nil {
+		return fmt.Errorf("failed to update user password: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,590 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartPasswordReset(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testChallengeId := "0d0c1bd4-8f63-4a6b-b0a4-53f6f0a3e1c2"
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	limitsQuery := "SELECT COUNT(*), COALESCE(SUM(pr.failed_attempts), 0) FROM password_resets pr WHERE pr.login = $1 AND pr.created_at > $2"
+	userQuery := "SELECT u.id FROM users u WHERE u.username = $1 OR u.email = $1"
+	userQuestionsQuery := "SELECT sq.id, sq.question, sq.created_at FROM users_security_questions usq " +
+		"JOIN security_questions sq ON sq.id = usq.question_id WHERE usq.user_id = $1"
+	insertQuery := "INSERT INTO password_resets (user_id, login, question_ids, expires_at) VALUES ($1, $2, $3, $4) RETURNING id"
+
+	expectLimits := func(db pgxmock.PgxConnIface, login string, starts, failures int64) {
+		db.ExpectQuery(limitsQuery).
+			WithArgs(login, pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"count", "sum"}).AddRow(starts, failures))
+	}
+
+	tests := []struct {
+		name  string
+		login string
+
+		dbFunc      func(db pgxmock.PgxConnIface)
+		expectedErr error
+	}{
+		{
+			name:        "InvalidArg",
+			login:       "  ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			// limits are checked before the login is looked up, so unknown logins are limited too
+			name:  "RateLimited",
+			login: "Unknown@Example.com",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				expectLimits(db, "unknown@example.com", 5, 0)
+			},
+			expectedErr: user.ErrRateLimited,
+		},
+		{
+			name:  "LockedOut",
+			login: "unknown@example.com",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				expectLimits(db, "unknown@example.com", 2, 5)
+			},
+			expectedErr: user.ErrLockedOut,
+		},
+		{
+			name:  "Started",
+			login: " TestUsername ",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				expectLimits(db, "testusername", 1, 0)
+				db.ExpectQuery(userQuery).
+					WithArgs("TestUsername").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
+				db.ExpectQuery(userQuestionsQuery).
+					WithArgs(testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "question", "created_at"}).
+						AddRow("q1", "Question 1", createdAt).
+						AddRow("q2", "Question 2", createdAt).
+						AddRow("q3", "Question 3", createdAt))
+				db.ExpectQuery(insertQuery).
+					WithArgs(pgxmock.AnyArg(), "testusername", pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testChallengeId))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			challenge, err := service.StartPasswordReset(context.TODO(), test.login)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				require.NoError(t, db.ExpectationsWereMet())
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testChallengeId, challenge.Id)
+			require.Len(t, challenge.Questions, 2)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestStartPasswordResetDecoy checks an unknown login is always shown questions from the same
+// three, like a user's own questions, even after the service restarts
+func TestStartPasswordResetDecoy(t *testing.T) {
+	testChallengeId := "0d0c1bd4-8f63-4a6b-b0a4-53f6f0a3e1c2"
+	testLogin := "unknown@example.com"
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	questionsQuery := "SELECT id, question, created_at FROM security_questions WHERE user_id IS NULL AND retired_at IS NULL"
+	insertQuery := "INSERT INTO password_resets (user_id, login, question_ids, expires_at) VALUES ($1, $2, $3, $4) RETURNING id"
+
+	db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("failed to create new test postgres db: %v", err)
+	}
+	defer db.Close(context.Background())
+
+	var shown = map[string]bool{}
+	for i := range 10 {
+		// a new service each time, as if restarted
+		service, err := user.NewService(user.ServiceConfig{
+			DB:                       db,
+			RandomGenerator:          &fakeRandomService{},
+			PasswordResetDecoySecret: []byte("0123456789abcdef0123456789abcdef"),
+		})
+		require.NoError(t, err)
+
+		db.ExpectQuery("SELECT COUNT(*), COALESCE(SUM(pr.failed_attempts), 0) FROM password_resets pr WHERE pr.login = $1 AND pr.created_at > $2").
+			WithArgs(testLogin, pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"count", "sum"}).AddRow(int64(0), int64(0)))
+		db.ExpectQuery("SELECT u.id FROM users u WHERE u.username = $1 OR u.email = $1").
+			WithArgs(testLogin).
+			WillReturnError(pgx.ErrNoRows)
+
+		rows := pgxmock.NewRows([]string{"id", "question", "created_at"})
+		for _, id := range []string{"q1", "q2", "q3", "q4", "q5", "q6", "q7", "q8"} {
+			rows.AddRow(id, "Question "+id, createdAt)
+		}
+		db.ExpectQuery(questionsQuery).WillReturnRows(rows)
+
+		// decoys are stored without a user
+		db.ExpectQuery(insertQuery).
+			WithArgs((*string)(nil), testLogin, pgxmock.AnyArg(), pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testChallengeId))
+
+		challenge, err := service.StartPasswordReset(context.TODO(), testLogin)
+		require.NoError(t, err, "start %d", i)
+		require.Len(t, challenge.Questions, 2)
+
+		for _, q := range challenge.Questions {
+			shown[q.Id] = true
+		}
+	}
+
+	require.LessOrEqual(t, len(shown), 3)
+	require.NoError(t, db.ExpectationsWereMet())
+}
+
+func TestAnswerPasswordResetChallenge(t *testing.T) {
+	testChallengeId := "0d0c1bd4-8f63-4a6b-b0a4-53f6f0a3e1c2"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testQuestionIds := []string{"d7f0b0a5-3a53-4d4e-9d6c-0c1f6e1f7f60", "5b8f3d1e-2f7c-4c0a-8e2b-6a9d4c3b2a10"}
+
+	testLogin := "testusername"
+
+	challengeQuery := "SELECT COALESCE(pr.user_id::text, ''), COALESCE(pr.login, ''), pr.question_ids::text[], pr.status, pr.expires_at " +
+		"FROM password_resets pr WHERE pr.id::text = $1 FOR UPDATE"
+	limitsQuery := "SELECT COUNT(*), COALESCE(SUM(pr.failed_attempts), 0) FROM password_resets pr WHERE pr.login = $1 AND pr.created_at > $2"
+	failQuery := "UPDATE password_resets SET failed_attempts = failed_attempts + 1, status = CASE WHEN failed_attempts + 1 >= $2 THEN 'failed' ELSE status END, updated_at = NOW() WHERE id = $1"
+	answersQuery := "SELECT usq.question_id, usq.answer_hash, usq.salt, usq.answer_normalized FROM users_security_questions usq WHERE usq.user_id = $1 AND usq.question_id::text = ANY($2)"
+	upgradeQuery := "UPDATE users_security_questions SET answer_hash = $3, salt = '', answer_normalized = true WHERE user_id = $1 AND question_id::text = $2"
+
+	expectChallenge := func(db pgxmock.PgxConnIface, status string, expiresAt time.Time) {
+		db.ExpectQuery(challengeQuery).
+			WithArgs(testChallengeId).
+			WillReturnRows(pgxmock.NewRows([]string{"user_id", "login", "question_ids", "status", "expires_at"}).
+				AddRow(testUserId, testLogin, testQuestionIds, status, expiresAt))
+	}
+
+	expectAnswers := func(db pgxmock.PgxConnIface) {
+		db.ExpectQuery(limitsQuery).
+			WithArgs(testLogin, pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"count", "sum"}).AddRow(int64(1), int64(0)))
+
+		db.ExpectQuery(answersQuery).
+			WithArgs(testUserId, testQuestionIds).
+			WillReturnRows(pgxmock.NewRows([]string{"question_id", "answer_hash", "salt", "answer_normalized"}).
+				AddRow(testQuestionIds[0], "m2LHi/PGOgAmCn17BQx8wTp9JZdc8lCBELH2NPsvSVs", "fakerandomstring", false).
+				AddRow(testQuestionIds[1], "m2LHi/PGOgAmCn17BQx8wTp9JZdc8lCBELH2NPsvSVs", "fakerandomstring", false))
+	}
+
+	// the answer "boston", normalized and hashed with a zero salt
+	expectNormalizedAnswers := func(db pgxmock.PgxConnIface) {
+		db.ExpectQuery(limitsQuery).
+			WithArgs(testLogin, pgxmock.AnyArg()).
+			WillReturnRows(pgxmock.NewRows([]string{"count", "sum"}).AddRow(int64(1), int64(0)))
+
+		db.ExpectQuery(answersQuery).
+			WithArgs(testUserId, testQuestionIds).
+			WillReturnRows(pgxmock.NewRows([]string{"question_id", "answer_hash", "salt", "answer_normalized"}).
+				AddRow(testQuestionIds[0], "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$16RFz5nRoH4ZNBZUMXL+hkzTqdLHPXPrKChr937kyQQ", "", true).
+				AddRow(testQuestionIds[1], "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$16RFz5nRoH4ZNBZUMXL+hkzTqdLHPXPrKChr937kyQQ", "", true))
+	}
+
+	expectVerified := func(db pgxmock.PgxConnIface) {
+		db.ExpectExec("UPDATE password_resets SET status = $2, reset_token_hash = $3, reset_token_expires_at = $4, updated_at = NOW() WHERE id = $1").
+			WithArgs(testChallengeId, pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		db.ExpectCommit()
+		db.ExpectRollback()
+	}
+
+	tests := []struct {
+		name    string
+		answers []user.UserSecurityQuestion
+
+		dbFunc        func(db pgxmock.PgxConnIface)
+		expectedToken bool
+		expectedErr   error
+	}{
+		{
+			name:        "InvalidArg",
+			answers:     nil,
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name: "UnknownChallenge",
+			answers: []user.UserSecurityQuestion{
+				{QuestionId: testQuestionIds[0], Answer: "TestPassword"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(testChallengeId).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrIncorrectAnswers,
+		},
+		{
+			// decoys are answered like any other challenge, and the failure counts towards the
+			// login's lockout
+			name: "DecoyChallenge",
+			answers: []user.UserSecurityQuestion{
+				{QuestionId: testQuestionIds[0], Answer: "TestPassword"},
+				{QuestionId: testQuestionIds[1], Answer: "TestPassword"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(challengeQuery).
+					WithArgs(testChallengeId).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "login", "question_ids", "status", "expires_at"}).
+						AddRow("", "unknown@example.com", testQuestionIds, "pending", time.Now().Add(time.Minute)))
+				db.ExpectQuery(limitsQuery).
+					WithArgs("unknown@example.com", pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"count", "sum"}).AddRow(int64(1), int64(0)))
+				db.ExpectExec(failQuery).
+					WithArgs(testChallengeId, 5).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrIncorrectAnswers,
+		},
+		{
+			name: "ExpiredChallenge",
+			answers: []user.UserSecurityQuestion{
+				{QuestionId: testQuestionIds[0], Answer: "TestPassword"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				expectChallenge(db, "pending", time.Now().Add(-time.Minute))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrIncorrectAnswers,
+		},
+		{
+			name: "LockedOut",
+			answers: []user.UserSecurityQuestion{
+				{QuestionId: testQuestionIds[0], Answer: "TestPassword"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				expectChallenge(db, "pending", time.Now().Add(time.Minute))
+				db.ExpectQuery(limitsQuery).
+					WithArgs(testLogin, pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"count", "sum"}).AddRow(int64(2), int64(5)))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrLockedOut,
+		},
+		{
+			name: "IncorrectAnswers",
+			answers: []user.UserSecurityQuestion{
+				{QuestionId: testQuestionIds[0], Answer: "TestPassword"},
+				{QuestionId: testQuestionIds[1], Answer: "WrongAnswer"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				expectChallenge(db, "pending", time.Now().Add(time.Minute))
+				expectAnswers(db)
+				db.ExpectExec(failQuery).
+					WithArgs(testChallengeId, 5).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrIncorrectAnswers,
+		},
+		{
+			name: "MissingAnswer",
+			answers: []user.UserSecurityQuestion{
+				{QuestionId: testQuestionIds[0], Answer: "TestPassword"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				expectChallenge(db, "pending", time.Now().Add(time.Minute))
+				expectAnswers(db)
+				db.ExpectExec(failQuery).
+					WithArgs(testChallengeId, 5).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrIncorrectAnswers,
+		},
+		{
+			name: "Success",
+			answers: []user.UserSecurityQuestion{
+				{QuestionId: testQuestionIds[0], Answer: "TestPassword"},
+				{QuestionId: testQuestionIds[1], Answer: "TestPassword"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				expectChallenge(db, "pending", time.Now().Add(time.Minute))
+				expectAnswers(db)
+				// answers hashed as they were typed are rehashed normalized
+				for _, questionId := range testQuestionIds {
+					db.ExpectExec(upgradeQuery).
+						WithArgs(testUserId, questionId, pgxmock.AnyArg()).
+						WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				}
+				expectVerified(db)
+			},
+			expectedToken: true,
+		},
+		{
+			name: "NormalizedAnswers",
+			answers: []user.UserSecurityQuestion{
+				{QuestionId: testQuestionIds[0], Answer: "Boston"},
+				{QuestionId: testQuestionIds[1], Answer: "  BOSTON \t"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				expectChallenge(db, "pending", time.Now().Add(time.Minute))
+				expectNormalizedAnswers(db)
+				expectVerified(db)
+			},
+			expectedToken: true,
+		},
+		{
+			name: "IncorrectNormalizedAnswers",
+			answers: []user.UserSecurityQuestion{
+				{QuestionId: testQuestionIds[0], Answer: "Boston"},
+				{QuestionId: testQuestionIds[1], Answer: "Bos ton"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				expectChallenge(db, "pending", time.Now().Add(time.Minute))
+				expectNormalizedAnswers(db)
+				db.ExpectExec(failQuery).
+					WithArgs(testChallengeId, 5).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrIncorrectAnswers,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			token, err := service.AnswerPasswordResetChallenge(context.TODO(), testChallengeId, test.answers)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.Equal(t, test.expectedToken, token.Token != "", "tokenComparison")
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetPasswordResetUserId(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	query := "SELECT pr.user_id FROM password_resets pr WHERE pr.reset_token_hash = $1 AND pr.status = $2 " +
+		"AND pr.reset_token_expires_at > $3"
+
+	tests := []struct {
+		name  string
+		token string
+
+		dbFunc         func(db pgxmock.PgxConnIface)
+		expectedUserId string
+		expectedErr    error
+	}{
+		{
+			name:        "InvalidArg",
+			token:       " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			// unknown, expired and already used reset tokens
+			name:  "NotFound",
+			token: "resettoken",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).
+					WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name:  "Found",
+			token: "resettoken",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(query).
+					WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(testUserId))
+			},
+			expectedUserId: testUserId,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			userId, err := service.GetPasswordResetUserId(context.TODO(), test.token)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.Equal(t, test.expectedUserId, userId, "userIdComparison")
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCompletePasswordReset(t *testing.T) {
+	testResetId := "0d0c1bd4-8f63-4a6b-b0a4-53f6f0a3e1c2"
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	resetQuery := "SELECT pr.id, pr.user_id, pr.reset_token_expires_at FROM password_resets pr WHERE pr.reset_token_hash = $1 AND pr.status = $2 FOR UPDATE"
+
+	tests := []struct {
+		name     string
+		token    string
+		password string
+
+		dbFunc         func(db pgxmock.PgxConnIface)
+		expectedUserId string
+		expectedErr    error
+	}{
+		{
+			name:        "InvalidArg",
+			token:       "",
+			password:    "NewPassword",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:        "WeakPassword",
+			token:       "resettoken",
+			password:    "short",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrWeakPassword,
+		},
+		{
+			name:     "UnknownToken",
+			token:    "resettoken",
+			password: "NewPassword",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(resetQuery).
+					WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnError(pgx.ErrNoRows)
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name:     "ExpiredToken",
+			token:    "resettoken",
+			password: "NewPassword",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(resetQuery).
+					WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "reset_token_expires_at"}).
+						AddRow(testResetId, testUserId, time.Now().Add(-time.Minute)))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name:     "Success",
+			token:    "resettoken",
+			password: "TestPassword",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBegin()
+				db.ExpectQuery(resetQuery).
+					WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "reset_token_expires_at"}).
+						AddRow(testResetId, testUserId, time.Now().Add(time.Minute)))
+				db.ExpectExec("UPDATE users SET salt = $2, password_hash = $3, updated_at = NOW() WHERE id = $1").
+					WithArgs(testUserId, "", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$amfAtsMjZrzn7e6EWS+yGCXEVLYdR1BWLfw8DtDa3+I").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectExec("UPDATE password_resets SET status = $2, updated_at = NOW() WHERE id = $1").
+					WithArgs(testResetId, pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedUserId: testUserId,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+				SaltReader:      zeroSaltReader{},
+			})
+			require.NoError(t, err)
+
+			userId, err := service.CompletePasswordReset(context.TODO(), test.token, test.password)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.Equal(t, test.expectedUserId, userId, "userIdComparison")
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package user
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	minPasswordLength = 8
+
+	// maxPasswordLength keeps hashing cheap enough that long passwords can't be used to tie up
+	// the auth server
+	maxPasswordLength = 128
+)
+
+// ErrWeakPassword is returned when a new password doesn't meet the strength rules. The error
+// says which rule it broke, so it can be shown to the user.
+var ErrWeakPassword = errors.New("password is too weak")
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = sync.OnceValue(func() map[string]struct{} {
+	passwords := make(map[string]struct{})
+	for _, line := range strings.Split(commonPasswordsFile, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			passwords[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return passwords
+})
+
+// CheckPasswordStrength checks a new password is long enough, isn't a common password and
+// isn't made from the user's details, like their username or email. Returns an error wrapping
+// ErrWeakPassword if it isn't strong enough.
+func CheckPasswordStrength(password string, userDetails ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < minPasswordLength || strings.TrimSpace(password) == "" {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, minPasswordLength)
+	}
+	if length > maxPasswordLength {
+		return fmt.Errorf("%w: must be at most %d characters", ErrWeakPassword, maxPasswordLength)
+	}
+
+	lower := strings.ToLower(password)
+
+	if strings.Count(lower, lower[:1]) == len(lower) {
+		return fmt.Errorf("%w: must not repeat a single character", ErrWeakPassword)
+	}
+
+	if _, ok := commonPasswords()[lower]; ok {
+		return fmt.Errorf("%w: too common", ErrWeakPassword)
+	}
+
+	for _, detail := range userDetails {
+		detail = strings.ToLower(strings.TrimSpace(detail))
+		// only the mailbox of an email, the domain is often something like gmail
+		if local, _, ok := strings.Cut(detail, "@"); ok {
+			detail = local
+		}
+
+		if len(detail) >= 4 && strings.Contains(lower, detail) {
+			return fmt.Errorf("%w: must not contain your username or email", ErrWeakPassword)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package user_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPasswordStrength(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		userDetails []string
+
+		expectedErr string
+	}{
+		{
+			name:        "TooShort",
+			password:    "abc12",
+			expectedErr: "password is too weak: must be at least 8 characters",
+		},
+		{
+			name:        "Whitespace",
+			password:    "          ",
+			expectedErr: "password is too weak: must be at least 8 characters",
+		},
+		{
+			name:        "TooLong",
+			password:    strings.Repeat("ab", 65),
+			expectedErr: "password is too weak: must be at most 128 characters",
+		},
+		{
+			name:        "RepeatedCharacter",
+			password:    "zzzzzzzzzzzz",
+			expectedErr: "password is too weak: must not repeat a single character",
+		},
+		{
+			name:        "Common",
+			password:    "Password123",
+			expectedErr: "password is too weak: too common",
+		},
+		{
+			name:        "ContainsUsername",
+			password:    "MyUsername2024",
+			userDetails: []string{"username", "someone@example.com"},
+			expectedErr: "password is too weak: must not contain your username or email",
+		},
+		{
+			name:        "ContainsEmail",
+			password:    "someone-likes-cars",
+			userDetails: []string{"username", "Someone@example.com"},
+			expectedErr: "password is too weak: must not contain your username or email",
+		},
+		{
+			name:        "ShortDetailsIgnored",
+			password:    "bob-drives-a-truck",
+			userDetails: []string{"bob", "bob@example.com"},
+		},
+		{
+			name:        "Strong",
+			password:    "correct horse battery staple",
+			userDetails: []string{"username", "someone@example.com"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := user.CheckPasswordStrength(test.password, test.userDetails...)
+			if test.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, user.ErrWeakPassword)
+			require.EqualError(t, err, test.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package user
+
+import (
+	"slices"
+)
+
+// Permission is an action on a resource, checked by the APIs with jwt.RequirePermission
+type Permission string
+
+const (
+	// PermissionCarsRead allows looking up cars and their history
+	PermissionCarsRead = Permission("cars:read")
+
+	// PermissionCarsWrite allows adding, claiming and updating the user's own cars
+	PermissionCarsWrite = Permission("cars:write")
+
+	// PermissionCarsAdmin allows managing any car, including reviewing ownership evidence
+	PermissionCarsAdmin = Permission("cars:admin")
+
+	// PermissionServiceLogsRead allows reading service logs of cars the user can see
+	PermissionServiceLogsRead = Permission("service_logs:read")
+
+	// PermissionServiceLogsWrite allows logging service on the user's own cars
+	PermissionServiceLogsWrite = Permission("service_logs:write")
+
+	// PermissionServiceLogsCertify allows logging service done at a shop on customers' cars
+	PermissionServiceLogsCertify = Permission("service_logs:certify")
+
+	// PermissionServiceLogsAdmin allows managing any service log
+	PermissionServiceLogsAdmin = Permission("service_logs:admin")
+
+	// PermissionShopsRead allows searching for and viewing shops
+	PermissionShopsRead = Permission("shops:read")
+
+	// PermissionShopsWrite allows updating the shops the user works at
+	PermissionShopsWrite = Permission("shops:write")
+
+	// PermissionShopsAdmin allows managing any shop
+	PermissionShopsAdmin = Permission("shops:admin")
+
+	// PermissionImagesRead allows viewing images
+	PermissionImagesRead = Permission("images:read")
+
+	// PermissionImagesWrite allows uploading images and deleting the user's own
+	PermissionImagesWrite = Permission("images:write")
+
+	// PermissionImagesAdmin allows deleting any image
+	PermissionImagesAdmin = Permission("images:admin")
+
+	// PermissionUsersAdmin allows managing users, their roles and the auth server's clients
+	PermissionUsersAdmin = Permission("users:admin")
+
+	// PermissionRolesMechanic allows granting and revoking only the mechanic role, ex. for
+	// autolog-api managing shop employees. No role grants it, it's for service clients.
+	PermissionRolesMechanic = Permission("roles:mechanic")
+
+	// PermissionTokensIntrospect allows introspecting any token, ex. for services verifying
+	// personal access tokens. No role grants it, it's for service clients.
+	PermissionTokensIntrospect = Permission("tokens:introspect")
+)
+
+// servicePermissions are permissions only service clients are granted
+var servicePermissions = []Permission{
+	PermissionRolesMechanic,
+	PermissionTokensIntrospect,
+}
+
+// serviceRolePermissions are the roles services may grant and revoke, and the permission needed
+// for each. Services can't manage any other role.
+var serviceRolePermissions = map[Role]Permission{
+	RoleMechanic: PermissionRolesMechanic,
+}
+
+// rolePermissions is the permission matrix. Users with several roles have every permission of
+// each.
+var rolePermissions = map[Role][]Permission{
+	RoleUser: {
+		PermissionCarsRead,
+		PermissionCarsWrite,
+		PermissionServiceLogsRead,
+		PermissionServiceLogsWrite,
+		PermissionShopsRead,
+		PermissionImagesRead,
+		PermissionImagesWrite,
+	},
+	RoleMechanic: {
+		PermissionCarsRead,
+		PermissionServiceLogsRead,
+		PermissionServiceLogsCertify,
+		PermissionShopsRead,
+		PermissionShopsWrite,
+		PermissionImagesRead,
+		PermissionImagesWrite,
+	},
+	RoleAdmin: {
+		PermissionCarsRead,
+		PermissionCarsWrite,
+		PermissionCarsAdmin,
+		PermissionServiceLogsRead,
+		PermissionServiceLogsWrite,
+		PermissionServiceLogsAdmin,
+		PermissionShopsRead,
+		PermissionShopsAdmin,
+		PermissionImagesRead,
+		PermissionImagesWrite,
+		PermissionImagesAdmin,
+		PermissionUsersAdmin,
+	},
+}
+
+// ValidPermission checks the permission is one of the permissions of the matrix, or a service
+// permission. Service clients may only be granted valid permissions.
+func ValidPermission(permission Permission) bool {
+	if slices.Contains(servicePermissions, permission) {
+		return true
+	}
+
+	for _, permissions := range rolePermissions {
+		if slices.Contains(permissions, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionsForRoles returns the permissions the roles grant, sorted and without duplicates
+func PermissionsForRoles(roles []Role) []Permission {
+	permissions := make([]Permission, 0)
+	for _, role := range roles {
+		permissions = append(permissions, rolePermissions[role]...)
+	}
+
+	slices.Sort(permissions)
+
+	return slices.Compact(permissions)
+}
+
+// ServiceRolePermission returns the permission a service needs to grant or revoke the role. It's
+// false for roles services can't manage.
+func ServiceRolePermission(role Role) (Permission, bool) {
+	permission, ok := serviceRolePermissions[role]
+	return permission, ok
+}
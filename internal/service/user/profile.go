@@ -0,0 +1,211 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/platform/postgres"
+)
+
+// DistanceUnit is how the user wants distances, like mileage, shown
+type DistanceUnit string
+
+const (
+	DistanceUnitMiles      = DistanceUnit("mi")
+	DistanceUnitKilometers = DistanceUnit("km")
+)
+
+// VolumeUnit is how the user wants volumes, like oil capacity, shown
+type VolumeUnit string
+
+const (
+	VolumeUnitGallons = VolumeUnit("gal")
+	VolumeUnitLiters  = VolumeUnit("l")
+)
+
+// NotificationPreferences are the optional emails the user gets. Emails about their account,
+// like password resets, are always sent.
+type NotificationPreferences struct {
+	ServiceReminders bool
+	ProductUpdates   bool
+}
+
+type UnitPreferences struct {
+	Distance DistanceUnit
+	Volume   VolumeUnit
+}
+
+// Profile is who the user is, as shared with apps they log in to
+type Profile struct {
+	Id string
+
+	// Username is empty for users who signed up with an external provider
+	Username string
+	Name     string
+	Email    string
+
+	// EmailVerifiedAt is when the user proved they own the address, nil if they haven't yet
+	EmailVerifiedAt *time.Time
+
+	NotificationPreferences NotificationPreferences
+	UnitPreferences         UnitPreferences
+
+	// DeletionScheduledAt is when the account will be deleted, nil unless the user asked for it
+	DeletionScheduledAt *time.Time
+}
+
+// GetProfile gets the user's profile. Returns ErrNotFound if the user doesn't exist, or has
+// been deleted.
+func (s *Service) GetProfile(ctx context.Context, userId string) (Profile, error) {
+	if s.db == nil {
+		return Profile{}, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return Profile{}, ErrInvalidArg
+	}
+
+	query := `
+	SELECT 
+		u.id,
+		COALESCE(u.username, ''),
+		COALESCE(u.name, ''),
+		COALESCE(u.email, ''),
+		u.email_verified_at,
+		u.notify_service_reminders,
+		u.notify_product_updates,
+		u.distance_unit,
+		u.volume_unit,
+		u.deletion_scheduled_at
+	FROM users u
+	WHERE 
+		u.id = $1 AND 
+		u.deleted_at IS NULL`
+
+	var profile Profile
+	var distanceUnit, volumeUnit string
+	row := s.db.QueryRow(ctx, query, userId)
+	if err := row.Scan(&profile.Id, &profile.Username, &profile.Name, &profile.Email,
+		&profile.EmailVerifiedAt, &profile.NotificationPreferences.ServiceReminders,
+		&profile.NotificationPreferences.ProductUpdates, &distanceUnit, &volumeUnit,
+		&profile.DeletionScheduledAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Profile{}, ErrNotFound
+		}
+		return Profile{}, fmt.Errorf("failed to query for user profile: %w", err)
+	}
+	profile.UnitPreferences.Distance = DistanceUnit(distanceUnit)
+	profile.UnitPreferences.Volume = VolumeUnit(volumeUnit)
+
+	return profile, nil
+}
+
+// UpdateProfileInput is the profile fields to change. Nil fields are left as they are. The
+// email is changed with StartEmailChange, so both addresses confirm it.
+type UpdateProfileInput struct {
+	UserId string
+
+	Name     *string
+	Username *string
+
+	NotificationPreferences *NotificationPreferences
+	UnitPreferences         *UnitPreferences
+}
+
+func (u *UpdateProfileInput) valid() bool {
+	if strings.TrimSpace(u.UserId) == "" {
+		return false
+	}
+
+	if u.Name != nil && len(strings.TrimSpace(*u.Name)) > 256 {
+		return false
+	}
+
+	if u.Username != nil {
+		username := strings.TrimSpace(*u.Username)
+		if username == "" || len(username) > 64 {
+			return false
+		}
+	}
+
+	if u.UnitPreferences != nil {
+		switch u.UnitPreferences.Distance {
+		case DistanceUnitMiles, DistanceUnitKilometers:
+		default:
+			return false
+		}
+
+		switch u.UnitPreferences.Volume {
+		case VolumeUnitGallons, VolumeUnitLiters:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// UpdateProfile changes the user's profile and returns the updated profile. Returns
+// ErrAlreadyExists if the username is taken, and ErrNotFound if the user doesn't exist.
+func (s *Service) UpdateProfile(ctx context.Context, input UpdateProfileInput) (Profile, error) {
+	if s.db == nil {
+		return Profile{}, ErrMissingRequiredConfiguration
+	}
+
+	if !input.valid() {
+		return Profile{}, ErrInvalidArg
+	}
+
+	var name, username *string
+	if input.Name != nil {
+		n := strings.TrimSpace(*input.Name)
+		name = &n
+	}
+	if input.Username != nil {
+		u := strings.TrimSpace(*input.Username)
+		username = &u
+	}
+
+	var serviceReminders, productUpdates *bool
+	if input.NotificationPreferences != nil {
+		serviceReminders = &input.NotificationPreferences.ServiceReminders
+		productUpdates = &input.NotificationPreferences.ProductUpdates
+	}
+
+	var distanceUnit, volumeUnit *string
+	if input.UnitPreferences != nil {
+		d, v := string(input.UnitPreferences.Distance), string(input.UnitPreferences.Volume)
+		distanceUnit, volumeUnit = &d, &v
+	}
+
+	query := `
+	UPDATE users SET
+		name = COALESCE($2, name),
+		username = COALESCE($3, username),
+		notify_service_reminders = COALESCE($4, notify_service_reminders),
+		notify_product_updates = COALESCE($5, notify_product_updates),
+		distance_unit = COALESCE($6, distance_unit),
+		volume_unit = COALESCE($7, volume_unit),
+		updated_at = NOW()
+	WHERE 
+		id = $1 AND 
+		deleted_at IS NULL`
+
+	tag, err := s.db.Exec(ctx, query, strings.TrimSpace(input.UserId), name, username, serviceReminders,
+		productUpdates, distanceUnit, volumeUnit)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			return Profile{}, ErrAlreadyExists
+		}
+		return Profile{}, fmt.Errorf("failed to update user profile: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return Profile{}, ErrNotFound
+	}
+
+	return s.GetProfile(ctx, strings.TrimSpace(input.UserId))
+}
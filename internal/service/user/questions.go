@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -9,19 +10,51 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+var (
+	// ErrInvalidSecurityQuestion is returned when a chosen question doesn't exist, or has been
+	// retired
+	ErrInvalidSecurityQuestion = errors.New("the security question is unknown or retired")
+
+	// ErrTooFewSecurityQuestions is returned when retiring a question would leave too few for new
+	// users to pick from
+	ErrTooFewSecurityQuestions = errors.New("too few security questions would be left to pick from")
+)
+
+const (
+	// minSecurityQuestions is how many questions a user must answer, password resets ask a
+	// random few of them
+	minSecurityQuestions = 3
+	maxSecurityQuestions = 10
+
+	maxSecurityQuestionLength = 256
+	maxSecurityAnswerLength   = 256
+)
+
 type SecurityQuestion struct {
-	Id        string
-	Question  string
+	Id       string
+	Question string
+
+	// Custom is true for a question the user wrote themselves
+	Custom bool
+
+	// RetiredAt is when the question stopped being offered, nil while it's offered
+	RetiredAt *time.Time
+
 	CreatedAt time.Time
 }
 
+// GetSecurityQuestions gets the questions users can pick from. Retired and custom questions
+// aren't included.
 func (s *Service) GetSecurityQuestions(ctx context.Context) ([]SecurityQuestion, error) {
 	query := `
 	SELECT 
 		id,
     	question,
     	created_at
-	FROM security_questions`
+	FROM security_questions
+	WHERE
+		user_id IS NULL AND
+		retired_at IS NULL`
 
 	rows, err := s.db.Query(ctx, query)
 	if err != nil {
@@ -48,11 +81,299 @@ func (s *Service) GetSecurityQuestions(ctx context.Context) ([]SecurityQuestion,
 	return questions, nil
 }
 
+// AddSecurityQuestion adds a question for users to pick from. Returns ErrAlreadyExists if the
+// same question is already offered.
+func (s *Service) AddSecurityQuestion(ctx context.Context, question string) (SecurityQuestion, error) {
+	if s.db == nil {
+		return SecurityQuestion{}, ErrMissingRequiredConfiguration
+	}
+
+	question = strings.TrimSpace(question)
+	if question == "" || len(question) > maxSecurityQuestionLength {
+		return SecurityQuestion{}, ErrInvalidArg
+	}
+
+	query := `
+	INSERT INTO security_questions (question)
+	SELECT $1
+	WHERE NOT EXISTS (
+		SELECT 1
+		FROM security_questions sq
+		WHERE
+			sq.user_id IS NULL AND
+			sq.retired_at IS NULL AND
+			lower(sq.question) = lower($1)
+	)
+	RETURNING id, created_at`
+
+	var q = SecurityQuestion{Question: question}
+	row := s.db.QueryRow(ctx, query, question)
+	if err := row.Scan(&q.Id, &q.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return SecurityQuestion{}, ErrAlreadyExists
+		}
+		return SecurityQuestion{}, fmt.Errorf("failed to insert security question: %w", err)
+	}
+
+	return q, nil
+}
+
+// RetireSecurityQuestion stops offering the question. Users who already answered it keep it
+// until they replace their questions. Returns ErrNotFound if the question isn't offered, and
+// ErrTooFewSecurityQuestions if too few would be left.
+func (s *Service) RetireSecurityQuestion(ctx context.Context, questionId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(questionId) == "" {
+		return ErrInvalidArg
+	}
+
+	countQuery := `
+	SELECT
+		COUNT(*) FILTER (WHERE sq.id::text = $1),
+		COUNT(*)
+	FROM security_questions sq
+	WHERE
+		sq.user_id IS NULL AND
+		sq.retired_at IS NULL`
+
+	var matching, offered int64
+	row := s.db.QueryRow(ctx, countQuery, questionId)
+	if err := row.Scan(&matching, &offered); err != nil {
+		return fmt.Errorf("failed to count security questions: %w", err)
+	}
+
+	if matching == 0 {
+		return ErrNotFound
+	}
+
+	if offered <= minSecurityQuestions {
+		return ErrTooFewSecurityQuestions
+	}
+
+	query := `
+	UPDATE security_questions SET
+		retired_at = NOW(),
+		updated_at = NOW()
+	WHERE
+		id::text = $1 AND
+		user_id IS NULL AND
+		retired_at IS NULL`
+
+	tag, err := s.db.Exec(ctx, query, questionId)
+	if err != nil {
+		return fmt.Errorf("failed to retire security question: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetUserSecurityQuestions gets the questions the user answered. The answers are never returned.
+func (s *Service) GetUserSecurityQuestions(ctx context.Context, userId string) ([]SecurityQuestion, error) {
+	if s.db == nil {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" {
+		return nil, ErrInvalidArg
+	}
+
+	query := `
+	SELECT
+		sq.id,
+		sq.question,
+		sq.user_id IS NOT NULL,
+		sq.retired_at,
+		sq.created_at
+	FROM users_security_questions usq
+	JOIN security_questions sq ON sq.id = usq.question_id
+	WHERE usq.user_id = $1
+	ORDER BY usq.created_at, sq.question`
+
+	rows, err := s.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for user security questions: %w", err)
+	}
+	defer rows.Close()
+
+	var questions = []SecurityQuestion{}
+	for rows.Next() {
+		var q SecurityQuestion
+		if err := rows.Scan(&q.Id, &q.Question, &q.Custom, &q.RetiredAt, &q.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user security question row: %w", err)
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read user security questions: %w", err)
+	}
+
+	return questions, nil
+}
+
+// ReplaceUserSecurityQuestions replaces all of the user's questions and answers. The caller
+// makes sure the user re-authenticated first. Returns ErrInvalidSecurityQuestion if a chosen
+// question isn't offered.
+func (s *Service) ReplaceUserSecurityQuestions(ctx context.Context, userId string, questions []UserSecurityQuestion) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || !validSecurityQuestions(questions) {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the user's custom questions are only referenced by their answers, the ones being kept are
+	// written again
+	for _, query := range []string{
+		`DELETE FROM users_security_questions WHERE user_id = $1`,
+		`DELETE FROM security_questions WHERE user_id = $1`,
+	} {
+		if _, err := tx.Exec(ctx, query, userId); err != nil {
+			return fmt.Errorf("failed to remove user security questions: %w", err)
+		}
+	}
+
+	if err := s.setUserSecurityQuestions(ctx, tx, userId, questions); err != nil {
+		return fmt.Errorf("failed to create user security questions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UserSecurityQuestion is a question and the user's answer to it. QuestionId is one of the
+// offered questions, or Question is a custom question written by the user.
 type UserSecurityQuestion struct {
 	QuestionId string
+	Question   string
 	Answer     string
 }
 
+// validSecurityQuestions checks the questions a user chose. Each is either an offered question
+// or a custom one, and none are repeated.
+func validSecurityQuestions(questions []UserSecurityQuestion) bool {
+	if len(questions) < minSecurityQuestions || len(questions) > maxSecurityQuestions {
+		return false
+	}
+
+	var seen = make(map[string]struct{}, len(questions))
+	for _, q := range questions {
+		custom := strings.TrimSpace(q.Question)
+		if (strings.TrimSpace(q.QuestionId) == "") == (custom == "") || len(custom) > maxSecurityQuestionLength {
+			return false
+		}
+
+		answer := normalizeSecurityAnswer(q.Answer)
+		if answer == "" || len(answer) > maxSecurityAnswerLength {
+			return false
+		}
+
+		key := "id:" + strings.TrimSpace(q.QuestionId)
+		if custom != "" {
+			key = "custom:" + strings.ToLower(custom)
+		}
+		if _, ok := seen[key]; ok {
+			return false
+		}
+		seen[key] = struct{}{}
+	}
+
+	return true
+}
+
+// normalizeSecurityAnswer is the answer as it's hashed, lowercase with whitespace collapsed, so
+// answers don't have to be typed exactly as they were the first time
+func normalizeSecurityAnswer(answer string) string {
+	return strings.ToLower(strings.Join(strings.Fields(answer), " "))
+}
+
+// setUserSecurityQuestions saves the user's questions and answers. Custom questions are created
+// for the user, the others must be offered.
+func (s *Service) setUserSecurityQuestions(ctx context.Context, tx pgx.Tx, userId string, questions []UserSecurityQuestion) error {
+	var questionIds []string
+	for _, q := range questions {
+		if q.QuestionId != "" {
+			questionIds = append(questionIds, strings.TrimSpace(q.QuestionId))
+		}
+	}
+
+	if len(questionIds) > 0 {
+		query := `
+		SELECT
+			COUNT(*)
+		FROM security_questions sq
+		WHERE
+			sq.id::text = ANY($1) AND
+			sq.user_id IS NULL AND
+			sq.retired_at IS NULL`
+
+		var offered int64
+		row := tx.QueryRow(ctx, query, questionIds)
+		if err := row.Scan(&offered); err != nil {
+			return fmt.Errorf("failed to query for security questions: %w", err)
+		}
+
+		if offered != int64(len(questionIds)) {
+			return ErrInvalidSecurityQuestion
+		}
+	}
+
+	records := make([]userSecurityQuestionRecord, 0, len(questions))
+	for _, q := range questions {
+		questionId := strings.TrimSpace(q.QuestionId)
+		if questionId == "" {
+			var err error
+			questionId, err = createCustomSecurityQuestion(ctx, tx, userId, strings.TrimSpace(q.Question))
+			if err != nil {
+				return err
+			}
+		}
+
+		answerHash, err := s.hashPassword(normalizeSecurityAnswer(q.Answer))
+		if err != nil {
+			return fmt.Errorf("failed to hash security question answer: %w", err)
+		}
+
+		records = append(records, userSecurityQuestionRecord{
+			questionId: questionId,
+			answerHash: answerHash,
+			userId:     userId,
+		})
+	}
+
+	return createUserSecurityQuestions(ctx, tx, records)
+}
+
+func createCustomSecurityQuestion(ctx context.Context, dbTransaction pgx.Tx, userId, question string) (string, error) {
+	query := `
+	INSERT INTO security_questions (question, user_id)
+	VALUES ($1, $2) RETURNING id`
+
+	var id string
+	row := dbTransaction.QueryRow(ctx, query, question, userId)
+	if err := row.Scan(&id); err != nil {
+		return "", fmt.Errorf("failed to insert custom security question: %w", err)
+	}
+
+	return id, nil
+}
+
 type userSecurityQuestionRecord struct {
 	id         string
 	userId     string
@@ -62,10 +383,11 @@ type userSecurityQuestionRecord struct {
 	createdAt  time.Time
 }
 
+// createUserSecurityQuestions inserts the answers, which must already be normalized and hashed
 func createUserSecurityQuestions(ctx context.Context, dbTransaction pgx.Tx, questions []userSecurityQuestionRecord) error {
 	var query strings.Builder
 	query.WriteString(`
-	INSERT INTO users_security_questions (user_id, question_id, answer_hash, salt)
+	INSERT INTO users_security_questions (user_id, question_id, answer_hash, salt, answer_normalized)
 	VALUES `)
 
 	var args = []any{}
@@ -73,7 +395,7 @@ func createUserSecurityQuestions(ctx context.Context, dbTransaction pgx.Tx, ques
 	for i, q := range questions {
 		args = append(args, q.userId, q.questionId, q.answerHash, q.salt)
 
-		query.WriteString(fmt.Sprintf("($%d, $%d, $%d, $%d)",
+		query.WriteString(fmt.Sprintf("($%d, $%d, $%d, $%d, true)",
 			len(args)-3, len(args)-2, len(args)-1, len(args),
 		))
 
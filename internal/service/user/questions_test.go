@@ -0,0 +1,324 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceUserSecurityQuestions(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testCustomQuestionId := "9a4f8c2e-6b1d-4e3a-8f7c-2d5b1a0e9c47"
+
+	offeredQuery := "SELECT COUNT(*) FROM security_questions sq WHERE sq.id::text = ANY($1) AND sq.user_id IS NULL AND sq.retired_at IS NULL"
+
+	expectRemoved := func(db pgxmock.PgxConnIface) {
+		db.ExpectBegin()
+		db.ExpectExec("DELETE FROM users_security_questions WHERE user_id = $1").WithArgs(testUserId).
+			WillReturnResult(pgxmock.NewResult("DELETE", 3))
+		db.ExpectExec("DELETE FROM security_questions WHERE user_id = $1").WithArgs(testUserId).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	}
+
+	tests := []struct {
+		name      string
+		questions []user.UserSecurityQuestion
+
+		dbFunc      func(db pgxmock.PgxConnIface)
+		expectedErr error
+	}{
+		{
+			name: "TooFew",
+			questions: []user.UserSecurityQuestion{
+				{QuestionId: "TestQuestionId", Answer: "Test Answer 1"},
+				{QuestionId: "TestQuestionId2", Answer: "Test Answer 2"},
+			},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name: "Repeated",
+			questions: []user.UserSecurityQuestion{
+				{QuestionId: "TestQuestionId", Answer: "Test Answer 1"},
+				{QuestionId: "TestQuestionId", Answer: "Test Answer 2"},
+				{QuestionId: "TestQuestionId3", Answer: "Test Answer 3"},
+			},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name: "RepeatedCustom",
+			questions: []user.UserSecurityQuestion{
+				{Question: "What was my first dog's name?", Answer: "Test Answer 1"},
+				{Question: "what was my first dog's name? ", Answer: "Test Answer 2"},
+				{QuestionId: "TestQuestionId3", Answer: "Test Answer 3"},
+			},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name: "QuestionIdAndCustom",
+			questions: []user.UserSecurityQuestion{
+				{QuestionId: "TestQuestionId", Question: "What was my first dog's name?", Answer: "Test Answer 1"},
+				{QuestionId: "TestQuestionId2", Answer: "Test Answer 2"},
+				{QuestionId: "TestQuestionId3", Answer: "Test Answer 3"},
+			},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name: "BlankAnswer",
+			questions: []user.UserSecurityQuestion{
+				{QuestionId: "TestQuestionId", Answer: "Test Answer 1"},
+				{QuestionId: "TestQuestionId2", Answer: " \t "},
+				{QuestionId: "TestQuestionId3", Answer: "Test Answer 3"},
+			},
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name: "RetiredQuestion",
+			questions: []user.UserSecurityQuestion{
+				{QuestionId: "TestQuestionId", Answer: "Test Answer 1"},
+				{QuestionId: "TestQuestionId2", Answer: "Test Answer 2"},
+				{QuestionId: "TestQuestionId3", Answer: "Test Answer 3"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				expectRemoved(db)
+				db.ExpectQuery(offeredQuery).
+					WithArgs([]string{"TestQuestionId", "TestQuestionId2", "TestQuestionId3"}).
+					WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(2)))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrInvalidSecurityQuestion,
+		},
+		{
+			name: "Success",
+			questions: []user.UserSecurityQuestion{
+				{QuestionId: "TestQuestionId", Answer: "  Test   Answer 1"},
+				{Question: " What was my first dog's name? ", Answer: "TEST ANSWER 2"},
+				{QuestionId: "TestQuestionId3", Answer: "test answer 3"},
+			},
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				expectRemoved(db)
+				db.ExpectQuery(offeredQuery).
+					WithArgs([]string{"TestQuestionId", "TestQuestionId3"}).
+					WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(2)))
+				db.ExpectQuery("INSERT INTO security_questions (question, user_id) VALUES ($1, $2) RETURNING id").
+					WithArgs("What was my first dog's name?", testUserId).
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testCustomQuestionId))
+				db.ExpectExec("INSERT INTO users_security_questions (user_id, question_id, answer_hash, salt, answer_normalized) "+
+					"VALUES ($1, $2, $3, $4, true), ($5, $6, $7, $8, true), ($9, $10, $11, $12, true)").
+					WithArgs(
+						testUserId, "TestQuestionId", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$9+M1BJbza9/i5WzkuFRmpMojIP7eKkHaprctOybbL9o", "",
+						testUserId, testCustomQuestionId, "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$nZMg8COtI+HCyU+ovfDx0u1cNsukrjGb5mvBk+vHc6I", "",
+						testUserId, "TestQuestionId3", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$eewrX5hihwV34pCjznysYpU1mJdv/LBQDaVl5GQhI28", "").
+					WillReturnResult(pgxmock.NewResult("INSERT", 3))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+				SaltReader:      zeroSaltReader{},
+			})
+			require.NoError(t, err)
+
+			err = service.ReplaceUserSecurityQuestions(context.TODO(), testUserId, test.questions)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetUserSecurityQuestions(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+
+	db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close(context.Background())
+
+	createdAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	retiredAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	db.ExpectQuery("SELECT sq.id, sq.question, sq.user_id IS NOT NULL, sq.retired_at, sq.created_at " +
+		"FROM users_security_questions usq JOIN security_questions sq ON sq.id = usq.question_id " +
+		"WHERE usq.user_id = $1 ORDER BY usq.created_at, sq.question").
+		WithArgs(testUserId).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "question", "custom", "retired_at", "created_at"}).
+			AddRow("TestQuestionId", "What city were you born in?", false, nil, createdAt).
+			AddRow("TestQuestionId2", "What is your high school mascot?", false, &retiredAt, createdAt).
+			AddRow("TestQuestionId3", "What was my first dog's name?", true, nil, createdAt))
+
+	service, err := user.NewService(user.ServiceConfig{
+		DB:              db,
+		RandomGenerator: &fakeRandomService{},
+	})
+	require.NoError(t, err)
+
+	questions, err := service.GetUserSecurityQuestions(context.TODO(), testUserId)
+	require.NoError(t, err)
+	require.Equal(t, []user.SecurityQuestion{
+		{Id: "TestQuestionId", Question: "What city were you born in?", CreatedAt: createdAt},
+		{Id: "TestQuestionId2", Question: "What is your high school mascot?", RetiredAt: &retiredAt, CreatedAt: createdAt},
+		{Id: "TestQuestionId3", Question: "What was my first dog's name?", Custom: true, CreatedAt: createdAt},
+	}, questions)
+	require.NoError(t, db.ExpectationsWereMet())
+}
+
+func TestAddSecurityQuestion(t *testing.T) {
+	insertQuery := "INSERT INTO security_questions (question) SELECT $1 WHERE NOT EXISTS ( SELECT 1 " +
+		"FROM security_questions sq WHERE sq.user_id IS NULL AND sq.retired_at IS NULL AND " +
+		"lower(sq.question) = lower($1) ) RETURNING id, created_at"
+
+	tests := []struct {
+		name     string
+		question string
+
+		dbFunc           func(db pgxmock.PgxConnIface)
+		expectedQuestion user.SecurityQuestion
+		expectedErr      error
+	}{
+		{
+			name:        "InvalidArg",
+			question:    "  ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:     "AlreadyExists",
+			question: "What city were you born in?",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(insertQuery).WithArgs("What city were you born in?").
+					WillReturnError(pgx.ErrNoRows)
+			},
+			expectedErr: user.ErrAlreadyExists,
+		},
+		{
+			name:     "Success",
+			question: " What street did you grow up on? ",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(insertQuery).WithArgs("What street did you grow up on?").
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).
+						AddRow("TestQuestionId", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)))
+			},
+			expectedQuestion: user.SecurityQuestion{
+				Id:        "TestQuestionId",
+				Question:  "What street did you grow up on?",
+				CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			question, err := service.AddSecurityQuestion(context.TODO(), test.question)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.Equal(t, test.expectedQuestion, question)
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRetireSecurityQuestion(t *testing.T) {
+	testQuestionId := "d7f0b0a5-3a53-4d4e-9d6c-0c1f6e1f7f60"
+
+	countQuery := "SELECT COUNT(*) FILTER (WHERE sq.id::text = $1), COUNT(*) FROM security_questions sq " +
+		"WHERE sq.user_id IS NULL AND sq.retired_at IS NULL"
+	retireQuery := "UPDATE security_questions SET retired_at = NOW(), updated_at = NOW() " +
+		"WHERE id::text = $1 AND user_id IS NULL AND retired_at IS NULL"
+
+	tests := []struct {
+		name   string
+		dbFunc func(db pgxmock.PgxConnIface)
+
+		expectedErr error
+	}{
+		{
+			name: "NotFound",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(countQuery).WithArgs(testQuestionId).
+					WillReturnRows(pgxmock.NewRows([]string{"matching", "offered"}).AddRow(int64(0), int64(6)))
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name: "TooFew",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(countQuery).WithArgs(testQuestionId).
+					WillReturnRows(pgxmock.NewRows([]string{"matching", "offered"}).AddRow(int64(1), int64(3)))
+			},
+			expectedErr: user.ErrTooFewSecurityQuestions,
+		},
+		{
+			name: "Success",
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectQuery(countQuery).WithArgs(testQuestionId).
+					WillReturnRows(pgxmock.NewRows([]string{"matching", "offered"}).AddRow(int64(1), int64(6)))
+				db.ExpectExec(retireQuery).WithArgs(testQuestionId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			err = service.RetireSecurityQuestion(context.TODO(), testQuestionId)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
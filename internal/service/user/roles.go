@@ -2,9 +2,9 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -17,49 +17,243 @@ const (
 
 	// user is the default role for users
 	RoleUser = Role("user")
+
+	// mechanic is for shop employees, who log service work on customers' cars
+	RoleMechanic = Role("mechanic")
 )
 
-type GetUserRoleOutput struct {
-	id        string
-	userId    string
-	Role      Role
-	createdAt time.Time
-	updatedAt time.Time
+// ValidRole checks the role is one of the roles in the roles table
+func ValidRole(role Role) bool {
+	switch role {
+	case RoleAdmin, RoleUser, RoleMechanic:
+		return true
+	default:
+		return false
+	}
 }
 
-func (s *Service) GetUserRole(ctx context.Context, userId string) (GetUserRoleOutput, error) {
+// GetUserRoles returns the roles the user currently holds
+func (s *Service) GetUserRoles(ctx context.Context, userId string) ([]Role, error) {
 	if s.db == nil {
-		return GetUserRoleOutput{}, ErrMissingRequiredConfiguration
+		return nil, ErrMissingRequiredConfiguration
 	}
 
 	if strings.TrimSpace(userId) == "" {
-		return GetUserRoleOutput{}, ErrInvalidArg
+		return nil, ErrInvalidArg
 	}
 
 	query := `
 	SELECT 
-		ur.id,
-    	ur.user_id,
-    	ur.created_at,
- 		ur.updated_at,
 		r.role
 	FROM users_roles ur
 	JOIN roles r ON r.id = ur.role_id
 	WHERE 
 		ur.user_id = $1
-	ORDER BY ur.created_at DESC 
-	LIMIT 1`
+		AND ur.revoked_at IS NULL
+	ORDER BY r.role`
+
+	rows, err := s.db.Query(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for user roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := make([]Role, 0)
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, fmt.Errorf("failed to scan user role: %w", err)
+		}
+		roles = append(roles, Role(role))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read user roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// AddUserRole grants the user a role. Granting a role the user already holds does nothing,
+// except a role a service granted becomes the admin's, so the service can't revoke it anymore.
+func (s *Service) AddUserRole(ctx context.Context, userId string, role Role) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || !ValidRole(role) {
+		return ErrInvalidArg
+	}
+
+	query := `
+	INSERT INTO users_roles (user_id, role_id)
+	SELECT 
+		u.id, 
+		r.id
+	FROM users u, roles r
+	WHERE 
+		u.id = $1
+		AND r.role = $2
+	ON CONFLICT (user_id, role_id) WHERE revoked_at IS NULL DO UPDATE SET
+		granted_by_client_id = NULL,
+		updated_at = NOW()
+	WHERE users_roles.granted_by_client_id IS NOT NULL`
+
+	if _, err := s.db.Exec(ctx, query, userId, string(role)); err != nil {
+		return fmt.Errorf("failed to insert user role: %w", err)
+	}
+
+	return nil
+}
+
+// AddServiceUserRole grants the user a role on behalf of a service client, which records the
+// grant as the client's. Granting a role the user already holds does nothing, so a role an admin
+// granted stays the admin's.
+func (s *Service) AddServiceUserRole(ctx context.Context, userId string, role Role, clientId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || !ValidRole(role) || strings.TrimSpace(clientId) == "" {
+		return ErrInvalidArg
+	}
+
+	query := `
+	INSERT INTO users_roles (user_id, role_id, granted_by_client_id)
+	SELECT 
+		u.id, 
+		r.id,
+		$3
+	FROM users u, roles r
+	WHERE 
+		u.id = $1
+		AND r.role = $2
+	ON CONFLICT (user_id, role_id) WHERE revoked_at IS NULL DO NOTHING`
+
+	if _, err := s.db.Exec(ctx, query, userId, string(role), strings.TrimSpace(clientId)); err != nil {
+		return fmt.Errorf("failed to insert user role: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveServiceUserRole revokes a role the service client granted the user. Returns ErrNotFound
+// if the user doesn't hold the role from the client, ex. it was granted by an admin.
+func (s *Service) RemoveServiceUserRole(ctx context.Context, userId string, role Role, clientId string) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || !ValidRole(role) || strings.TrimSpace(clientId) == "" {
+		return ErrInvalidArg
+	}
+
+	query := `
+	UPDATE users_roles ur
+	SET 
+		revoked_at = NOW(),
+		updated_at = NOW()
+	FROM roles r
+	WHERE 
+		r.id = ur.role_id
+		AND ur.user_id = $1
+		AND r.role = $2
+		AND ur.granted_by_client_id = $3
+		AND ur.revoked_at IS NULL`
+
+	tag, err := s.db.Exec(ctx, query, userId, string(role), strings.TrimSpace(clientId))
+	if err != nil {
+		return fmt.Errorf("failed to revoke user role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ErrLastAdmin is returned when removing the role would leave no active admins
+var ErrLastAdmin = errors.New("the user is the last active admin")
+
+// RemoveUserRole revokes a role from the user, keeping the record of it. Returns ErrNotFound if
+// the user doesn't hold the role, and ErrLastAdmin if they're the last active admin.
+func (s *Service) RemoveUserRole(ctx context.Context, userId string, role Role) error {
+	if s.db == nil {
+		return ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(userId) == "" || !ValidRole(role) {
+		return ErrInvalidArg
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if role == RoleAdmin {
+		// the active admins are locked, so two admins removing each other at the same time can't
+		// both see the other one still there
+		adminsQuery := `
+		SELECT 
+			ur.user_id
+		FROM users_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		JOIN users u ON u.id = ur.user_id
+		WHERE 
+			r.role = $1
+			AND ur.revoked_at IS NULL
+			AND u.deleted_at IS NULL
+		FOR UPDATE OF ur`
+
+		rows, err := tx.Query(ctx, adminsQuery, string(RoleAdmin))
+		if err != nil {
+			return fmt.Errorf("failed to query for active admins: %w", err)
+		}
+		defer rows.Close()
+
+		adminIds := make([]string, 0)
+		for rows.Next() {
+			var adminId string
+			if err := rows.Scan(&adminId); err != nil {
+				return fmt.Errorf("failed to scan active admin: %w", err)
+			}
+			adminIds = append(adminIds, adminId)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read active admins: %w", err)
+		}
 
-	var output GetUserRoleOutput
-	row := s.db.QueryRow(ctx, query, userId)
-	if err := row.Scan(&output.id, &output.userId,
-		&output.createdAt,
-		&output.updatedAt,
-		&output.Role); err != nil {
-		return GetUserRoleOutput{}, fmt.Errorf("failed to query for user role: %w", err)
+		if len(adminIds) == 1 && adminIds[0] == userId {
+			return ErrLastAdmin
+		}
 	}
 
-	return output, nil
+	query := `
+	UPDATE users_roles ur
+	SET 
+		revoked_at = NOW(),
+		updated_at = NOW()
+	FROM roles r
+	WHERE 
+		r.id = ur.role_id
+		AND ur.user_id = $1
+		AND r.role = $2
+		AND ur.revoked_at IS NULL`
+
+	tag, err := tx.Exec(ctx, query, userId, string(role))
+	if err != nil {
+		return fmt.Errorf("failed to revoke user role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
 // createUserRoleRecord creates a new record in the users_roles table. This decision was made
@@ -0,0 +1,340 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/keola-dunn/autolog/internal/service/user"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveUserRole(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	otherAdminId := "0b1c2d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e"
+	adminsQuery := "SELECT ur.user_id FROM users_roles ur JOIN roles r ON r.id = ur.role_id JOIN users u ON u.id = ur.user_id " +
+		"WHERE r.role = $1 AND ur.revoked_at IS NULL AND u.deleted_at IS NULL FOR UPDATE OF ur"
+	query := "UPDATE users_roles ur SET revoked_at = NOW(), updated_at = NOW() FROM roles r WHERE r.id = ur.role_id AND ur.user_id = $1 AND r.role = $2 AND ur.revoked_at IS NULL"
+
+	tests := []struct {
+		name string
+		role user.Role
+
+		dbFunc      func(db pgxmock.PgxConnIface)
+		expectedErr error
+	}{
+		{
+			name:        "UnknownRole",
+			role:        user.Role("owner"),
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name: "NotHeld",
+			role: user.RoleMechanic,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectExec(query).
+					WithArgs(testUserId, "mechanic").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name: "Removed",
+			role: user.RoleMechanic,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectExec(query).
+					WithArgs(testUserId, "mechanic").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "AdminRemoved",
+			role: user.RoleAdmin,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(adminsQuery).
+					WithArgs("admin").
+					WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(testUserId).AddRow(otherAdminId))
+				db.ExpectExec(query).
+					WithArgs(testUserId, "admin").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				db.ExpectCommit()
+				db.ExpectRollback()
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "LastAdmin",
+			role: user.RoleAdmin,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(adminsQuery).
+					WithArgs("admin").
+					WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(testUserId))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrLastAdmin,
+		},
+		{
+			// another admin is left, the user just isn't one of them
+			name: "AdminNotHeld",
+			role: user.RoleAdmin,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectBeginTx(pgx.TxOptions{})
+				db.ExpectQuery(adminsQuery).
+					WithArgs("admin").
+					WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(otherAdminId))
+				db.ExpectExec(query).
+					WithArgs(testUserId, "admin").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				db.ExpectRollback()
+			},
+			expectedErr: user.ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			err = service.RemoveUserRole(context.TODO(), testUserId, test.role)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAddServiceUserRole(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testClientId := "autolog-api"
+	query := "INSERT INTO users_roles (user_id, role_id, granted_by_client_id) SELECT u.id, r.id, $3 FROM users u, roles r " +
+		"WHERE u.id = $1 AND r.role = $2 ON CONFLICT (user_id, role_id) WHERE revoked_at IS NULL DO NOTHING"
+
+	tests := []struct {
+		name     string
+		role     user.Role
+		clientId string
+
+		dbFunc      func(db pgxmock.PgxConnIface)
+		expectedErr error
+	}{
+		{
+			name:        "UnknownRole",
+			role:        user.Role("owner"),
+			clientId:    testClientId,
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:        "MissingClientId",
+			role:        user.RoleMechanic,
+			clientId:    " ",
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			name:     "Added",
+			role:     user.RoleMechanic,
+			clientId: testClientId,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).
+					WithArgs(testUserId, "mechanic", testClientId).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			err = service.AddServiceUserRole(context.TODO(), testUserId, test.role, test.clientId)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRemoveServiceUserRole(t *testing.T) {
+	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
+	testClientId := "autolog-api"
+	query := "UPDATE users_roles ur SET revoked_at = NOW(), updated_at = NOW() FROM roles r WHERE r.id = ur.role_id " +
+		"AND ur.user_id = $1 AND r.role = $2 AND ur.granted_by_client_id = $3 AND ur.revoked_at IS NULL"
+
+	tests := []struct {
+		name string
+		role user.Role
+
+		dbFunc      func(db pgxmock.PgxConnIface)
+		expectedErr error
+	}{
+		{
+			name:        "UnknownRole",
+			role:        user.Role("owner"),
+			dbFunc:      func(db pgxmock.PgxConnIface) {},
+			expectedErr: user.ErrInvalidArg,
+		},
+		{
+			// ex. an admin granted the role, or another service did
+			name: "NotGrantedByClient",
+			role: user.RoleMechanic,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).
+					WithArgs(testUserId, "mechanic", testClientId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			expectedErr: user.ErrNotFound,
+		},
+		{
+			name: "Removed",
+			role: user.RoleMechanic,
+			dbFunc: func(db pgxmock.PgxConnIface) {
+				db.ExpectExec(query).
+					WithArgs(testUserId, "mechanic", testClientId).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := pgxmock.NewConn(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("failed to create new test postgres db: %v", err)
+			}
+			defer db.Close(context.Background())
+
+			test.dbFunc(db)
+
+			service, err := user.NewService(user.ServiceConfig{
+				DB:              db,
+				RandomGenerator: &fakeRandomService{},
+			})
+			require.NoError(t, err)
+
+			err = service.RemoveServiceUserRole(context.TODO(), testUserId, test.role, testClientId)
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error:\n%v\ndoes not match actual:\n%v", test.expectedErr, err)
+			}
+			require.NoError(t, db.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPermissionsForRoles(t *testing.T) {
+	tests := []struct {
+		name     string
+		roles    []user.Role
+		expected []user.Permission
+	}{
+		{
+			name:     "NoRoles",
+			roles:    nil,
+			expected: []user.Permission{},
+		},
+		{
+			name:  "Mechanic",
+			roles: []user.Role{user.RoleMechanic},
+			expected: []user.Permission{
+				user.PermissionCarsRead,
+				user.PermissionImagesRead,
+				user.PermissionImagesWrite,
+				user.PermissionServiceLogsCertify,
+				user.PermissionServiceLogsRead,
+				user.PermissionShopsRead,
+				user.PermissionShopsWrite,
+			},
+		},
+		{
+			name:  "UserAndMechanic",
+			roles: []user.Role{user.RoleUser, user.RoleMechanic},
+			expected: []user.Permission{
+				user.PermissionCarsRead,
+				user.PermissionCarsWrite,
+				user.PermissionImagesRead,
+				user.PermissionImagesWrite,
+				user.PermissionServiceLogsCertify,
+				user.PermissionServiceLogsRead,
+				user.PermissionServiceLogsWrite,
+				user.PermissionShopsRead,
+				user.PermissionShopsWrite,
+			},
+		},
+		{
+			name:     "UnknownRole",
+			roles:    []user.Role{user.Role("owner")},
+			expected: []user.Permission{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, user.PermissionsForRoles(test.roles))
+		})
+	}
+}
+
+func TestValidPermission(t *testing.T) {
+	require.True(t, user.ValidPermission(user.PermissionImagesAdmin))
+	require.True(t, user.ValidPermission(user.PermissionUsersAdmin))
+	require.True(t, user.ValidPermission(user.PermissionRolesMechanic))
+	require.True(t, user.ValidPermission(user.PermissionTokensIntrospect))
+	require.False(t, user.ValidPermission(user.Permission("images:delete")))
+	require.False(t, user.ValidPermission(user.Permission("")))
+}
+
+func TestServiceRolePermission(t *testing.T) {
+	permission, ok := user.ServiceRolePermission(user.RoleMechanic)
+	require.True(t, ok)
+	require.Equal(t, user.PermissionRolesMechanic, permission)
+
+	// services can't grant any other role, whatever permissions they hold
+	for _, role := range []user.Role{user.RoleAdmin, user.RoleUser, user.Role("owner")} {
+		_, ok := user.ServiceRolePermission(role)
+		require.False(t, ok, role)
+	}
+
+	// no role grants the service permissions to users
+	permissions := user.PermissionsForRoles([]user.Role{user.RoleAdmin, user.RoleUser, user.RoleMechanic})
+	require.NotContains(t, permissions, user.PermissionRolesMechanic)
+	require.NotContains(t, permissions, user.PermissionTokensIntrospect)
+}
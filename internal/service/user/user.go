@@ -2,16 +2,18 @@ package user
 
 import (
 	"context"
-	"encoding/base64"
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/keola-dunn/autolog/internal/calendar"
 	"github.com/keola-dunn/autolog/internal/platform/postgres"
 	"github.com/keola-dunn/autolog/internal/random"
-	"golang.org/x/crypto/argon2"
 )
 
 var (
@@ -27,42 +29,126 @@ type ServiceConfig struct {
 	// RandomGenerator is used to generate random values within the auth service.
 	RandomGenerator random.ServiceIface
 
-	// SaltLength sets the length of the password salts generated for the auth service.
-	// Defaults to 8.
+	CalendarService calendar.ServiceIface
+
+	// SaltLength sets the length, in bytes, of the password salts generated for the auth service.
+	// Defaults to 16.
 	SaltLength int64
+
+	// SaltReader is where password salts are read from. Defaults to crypto/rand.Reader.
+	SaltReader io.Reader
+
+	// AccountDeletionGracePeriod is how long after asking for their account to be deleted a
+	// user can cancel. Defaults to 30 days.
+	AccountDeletionGracePeriod time.Duration
+
+	// PasswordResetDecoySecret picks the security questions shown for logins that don't match a
+	// user, so they're the same every time. Defaults to a random secret, which changes the
+	// questions whenever the service restarts.
+	PasswordResetDecoySecret []byte
 }
 
 type ServiceIface interface {
 	CreateNewUser(context.Context, CreateNewUserInput) (string, error)
 	ValidateCredentials(ctx context.Context, user, password string) (bool, string, error)
 
+	StartLoginAttempt(ctx context.Context, login, ip string) (LoginAttempt, error)
+	FailLoginAttempt(ctx context.Context, attempt LoginAttempt) (bool, error)
+	SucceedLoginAttempt(ctx context.Context, attempt LoginAttempt) error
+	UnlockUser(ctx context.Context, userId string) error
+
 	DoesUsernameOrEmailExist(ctx context.Context, username, email string) (bool, bool, error)
 
 	GetSecurityQuestions(context.Context) ([]SecurityQuestion, error)
-
-	GetUserRole(ctx context.Context, userId string) (GetUserRoleOutput, error)
+	AddSecurityQuestion(ctx context.Context, question string) (SecurityQuestion, error)
+	RetireSecurityQuestion(ctx context.Context, questionId string) error
+	GetUserSecurityQuestions(ctx context.Context, userId string) ([]SecurityQuestion, error)
+	ReplaceUserSecurityQuestions(ctx context.Context, userId string, questions []UserSecurityQuestion) error
+
+	GetUserRoles(ctx context.Context, userId string) ([]Role, error)
+	AddUserRole(ctx context.Context, userId string, role Role) error
+	RemoveUserRole(ctx context.Context, userId string, role Role) error
+	AddServiceUserRole(ctx context.Context, userId string, role Role, clientId string) error
+	RemoveServiceUserRole(ctx context.Context, userId string, role Role, clientId string) error
+
+	StartPasswordReset(ctx context.Context, login string) (PasswordResetChallenge, error)
+	AnswerPasswordResetChallenge(ctx context.Context, challengeId string, answers []UserSecurityQuestion) (PasswordResetToken, error)
+	GetPasswordResetUserId(ctx context.Context, resetToken string) (string, error)
+	CompletePasswordReset(ctx context.Context, resetToken, newPassword string) (string, error)
+
+	GetProfile(ctx context.Context, userId string) (Profile, error)
+	UpdateProfile(ctx context.Context, input UpdateProfileInput) (Profile, error)
+
+	ScheduleAccountDeletion(ctx context.Context, userId string) (time.Time, error)
+	CancelAccountDeletion(ctx context.Context, userId string) error
+	DueAccountDeletions(ctx context.Context) ([]string, error)
+	DeleteAccount(ctx context.Context, userId string) error
+	ListDeletedAccounts(ctx context.Context, since time.Time) ([]DeletedAccount, error)
+
+	GetUserEmail(ctx context.Context, userId string) (UserEmail, error)
+	VerifyEmail(ctx context.Context, userId, email string) error
+	StartEmailChange(ctx context.Context, userId, newEmail string) (EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, changeId string, address EmailChangeAddress) (EmailChange, error)
+
+	StartExternalLogin(ctx context.Context, provider, linkUserId string) (ExternalLogin, error)
+	UseExternalLogin(ctx context.Context, provider, state string) (ExternalLogin, error)
+	LoginWithExternalIdentity(ctx context.Context, identity ExternalIdentity) (string, error)
+	LinkExternalIdentity(ctx context.Context, userId string, identity ExternalIdentity) (LinkedIdentity, error)
+	ListExternalIdentities(ctx context.Context, userId string) ([]LinkedIdentity, error)
+	UnlinkExternalIdentity(ctx context.Context, userId, identityId string) error
 }
 
 type Service struct {
 	db              postgres.ConnectionPool
 	randomGenerator random.ServiceIface
+	calendarService calendar.ServiceIface
 	saltLength      int64
+	saltReader      io.Reader
+
+	accountDeletionGracePeriod time.Duration
+
+	passwordResetDecoySecret []byte
 }
 
-func NewService(cfg ServiceConfig) *Service {
+func NewService(cfg ServiceConfig) (*Service, error) {
 	if cfg.RandomGenerator == nil {
 		cfg.RandomGenerator = random.NewService()
 	}
 
+	if cfg.CalendarService == nil {
+		cfg.CalendarService = calendar.NewService()
+	}
+
 	if cfg.SaltLength <= 0 {
-		cfg.SaltLength = 8
+		cfg.SaltLength = 16
+	}
+
+	if cfg.SaltReader == nil {
+		cfg.SaltReader = rand.Reader
+	}
+
+	if cfg.AccountDeletionGracePeriod <= 0 {
+		cfg.AccountDeletionGracePeriod = defaultAccountDeletionGracePeriod
+	}
+
+	if len(cfg.PasswordResetDecoySecret) == 0 {
+		cfg.PasswordResetDecoySecret = make([]byte, 32)
+		if _, err := rand.Read(cfg.PasswordResetDecoySecret); err != nil {
+			return nil, fmt.Errorf("failed to generate password reset decoy secret: %w", err)
+		}
 	}
 
 	return &Service{
 		db:              cfg.DB,
 		randomGenerator: cfg.RandomGenerator,
+		calendarService: cfg.CalendarService,
 		saltLength:      cfg.SaltLength,
-	}
+		saltReader:      cfg.SaltReader,
+
+		accountDeletionGracePeriod: cfg.AccountDeletionGracePeriod,
+
+		passwordResetDecoySecret: cfg.PasswordResetDecoySecret,
+	}, nil
 }
 
 type CreateNewUserInput struct {
@@ -78,7 +164,7 @@ func (c *CreateNewUserInput) Valid() bool {
 	if strings.TrimSpace(c.Email) == "" ||
 		strings.TrimSpace(c.Password) == "" ||
 		strings.TrimSpace(c.Email) == "" ||
-		len(c.SecurityQuestions) < 3 {
+		!validSecurityQuestions(c.SecurityQuestions) {
 		return false
 	}
 
@@ -86,7 +172,9 @@ func (c *CreateNewUserInput) Valid() bool {
 }
 
 // CreateNewUser creates a new user in the Auth service
-// Takes a context and CreateNewUserInput as the inputs, returns UserID and an error as the output
+// Takes a context and CreateNewUserInput as the inputs, returns UserID and an error as the output.
+// Returns an error wrapping ErrWeakPassword if the password isn't strong enough, and
+// ErrInvalidSecurityQuestion if a chosen question isn't offered.
 func (s *Service) CreateNewUser(ctx context.Context, input CreateNewUserInput) (string, error) {
 	if s.db == nil {
 		return "", ErrMissingRequiredConfiguration
@@ -96,36 +184,29 @@ func (s *Service) CreateNewUser(ctx context.Context, input CreateNewUserInput) (
 		return "", ErrInvalidArg
 	}
 
+	if err := CheckPasswordStrength(input.Password, input.Username, input.Email); err != nil {
+		return "", err
+	}
+
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return "", fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	salt := s.randomGenerator.RandomString(s.saltLength)
-
-	passwordHash := s.passwordHash(input.Password, salt)
+	passwordHash, err := s.hashPassword(input.Password)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
 
-	userId, err := createNewUserRecord(ctx, tx, input.Username, salt, string(passwordHash), input.Email)
+	// the salt is part of the hash, the salt column is only used by legacy hashes
+	userId, err := createNewUserRecord(ctx, tx, input.Username, "", passwordHash, input.Email)
 	if err != nil {
 		// TODO: figure out the error when a unique constraint on username or email is violated
 		return "", fmt.Errorf("failed to create new user record: %w", err)
 	}
 
-	userSecQuestions := make([]userSecurityQuestionRecord, 0, len(input.SecurityQuestions))
-	for _, question := range input.SecurityQuestions {
-		salt = s.randomGenerator.RandomString(s.saltLength)
-		answerHash := s.passwordHash(question.Answer, salt)
-
-		userSecQuestions = append(userSecQuestions, userSecurityQuestionRecord{
-			questionId: question.QuestionId,
-			answerHash: string(answerHash),
-			salt:       salt,
-			userId:     userId,
-		})
-	}
-
-	if err := createUserSecurityQuestions(ctx, tx, userSecQuestions); err != nil {
+	if err := s.setUserSecurityQuestions(ctx, tx, userId, input.SecurityQuestions); err != nil {
 		return "", fmt.Errorf("failed to create user security questions: %w", err)
 	}
 
@@ -155,15 +236,11 @@ func createNewUserRecord(ctx context.Context, dbTransaction pgx.Tx, username, sa
 	return id.String(), nil
 }
 
-func (s *Service) passwordHash(password, salt string) string {
-	pwHash := argon2.Key([]byte(password), []byte(salt), 1, 64*1024, 4, 32)
-	return base64.RawStdEncoding.EncodeToString(pwHash)
-}
-
 // ValidateCredentials will check the provided credentials against the database. This
 // is meant to be used as a login method. Returns
 // true if the credentials are good, false otherwise, the user id
-// (if valid) and an error.
+// (if valid) and an error. Password hashes made with older parameters
+// are upgraded once the password is known to be right.
 func (s *Service) ValidateCredentials(ctx context.Context, user, password string) (bool, string, error) {
 	if s.db == nil {
 		return false, "", ErrMissingRequiredConfiguration
@@ -188,18 +265,67 @@ func (s *Service) ValidateCredentials(ctx context.Context, user, password string
 	var storedPasswordHash string
 	if err := row.Scan(&userId, &salt, &storedPasswordHash); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
+			s.dummyPasswordHash(password)
 			return false, "", nil
 		}
 
 		return false, "", fmt.Errorf("failed to query for valid user credentials: %w", err)
 	}
 
-	providedHash := s.passwordHash(password, salt)
-	if providedHash == storedPasswordHash {
-		return true, userId.String(), nil
+	// users who only log in with an external provider have no password
+	if storedPasswordHash == "" {
+		s.dummyPasswordHash(password)
+		return false, "", nil
+	}
+
+	valid, needsUpgrade, err := verifyPassword(password, storedPasswordHash, salt)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to verify password: %w", err)
+	}
+	if !valid {
+		return false, "", nil
+	}
+
+	if needsUpgrade {
+		if err := s.upgradePasswordHash(ctx, userId.String(), password, storedPasswordHash); err != nil {
+			return false, "", fmt.Errorf("failed to upgrade password hash: %w", err)
+		}
+	}
+
+	return true, userId.String(), nil
+}
+
+// upgradePasswordHash rehashes the user's password with the current parameters. The hash is only
+// replaced if it hasn't changed since it was checked, so a concurrent password change wins.
+func (s *Service) upgradePasswordHash(ctx context.Context, userId, password, oldHash string) error {
+	newHash, err := s.hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	return false, "", nil
+	query := `
+	UPDATE users SET
+		salt = '',
+		password_hash = $2,
+		updated_at = NOW()
+	WHERE 
+		id = $1 AND 
+		password_hash = $3`
+
+	if _, err := s.db.Exec(ctx, query, userId, newHash, oldHash); err != nil {
+		return fmt.Errorf("failed to update user password hash: %w", err)
+	}
+
+	return nil
+}
+
+// dummyPasswordSalt is only used to hash passwords for logins that can't succeed
+var dummyPasswordSalt = []byte("autolog-dummy-salt")
+
+// dummyPasswordHash hashes the password for a login that can't succeed, so it takes as long as
+// one that could and the response time doesn't reveal which users exist
+func (s *Service) dummyPasswordHash(password string) {
+	_ = encodePasswordHash(password, dummyPasswordSalt, currentPasswordParams)
 }
 
 // DoesUsernameOrEmailExist checks if a provided username or email exists in the users table already.
@@ -21,6 +21,14 @@ func (f *fakeRandomService) RandomString(_ int64) string {
 	return "fakerandomstring"
 }
 
+// zeroSaltReader makes every password salt zeros, so hashes are predictable
+type zeroSaltReader struct{}
+
+func (zeroSaltReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
 func TestCreateNewUser(t *testing.T) {
 	testUserId := "e186aa27-10d4-4f06-907f-ec1a37174a98"
 	tests := []struct {
@@ -38,6 +46,23 @@ func TestCreateNewUser(t *testing.T) {
 			expectedUserId: "",
 			expectedErr:    user.ErrInvalidArg,
 		},
+		{
+			name: "WeakPassword",
+			input: user.CreateNewUserInput{
+				Username: "TestUsername",
+				Email:    "TestEmail",
+				Password: "password123",
+				SecurityQuestions: []user.UserSecurityQuestion{
+					{QuestionId: "TestQuestionId", Answer: "Test Answer 1"},
+					{QuestionId: "TestQuestionId2", Answer: "Test Answer 2"},
+					{QuestionId: "TestQuestionId3", Answer: "Test Answer 3"},
+				},
+				Role: user.RoleUser,
+			},
+			dbFunc:         func(db pgxmock.PgxConnIface) {},
+			expectedUserId: "",
+			expectedErr:    errors.New("password is too weak: too common"),
+		},
 		{
 			name: "DbError-CreateUserRecord",
 			input: user.CreateNewUserInput{
@@ -45,7 +70,9 @@ func TestCreateNewUser(t *testing.T) {
 				Email:    "TestEmail",
 				Password: "TestPassword",
 				SecurityQuestions: []user.UserSecurityQuestion{
-					{}, {}, {},
+					{QuestionId: "TestQuestionId", Answer: "Test Answer 1"},
+					{QuestionId: "TestQuestionId2", Answer: "Test Answer 2"},
+					{QuestionId: "TestQuestionId3", Answer: "Test Answer 3"},
 				},
 				Role: user.RoleUser,
 			},
@@ -55,8 +82,8 @@ func TestCreateNewUser(t *testing.T) {
 				db.ExpectQuery("INSERT INTO users(username, salt, password_hash, email) VALUES ($1, $2, $3, $4) RETURNING id").
 					WithArgs(
 						"TestUsername",
-						"fakerandomstring",
-						"m2LHi/PGOgAmCn17BQx8wTp9JZdc8lCBELH2NPsvSVs",
+						"",
+						"$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$amfAtsMjZrzn7e6EWS+yGCXEVLYdR1BWLfw8DtDa3+I",
 						"TestEmail").
 					WillReturnRows(pgxmock.NewRows(nil)).
 					WillReturnError(errors.New("fake db error"))
@@ -92,21 +119,25 @@ func TestCreateNewUser(t *testing.T) {
 				db.ExpectQuery("INSERT INTO users(username, salt, password_hash, email) VALUES ($1, $2, $3, $4) RETURNING id").
 					WithArgs(
 						"TestUsername",
-						"fakerandomstring",
-						"m2LHi/PGOgAmCn17BQx8wTp9JZdc8lCBELH2NPsvSVs",
+						"",
+						"$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$amfAtsMjZrzn7e6EWS+yGCXEVLYdR1BWLfw8DtDa3+I",
 						"TestEmail").
 					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
 
+				db.ExpectQuery("SELECT COUNT(*) FROM security_questions sq WHERE sq.id::text = ANY($1) AND sq.user_id IS NULL AND sq.retired_at IS NULL").
+					WithArgs([]string{"TestQuestionId", "TestQuestionId2", "TestQuestionId3"}).
+					WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(3)))
+
 				db.ExpectExec((`
-				INSERT INTO users_security_questions (user_id, question_id, answer_hash, salt) 
+				INSERT INTO users_security_questions (user_id, question_id, answer_hash, salt, answer_normalized) 
 				VALUES 
-					($1, $2, $3, $4), 
-					($5, $6, $7, $8), 
-					($9, $10, $11, $12)`)).
+					($1, $2, $3, $4, true), 
+					($5, $6, $7, $8, true), 
+					($9, $10, $11, $12, true)`)).
 					WithArgs(
-						testUserId, "TestQuestionId", "QxPGM9/ix/57HRCs3ZbIqaVI7nbKmwcZHJIeLIgtc5Y", "fakerandomstring",
-						testUserId, "TestQuestionId2", "b+hYERj3RxnD8+ijNE3Ot6yS+q62VNGlXvJnWZ84o5U", "fakerandomstring",
-						testUserId, "TestQuestionId3", "zvdpXECZZTj4uu3A8Tleo9RKRMUx+Wz9Xqbt+8Evug8", "fakerandomstring").
+						testUserId, "TestQuestionId", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$9+M1BJbza9/i5WzkuFRmpMojIP7eKkHaprctOybbL9o", "",
+						testUserId, "TestQuestionId2", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$nZMg8COtI+HCyU+ovfDx0u1cNsukrjGb5mvBk+vHc6I", "",
+						testUserId, "TestQuestionId3", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$eewrX5hihwV34pCjznysYpU1mJdv/LBQDaVl5GQhI28", "").
 					WillReturnError(errors.New("fake db error"))
 
 				db.ExpectRollback()
@@ -140,21 +171,25 @@ func TestCreateNewUser(t *testing.T) {
 				db.ExpectQuery("INSERT INTO users(username, salt, password_hash, email) VALUES ($1, $2, $3, $4) RETURNING id").
 					WithArgs(
 						"TestUsername",
-						"fakerandomstring",
-						"m2LHi/PGOgAmCn17BQx8wTp9JZdc8lCBELH2NPsvSVs",
+						"",
+						"$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$amfAtsMjZrzn7e6EWS+yGCXEVLYdR1BWLfw8DtDa3+I",
 						"TestEmail").
 					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
 
+				db.ExpectQuery("SELECT COUNT(*) FROM security_questions sq WHERE sq.id::text = ANY($1) AND sq.user_id IS NULL AND sq.retired_at IS NULL").
+					WithArgs([]string{"TestQuestionId", "TestQuestionId2", "TestQuestionId3"}).
+					WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(3)))
+
 				db.ExpectExec((`
-				INSERT INTO users_security_questions (user_id, question_id, answer_hash, salt) 
+				INSERT INTO users_security_questions (user_id, question_id, answer_hash, salt, answer_normalized) 
 				VALUES 
-					($1, $2, $3, $4), 
-					($5, $6, $7, $8), 
-					($9, $10, $11, $12)`)).
+					($1, $2, $3, $4, true), 
+					($5, $6, $7, $8, true), 
+					($9, $10, $11, $12, true)`)).
 					WithArgs(
-						testUserId, "TestQuestionId", "QxPGM9/ix/57HRCs3ZbIqaVI7nbKmwcZHJIeLIgtc5Y", "fakerandomstring",
-						testUserId, "TestQuestionId2", "b+hYERj3RxnD8+ijNE3Ot6yS+q62VNGlXvJnWZ84o5U", "fakerandomstring",
-						testUserId, "TestQuestionId3", "zvdpXECZZTj4uu3A8Tleo9RKRMUx+Wz9Xqbt+8Evug8", "fakerandomstring").
+						testUserId, "TestQuestionId", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$9+M1BJbza9/i5WzkuFRmpMojIP7eKkHaprctOybbL9o", "",
+						testUserId, "TestQuestionId2", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$nZMg8COtI+HCyU+ovfDx0u1cNsukrjGb5mvBk+vHc6I", "",
+						testUserId, "TestQuestionId3", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$eewrX5hihwV34pCjznysYpU1mJdv/LBQDaVl5GQhI28", "").
 					WillReturnResult(pgxmock.NewResult("insert", 3))
 
 				db.ExpectExec(`
@@ -201,21 +236,25 @@ func TestCreateNewUser(t *testing.T) {
 				db.ExpectQuery("INSERT INTO users(username, salt, password_hash, email) VALUES ($1, $2, $3, $4) RETURNING id").
 					WithArgs(
 						"TestUsername",
-						"fakerandomstring",
-						"m2LHi/PGOgAmCn17BQx8wTp9JZdc8lCBELH2NPsvSVs",
+						"",
+						"$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$amfAtsMjZrzn7e6EWS+yGCXEVLYdR1BWLfw8DtDa3+I",
 						"TestEmail").
 					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(testUserId))
 
+				db.ExpectQuery("SELECT COUNT(*) FROM security_questions sq WHERE sq.id::text = ANY($1) AND sq.user_id IS NULL AND sq.retired_at IS NULL").
+					WithArgs([]string{"TestQuestionId", "TestQuestionId2", "TestQuestionId3"}).
+					WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(int64(3)))
+
 				db.ExpectExec((`
-				INSERT INTO users_security_questions (user_id, question_id, answer_hash, salt) 
+				INSERT INTO users_security_questions (user_id, question_id, answer_hash, salt, answer_normalized) 
 				VALUES 
-					($1, $2, $3, $4), 
-					($5, $6, $7, $8), 
-					($9, $10, $11, $12)`)).
+					($1, $2, $3, $4, true), 
+					($5, $6, $7, $8, true), 
+					($9, $10, $11, $12, true)`)).
 					WithArgs(
-						testUserId, "TestQuestionId", "QxPGM9/ix/57HRCs3ZbIqaVI7nbKmwcZHJIeLIgtc5Y", "fakerandomstring",
-						testUserId, "TestQuestionId2", "b+hYERj3RxnD8+ijNE3Ot6yS+q62VNGlXvJnWZ84o5U", "fakerandomstring",
-						testUserId, "TestQuestionId3", "zvdpXECZZTj4uu3A8Tleo9RKRMUx+Wz9Xqbt+8Evug8", "fakerandomstring").
+						testUserId, "TestQuestionId", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$9+M1BJbza9/i5WzkuFRmpMojIP7eKkHaprctOybbL9o", "",
+						testUserId, "TestQuestionId2", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$nZMg8COtI+HCyU+ovfDx0u1cNsukrjGb5mvBk+vHc6I", "",
+						testUserId, "TestQuestionId3", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$eewrX5hihwV34pCjznysYpU1mJdv/LBQDaVl5GQhI28", "").
 					WillReturnResult(pgxmock.NewResult("insert", 3))
 
 				db.ExpectExec(`
@@ -248,10 +287,12 @@ func TestCreateNewUser(t *testing.T) {
 
 			test.dbFunc(db)
 
-			service := user.NewService(user.ServiceConfig{
+			service, err := user.NewService(user.ServiceConfig{
 				DB:              db,
 				RandomGenerator: &fakeRandomService{},
+				SaltReader:      zeroSaltReader{},
 			})
+			require.NoError(t, err)
 
 			userId, err := service.CreateNewUser(context.TODO(), test.input)
 			if err != test.expectedErr && (err == nil || test.expectedErr == nil || err.Error() != test.expectedErr.Error()) {
@@ -274,6 +315,9 @@ func TestValidateCredentials(t *testing.T) {
 		fakeQueryRows     *pgxmock.Rows
 		fakeQueryErr      error
 
+		// expectedUpgradeArgs are the args of the password hash upgrade, nil if there isn't one
+		expectedUpgradeArgs []interface{}
+
 		expectedValid  bool
 		expectedUserId string
 		expectedErr    error
@@ -340,10 +384,60 @@ func TestValidateCredentials(t *testing.T) {
 					"fakerandomstring",
 					"m2LHi/PGOgAmCn17BQx8wTp9JZdc8lCBELH2NPsvSVs"},
 			),
-			fakeQueryErr:   nil,
+			fakeQueryErr:        nil,
+			expectedUpgradeArgs: []interface{}{testUserId, "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$amfAtsMjZrzn7e6EWS+yGCXEVLYdR1BWLfw8DtDa3+I", "m2LHi/PGOgAmCn17BQx8wTp9JZdc8lCBELH2NPsvSVs"},
+			expectedValid:       true,
+			expectedUserId:      testUserId,
+			expectedErr:         nil,
+		},
+		{
+			name:              "ValidCredentials-CurrentHash",
+			user:              "Username",
+			password:          "TestPassword",
+			expectedQuery:     "SELECT u.id, u.salt, u.password_hash FROM users u WHERE u.username = $1 OR u.email = $1",
+			expectedQueryArgs: []interface{}{"Username"},
+			fakeQueryRows: pgxmock.NewRows([]string{"id", "salt", "password_hash"}).AddRows(
+				[]interface{}{testUserId, "", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$amfAtsMjZrzn7e6EWS+yGCXEVLYdR1BWLfw8DtDa3+I"},
+			),
 			expectedValid:  true,
 			expectedUserId: testUserId,
-			expectedErr:    nil,
+		},
+		{
+			name:              "ValidCredentials-OldParameters",
+			user:              "Username",
+			password:          "TestPassword",
+			expectedQuery:     "SELECT u.id, u.salt, u.password_hash FROM users u WHERE u.username = $1 OR u.email = $1",
+			expectedQueryArgs: []interface{}{"Username"},
+			fakeQueryRows: pgxmock.NewRows([]string{"id", "salt", "password_hash"}).AddRows(
+				[]interface{}{testUserId, "", "$argon2id$v=19$m=65536,t=1,p=4$AAAAAAAAAAAAAAAAAAAAAA$HnXZ2Zf13NwPei7zgBZKXgbiAwJat+ErP7HET+s6g/0"},
+			),
+			expectedUpgradeArgs: []interface{}{testUserId, "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$amfAtsMjZrzn7e6EWS+yGCXEVLYdR1BWLfw8DtDa3+I", "$argon2id$v=19$m=65536,t=1,p=4$AAAAAAAAAAAAAAAAAAAAAA$HnXZ2Zf13NwPei7zgBZKXgbiAwJat+ErP7HET+s6g/0"},
+			expectedValid:       true,
+			expectedUserId:      testUserId,
+		},
+		{
+			name:              "InvalidCredentials-CurrentHash",
+			user:              "Username",
+			password:          "WrongPassword",
+			expectedQuery:     "SELECT u.id, u.salt, u.password_hash FROM users u WHERE u.username = $1 OR u.email = $1",
+			expectedQueryArgs: []interface{}{"Username"},
+			fakeQueryRows: pgxmock.NewRows([]string{"id", "salt", "password_hash"}).AddRows(
+				[]interface{}{testUserId, "", "$argon2id$v=19$m=65536,t=3,p=4$AAAAAAAAAAAAAAAAAAAAAA$amfAtsMjZrzn7e6EWS+yGCXEVLYdR1BWLfw8DtDa3+I"},
+			),
+			expectedValid:  false,
+			expectedUserId: "",
+		},
+		{
+			name:              "ExternalUser",
+			user:              "Username",
+			password:          "TestPassword",
+			expectedQuery:     "SELECT u.id, u.salt, u.password_hash FROM users u WHERE u.username = $1 OR u.email = $1",
+			expectedQueryArgs: []interface{}{"Username"},
+			fakeQueryRows: pgxmock.NewRows([]string{"id", "salt", "password_hash"}).AddRows(
+				[]interface{}{testUserId, "", ""},
+			),
+			expectedValid:  false,
+			expectedUserId: "",
 		},
 	}
 
@@ -360,10 +454,18 @@ func TestValidateCredentials(t *testing.T) {
 				WillReturnRows(test.fakeQueryRows).
 				WillReturnError(test.fakeQueryErr)
 
-			service := user.NewService(user.ServiceConfig{
+			if test.expectedUpgradeArgs != nil {
+				db.ExpectExec("UPDATE users SET salt = '', password_hash = $2, updated_at = NOW() WHERE id = $1 AND password_hash = $3").
+					WithArgs(test.expectedUpgradeArgs...).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			}
+
+			service, err := user.NewService(user.ServiceConfig{
 				DB:              db,
 				RandomGenerator: &fakeRandomService{},
+				SaltReader:      zeroSaltReader{},
 			})
+			require.NoError(t, err)
 
 			valid, userId, err := service.ValidateCredentials(context.TODO(), test.user, test.password)
 			if err != test.expectedErr && (err == nil || test.expectedErr == nil || err.Error() != test.expectedErr.Error()) {
@@ -371,6 +473,9 @@ func TestValidateCredentials(t *testing.T) {
 			}
 			require.Equal(t, test.expectedValid, valid, "validComparison")
 			require.Equal(t, test.expectedUserId, userId, "userIdComparison")
+			if test.expectedUpgradeArgs != nil {
+				require.NoError(t, db.ExpectationsWereMet())
+			}
 		})
 	}
 }
@@ -0,0 +1,172 @@
+package serviceauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidClient is returned when the auth server rejects the service's credentials
+var ErrInvalidClient = errors.New("the service client credentials are invalid")
+
+// TokenSource gets service tokens from the auth server with the client credentials grant, for a
+// service to call another autolog service as itself. Tokens are cached and replaced shortly
+// before they expire.
+type TokenSource struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	audience     string
+	scope        string
+
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type TokenSourceConfig struct {
+	// TokenUrl is the auth server's token endpoint, ex. http://auth/v1/oauth/token
+	TokenUrl string
+
+	// ClientId and ClientSecret are the service client's credentials
+	ClientId     string
+	ClientSecret string
+
+	// Audience is the service the tokens are for, ex. images
+	Audience string
+
+	// Scope is the space separated permissions to request. Defaults to every permission of the
+	// service client.
+	Scope string
+
+	// HTTPClient defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+func NewTokenSource(config TokenSourceConfig) (*TokenSource, error) {
+	if _, err := url.ParseRequestURI(config.TokenUrl); err != nil {
+		return nil, fmt.Errorf("invalid token url: %w", err)
+	}
+
+	if config.ClientId == "" || config.ClientSecret == "" {
+		return nil, errors.New("missing service client credentials")
+	}
+
+	if config.Audience == "" {
+		return nil, errors.New("missing audience")
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+
+	return &TokenSource{
+		tokenUrl:     config.TokenUrl,
+		clientId:     config.ClientId,
+		clientSecret: config.ClientSecret,
+		audience:     config.Audience,
+		scope:        config.Scope,
+		httpClient:   config.HTTPClient,
+		now:          time.Now,
+	}, nil
+}
+
+// expiryMargin is how long before a token expires it's replaced, so it doesn't expire on the
+// way to the other service
+const expiryMargin = time.Minute
+
+// Token gets a service token, from the cache while it's still fresh
+func (t *TokenSource) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && t.now().Before(t.expiresAt) {
+		return t.token, nil
+	}
+
+	token, expiresIn, err := t.requestToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// short lived tokens are replaced half way through instead
+	margin := expiryMargin
+	if expiresIn < 2*margin {
+		margin = expiresIn / 2
+	}
+
+	t.token = token
+	t.expiresAt = t.now().Add(expiresIn - margin)
+
+	return t.token, nil
+}
+
+// Invalidate drops the cached token, ex. after the other service rejects it
+func (t *TokenSource) Invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.token = ""
+	t.expiresAt = time.Time{}
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Error       string `json:"error"`
+}
+
+func (t *TokenSource) requestToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"audience":   {t.audience},
+	}
+	if t.scope != "" {
+		form.Set("scope", t.scope)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.tokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// credentials are form encoded before basic auth encoding,
+	// https://datatracker.ietf.org/doc/html/rfc6749#section-2.3.1
+	req.SetBasicAuth(url.QueryEscape(t.clientId), url.QueryEscape(t.clientSecret))
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", 0, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if body.Error == "invalid_client" || body.Error == "unauthorized_client" {
+			return "", 0, ErrInvalidClient
+		}
+		return "", 0, fmt.Errorf("unexpected token response status %d: %s", resp.StatusCode, body.Error)
+	}
+
+	if body.AccessToken == "" || body.ExpiresIn <= 0 {
+		return "", 0, errors.New("token response is missing the access token or its expiry")
+	}
+
+	return body.AccessToken, time.Duration(body.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,110 @@
+package serviceauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/keola-dunn/autolog/internal/serviceauth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenSource(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientId, clientSecret, ok := r.BasicAuth()
+		if !ok || clientId != "autolog-api" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		require.Equal(t, "images", r.PostForm.Get("audience"))
+		require.Equal(t, "images:read", r.PostForm.Get("scope"))
+
+		mu.Lock()
+		requests++
+		token := fmt.Sprintf("token-%d", requests)
+		mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   1800,
+		})
+	}))
+	defer server.Close()
+
+	tokenSource, err := serviceauth.NewTokenSource(serviceauth.TokenSourceConfig{
+		TokenUrl:     server.URL,
+		ClientId:     "autolog-api",
+		ClientSecret: "secret",
+		Audience:     "images",
+		Scope:        "images:read",
+	})
+	require.NoError(t, err)
+
+	token, err := tokenSource.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token-1", token)
+
+	// cached until it's about to expire
+	token, err = tokenSource.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token-1", token)
+
+	tokenSource.Invalidate()
+
+	token, err = tokenSource.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token-2", token)
+
+	badTokenSource, err := serviceauth.NewTokenSource(serviceauth.TokenSourceConfig{
+		TokenUrl:     server.URL,
+		ClientId:     "autolog-api",
+		ClientSecret: "wrong",
+		Audience:     "images",
+	})
+	require.NoError(t, err)
+
+	_, err = badTokenSource.Token(context.Background())
+	require.ErrorIs(t, err, serviceauth.ErrInvalidClient)
+}
+
+func TestNewTokenSource(t *testing.T) {
+	_, err := serviceauth.NewTokenSource(serviceauth.TokenSourceConfig{
+		ClientId:     "autolog-api",
+		ClientSecret: "secret",
+		Audience:     "images",
+	})
+	require.Error(t, err)
+
+	_, err = serviceauth.NewTokenSource(serviceauth.TokenSourceConfig{
+		TokenUrl: "http://auth/v1/oauth/token",
+		Audience: "images",
+	})
+	require.Error(t, err)
+
+	_, err = serviceauth.NewTokenSource(serviceauth.TokenSourceConfig{
+		TokenUrl:     "http://auth/v1/oauth/token",
+		ClientId:     "autolog-api",
+		ClientSecret: "secret",
+	})
+	require.Error(t, err)
+
+	_, err = serviceauth.NewTokenSource(serviceauth.TokenSourceConfig{
+		TokenUrl:     "http://auth/v1/oauth/token",
+		ClientId:     "autolog-api",
+		ClientSecret: "secret",
+		Audience:     "images",
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,79 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keola-dunn/autolog/internal/totp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B test vectors, SHA1, truncated to 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "287082"},
+		{unix: 1111111109, expected: "081804"},
+		{unix: 1111111111, expected: "050471"},
+		{unix: 1234567890, expected: "005924"},
+		{unix: 2000000000, expected: "279037"},
+		{unix: 20000000000, expected: "353130"},
+	}
+
+	for _, test := range tests {
+		code, err := totp.Code(secret, totp.Step(time.Unix(test.unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, test.expected, code, "unix %d", test.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	current, err := totp.Code(secret, totp.Step(now))
+	require.NoError(t, err)
+
+	step, ok, err := totp.Validate(secret, current, now)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, totp.Step(now), step)
+
+	// a code from the previous period is still accepted for clock drift
+	previous, err := totp.Code(secret, totp.Step(now)-1)
+	require.NoError(t, err)
+	_, ok, err = totp.Validate(secret, previous, now)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// but not one from long ago
+	old, err := totp.Code(secret, totp.Step(now)-10)
+	require.NoError(t, err)
+	if old != current && old != previous {
+		_, ok, err = totp.Validate(secret, old, now)
+		require.NoError(t, err)
+		require.False(t, ok)
+	}
+
+	_, ok, err = totp.Validate(secret, "12345", now)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := totp.ProvisioningURI("Autolog", "user@example.com", "JBSWY3DPEHPK3PXP")
+
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Autolog:user@example.com?"), uri)
+	require.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	require.Contains(t, uri, "issuer=Autolog")
+	require.Contains(t, uri, "digits=6")
+	require.Contains(t, uri, "period=30")
+}
@@ -0,0 +1,99 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// authenticator data flags, https://www.w3.org/TR/webauthn-3/#authdata-flags
+const (
+	flagUserPresent            = byte(1 << 0)
+	flagUserVerified           = byte(1 << 2)
+	flagBackupEligible         = byte(1 << 3)
+	flagBackedUp               = byte(1 << 4)
+	flagAttestedCredentialData = byte(1 << 6)
+	flagExtensionData          = byte(1 << 7)
+)
+
+// minAuthenticatorDataLength is the rp id hash, flags and sign count
+const minAuthenticatorDataLength = 37
+
+type authenticatorData struct {
+	rpIdHash  []byte
+	flags     byte
+	signCount uint32
+
+	// set when flagAttestedCredentialData is, during registration
+	aaguid       []byte
+	credentialId []byte
+	publicKey    publicKey
+	rawPublicKey []byte
+}
+
+func (a *authenticatorData) userPresent() bool {
+	return a.flags&flagUserPresent != 0
+}
+
+func (a *authenticatorData) userVerified() bool {
+	return a.flags&flagUserVerified != 0
+}
+
+func (a *authenticatorData) backupEligible() bool {
+	return a.flags&flagBackupEligible != 0
+}
+
+func (a *authenticatorData) backedUp() bool {
+	return a.flags&flagBackedUp != 0
+}
+
+// parseAuthenticatorData parses the authenticator data, https://www.w3.org/TR/webauthn-3/#sctn-authenticator-data
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < minAuthenticatorDataLength {
+		return authenticatorData{}, fmt.Errorf("%w: authenticator data is too short", ErrInvalidResponse)
+	}
+
+	authData := authenticatorData{
+		rpIdHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[minAuthenticatorDataLength:]
+
+	if authData.flags&flagAttestedCredentialData != 0 {
+		// aaguid (16), credential id length (2), credential id, cose public key
+		if len(rest) < 18 {
+			return authenticatorData{}, fmt.Errorf("%w: attested credential data is too short", ErrInvalidResponse)
+		}
+		authData.aaguid = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return authenticatorData{}, fmt.Errorf("%w: invalid credential id length", ErrInvalidResponse)
+		}
+		authData.credentialId = rest[:idLength]
+		rest = rest[idLength:]
+
+		key, afterKey, err := parsePublicKey(rest)
+		if err != nil {
+			return authenticatorData{}, err
+		}
+		authData.publicKey = key
+		authData.rawPublicKey = rest[:len(rest)-len(afterKey)]
+		rest = afterKey
+	}
+
+	if authData.flags&flagExtensionData != 0 {
+		_, afterExtensions, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, fmt.Errorf("%w: invalid extension data", ErrInvalidResponse)
+		}
+		rest = afterExtensions
+	}
+
+	if len(rest) != 0 {
+		return authenticatorData{}, fmt.Errorf("%w: trailing authenticator data", ErrInvalidResponse)
+	}
+
+	return authData, nil
+}
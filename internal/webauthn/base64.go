@@ -0,0 +1,34 @@
+package webauthn
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// URLEncodedBase64 is binary data encoded in JSON as unpadded base64url, as the WebAuthn JSON
+// serialization expects. Padded input is accepted too.
+type URLEncodedBase64 []byte
+
+func (u URLEncodedBase64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(u))
+}
+
+func (u *URLEncodedBase64) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+
+	*u = decoded
+	return nil
+}
+
+func (u URLEncodedBase64) String() string {
+	return base64.RawURLEncoding.EncodeToString(u)
+}
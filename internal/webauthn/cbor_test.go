@@ -0,0 +1,62 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// examples from RFC 8949 appendix A
+	tests := []struct {
+		hex      string
+		expected any
+	}{
+		{hex: "00", expected: int64(0)},
+		{hex: "17", expected: int64(23)},
+		{hex: "1818", expected: int64(24)},
+		{hex: "1903e8", expected: int64(1000)},
+		{hex: "1a000f4240", expected: int64(1000000)},
+		{hex: "20", expected: int64(-1)},
+		{hex: "3903e7", expected: int64(-1000)},
+		{hex: "f4", expected: false},
+		{hex: "f5", expected: true},
+		{hex: "f6", expected: nil},
+		{hex: "4401020304", expected: []byte{1, 2, 3, 4}},
+		{hex: "6449455446", expected: "IETF"},
+		{hex: "83010203", expected: []any{int64(1), int64(2), int64(3)}},
+		{hex: "a201020304", expected: map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{hex: "a26161016162820203", expected: map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+	}
+
+	for _, test := range tests {
+		data, err := hex.DecodeString(test.hex)
+		require.NoError(t, err)
+
+		value, rest, err := decodeCBOR(data)
+		require.NoError(t, err, test.hex)
+		require.Empty(t, rest, test.hex)
+		require.Equal(t, test.expected, value, test.hex)
+	}
+}
+
+func TestDecodeCBORInvalid(t *testing.T) {
+	tests := []string{
+		"",           // empty
+		"19",         // truncated argument
+		"45010203",   // byte string longer than data
+		"9f",         // indefinite length array
+		"a2010201",   // truncated map
+		"a201020102", // duplicate key
+		"fb",         // float
+	}
+
+	for _, test := range tests {
+		data, err := hex.DecodeString(test)
+		require.NoError(t, err)
+
+		_, _, err = decodeCBOR(data)
+		require.ErrorIs(t, err, errCBOR, test)
+	}
+}
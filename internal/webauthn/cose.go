@@ -0,0 +1,130 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrUnsupportedKey is returned for credential public keys with an algorithm that isn't
+// supported
+var ErrUnsupportedKey = errors.New("unsupported credential public key")
+
+// COSE algorithm identifiers, https://www.iana.org/assignments/cose/cose.xhtml#algorithms
+const (
+	AlgES256 = int64(-7)
+	AlgEdDSA = int64(-8)
+	AlgRS256 = int64(-257)
+)
+
+// SupportedAlgorithms are offered to authenticators in order of preference
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters, RFC 9053
+const (
+	coseKeyType   = int64(1)
+	coseAlgorithm = int64(3)
+
+	coseEC2Curve = int64(-1)
+	coseEC2X     = int64(-2)
+	coseEC2Y     = int64(-3)
+
+	coseOKPCurve = int64(-1)
+	coseOKPX     = int64(-2)
+
+	coseRSAN = int64(-1)
+	coseRSAE = int64(-2)
+
+	coseKeyTypeOKP = int64(1)
+	coseKeyTypeEC2 = int64(2)
+	coseKeyTypeRSA = int64(3)
+
+	coseCurveP256    = int64(1)
+	coseCurveEd25519 = int64(6)
+)
+
+// publicKey is a credential public key decoded from its COSE encoding
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key, returning the key and the bytes after it
+func parsePublicKey(data []byte) (publicKey, []byte, error) {
+	decoded, rest, err := decodeCBOR(data)
+	if err != nil {
+		return publicKey{}, nil, fmt.Errorf("failed to decode cose key: %w", err)
+	}
+
+	params, ok := decoded.(map[any]any)
+	if !ok {
+		return publicKey{}, nil, fmt.Errorf("%w: cose key is not a map", ErrUnsupportedKey)
+	}
+
+	keyType, _ := params[coseKeyType].(int64)
+	alg, _ := params[coseAlgorithm].(int64)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && alg == AlgES256:
+		curve, _ := params[coseEC2Curve].(int64)
+		x, _ := params[coseEC2X].([]byte)
+		y, _ := params[coseEC2Y].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, nil, fmt.Errorf("%w: invalid ec2 key", ErrUnsupportedKey)
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return publicKey{}, nil, fmt.Errorf("%w: point is not on the curve", ErrUnsupportedKey)
+		}
+		return publicKey{algorithm: alg, key: key}, rest, nil
+
+	case keyType == coseKeyTypeOKP && alg == AlgEdDSA:
+		curve, _ := params[coseOKPCurve].(int64)
+		x, _ := params[coseOKPX].([]byte)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, nil, fmt.Errorf("%w: invalid okp key", ErrUnsupportedKey)
+		}
+		return publicKey{algorithm: alg, key: ed25519.PublicKey(x)}, rest, nil
+
+	case keyType == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := params[coseRSAN].([]byte)
+		e, _ := params[coseRSAE].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return publicKey{}, nil, fmt.Errorf("%w: invalid rsa key", ErrUnsupportedKey)
+		}
+		return publicKey{algorithm: alg, key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, rest, nil
+
+	default:
+		return publicKey{}, nil, fmt.Errorf("%w: key type %d, algorithm %d", ErrUnsupportedKey, keyType, alg)
+	}
+}
+
+// verify checks signature is the key's signature of data
+func (p publicKey) verify(data, signature []byte) bool {
+	switch key := p.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,440 @@
+// Package webauthn verifies WebAuthn registration and assertion ceremonies for passkeys,
+// https://www.w3.org/TR/webauthn-3/. It's concerned with the protocol only, storing
+// credentials and challenges is left to callers.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingRequiredConfiguration = errors.New("relying party is missing required configurations")
+
+	// ErrInvalidResponse is returned for malformed responses, or ones that don't match the
+	// ceremony, ex. the wrong challenge or relying party
+	ErrInvalidResponse = errors.New("invalid webauthn response")
+
+	ErrInvalidOrigin = errors.New("the response came from an origin that isn't allowed")
+
+	ErrInvalidSignature = errors.New("the response signature is invalid")
+
+	// ErrUserNotVerified is returned when the authenticator didn't verify the user, with a PIN
+	// or biometric
+	ErrUserNotVerified = errors.New("the user was not verified by the authenticator")
+
+	// ErrSignCountRegressed is returned when an authenticator's sign count doesn't increase,
+	// which suggests the credential was cloned
+	ErrSignCountRegressed = errors.New("the authenticator sign count did not increase")
+)
+
+// CeremonyTimeout is how long the user has to complete a ceremony
+const CeremonyTimeout = 5 * time.Minute
+
+const (
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+
+	credentialTypePublicKey = "public-key"
+)
+
+type RelyingPartyConfig struct {
+	// Id is the domain credentials are scoped to, ex. autolog.app
+	Id string
+
+	// Name is shown to the user by their authenticator
+	Name string
+
+	// Origins are the origins ceremonies can be completed from, ex. https://autolog.app or
+	// android:apk-key-hash:... for the Android app
+	Origins []string
+}
+
+// RelyingParty creates ceremony options and verifies the responses
+type RelyingParty struct {
+	id      string
+	name    string
+	origins []string
+	idHash  [32]byte
+}
+
+func NewRelyingParty(cfg RelyingPartyConfig) (*RelyingParty, error) {
+	if strings.TrimSpace(cfg.Id) == "" || len(cfg.Origins) == 0 {
+		return nil, ErrMissingRequiredConfiguration
+	}
+
+	if strings.TrimSpace(cfg.Name) == "" {
+		cfg.Name = cfg.Id
+	}
+
+	return &RelyingParty{
+		id:      cfg.Id,
+		name:    cfg.Name,
+		origins: cfg.Origins,
+		idHash:  sha256.Sum256([]byte(cfg.Id)),
+	}, nil
+}
+
+type RelyingPartyEntity struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	// Id is the user handle, it must not contain personal information
+	Id          URLEncodedBase64 `json:"id"`
+	Name        string           `json:"name"`
+	DisplayName string           `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string           `json:"type"`
+	Id         URLEncodedBase64 `json:"id"`
+	Transports []string         `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CredentialCreationOptions are passed to navigator.credentials.create() as publicKey
+type CredentialCreationOptions struct {
+	Challenge              URLEncodedBase64       `json:"challenge"`
+	RelyingParty           RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// NewCreationOptions creates options for registering a passkey. exclude are the user's
+// existing credentials, so the same authenticator isn't registered twice.
+func (rp *RelyingParty) NewCreationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor) CredentialCreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: credentialTypePublicKey, Algorithm: alg})
+	}
+
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return CredentialCreationOptions{
+		Challenge:          challenge,
+		RelyingParty:       RelyingPartyEntity{Id: rp.id, Name: rp.name},
+		User:               user,
+		PubKeyCredParams:   params,
+		Timeout:            CeremonyTimeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		// passkeys are discoverable, so users can log in without a username
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		// attestation isn't used to decide which authenticators are trusted
+		Attestation: "none",
+	}
+}
+
+// CredentialRequestOptions are passed to navigator.credentials.get() as publicKey
+type CredentialRequestOptions struct {
+	Challenge        URLEncodedBase64       `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RelyingPartyId   string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// NewRequestOptions creates options for logging in with a passkey. allow may be empty, to let
+// the user pick any of their passkeys for this relying party.
+func (rp *RelyingParty) NewRequestOptions(challenge []byte, allow []CredentialDescriptor) CredentialRequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+
+	return CredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          CeremonyTimeout.Milliseconds(),
+		RelyingPartyId:   rp.id,
+		AllowCredentials: allow,
+		UserVerification: "required",
+	}
+}
+
+// RegistrationResponse is the PublicKeyCredential returned by navigator.credentials.create(),
+// serialized with toJSON()
+type RegistrationResponse struct {
+	Id       string           `json:"id"`
+	RawId    URLEncodedBase64 `json:"rawId"`
+	Type     string           `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON"`
+		AttestationObject URLEncodedBase64 `json:"attestationObject"`
+		Transports        []string         `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the PublicKeyCredential returned by navigator.credentials.get(),
+// serialized with toJSON()
+type AssertionResponse struct {
+	Id       string           `json:"id"`
+	RawId    URLEncodedBase64 `json:"rawId"`
+	Type     string           `json:"type"`
+	Response struct {
+		ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON"`
+		AuthenticatorData URLEncodedBase64 `json:"authenticatorData"`
+		Signature         URLEncodedBase64 `json:"signature"`
+		UserHandle        URLEncodedBase64 `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a registered passkey
+type Credential struct {
+	Id []byte
+
+	// PublicKey is the COSE encoded public key
+	PublicKey []byte
+	Algorithm int64
+
+	SignCount  uint32
+	AAGUID     []byte
+	Transports []string
+
+	// BackupEligible and BackedUp are set for synced passkeys
+	BackupEligible bool
+	BackedUp       bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// ClientDataChallenge returns the challenge in the client data, so callers can look up the
+// ceremony it belongs to. The challenge still has to be verified.
+func ClientDataChallenge(clientDataJSON []byte) ([]byte, error) {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return nil, fmt.Errorf("%w: invalid client data", ErrInvalidResponse)
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data.Challenge, "="))
+	if err != nil || len(challenge) == 0 {
+		return nil, fmt.Errorf("%w: invalid client data challenge", ErrInvalidResponse)
+	}
+
+	return challenge, nil
+}
+
+// verifyClientData checks the client data is for the ceremony, https://www.w3.org/TR/webauthn-3/#sctn-verifying-assertion
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremonyType string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("%w: invalid client data", ErrInvalidResponse)
+	}
+
+	if data.Type != ceremonyType {
+		return fmt.Errorf("%w: client data type %q", ErrInvalidResponse, data.Type)
+	}
+
+	received, err := ClientDataChallenge(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+
+	for _, origin := range rp.origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+
+	return ErrInvalidOrigin
+}
+
+// verifyAuthenticatorData checks the data is for this relying party and the user was present
+// and verified
+func (rp *RelyingParty) verifyAuthenticatorData(authData authenticatorData) error {
+	if subtle.ConstantTimeCompare(authData.rpIdHash, rp.idHash[:]) != 1 {
+		return fmt.Errorf("%w: rp id mismatch", ErrInvalidResponse)
+	}
+
+	if !authData.userPresent() {
+		return fmt.Errorf("%w: user not present", ErrInvalidResponse)
+	}
+
+	if !authData.userVerified() {
+		return ErrUserNotVerified
+	}
+
+	return nil
+}
+
+// VerifyRegistration verifies the response to a registration ceremony started with challenge,
+// returning the new credential to store
+func (rp *RelyingParty) VerifyRegistration(resp RegistrationResponse, challenge []byte) (Credential, error) {
+	if resp.Type != credentialTypePublicKey {
+		return Credential{}, fmt.Errorf("%w: credential type %q", ErrInvalidResponse, resp.Type)
+	}
+
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, clientDataTypeCreate, challenge); err != nil {
+		return Credential{}, err
+	}
+
+	decoded, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: invalid attestation object", ErrInvalidResponse)
+	}
+
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: attestation object is not a map", ErrInvalidResponse)
+	}
+
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[any]any)
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return Credential{}, err
+	}
+
+	if authData.credentialId == nil {
+		return Credential{}, fmt.Errorf("%w: missing attested credential data", ErrInvalidResponse)
+	}
+
+	if len(resp.RawId) > 0 && !bytes.Equal(resp.RawId, authData.credentialId) {
+		return Credential{}, fmt.Errorf("%w: credential id mismatch", ErrInvalidResponse)
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	if err := verifyAttestationStatement(format, statement, rawAuthData, clientDataHash[:], authData.publicKey); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		Id:             append([]byte(nil), authData.credentialId...),
+		PublicKey:      append([]byte(nil), authData.rawPublicKey...),
+		Algorithm:      authData.publicKey.algorithm,
+		SignCount:      authData.signCount,
+		AAGUID:         append([]byte(nil), authData.aaguid...),
+		Transports:     resp.Response.Transports,
+		BackupEligible: authData.backupEligible(),
+		BackedUp:       authData.backedUp(),
+	}, nil
+}
+
+// verifyAttestationStatement checks the statements that can be verified without trusting an
+// attestation root. none and packed are verified. Other formats are only sent when
+// attestation is requested, which it isn't, and are accepted without verification, as the
+// credential's trust doesn't depend on attestation.
+func verifyAttestationStatement(format string, statement map[any]any, rawAuthData, clientDataHash []byte, credentialKey publicKey) error {
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return fmt.Errorf("%w: none attestation with a statement", ErrInvalidResponse)
+		}
+		return nil
+
+	case "packed":
+		alg, _ := statement["alg"].(int64)
+		sig, _ := statement["sig"].([]byte)
+		signed := append(append([]byte(nil), rawAuthData...), clientDataHash...)
+
+		certs, hasCerts := statement["x5c"].([]any)
+		if !hasCerts {
+			// self attestation, signed by the credential itself
+			if alg != credentialKey.algorithm || !credentialKey.verify(signed, sig) {
+				return ErrInvalidSignature
+			}
+			return nil
+		}
+
+		if len(certs) == 0 {
+			return fmt.Errorf("%w: empty attestation certificate chain", ErrInvalidResponse)
+		}
+		rawCert, _ := certs[0].([]byte)
+		cert, err := x509.ParseCertificate(rawCert)
+		if err != nil {
+			return fmt.Errorf("%w: invalid attestation certificate", ErrInvalidResponse)
+		}
+
+		attestationKey := publicKey{algorithm: alg, key: cert.PublicKey}
+		if !attestationKey.verify(signed, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	default:
+		return nil
+	}
+}
+
+// VerifyAssertion verifies the response to a login ceremony started with challenge, for the
+// stored credential. Returns the new sign count to store.
+func (rp *RelyingParty) VerifyAssertion(resp AssertionResponse, challenge []byte, credential Credential) (uint32, error) {
+	if resp.Type != credentialTypePublicKey {
+		return 0, fmt.Errorf("%w: credential type %q", ErrInvalidResponse, resp.Type)
+	}
+
+	if !bytes.Equal(resp.RawId, credential.Id) {
+		return 0, fmt.Errorf("%w: credential id mismatch", ErrInvalidResponse)
+	}
+
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, clientDataTypeGet, challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	key, _, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse stored public key: %w", err)
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, resp.Response.Signature) {
+		return 0, ErrInvalidSignature
+	}
+
+	// authenticators that don't count always send 0, https://www.w3.org/TR/webauthn-3/#sctn-sign-counter
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, ErrSignCountRegressed
+	}
+
+	return authData.signCount, nil
+}
@@ -0,0 +1,205 @@
+package webauthn_test
+
+import (
+	"testing"
+
+	"github.com/keola-dunn/autolog/internal/webauthn"
+	"github.com/keola-dunn/autolog/internal/webauthn/webauthntest"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPId   = "autolog.test"
+	testOrigin = "https://autolog.test"
+)
+
+func newTestRelyingParty(t *testing.T) *webauthn.RelyingParty {
+	rp, err := webauthn.NewRelyingParty(webauthn.RelyingPartyConfig{
+		Id:      testRPId,
+		Name:    "Autolog",
+		Origins: []string{testOrigin},
+	})
+	require.NoError(t, err)
+	return rp
+}
+
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) webauthn.Credential {
+	challenge := []byte("registration-challenge-0123456789")
+	options := rp.NewCreationOptions(challenge, webauthn.UserEntity{
+		Id:          []byte("user-handle"),
+		Name:        "user@example.com",
+		DisplayName: "user",
+	}, nil)
+
+	credential, err := rp.VerifyRegistration(authenticator.Create(options), challenge)
+	require.NoError(t, err)
+	return credential
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	challenge := []byte("registration-challenge-0123456789")
+
+	tests := []struct {
+		name        string
+		modify      func(a *webauthntest.Authenticator)
+		challenge   []byte
+		expectedErr error
+	}{
+		{
+			name:      "Success",
+			modify:    func(a *webauthntest.Authenticator) {},
+			challenge: challenge,
+		},
+		{
+			name:        "WrongChallenge",
+			modify:      func(a *webauthntest.Authenticator) {},
+			challenge:   []byte("some-other-challenge"),
+			expectedErr: webauthn.ErrInvalidResponse,
+		},
+		{
+			name:        "WrongOrigin",
+			modify:      func(a *webauthntest.Authenticator) { a.Origin = "https://evil.test" },
+			challenge:   challenge,
+			expectedErr: webauthn.ErrInvalidOrigin,
+		},
+		{
+			name:        "WrongRelyingParty",
+			modify:      func(a *webauthntest.Authenticator) { a.RelyingPartyId = "evil.test" },
+			challenge:   challenge,
+			expectedErr: webauthn.ErrInvalidResponse,
+		},
+		{
+			name:        "UserNotVerified",
+			modify:      func(a *webauthntest.Authenticator) { a.UserVerified = false },
+			challenge:   challenge,
+			expectedErr: webauthn.ErrUserNotVerified,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator, err := webauthntest.NewAuthenticator(testRPId, testOrigin)
+			require.NoError(t, err)
+			test.modify(authenticator)
+
+			options := rp.NewCreationOptions(challenge, webauthn.UserEntity{
+				Id:          []byte("user-handle"),
+				Name:        "user@example.com",
+				DisplayName: "user",
+			}, nil)
+
+			credential, err := rp.VerifyRegistration(authenticator.Create(options), test.challenge)
+			require.ErrorIs(t, err, test.expectedErr)
+			if test.expectedErr == nil {
+				require.Equal(t, authenticator.CredentialId, credential.Id)
+				require.Equal(t, authenticator.PublicKeyCOSE(), credential.PublicKey)
+				require.Equal(t, webauthn.AlgES256, credential.Algorithm)
+				require.Equal(t, []string{"internal"}, credential.Transports)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	rp := newTestRelyingParty(t)
+	challenge := []byte("login-challenge-0123456789")
+
+	tests := []struct {
+		name        string
+		modify      func(a *webauthntest.Authenticator, credential *webauthn.Credential)
+		tamper      func(resp *webauthn.AssertionResponse)
+		expectedErr error
+	}{
+		{
+			name:   "Success",
+			modify: func(a *webauthntest.Authenticator, credential *webauthn.Credential) {},
+			tamper: func(resp *webauthn.AssertionResponse) {},
+		},
+		{
+			name: "NonCountingAuthenticator",
+			modify: func(a *webauthntest.Authenticator, credential *webauthn.Credential) {
+				a.Counting = false
+			},
+			tamper: func(resp *webauthn.AssertionResponse) {},
+		},
+		{
+			name: "SignCountRegressed",
+			modify: func(a *webauthntest.Authenticator, credential *webauthn.Credential) {
+				credential.SignCount = 10
+			},
+			tamper:      func(resp *webauthn.AssertionResponse) {},
+			expectedErr: webauthn.ErrSignCountRegressed,
+		},
+		{
+			name:   "TamperedSignature",
+			modify: func(a *webauthntest.Authenticator, credential *webauthn.Credential) {},
+			tamper: func(resp *webauthn.AssertionResponse) {
+				resp.Response.Signature[len(resp.Response.Signature)-1] ^= 0xff
+			},
+			expectedErr: webauthn.ErrInvalidSignature,
+		},
+		{
+			name:   "TamperedAuthenticatorData",
+			modify: func(a *webauthntest.Authenticator, credential *webauthn.Credential) {},
+			tamper: func(resp *webauthn.AssertionResponse) {
+				resp.Response.AuthenticatorData[36] ^= 0xff
+			},
+			expectedErr: webauthn.ErrInvalidSignature,
+		},
+		{
+			name: "UserNotVerified",
+			modify: func(a *webauthntest.Authenticator, credential *webauthn.Credential) {
+				a.UserVerified = false
+			},
+			tamper:      func(resp *webauthn.AssertionResponse) {},
+			expectedErr: webauthn.ErrUserNotVerified,
+		},
+		{
+			name:   "WrongCredential",
+			modify: func(a *webauthntest.Authenticator, credential *webauthn.Credential) {},
+			tamper: func(resp *webauthn.AssertionResponse) {
+				resp.RawId = []byte("another-credential")
+			},
+			expectedErr: webauthn.ErrInvalidResponse,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator, err := webauthntest.NewAuthenticator(testRPId, testOrigin)
+			require.NoError(t, err)
+
+			credential := register(t, rp, authenticator)
+			test.modify(authenticator, &credential)
+
+			options := rp.NewRequestOptions(challenge, nil)
+			resp, err := authenticator.Get(options)
+			require.NoError(t, err)
+			test.tamper(&resp)
+
+			signCount, err := rp.VerifyAssertion(resp, challenge, credential)
+			require.ErrorIs(t, err, test.expectedErr)
+			if test.expectedErr == nil {
+				require.Equal(t, authenticator.SignCount, signCount)
+			}
+		})
+	}
+}
+
+func TestClientDataChallenge(t *testing.T) {
+	rp := newTestRelyingParty(t)
+
+	authenticator, err := webauthntest.NewAuthenticator(testRPId, testOrigin)
+	require.NoError(t, err)
+
+	resp, err := authenticator.Get(rp.NewRequestOptions([]byte("challenge"), nil))
+	require.NoError(t, err)
+
+	challenge, err := webauthn.ClientDataChallenge(resp.Response.ClientDataJSON)
+	require.NoError(t, err)
+	require.Equal(t, []byte("challenge"), challenge)
+
+	_, err = webauthn.ClientDataChallenge([]byte("not json"))
+	require.ErrorIs(t, err, webauthn.ErrInvalidResponse)
+}
@@ -0,0 +1,164 @@
+// Package webauthntest provides a software authenticator for testing WebAuthn ceremonies
+// without a browser or hardware key
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/keola-dunn/autolog/internal/webauthn"
+)
+
+// Authenticator is a software passkey with a single ES256 credential
+type Authenticator struct {
+	// Origin is put in client data, as a browser would
+	Origin string
+
+	// RelyingPartyId is hashed into authenticator data
+	RelyingPartyId string
+
+	// UserVerified sets the user verified flag
+	UserVerified bool
+
+	// SignCount is incremented before each assertion. Leave at zero for an authenticator that
+	// doesn't count.
+	SignCount uint32
+
+	// Counting makes the authenticator increment SignCount
+	Counting bool
+
+	CredentialId []byte
+	UserHandle   []byte
+
+	key *ecdsa.PrivateKey
+}
+
+// NewAuthenticator creates an authenticator with a new credential that verifies users and
+// counts signatures
+func NewAuthenticator(rpId, origin string) (*Authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	credentialId := make([]byte, 16)
+	if _, err := rand.Read(credentialId); err != nil {
+		return nil, fmt.Errorf("failed to generate credential id: %w", err)
+	}
+
+	return &Authenticator{
+		Origin:         origin,
+		RelyingPartyId: rpId,
+		UserVerified:   true,
+		Counting:       true,
+		CredentialId:   credentialId,
+		key:            key,
+	}, nil
+}
+
+func (a *Authenticator) clientDataJSON(ceremonyType string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremonyType,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+func (a *Authenticator) authenticatorData(attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(a.RelyingPartyId))
+
+	flags := byte(0x01) // user present
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	if attested {
+		flags |= 0x40
+	}
+
+	data := append([]byte(nil), rpIdHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.SignCount)
+
+	if attested {
+		data = append(data, make([]byte, 16)...) // zero aaguid, as with none attestation
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.CredentialId)))
+		data = append(data, a.CredentialId...)
+		data = append(data, a.PublicKeyCOSE()...)
+	}
+
+	return data
+}
+
+// PublicKeyCOSE is the credential's COSE encoded public key
+func (a *Authenticator) PublicKeyCOSE() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+
+	return EncodeCBOR(map[int64]any{
+		1:  int64(2),  // kty: EC2
+		3:  int64(-7), // alg: ES256
+		-1: int64(1),  // crv: P-256
+		-2: x,
+		-3: y,
+	})
+}
+
+// Create responds to a registration ceremony with the credential, using none attestation
+func (a *Authenticator) Create(options webauthn.CredentialCreationOptions) webauthn.RegistrationResponse {
+	a.UserHandle = options.User.Id
+
+	attestationObject := EncodeCBOR(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authenticatorData(true),
+	})
+
+	var resp webauthn.RegistrationResponse
+	resp.Id = base64.RawURLEncoding.EncodeToString(a.CredentialId)
+	resp.RawId = a.CredentialId
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = a.clientDataJSON("webauthn.create", options.Challenge)
+	resp.Response.AttestationObject = attestationObject
+	resp.Response.Transports = []string{"internal"}
+
+	return resp
+}
+
+// Get responds to a login ceremony, signing with the credential
+func (a *Authenticator) Get(options webauthn.CredentialRequestOptions) (webauthn.AssertionResponse, error) {
+	if a.Counting {
+		a.SignCount++
+	}
+
+	clientDataJSON := a.clientDataJSON("webauthn.get", options.Challenge)
+	authData := a.authenticatorData(false)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return webauthn.AssertionResponse{}, fmt.Errorf("failed to sign assertion: %w", err)
+	}
+
+	var resp webauthn.AssertionResponse
+	resp.Id = base64.RawURLEncoding.EncodeToString(a.CredentialId)
+	resp.RawId = a.CredentialId
+	resp.Type = "public-key"
+	resp.Response.ClientDataJSON = clientDataJSON
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = signature
+	resp.Response.UserHandle = a.UserHandle
+
+	return resp, nil
+}
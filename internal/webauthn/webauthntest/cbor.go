@@ -0,0 +1,95 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// EncodeCBOR encodes the values authenticators send: int64, []byte, string, bool, []any,
+// map[string]any and map[int64]any. Map keys are sorted, as CTAP2 canonical encoding requires.
+func EncodeCBOR(value any) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case int:
+		return EncodeCBOR(int64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	case []any:
+		out := cborHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, EncodeCBOR(item)...)
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// canonical order is shorter keys first, then bytewise
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		out := cborHead(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(out, EncodeCBOR(k)...)
+			out = append(out, EncodeCBOR(v[k])...)
+		}
+		return out
+	case map[int64]any:
+		keys := make([]int64, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// canonical order puts positive integers before negative ones
+		sort.Slice(keys, func(i, j int) bool {
+			if (keys[i] < 0) != (keys[j] < 0) {
+				return keys[i] >= 0
+			}
+			if keys[i] < 0 {
+				return keys[i] > keys[j]
+			}
+			return keys[i] < keys[j]
+		})
+		out := cborHead(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(out, EncodeCBOR(k)...)
+			out = append(out, EncodeCBOR(v[k])...)
+		}
+		return out
+	default:
+		panic(fmt.Sprintf("webauthntest: unsupported cbor type %T", value))
+	}
+}
+
+func cborHead(majorType byte, arg uint64) []byte {
+	mt := majorType << 5
+	switch {
+	case arg < 24:
+		return []byte{mt | byte(arg)}
+	case arg <= 0xff:
+		return []byte{mt | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{mt | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{mt | 26}, uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{mt | 27}, arg)
+	}
+}
@@ -0,0 +1,62 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS catalog_makes (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    nhtsa_make_id integer NOT NULL UNIQUE,
+    name varchar(256) NOT NULL,
+    normalized_name varchar(256) NOT NULL,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_catalog_makes_normalized_name ON catalog_makes(normalized_name varchar_pattern_ops);
+
+-- aliases are the common shorthand users type in for a make, ex. "chevy". Keyed by the
+-- normalized catalog name so they survive a re-sync of the makes table.
+CREATE TABLE IF NOT EXISTS catalog_make_aliases (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    alias varchar(256) NOT NULL UNIQUE,
+    make_normalized_name varchar(256) NOT NULL,
+    created_at timestamptz DEFAULT NOW()
+);
+
+INSERT INTO catalog_make_aliases (alias, make_normalized_name) VALUES
+    ('chevy', 'chevrolet'),
+    ('vw', 'volkswagen'),
+    ('vdub', 'volkswagen'),
+    ('mercedes', 'mercedesbenz'),
+    ('merc', 'mercedesbenz'),
+    ('benz', 'mercedesbenz'),
+    ('mb', 'mercedesbenz'),
+    ('bimmer', 'bmw'),
+    ('beemer', 'bmw'),
+    ('alfa', 'alfaromeo'),
+    ('landie', 'landrover'),
+    ('rangerover', 'landrover'),
+    ('caddy', 'cadillac'),
+    ('olds', 'oldsmobile'),
+    ('rr', 'rollsroyce');
+
+CREATE TABLE IF NOT EXISTS catalog_models (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    make_id uuid NOT NULL references catalog_makes(id) ON DELETE CASCADE,
+    nhtsa_model_id integer NOT NULL,
+    name varchar(256) NOT NULL,
+    normalized_name varchar(256) NOT NULL,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW(),
+    UNIQUE (make_id, nhtsa_model_id)
+);
+CREATE INDEX IF NOT EXISTS idx_catalog_models_make_id_normalized_name ON catalog_models(make_id, normalized_name varchar_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS catalog_model_years (
+    model_id uuid NOT NULL references catalog_models(id) ON DELETE CASCADE,
+    year smallint NOT NULL,
+    created_at timestamptz DEFAULT NOW(),
+    PRIMARY KEY (model_id, year)
+);
+CREATE INDEX IF NOT EXISTS idx_catalog_model_years_year ON catalog_model_years(year);
+
+-- +goose Down
+DROP TABLE IF EXISTS catalog_model_years;
+DROP TABLE IF EXISTS catalog_models;
+DROP TABLE IF EXISTS catalog_make_aliases;
+DROP TABLE IF EXISTS catalog_makes;
@@ -0,0 +1,38 @@
+-- +goose Up
+-- vehicle_specs holds the typed, metric version of the NHTSA vPIC data so it can be compared
+-- and filtered on. nhtsa_vpic_data remains the raw source.
+CREATE TABLE IF NOT EXISTS vehicle_specs (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    car_id uuid NOT NULL UNIQUE references cars(id),
+    displacement_l numeric(6, 3),
+    engine_cylinders smallint,
+    power_kw_min numeric(8, 2),
+    power_kw_max numeric(8, 2),
+    turbo boolean NOT NULL DEFAULT false,
+    drive_type varchar(16) NOT NULL DEFAULT 'unknown',
+    fuel_type_primary varchar(16) NOT NULL DEFAULT 'unknown',
+    fuel_type_secondary varchar(16) NOT NULL DEFAULT 'unknown',
+    transmission_type varchar(32) NOT NULL DEFAULT 'unknown',
+    transmission_speeds smallint,
+    wheelbase_mm_min numeric(8, 2),
+    wheelbase_mm_max numeric(8, 2),
+    track_width_mm numeric(8, 2),
+    curb_weight_kg numeric(8, 2),
+    gvwr_kg_min numeric(10, 2),
+    gvwr_kg_max numeric(10, 2),
+    wheel_size_front_in numeric(5, 2),
+    wheel_size_rear_in numeric(5, 2),
+    doors smallint,
+    seats smallint,
+    seat_rows smallint,
+    battery_kwh_min numeric(8, 2),
+    battery_kwh_max numeric(8, 2),
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_vehicle_specs_displacement_l ON vehicle_specs(displacement_l);
+CREATE INDEX IF NOT EXISTS idx_vehicle_specs_power_kw_max ON vehicle_specs(power_kw_max);
+
+-- +goose Down
+DROP TABLE IF EXISTS vehicle_specs;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- car_field_overrides records the car details where the owner kept their own value over the
+-- NHTSA decode of the VIN, ex. a trim NHTSA doesn't know about.
+CREATE TABLE IF NOT EXISTS car_field_overrides (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    car_id uuid NOT NULL references cars(id),
+    field varchar(32) NOT NULL,
+    provided_value varchar(256),
+    nhtsa_value varchar(256),
+    reason varchar(32),
+    created_by uuid NOT NULL,
+    created_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_car_field_overrides_car_id ON car_field_overrides(car_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS car_field_overrides;
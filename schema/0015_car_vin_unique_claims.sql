@@ -0,0 +1,79 @@
+-- +goose Up
+-- users_cars now keeps the ownership history of a car. The current owner is the row without
+-- an ended_at.
+ALTER TABLE users_cars ADD COLUMN IF NOT EXISTS ended_at timestamptz;
+
+-- merge cars that share a VIN into the first one created, keeping every history
+CREATE TEMPORARY TABLE duplicate_cars AS
+SELECT 
+    c.id AS duplicate_id,
+    canonical.id AS canonical_id
+FROM cars c
+JOIN (
+    SELECT DISTINCT ON (UPPER(TRIM(vin)))
+        id,
+        UPPER(TRIM(vin)) AS vin
+    FROM cars
+    WHERE vin IS NOT NULL AND TRIM(vin) <> ''
+    ORDER BY UPPER(TRIM(vin)), created_at ASC, id
+) canonical ON canonical.vin = UPPER(TRIM(c.vin))
+WHERE c.id <> canonical.id;
+
+UPDATE users_cars uc SET car_id = d.canonical_id FROM duplicate_cars d WHERE uc.car_id = d.duplicate_id;
+UPDATE service_logs sl SET car_id = d.canonical_id FROM duplicate_cars d WHERE sl.car_id = d.duplicate_id;
+UPDATE license_plates lp SET car_id = d.canonical_id FROM duplicate_cars d WHERE lp.car_id = d.duplicate_id;
+UPDATE nhtsa_vpic_data n SET car_id = d.canonical_id FROM duplicate_cars d WHERE n.car_id = d.duplicate_id;
+UPDATE car_field_overrides o SET car_id = d.canonical_id FROM duplicate_cars d WHERE o.car_id = d.duplicate_id;
+-- specs are derived from the nhtsa data, the canonical car's spec is kept
+DELETE FROM vehicle_specs vs USING duplicate_cars d WHERE vs.car_id = d.duplicate_id;
+DELETE FROM cars c USING duplicate_cars d WHERE c.id = d.duplicate_id;
+
+DROP TABLE duplicate_cars;
+
+-- the most recent owner of a merged car is the current owner
+UPDATE users_cars uc SET ended_at = next_owner.next_created_at
+FROM (
+    SELECT 
+        id,
+        LEAD(created_at) OVER (PARTITION BY car_id ORDER BY created_at, id) AS next_created_at
+    FROM users_cars
+) next_owner
+WHERE 
+    next_owner.id = uc.id AND 
+    next_owner.next_created_at IS NOT NULL AND
+    uc.ended_at IS NULL;
+
+UPDATE cars SET vin = UPPER(TRIM(vin)) WHERE vin IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_cars_vin;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cars_vin_unique ON cars(vin) WHERE vin IS NOT NULL AND vin <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_cars_current_owner ON users_cars(car_id) WHERE ended_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS car_claims (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    car_id uuid NOT NULL references cars(id),
+    claimant_user_id uuid NOT NULL,
+    -- owner: approved or rejected by the current owner
+    -- evidence: reviewed by an admin using the submitted evidence
+    method varchar(16) NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    evidence_notes text,
+    evidence_image_ids uuid[] NOT NULL DEFAULT '{}',
+    reviewed_by uuid,
+    reviewed_at timestamptz,
+    review_notes text,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_car_claims_car_id ON car_claims(car_id);
+CREATE INDEX IF NOT EXISTS idx_car_claims_claimant_user_id ON car_claims(claimant_user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_car_claims_pending ON car_claims(car_id, claimant_user_id) WHERE status = 'pending';
+
+-- +goose Down
+-- merged cars are not split back apart
+DROP TABLE IF EXISTS car_claims;
+DROP INDEX IF EXISTS idx_users_cars_current_owner;
+DROP INDEX IF EXISTS idx_cars_vin_unique;
+CREATE INDEX IF NOT EXISTS idx_cars_vin ON cars(vin);
+ALTER TABLE users_cars DROP COLUMN IF EXISTS ended_at;
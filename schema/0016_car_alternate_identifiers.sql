@@ -0,0 +1,22 @@
+-- +goose Up
+-- cars without a 17 character VIN, ex. pre-1981 or grey market imports, are identified by a
+-- chassis number, short VIN or frame number instead. These can't be decoded by NHTSA, so they
+-- are treated as unverified.
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS identifier_type varchar(16) NOT NULL DEFAULT 'vin';
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS identifier varchar(64);
+
+-- alternate identifiers are only unique per manufacturer, ex. two makes could both have
+-- chassis number 10001
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cars_identifier_unique ON cars(identifier_type, UPPER(make), identifier) 
+WHERE identifier IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_cars_identifier ON cars(identifier);
+
+-- specs for unverified cars are entered by the user instead of decoded from NHTSA
+ALTER TABLE vehicle_specs ADD COLUMN IF NOT EXISTS source varchar(16) NOT NULL DEFAULT 'nhtsa';
+
+-- +goose Down
+ALTER TABLE vehicle_specs DROP COLUMN IF EXISTS source;
+DROP INDEX IF EXISTS idx_cars_identifier;
+DROP INDEX IF EXISTS idx_cars_identifier_unique;
+ALTER TABLE cars DROP COLUMN IF EXISTS identifier;
+ALTER TABLE cars DROP COLUMN IF EXISTS identifier_type;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- refresh_tokens are opaque, single use tokens exchanged for new access JWTs. Only a hash of
+-- the token is stored. Every token rotated from the same login shares a family_id, so the
+-- family can be revoked together if a used token is presented again.
+CREATE TABLE IF NOT EXISTS auth.refresh_tokens (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    family_id uuid NOT NULL,
+    parent_id uuid references auth.refresh_tokens(id),
+    user_id uuid NOT NULL references auth.users(id),
+    token_hash varchar(64) NOT NULL UNIQUE,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON auth.refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON auth.refresh_tokens(user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.refresh_tokens;
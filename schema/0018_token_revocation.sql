@@ -0,0 +1,25 @@
+-- +goose Up
+-- revoked_tokens is the jti denylist for access JWTs. Entries only matter until the token
+-- expires.
+CREATE TABLE IF NOT EXISTS auth.revoked_tokens (
+    jti varchar(64) NOT NULL PRIMARY KEY,
+    user_id uuid,
+    expires_at timestamptz NOT NULL,
+    reason varchar(64),
+    created_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_created_at ON auth.revoked_tokens(created_at);
+
+-- user_token_revocations revokes every token issued to a user before issued_before, ex. after
+-- a password change
+CREATE TABLE IF NOT EXISTS auth.user_token_revocations (
+    user_id uuid NOT NULL PRIMARY KEY references auth.users(id),
+    issued_before timestamptz NOT NULL,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.user_token_revocations;
+DROP TABLE IF EXISTS auth.revoked_tokens;
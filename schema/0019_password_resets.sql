@@ -0,0 +1,24 @@
+-- +goose Up
+-- password_resets tracks a password reset from the security question challenge through to
+-- the new password being set. Only a hash of the reset token is stored.
+CREATE TABLE IF NOT EXISTS auth.password_resets (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_id uuid NOT NULL references auth.users(id),
+    question_ids uuid[] NOT NULL,
+    -- pending: waiting on answers
+    -- verified: answers were correct, the reset token can be used
+    -- completed: the password was reset
+    -- failed: too many wrong answers
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    failed_attempts integer NOT NULL DEFAULT 0,
+    expires_at timestamptz NOT NULL,
+    reset_token_hash varchar(64) UNIQUE,
+    reset_token_expires_at timestamptz,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id_created_at ON auth.password_resets(user_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.password_resets;
@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE auth.users ADD COLUMN IF NOT EXISTS email_verified_at timestamptz;
+
+-- email_changes tracks a change of a user's email address. The change is applied once both
+-- the old and new addresses have been confirmed.
+CREATE TABLE IF NOT EXISTS auth.email_changes (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_id uuid NOT NULL references auth.users(id),
+    old_email varchar(256) NOT NULL,
+    new_email varchar(256) NOT NULL,
+    old_confirmed_at timestamptz,
+    new_confirmed_at timestamptz,
+    completed_at timestamptz,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON auth.email_changes(user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.email_changes;
+
+ALTER TABLE auth.users DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- user_totp holds each user's TOTP secret. enabled_at is set once the user confirms enrollment
+-- with a valid code. last_used_step stops a code being used twice.
+CREATE TABLE IF NOT EXISTS auth.user_totp (
+    user_id uuid NOT NULL PRIMARY KEY references auth.users(id),
+    secret varchar(64) NOT NULL,
+    enabled_at timestamptz,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+-- mfa_recovery_codes are single use codes for when the user can't access their authenticator.
+-- Only a hash of each code is stored.
+CREATE TABLE IF NOT EXISTS auth.mfa_recovery_codes (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_id uuid NOT NULL references auth.users(id),
+    code_hash varchar(64) NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON auth.mfa_recovery_codes(user_id);
+
+-- mfa_challenges are issued by login when the user has 2FA enabled, and exchanged for tokens
+-- with a valid code
+CREATE TABLE IF NOT EXISTS auth.mfa_challenges (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_id uuid NOT NULL references auth.users(id),
+    token_hash varchar(64) NOT NULL UNIQUE,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    expires_at timestamptz NOT NULL,
+    completed_at timestamptz,
+    created_at timestamptz DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.mfa_challenges;
+DROP TABLE IF EXISTS auth.mfa_recovery_codes;
+DROP TABLE IF EXISTS auth.user_totp;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- webauthn_credentials are the passkeys users log in with
+CREATE TABLE IF NOT EXISTS auth.webauthn_credentials (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_id uuid NOT NULL references auth.users(id),
+    credential_id bytea NOT NULL UNIQUE,
+    -- COSE encoded public key
+    public_key bytea NOT NULL,
+    algorithm integer NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0,
+    aaguid bytea,
+    transports text[] NOT NULL DEFAULT '{}',
+    backup_eligible boolean NOT NULL DEFAULT false,
+    backed_up boolean NOT NULL DEFAULT false,
+    name varchar(64) NOT NULL DEFAULT '',
+    last_used_at timestamptz,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON auth.webauthn_credentials(user_id);
+
+-- webauthn_challenges are the challenges for registration and login ceremonies in progress.
+-- user_id is null for logins, where the user isn't known until they pick a passkey.
+CREATE TABLE IF NOT EXISTS auth.webauthn_challenges (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_id uuid references auth.users(id),
+    ceremony varchar(16) NOT NULL,
+    challenge bytea NOT NULL UNIQUE,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.webauthn_challenges;
+DROP TABLE IF EXISTS auth.webauthn_credentials;
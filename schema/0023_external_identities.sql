@@ -0,0 +1,35 @@
+-- +goose Up
+-- external_identities link users to the accounts they log in with at external OpenID Connect
+-- providers. subject is the provider's stable id for the account, emails can change.
+CREATE TABLE IF NOT EXISTS auth.external_identities (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_id uuid NOT NULL references auth.users(id),
+    provider varchar(64) NOT NULL,
+    subject varchar(255) NOT NULL,
+    email varchar(256) NOT NULL DEFAULT '',
+    last_login_at timestamptz,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_external_identities_user_id ON auth.external_identities(user_id);
+
+-- external_logins are logins with external providers in progress, between sending the user to
+-- the provider and them coming back. link_user_id is set when a logged in user is linking a
+-- provider to their account.
+CREATE TABLE IF NOT EXISTS auth.external_logins (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    state_hash varchar(64) NOT NULL UNIQUE,
+    provider varchar(64) NOT NULL,
+    nonce text NOT NULL,
+    code_verifier text NOT NULL,
+    link_user_id uuid references auth.users(id),
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.external_logins;
+DROP TABLE IF EXISTS auth.external_identities;
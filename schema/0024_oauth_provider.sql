@@ -0,0 +1,42 @@
+-- +goose Up
+-- oauth_clients are the apps registered to log users in through the auth server's OAuth2/OIDC
+-- endpoints. Public clients, like the web and mobile apps, have no secret and rely on PKCE.
+-- Only a hash of confidential clients' secrets is stored.
+CREATE TABLE IF NOT EXISTS auth.oauth_clients (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    client_id varchar(64) NOT NULL UNIQUE,
+    client_secret_hash varchar(64),
+    name varchar(128) NOT NULL,
+    redirect_uris text[] NOT NULL DEFAULT '{}',
+    scopes text[] NOT NULL DEFAULT '{}',
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+-- oauth_authorization_codes are the single use codes clients exchange for tokens. Codes are
+-- bound to the client, redirect uri and PKCE challenge they were issued for.
+CREATE TABLE IF NOT EXISTS auth.oauth_authorization_codes (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    code_hash varchar(64) NOT NULL UNIQUE,
+    client_id varchar(64) NOT NULL references auth.oauth_clients(client_id) ON DELETE CASCADE,
+    user_id uuid NOT NULL references auth.users(id),
+    redirect_uri text NOT NULL,
+    scope text NOT NULL DEFAULT '',
+    nonce text NOT NULL DEFAULT '',
+    code_challenge varchar(128) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz DEFAULT NOW()
+);
+
+-- refresh tokens issued to OAuth clients can only be used by that client, and keep the scopes
+-- it was granted
+ALTER TABLE auth.refresh_tokens ADD COLUMN IF NOT EXISTS client_id varchar(64);
+ALTER TABLE auth.refresh_tokens ADD COLUMN IF NOT EXISTS scope text;
+
+-- +goose Down
+ALTER TABLE auth.refresh_tokens DROP COLUMN IF EXISTS scope;
+ALTER TABLE auth.refresh_tokens DROP COLUMN IF EXISTS client_id;
+
+DROP TABLE IF EXISTS auth.oauth_authorization_codes;
+DROP TABLE IF EXISTS auth.oauth_clients;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- signing_keys is the auth server's keyring for signing tokens. Keys are created as the next
+-- key, published in the JWKS before they sign anything so verifiers already have them, then
+-- activated by rotation. The newest active key signs tokens. Superseded keys stay published
+-- until retired_at, so tokens they signed verify until they expire.
+-- Private keys are encrypted with the auth server's signing key encryption secret.
+CREATE TABLE IF NOT EXISTS auth.signing_keys (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    kid varchar(64) NOT NULL UNIQUE,
+    algorithm varchar(16) NOT NULL,
+    private_key bytea NOT NULL,
+    public_key bytea NOT NULL,
+    activated_at timestamptz,
+    retired_at timestamptz,
+    created_at timestamptz DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.signing_keys;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- users can hold several roles at once, ex. a user who is also a mechanic. Removing a role
+-- marks its row revoked instead of deleting it, so users_roles keeps the history.
+ALTER TABLE auth.users_roles ADD COLUMN IF NOT EXISTS revoked_at timestamptz;
+
+-- only the latest row was the user's role before, older rows are history
+UPDATE auth.users_roles ur
+SET revoked_at = NOW()
+WHERE ur.id <> (
+    SELECT latest.id
+    FROM auth.users_roles latest
+    WHERE latest.user_id = ur.user_id
+    ORDER BY latest.created_at DESC
+    LIMIT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_roles_active ON auth.users_roles(user_id, role_id) WHERE revoked_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS auth.idx_users_roles_active;
+ALTER TABLE auth.users_roles DROP COLUMN IF EXISTS revoked_at;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- personal_access_tokens are long lived tokens users create for scripts and integrations.
+-- They're limited to the scopes they were created with, and only a hash of the token is stored.
+CREATE TABLE IF NOT EXISTS auth.personal_access_tokens (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_id uuid NOT NULL references auth.users(id),
+    name varchar(128) NOT NULL,
+    token_hash varchar(64) NOT NULL UNIQUE,
+    scopes text[] NOT NULL DEFAULT '{}',
+    expires_at timestamptz NOT NULL,
+    last_used_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON auth.personal_access_tokens(user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.personal_access_tokens;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- login_throttles count recent failed logins per account and per IP address, so every replica
+-- of the auth server enforces the same delays and lockouts. Unknown usernames are tracked like
+-- accounts, so throttling doesn't reveal which accounts exist.
+CREATE TABLE IF NOT EXISTS auth.login_throttles (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    kind varchar(16) NOT NULL,
+    key text NOT NULL,
+    failed_attempts int NOT NULL DEFAULT 0,
+    last_failed_at timestamptz NOT NULL,
+    locked_until timestamptz,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW(),
+    UNIQUE (kind, key)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.login_throttles;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- profile preferences
+ALTER TABLE auth.users ADD COLUMN IF NOT EXISTS distance_unit varchar(8) NOT NULL DEFAULT 'mi';
+ALTER TABLE auth.users ADD COLUMN IF NOT EXISTS volume_unit varchar(8) NOT NULL DEFAULT 'gal';
+ALTER TABLE auth.users ADD COLUMN IF NOT EXISTS notify_service_reminders boolean NOT NULL DEFAULT true;
+ALTER TABLE auth.users ADD COLUMN IF NOT EXISTS notify_product_updates boolean NOT NULL DEFAULT false;
+
+-- a deleted account is kept, anonymized, so the rows that reference it stay valid. Deletion is
+-- scheduled first, the user can cancel it until deletion_scheduled_at.
+ALTER TABLE auth.users ADD COLUMN IF NOT EXISTS deletion_scheduled_at timestamptz;
+ALTER TABLE auth.users ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON auth.users(deletion_scheduled_at) 
+WHERE deletion_scheduled_at IS NOT NULL AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON auth.users(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS auth.idx_users_deleted_at;
+DROP INDEX IF EXISTS auth.idx_users_deletion_scheduled_at;
+ALTER TABLE auth.users DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE auth.users DROP COLUMN IF EXISTS deletion_scheduled_at;
+ALTER TABLE auth.users DROP COLUMN IF EXISTS notify_product_updates;
+ALTER TABLE auth.users DROP COLUMN IF EXISTS notify_service_reminders;
+ALTER TABLE auth.users DROP COLUMN IF EXISTS volume_unit;
+ALTER TABLE auth.users DROP COLUMN IF EXISTS distance_unit;
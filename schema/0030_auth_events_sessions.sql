@@ -0,0 +1,38 @@
+-- +goose Up
+-- auth_events is the audit trail of logins, signups, password changes and token refreshes and
+-- revocations. user_id is empty for failed logins that don't match a user, login is what was
+-- typed in.
+CREATE TABLE IF NOT EXISTS auth.auth_events (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    event_type varchar(32) NOT NULL,
+    user_id uuid references auth.users(id),
+    login varchar(320),
+    detail varchar(64),
+    ip_address varchar(64),
+    user_agent varchar(512),
+    request_id varchar(64),
+    created_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_events_user_id_created_at ON auth.auth_events(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_auth_events_created_at ON auth.auth_events(created_at);
+
+-- sessions are the devices a user is logged in on, one per refresh token family. The latest
+-- access token issued to the session is kept so signing the device out revokes it too.
+CREATE TABLE IF NOT EXISTS auth.sessions (
+    id uuid NOT NULL PRIMARY KEY,
+    user_id uuid NOT NULL references auth.users(id),
+    ip_address varchar(64),
+    user_agent varchar(512),
+    access_token_id varchar(64),
+    access_token_expires_at timestamptz,
+    last_used_at timestamptz NOT NULL DEFAULT NOW(),
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON auth.sessions(user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.sessions;
+DROP TABLE IF EXISTS auth.auth_events;
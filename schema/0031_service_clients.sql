@@ -0,0 +1,10 @@
+-- +goose Up
+-- service clients are the autolog services registered to call each other with the client
+-- credentials grant. Their tokens are only valid for the audiences, the services, they may call,
+-- and grant only the permissions listed here.
+ALTER TABLE auth.oauth_clients ADD COLUMN IF NOT EXISTS audiences text[] NOT NULL DEFAULT '{}';
+ALTER TABLE auth.oauth_clients ADD COLUMN IF NOT EXISTS permissions text[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE auth.oauth_clients DROP COLUMN IF EXISTS permissions;
+ALTER TABLE auth.oauth_clients DROP COLUMN IF EXISTS audiences;
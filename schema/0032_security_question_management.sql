@@ -0,0 +1,21 @@
+-- +goose Up
+-- custom security questions are written by a user and only offered to them, user_id is null for
+-- the questions everyone can pick from. Retired questions can't be picked anymore, users who
+-- already have one keep answering it until they replace their questions.
+ALTER TABLE auth.security_questions ADD COLUMN IF NOT EXISTS user_id uuid references auth.users(id);
+ALTER TABLE auth.security_questions ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+ALTER TABLE auth.security_questions ADD COLUMN IF NOT EXISTS updated_at timestamptz DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_security_questions_user_id ON auth.security_questions(user_id)
+WHERE user_id IS NOT NULL;
+
+-- answers are hashed lowercase with whitespace collapsed, so "Boston " matches "boston". Answers
+-- hashed before that are checked as they were typed, and rehashed once answered correctly.
+ALTER TABLE auth.users_security_questions ADD COLUMN IF NOT EXISTS answer_normalized boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE auth.users_security_questions DROP COLUMN IF EXISTS answer_normalized;
+DROP INDEX IF EXISTS auth.idx_security_questions_user_id;
+ALTER TABLE auth.security_questions DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE auth.security_questions DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE auth.security_questions DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- shop owners invite people by email, whether or not they have an account yet. The invitee
+-- accepts with the signed token emailed to them, which creates their employees row.
+CREATE TABLE IF NOT EXISTS shop_invitations (
+    id uuid NOT NULL DEFAULT gen_random_uuid() PRIMARY KEY,
+    shop_id uuid NOT NULL references shops(id),
+    email varchar(256) NOT NULL,
+    "role" varchar(64) NOT NULL,
+    invited_by uuid NOT NULL references auth.users(id),
+    expires_at timestamptz NOT NULL,
+    accepted_by uuid references auth.users(id),
+    accepted_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz DEFAULT NOW(),
+    updated_at timestamptz DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_shop_invitations_shop_id ON shop_invitations(shop_id);
+
+-- removed employees are kept so the service work they logged still points at them. A user works
+-- at a shop at most once at a time.
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS removed_at timestamptz;
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS removed_by uuid references auth.users(id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_employees_shop_id_user_id ON employees(shop_id, user_id)
+WHERE removed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_employees_user_id ON employees(user_id) WHERE removed_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_employees_user_id;
+DROP INDEX IF EXISTS idx_employees_shop_id_user_id;
+ALTER TABLE employees DROP COLUMN IF EXISTS removed_by;
+ALTER TABLE employees DROP COLUMN IF EXISTS removed_at;
+DROP TABLE IF EXISTS shop_invitations;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- shops are searched by name, city and zip with trigram matching, so misspellings and partial
+-- names still match
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS search_text text GENERATED ALWAYS AS (
+    lower(coalesce(name, '') || ' ' || coalesce(city, '') || ' ' || coalesce(zip, ''))
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_shops_search_text ON shops USING gin (search_text gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_shops_search_text;
+ALTER TABLE shops DROP COLUMN IF EXISTS search_text;
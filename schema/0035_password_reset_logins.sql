@@ -0,0 +1,14 @@
+-- +goose Up
+-- password resets are limited by the login they were started with, before it's looked up, so
+-- unknown logins are limited the same as accounts. Resets for unknown logins are stored as decoys
+-- without a user, they can be answered but never passed.
+ALTER TABLE auth.password_resets ADD COLUMN IF NOT EXISTS login varchar(256);
+ALTER TABLE auth.password_resets ALTER COLUMN user_id DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_password_resets_login_created_at ON auth.password_resets(login, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS auth.idx_password_resets_login_created_at;
+DELETE FROM auth.password_resets WHERE user_id IS NULL;
+ALTER TABLE auth.password_resets ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE auth.password_resets DROP COLUMN IF EXISTS login;
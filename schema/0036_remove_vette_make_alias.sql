@@ -0,0 +1,7 @@
+-- +goose Up
+-- "vette" is a nickname for the Corvette model, not the Chevrolet make. It was seeded as a make
+-- alias by 0012 before it was removed there.
+DELETE FROM catalog_make_aliases WHERE alias = 'vette';
+
+-- +goose Down
+-- the alias isn't restored, it was never a make alias
@@ -0,0 +1,8 @@
+-- +goose Up
+-- roles a service client granted, ex. mechanic for shop employees, record the client. Services
+-- can only revoke the roles they granted, so a role an admin granted outlives a shop job. Roles
+-- granted before this are treated as granted by an admin.
+ALTER TABLE auth.users_roles ADD COLUMN IF NOT EXISTS granted_by_client_id varchar(64);
+
+-- +goose Down
+ALTER TABLE auth.users_roles DROP COLUMN IF EXISTS granted_by_client_id;